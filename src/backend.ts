@@ -0,0 +1,126 @@
+/**
+ * @fileoverview Printing backend selection.
+ * The tools submit, list, inspect, release, and cancel jobs through a PrintBackend, so the same
+ * tool behavior works on CUPS (Linux/macOS), the Windows print spooler, and the virtual PDF
+ * printer used for development and tests.
+ */
+
+import { config } from "./config.js"
+import * as cups from "./cups.js"
+import * as pdf from "./pdf-backend.js"
+import * as windows from "./windows.js"
+import type { JobStatus, LpJobOptions, PrinterSummary } from "./cups.js"
+
+/**
+ * Available printing backends.
+ */
+export const BACKEND_NAMES = ["cups", "windows", "pdf"] as const
+
+/**
+ * A printing backend.
+ */
+export type BackendName = (typeof BACKEND_NAMES)[number]
+
+/**
+ * Operations the tools need from the local printing system.
+ * Job IDs have the form "<printer>-<number>" on every backend. Each operation takes an optional
+ * signal that cancels it; the backend also stops it once its timeout passes.
+ */
+export interface PrintBackend {
+  /** Backend name */
+  name: BackendName
+  /** Submits a job and returns its job ID */
+  submitJob(job: LpJobOptions, signal?: AbortSignal): Promise<string>
+  /** Lists the printers with their description, state, and default status */
+  listPrinters(signal?: AbortSignal): Promise<PrinterSummary[]>
+  /** Looks up a job, reporting state "not-found" for jobs the backend no longer knows about */
+  getJobStatus(jobId: string, signal?: AbortSignal): Promise<JobStatus>
+  /** Releases a held job so it prints */
+  releaseJob(jobId: string, signal?: AbortSignal): Promise<void>
+  /** Cancels a single job */
+  cancelJob(jobId: string, signal?: AbortSignal): Promise<void>
+  /** Cancels every job queued on a printer */
+  cancelAllJobs(printer: string, signal?: AbortSignal): Promise<void>
+}
+
+/**
+ * CUPS backend (lp, lpstat, cancel).
+ */
+const cupsBackend: PrintBackend = {
+  name: "cups",
+  submitJob: (job, signal) => cups.submitLpJob(job, signal),
+  listPrinters: (signal) => cups.listPrinters(signal),
+  getJobStatus: (jobId, signal) => cups.getJobStatus(jobId, signal),
+  releaseJob: (jobId, signal) => cups.releaseJob(jobId, signal),
+  cancelJob: (jobId, signal) => cups.cancelJob(jobId, signal),
+  cancelAllJobs: (printer, signal) => cups.cancelAllJobs(printer, signal),
+}
+
+/**
+ * Windows print spooler backend (winspool via PowerShell).
+ */
+const windowsBackend: PrintBackend = {
+  name: "windows",
+  submitJob: (job, signal) => windows.submitWindowsJob(job, signal),
+  listPrinters: (signal) => windows.listWindowsPrinters(signal),
+  getJobStatus: (jobId, signal) => windows.getWindowsJobStatus(jobId, signal),
+  releaseJob: (jobId, signal) => windows.releaseWindowsJob(jobId, signal),
+  cancelJob: (jobId, signal) => windows.cancelWindowsJob(jobId, signal),
+  cancelAllJobs: (printer, signal) => windows.cancelAllWindowsJobs(printer, signal),
+}
+
+/**
+ * Virtual PDF printer backend (writes documents to MCP_PRINTER_PDF_OUTPUT_DIR).
+ */
+const pdfBackend: PrintBackend = {
+  name: "pdf",
+  submitJob: (job, signal) => pdf.submitPdfJob(job, signal),
+  listPrinters: () => Promise.resolve(pdf.listPdfPrinters()),
+  getJobStatus: (jobId) => Promise.resolve(pdf.getPdfJobStatus(jobId)),
+  releaseJob: (jobId) => Promise.resolve().then(() => pdf.releasePdfJob(jobId)),
+  cancelJob: (jobId) => pdf.cancelPdfJob(jobId),
+  cancelAllJobs: (printer) => pdf.cancelAllPdfJobs(printer),
+}
+
+/** Backends by name. */
+const BACKENDS: Record<BackendName, PrintBackend> = {
+  cups: cupsBackend,
+  windows: windowsBackend,
+  pdf: pdfBackend,
+}
+
+/**
+ * Resolves the MCP_PRINTER_BACKEND setting to a backend name.
+ * "auto" (or an empty setting) picks the Windows spooler on Windows and CUPS everywhere else.
+ *
+ * @param setting - Configured backend ("auto", "cups", "windows", or "pdf")
+ * @param platform - Operating system (default: the current one)
+ * @returns The backend to use
+ * @throws {Error} If the setting is not a known backend
+ */
+export function selectBackendName(
+  setting = "auto",
+  platform: NodeJS.Platform = process.platform
+): BackendName {
+  const value = setting.trim().toLowerCase()
+  if (value === "" || value === "auto") {
+    return platform === "win32" ? "windows" : "cups"
+  }
+  if (!(BACKEND_NAMES as readonly string[]).includes(value)) {
+    const choices = ["auto", ...BACKEND_NAMES]
+    throw new Error(
+      `Unknown printing backend "${setting}". Set MCP_PRINTER_BACKEND to ${choices.slice(0, -1).join(", ")}, or ${choices[choices.length - 1]}.`
+    )
+  }
+  return value as BackendName
+}
+
+/**
+ * Returns the printing backend selected by MCP_PRINTER_BACKEND.
+ *
+ * @returns The backend to submit, list, inspect, and cancel jobs with
+ * @throws {Error} If MCP_PRINTER_BACKEND is not a known backend
+ */
+export function getBackend(): PrintBackend {
+  return BACKENDS[selectBackendName(config.backend)]
+}
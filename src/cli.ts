@@ -0,0 +1,78 @@
+/**
+ * @fileoverview Command-line argument parsing for the server entry point.
+ * Supports `--transport=stdio|http` (stdio by default, so existing MCP client configs keep
+ * working) and `--listen=[host]:port` for the HTTP transport.
+ */
+
+import { parseArgs } from "util"
+
+/** Transports the server can run on. */
+export const TRANSPORTS = ["stdio", "http"] as const
+export type Transport = (typeof TRANSPORTS)[number]
+
+/** Address the HTTP transport listens on when --listen is not given (local connections only). */
+export const DEFAULT_LISTEN = "127.0.0.1:8080"
+
+/**
+ * Host and port to listen on.
+ */
+export interface ListenAddress {
+  /** Host to bind, or undefined to listen on all interfaces */
+  host?: string
+  port: number
+}
+
+/**
+ * Options parsed from the command line.
+ */
+export interface CliOptions {
+  transport: Transport
+  listen: ListenAddress
+}
+
+/**
+ * Parses a listen address: `:8080` (all interfaces), `127.0.0.1:8080`, `[::1]:8080`, or `8080`.
+ *
+ * @param listen - Listen address
+ * @returns Host and port
+ * @throws {Error} If the address or port is invalid
+ */
+export function parseListenAddress(listen: string): ListenAddress {
+  const match = listen.match(/^(?:(\[[^\]]+\]|[^:]*):)?(\d+)$/)
+  const port = match ? parseInt(match[2], 10) : NaN
+  if (!match || port < 1 || port > 65535) {
+    throw new Error(
+      `Invalid --listen address "${listen}". Use [host]:port, e.g. ":8080" or "127.0.0.1:8080".`
+    )
+  }
+
+  const host = match[1]?.replace(/^\[|\]$/g, "")
+  return host ? { host, port } : { port }
+}
+
+/**
+ * Parses the server's command-line arguments.
+ *
+ * @param args - Arguments after the script name (process.argv.slice(2))
+ * @returns Parsed options
+ * @throws {Error} If an argument is unknown or invalid
+ */
+export function parseCliArgs(args: string[]): CliOptions {
+  const { values } = parseArgs({
+    args,
+    options: {
+      transport: { type: "string", default: "stdio" },
+      listen: { type: "string", default: DEFAULT_LISTEN },
+    },
+    strict: true,
+  })
+
+  const transport = values.transport as Transport
+  if (!TRANSPORTS.includes(transport)) {
+    throw new Error(
+      `Invalid --transport "${values.transport}". Expected one of: ${TRANSPORTS.join(", ")}`
+    )
+  }
+
+  return { transport, listen: parseListenAddress(values.listen as string) }
+}
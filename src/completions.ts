@@ -0,0 +1,86 @@
+/**
+ * @fileoverview Argument completion (completion/complete).
+ * Printer arguments complete from the allowed printers and media arguments from the media
+ * sizes the chosen printer supports. Clients ask for completions on every keystroke, so the
+ * printer list and capabilities are kept for a few seconds instead of running lpstat and
+ * lpoptions each time.
+ */
+
+import { getBackend } from "./backend.js"
+import { filterAllowedPrinters } from "./printer-access.js"
+import { getPrinterInfo } from "./printer-info.js"
+import { MEDIA_SIZES } from "./print-options.js"
+
+/** How long a printer listing or printer's capabilities are reused, in milliseconds. */
+export const COMPLETION_CACHE_MS = 5000
+
+const cache = new Map<string, { loadedAt: number; value: Promise<unknown> }>()
+
+/**
+ * Loads a value, reusing the last one loaded for the key for COMPLETION_CACHE_MS. A load that
+ * fails isn't kept, so the next completion tries again.
+ */
+function cached<T>(key: string, load: () => Promise<T>): Promise<T> {
+  const hit = cache.get(key)
+  if (hit && Date.now() - hit.loadedAt < COMPLETION_CACHE_MS) {
+    return hit.value as Promise<T>
+  }
+  const entry = { loadedAt: Date.now(), value: load() }
+  cache.set(key, entry)
+  void entry.value.catch(() => {
+    if (cache.get(key) === entry) {
+      cache.delete(key)
+    }
+  })
+  return entry.value
+}
+
+/**
+ * Completes a printer argument from the allowed printers. Printers that can't be listed give
+ * no suggestions rather than an error.
+ *
+ * @param value - What the user has typed so far
+ * @returns Allowed printer names starting with it (case-insensitive)
+ */
+export async function completePrinterNames(value: string | undefined): Promise<string[]> {
+  const prefix = (value ?? "").toLowerCase()
+  try {
+    const printers = filterAllowedPrinters(
+      await cached("printers", () => getBackend().listPrinters())
+    )
+    return printers
+      .map((printer) => printer.name)
+      .filter((name) => name.toLowerCase().startsWith(prefix))
+  } catch {
+    return []
+  }
+}
+
+/**
+ * Completes a media argument with the sizes the media option accepts that the printer
+ * supports. Without a printer, or when the printer can't be asked, every size is suggested.
+ *
+ * @param value - What the user has typed so far
+ * @param printer - The printer argument given with it, if any
+ * @returns Media sizes starting with it (case-insensitive)
+ */
+export async function completeMediaSizes(
+  value: string | undefined,
+  printer?: string
+): Promise<string[]> {
+  const prefix = (value ?? "").toLowerCase()
+  let sizes: string[] = [...MEDIA_SIZES]
+  if (printer?.trim()) {
+    try {
+      const name = printer.trim()
+      const info = await cached(`printer:${name}`, () => getPrinterInfo(name))
+      const supported = info.media_sizes.map((size) => size.toLowerCase())
+      if (supported.length > 0) {
+        sizes = sizes.filter((size) => supported.includes(size.toLowerCase()))
+      }
+    } catch {
+      // Fall back to every size
+    }
+  }
+  return sizes.filter((size) => size.toLowerCase().startsWith(prefix))
+}
@@ -1,14 +1,240 @@
 import yn from "yn"
-import { homedir } from "os"
+import { readFileSync } from "fs"
+import { homedir, tmpdir } from "os"
 import { join } from "path"
 import { parseDelimitedString } from "./utils.js"
 
+/** Log levels, from most to least verbose. */
+export const LOG_LEVELS = ["debug", "info", "warn", "error"] as const
+export type LogLevel = (typeof LOG_LEVELS)[number]
+
+/**
+ * Checks whether a value is a log level.
+ */
+function isLogLevel(value: unknown): value is LogLevel {
+  return LOG_LEVELS.includes(value as LogLevel)
+}
+
+/**
+ * Parses MCP_PRINTER_LOG_LEVEL, falling back to the config file's level.
+ *
+ * @param value - The environment variable's value
+ * @param fallback - Level to use when it's unset
+ * @returns The log level ("warning" is accepted for "warn")
+ * @throws {Error} If the value isn't a log level
+ */
+export function parseLogLevel(value: string | undefined, fallback: LogLevel): LogLevel {
+  if (!value) {
+    return fallback
+  }
+  const level = value.toLowerCase() === "warning" ? "warn" : value.toLowerCase()
+  if (!isLogLevel(level)) {
+    throw new Error(
+      `Invalid MCP_PRINTER_LOG_LEVEL "${value}". Use one of ${LOG_LEVELS.join(", ")}.`
+    )
+  }
+  return level
+}
+
+/**
+ * How cover pages are printed: generated as the first page of the PDF, or as a CUPS banner
+ * page (job-sheets).
+ */
+export const COVER_PAGE_MODES = ["generate", "job-sheets"] as const
+export type CoverPageMode = (typeof COVER_PAGE_MODES)[number]
+
+/**
+ * Checks whether a value is a cover page mode.
+ */
+function isCoverPageMode(value: unknown): value is CoverPageMode {
+  return COVER_PAGE_MODES.includes(value as CoverPageMode)
+}
+
+/**
+ * Parses MCP_PRINTER_COVER_PAGE_MODE, falling back to the config file's mode.
+ *
+ * @param value - The environment variable's value
+ * @param fallback - Mode to use when it's unset
+ * @returns The cover page mode
+ * @throws {Error} If the value isn't a cover page mode
+ */
+export function parseCoverPageMode(
+  value: string | undefined,
+  fallback: CoverPageMode
+): CoverPageMode {
+  if (!value) {
+    return fallback
+  }
+  const mode = value.toLowerCase()
+  if (!isCoverPageMode(mode)) {
+    throw new Error(
+      `Invalid MCP_PRINTER_COVER_PAGE_MODE "${value}". Use one of ${COVER_PAGE_MODES.join(", ")}.`
+    )
+  }
+  return mode
+}
+
+/**
+ * When the CUPS commands encrypt their connection to the CUPS server (CUPS_ENCRYPTION).
+ */
+export const CUPS_ENCRYPTIONS = ["never", "ifrequested", "always"] as const
+export type CupsEncryption = (typeof CUPS_ENCRYPTIONS)[number]
+
 /**
- * Configuration interface for MCP Printer settings loaded from environment variables.
+ * Checks whether a value is a CUPS encryption setting.
+ */
+function isCupsEncryption(value: unknown): value is CupsEncryption {
+  return CUPS_ENCRYPTIONS.includes(value as CupsEncryption)
+}
+
+/**
+ * Parses MCP_PRINTER_CUPS_ENCRYPTION, falling back to the config file's setting.
+ *
+ * @param value - The environment variable's value
+ * @param fallback - Setting to use when it's unset
+ * @returns The encryption setting
+ * @throws {Error} If the value isn't a CUPS encryption setting
+ */
+export function parseCupsEncryption(
+  value: string | undefined,
+  fallback: CupsEncryption
+): CupsEncryption {
+  if (!value) {
+    return fallback
+  }
+  const encryption = value.toLowerCase()
+  if (!isCupsEncryption(encryption)) {
+    throw new Error(
+      `Invalid MCP_PRINTER_CUPS_ENCRYPTION "${value}". Use one of ${CUPS_ENCRYPTIONS.join(", ")}.`
+    )
+  }
+  return encryption
+}
+
+/**
+ * Whom the print quotas are counted for: every client together, or each MCP session on its own.
+ */
+export const QUOTA_SCOPES = ["global", "session"] as const
+export type QuotaScope = (typeof QUOTA_SCOPES)[number]
+
+/**
+ * Checks whether a value is a quota scope.
+ */
+function isQuotaScope(value: unknown): value is QuotaScope {
+  return QUOTA_SCOPES.includes(value as QuotaScope)
+}
+
+/**
+ * Parses MCP_PRINTER_QUOTA_SCOPE, falling back to the config file's scope.
+ *
+ * @param value - The environment variable's value
+ * @param fallback - Scope to use when it's unset
+ * @returns The quota scope
+ * @throws {Error} If the value isn't a quota scope
+ */
+export function parseQuotaScope(value: string | undefined, fallback: QuotaScope): QuotaScope {
+  if (!value) {
+    return fallback
+  }
+  const scope = value.toLowerCase()
+  if (!isQuotaScope(scope)) {
+    throw new Error(
+      `Invalid MCP_PRINTER_QUOTA_SCOPE "${value}". Use one of ${QUOTA_SCOPES.join(", ")}.`
+    )
+  }
+  return scope
+}
+
+/**
+ * Parses MCP_PRINTER_ALLOWED_PATHS (colon-separated), falling back to the config file's
+ * allowed_paths and then to the default directories. `~`, $HOME, and ${HOME} are expanded.
+ *
+ * @param value - The environment variable's value
+ * @param filePaths - The config file's allowed_paths
+ * @returns The directories files may be printed from
+ */
+export function parseAllowedPaths(value: string | undefined, filePaths: string[] = []): string[] {
+  const envPaths = parseDelimitedString(value, ":")
+  const paths = envPaths.length > 0 ? envPaths : filePaths.filter((path) => path.trim() !== "")
+  return paths.length > 0 ? paths.map(expandEnvVars) : [...defaultAllowedPaths]
+}
+
+/**
+ * Configuration interface for MCP Printer settings loaded from environment variables
+ * and the optional config file.
  */
 export interface Config {
+  /** Path to the JSON config file, if one was loaded */
+  configFile: string
+  /**
+   * Printing backend: "auto" (Windows spooler on Windows, CUPS elsewhere), "cups", "windows", or
+   * "pdf" (a virtual printer that writes documents to pdfOutputDir)
+   */
+  backend: string
+  /** Directory the pdf backend's virtual printer writes documents to */
+  pdfOutputDir: string
+  /** Seconds a virtual PDF job takes to go from pending to completed (0 = right away) */
+  pdfJobDelaySeconds: number
+  /** CUPS server the CUPS commands talk to, as host or host:port (empty string = the local one) */
+  cupsServer: string
+  /** When the connection to the CUPS server is encrypted: "never", "ifrequested", or "always" */
+  cupsEncryption: CupsEncryption
   /** Default printer name for print operations */
   defaultPrinter: string
+  /** Printers the tools may use (empty = all printers allowed) */
+  allowedPrinters: string[]
+  /** Printers raw jobs may be sent to, untouched by filters (empty = raw printing is off) */
+  rawAllowedPrinters: string[]
+  /** Skip TLS certificate verification for ipps:// printer URIs (for self-signed certificates) */
+  ippInsecureTls: boolean
+  /** Allow print_url to fetch localhost and private network addresses */
+  allowPrivateUrls: boolean
+  /** Timeout for fetching a URL with print_url, in seconds */
+  urlTimeoutSeconds: number
+  /** Maximum size of a document fetched with print_url, in megabytes */
+  urlMaxSizeMb: number
+  /** Maximum size of a document sent to print_data, in bytes once decoded */
+  maxUploadBytes: number
+  /** Timeout for submitting a job (lp, the Windows spooler, or IPP), in seconds (0 = none) */
+  submitTimeoutSeconds: number
+  /** Timeout for printer and job queries and cancellation, in seconds (0 = none) */
+  statusTimeoutSeconds: number
+  /** LibreOffice (soffice) executable that converts office documents to PDF ("" = none) */
+  libreofficePath: string
+  /** Timeout for converting an office document to PDF, in seconds (0 = none) */
+  convertTimeoutSeconds: number
+  /** Time the server waits at shutdown for renders and submissions to finish, in seconds */
+  shutdownTimeoutSeconds: number
+  /** Times a queued job is submitted again after a transient failure (0 = never) */
+  maxRetries: number
+  /** Delay before the first retry, in seconds; each retry after it waits twice as long */
+  retryDelaySeconds: number
+  /** Lowest level of log records written: "debug", "info", "warn", or "error" */
+  logLevel: LogLevel
+  /** File log records are appended to (empty string = stderr) */
+  logFile: string
+  /** Seconds between the status monitor's checks of printers and jobs (0 = off) */
+  monitorIntervalSeconds: number
+  /** Directory where dry-run previews are written */
+  previewDir: string
+  /** Work directory every render's temp files are written under, a subdirectory per render */
+  tempDir: string
+  /** Hours after which directories left in tempDir are removed at startup (0 = never) */
+  tempMaxAgeHours: number
+  /** Megabytes tempDir may hold before new renders are refused (0 = no limit) */
+  tempMaxMb: number
+  /** JSON file where submitted jobs are recorded for list_recent_jobs */
+  historyFile: string
+  /** Bearer token required by the HTTP transport (empty string disables authentication) */
+  authToken: string
+  /** Minutes an HTTP session may be idle before it is closed (0 = never) */
+  sessionTtlMinutes: number
+  /** Margin around images rendered to PDF, in millimeters */
+  imageMarginMm: number
+  /** Header template for rendered markdown, code, and text (empty string = no header) */
+  header: string
+  /** Footer template for rendered markdown, code, and text (empty string = no footer) */
+  footer: string
   /** Automatically enable duplex (two-sided) printing by default (can be overridden per-call) */
   autoDuplex: boolean
   /** Default CUPS printing options (array of option strings) */
@@ -19,6 +245,8 @@ export interface Config {
   autoRenderMarkdown: boolean
   /** Automatically render code files to PDF with syntax highlighting (can be overridden per-call) */
   autoRenderCode: boolean
+  /** Automatically render plain text files to PDF (wrapped, with tabs expanded) */
+  autoRenderText: boolean
   /** Enable management operations (set_default_printer, cancel_print_job) */
   enableManagement: boolean
   /** Enable prompts (workflow templates that appear as slash commands) */
@@ -31,8 +259,36 @@ export interface Config {
   deniedPaths: string[]
   /** Maximum number of copies allowed per print job (0 or negative means unlimited) */
   maxCopies: number
+  /** PDF renders (Chrome or LibreOffice runs) allowed at once (0 or negative means unlimited) */
+  maxConcurrentRenders: number
   /** Threshold for page count confirmation. If physical sheets exceed this, print job returns preview instead. 0 = disabled. */
   confirmIfOverPages: number
+  /** Pages a job may print without confirm_large_job (0 = no limit) */
+  maxPagesPerJob: number
+  /** Pages a job may print even with confirm_large_job (0 = no ceiling) */
+  absoluteMaxPages: number
+  /** Jobs that may be printed in each clock hour (0 = no quota) */
+  maxJobsPerHour: number
+  /** Pages that may be printed each day, from local midnight (0 = no quota) */
+  maxPagesPerDay: number
+  /** Whether the quotas are counted for all clients together or for each session */
+  quotaScope: QuotaScope
+  /** Jobs each MCP session may queue per minute, in bursts up to as many (0 = no limit) */
+  maxJobsPerMinute: number
+  /** Seconds in which a job identical to one just queued returns that job instead (0 = off) */
+  dedupeWindowSeconds: number
+  /** Price of a black-and-white printed side, for estimate_job (0 = no cost estimate) */
+  costPerPage: number
+  /** Price of a printed side with color on it, for estimate_job (defaults to costPerPage) */
+  costPerColorPage: number
+  /** Currency shown with estimated costs (e.g., "USD"; empty string = none) */
+  costCurrency: string
+  /** Start every job with a cover page (can be overridden per-call with cover_page) */
+  coverPage: boolean
+  /** How cover pages are printed: "generate" or "job-sheets" (CUPS banner page) */
+  coverPageMode: CoverPageMode
+  /** Owner named on cover pages (empty string = the user running the server) */
+  jobOwner: string
   /** Code rendering configuration */
   code: {
     /** File extensions to exclude from code rendering. All enabled by default. */
@@ -48,6 +304,299 @@ export interface Config {
   }
 }
 
+/**
+ * Settings that can be provided in the optional JSON config file (MCP_PRINTER_CONFIG_FILE).
+ * Environment variables take precedence over values from the file.
+ */
+export interface FileConfig {
+  /** Printing backend (same as MCP_PRINTER_BACKEND) */
+  backend?: string
+  /** Where the pdf backend writes documents (same as MCP_PRINTER_PDF_OUTPUT_DIR) */
+  pdf_output_dir?: string
+  /** CUPS server to print through (same as MCP_PRINTER_CUPS_SERVER) */
+  cups_server?: string
+  /** Encryption of the connection to the CUPS server (same as MCP_PRINTER_CUPS_ENCRYPTION) */
+  cups_encryption?: CupsEncryption
+  /** Default printer name (same as MCP_PRINTER_DEFAULT_PRINTER) */
+  default_printer?: string
+  /** Printers the tools may use (same as MCP_PRINTER_ALLOWED_PRINTERS) */
+  allowed_printers?: string[]
+  /** Printers raw jobs may be sent to (same as MCP_PRINTER_RAW_ALLOWED_PRINTERS) */
+  raw_allowed_printers?: string[]
+  /** Directories files may be printed from (same as MCP_PRINTER_ALLOWED_PATHS) */
+  allowed_paths?: string[]
+  /** Allow print_url to fetch private addresses (same as MCP_PRINTER_ALLOW_PRIVATE_URLS) */
+  allow_private_urls?: boolean
+  /** Bearer token for the HTTP transport (same as MCP_PRINTER_AUTH_TOKEN) */
+  auth_token?: string
+  /** Idle time before an HTTP session is closed (same as MCP_PRINTER_SESSION_TTL_MINUTES) */
+  session_ttl_minutes?: number
+  /** PDF renders allowed at once (same as MCP_PRINTER_MAX_CONCURRENT_RENDERS) */
+  max_concurrent_renders?: number
+  /** Lowest level of log records written (same as MCP_PRINTER_LOG_LEVEL) */
+  log_level?: LogLevel
+  /** File log records are appended to (same as MCP_PRINTER_LOG_FILE) */
+  log_file?: string
+  /** Pages a job may print (same as MCP_PRINTER_MAX_PAGES_PER_JOB) */
+  max_pages_per_job?: number
+  /** Pages a job may print with confirm_large_job (same as MCP_PRINTER_ABSOLUTE_MAX_PAGES) */
+  absolute_max_pages?: number
+  /** Jobs printed per hour (same as MCP_PRINTER_MAX_JOBS_PER_HOUR) */
+  max_jobs_per_hour?: number
+  /** Pages printed per day (same as MCP_PRINTER_MAX_PAGES_PER_DAY) */
+  max_pages_per_day?: number
+  /** Whom the quotas are counted for (same as MCP_PRINTER_QUOTA_SCOPE) */
+  quota_scope?: QuotaScope
+  /** Jobs each session may queue per minute (same as MCP_PRINTER_MAX_JOBS_PER_MINUTE) */
+  max_jobs_per_minute?: number
+  /** Window for recognizing duplicate jobs (same as MCP_PRINTER_DEDUPE_WINDOW_SECONDS) */
+  dedupe_window_seconds?: number
+  /** Largest document print_data accepts, in bytes (same as MCP_PRINTER_MAX_UPLOAD_BYTES) */
+  max_upload_bytes?: number
+  /** Start every job with a cover page (same as MCP_PRINTER_COVER_PAGE) */
+  cover_page?: boolean
+  /** How cover pages are printed (same as MCP_PRINTER_COVER_PAGE_MODE) */
+  cover_page_mode?: CoverPageMode
+  /** Owner named on cover pages (same as MCP_PRINTER_JOB_OWNER) */
+  job_owner?: string
+  /** LibreOffice executable for office documents (same as MCP_PRINTER_LIBREOFFICE_PATH) */
+  libreoffice_path?: string
+  /** Work directory for temp files (same as MCP_PRINTER_TEMP_DIR) */
+  temp_dir?: string
+  /** Age at which leftover temp files are swept (same as MCP_PRINTER_TEMP_MAX_AGE_HOURS) */
+  temp_max_age_hours?: number
+  /** Size limit of the temp directory (same as MCP_PRINTER_TEMP_MAX_MB) */
+  temp_max_mb?: number
+}
+
+/**
+ * Loads and validates the JSON config file.
+ *
+ * @param filePath - Path to the config file (empty or undefined means no file)
+ * @returns Parsed settings, or an empty object if no file is configured
+ * @throws {Error} If the file cannot be read, is not valid JSON, or has fields of the wrong type
+ */
+export function loadConfigFile(filePath: string | undefined): FileConfig {
+  if (!filePath) {
+    return {}
+  }
+
+  let parsed: unknown
+  try {
+    parsed = JSON.parse(readFileSync(filePath, "utf-8"))
+  } catch (error) {
+    throw new Error(
+      `Failed to load config file ${filePath}: ${error instanceof Error ? error.message : String(error)}`
+    )
+  }
+
+  if (typeof parsed !== "object" || parsed === null || Array.isArray(parsed)) {
+    throw new Error(`Invalid config file ${filePath}: expected a JSON object`)
+  }
+
+  const {
+    backend,
+    pdf_output_dir,
+    cups_server,
+    cups_encryption,
+    default_printer,
+    allowed_printers,
+    raw_allowed_printers,
+    allowed_paths,
+    allow_private_urls,
+    auth_token,
+    session_ttl_minutes,
+    max_concurrent_renders,
+    log_level,
+    log_file,
+    max_pages_per_job,
+    absolute_max_pages,
+    max_jobs_per_hour,
+    max_pages_per_day,
+    quota_scope,
+    max_jobs_per_minute,
+    dedupe_window_seconds,
+    max_upload_bytes,
+    cover_page,
+    cover_page_mode,
+    job_owner,
+    libreoffice_path,
+    temp_dir,
+    temp_max_age_hours,
+    temp_max_mb,
+  } = parsed as Record<string, unknown>
+  if (backend !== undefined && typeof backend !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "backend" must be a string`)
+  }
+
+  if (pdf_output_dir !== undefined && typeof pdf_output_dir !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "pdf_output_dir" must be a string`)
+  }
+
+  if (cups_server !== undefined && typeof cups_server !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "cups_server" must be a string`)
+  }
+
+  if (cups_encryption !== undefined && !isCupsEncryption(cups_encryption)) {
+    throw new Error(
+      `Invalid config file ${filePath}: "cups_encryption" must be one of ${CUPS_ENCRYPTIONS.join(", ")}`
+    )
+  }
+
+  if (default_printer !== undefined && typeof default_printer !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "default_printer" must be a string`)
+  }
+  if (
+    allowed_printers !== undefined &&
+    !(Array.isArray(allowed_printers) && allowed_printers.every((p) => typeof p === "string"))
+  ) {
+    throw new Error(
+      `Invalid config file ${filePath}: "allowed_printers" must be an array of printer names`
+    )
+  }
+  if (
+    raw_allowed_printers !== undefined &&
+    !(
+      Array.isArray(raw_allowed_printers) &&
+      raw_allowed_printers.every((p) => typeof p === "string")
+    )
+  ) {
+    throw new Error(
+      `Invalid config file ${filePath}: "raw_allowed_printers" must be an array of printer names`
+    )
+  }
+  if (
+    allowed_paths !== undefined &&
+    !(Array.isArray(allowed_paths) && allowed_paths.every((p) => typeof p === "string"))
+  ) {
+    throw new Error(`Invalid config file ${filePath}: "allowed_paths" must be an array of paths`)
+  }
+
+  if (allow_private_urls !== undefined && typeof allow_private_urls !== "boolean") {
+    throw new Error(`Invalid config file ${filePath}: "allow_private_urls" must be true or false`)
+  }
+
+  if (auth_token !== undefined && typeof auth_token !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "auth_token" must be a string`)
+  }
+
+  if (max_concurrent_renders !== undefined && !Number.isInteger(max_concurrent_renders)) {
+    throw new Error(
+      `Invalid config file ${filePath}: "max_concurrent_renders" must be a whole number`
+    )
+  }
+
+  if (log_level !== undefined && !isLogLevel(log_level)) {
+    throw new Error(
+      `Invalid config file ${filePath}: "log_level" must be one of ${LOG_LEVELS.join(", ")}`
+    )
+  }
+
+  if (log_file !== undefined && typeof log_file !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "log_file" must be a string`)
+  }
+
+  if (max_pages_per_job !== undefined && !Number.isInteger(max_pages_per_job)) {
+    throw new Error(`Invalid config file ${filePath}: "max_pages_per_job" must be a whole number`)
+  }
+
+  if (absolute_max_pages !== undefined && !Number.isInteger(absolute_max_pages)) {
+    throw new Error(`Invalid config file ${filePath}: "absolute_max_pages" must be a whole number`)
+  }
+
+  if (max_jobs_per_hour !== undefined && !Number.isInteger(max_jobs_per_hour)) {
+    throw new Error(`Invalid config file ${filePath}: "max_jobs_per_hour" must be a whole number`)
+  }
+
+  if (max_pages_per_day !== undefined && !Number.isInteger(max_pages_per_day)) {
+    throw new Error(`Invalid config file ${filePath}: "max_pages_per_day" must be a whole number`)
+  }
+
+  if (quota_scope !== undefined && !isQuotaScope(quota_scope)) {
+    throw new Error(
+      `Invalid config file ${filePath}: "quota_scope" must be one of ${QUOTA_SCOPES.join(", ")}`
+    )
+  }
+
+  if (session_ttl_minutes !== undefined && typeof session_ttl_minutes !== "number") {
+    throw new Error(`Invalid config file ${filePath}: "session_ttl_minutes" must be a number`)
+  }
+
+  if (max_jobs_per_minute !== undefined && !Number.isInteger(max_jobs_per_minute)) {
+    throw new Error(`Invalid config file ${filePath}: "max_jobs_per_minute" must be a whole number`)
+  }
+
+  if (dedupe_window_seconds !== undefined && typeof dedupe_window_seconds !== "number") {
+    throw new Error(`Invalid config file ${filePath}: "dedupe_window_seconds" must be a number`)
+  }
+
+  if (max_upload_bytes !== undefined && !Number.isInteger(max_upload_bytes)) {
+    throw new Error(`Invalid config file ${filePath}: "max_upload_bytes" must be a whole number`)
+  }
+
+  if (cover_page !== undefined && typeof cover_page !== "boolean") {
+    throw new Error(`Invalid config file ${filePath}: "cover_page" must be true or false`)
+  }
+
+  if (cover_page_mode !== undefined && !isCoverPageMode(cover_page_mode)) {
+    throw new Error(
+      `Invalid config file ${filePath}: "cover_page_mode" must be one of ${COVER_PAGE_MODES.join(", ")}`
+    )
+  }
+
+  if (job_owner !== undefined && typeof job_owner !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "job_owner" must be a string`)
+  }
+
+  if (libreoffice_path !== undefined && typeof libreoffice_path !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "libreoffice_path" must be a string`)
+  }
+
+  if (temp_dir !== undefined && typeof temp_dir !== "string") {
+    throw new Error(`Invalid config file ${filePath}: "temp_dir" must be a string`)
+  }
+
+  if (temp_max_age_hours !== undefined && typeof temp_max_age_hours !== "number") {
+    throw new Error(`Invalid config file ${filePath}: "temp_max_age_hours" must be a number`)
+  }
+
+  if (temp_max_mb !== undefined && typeof temp_max_mb !== "number") {
+    throw new Error(`Invalid config file ${filePath}: "temp_max_mb" must be a number`)
+  }
+
+  return {
+    backend,
+    pdf_output_dir,
+    cups_server,
+    cups_encryption,
+    default_printer,
+    allowed_printers,
+    raw_allowed_printers,
+    allowed_paths,
+    allow_private_urls,
+    auth_token,
+    session_ttl_minutes: session_ttl_minutes as number | undefined,
+    max_concurrent_renders: max_concurrent_renders as number | undefined,
+    log_level,
+    log_file,
+    max_pages_per_job: max_pages_per_job as number | undefined,
+    absolute_max_pages: absolute_max_pages as number | undefined,
+    max_jobs_per_hour: max_jobs_per_hour as number | undefined,
+    max_pages_per_day: max_pages_per_day as number | undefined,
+    quota_scope,
+    max_jobs_per_minute: max_jobs_per_minute as number | undefined,
+    dedupe_window_seconds: dedupe_window_seconds as number | undefined,
+    max_upload_bytes: max_upload_bytes as number | undefined,
+    cover_page,
+    cover_page_mode,
+    job_owner,
+    libreoffice_path,
+    temp_dir,
+    temp_max_age_hours: temp_max_age_hours as number | undefined,
+    temp_max_mb: temp_max_mb as number | undefined,
+  }
+}
+
 /**
  * Standard markdown file extensions.
  * These are the file extensions that will be treated as markdown files for rendering.
@@ -64,15 +613,64 @@ export type MarkdownExtension = (typeof MARKDOWN_EXTENSIONS)[number]
  * These are used when environment variables are not set.
  */
 const DEFAULT_PRINTER = ""
+const DEFAULT_IPP_INSECURE_TLS = false
+const DEFAULT_BACKEND = "auto"
+const DEFAULT_PDF_OUTPUT_DIR = join(tmpdir(), "mcp-printer-pdf")
+const DEFAULT_PDF_JOB_DELAY_SECONDS = 2
+const DEFAULT_CUPS_SERVER = ""
+const DEFAULT_CUPS_ENCRYPTION: CupsEncryption = "ifrequested"
+const DEFAULT_ALLOW_PRIVATE_URLS = false
+const DEFAULT_URL_TIMEOUT_SECONDS = 30
+const DEFAULT_URL_MAX_SIZE_MB = 20
+const DEFAULT_MAX_UPLOAD_BYTES = 20 * 1024 * 1024
+const DEFAULT_SUBMIT_TIMEOUT_SECONDS = 30
+const DEFAULT_STATUS_TIMEOUT_SECONDS = 10
+const DEFAULT_LIBREOFFICE_PATH = ""
+const DEFAULT_CONVERT_TIMEOUT_SECONDS = 120
+const DEFAULT_SHUTDOWN_TIMEOUT_SECONDS = 10
+const DEFAULT_MAX_RETRIES = 3
+const DEFAULT_RETRY_DELAY_SECONDS = 2
+const DEFAULT_LOG_LEVEL: LogLevel = "info"
+const DEFAULT_LOG_FILE = ""
+const DEFAULT_MONITOR_INTERVAL_SECONDS = 0
+const DEFAULT_PREVIEW_DIR = join(tmpdir(), "mcp-printer-previews")
+const DEFAULT_TEMP_DIR = join(tmpdir(), "mcp-printer")
+const DEFAULT_TEMP_MAX_AGE_HOURS = 24
+const DEFAULT_TEMP_MAX_MB = 2048
+const DEFAULT_AUTH_TOKEN = ""
+const DEFAULT_SESSION_TTL_MINUTES = 60
+const DEFAULT_HISTORY_FILE = join(
+  process.env.XDG_CONFIG_HOME || join(homedir(), ".config"),
+  "mcp-printer",
+  "history.json"
+)
+const DEFAULT_IMAGE_MARGIN_MM = 6
+const DEFAULT_HEADER = ""
+const DEFAULT_FOOTER = ""
 const DEFAULT_AUTO_DUPLEX = false
 const DEFAULT_CHROME_PATH = ""
 const DEFAULT_AUTO_RENDER_MARKDOWN = true
 const DEFAULT_AUTO_RENDER_CODE = true
+const DEFAULT_AUTO_RENDER_TEXT = true
 const DEFAULT_ENABLE_MANAGEMENT = false
 const DEFAULT_ENABLE_PROMPTS = true
 const DEFAULT_FALLBACK_ON_RENDER_ERROR = false
 const DEFAULT_MAX_COPIES = 10
 const DEFAULT_CONFIRM_IF_OVER_PAGES = 10
+const DEFAULT_MAX_CONCURRENT_RENDERS = 2
+const DEFAULT_MAX_PAGES_PER_JOB = 50
+const DEFAULT_ABSOLUTE_MAX_PAGES = 500
+const DEFAULT_MAX_JOBS_PER_HOUR = 0
+// A full batch of print_file (RECOMMENDED_BATCH_SIZE) fits in the bucket
+const DEFAULT_MAX_JOBS_PER_MINUTE = 50
+const DEFAULT_DEDUPE_WINDOW_SECONDS = 60
+const DEFAULT_MAX_PAGES_PER_DAY = 0
+const DEFAULT_QUOTA_SCOPE: QuotaScope = "global"
+const DEFAULT_COST_PER_PAGE = 0
+const DEFAULT_COST_CURRENCY = ""
+const DEFAULT_COVER_PAGE = false
+const DEFAULT_COVER_PAGE_MODE: CoverPageMode = "generate"
+const DEFAULT_JOB_OWNER = ""
 const DEFAULT_CODE_COLOR_SCHEME = "atom-one-light"
 const DEFAULT_CODE_AUTO_LINE_NUMBERS = true
 const DEFAULT_CODE_FONT_SIZE = "10pt"
@@ -125,23 +723,129 @@ const defaultDeniedPaths = [
   "/private/tmp",
 ]
 
-// Parse user-provided allowed paths from environment variable (colon-separated) and expand env vars
-const userAllowedPaths = parseDelimitedString(process.env.MCP_PRINTER_ALLOWED_PATHS, ":").map(
-  expandEnvVars
+// Load the optional config file (environment variables override its values)
+const configFilePath = expandEnvVars(process.env.MCP_PRINTER_CONFIG_FILE || "")
+const fileConfig = loadConfigFile(configFilePath)
+
+// Parse allowed printers from environment variable (comma-separated), falling back to the file
+const envAllowedPrinters = parseDelimitedString(process.env.MCP_PRINTER_ALLOWED_PRINTERS, ",")
+const envRawAllowedPrinters = parseDelimitedString(
+  process.env.MCP_PRINTER_RAW_ALLOWED_PRINTERS,
+  ","
 )
-const hasUserPaths = userAllowedPaths.length > 0
 
 // Parse user-provided denied paths from environment variable (colon-separated) and expand env vars
 const userDeniedPaths = parseDelimitedString(process.env.MCP_PRINTER_DENIED_PATHS, ":").map(
   expandEnvVars
 )
 
+// The color price falls back to the black-and-white price, so setting one price covers both
+const costPerPage = parseFloat(
+  process.env.MCP_PRINTER_COST_PER_PAGE || String(DEFAULT_COST_PER_PAGE)
+)
+
 /**
- * Global configuration object loaded from environment variables.
+ * Global configuration object loaded from environment variables and the optional config file.
  * Provides settings for printer defaults, rendering options, and code formatting.
  */
 export const config: Config = {
-  defaultPrinter: process.env.MCP_PRINTER_DEFAULT_PRINTER || DEFAULT_PRINTER,
+  configFile: configFilePath,
+  backend: process.env.MCP_PRINTER_BACKEND || fileConfig.backend || DEFAULT_BACKEND,
+  pdfOutputDir: expandEnvVars(
+    process.env.MCP_PRINTER_PDF_OUTPUT_DIR || fileConfig.pdf_output_dir || DEFAULT_PDF_OUTPUT_DIR
+  ),
+  pdfJobDelaySeconds: parseFloat(
+    process.env.MCP_PRINTER_PDF_JOB_DELAY_SECONDS || String(DEFAULT_PDF_JOB_DELAY_SECONDS)
+  ),
+  cupsServer: process.env.MCP_PRINTER_CUPS_SERVER || fileConfig.cups_server || DEFAULT_CUPS_SERVER,
+  cupsEncryption: parseCupsEncryption(
+    process.env.MCP_PRINTER_CUPS_ENCRYPTION,
+    fileConfig.cups_encryption ?? DEFAULT_CUPS_ENCRYPTION
+  ),
+  defaultPrinter:
+    process.env.MCP_PRINTER_DEFAULT_PRINTER || fileConfig.default_printer || DEFAULT_PRINTER,
+  allowedPrinters:
+    envAllowedPrinters.length > 0 ? envAllowedPrinters : [...(fileConfig.allowed_printers ?? [])],
+  rawAllowedPrinters:
+    envRawAllowedPrinters.length > 0
+      ? envRawAllowedPrinters
+      : [...(fileConfig.raw_allowed_printers ?? [])],
+  ippInsecureTls: yn(process.env.MCP_PRINTER_IPP_INSECURE_TLS, {
+    default: DEFAULT_IPP_INSECURE_TLS,
+  }),
+  allowPrivateUrls: yn(process.env.MCP_PRINTER_ALLOW_PRIVATE_URLS, {
+    default: fileConfig.allow_private_urls ?? DEFAULT_ALLOW_PRIVATE_URLS,
+  }),
+  urlTimeoutSeconds: parseInt(
+    process.env.MCP_PRINTER_URL_TIMEOUT_SECONDS || String(DEFAULT_URL_TIMEOUT_SECONDS),
+    10
+  ),
+  urlMaxSizeMb: parseInt(
+    process.env.MCP_PRINTER_URL_MAX_SIZE_MB || String(DEFAULT_URL_MAX_SIZE_MB),
+    10
+  ),
+  maxUploadBytes: parseInt(
+    process.env.MCP_PRINTER_MAX_UPLOAD_BYTES ||
+      String(fileConfig.max_upload_bytes ?? DEFAULT_MAX_UPLOAD_BYTES),
+    10
+  ),
+  submitTimeoutSeconds: parseInt(
+    process.env.MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS || String(DEFAULT_SUBMIT_TIMEOUT_SECONDS),
+    10
+  ),
+  statusTimeoutSeconds: parseInt(
+    process.env.MCP_PRINTER_STATUS_TIMEOUT_SECONDS || String(DEFAULT_STATUS_TIMEOUT_SECONDS),
+    10
+  ),
+  libreofficePath: expandEnvVars(
+    process.env.MCP_PRINTER_LIBREOFFICE_PATH ||
+      fileConfig.libreoffice_path ||
+      DEFAULT_LIBREOFFICE_PATH
+  ),
+  convertTimeoutSeconds: parseInt(
+    process.env.MCP_PRINTER_CONVERT_TIMEOUT_SECONDS || String(DEFAULT_CONVERT_TIMEOUT_SECONDS),
+    10
+  ),
+  shutdownTimeoutSeconds: parseFloat(
+    process.env.MCP_PRINTER_SHUTDOWN_TIMEOUT_SECONDS || String(DEFAULT_SHUTDOWN_TIMEOUT_SECONDS)
+  ),
+  maxRetries: parseInt(process.env.MCP_PRINTER_MAX_RETRIES || String(DEFAULT_MAX_RETRIES), 10),
+  retryDelaySeconds: parseFloat(
+    process.env.MCP_PRINTER_RETRY_DELAY_SECONDS || String(DEFAULT_RETRY_DELAY_SECONDS)
+  ),
+  logLevel: parseLogLevel(
+    process.env.MCP_PRINTER_LOG_LEVEL,
+    fileConfig.log_level ?? DEFAULT_LOG_LEVEL
+  ),
+  logFile: expandEnvVars(
+    process.env.MCP_PRINTER_LOG_FILE || fileConfig.log_file || DEFAULT_LOG_FILE
+  ),
+  monitorIntervalSeconds: parseInt(
+    process.env.MCP_PRINTER_MONITOR_INTERVAL_SECONDS || String(DEFAULT_MONITOR_INTERVAL_SECONDS),
+    10
+  ),
+  previewDir: expandEnvVars(process.env.MCP_PRINTER_PREVIEW_DIR || DEFAULT_PREVIEW_DIR),
+  tempDir: expandEnvVars(
+    process.env.MCP_PRINTER_TEMP_DIR || fileConfig.temp_dir || DEFAULT_TEMP_DIR
+  ),
+  tempMaxAgeHours: parseFloat(
+    process.env.MCP_PRINTER_TEMP_MAX_AGE_HOURS ||
+      String(fileConfig.temp_max_age_hours ?? DEFAULT_TEMP_MAX_AGE_HOURS)
+  ),
+  tempMaxMb: parseFloat(
+    process.env.MCP_PRINTER_TEMP_MAX_MB || String(fileConfig.temp_max_mb ?? DEFAULT_TEMP_MAX_MB)
+  ),
+  historyFile: expandEnvVars(process.env.MCP_PRINTER_HISTORY_FILE || DEFAULT_HISTORY_FILE),
+  authToken: process.env.MCP_PRINTER_AUTH_TOKEN || fileConfig.auth_token || DEFAULT_AUTH_TOKEN,
+  sessionTtlMinutes: parseFloat(
+    process.env.MCP_PRINTER_SESSION_TTL_MINUTES ||
+      String(fileConfig.session_ttl_minutes ?? DEFAULT_SESSION_TTL_MINUTES)
+  ),
+  imageMarginMm: parseFloat(
+    process.env.MCP_PRINTER_IMAGE_MARGIN_MM || String(DEFAULT_IMAGE_MARGIN_MM)
+  ),
+  header: process.env.MCP_PRINTER_HEADER || DEFAULT_HEADER,
+  footer: process.env.MCP_PRINTER_FOOTER || DEFAULT_FOOTER,
   autoDuplex: yn(process.env.MCP_PRINTER_AUTO_DUPLEX, { default: DEFAULT_AUTO_DUPLEX }),
   defaultOptions: parseDelimitedString(process.env.MCP_PRINTER_DEFAULT_OPTIONS, /\s+/),
   chromePath: process.env.MCP_PRINTER_CHROME_PATH || DEFAULT_CHROME_PATH,
@@ -151,6 +855,9 @@ export const config: Config = {
   autoRenderCode: yn(process.env.MCP_PRINTER_AUTO_RENDER_CODE, {
     default: DEFAULT_AUTO_RENDER_CODE,
   }),
+  autoRenderText: yn(process.env.MCP_PRINTER_AUTO_RENDER_TEXT, {
+    default: DEFAULT_AUTO_RENDER_TEXT,
+  }),
   enableManagement: yn(process.env.MCP_PRINTER_ENABLE_MANAGEMENT, {
     default: DEFAULT_ENABLE_MANAGEMENT,
   }),
@@ -161,13 +868,62 @@ export const config: Config = {
     default: DEFAULT_FALLBACK_ON_RENDER_ERROR,
   }),
   // Use user-provided paths if set, otherwise use default allowed directories
-  allowedPaths: hasUserPaths ? userAllowedPaths : [...defaultAllowedPaths],
+  allowedPaths: parseAllowedPaths(process.env.MCP_PRINTER_ALLOWED_PATHS, fileConfig.allowed_paths),
   deniedPaths: [...defaultDeniedPaths, ...userDeniedPaths],
   maxCopies: parseInt(process.env.MCP_PRINTER_MAX_COPIES || String(DEFAULT_MAX_COPIES), 10),
+  maxConcurrentRenders: parseInt(
+    process.env.MCP_PRINTER_MAX_CONCURRENT_RENDERS ||
+      String(fileConfig.max_concurrent_renders ?? DEFAULT_MAX_CONCURRENT_RENDERS),
+    10
+  ),
   confirmIfOverPages: parseInt(
     process.env.MCP_PRINTER_CONFIRM_IF_OVER_PAGES || String(DEFAULT_CONFIRM_IF_OVER_PAGES),
     10
   ),
+  maxPagesPerJob: parseInt(
+    process.env.MCP_PRINTER_MAX_PAGES_PER_JOB ||
+      String(fileConfig.max_pages_per_job ?? DEFAULT_MAX_PAGES_PER_JOB),
+    10
+  ),
+  absoluteMaxPages: parseInt(
+    process.env.MCP_PRINTER_ABSOLUTE_MAX_PAGES ||
+      String(fileConfig.absolute_max_pages ?? DEFAULT_ABSOLUTE_MAX_PAGES),
+    10
+  ),
+  maxJobsPerHour: parseInt(
+    process.env.MCP_PRINTER_MAX_JOBS_PER_HOUR ||
+      String(fileConfig.max_jobs_per_hour ?? DEFAULT_MAX_JOBS_PER_HOUR),
+    10
+  ),
+  maxPagesPerDay: parseInt(
+    process.env.MCP_PRINTER_MAX_PAGES_PER_DAY ||
+      String(fileConfig.max_pages_per_day ?? DEFAULT_MAX_PAGES_PER_DAY),
+    10
+  ),
+  quotaScope: parseQuotaScope(
+    process.env.MCP_PRINTER_QUOTA_SCOPE,
+    fileConfig.quota_scope ?? DEFAULT_QUOTA_SCOPE
+  ),
+  maxJobsPerMinute: parseInt(
+    process.env.MCP_PRINTER_MAX_JOBS_PER_MINUTE ||
+      String(fileConfig.max_jobs_per_minute ?? DEFAULT_MAX_JOBS_PER_MINUTE),
+    10
+  ),
+  dedupeWindowSeconds: parseFloat(
+    process.env.MCP_PRINTER_DEDUPE_WINDOW_SECONDS ||
+      String(fileConfig.dedupe_window_seconds ?? DEFAULT_DEDUPE_WINDOW_SECONDS)
+  ),
+  costPerPage,
+  costPerColorPage: parseFloat(process.env.MCP_PRINTER_COST_PER_COLOR_PAGE || String(costPerPage)),
+  costCurrency: process.env.MCP_PRINTER_COST_CURRENCY || DEFAULT_COST_CURRENCY,
+  coverPage: yn(process.env.MCP_PRINTER_COVER_PAGE, {
+    default: fileConfig.cover_page ?? DEFAULT_COVER_PAGE,
+  }),
+  coverPageMode: parseCoverPageMode(
+    process.env.MCP_PRINTER_COVER_PAGE_MODE,
+    fileConfig.cover_page_mode ?? DEFAULT_COVER_PAGE_MODE
+  ),
+  jobOwner: process.env.MCP_PRINTER_JOB_OWNER || fileConfig.job_owner || DEFAULT_JOB_OWNER,
   code: {
     excludeExtensions: parseDelimitedString(
       process.env.MCP_PRINTER_CODE_EXCLUDE_EXTENSIONS,
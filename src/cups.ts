@@ -0,0 +1,655 @@
+/**
+ * @fileoverview CUPS command helpers and output parsers.
+ * Wraps lpstat and friends, turning their text output into structured data for the tools.
+ */
+
+import { execa } from "execa"
+import { config, type CupsEncryption } from "./config.js"
+import { commandError, PrinterError } from "./errors.js"
+import { abortError, operationSignal, type OperationKind } from "./timeouts.js"
+import { logCommand } from "./logger.js"
+
+/**
+ * Environment applied to every CUPS command so output is not localized.
+ * The parsers below match the English (C locale) wording of lpstat.
+ */
+const CUPS_ENV = { LC_ALL: "C", LANG: "C" }
+
+/** MCP_PRINTER_CUPS_ENCRYPTION values, spelled the way CUPS_ENCRYPTION takes them. */
+const CUPS_ENCRYPTION_VALUES: Record<CupsEncryption, string> = {
+  never: "Never",
+  ifrequested: "IfRequested",
+  always: "Always",
+}
+
+/**
+ * stderr messages printed by the CUPS commands when the CUPS server can't be reached.
+ */
+const SERVER_UNREACHABLE_PATTERN =
+  /unable to connect to (the )?server|connection refused|connection timed out|host is unreachable|network is unreachable|no route to host|name or service not known|unknown host/i
+
+/**
+ * Builds the environment of a CUPS command: the C locale, and the CUPS server and encryption
+ * from MCP_PRINTER_CUPS_SERVER and MCP_PRINTER_CUPS_ENCRYPTION when a server is configured.
+ * Without one, the commands use the local scheduler (or the server in the user's client.conf).
+ *
+ * @returns Variables to add to the command's environment
+ */
+export function cupsEnv(): Record<string, string> {
+  if (!config.cupsServer) {
+    return CUPS_ENV
+  }
+  return {
+    ...CUPS_ENV,
+    CUPS_SERVER: config.cupsServer,
+    CUPS_ENCRYPTION: CUPS_ENCRYPTION_VALUES[config.cupsEncryption],
+  }
+}
+
+/**
+ * Runs a CUPS command with the operation's timeout, killing it if the timeout passes or the
+ * request is canceled.
+ *
+ * @param command - lp, lpstat, lpoptions, or cancel
+ * @param args - Arguments
+ * @param kind - Which timeout applies
+ * @param signal - The MCP request's signal
+ * @param input - Data streamed to the command's stdin
+ * @returns The command's result (a non-zero exit is left to the caller)
+ * @throws {PrinterError} TIMEOUT if the command timed out
+ * @throws {PrinterError} SERVER_UNREACHABLE if the configured CUPS server can't be reached
+ * @throws {Error} If the request was canceled
+ */
+async function runCupsCommand(
+  command: string,
+  args: string[],
+  kind: OperationKind,
+  signal?: AbortSignal,
+  input?: string | Buffer
+) {
+  const operation = operationSignal(kind, signal)
+  const startedAt = Date.now()
+  const result = await execa(command, args, {
+    env: cupsEnv(),
+    reject: false,
+    cancelSignal: operation,
+    ...(input !== undefined ? { input } : {}),
+  })
+  logCommand(command, args, result.exitCode, startedAt)
+  if (result.isCanceled) {
+    throw abortError(command, operation)
+  }
+  const stderr = String(result.stderr).trim()
+  if (result.exitCode !== 0 && config.cupsServer && SERVER_UNREACHABLE_PATTERN.test(stderr)) {
+    throw new PrinterError(
+      "SERVER_UNREACHABLE",
+      `Cannot reach the CUPS server ${config.cupsServer}: ${stderr}`,
+      {
+        cause: new Error(stderr),
+        suggestion: `Check that the CUPS server ${config.cupsServer} is running and accepts connections from this machine (MCP_PRINTER_CUPS_SERVER), then try again.`,
+      }
+    )
+  }
+  return result
+}
+
+/**
+ * stderr message printed by lpstat when no printers are configured.
+ */
+const NO_DESTINATIONS_PATTERN = /no destinations added/i
+
+/**
+ * Keys printed by `lpstat -l -p` for every printer. Any other indented line directly
+ * after the "printer ..." line is the printer's state message.
+ */
+const LONG_FORM_KEYS = [
+  "Form mounted",
+  "Content types",
+  "Printer types",
+  "Description",
+  "Alerts",
+  "Location",
+  "Connection",
+  "Interface",
+  "On fault",
+  "After fault",
+  "Users allowed",
+  "Forms allowed",
+  "Banner required",
+  "Charset sets",
+  "Default pitch",
+  "Default page size",
+  "Default port settings",
+]
+
+/**
+ * Maps lpstat state wording to printer states.
+ */
+const LPSTAT_STATES = { idle: "idle", printing: "printing", disabled: "stopped" } as const
+
+/**
+ * A printer (CUPS destination) as reported by lpstat.
+ */
+export interface PrinterSummary {
+  /** CUPS queue name (spaces are stored as underscores by CUPS) */
+  name: string
+  /** Human-readable description, falls back to the queue name */
+  description: string
+  /** Whether this is the system default destination */
+  is_default: boolean
+  /** Current printer state */
+  state: "idle" | "printing" | "stopped" | "unknown"
+  /** Whether the queue is accepting new jobs */
+  accepting_jobs: boolean
+  /** State message reported by CUPS (e.g., "Paused"), if any */
+  state_message?: string
+  /** Printer state reasons (from the "Alerts:" line, e.g., "media-empty-error"), if any */
+  state_reasons?: string[]
+  /** Printer location, if configured */
+  location?: string
+}
+
+/**
+ * Parses the combined output of `lpstat -l -p -a -d` into printer summaries.
+ *
+ * @param output - stdout from lpstat
+ * @returns Array of printers in the order lpstat listed them
+ *
+ * @example
+ * parseLpstatPrinters("printer Office_HP is idle.\nsystem default destination: Office_HP")
+ * // [{ name: "Office_HP", is_default: true, state: "idle", ... }]
+ */
+export function parseLpstatPrinters(output: string): PrinterSummary[] {
+  const printers: PrinterSummary[] = []
+  const accepting = new Map<string, boolean>()
+  let defaultPrinter = ""
+  let current: PrinterSummary | null = null
+  let expectStateMessage = false
+
+  for (const line of output.split(/\r?\n/)) {
+    const printerMatch = line.match(/^printer (\S+) (?:is |now )?(idle|printing|disabled)/)
+    if (printerMatch) {
+      current = {
+        name: printerMatch[1],
+        description: printerMatch[1],
+        is_default: false,
+        state: LPSTAT_STATES[printerMatch[2] as keyof typeof LPSTAT_STATES] ?? "unknown",
+        accepting_jobs: true,
+      }
+      printers.push(current)
+      expectStateMessage = true
+      continue
+    }
+
+    const acceptingMatch = line.match(/^(\S+) (accepting|not accepting) requests/)
+    if (acceptingMatch) {
+      accepting.set(acceptingMatch[1], acceptingMatch[2] === "accepting")
+      current = null
+      continue
+    }
+
+    const defaultMatch = line.match(/^system default destination: (\S+)/)
+    if (defaultMatch) {
+      defaultPrinter = defaultMatch[1]
+      current = null
+      continue
+    }
+
+    // Indented detail lines belong to the most recent printer
+    if (current && /^\s/.test(line)) {
+      const detail = line.trim()
+      if (expectStateMessage && detail && !LONG_FORM_KEYS.some((key) => detail.startsWith(key))) {
+        current.state_message = detail
+      } else if (detail.startsWith("Description:")) {
+        current.description = detail.slice("Description:".length).trim() || current.name
+      } else if (detail.startsWith("Alerts:")) {
+        const reasons = detail
+          .slice("Alerts:".length)
+          .trim()
+          .split(/\s+/)
+          .filter((reason) => reason && reason !== "none")
+        if (reasons.length > 0) current.state_reasons = reasons
+      } else if (detail.startsWith("Location:")) {
+        const location = detail.slice("Location:".length).trim()
+        if (location) current.location = location
+      }
+      expectStateMessage = false
+      continue
+    }
+
+    current = null
+  }
+
+  for (const printer of printers) {
+    printer.is_default = printer.name === defaultPrinter
+    printer.accepting_jobs = accepting.get(printer.name) ?? printer.accepting_jobs
+  }
+
+  return printers
+}
+
+/**
+ * Lists all CUPS destinations with their description, state, and default status.
+ * Returns an empty list (not an error) when no printers are configured.
+ *
+ * @param signal - The MCP request's signal
+ * @returns Array of printer summaries
+ * @throws {Error} If lpstat fails for a reason other than having no printers, or times out
+ */
+export async function listPrinters(signal?: AbortSignal): Promise<PrinterSummary[]> {
+  const result = await runCupsCommand("lpstat", ["-l", "-p", "-a", "-d"], "status", signal)
+
+  const stderr = String(result.stderr)
+  if (result.exitCode !== 0 && !NO_DESTINATIONS_PATTERN.test(stderr)) {
+    throw commandError(
+      `Failed to list printers: ${stderr || `lpstat exited with ${result.exitCode}`}`,
+      stderr
+    )
+  }
+
+  return parseLpstatPrinters(String(result.stdout))
+}
+
+/**
+ * A printer option (PPD option) as reported by `lpoptions -p <printer> -l`.
+ */
+export interface PrinterOption {
+  /** Option keyword (e.g., "PageSize") */
+  name: string
+  /** Human-readable label (e.g., "Media Size") */
+  label: string
+  /** Available choices in the order listed */
+  choices: string[]
+  /** Current default choice (marked with * by lpoptions), if any */
+  default?: string
+}
+
+/**
+ * Parses the output of `lpoptions -p <printer> -l`.
+ * Each line has the form "Keyword/Label: choice *default choice ...".
+ *
+ * @param output - stdout from lpoptions
+ * @returns Array of options in the order lpoptions listed them
+ *
+ * @example
+ * parseLpoptions("Duplex/2-Sided Printing: *None DuplexNoTumble DuplexTumble")
+ * // [{ name: "Duplex", label: "2-Sided Printing", choices: ["None", ...], default: "None" }]
+ */
+export function parseLpoptions(output: string): PrinterOption[] {
+  const options: PrinterOption[] = []
+
+  for (const line of output.split(/\r?\n/)) {
+    const match = line.match(/^([^/:\s]+)(?:\/([^:]*))?:\s*(.*)$/)
+    if (!match) {
+      continue
+    }
+
+    const option: PrinterOption = {
+      name: match[1],
+      label: match[2]?.trim() || match[1],
+      choices: [],
+    }
+    for (const choice of match[3].split(/\s+/).filter(Boolean)) {
+      if (choice.startsWith("*")) {
+        option.default = choice.slice(1)
+        option.choices.push(option.default)
+      } else {
+        option.choices.push(choice)
+      }
+    }
+    options.push(option)
+  }
+
+  return options
+}
+
+/**
+ * Lists a printer's options and their choices with `lpoptions -p <printer> -l`.
+ *
+ * @param printer - CUPS printer name
+ * @param signal - The MCP request's signal
+ * @returns The printer's options
+ * @throws {Error} If lpoptions fails (e.g., the printer does not exist) or times out
+ */
+export async function getPrinterOptions(
+  printer: string,
+  signal?: AbortSignal
+): Promise<PrinterOption[]> {
+  const result = await runCupsCommand("lpoptions", ["-p", printer, "-l"], "status", signal)
+
+  if (result.exitCode !== 0) {
+    const stderr = String(result.stderr)
+    throw commandError(
+      `Failed to get options for printer "${printer}": ` +
+        (stderr || `lpoptions exited with ${result.exitCode}`),
+      stderr
+    )
+  }
+
+  return parseLpoptions(String(result.stdout))
+}
+
+/**
+ * Extracts the job ID from lp output such as "request id is Office_HP-123 (1 file(s))".
+ *
+ * @param output - stdout from lp
+ * @returns The job ID (e.g., "Office_HP-123"), or null if none was reported
+ */
+export function parseJobId(output: string): string | null {
+  const match = output.match(/request id is (\S+)/)
+  return match ? match[1] : null
+}
+
+/**
+ * Options for submitting a job with lp.
+ */
+export interface LpJobOptions {
+  /** Destination printer (uses the CUPS default when omitted) */
+  printer?: string
+  /** Job title shown in the queue */
+  title?: string
+  /** CUPS options, each passed with -o */
+  options?: string[]
+  /** Number of copies, passed with -n when greater than 1 */
+  copies?: number
+  /** File to print. Mutually exclusive with content. */
+  filePath?: string
+  /** Content to stream to lp over stdin when no file is given (text, or a raw job's bytes) */
+  content?: string | Buffer
+}
+
+/**
+ * Submits a print job with lp and returns the CUPS job ID.
+ * When `content` is given it is streamed to lp over stdin, so no temp file is written.
+ *
+ * @param job - Job options
+ * @param signal - Signal that cancels the submission (lp is also killed after
+ *   MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS)
+ * @returns The CUPS job ID (e.g., "Office_HP-123")
+ * @throws {Error} If lp fails, with lp's error message, or times out
+ */
+export async function submitLpJob(job: LpJobOptions, signal?: AbortSignal): Promise<string> {
+  const args: string[] = []
+  if (job.printer) {
+    args.push("-d", job.printer)
+  }
+  if (job.title) {
+    args.push("-t", job.title)
+  }
+  for (const option of job.options ?? []) {
+    args.push("-o", option)
+  }
+  if (job.copies !== undefined && job.copies > 1) {
+    args.push("-n", String(job.copies))
+  }
+  if (job.filePath) {
+    args.push("--", job.filePath)
+  }
+
+  const input = job.filePath ? undefined : (job.content ?? "")
+  const result = await runCupsCommand("lp", args, "submit", signal, input)
+
+  if (result.exitCode !== 0) {
+    const stderr = String(result.stderr)
+    throw commandError(
+      `lp failed: ${stderr || `lp exited with ${result.exitCode}`}`,
+      stderr,
+      "JOB_REJECTED"
+    )
+  }
+
+  const jobId = parseJobId(String(result.stdout))
+  if (!jobId) {
+    throw new Error(`lp did not report a job ID: ${String(result.stdout)}`)
+  }
+  return jobId
+}
+
+/**
+ * Returns the printer name portion of a CUPS job ID.
+ * Job IDs have the form "<printer>-<number>", and printer names may themselves contain dashes.
+ *
+ * @param jobId - CUPS job ID (e.g., "Office-HP-123")
+ * @returns The printer name (e.g., "Office-HP")
+ */
+export function printerFromJobId(jobId: string): string {
+  const dash = jobId.lastIndexOf("-")
+  return dash > 0 ? jobId.slice(0, dash) : jobId
+}
+
+/**
+ * Lifecycle states reported by get_job_status.
+ * "queued" means the job is waiting in the server's own queue and hasn't reached the printing
+ * system yet. "held" means the printing system has the job but won't print it until it is
+ * released (or its hold_until time comes). "not-found" means CUPS has no record of the job
+ * (never submitted or purged from history).
+ */
+export type JobState =
+  | "queued"
+  | "pending"
+  | "held"
+  | "processing"
+  | "completed"
+  | "canceled"
+  | "aborted"
+  | "not-found"
+
+/**
+ * A print job as reported by `lpstat -l -o`.
+ */
+export interface JobListing {
+  /** CUPS job ID (e.g., "Office_HP-123") */
+  job_id: string
+  /** Destination printer */
+  printer: string
+  /** Submitting user */
+  user: string
+  /** Job size in bytes */
+  size: number
+  /** Submission time as printed by lpstat */
+  submitted: string
+  /** Job state reasons (from the "Alerts:" line) */
+  alerts: string[]
+  /** Human-readable status message (from the "Status:" line), if any */
+  status_message?: string
+}
+
+/**
+ * Status of a print job returned by getJobStatus.
+ */
+export interface JobStatus {
+  job_id: string
+  state: JobState
+  printer?: string
+  user?: string
+  size?: number
+  submitted?: string
+  alerts?: string[]
+  status_message?: string
+  /** Place in the printer's queue of a "queued" job (1 = next, 0 = being submitted or retried) */
+  position?: number
+  /** Submission attempts of a queued job, when it took more than one */
+  attempts?: number
+  /** When a queued job whose submission failed will be tried again (ISO 8601) */
+  next_retry_at?: string
+  /** Queued job ID the job was looked up by */
+  queue_id?: string
+  /** Options the printer rejected, which the queued job was submitted without */
+  warnings?: string[]
+}
+
+/**
+ * Parses the output of `lpstat -l -o` into job listings.
+ *
+ * @param output - stdout from lpstat
+ * @returns Array of jobs in the order lpstat listed them
+ */
+export function parseLpstatJobs(output: string): JobListing[] {
+  const jobs: JobListing[] = []
+  let current: JobListing | null = null
+
+  for (const line of output.split(/\r?\n/)) {
+    const jobMatch = line.match(/^(\S+-\d+)\s+(\S+)\s+(\d+)\s+(.+?)\s*$/)
+    if (jobMatch) {
+      current = {
+        job_id: jobMatch[1],
+        printer: printerFromJobId(jobMatch[1]),
+        user: jobMatch[2],
+        size: parseInt(jobMatch[3], 10),
+        submitted: jobMatch[4],
+        alerts: [],
+      }
+      jobs.push(current)
+      continue
+    }
+
+    if (current && /^\s/.test(line)) {
+      const detail = line.trim()
+      if (detail.startsWith("Alerts:")) {
+        current.alerts = detail
+          .slice("Alerts:".length)
+          .trim()
+          .split(/\s+/)
+          .filter((alert) => alert && alert !== "none")
+      } else if (detail.startsWith("Status:")) {
+        const message = detail.slice("Status:".length).trim()
+        if (message) current.status_message = message
+      } else if (detail.startsWith("queued for ")) {
+        current.printer = detail.slice("queued for ".length).trim()
+      }
+      continue
+    }
+
+    current = null
+  }
+
+  return jobs
+}
+
+/**
+ * Infers a job's state from its state reasons and whether CUPS lists it as completed.
+ *
+ * @param alerts - Job state reasons from lpstat
+ * @param finished - True if the job appeared in the completed job list
+ * @returns The inferred job state
+ */
+export function inferJobState(alerts: string[], finished: boolean): JobState {
+  if (finished) {
+    if (alerts.some((alert) => alert.startsWith("job-canceled"))) return "canceled"
+    if (alerts.some((alert) => alert.includes("aborted"))) return "aborted"
+    return "completed"
+  }
+  if (alerts.some((alert) => alert === "job-printing" || alert === "job-transforming")) {
+    return "processing"
+  }
+  if (alerts.some((alert) => alert.startsWith("job-hold-until") || alert === "job-held")) {
+    return "held"
+  }
+  return "pending"
+}
+
+/**
+ * Checks whether a job listing matches a requested job ID.
+ * Accepts either the full CUPS job ID ("Office_HP-123") or just the number ("123").
+ */
+function matchesJobId(listing: JobListing, jobId: string): boolean {
+  if (listing.job_id === jobId) {
+    return true
+  }
+  return /^\d+$/.test(jobId) && listing.job_id.endsWith(`-${jobId}`)
+}
+
+/**
+ * Runs `lpstat -l -o` for the given which-jobs filter and parses the result.
+ */
+async function queryJobs(
+  whichJobs: "not-completed" | "completed",
+  signal?: AbortSignal
+): Promise<JobListing[]> {
+  const result = await runCupsCommand("lpstat", ["-W", whichJobs, "-l", "-o"], "status", signal)
+
+  const stderr = String(result.stderr)
+  if (result.exitCode !== 0 && !NO_DESTINATIONS_PATTERN.test(stderr)) {
+    throw commandError(
+      `Failed to query jobs: ${stderr || `lpstat exited with ${result.exitCode}`}`,
+      stderr
+    )
+  }
+
+  return parseLpstatJobs(String(result.stdout))
+}
+
+/**
+ * Looks up the current state of a print job.
+ * Jobs that CUPS no longer knows about (never submitted, or purged from history)
+ * are reported with state "not-found" rather than as an error.
+ *
+ * @param jobId - CUPS job ID (e.g., "Office_HP-123") or job number (e.g., "123")
+ * @param signal - The MCP request's signal
+ * @returns The job's status
+ * @throws {Error} If lpstat fails or times out
+ */
+export async function getJobStatus(jobId: string, signal?: AbortSignal): Promise<JobStatus> {
+  for (const whichJobs of ["not-completed", "completed"] as const) {
+    const listing = (await queryJobs(whichJobs, signal)).find((job) => matchesJobId(job, jobId))
+    if (listing) {
+      return {
+        ...listing,
+        state: inferJobState(listing.alerts, whichJobs === "completed"),
+      }
+    }
+  }
+
+  return { job_id: jobId, state: "not-found" }
+}
+
+/**
+ * Cancels a single job with `cancel <job-id>`.
+ *
+ * @param jobId - Full CUPS job ID (e.g., "Office_HP-123")
+ * @param signal - The MCP request's signal
+ * @throws {Error} If cancel fails, with cancel's error message, or times out
+ */
+export async function cancelJob(jobId: string, signal?: AbortSignal): Promise<void> {
+  await runCancel([jobId], signal)
+}
+
+/**
+ * Releases a held job with `lp -i <job-id> -H resume`.
+ *
+ * @param jobId - Full CUPS job ID (e.g., "Office_HP-123")
+ * @param signal - The MCP request's signal
+ * @throws {Error} If lp fails, with lp's error message, or times out
+ */
+export async function releaseJob(jobId: string, signal?: AbortSignal): Promise<void> {
+  const result = await runCupsCommand("lp", ["-i", jobId, "-H", "resume"], "status", signal)
+  if (result.exitCode !== 0) {
+    const stderr = String(result.stderr)
+    throw commandError(`lp failed: ${stderr || `lp exited with ${result.exitCode}`}`, stderr)
+  }
+}
+
+/**
+ * Cancels every job queued on a printer with `cancel -a <printer>`.
+ *
+ * @param printer - Printer name
+ * @param signal - The MCP request's signal
+ * @throws {Error} If cancel fails, with cancel's error message, or times out
+ */
+export async function cancelAllJobs(printer: string, signal?: AbortSignal): Promise<void> {
+  await runCancel(["-a", printer], signal)
+}
+
+/**
+ * Runs the cancel command and converts a non-zero exit into an Error.
+ */
+async function runCancel(args: string[], signal?: AbortSignal): Promise<void> {
+  const result = await runCupsCommand("cancel", args, "status", signal)
+  if (result.exitCode !== 0) {
+    const stderr = String(result.stderr)
+    throw commandError(
+      `cancel failed: ${stderr || `cancel exited with ${result.exitCode}`}`,
+      stderr
+    )
+  }
+}
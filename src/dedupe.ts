@@ -0,0 +1,114 @@
+/**
+ * @fileoverview Duplicate print requests.
+ * Assistants sometimes call a print tool again when the first call seemed to time out, though
+ * it went through. A job identical to one queued in the last MCP_PRINTER_DEDUPE_WINDOW_SECONDS
+ * (the same document as the tool was given it, before rendering, to the same printer with the
+ * same options) isn't printed again: the print tools return the first job's ID with
+ * `duplicate: true`, unless the call passes `force: true`. A first job that failed or was
+ * canceled doesn't count, so printing it again works (see queuePrintJob).
+ */
+
+import { createHash } from "crypto"
+import { createReadStream } from "fs"
+import { config } from "./config.js"
+
+/**
+ * What a print request is recognized by, apart from the printer and options of the job.
+ */
+export interface JobIdentity {
+  /** Files given to the tool, before rendering */
+  files?: string[]
+  /** Content given to the tool (text, or a raw job's bytes) */
+  content?: string | Buffer
+  /** The tool's other arguments that change what is printed (rendering, watermark, ...) */
+  settings?: unknown
+}
+
+/**
+ * A job remembered for MCP_PRINTER_DEDUPE_WINDOW_SECONDS.
+ */
+export interface RecentJob {
+  /** Queued job ID */
+  jobId: string
+  /** When it was queued, in milliseconds */
+  at: number
+}
+
+// Fingerprints of the jobs queued in the window, oldest first
+const recentJobs = new Map<string, RecentJob>()
+
+/**
+ * Window in which identical jobs are recognized, in milliseconds (0 = off).
+ */
+function windowMs(): number {
+  return config.dedupeWindowSeconds > 0 ? config.dedupeWindowSeconds * 1000 : 0
+}
+
+/**
+ * Hashes a print request: the document's bytes, then the printer, options, and settings. The
+ * parts are separated, so moving bytes from one to the next changes the hash.
+ *
+ * @param identity - The document and settings as the tool was given them
+ * @param job - The resolved printer and options (e.g., the job from buildPrintJob)
+ * @returns SHA-256 hash, in hex
+ * @throws {Error} If a file can't be read
+ */
+export async function jobFingerprint(identity: JobIdentity, job: unknown): Promise<string> {
+  const hash = createHash("sha256")
+  for (const file of identity.files ?? []) {
+    hash.update("file\0")
+    for await (const chunk of createReadStream(file)) {
+      hash.update(chunk as Buffer)
+    }
+    hash.update("\0")
+  }
+  if (identity.content !== undefined) {
+    hash.update(`content:${typeof identity.content}\0`)
+    hash.update(identity.content)
+    hash.update("\0")
+  }
+  hash.update(JSON.stringify({ job, settings: identity.settings ?? null }))
+  return hash.digest("hex")
+}
+
+/**
+ * Forgets jobs queued before the window.
+ */
+function forgetExpired(now: number): void {
+  const window = windowMs()
+  for (const [fingerprint, { at }] of recentJobs) {
+    if (window > 0 && now - at < window) {
+      break
+    }
+    recentJobs.delete(fingerprint)
+  }
+}
+
+/**
+ * Looks for a job identical to a new one, queued in the last MCP_PRINTER_DEDUPE_WINDOW_SECONDS.
+ *
+ * @param fingerprint - The new job's fingerprint, from jobFingerprint
+ * @param now - The current time, in milliseconds
+ * @returns The identical job's queued job ID and when it was queued, or undefined
+ */
+export function findDuplicate(fingerprint: string, now = Date.now()): RecentJob | undefined {
+  forgetExpired(now)
+  const recent = recentJobs.get(fingerprint)
+  return recent ? { ...recent } : undefined
+}
+
+/**
+ * Remembers a job that was just queued, so an identical request in the window returns it.
+ *
+ * @param fingerprint - The job's fingerprint, from jobFingerprint
+ * @param jobId - Its queued job ID
+ * @param now - The current time, in milliseconds
+ */
+export function rememberJob(fingerprint: string, jobId: string, now = Date.now()): void {
+  if (windowMs() === 0) {
+    return
+  }
+  // Moved to the end, so the oldest job stays first
+  recentJobs.delete(fingerprint)
+  recentJobs.set(fingerprint, { jobId, at: now })
+}
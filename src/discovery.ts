@@ -0,0 +1,238 @@
+/**
+ * @fileoverview Network printer discovery over mDNS / DNS-SD.
+ * Browses `_ipp._tcp` and `_ipps._tcp` for IPP printers on the local network (AirPrint, IPP
+ * Everywhere) and builds ipp:// / ipps:// URIs the print tools accept directly.
+ * Queries are sent from an ephemeral port as one-shot mDNS queries (RFC 6762 §5.1), so no
+ * multicast group membership or port 5353 binding is needed and the system responder
+ * (Avahi, mDNSResponder) is left alone.
+ */
+
+import { createSocket } from "dgram"
+import { decodeDnsRecords, encodeDnsQuery, RECORD_TYPES, type SrvData } from "./mdns.js"
+
+/** mDNS multicast group and port. */
+const MDNS_TARGET = { address: "224.0.0.251", port: 5353 }
+
+/** DNS-SD service types browsed, and the URI scheme each maps to. */
+const SERVICE_TYPES = {
+  "_ipp._tcp.local": "ipp",
+  "_ipps._tcp.local": "ipps",
+} as const
+
+/** Delay before repeating the browse query, to catch responders that missed the first one. */
+const REQUERY_DELAY_MS = 1000
+
+/**
+ * A printer found on the network.
+ */
+export interface DiscoveredPrinter {
+  /** Service instance name (usually the printer's friendly name) */
+  name: string
+  service: "ipp" | "ipps"
+  host: string
+  port: number
+  addresses: string[]
+  /** URI to pass as the `printer` argument of the print tools */
+  uri: string
+  make_and_model?: string
+  location?: string
+  /** Document formats the printer accepts (TXT `pdl` key) */
+  pdl: string[]
+  color?: boolean
+  duplex?: boolean
+}
+
+/**
+ * Result of a discovery run.
+ */
+export interface DiscoveryResult {
+  printers: DiscoveredPrinter[]
+  /** Set when the network didn't allow browsing (e.g., no multicast route in a container) */
+  warning?: string
+}
+
+/**
+ * Options for discoverPrinters.
+ */
+export interface DiscoveryOptions {
+  /** How long to collect responses, in milliseconds */
+  durationMs: number
+  /** Where to send queries (mDNS multicast group by default; overridden in tests) */
+  target?: { address: string; port: number }
+}
+
+/**
+ * Records collected for one service instance.
+ */
+interface ServiceInstance {
+  /** Full instance name as advertised, e.g. "Office Printer._ipp._tcp.local" */
+  name: string
+  service: "ipp" | "ipps"
+  srv?: SrvData
+  txt?: Record<string, string>
+}
+
+/**
+ * Parses a DNS-SD boolean TXT value ("T"/"F").
+ */
+function parseTxtBoolean(value: string | undefined): boolean | undefined {
+  if (value === undefined) return undefined
+  return value.toUpperCase() === "T"
+}
+
+/**
+ * Strips the service type suffix from an instance name.
+ */
+function instanceLabel(instanceName: string, serviceType: string): string {
+  return instanceName.slice(0, -(serviceType.length + 1))
+}
+
+/**
+ * Formats a host for use in a URI (brackets IPv6 addresses).
+ */
+function uriHost(host: string): string {
+  return host.includes(":") ? `[${host}]` : host
+}
+
+/**
+ * Builds the printers found so far from the collected records. Instances without an SRV
+ * record yet are skipped since their host and port are unknown.
+ */
+function buildPrinters(
+  instances: Map<string, ServiceInstance>,
+  addresses: Map<string, string[]>
+): DiscoveredPrinter[] {
+  const printers: DiscoveredPrinter[] = []
+
+  for (const instance of instances.values()) {
+    if (!instance.srv) continue
+
+    const serviceType = `_${instance.service}._tcp.local`
+    const host = instance.srv.target
+    const hostAddresses = addresses.get(host.toLowerCase()) ?? []
+    const txt = instance.txt ?? {}
+    const resourcePath = (txt.rp ?? "ipp/print").replace(/^\//, "")
+    // Prefer an IPv4 address so the URI works without .local name resolution on the host
+    const uriAddress = hostAddresses.find((address) => !address.includes(":")) ?? host
+
+    printers.push({
+      name: instanceLabel(instance.name, serviceType),
+      service: instance.service,
+      host,
+      port: instance.srv.port,
+      addresses: hostAddresses,
+      uri: `${instance.service}://${uriHost(uriAddress)}:${instance.srv.port}/${resourcePath}`,
+      make_and_model: txt.ty || undefined,
+      location: txt.note || undefined,
+      pdl: txt.pdl ? txt.pdl.split(",").map((format) => format.trim()) : [],
+      color: parseTxtBoolean(txt.color),
+      duplex: parseTxtBoolean(txt.duplex),
+    })
+  }
+
+  return printers.sort((a, b) => a.name.localeCompare(b.name) || a.uri.localeCompare(b.uri))
+}
+
+/**
+ * Browses the local network for IPP printers for a fixed duration.
+ * Never hangs or throws on network problems: if queries can't be sent (no multicast route,
+ * no network), resolves with an empty list and a warning.
+ *
+ * @param options - Browse duration and (for tests) the query target
+ * @returns Printers found, sorted by name
+ */
+export function discoverPrinters(options: DiscoveryOptions): Promise<DiscoveryResult> {
+  const target = options.target ?? MDNS_TARGET
+  // All keyed by lowercased DNS name, since DNS names are case-insensitive
+  const instances = new Map<string, ServiceInstance>()
+  const records = new Map<string, Pick<ServiceInstance, "srv" | "txt">>()
+  const addresses = new Map<string, string[]>()
+  const resolving = new Set<string>()
+
+  return new Promise((resolve) => {
+    const socket = createSocket({ type: "udp4" })
+    const timers: NodeJS.Timeout[] = []
+    let warning: string | undefined
+    let finished = false
+
+    function finish() {
+      if (finished) return
+      finished = true
+      timers.forEach(clearTimeout)
+      socket.close()
+      resolve({ printers: buildPrinters(instances, addresses), ...(warning && { warning }) })
+    }
+
+    function networkUnavailable(error: Error) {
+      warning =
+        `mDNS discovery is unavailable on this network (${error.message}). ` +
+        "Multicast may be blocked, e.g., inside a container. Specify printers by ipp:// URI instead."
+      finish()
+    }
+
+    function send(questions: Parameters<typeof encodeDnsQuery>[0]) {
+      if (finished) return
+      socket.send(encodeDnsQuery(questions), target.port, target.address, (error) => {
+        if (error) networkUnavailable(error)
+      })
+    }
+
+    function browse() {
+      send(Object.keys(SERVICE_TYPES).map((name) => ({ name, type: RECORD_TYPES.PTR })))
+    }
+
+    socket.on("error", networkUnavailable)
+
+    socket.on("message", (message) => {
+      let answers
+      try {
+        answers = decodeDnsRecords(message)
+      } catch {
+        return // Ignore malformed packets from other responders
+      }
+
+      for (const record of answers) {
+        const name = record.name.toLowerCase()
+
+        if (record.type === RECORD_TYPES.PTR && name in SERVICE_TYPES) {
+          const instanceName = record.data as string
+          if (!instances.has(instanceName.toLowerCase())) {
+            const service = SERVICE_TYPES[name as keyof typeof SERVICE_TYPES]
+            instances.set(instanceName.toLowerCase(), { name: instanceName, service })
+          }
+        } else if (record.type === RECORD_TYPES.SRV) {
+          records.set(name, { ...records.get(name), srv: record.data as SrvData })
+        } else if (record.type === RECORD_TYPES.TXT) {
+          records.set(name, { ...records.get(name), txt: record.data as Record<string, string> })
+        } else if (record.type === RECORD_TYPES.A || record.type === RECORD_TYPES.AAAA) {
+          const address = record.data as string
+          const known = addresses.get(name) ?? []
+          if (!known.includes(address)) {
+            addresses.set(name, [...known, address])
+          }
+        }
+      }
+
+      // SRV and TXT records may arrive before or after the PTR record that names the instance
+      for (const [key, instance] of instances) {
+        Object.assign(instance, records.get(key))
+        if (!instance.srv && !resolving.has(key)) {
+          // The responder only sent the PTR record, so ask for the rest
+          resolving.add(key)
+          send([
+            { name: instance.name, type: RECORD_TYPES.SRV },
+            { name: instance.name, type: RECORD_TYPES.TXT },
+          ])
+        }
+      }
+    })
+
+    socket.bind(0, () => {
+      browse()
+      if (options.durationMs > REQUERY_DELAY_MS) {
+        timers.push(setTimeout(browse, REQUERY_DELAY_MS))
+      }
+      timers.push(setTimeout(finish, options.durationMs))
+    })
+  })
+}
@@ -0,0 +1,243 @@
+/**
+ * @fileoverview Typed printing errors.
+ * Failures from CUPS, the Windows print spooler, IPP printers, the access checks, and timeouts are
+ * reported as a PrinterError with a machine-readable code and a suggestion for what to do next,
+ * so the assistant can act on them instead of reading raw lp output.
+ */
+
+/**
+ * Error codes reported in tool results.
+ */
+export const PRINTER_ERROR_CODES = {
+  /** The printer (or the default destination) does not exist */
+  PRINTER_NOT_FOUND: "PRINTER_NOT_FOUND",
+  /** The printer exists but its queue is rejecting jobs */
+  PRINTER_NOT_ACCEPTING: "PRINTER_NOT_ACCEPTING",
+  /** The printer can't be reached over the network */
+  PRINTER_UNREACHABLE: "PRINTER_UNREACHABLE",
+  /** The CUPS server the commands run against (MCP_PRINTER_CUPS_SERVER) can't be reached */
+  SERVER_UNREACHABLE: "SERVER_UNREACHABLE",
+  /** The file to print does not exist */
+  FILE_NOT_FOUND: "FILE_NOT_FOUND",
+  /** The printer can't print this kind of document */
+  UNSUPPORTED_FORMAT: "UNSUPPORTED_FORMAT",
+  /** The printing system refused the job for another reason */
+  JOB_REJECTED: "JOB_REJECTED",
+  /** A path, printer, or job is off limits (allow-lists, file permissions, CUPS policy) */
+  PERMISSION_DENIED: "PERMISSION_DENIED",
+  /** The printing system or printer didn't answer in time */
+  TIMEOUT: "TIMEOUT",
+  /** The job prints more pages than the page limits allow */
+  PAGE_LIMIT_EXCEEDED: "PAGE_LIMIT_EXCEEDED",
+  /** Printing the job would go over the hourly job or daily page quota */
+  QUOTA_EXCEEDED: "QUOTA_EXCEEDED",
+  /** The session sent more jobs in the last minute than the rate limit allows */
+  RATE_LIMITED: "RATE_LIMITED",
+  /** The temp directory holds more than its size limit, so nothing new is rendered */
+  TEMP_SPACE_EXCEEDED: "TEMP_SPACE_EXCEEDED",
+} as const
+
+/**
+ * A printing error code.
+ */
+export type PrinterErrorCode = (typeof PRINTER_ERROR_CODES)[keyof typeof PRINTER_ERROR_CODES]
+
+/**
+ * Default suggestion for each error code.
+ */
+const SUGGESTIONS: Record<PrinterErrorCode, string> = {
+  PRINTER_NOT_FOUND:
+    "Run list_printers to see available destinations, or discover_printers to find network printers.",
+  PRINTER_NOT_ACCEPTING:
+    "Run get_printer_info to see why the printer is rejecting jobs, or choose another printer from list_printers.",
+  PRINTER_UNREACHABLE:
+    "Check that the printer is on and connected to the network, then try again. Queued jobs are retried on their own (MCP_PRINTER_MAX_RETRIES).",
+  SERVER_UNREACHABLE:
+    "Tell the user the print server is down or unreachable: every printer on it is affected, so choosing another one won't help. Run server_status to check again, and print once the server is back; jobs aren't retried on their own.",
+  FILE_NOT_FOUND:
+    "Check the file path. Relative paths are resolved against the server's directory.",
+  UNSUPPORTED_FORMAT:
+    "Convert the document to PDF first, or use print_text to print its content as text.",
+  JOB_REJECTED:
+    "Check the print options against get_printer_info and try again, or print to another printer.",
+  PERMISSION_DENIED:
+    "Run get_config to see the allowed paths and printers, or ask the user to check permissions.",
+  TIMEOUT:
+    "Check that the printer is reachable with get_printer_info and try again. Slow printers may need a longer MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS or MCP_PRINTER_STATUS_TIMEOUT_SECONDS.",
+  PAGE_LIMIT_EXCEEDED:
+    "Print fewer pages with page_ranges or fewer copies, or ask the user whether to print it all with confirm_large_job.",
+  QUOTA_EXCEEDED:
+    "Tell the user when the quota resets, or print fewer pages. Only whoever runs the server can change the quota.",
+  RATE_LIMITED:
+    "Wait the time given in the message and try again. Check get_job_status or list_recent_jobs first: the jobs already sent may be the ones you meant to print.",
+  TEMP_SPACE_EXCEEDED:
+    "Wait for queued jobs to print (their temp files are removed then) and try again. Run server_status to see the temp directory's usage; whoever runs the server can raise MCP_PRINTER_TEMP_MAX_MB.",
+}
+
+/**
+ * An error with a code and a suggestion for the assistant.
+ */
+export class PrinterError extends Error {
+  /** Machine-readable error code */
+  readonly code: PrinterErrorCode
+  /** What to do about it */
+  readonly suggestion: string
+
+  constructor(
+    code: PrinterErrorCode,
+    message: string,
+    options: { cause?: unknown; suggestion?: string } = {}
+  ) {
+    super(message, options.cause !== undefined ? { cause: options.cause } : undefined)
+    this.name = "PrinterError"
+    this.code = code
+    this.suggestion = options.suggestion ?? SUGGESTIONS[code]
+  }
+}
+
+/**
+ * stderr patterns of lp, lpstat, lpoptions, cancel, and the Windows spooler shim, in the order
+ * they are checked. Matches the English (C locale) wording, which the CUPS helpers force.
+ */
+const COMMAND_ERROR_PATTERNS: Array<[RegExp, PrinterErrorCode]> = [
+  [/is not accepting jobs|not-accepting-jobs/i, "PRINTER_NOT_ACCEPTING"],
+  [
+    /unable to connect|connection refused|connection reset|host is unreachable|network is unreachable|no route to host/i,
+    "PRINTER_UNREACHABLE",
+  ],
+  [/unable to access .*no such file or directory/i, "FILE_NOT_FOUND"],
+  [
+    /permission denied|forbidden|not authorized|unauthorized|not allowed|access is denied|you don't own/i,
+    "PERMISSION_DENIED",
+  ],
+  [/unsupported (document-)?format|document-format-not-supported/i, "UNSUPPORTED_FORMAT"],
+  [
+    /printer or class does not exist|no default (destination|printer)|No MSFT_Printer objects found|invalid destination name|unknown destination|unknown printer|OpenPrinter failed/i,
+    "PRINTER_NOT_FOUND",
+  ],
+  [/client-error|server-error|request entity too large|job rejected/i, "JOB_REJECTED"],
+]
+
+/**
+ * Classifies the error output of a printing command.
+ *
+ * @param stderr - Error output of lp, lpstat, lpoptions, cancel, or the spooler shim
+ * @returns Error code, or undefined if the output isn't a recognized printing error
+ */
+export function classifyCommandError(stderr: string): PrinterErrorCode | undefined {
+  return COMMAND_ERROR_PATTERNS.find(([pattern]) => pattern.test(stderr))?.[1]
+}
+
+/**
+ * Builds the error for a failed printing command. The command's output becomes the cause.
+ *
+ * @param message - Error message
+ * @param stderr - The command's error output
+ * @param fallback - Code to use when the output isn't recognized (e.g., JOB_REJECTED for lp)
+ * @returns A PrinterError when the failure can be classified, otherwise an Error
+ */
+export function commandError(
+  message: string,
+  stderr: string,
+  fallback?: PrinterErrorCode
+): Error {
+  const cause = stderr ? new Error(stderr) : undefined
+  const code = classifyCommandError(stderr) ?? fallback
+  return code ? new PrinterError(code, message, { cause }) : new Error(message, { cause })
+}
+
+/**
+ * Maps an IPP status code to an error code.
+ *
+ * @param statusCode - IPP status code (0x0400 and above are errors)
+ * @returns Error code, or undefined for a successful status
+ */
+export function classifyIppStatus(statusCode: number): PrinterErrorCode | undefined {
+  switch (statusCode) {
+    case 0x0401: // client-error-forbidden
+    case 0x0402: // client-error-not-authenticated
+    case 0x0403: // client-error-not-authorized
+      return "PERMISSION_DENIED"
+    case 0x0406: // client-error-not-found
+      return "PRINTER_NOT_FOUND"
+    case 0x040a: // client-error-document-format-not-supported
+      return "UNSUPPORTED_FORMAT"
+    case 0x0506: // server-error-not-accepting-jobs
+      return "PRINTER_NOT_ACCEPTING"
+    default:
+      return statusCode >= 0x0400 ? "JOB_REJECTED" : undefined
+  }
+}
+
+/**
+ * Error codes of failures that may go away on their own (a printer that dropped off the network,
+ * a paused queue, a slow answer), so a submission that failed with one is worth trying again.
+ * SERVER_UNREACHABLE isn't one: a print server that is down usually stays down for longer than
+ * the retries last, and every job would wait out all of them.
+ */
+const TRANSIENT_ERROR_CODES: PrinterErrorCode[] = [
+  "PRINTER_UNREACHABLE",
+  "PRINTER_NOT_ACCEPTING",
+  "TIMEOUT",
+]
+
+/**
+ * Checks whether an error is transient: trying the same thing again later may succeed.
+ * Errors that can't be classified, like a canceled operation, are not.
+ *
+ * @param error - Caught error
+ * @returns True for PRINTER_UNREACHABLE, PRINTER_NOT_ACCEPTING, and TIMEOUT errors
+ */
+export function isTransientError(error: unknown): boolean {
+  const code = toPrinterError(error)?.code
+  return code !== undefined && TRANSIENT_ERROR_CODES.includes(code)
+}
+
+/**
+ * Converts an error to a PrinterError when it has a known code. File system errors for a
+ * missing or unreadable file are converted too (but not a missing command).
+ *
+ * @param error - Caught error
+ * @returns The PrinterError, or undefined if the error can't be classified
+ */
+export function toPrinterError(error: unknown): PrinterError | undefined {
+  if (error instanceof PrinterError) {
+    return error
+  }
+  if (!(error instanceof Error) || !("code" in error) || !("syscall" in error)) {
+    return undefined
+  }
+  if (String(error.syscall).startsWith("spawn")) {
+    return undefined
+  }
+  if (error.code === "ENOENT") {
+    return new PrinterError("FILE_NOT_FOUND", error.message, { cause: error })
+  }
+  if (error.code === "EACCES" || error.code === "EPERM") {
+    return new PrinterError("PERMISSION_DENIED", error.message, { cause: error })
+  }
+  return undefined
+}
+
+/**
+ * Message, code, and suggestion of an error, as reported in tool results.
+ */
+export interface ErrorDetails {
+  message: string
+  code?: PrinterErrorCode
+  suggestion?: string
+}
+
+/**
+ * Describes a caught error for a tool result.
+ *
+ * @param error - Caught error (or an error message)
+ * @returns The message, plus the code and suggestion if the error could be classified
+ */
+export function describeError(error: unknown): ErrorDetails {
+  const message = error instanceof Error ? error.message : String(error)
+  const printerError = toPrinterError(error)
+  return printerError
+    ? { message, code: printerError.code, suggestion: printerError.suggestion }
+    : { message }
+}
@@ -0,0 +1,148 @@
+/**
+ * @fileoverview Job estimates for the estimate_job tool.
+ * Counts the pages a job prints, the sheets of paper it takes, and what it costs, from the
+ * PDF that would be sent to the printer. Nothing is submitted.
+ *
+ * Pages are grouped onto printed sides by number-up, and a side counts as color when any of
+ * its pages is (see findColorPages). Sides are priced with MCP_PRINTER_COST_PER_PAGE and
+ * MCP_PRINTER_COST_PER_COLOR_PAGE.
+ */
+
+import { readFile } from "fs/promises"
+import { config } from "./config.js"
+import {
+  calculatePhysicalSheets,
+  getPagesPerSheet,
+  getPdfPageCount,
+  isDuplexEnabled,
+} from "./utils.js"
+import { selectPages, type PrintJobOptions } from "./print-options.js"
+import { PdfDocument } from "./pdf/document.js"
+import { findColorPages } from "./pdf/color.js"
+
+/**
+ * What a job prints and costs.
+ */
+export interface JobEstimate {
+  /** Pages in the document */
+  documentPages: number
+  /** Pages printed per copy (the pages page_ranges selects, or all of them) */
+  pages: number
+  /** Printed pages with color on them, per copy (every page when color can't be checked) */
+  colorPages: number
+  /** Whether color pages were told apart from black-and-white ones */
+  colorChecked: boolean
+  /** Whether the job prints in grayscale (color_mode or print-color-mode is monochrome) */
+  monochrome: boolean
+  /** Printed sides per copy, with number-up pages on each */
+  sides: number
+  /** Printed sides with color on them, per copy (charged at the color price) */
+  colorSides: number
+  /** Number of copies */
+  copies: number
+  /** Whether the job prints on both sides */
+  duplex: boolean
+  /** Pages printed on each side of a sheet */
+  numberUp: number
+  /** Sheets of paper for all copies */
+  sheets: number
+  /** Estimated cost of all copies, or undefined when no prices are configured */
+  cost?: number
+}
+
+/**
+ * Returns a configured price, treating unset, negative, and invalid prices as free.
+ */
+function price(value: number): number {
+  return Number.isFinite(value) && value > 0 ? value : 0
+}
+
+/**
+ * Checks whether a job prints in grayscale: color_mode wins over the last print-color-mode
+ * option, as with lp, and the configured default options come first.
+ */
+function isMonochrome(jobOptions: PrintJobOptions, options?: string): boolean {
+  if (jobOptions.color_mode) {
+    return jobOptions.color_mode === "monochrome"
+  }
+  const allOptions = [...config.defaultOptions, ...(options?.split(/\s+/) ?? [])]
+  const last = allOptions.filter((option) => option.startsWith("print-color-mode=")).pop()
+  return last === "print-color-mode=monochrome"
+}
+
+/**
+ * Estimates the pages, sheets, and cost of printing a PDF.
+ *
+ * @param filePath - The PDF that would be sent to the printer
+ * @param jobOptions - Typed print options (copies, duplex, page_ranges, number_up, color_mode)
+ * @param options - CUPS options string (may set sides, number-up, or print-color-mode)
+ * @returns The estimate
+ * @throws {Error} If the file cannot be read or isn't a PDF
+ */
+export async function estimatePdf(
+  filePath: string,
+  jobOptions: PrintJobOptions = {},
+  options?: string
+): Promise<JobEstimate> {
+  let documentPages: number
+  let colorPages: Set<number> | undefined
+  try {
+    const document = new PdfDocument(await readFile(filePath))
+    documentPages = document.getPages().length
+    // Encrypted content can't be read, so its pages are all counted as color
+    colorPages = document.encrypted ? undefined : findColorPages(document)
+  } catch {
+    documentPages = await getPdfPageCount(filePath)
+  }
+
+  const printed = jobOptions.page_ranges
+    ? selectPages(jobOptions.page_ranges, documentPages)
+    : Array.from({ length: documentPages }, (_, i) => i + 1)
+  const monochrome = isMonochrome(jobOptions, options)
+  const isColor = (page: number) => !monochrome && (colorPages ? colorPages.has(page) : true)
+
+  const numberUp = getPagesPerSheet(options, jobOptions.number_up)
+  const duplex = isDuplexEnabled(options, jobOptions.duplex)
+  const copies = jobOptions.copies ?? 1
+  let sides = 0
+  let colorSides = 0
+  for (let i = 0; i < printed.length; i += numberUp) {
+    sides++
+    if (printed.slice(i, i + numberUp).some(isColor)) {
+      colorSides++
+    }
+  }
+
+  const perPage = price(config.costPerPage)
+  const perColorPage = price(config.costPerColorPage)
+  const cost =
+    perPage > 0 || perColorPage > 0
+      ? copies * ((sides - colorSides) * perPage + colorSides * perColorPage)
+      : undefined
+
+  return {
+    documentPages,
+    pages: printed.length,
+    colorPages: printed.filter(isColor).length,
+    colorChecked: colorPages !== undefined || monochrome,
+    monochrome,
+    sides,
+    colorSides,
+    copies,
+    duplex,
+    numberUp,
+    sheets: copies * calculatePhysicalSheets(printed.length, duplex, numberUp),
+    cost,
+  }
+}
+
+/**
+ * Formats an estimated cost with the configured currency (e.g., "1.35 USD").
+ *
+ * @param cost - Amount to format
+ * @returns The amount to two decimal places, followed by the currency if one is set
+ */
+export function formatCost(cost: number): string {
+  const amount = cost.toFixed(2)
+  return config.costCurrency ? `${amount} ${config.costCurrency}` : amount
+}
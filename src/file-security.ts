@@ -4,8 +4,29 @@
  */
 
 import { realpathSync } from "fs"
-import { resolve, sep } from "path"
+import { basename, dirname, join, resolve, sep } from "path"
 import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+
+/**
+ * Resolves symlinks in an absolute path. For paths that don't exist (yet), the nearest existing
+ * ancestor is resolved instead, so a symlinked parent directory can't be used to escape the
+ * allowed directories.
+ *
+ * @param absolutePath - Absolute path to resolve
+ * @returns Path with all resolvable symlinks followed
+ */
+function resolveRealPath(absolutePath: string): string {
+  try {
+    return realpathSync(absolutePath)
+  } catch {
+    const parent = dirname(absolutePath)
+    if (parent === absolutePath) {
+      return absolutePath
+    }
+    return join(resolveRealPath(parent), basename(absolutePath))
+  }
+}
 
 /**
  * Check if a path contains any dotfile or dotdir component.
@@ -27,29 +48,25 @@ function pathContainsDotfile(filePath: string): boolean {
  * Resolves symlinks and checks against allowlist and denylist.
  *
  * @param filePath - The file path to validate
- * @throws {Error} If the file path is not allowed with a descriptive message
+ * @throws {PrinterError} PERMISSION_DENIED (with a descriptive message) if the path is not allowed
  */
 export function validateFilePath(filePath: string): void {
-  // Resolve to absolute path and follow symlinks
+  // Resolve to absolute path (collapsing "..") and follow symlinks
   const originalAbsolutePath = resolve(filePath)
-  let absolutePath: string
-  try {
-    absolutePath = realpathSync(originalAbsolutePath)
-  } catch {
-    // If file doesn't exist yet or can't be resolved, use resolved path without following symlinks
-    absolutePath = originalAbsolutePath
-  }
+  const absolutePath = resolveRealPath(originalAbsolutePath)
 
   // Check for dotfiles/dotdirs in BOTH original and resolved paths (security layer - no override)
   if (pathContainsDotfile(originalAbsolutePath)) {
-    throw new Error(
+    throw new PrinterError(
+      "PERMISSION_DENIED",
       `Access denied: Dotfiles and hidden directories cannot be printed for security reasons. ` +
         `Path "${filePath}" contains hidden components.`
     )
   }
 
   if (pathContainsDotfile(absolutePath) && absolutePath !== originalAbsolutePath) {
-    throw new Error(
+    throw new PrinterError(
+      "PERMISSION_DENIED",
       `Access denied: Dotfiles and hidden directories cannot be printed for security reasons. ` +
         `Path "${filePath}" resolves to a hidden file or directory.`
     )
@@ -59,17 +76,18 @@ export function validateFilePath(filePath: string): void {
   for (const deniedPath of config.deniedPaths) {
     const resolvedDeniedPath = resolve(deniedPath)
     if (absolutePath.startsWith(resolvedDeniedPath + sep) || absolutePath === resolvedDeniedPath) {
-      throw new Error(
+      throw new PrinterError(
+        "PERMISSION_DENIED",
         `Access denied: File path "${filePath}" is in a restricted directory (${deniedPath}). ` +
           `This path is blocked for security reasons.`
       )
     }
   }
 
-  // Check if file is under at least one allowed path
+  // Check if file is under at least one allowed path (roots may themselves be symlinks)
   let isAllowed = false
   for (const allowedPath of config.allowedPaths) {
-    const resolvedAllowedPath = resolve(allowedPath)
+    const resolvedAllowedPath = resolveRealPath(resolve(allowedPath))
     if (
       absolutePath.startsWith(resolvedAllowedPath + sep) ||
       absolutePath === resolvedAllowedPath
@@ -80,10 +98,11 @@ export function validateFilePath(filePath: string): void {
   }
 
   if (!isAllowed) {
-    throw new Error(
-      `Access denied: File is outside allowed directories. ` +
-        `Configure MCP_PRINTER_ALLOWED_PATHS to grant access to additional paths. ` +
-        `Default allowed: ~/Documents, ~/Downloads, ~/Desktop.`
+    throw new PrinterError(
+      "PERMISSION_DENIED",
+      `Access denied: File "${filePath}" is outside allowed directories. ` +
+        `Allowed directories: ${config.allowedPaths.join(", ")}. ` +
+        `Configure MCP_PRINTER_ALLOWED_PATHS to grant access to additional paths.`
     )
   }
 }
@@ -0,0 +1,299 @@
+/**
+ * @fileoverview Streamable HTTP transport.
+ * Serves MCP over HTTP (the MCP Streamable HTTP spec) so the server can run as a daemon on the
+ * machine attached to the printer: clients POST JSON-RPC messages, receive responses and
+ * server-to-client messages over SSE, and are tracked by the Mcp-Session-Id header.
+ * Each session gets its own McpServer instance, and is recorded with the client that opened it
+ * (see sessions.ts). Sessions that send no request for MCP_PRINTER_SESSION_TTL_MINUTES, and
+ * have no SSE stream open to hear from the server, are closed, and the jobs they queued that
+ * haven't been submitted yet are canceled. When an auth
+ * token is configured, every request must carry `Authorization: Bearer <token>`. At shutdown
+ * every session is sent a final notification before its streams are closed.
+ */
+
+import { createServer, type IncomingMessage, type Server, type ServerResponse } from "http"
+import { createHash, randomUUID, timingSafeEqual } from "crypto"
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { StreamableHTTPServerTransport } from "@modelcontextprotocol/sdk/server/streamableHttp.js"
+import { isInitializeRequest } from "@modelcontextprotocol/sdk/types.js"
+import type { ListenAddress } from "./cli.js"
+import { config } from "./config.js"
+import { cancelWaitingJobs } from "./job-queue.js"
+import { logger } from "./logger.js"
+import { clientLabel, closeSession, idleSessions, openSession, touchSession } from "./sessions.js"
+import { SERVER_LOGGER } from "./tools/logging.js"
+
+/** Path the MCP endpoint is served on. */
+export const MCP_ENDPOINT = "/mcp"
+
+/** Largest request body accepted, in bytes. */
+const MAX_BODY_BYTES = 10 * 1024 * 1024
+
+/** Milliseconds per minute. */
+const MS_PER_MINUTE = 60_000
+
+/** Longest time between two checks for idle sessions, in milliseconds. */
+const REAP_INTERVAL_MS = MS_PER_MINUTE
+
+/**
+ * An MCP session over HTTP.
+ */
+interface HttpSession {
+  transport: StreamableHTTPServerTransport
+  server: McpServer
+  /** SSE streams the client has open with GET, listening for server-to-client messages */
+  streams: number
+}
+
+/** Open sessions of each HTTP server, for closeHttpServer. */
+const serverSessions = new WeakMap<Server, Map<string, HttpSession>>()
+
+/**
+ * Sends a JSON-RPC error response that isn't tied to a request ID.
+ */
+function sendJsonRpcError(res: ServerResponse, status: number, code: number, message: string) {
+  res.writeHead(status, { "Content-Type": "application/json" })
+  res.end(JSON.stringify({ jsonrpc: "2.0", error: { code, message }, id: null }))
+}
+
+/**
+ * Checks an Authorization header against the configured bearer token in constant time.
+ * Both values are hashed first so the comparison doesn't leak the token's length either.
+ *
+ * @param header - Authorization header from the request
+ * @param token - Configured token
+ * @returns True if the header is `Bearer <token>`
+ */
+export function isAuthorized(header: string | undefined, token: string): boolean {
+  const presented = header?.match(/^Bearer (.+)$/i)?.[1] ?? ""
+  const digest = (value: string) => createHash("sha256").update(value).digest()
+  return timingSafeEqual(digest(presented), digest(token)) && presented.length > 0
+}
+
+/**
+ * Reads a request body, refusing bodies over MAX_BODY_BYTES.
+ */
+function readBody(req: IncomingMessage): Promise<string> {
+  return new Promise((resolve, reject) => {
+    const chunks: Buffer[] = []
+    let received = 0
+    req.on("data", (chunk: Buffer) => {
+      received += chunk.length
+      if (received > MAX_BODY_BYTES) {
+        reject(new Error("Request body too large"))
+        req.destroy()
+        return
+      }
+      chunks.push(chunk)
+    })
+    req.on("end", () => resolve(Buffer.concat(chunks).toString("utf-8")))
+    req.on("error", reject)
+  })
+}
+
+/**
+ * Starts the Streamable HTTP transport.
+ *
+ * @param createMcpServer - Creates a fully registered McpServer for each new session
+ * @param listen - Address to listen on
+ * @param options - Bearer token every request must present (no authentication when empty)
+ * @returns The listening HTTP server (closing it closes every session)
+ */
+export async function startHttpServer(
+  createMcpServer: () => McpServer,
+  listen: ListenAddress,
+  options: { authToken?: string } = {}
+): Promise<Server> {
+  const sessions = new Map<string, HttpSession>()
+  const { authToken } = options
+
+  async function handleRequest(req: IncomingMessage, res: ServerResponse) {
+    // Authenticate before reading the body or touching any JSON-RPC state
+    if (authToken && !isAuthorized(req.headers.authorization, authToken)) {
+      res.writeHead(401, {
+        "Content-Type": "application/json",
+        "WWW-Authenticate": 'Bearer realm="mcp-printer"',
+      })
+      res.end(JSON.stringify({ error: "Unauthorized: missing or invalid bearer token" }))
+      return
+    }
+
+    const url = new URL(req.url ?? "/", "http://localhost")
+    if (url.pathname !== MCP_ENDPOINT) {
+      res.writeHead(404, { "Content-Type": "text/plain" })
+      res.end(`Not found. The MCP endpoint is ${MCP_ENDPOINT}`)
+      return
+    }
+
+    let body: unknown
+    if (req.method === "POST") {
+      try {
+        body = JSON.parse(await readBody(req))
+      } catch (error) {
+        const message = error instanceof Error ? error.message : String(error)
+        sendJsonRpcError(res, 400, -32700, `Parse error: ${message}`)
+        return
+      }
+    }
+
+    const sessionHeader = req.headers["mcp-session-id"]
+    const sessionId = Array.isArray(sessionHeader) ? sessionHeader[0] : sessionHeader
+    const session = sessionId ? sessions.get(sessionId) : undefined
+    let transport = session?.transport
+
+    if (sessionId && !session) {
+      sendJsonRpcError(res, 404, -32001, "Session not found")
+      return
+    }
+    if (sessionId && session) {
+      touchSession(sessionId)
+      // A client listening on a stream is active until it hangs up, however long it is quiet
+      if (req.method === "GET") {
+        session.streams++
+        res.on("close", () => {
+          session.streams--
+          touchSession(sessionId)
+        })
+      }
+    }
+
+    if (!transport) {
+      if (req.method !== "POST" || !isInitializeRequest(body)) {
+        sendJsonRpcError(res, 400, -32000, "Bad Request: no valid session ID provided")
+        return
+      }
+
+      const { clientInfo } = body.params
+      const mcpServer = createMcpServer()
+      const newTransport = new StreamableHTTPServerTransport({
+        sessionIdGenerator: () => randomUUID(),
+        onsessioninitialized: (id) => {
+          sessions.set(id, { transport: newTransport, server: mcpServer, streams: 0 })
+          openSession(id, clientInfo)
+        },
+      })
+      newTransport.onclose = () => {
+        if (newTransport.sessionId) {
+          sessions.delete(newTransport.sessionId)
+          closeSession(newTransport.sessionId)
+        }
+      }
+      await mcpServer.connect(newTransport)
+      transport = newTransport
+    }
+
+    await transport.handleRequest(req, res, body)
+  }
+
+  const server = createServer((req, res) => {
+    handleRequest(req, res).catch((error) => {
+      logger.error("error handling MCP request", { error })
+      if (!res.headersSent) {
+        sendJsonRpcError(res, 500, -32603, "Internal server error")
+      } else {
+        res.end()
+      }
+    })
+  })
+
+  const ttlMs = config.sessionTtlMinutes * MS_PER_MINUTE
+  const reaper =
+    ttlMs > 0
+      ? setInterval(() => {
+          reapIdleSessions(server).catch((error) => {
+            logger.error("failed to close idle sessions", { error })
+          })
+        }, Math.min(ttlMs, REAP_INTERVAL_MS))
+      : undefined
+  // Checking for idle sessions never keeps the process alive on its own
+  reaper?.unref()
+
+  server.on("close", () => {
+    clearInterval(reaper)
+    for (const { transport } of sessions.values()) {
+      void transport.close()
+    }
+    sessions.clear()
+  })
+  serverSessions.set(server, sessions)
+
+  await new Promise<void>((resolve, reject) => {
+    server.once("error", reject)
+    server.listen(listen.port, listen.host, () => {
+      server.off("error", reject)
+      resolve()
+    })
+  })
+
+  return server
+}
+
+/**
+ * Closes the sessions that haven't sent a request for longer than
+ * MCP_PRINTER_SESSION_TTL_MINUTES and have no SSE stream open (a stream that closes counts as
+ * the session's last activity). The jobs each one queued that haven't been submitted yet are
+ * canceled first, and recorded in the job history as canceled with the reason "session expired".
+ * Runs every minute (or every TTL, if it is shorter) while the server listens.
+ *
+ * @param server - Server returned by startHttpServer
+ * @param now - The current time, in milliseconds
+ * @returns IDs of the sessions closed
+ */
+export async function reapIdleSessions(server: Server, now = Date.now()): Promise<string[]> {
+  const sessions = serverSessions.get(server)
+  const ttlMs = config.sessionTtlMinutes * MS_PER_MINUTE
+  if (!sessions || !(ttlMs > 0)) {
+    return []
+  }
+
+  const reaped: string[] = []
+  for (const id of idleSessions(ttlMs, now)) {
+    const session = sessions.get(id)
+    if (!session || session.streams > 0) {
+      // Another server's session, or one still listening on a stream
+      continue
+    }
+    const canceled = await cancelWaitingJobs("session expired", id)
+    logger.info("session expired", {
+      session: id,
+      client: clientLabel(id),
+      canceled_jobs: canceled,
+    })
+    sessions.delete(id)
+    closeSession(id)
+    await session.transport.close()
+    reaped.push(id)
+  }
+  return reaped
+}
+
+/**
+ * Closes the Streamable HTTP transport at shutdown. Every session is sent a final
+ * notifications/message saying the server is shutting down, its streams are ended, and the
+ * server stops listening.
+ *
+ * @param server - Server returned by startHttpServer
+ */
+export async function closeHttpServer(server: Server): Promise<void> {
+  const sessions = serverSessions.get(server) ?? new Map<string, HttpSession>()
+  await Promise.all(
+    [...sessions.values()].map(async (session) => {
+      await session.server.server
+        .sendLoggingMessage({
+          level: "notice",
+          logger: SERVER_LOGGER,
+          data: "The server is shutting down.",
+        })
+        .catch(() => {
+          // The client has already gone
+        })
+      await session.transport.close()
+    })
+  )
+  sessions.clear()
+
+  await new Promise<void>((resolve) => {
+    server.close(() => resolve())
+    server.closeAllConnections()
+  })
+}
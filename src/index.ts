@@ -6,9 +6,17 @@
  */
 
 import { startServer } from "./server.js"
+import { parseCliArgs } from "./cli.js"
+
+/**
+ * Parses the command line and starts the server (stdio unless --transport=http is given).
+ */
+async function main() {
+  await startServer(parseCliArgs(process.argv.slice(2)))
+}
 
 // Start the MCP Printer server
-startServer().catch((error) => {
+main().catch((error) => {
   console.error("Fatal error:", error)
   process.exit(1)
 })
@@ -0,0 +1,616 @@
+/**
+ * @fileoverview Minimal IPP client for printing straight to a printer URI.
+ * Used when the printer is given as an `ipp://` or `ipps://` URI instead of a CUPS queue name.
+ * Supports Print-Job, Get-Printer-Attributes, Get-Job-Attributes, and Cancel-Job over
+ * HTTP (ipp://) and HTTPS (ipps://), both on port 631 by default.
+ */
+
+import http from "http"
+import https from "https"
+import { readFile } from "fs/promises"
+import { userInfo } from "os"
+import { extname } from "path"
+import { config } from "../config.js"
+import { classifyIppStatus, PrinterError } from "../errors.js"
+import { abortError, operationSignal } from "../timeouts.js"
+import { RAW_OPTION } from "../raw.js"
+import type { JobState, JobStatus, LpJobOptions } from "../cups.js"
+import {
+  decodeIppMessage,
+  encodeIppMessage,
+  getAttributeValues,
+  GROUP_TAGS,
+  OPERATIONS,
+  VALUE_TAGS,
+  type IppAttribute,
+  type IppAttributeGroup,
+  type IppMessage,
+  type IppValue,
+} from "./encoding.js"
+import { cupsOptionsToIppAttributes } from "./options.js"
+
+/** Default port for ipp:// and ipps:// URIs. */
+const IPP_DEFAULT_PORT = "631"
+
+/** IPP status codes the client reacts to. */
+const STATUS = {
+  notFound: 0x0406,
+  gone: 0x0407,
+} as const
+
+/** Names for common IPP error status codes, used in error messages. */
+const STATUS_NAMES: Record<number, string> = {
+  0x0400: "client-error-bad-request",
+  0x0401: "client-error-forbidden",
+  0x0402: "client-error-not-authenticated",
+  0x0403: "client-error-not-authorized",
+  0x0404: "client-error-not-possible",
+  0x0405: "client-error-timeout",
+  0x0406: "client-error-not-found",
+  0x0407: "client-error-gone",
+  0x0408: "client-error-request-entity-too-large",
+  0x040a: "client-error-document-format-not-supported",
+  0x040b: "client-error-attributes-or-values-not-supported",
+  0x0500: "server-error-internal-error",
+  0x0501: "server-error-operation-not-supported",
+  0x0502: "server-error-service-unavailable",
+  0x0503: "server-error-version-not-supported",
+  0x0504: "server-error-device-error",
+  0x0505: "server-error-temporary-error",
+  0x0506: "server-error-not-accepting-jobs",
+  0x0507: "server-error-busy",
+  0x0508: "server-error-job-canceled",
+}
+
+/** Maps the IPP job-state enum to the job states reported by get_job_status. */
+const JOB_STATES: Record<number, JobState> = {
+  3: "pending",
+  4: "held", // pending-held
+  5: "processing",
+  6: "processing", // processing-stopped
+  7: "canceled",
+  8: "aborted",
+  9: "completed",
+}
+
+/** Document formats sent for common file extensions; anything else is auto-sensed. */
+const DOCUMENT_FORMATS: Record<string, string> = {
+  pdf: "application/pdf",
+  ps: "application/postscript",
+  txt: "text/plain",
+  text: "text/plain",
+  jpg: "image/jpeg",
+  jpeg: "image/jpeg",
+  png: "image/png",
+  pwg: "image/pwg-raster",
+  urf: "image/urf",
+}
+
+/** Socket error codes of a printer that is off, asleep, or off the network. */
+const CONNECTION_ERROR_CODES = [
+  "ECONNREFUSED",
+  "ECONNRESET",
+  "EHOSTDOWN",
+  "EHOSTUNREACH",
+  "ENETUNREACH",
+  "ETIMEDOUT",
+  "EAI_AGAIN",
+]
+
+/** TLS error codes that indicate an untrusted (usually self-signed) printer certificate. */
+const UNTRUSTED_CERT_CODES = [
+  "DEPTH_ZERO_SELF_SIGNED_CERT",
+  "SELF_SIGNED_CERT_IN_CHAIN",
+  "UNABLE_TO_VERIFY_LEAF_SIGNATURE",
+  "UNABLE_TO_GET_ISSUER_CERT_LOCALLY",
+  "ERR_TLS_CERT_ALTNAME_INVALID",
+]
+
+/**
+ * Error returned by a printer in an IPP response, coded like the CUPS errors.
+ */
+export class IppError extends PrinterError {
+  /** IPP status code (e.g., 0x0406 client-error-not-found) */
+  readonly statusCode: number
+
+  constructor(message: string, statusCode: number) {
+    super(classifyIppStatus(statusCode) ?? "JOB_REJECTED", message)
+    this.name = "IppError"
+    this.statusCode = statusCode
+  }
+}
+
+let nextRequestId = 1
+
+/**
+ * Checks whether a printer value is an IPP URI rather than a CUPS queue name.
+ *
+ * @param printer - Printer value from a tool call or config
+ * @returns True for `ipp://` and `ipps://` URIs
+ */
+export function isIppUri(printer: string | undefined): printer is string {
+  return /^ipps?:\/\//i.test(printer ?? "")
+}
+
+/**
+ * Formats the job ID reported for a job sent straight to an IPP printer.
+ *
+ * @param printerUri - Printer URI the job was sent to
+ * @param jobId - job-id assigned by the printer
+ * @returns Job ID in the form "<printer-uri>#<job-id>"
+ */
+export function formatIppJobId(printerUri: string, jobId: number): string {
+  return `${printerUri}#${jobId}`
+}
+
+/**
+ * Parses a job ID returned by formatIppJobId.
+ *
+ * @param jobId - Job ID (e.g., "ipp://printer.local/ipp/print#42")
+ * @returns The printer URI and numeric job-id, or null if this is not an IPP job ID
+ */
+export function parseIppJobId(jobId: string): { printerUri: string; jobId: number } | null {
+  const match = jobId.match(/^(ipps?:\/\/.+)#(\d+)$/i)
+  return match ? { printerUri: match[1], jobId: parseInt(match[2], 10) } : null
+}
+
+/**
+ * Checks whether an IPP URI is on the CUPS server (MCP_PRINTER_CUPS_SERVER), e.g.
+ * ipp://printserver:631/printers/Office for a queue of printserver:631.
+ *
+ * @param uri - Parsed ipp:// or ipps:// URI
+ * @returns True if its host and port are the CUPS server's
+ */
+function isOnCupsServer(uri: URL): boolean {
+  // A domain socket (/run/cups/cups.sock) has no host to match
+  if (!config.cupsServer || config.cupsServer.startsWith("/")) {
+    return false
+  }
+  try {
+    const server = new URL(`ipp://${config.cupsServer}`)
+    return (
+      server.hostname.toLowerCase() === uri.hostname.toLowerCase() &&
+      (server.port || IPP_DEFAULT_PORT) === (uri.port || IPP_DEFAULT_PORT)
+    )
+  } catch {
+    return false
+  }
+}
+
+/**
+ * Converts an IPP URI to the HTTP(S) URL its requests are POSTed to. Requests to the CUPS
+ * server are sent over TLS too when MCP_PRINTER_CUPS_ENCRYPTION is "always".
+ *
+ * @param printerUri - ipp:// or ipps:// URI
+ * @returns http:// URL for ipp://, https:// URL for ipps://, with port 631 unless specified
+ * @throws {Error} If the URI is not a valid IPP URI
+ */
+export function ippUriToHttpUrl(printerUri: string): URL {
+  let uri: URL
+  try {
+    uri = new URL(printerUri)
+  } catch {
+    throw new Error(`Invalid printer URI "${printerUri}"`)
+  }
+  if (uri.protocol !== "ipp:" && uri.protocol !== "ipps:") {
+    throw new Error(`Invalid printer URI "${printerUri}": expected ipp:// or ipps://`)
+  }
+
+  const encrypted =
+    uri.protocol === "ipps:" || (config.cupsEncryption === "always" && isOnCupsServer(uri))
+  const scheme = encrypted ? "https" : "http"
+  return new URL(
+    `${scheme}://${uri.hostname}:${uri.port || IPP_DEFAULT_PORT}${uri.pathname}${uri.search}`
+  )
+}
+
+/**
+ * Returns the user name sent as requesting-user-name.
+ */
+function requestingUserName(): string {
+  try {
+    return userInfo().username
+  } catch {
+    return "mcp-printer"
+  }
+}
+
+/**
+ * Builds the operation attributes group shared by every request.
+ */
+function operationAttributes(printerUri: string, extra: IppAttribute[] = []): IppAttributeGroup {
+  return {
+    tag: GROUP_TAGS.operation,
+    attributes: [
+      { name: "attributes-charset", tag: VALUE_TAGS.charset, values: ["utf-8"] },
+      { name: "attributes-natural-language", tag: VALUE_TAGS.naturalLanguage, values: ["en"] },
+      { name: "printer-uri", tag: VALUE_TAGS.uri, values: [printerUri] },
+      {
+        name: "requesting-user-name",
+        tag: VALUE_TAGS.nameWithoutLanguage,
+        values: [requestingUserName()],
+      },
+      ...extra,
+    ],
+  }
+}
+
+/**
+ * POSTs an encoded request and returns the raw response body.
+ * The request is aborted when the signal fires (on timeout or cancellation).
+ */
+function postIpp(url: URL, body: Buffer, signal: AbortSignal): Promise<Buffer> {
+  const secure = url.protocol === "https:"
+  const transport = secure ? https : http
+
+  return new Promise((resolve, reject) => {
+    const request = transport.request(
+      url,
+      {
+        method: "POST",
+        headers: { "Content-Type": "application/ipp", "Content-Length": body.length },
+        signal,
+        ...(secure ? { rejectUnauthorized: !config.ippInsecureTls } : {}),
+      },
+      (response) => {
+        const chunks: Buffer[] = []
+        response.on("data", (chunk: Buffer) => chunks.push(chunk))
+        response.on("error", reject)
+        response.on("end", () => {
+          if (response.statusCode !== 200) {
+            reject(new Error(`Printer at ${url.host} returned HTTP ${response.statusCode}`))
+            return
+          }
+          resolve(Buffer.concat(chunks))
+        })
+      }
+    )
+
+    request.on("error", (error: NodeJS.ErrnoException) => {
+      if (signal.aborted) {
+        reject(abortError(`IPP request to ${url.host}`, signal))
+        return
+      }
+      const hint =
+        error.code && UNTRUSTED_CERT_CODES.includes(error.code)
+          ? ". Set MCP_PRINTER_IPP_INSECURE_TLS=true to accept self-signed printer certificates"
+          : ""
+      const message = `Failed to reach printer at ${url.host}: ${error.message}${hint}`
+      reject(
+        error.code && CONNECTION_ERROR_CODES.includes(error.code)
+          ? new PrinterError("PRINTER_UNREACHABLE", message, { cause: error })
+          : new Error(message)
+      )
+    })
+    request.end(body)
+  })
+}
+
+/**
+ * Sends an IPP request to a printer and decodes the response.
+ *
+ * @param printerUri - ipp:// or ipps:// printer URI
+ * @param operation - Operation ID (see OPERATIONS)
+ * @param groups - Attribute groups (operation attributes first)
+ * @param data - Optional document data (Print-Job)
+ * @param signal - The MCP request's signal. The request is also aborted after
+ *   MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS for Print-Job, or MCP_PRINTER_STATUS_TIMEOUT_SECONDS
+ * @returns Decoded response
+ * @throws {IppError} If the printer returns an error status
+ * @throws {PrinterError} TIMEOUT if the printer doesn't answer in time
+ * @throws {PrinterError} PRINTER_UNREACHABLE if the connection is refused or drops
+ * @throws {Error} If the printer cannot be reached or the response is malformed
+ */
+export async function sendIppRequest(
+  printerUri: string,
+  operation: number,
+  groups: IppAttributeGroup[],
+  data?: Buffer,
+  signal?: AbortSignal
+): Promise<IppMessage> {
+  const request: IppMessage = {
+    version: [2, 0],
+    code: operation,
+    requestId: nextRequestId++,
+    groups,
+    data,
+  }
+  const kind = operation === OPERATIONS.printJob ? "submit" : "status"
+  const body = await postIpp(
+    ippUriToHttpUrl(printerUri),
+    encodeIppMessage(request),
+    operationSignal(kind, signal)
+  )
+  const response = decodeIppMessage(body)
+
+  if (response.code >= 0x0400) {
+    const statusName =
+      STATUS_NAMES[response.code] ?? `status 0x${response.code.toString(16).padStart(4, "0")}`
+    const [statusMessage] = getAttributeValues(response, GROUP_TAGS.operation, "status-message")
+    throw new IppError(
+      `Printer at ${printerUri} rejected the request: ${statusName}` +
+        (statusMessage ? ` (${String(statusMessage)})` : ""),
+      response.code
+    )
+  }
+
+  return response
+}
+
+/**
+ * Collects the attributes of the first group with the given tag into a name → values record.
+ */
+function groupToRecord(message: IppMessage, groupTag: number): Record<string, IppValue[]> {
+  const group = message.groups.find((g) => g.tag === groupTag)
+  return Object.fromEntries((group?.attributes ?? []).map((a) => [a.name, a.values]))
+}
+
+/**
+ * Sends a document with Print-Job.
+ *
+ * @param printerUri - Printer URI
+ * @param document - Document bytes
+ * @param options - Job name, document format, job template attributes, and the signal that
+ *   cancels the request
+ * @returns The job-id assigned by the printer
+ */
+export async function printJob(
+  printerUri: string,
+  document: Buffer,
+  options: {
+    jobName?: string
+    documentFormat?: string
+    jobAttributes?: IppAttribute[]
+    signal?: AbortSignal
+  } = {}
+): Promise<number> {
+  const extra: IppAttribute[] = [
+    ...(options.jobName
+      ? [{ name: "job-name", tag: VALUE_TAGS.nameWithoutLanguage, values: [options.jobName] }]
+      : []),
+    {
+      name: "document-format",
+      tag: VALUE_TAGS.mimeMediaType,
+      values: [options.documentFormat ?? "application/octet-stream"],
+    },
+  ]
+  const groups = [operationAttributes(printerUri, extra)]
+  if (options.jobAttributes && options.jobAttributes.length > 0) {
+    groups.push({ tag: GROUP_TAGS.job, attributes: options.jobAttributes })
+  }
+
+  const response = await sendIppRequest(
+    printerUri,
+    OPERATIONS.printJob,
+    groups,
+    document,
+    options.signal
+  )
+  const [jobId] = getAttributeValues(response, GROUP_TAGS.job, "job-id")
+  if (typeof jobId !== "number") {
+    throw new Error(`Printer at ${printerUri} did not report a job ID`)
+  }
+  return jobId
+}
+
+/**
+ * Fetches printer attributes with Get-Printer-Attributes.
+ *
+ * @param printerUri - Printer URI
+ * @param requested - Attribute names or groups to request (default: "all")
+ * @param signal - The MCP request's signal
+ * @returns Printer attributes keyed by name
+ */
+export async function getPrinterAttributes(
+  printerUri: string,
+  requested: string[] = ["all"],
+  signal?: AbortSignal
+): Promise<Record<string, IppValue[]>> {
+  const groups = [
+    operationAttributes(printerUri, [
+      { name: "requested-attributes", tag: VALUE_TAGS.keyword, values: requested },
+    ]),
+  ]
+  const response = await sendIppRequest(
+    printerUri,
+    OPERATIONS.getPrinterAttributes,
+    groups,
+    undefined,
+    signal
+  )
+  return groupToRecord(response, GROUP_TAGS.printer)
+}
+
+/**
+ * Fetches job attributes with Get-Job-Attributes.
+ *
+ * @param printerUri - Printer URI
+ * @param jobId - job-id assigned by the printer
+ * @param signal - The MCP request's signal
+ * @returns Job attributes keyed by name
+ */
+export async function getJobAttributes(
+  printerUri: string,
+  jobId: number,
+  signal?: AbortSignal
+): Promise<Record<string, IppValue[]>> {
+  const groups = [
+    operationAttributes(printerUri, [
+      { name: "job-id", tag: VALUE_TAGS.integer, values: [jobId] },
+      {
+        name: "requested-attributes",
+        tag: VALUE_TAGS.keyword,
+        values: [
+          "job-id",
+          "job-name",
+          "job-state",
+          "job-state-reasons",
+          "job-state-message",
+          "job-originating-user-name",
+          "job-k-octets",
+          "date-time-at-creation",
+        ],
+      },
+    ]),
+  ]
+  const response = await sendIppRequest(
+    printerUri,
+    OPERATIONS.getJobAttributes,
+    groups,
+    undefined,
+    signal
+  )
+  return groupToRecord(response, GROUP_TAGS.job)
+}
+
+/**
+ * Cancels a job with Cancel-Job.
+ *
+ * @param printerUri - Printer URI
+ * @param jobId - job-id assigned by the printer
+ * @param signal - The MCP request's signal
+ */
+export async function cancelJob(
+  printerUri: string,
+  jobId: number,
+  signal?: AbortSignal
+): Promise<void> {
+  const groups = [
+    operationAttributes(printerUri, [{ name: "job-id", tag: VALUE_TAGS.integer, values: [jobId] }]),
+  ]
+  await sendIppRequest(printerUri, OPERATIONS.cancelJob, groups, undefined, signal)
+}
+
+/**
+ * Releases a held job with Release-Job.
+ *
+ * @param printerUri - Printer URI
+ * @param jobId - job-id assigned by the printer
+ * @param signal - The MCP request's signal
+ */
+export async function releaseJob(
+  printerUri: string,
+  jobId: number,
+  signal?: AbortSignal
+): Promise<void> {
+  const groups = [
+    operationAttributes(printerUri, [{ name: "job-id", tag: VALUE_TAGS.integer, values: [jobId] }]),
+  ]
+  await sendIppRequest(printerUri, OPERATIONS.releaseJob, groups, undefined, signal)
+}
+
+/**
+ * Submits a job straight to an IPP printer. Counterpart of submitLpJob for printer URIs:
+ * CUPS options are translated to IPP job template attributes. Raw jobs (the `raw` option) are
+ * sent as application/octet-stream, which the printer takes in its own command language.
+ *
+ * @param job - Job options; `printer` must be an ipp:// or ipps:// URI
+ * @param signal - Signal that cancels the submission
+ * @returns Job ID in the form "<printer-uri>#<job-id>"
+ * @throws {Error} If the file cannot be read, the printer rejects the job, or the submission
+ *   times out
+ */
+export async function submitIppJob(job: LpJobOptions, signal?: AbortSignal): Promise<string> {
+  if (!isIppUri(job.printer)) {
+    throw new Error(`Invalid printer URI "${job.printer ?? ""}": expected ipp:// or ipps://`)
+  }
+
+  const document = job.filePath
+    ? await readFile(job.filePath)
+    : Buffer.isBuffer(job.content)
+      ? job.content
+      : Buffer.from(job.content ?? "", "utf-8")
+  const raw = job.options?.includes(RAW_OPTION) ?? false
+  const documentFormat = raw
+    ? "application/octet-stream"
+    : job.filePath
+      ? DOCUMENT_FORMATS[extname(job.filePath).slice(1).toLowerCase()]
+      : "text/plain"
+  const options = (job.options ?? []).filter((option) => option !== RAW_OPTION)
+
+  const jobId = await printJob(job.printer, document, {
+    jobName: job.title,
+    documentFormat,
+    jobAttributes: cupsOptionsToIppAttributes(options, job.copies),
+    signal,
+  })
+  return formatIppJobId(job.printer, jobId)
+}
+
+/**
+ * Looks up the state of a job sent to an IPP printer.
+ * Jobs the printer no longer knows about are reported with state "not-found".
+ *
+ * @param jobId - Job ID returned by submitIppJob
+ * @param signal - The MCP request's signal
+ * @returns The job's status, in the same shape as getJobStatus
+ */
+export async function getIppJobStatus(jobId: string, signal?: AbortSignal): Promise<JobStatus> {
+  const parsed = parseIppJobId(jobId)
+  if (!parsed) {
+    return { job_id: jobId, state: "not-found" }
+  }
+
+  let attributes: Record<string, IppValue[]>
+  try {
+    attributes = await getJobAttributes(parsed.printerUri, parsed.jobId, signal)
+  } catch (error) {
+    if (
+      error instanceof IppError &&
+      (error.statusCode === STATUS.notFound || error.statusCode === STATUS.gone)
+    ) {
+      return { job_id: jobId, state: "not-found", printer: parsed.printerUri }
+    }
+    throw error
+  }
+
+  const [state] = attributes["job-state"] ?? []
+  const [user] = attributes["job-originating-user-name"] ?? []
+  const [kOctets] = attributes["job-k-octets"] ?? []
+  const [created] = attributes["date-time-at-creation"] ?? []
+  const [message] = attributes["job-state-message"] ?? []
+  const alerts = (attributes["job-state-reasons"] ?? [])
+    .map(String)
+    .filter((reason) => reason !== "none")
+
+  return {
+    job_id: jobId,
+    state: JOB_STATES[state as number] ?? "pending",
+    printer: parsed.printerUri,
+    ...(typeof user === "string" ? { user } : {}),
+    ...(typeof kOctets === "number" ? { size: kOctets * 1024 } : {}),
+    ...(created instanceof Date ? { submitted: created.toISOString() } : {}),
+    alerts,
+    ...(typeof message === "string" && message ? { status_message: message } : {}),
+  }
+}
+
+/**
+ * Cancels a job sent to an IPP printer.
+ *
+ * @param jobId - Job ID returned by submitIppJob
+ * @param signal - The MCP request's signal
+ * @throws {Error} If the job ID is not an IPP job ID or the printer rejects the request
+ */
+export async function cancelIppJob(jobId: string, signal?: AbortSignal): Promise<void> {
+  const parsed = parseIppJobId(jobId)
+  if (!parsed) {
+    throw new Error(`Invalid IPP job ID "${jobId}"`)
+  }
+  await cancelJob(parsed.printerUri, parsed.jobId, signal)
+}
+
+/**
+ * Releases a held job sent to an IPP printer.
+ *
+ * @param jobId - Job ID returned by submitIppJob
+ * @param signal - The MCP request's signal
+ * @throws {Error} If the job ID is not an IPP job ID or the printer rejects the request
+ */
+export async function releaseIppJob(jobId: string, signal?: AbortSignal): Promise<void> {
+  const parsed = parseIppJobId(jobId)
+  if (!parsed) {
+    throw new Error(`Invalid IPP job ID "${jobId}"`)
+  }
+  await releaseJob(parsed.printerUri, parsed.jobId, signal)
+}
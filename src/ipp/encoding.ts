@@ -0,0 +1,476 @@
+/**
+ * @fileoverview IPP message encoding and decoding (RFC 8010).
+ *
+ * An IPP message is a binary header (version, operation-id or status-code, request-id)
+ * followed by attribute groups and an optional document. Each group starts with a
+ * delimiter tag; each attribute is encoded as:
+ *
+ * ```
+ * value-tag (1 byte) | name-length (2) | name | value-length (2) | value
+ * ```
+ *
+ * Additional values of a multi-valued (1setOf) attribute repeat the value-tag with a
+ * zero name-length. Collections are delimited by begCollection/endCollection with
+ * memberAttrName entries naming each member.
+ */
+
+/** Delimiter tags that start an attribute group. */
+export const GROUP_TAGS = {
+  operation: 0x01,
+  job: 0x02,
+  end: 0x03,
+  printer: 0x04,
+  unsupported: 0x05,
+} as const
+
+/** Value tags used by the attributes this client sends and reads. */
+export const VALUE_TAGS = {
+  unsupported: 0x10,
+  unknown: 0x12,
+  noValue: 0x13,
+  integer: 0x21,
+  boolean: 0x22,
+  enum: 0x23,
+  octetString: 0x30,
+  dateTime: 0x31,
+  resolution: 0x32,
+  rangeOfInteger: 0x33,
+  begCollection: 0x34,
+  textWithLanguage: 0x35,
+  nameWithLanguage: 0x36,
+  endCollection: 0x37,
+  textWithoutLanguage: 0x41,
+  nameWithoutLanguage: 0x42,
+  keyword: 0x44,
+  uri: 0x45,
+  uriScheme: 0x46,
+  charset: 0x47,
+  naturalLanguage: 0x48,
+  mimeMediaType: 0x49,
+  memberAttrName: 0x4a,
+} as const
+
+/** IPP operation IDs. */
+export const OPERATIONS = {
+  printJob: 0x0002,
+  cancelJob: 0x0008,
+  getJobAttributes: 0x0009,
+  getPrinterAttributes: 0x000b,
+  releaseJob: 0x000d,
+} as const
+
+/** A resolution value (units: 3 = dots per inch, 4 = dots per centimeter). */
+export interface IppResolution {
+  x: number
+  y: number
+  units: number
+}
+
+/** A rangeOfInteger value. */
+export interface IppRange {
+  lower: number
+  upper: number
+}
+
+/** A collection value, holding its member attributes. */
+export interface IppCollection {
+  members: IppAttribute[]
+}
+
+/**
+ * A decoded attribute value. Out-of-band values (unknown, no-value, unsupported) decode to null.
+ */
+export type IppValue =
+  | number
+  | boolean
+  | string
+  | Date
+  | Buffer
+  | IppResolution
+  | IppRange
+  | IppCollection
+  | null
+
+/** A named attribute with one or more values of the same tag. */
+export interface IppAttribute {
+  name: string
+  tag: number
+  values: IppValue[]
+}
+
+/** An attribute group (operation, job, printer, ...). */
+export interface IppAttributeGroup {
+  tag: number
+  attributes: IppAttribute[]
+}
+
+/** A complete IPP request or response. */
+export interface IppMessage {
+  /** IPP version as [major, minor], e.g. [2, 0] */
+  version: [number, number]
+  /** operation-id for requests, status-code for responses */
+  code: number
+  requestId: number
+  groups: IppAttributeGroup[]
+  /** Document data following the attributes (requests only) */
+  data?: Buffer
+}
+
+/**
+ * Incrementally builds a binary buffer.
+ */
+class ByteWriter {
+  private chunks: Buffer[] = []
+
+  byte(value: number): void {
+    this.chunks.push(Buffer.from([value]))
+  }
+
+  int16(value: number): void {
+    const buffer = Buffer.alloc(2)
+    buffer.writeUInt16BE(value)
+    this.chunks.push(buffer)
+  }
+
+  int32(value: number): void {
+    const buffer = Buffer.alloc(4)
+    buffer.writeInt32BE(value)
+    this.chunks.push(buffer)
+  }
+
+  /** Writes a 2-byte length followed by the bytes. */
+  field(bytes: Buffer): void {
+    this.int16(bytes.length)
+    this.chunks.push(bytes)
+  }
+
+  toBuffer(): Buffer {
+    return Buffer.concat(this.chunks)
+  }
+}
+
+/**
+ * Encodes a dateTime value (RFC 2579 DateAndTime, always in UTC).
+ */
+function encodeDateTime(date: Date): Buffer {
+  const buffer = Buffer.alloc(11)
+  buffer.writeUInt16BE(date.getUTCFullYear(), 0)
+  buffer.writeUInt8(date.getUTCMonth() + 1, 2)
+  buffer.writeUInt8(date.getUTCDate(), 3)
+  buffer.writeUInt8(date.getUTCHours(), 4)
+  buffer.writeUInt8(date.getUTCMinutes(), 5)
+  buffer.writeUInt8(date.getUTCSeconds(), 6)
+  buffer.writeUInt8(Math.floor(date.getUTCMilliseconds() / 100), 7)
+  buffer.write("+", 8, "ascii")
+  return buffer
+}
+
+/**
+ * Encodes a single attribute value according to its tag.
+ */
+function encodeValue(tag: number, value: IppValue): Buffer {
+  if (value === null) {
+    return Buffer.alloc(0)
+  }
+
+  switch (tag) {
+    case VALUE_TAGS.integer:
+    case VALUE_TAGS.enum: {
+      const buffer = Buffer.alloc(4)
+      buffer.writeInt32BE(value as number)
+      return buffer
+    }
+    case VALUE_TAGS.boolean:
+      return Buffer.from([value ? 1 : 0])
+    case VALUE_TAGS.dateTime:
+      return encodeDateTime(value as Date)
+    case VALUE_TAGS.resolution: {
+      const { x, y, units } = value as IppResolution
+      const buffer = Buffer.alloc(9)
+      buffer.writeInt32BE(x, 0)
+      buffer.writeInt32BE(y, 4)
+      buffer.writeInt8(units, 8)
+      return buffer
+    }
+    case VALUE_TAGS.rangeOfInteger: {
+      const { lower, upper } = value as IppRange
+      const buffer = Buffer.alloc(8)
+      buffer.writeInt32BE(lower, 0)
+      buffer.writeInt32BE(upper, 4)
+      return buffer
+    }
+    case VALUE_TAGS.octetString:
+      return Buffer.isBuffer(value) ? value : Buffer.from(String(value), "utf-8")
+    default:
+      return Buffer.from(String(value), "utf-8")
+  }
+}
+
+/**
+ * Writes an attribute (all of its values) to the writer.
+ */
+function writeAttribute(writer: ByteWriter, attribute: IppAttribute): void {
+  attribute.values.forEach((value, index) => {
+    const name = Buffer.from(index === 0 ? attribute.name : "", "utf-8")
+
+    if (attribute.tag === VALUE_TAGS.begCollection) {
+      writer.byte(VALUE_TAGS.begCollection)
+      writer.field(name)
+      writer.field(Buffer.alloc(0))
+      for (const member of (value as IppCollection).members) {
+        writer.byte(VALUE_TAGS.memberAttrName)
+        writer.field(Buffer.alloc(0))
+        writer.field(Buffer.from(member.name, "utf-8"))
+        writeAttribute(writer, { ...member, name: "" })
+      }
+      writer.byte(VALUE_TAGS.endCollection)
+      writer.field(Buffer.alloc(0))
+      writer.field(Buffer.alloc(0))
+      return
+    }
+
+    writer.byte(attribute.tag)
+    writer.field(name)
+    writer.field(encodeValue(attribute.tag, value))
+  })
+}
+
+/**
+ * Encodes an IPP message (header, attribute groups, end tag, and document data).
+ *
+ * @param message - Message to encode
+ * @returns Encoded bytes, ready to POST with Content-Type application/ipp
+ */
+export function encodeIppMessage(message: IppMessage): Buffer {
+  const writer = new ByteWriter()
+  writer.byte(message.version[0])
+  writer.byte(message.version[1])
+  writer.int16(message.code)
+  writer.int32(message.requestId)
+
+  for (const group of message.groups) {
+    writer.byte(group.tag)
+    for (const attribute of group.attributes) {
+      writeAttribute(writer, attribute)
+    }
+  }
+  writer.byte(GROUP_TAGS.end)
+
+  const header = writer.toBuffer()
+  return message.data ? Buffer.concat([header, message.data]) : header
+}
+
+/**
+ * Reads a binary buffer sequentially, failing clearly on truncated input.
+ */
+class ByteReader {
+  offset = 0
+  private readonly buffer: Buffer
+
+  constructor(buffer: Buffer) {
+    this.buffer = buffer
+  }
+
+  private need(length: number): void {
+    if (this.offset + length > this.buffer.length) {
+      throw new Error(`Malformed IPP message: unexpected end of data at byte ${this.offset}`)
+    }
+  }
+
+  byte(): number {
+    this.need(1)
+    return this.buffer.readUInt8(this.offset++)
+  }
+
+  peek(): number {
+    this.need(1)
+    return this.buffer.readUInt8(this.offset)
+  }
+
+  int16(): number {
+    this.need(2)
+    const value = this.buffer.readUInt16BE(this.offset)
+    this.offset += 2
+    return value
+  }
+
+  int32(): number {
+    this.need(4)
+    const value = this.buffer.readInt32BE(this.offset)
+    this.offset += 4
+    return value
+  }
+
+  /** Reads a 2-byte length followed by that many bytes. */
+  field(): Buffer {
+    const length = this.int16()
+    this.need(length)
+    const bytes = this.buffer.subarray(this.offset, this.offset + length)
+    this.offset += length
+    return bytes
+  }
+
+  rest(): Buffer {
+    return this.buffer.subarray(this.offset)
+  }
+}
+
+/**
+ * Decodes a dateTime value into a Date, honoring the UTC offset.
+ */
+function decodeDateTime(bytes: Buffer): Date {
+  const utc = Date.UTC(
+    bytes.readUInt16BE(0),
+    bytes.readUInt8(2) - 1,
+    bytes.readUInt8(3),
+    bytes.readUInt8(4),
+    bytes.readUInt8(5),
+    bytes.readUInt8(6),
+    bytes.readUInt8(7) * 100
+  )
+  const sign = String.fromCharCode(bytes.readUInt8(8)) === "-" ? -1 : 1
+  const offsetMinutes = bytes.readUInt8(9) * 60 + bytes.readUInt8(10)
+  return new Date(utc - sign * offsetMinutes * 60_000)
+}
+
+/**
+ * Decodes a single value according to its tag.
+ */
+function decodeValue(tag: number, bytes: Buffer): IppValue {
+  // Out-of-band values (unsupported, unknown, no-value, ...) carry no data
+  if (tag >= 0x10 && tag <= 0x1f) {
+    return null
+  }
+
+  switch (tag) {
+    case VALUE_TAGS.integer:
+    case VALUE_TAGS.enum:
+      return bytes.readInt32BE(0)
+    case VALUE_TAGS.boolean:
+      return bytes.readUInt8(0) !== 0
+    case VALUE_TAGS.dateTime:
+      return decodeDateTime(bytes)
+    case VALUE_TAGS.resolution:
+      return { x: bytes.readInt32BE(0), y: bytes.readInt32BE(4), units: bytes.readInt8(8) }
+    case VALUE_TAGS.rangeOfInteger:
+      return { lower: bytes.readInt32BE(0), upper: bytes.readInt32BE(4) }
+    case VALUE_TAGS.octetString:
+      return Buffer.from(bytes)
+    case VALUE_TAGS.textWithLanguage:
+    case VALUE_TAGS.nameWithLanguage: {
+      // natural-language length + value, then text length + value; the language is dropped
+      const languageLength = bytes.readUInt16BE(0)
+      const textLength = bytes.readUInt16BE(2 + languageLength)
+      const textStart = 2 + languageLength + 2
+      return bytes.subarray(textStart, textStart + textLength).toString("utf-8")
+    }
+    default:
+      return bytes.toString("utf-8")
+  }
+}
+
+/**
+ * Reads collection members up to the matching endCollection.
+ * The begCollection tag, name, and (empty) value have already been read.
+ */
+function readCollection(reader: ByteReader): IppCollection {
+  const members: IppAttribute[] = []
+
+  for (;;) {
+    const tag = reader.byte()
+    reader.field() // name is always empty inside collections
+    const value = reader.field()
+
+    if (tag === VALUE_TAGS.endCollection) {
+      return { members }
+    }
+
+    if (tag === VALUE_TAGS.memberAttrName) {
+      members.push({ name: value.toString("utf-8"), tag: 0, values: [] })
+      continue
+    }
+
+    const member = members[members.length - 1]
+    if (!member) {
+      throw new Error("Malformed IPP message: collection value without a member name")
+    }
+    member.tag = tag
+    member.values.push(
+      tag === VALUE_TAGS.begCollection ? readCollection(reader) : decodeValue(tag, value)
+    )
+  }
+}
+
+/**
+ * Decodes an IPP message.
+ *
+ * @param buffer - Raw message bytes (e.g., an HTTP response body)
+ * @returns Decoded message; any bytes after the end tag are returned as `data`
+ * @throws {Error} If the message is truncated or malformed
+ */
+export function decodeIppMessage(buffer: Buffer): IppMessage {
+  const reader = new ByteReader(buffer)
+  const version: [number, number] = [reader.byte(), reader.byte()]
+  const code = reader.int16()
+  const requestId = reader.int32()
+  const groups: IppAttributeGroup[] = []
+
+  let group: IppAttributeGroup | undefined
+  let attribute: IppAttribute | undefined
+
+  for (;;) {
+    const tag = reader.byte()
+
+    if (tag === GROUP_TAGS.end) {
+      break
+    }
+
+    // Delimiter tags (0x00-0x0f) start a new group
+    if (tag < 0x10) {
+      group = { tag, attributes: [] }
+      groups.push(group)
+      attribute = undefined
+      continue
+    }
+
+    if (!group) {
+      throw new Error("Malformed IPP message: attribute outside of a group")
+    }
+
+    const name = reader.field().toString("utf-8")
+    const valueBytes = reader.field()
+    const value =
+      tag === VALUE_TAGS.begCollection ? readCollection(reader) : decodeValue(tag, valueBytes)
+
+    if (name === "") {
+      // Additional value for the previous attribute (1setOf)
+      if (!attribute) {
+        throw new Error("Malformed IPP message: additional value without an attribute")
+      }
+      attribute.values.push(value)
+    } else {
+      attribute = { name, tag, values: [value] }
+      group.attributes.push(attribute)
+    }
+  }
+
+  const data = reader.rest()
+  return { version, code, requestId, groups, ...(data.length > 0 ? { data } : {}) }
+}
+
+/**
+ * Finds an attribute by name in the first group with the given tag.
+ *
+ * @param message - Decoded message
+ * @param groupTag - Group to search (e.g., GROUP_TAGS.printer)
+ * @param name - Attribute name
+ * @returns The attribute's values, or an empty array if absent
+ */
+export function getAttributeValues(
+  message: IppMessage,
+  groupTag: number,
+  name: string
+): IppValue[] {
+  const group = message.groups.find((g) => g.tag === groupTag)
+  return group?.attributes.find((a) => a.name === name)?.values ?? []
+}
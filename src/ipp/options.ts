@@ -0,0 +1,122 @@
+/**
+ * @fileoverview Translates CUPS-style job options into IPP job template attributes.
+ * Lets the same option strings (MCP_PRINTER_DEFAULT_OPTIONS, the `options` tool parameter,
+ * and typed print options) apply to jobs sent straight to an IPP printer.
+ */
+
+import { parsePageRanges } from "../print-options.js"
+import { VALUE_TAGS, type IppAttribute } from "./encoding.js"
+
+/**
+ * Common PWG self-describing media names and the CUPS media names they correspond to.
+ */
+export const PWG_MEDIA_NAMES: Record<string, string> = {
+  iso_a3_297x420mm: "A3",
+  iso_a4_210x297mm: "A4",
+  iso_a5_148x210mm: "A5",
+  iso_a6_105x148mm: "A6",
+  iso_b5_176x250mm: "ISOB5",
+  jis_b5_182x257mm: "B5",
+  "na_letter_8.5x11in": "Letter",
+  "na_legal_8.5x14in": "Legal",
+  "na_executive_7.25x10.5in": "Executive",
+  na_ledger_11x17in: "Tabloid",
+  "na_number-10_4.125x9.5in": "Env10",
+  iso_dl_110x220mm: "EnvDL",
+  iso_c5_162x229mm: "EnvC5",
+  "na_index-4x6_4x6in": "4x6",
+}
+
+/** Maps CUPS media names (lowercase) to PWG media names, for the media option. */
+const MEDIA_KEYWORDS: Record<string, string> = Object.fromEntries(
+  Object.entries(PWG_MEDIA_NAMES).map(([keyword, name]) => [name.toLowerCase(), keyword])
+)
+
+/** orientation-requested enum values (RFC 8011). */
+const ORIENTATION = {
+  portrait: 3,
+  landscape: 4,
+} as const
+
+/**
+ * Converts a single CUPS option to an IPP attribute.
+ * Bare flags become `name=true`, as CUPS does, except for the orientation shortcuts.
+ */
+function optionToAttribute(option: string): IppAttribute {
+  const [name, value] = option.includes("=")
+    ? [option.slice(0, option.indexOf("=")), option.slice(option.indexOf("=") + 1)]
+    : [option, undefined]
+
+  if (value === undefined) {
+    if (name === "landscape" || name === "portrait") {
+      return {
+        name: "orientation-requested",
+        tag: VALUE_TAGS.enum,
+        values: [ORIENTATION[name]],
+      }
+    }
+    if (name === "fit-to-page") {
+      return { name: "print-scaling", tag: VALUE_TAGS.keyword, values: ["fit"] }
+    }
+    return { name, tag: VALUE_TAGS.boolean, values: [true] }
+  }
+
+  switch (name) {
+    case "media":
+      return {
+        name,
+        tag: VALUE_TAGS.keyword,
+        values: [MEDIA_KEYWORDS[value.toLowerCase()] ?? value],
+      }
+    case "page-ranges":
+      return {
+        name,
+        tag: VALUE_TAGS.rangeOfInteger,
+        values: parsePageRanges(value).map(([lower, upper]) => ({ lower, upper })),
+      }
+    case "orientation-requested":
+    case "print-quality":
+      return { name, tag: VALUE_TAGS.enum, values: [parseInt(value, 10)] }
+    case "job-hold-until":
+      // A time of day ("22:30:00") is a name, as CUPS sends it; anything else is a keyword
+      return {
+        name,
+        tag: /^\d{2}:\d{2}(:\d{2})?$/.test(value)
+          ? VALUE_TAGS.nameWithoutLanguage
+          : VALUE_TAGS.keyword,
+        values: [value],
+      }
+  }
+
+  if (/^-?\d+$/.test(value)) {
+    return { name, tag: VALUE_TAGS.integer, values: [parseInt(value, 10)] }
+  }
+  if (value === "true" || value === "false") {
+    return { name, tag: VALUE_TAGS.boolean, values: [value === "true"] }
+  }
+  return { name, tag: VALUE_TAGS.keyword, values: [value] }
+}
+
+/**
+ * Builds IPP job template attributes from CUPS options and a copy count.
+ * Later options override earlier ones with the same attribute name, matching lp.
+ *
+ * @param options - CUPS option strings (e.g., ["sides=two-sided-long-edge", "landscape"])
+ * @param copies - Number of copies (omitted from the job when 1 or less)
+ * @returns Attributes for the job attributes group
+ * @throws {Error} If a page-ranges option is malformed
+ */
+export function cupsOptionsToIppAttributes(options: string[], copies?: number): IppAttribute[] {
+  const attributes = new Map<string, IppAttribute>()
+
+  for (const option of options) {
+    const attribute = optionToAttribute(option)
+    attributes.set(attribute.name, attribute)
+  }
+
+  if (copies !== undefined && copies > 1) {
+    attributes.set("copies", { name: "copies", tag: VALUE_TAGS.integer, values: [copies] })
+  }
+
+  return [...attributes.values()]
+}
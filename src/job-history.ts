@@ -0,0 +1,244 @@
+/**
+ * @fileoverview Job history ledger.
+ * Records every job the print tools submit in a small JSON file (MCP_PRINTER_HISTORY_FILE),
+ * so the assistant can answer questions like "what did I print today?". Job states are
+ * refreshed lazily from CUPS or the IPP printer when the history is read. The print quotas
+ * (see quota.ts) are counted from it, so they survive restarts. Jobs queued over HTTP record
+ * the session and client that queued them (see sessions.ts); session IDs are kept in the
+ * ledger, for listing a session's own jobs and counting its quotas, but never listed.
+ */
+
+import { mkdir, readFile, rename, writeFile } from "fs/promises"
+import { dirname } from "path"
+import { config } from "./config.js"
+import { getBackend } from "./backend.js"
+import type { JobState } from "./cups.js"
+import { getIppJobStatus, parseIppJobId } from "./ipp/client.js"
+import { getPdfPageCount } from "./utils.js"
+import { logger } from "./logger.js"
+
+/** Maximum number of jobs kept in the ledger; older entries are dropped. */
+export const MAX_HISTORY_ENTRIES = 500
+
+/** Job states that will not change, so they are never polled again. */
+const FINAL_STATES: JobState[] = ["completed", "canceled", "aborted", "not-found"]
+
+/**
+ * A job recorded in the ledger.
+ */
+export interface JobRecord {
+  /** Job ID returned by the print tool */
+  job_id: string
+  /** Tool that submitted the job (e.g., "print_file") */
+  tool: string
+  /** Printer name or IPP URI the job was sent to */
+  printer: string
+  /** Job title (file name, text title, or URL) */
+  title: string
+  /** Page count of the document, when it was a PDF */
+  pages?: number
+  /** Pages the job printed (the pages page_ranges selects, times copies), when counted */
+  printed_pages?: number
+  /** Submission attempts, when transient failures made it take more than one */
+  attempts?: number
+  /** When the job was submitted (ISO 8601) */
+  submitted_at: string
+  /** Last known job state */
+  status: JobState
+  /** When the state was last checked (ISO 8601) */
+  status_checked_at?: string
+  /** Why the job was canceled before it was submitted (e.g., "shutdown"); it never printed */
+  canceled_reason?: string
+  /** MCP session that queued the job (HTTP only; not listed) */
+  session?: string
+  /** Name and version of the client that queued it (HTTP only) */
+  client?: string
+}
+
+/**
+ * Details of a submitted job to record.
+ */
+export interface JobSubmission {
+  jobId: string
+  tool: string
+  printer: string
+  title: string
+  /** File that was printed; its pages are counted if it's a PDF */
+  filePath?: string
+  /** Submission attempts it took (default: 1) */
+  attempts?: number
+  /** Pages the job prints, when they could be counted */
+  printedPages?: number
+  /** Why the job was canceled before it was submitted, for jobs that never were */
+  canceledReason?: string
+  /** MCP session that queued the job (undefined for stdio) */
+  session?: string
+  /** Name and version of the session's client */
+  client?: string
+}
+
+// Ledger reads and writes are chained so concurrent tool calls never interleave
+let ledgerQueue: Promise<unknown> = Promise.resolve()
+
+/**
+ * Runs a ledger operation after every operation queued before it.
+ */
+function serialize<T>(task: () => Promise<T>): Promise<T> {
+  const run = ledgerQueue.then(task, task)
+  ledgerQueue = run.catch(() => undefined)
+  return run
+}
+
+/**
+ * Reads the ledger file. A missing file is an empty history.
+ */
+async function readLedger(): Promise<JobRecord[]> {
+  let raw: string
+  try {
+    raw = await readFile(config.historyFile, "utf-8")
+  } catch (error) {
+    if ((error as NodeJS.ErrnoException).code === "ENOENT") {
+      return []
+    }
+    throw error
+  }
+
+  try {
+    const parsed = JSON.parse(raw) as { jobs?: unknown }
+    return Array.isArray(parsed.jobs) ? (parsed.jobs as JobRecord[]) : []
+  } catch {
+    logger.warn("ignoring unreadable job history file", { file: config.historyFile })
+    return []
+  }
+}
+
+/**
+ * Writes the ledger atomically (temp file and rename), keeping the most recent entries.
+ */
+async function writeLedger(jobs: JobRecord[]): Promise<void> {
+  await mkdir(dirname(config.historyFile), { recursive: true })
+  const tempFile = `${config.historyFile}.${process.pid}.tmp`
+  const kept = jobs.slice(-MAX_HISTORY_ENTRIES)
+  await writeFile(tempFile, JSON.stringify({ jobs: kept }, null, 2) + "\n")
+  await rename(tempFile, config.historyFile)
+}
+
+/**
+ * Records a submitted job in the ledger, or one canceled before it could be submitted (with its
+ * queued job ID and canceledReason, in the "canceled" state).
+ * Failures are logged rather than thrown, so a broken ledger never fails a print.
+ *
+ * @param job - The submitted job
+ */
+export async function recordJob(job: JobSubmission): Promise<void> {
+  let pages: number | undefined
+  if (job.filePath) {
+    pages = await getPdfPageCount(job.filePath).catch(() => undefined)
+  }
+
+  const record: JobRecord = {
+    job_id: job.jobId,
+    tool: job.tool,
+    printer: job.printer,
+    title: job.title,
+    ...(pages !== undefined ? { pages } : {}),
+    ...(job.printedPages !== undefined ? { printed_pages: job.printedPages } : {}),
+    ...(job.attempts && job.attempts > 1 ? { attempts: job.attempts } : {}),
+    submitted_at: new Date().toISOString(),
+    status: job.canceledReason ? "canceled" : "pending",
+    ...(job.canceledReason ? { canceled_reason: job.canceledReason } : {}),
+    ...(job.session ? { session: job.session } : {}),
+    ...(job.client ? { client: job.client } : {}),
+  }
+
+  try {
+    await serialize(async () => writeLedger([...(await readLedger()), record]))
+  } catch (error) {
+    logger.error("failed to record job in history", { job_id: job.jobId, error })
+  }
+}
+
+/**
+ * Reads every job in the ledger, oldest first, without refreshing their states.
+ *
+ * @returns The recorded jobs
+ * @throws {Error} If the ledger file can't be read
+ */
+export async function readJobHistory(): Promise<JobRecord[]> {
+  return serialize(readLedger)
+}
+
+/**
+ * Looks up a job's current state, or undefined if it can't be checked right now.
+ */
+async function pollJobState(jobId: string, signal?: AbortSignal): Promise<JobState | undefined> {
+  try {
+    const status = parseIppJobId(jobId)
+      ? await getIppJobStatus(jobId, signal)
+      : await getBackend().getJobStatus(jobId, signal)
+    return status.state
+  } catch {
+    return undefined
+  }
+}
+
+/**
+ * Leaves a job's session ID out of a listing, so one client can't learn another's.
+ */
+function withoutSession(job: JobRecord): JobRecord {
+  const listed = { ...job }
+  delete listed.session
+  return listed
+}
+
+/**
+ * Lists the most recent jobs, newest first, refreshing the state of unfinished jobs.
+ *
+ * @param limit - Maximum number of jobs to return
+ * @param signal - The MCP request's signal (jobs that can't be checked keep their last state)
+ * @param mine - Only list the jobs this session queued (for the stdio transport, whose
+ *   session is undefined, the jobs no HTTP session queued)
+ * @returns Recent jobs with their latest known state, without their session IDs
+ */
+export async function listRecentJobs(
+  limit: number,
+  signal?: AbortSignal,
+  mine?: { session: string | undefined }
+): Promise<JobRecord[]> {
+  const recent = (await serialize(readLedger))
+    .filter((job) => !mine || job.session === mine.session)
+    .slice(-limit)
+    .reverse()
+    .map(withoutSession)
+
+  // Poll outside the ledger lock so slow printers don't hold up other tool calls
+  const checkedAt = new Date().toISOString()
+  const updates = new Map<string, JobState>()
+  await Promise.all(
+    recent
+      .filter((job) => !FINAL_STATES.includes(job.status))
+      .map(async (job) => {
+        const state = await pollJobState(job.job_id, signal)
+        if (state) {
+          updates.set(job.job_id, state)
+        }
+      })
+  )
+
+  if (updates.size === 0) {
+    return recent
+  }
+
+  const apply = (job: JobRecord): JobRecord => {
+    const status = updates.get(job.job_id)
+    return status ? { ...job, status, status_checked_at: checkedAt } : job
+  }
+
+  try {
+    await serialize(async () => writeLedger((await readLedger()).map(apply)))
+  } catch (error) {
+    logger.error("failed to update job history", { error })
+  }
+
+  return recent.map(apply)
+}
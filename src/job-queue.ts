@@ -0,0 +1,881 @@
+/**
+ * @fileoverview Print job queue.
+ * Jobs are submitted one at a time per printer, so jobs sent in quick succession (e.g., several
+ * print_file calls in one turn) can't interleave on the printer, while different printers work
+ * in parallel. The print tools return the queued job's ID ("queue#<n>") right away;
+ * get_job_status reports the job as "queued" until it is submitted, and as the printing
+ * system's job after that. A submission that fails for a reason that may go away (the printer
+ * dropped off the network, its queue is paused, or it didn't answer in time) is tried again up
+ * to MCP_PRINTER_MAX_RETRIES times, with exponential backoff and jitter; the printer's later
+ * jobs wait behind it, so they still go out in order. Jobs over the print quotas (see quota.ts)
+ * or the session's rate limit (see rate-limit.ts) are refused before they are queued, and a job
+ * identical to one just queued returns that job instead (see dedupe.ts). Each job remembers the
+ * MCP session that queued it, which the job history records, and an HTTP session closed for
+ * being idle has its waiting jobs canceled.
+ */
+
+import { buildPrintJob, cleanupRenderedPdf, getPdfPageCount, submitPrintJob } from "./utils.js"
+import { config } from "./config.js"
+import { getBackend } from "./backend.js"
+import { printerFromJobId, type JobStatus, type LpJobOptions } from "./cups.js"
+import { getIppJobStatus, parseIppJobId } from "./ipp/client.js"
+import { recordJob } from "./job-history.js"
+import {
+  PrinterError,
+  describeError,
+  isTransientError,
+  type PrinterErrorCode,
+} from "./errors.js"
+import { throwIfAborted } from "./timeouts.js"
+import { logger, type LogAttributes } from "./logger.js"
+import { imposeIppJob } from "./renderers/n-up.js"
+import {
+  JOB_SHEETS_OPTION,
+  addCoverPage,
+  coverPageMode,
+  coverPageOwner,
+} from "./renderers/cover-page.js"
+import { sniffFile } from "./renderers/file-type.js"
+import { getPrinterInfo, printOptionWarnings } from "./printer-info.js"
+import { countSelectedPages, type PrintJobOptions } from "./print-options.js"
+import { checkQuota, withQuotaLock, type QuotaJob } from "./quota.js"
+import { findDuplicate, jobFingerprint, rememberJob, type JobIdentity } from "./dedupe.js"
+import { takeJobToken } from "./rate-limit.js"
+import { clientLabel } from "./sessions.js"
+import { RAW_OPTION, validateRawOptions } from "./raw.js"
+import { resolveRawPrinter } from "./printer-access.js"
+
+/**
+ * Prefix of queued job IDs. "#" can't appear in CUPS printer names, so queued job IDs never
+ * collide with CUPS job IDs ("<printer>-<number>").
+ */
+export const QUEUE_JOB_ID_PREFIX = "queue#"
+
+/**
+ * Finished jobs remembered for get_job_status (older ones are forgotten first).
+ */
+const MAX_TRACKED_JOBS = 500
+
+/**
+ * Longest wait between two submission attempts, however many have failed.
+ */
+const MAX_RETRY_DELAY_MS = 60_000
+
+/**
+ * Where a queued job is: waiting, being submitted, waiting to try again after a transient
+ * failure, handed to the printing system, failed to submit, or canceled before it was submitted.
+ */
+export type QueuedJobState =
+  | "queued"
+  | "submitting"
+  | "retrying"
+  | "submitted"
+  | "failed"
+  | "canceled"
+
+/**
+ * A job in the queue.
+ */
+export interface QueuedJob {
+  /** Queued job ID ("queue#<n>") */
+  id: string
+  /** Printer the job was sent to ("" for the default printer) */
+  printer: string
+  title?: string
+  state: QueuedJobState
+  /** When the job was queued (ISO 8601) */
+  queued_at: string
+  /** Job ID reported by the printing system once the job is submitted */
+  job_id?: string
+  /** Submission attempts so far */
+  attempts: number
+  /** When the next attempt starts (ISO 8601), while the job is retrying */
+  next_retry_at?: string
+  /** Why the submission failed (the last attempt's error while retrying) */
+  error?: string
+  /** Error code of the failed submission */
+  code?: PrinterErrorCode
+  /** Options the printer rejected, which the job was submitted without */
+  warnings?: string[]
+}
+
+/**
+ * Work for the queue.
+ */
+export interface QueueTask {
+  /** Printer to serialize on (undefined for the default printer) */
+  printer?: string
+  title?: string
+  /**
+   * Submits the job, returning the printing system's job ID; `warn` records a warning, and
+   * `attempt` counts from 1 (it's higher when earlier attempts failed)
+   */
+  submit(warn: (warning: string) => void, attempt: number): Promise<string>
+  /** Called once the job has been submitted, has failed, or was canceled */
+  cleanup?(): void
+  /** Pages the job prints, counted against MCP_PRINTER_MAX_PAGES_PER_DAY until it's recorded */
+  pages?: number
+  /** Tool that queued the job, recorded in the job history if it is canceled at shutdown */
+  tool?: string
+  /** MCP session that queued the job (undefined for stdio) */
+  session?: string
+  /** Name and version of the session's client, recorded in the job history if it is canceled */
+  client?: string
+}
+
+interface QueueEntry {
+  job: QueuedJob
+  task: QueueTask
+  /** Aborted when the job is canceled while it waits to retry */
+  retry: AbortController
+}
+
+let nextQueueId = 1
+const queuedJobs = new Map<string, QueueEntry>()
+
+// Each printer's submissions are chained so a job starts only after the one before it settles
+const printerQueues = new Map<string, Promise<void>>()
+
+/**
+ * Queue key of a printer. CUPS printer names are case-insensitive.
+ */
+function queueKey(printer: string | undefined): string {
+  return (printer ?? "").toLowerCase()
+}
+
+/**
+ * Moves a job to a new state, logging the transition.
+ */
+function setJobState(job: QueuedJob, state: QueuedJobState, attrs: LogAttributes = {}): void {
+  logger.info("job state", {
+    job_id: job.id,
+    printer: job.printer,
+    from: job.state,
+    to: state,
+    ...attrs,
+  })
+  job.state = state
+}
+
+/**
+ * Checks whether a job ID is a queued job ID.
+ *
+ * @param jobId - Job ID from a tool call
+ * @returns True for "queue#<n>" IDs
+ */
+export function isQueueJobId(jobId: string): boolean {
+  return jobId.startsWith(QUEUE_JOB_ID_PREFIX)
+}
+
+/**
+ * Adds a job to its printer's queue. The job is submitted once every job queued before it
+ * on the same printer has been submitted (or has failed).
+ *
+ * @param task - The job's printer, title, and submit and cleanup steps
+ * @returns The queued job
+ */
+export function enqueueJob(task: QueueTask): QueuedJob {
+  const entry: QueueEntry = {
+    job: {
+      id: `${QUEUE_JOB_ID_PREFIX}${nextQueueId++}`,
+      printer: task.printer ?? "",
+      ...(task.title ? { title: task.title } : {}),
+      state: "queued",
+      queued_at: new Date().toISOString(),
+      attempts: 0,
+    },
+    task,
+    retry: new AbortController(),
+  }
+  queuedJobs.set(entry.job.id, entry)
+  forgetOldJobs()
+  logger.info("job queued", { job_id: entry.job.id, printer: entry.job.printer })
+
+  const key = queueKey(task.printer)
+  const run = (printerQueues.get(key) ?? Promise.resolve()).then(() => submitEntry(entry))
+  printerQueues.set(key, run)
+  void run.then(() => {
+    if (printerQueues.get(key) === run) {
+      printerQueues.delete(key)
+    }
+  })
+
+  return { ...entry.job }
+}
+
+/**
+ * Submits a queued job, unless it was canceled while it waited, retrying transient failures.
+ * Never rejects.
+ */
+async function submitEntry({ job, task, retry }: QueueEntry): Promise<void> {
+  if (job.state === "canceled") {
+    return
+  }
+
+  try {
+    for (;;) {
+      job.attempts++
+      setJobState(job, "submitting", { attempt: job.attempts })
+      try {
+        job.job_id = await task.submit((warning) => {
+          job.warnings = [...(job.warnings ?? []), warning]
+        }, job.attempts)
+        setJobState(job, "submitted", { cups_job_id: job.job_id })
+        delete job.error
+        delete job.code
+        return
+      } catch (error) {
+        const { message, code } = describeError(error)
+        job.error = message
+        if (code) {
+          job.code = code
+        } else {
+          delete job.code
+        }
+        if (!isTransientError(error) || job.attempts > config.maxRetries) {
+          setJobState(job, "failed", { attempts: job.attempts, code, error: message })
+          return
+        }
+
+        const delay = retryDelayMs(job.attempts)
+        job.next_retry_at = new Date(Date.now() + delay).toISOString()
+        setJobState(job, "retrying", {
+          attempt: job.attempts,
+          retry_in_ms: delay,
+          code,
+          error: message,
+        })
+        await waitForRetry(delay, retry.signal)
+        if (retry.signal.aborted) {
+          return
+        }
+        delete job.next_retry_at
+      }
+    }
+  } finally {
+    task.cleanup?.()
+  }
+}
+
+/**
+ * Delay before the next submission attempt: MCP_PRINTER_RETRY_DELAY_SECONDS, doubled for each
+ * failed attempt after the first and capped at a minute. Up to half of it is taken off at random,
+ * so jobs that failed together don't all retry at the same moment.
+ *
+ * @param attempt - Attempts that have failed so far (1 after the first failure)
+ * @param random - Source of jitter in [0, 1)
+ * @returns Delay in milliseconds
+ * @internal Exported for testing purposes
+ */
+export function retryDelayMs(attempt: number, random: () => number = Math.random): number {
+  const backoff = Math.min(MAX_RETRY_DELAY_MS, config.retryDelaySeconds * 1000 * 2 ** (attempt - 1))
+  return Math.round(backoff / 2 + (random() * backoff) / 2)
+}
+
+/**
+ * Waits before a retry, returning early when the job is canceled.
+ */
+function waitForRetry(ms: number, signal: AbortSignal): Promise<void> {
+  return new Promise((resolve) => {
+    const timer = setTimeout(done, ms)
+    function done() {
+      clearTimeout(timer)
+      signal.removeEventListener("abort", done)
+      resolve()
+    }
+    signal.addEventListener("abort", done)
+  })
+}
+
+/**
+ * Forgets the oldest finished jobs once more than MAX_TRACKED_JOBS are remembered.
+ */
+function forgetOldJobs(): void {
+  for (const [id, { job }] of queuedJobs) {
+    if (queuedJobs.size <= MAX_TRACKED_JOBS) {
+      break
+    }
+    if (job.state !== "queued" && job.state !== "submitting" && job.state !== "retrying") {
+      queuedJobs.delete(id)
+    }
+  }
+}
+
+/**
+ * Looks up a queued job.
+ *
+ * @param id - Queued job ID
+ * @returns A snapshot of the job, or undefined if it is unknown (or long finished)
+ */
+export function getQueuedJob(id: string): QueuedJob | undefined {
+  const entry = queuedJobs.get(id)
+  return entry ? { ...entry.job } : undefined
+}
+
+/**
+ * Jobs the queue hasn't handed to the printing system yet, for server_status.
+ */
+export interface QueueCounts {
+  /** Waiting for the printer's earlier jobs */
+  queued: number
+  /** Being submitted */
+  submitting: number
+  /** Waiting to try again after a transient failure */
+  retrying: number
+}
+
+/**
+ * Counts the jobs the queue is still working on.
+ *
+ * @returns Jobs queued, being submitted, and waiting to retry, over every printer
+ */
+export function countQueuedJobs(): QueueCounts {
+  const counts: QueueCounts = { queued: 0, submitting: 0, retrying: 0 }
+  for (const { job } of queuedJobs.values()) {
+    if (job.state === "queued" || job.state === "submitting" || job.state === "retrying") {
+      counts[job.state]++
+    }
+  }
+  return counts
+}
+
+/**
+ * Position of a waiting job in its printer's queue.
+ *
+ * @returns 1 for the next job to be submitted, 2 for the one after it, and so on
+ */
+function queuePosition(job: QueuedJob): number {
+  const key = queueKey(job.printer)
+  let position = 1
+  for (const { job: other } of queuedJobs.values()) {
+    if (other === job) {
+      break
+    }
+    if (other.state === "queued" && queueKey(other.printer) === key) {
+      position++
+    }
+  }
+  return position
+}
+
+/**
+ * Cancels a job that hasn't been submitted yet: one waiting for its turn, or waiting to retry.
+ *
+ * @param id - Queued job ID
+ * @returns True if the job was waiting and is now canceled
+ */
+export function cancelQueuedJob(id: string): boolean {
+  const entry = queuedJobs.get(id)
+  if (entry?.job.state === "retrying") {
+    // The submission loop stops waiting, sees the cancellation, and cleans up
+    setJobState(entry.job, "canceled")
+    delete entry.job.next_retry_at
+    entry.retry.abort()
+    return true
+  }
+  if (!entry || entry.job.state !== "queued") {
+    return false
+  }
+  setJobState(entry.job, "canceled")
+  entry.task.cleanup?.()
+  return true
+}
+
+/**
+ * Lists the jobs that count against the print quotas: every job that hasn't failed or been
+ * canceled, including submitted ones the job history may not have recorded yet.
+ */
+function quotaJobs(): QuotaJob[] {
+  const jobs: QuotaJob[] = []
+  for (const { job, task } of queuedJobs.values()) {
+    if (job.state !== "failed" && job.state !== "canceled") {
+      jobs.push({
+        job_id: job.job_id,
+        at: job.queued_at,
+        pages: task.pages ?? 0,
+        session: task.session,
+      })
+    }
+  }
+  return jobs
+}
+
+/**
+ * Cancels every job waiting in a printer's queue.
+ *
+ * @param printer - Printer name
+ * @returns Number of jobs canceled
+ */
+export function cancelQueuedJobs(printer: string): number {
+  const key = queueKey(printer)
+  let canceled = 0
+  for (const { job } of queuedJobs.values()) {
+    const waiting = job.state === "queued" || job.state === "retrying"
+    if (waiting && queueKey(job.printer) === key && cancelQueuedJob(job.id)) {
+      canceled++
+    }
+  }
+  return canceled
+}
+
+/**
+ * Cancels every job that hasn't been submitted yet, on every printer, because the server is
+ * shutting down, or every one a session queued, because the session expired. The jobs are
+ * recorded in the job history as canceled, with the reason.
+ *
+ * @param reason - Why the jobs were canceled (e.g., "shutdown")
+ * @param session - Only cancel the jobs this MCP session queued (default: every job)
+ * @returns Number of jobs canceled
+ */
+export async function cancelWaitingJobs(reason: string, session?: string): Promise<number> {
+  const canceled: QueueEntry[] = []
+  for (const entry of queuedJobs.values()) {
+    const waiting = entry.job.state === "queued" || entry.job.state === "retrying"
+    const ours = session === undefined || entry.task.session === session
+    if (waiting && ours && cancelQueuedJob(entry.job.id)) {
+      canceled.push(entry)
+    }
+  }
+  for (const { job, task } of canceled) {
+    await recordJob({
+      jobId: job.id,
+      tool: task.tool ?? "",
+      printer: job.printer,
+      title: job.title ?? "",
+      canceledReason: reason,
+      session: task.session,
+      client: task.client,
+    })
+  }
+  return canceled.length
+}
+
+/**
+ * Waits until every queued job has been submitted, has failed (after any retries), or was
+ * canceled.
+ */
+export async function drainQueue(): Promise<void> {
+  while (printerQueues.size > 0) {
+    await Promise.all(printerQueues.values())
+  }
+}
+
+/**
+ * A print job for the queue.
+ */
+export interface PrintJobRequest {
+  /** File to print */
+  filePath?: string
+  /** Content to print instead of a file (text, or a raw job's bytes) */
+  content?: string | Buffer
+  /**
+   * Pages the content prints, as the tool estimated them (e.g., plain text), counted for the page
+   * limits and the daily page quota in place of a file's
+   */
+  pages?: number
+  /**
+   * Send the document untouched (`-o raw`), to a printer in MCP_PRINTER_RAW_ALLOWED_PRINTERS
+   * only
+   */
+  raw?: boolean
+  /** Printer name or IPP printer URI (default: the configured or system default printer) */
+  printer?: string
+  jobOptions?: PrintJobOptions
+  /** CUPS options string */
+  options?: string
+  title?: string
+  /** File or URL the job came from, shown on its cover page */
+  source?: string
+  /** Tool recorded in the job history */
+  tool: string
+  /** Print more pages than MCP_PRINTER_MAX_PAGES_PER_JOB (up to MCP_PRINTER_ABSOLUTE_MAX_PAGES) */
+  confirmLargeJob?: boolean
+  /** Called once the job has been submitted, has failed, or was canceled */
+  cleanup?: () => void
+  /**
+   * The document and settings as the tool was given them, which a repeated request is
+   * recognized by (default: the file or content printed)
+   */
+  identity?: JobIdentity
+  /** Queue the job even if an identical one was queued in MCP_PRINTER_DEDUPE_WINDOW_SECONDS */
+  force?: boolean
+  /**
+   * MCP session the request came from, for the rate limit, the quotas of
+   * MCP_PRINTER_QUOTA_SCOPE=session, and the job history (undefined for stdio)
+   */
+  session?: string
+  /** The MCP request's signal, which cancels validation (the submission only has a timeout) */
+  signal?: AbortSignal
+}
+
+/**
+ * Validates a print job and adds it to its printer's queue. Options, copies, the printer, and
+ * the page limits of PDF jobs are checked now, so a bad request fails right away; the job is
+ * submitted and recorded in the job history when its turn comes. N-up PDF jobs for IPP printers
+ * are imposed before they are queued. A color mode or quality the printer doesn't list is
+ * reported as a warning, and a job over the print quotas is refused. PDF jobs get their cover
+ * page (cover_page or MCP_PRINTER_COVER_PAGE) here, and it counts toward the page limits and
+ * quotas as one page per copy. Raw jobs only go to printers allowed raw jobs, and never get a
+ * cover page, which would be printed on the labels or receipts. A job identical to one queued
+ * in MCP_PRINTER_DEDUPE_WINDOW_SECONDS that is still waiting or was submitted isn't queued again
+ * (unless force is set): that job is returned, flagged as a duplicate, and cleanup is called.
+ * The submission runs after the tool call has returned, so it isn't canceled with the request;
+ * each attempt is stopped after MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS, and transient failures are
+ * retried (see retryDelayMs) until cancel_print_job drops the job.
+ *
+ * @param request - What to print, where, and how
+ * @returns The printer name ("default printer" when none is set), options, queued job (the
+ *   earlier one for a duplicate), whether the request was a duplicate, and warnings about
+ *   options the printer may ignore
+ * @throws {PrinterError} PAGE_LIMIT_EXCEEDED if the job prints more pages than the limits allow
+ * @throws {PrinterError} QUOTA_EXCEEDED if printing it would go over a print quota
+ * @throws {PrinterError} RATE_LIMITED if the session queued too many jobs in the last minute
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if a cover page can't be added to the PDF
+ * @throws {PrinterError} PERMISSION_DENIED if a raw job's printer isn't allowed raw jobs
+ * @throws {Error} If the options or printer are not allowed, or imposition fails (cleanup is
+ *   then not called)
+ */
+export async function queuePrintJob(request: PrintJobRequest): Promise<{
+  printerName: string
+  allOptions: string[]
+  job: QueuedJob
+  duplicate: boolean
+  warnings: string[]
+}> {
+  const job = await buildPrintJob(
+    request.printer,
+    request.jobOptions,
+    request.options,
+    request.title,
+    request.signal
+  )
+  if (request.raw) {
+    validateRawOptions(request.jobOptions ?? {})
+    job.printer = await resolveRawPrinter(job.printer, request.signal)
+    job.options = [...(job.options ?? []), RAW_OPTION]
+  }
+
+  // A request repeated within the window (e.g., after a timeout) gets the job it repeats
+  const fingerprint =
+    config.dedupeWindowSeconds > 0
+      ? await jobFingerprint(
+          request.identity ?? {
+            files: request.filePath ? [request.filePath] : [],
+            content: request.content,
+          },
+          { job, jobOptions: request.jobOptions ?? {}, raw: request.raw ?? false }
+        )
+      : undefined
+  const original = fingerprint && !request.force ? findDuplicate(fingerprint) : undefined
+  const repeated = original ? getQueuedJob(original.jobId) : undefined
+  if (repeated && repeated.state !== "failed" && repeated.state !== "canceled") {
+    logger.info("duplicate job", { job_id: repeated.id, printer: repeated.printer })
+    request.cleanup?.()
+    return {
+      printerName: job.printer || "default printer",
+      allOptions: job.options ?? [],
+      job: repeated,
+      duplicate: true,
+      warnings: [],
+    }
+  }
+
+  const coverMode = coverPageMode(job.printer, request.jobOptions?.cover_page)
+  const cover = request.raw ? undefined : coverMode
+  // Pages are only counted for the page limits, the daily page quota, and the cover page
+  const countsPages = pagesAreLimited() || cover === "generate"
+  const document =
+    request.filePath && countsPages
+      ? await countJobPages(request.filePath, request.jobOptions)
+      : request.pages !== undefined
+        ? selectJobPages(request.pages, request.jobOptions)
+        : undefined
+  const counted = document && cover ? withCoverPage(document) : document
+  if (counted) {
+    checkPageLimit(counted, request.confirmLargeJob)
+  }
+  // A request canceled while it was being validated or rendered must not print anything
+  throwIfAborted("Print request", request.signal)
+  const warnings = await optionWarnings(job.printer, request.jobOptions, request.signal)
+  if (request.raw && coverMode) {
+    warnings.push("No cover page was added: raw jobs are sent to the printer untouched.")
+  }
+
+  let submission: LpJobOptions = request.filePath
+    ? { ...job, filePath: request.filePath }
+    : { ...job, content: request.content }
+  let coverPdf: string | null = null
+  if (cover === "job-sheets") {
+    submission.options = [...(submission.options ?? []), JOB_SHEETS_OPTION]
+  } else if (cover === "generate" && document && request.filePath) {
+    const covered = await addCoverPage(
+      { ...job, filePath: request.filePath },
+      {
+        owner: coverPageOwner(),
+        title: job.title ?? "",
+        queuedAt: new Date(),
+        source: request.source,
+        pages: document.selected,
+        copies: document.copies,
+      },
+      request.signal
+    )
+    submission = covered.job
+    coverPdf = covered.coverPdf
+  } else if (cover === "generate") {
+    warnings.push(
+      "No cover page was added: only PDF jobs (including rendered documents) can have one."
+    )
+  }
+
+  // Named now, since the session may have closed by the time the job is submitted
+  const client = clientLabel(request.session)
+  let imposedPdf: string | null = null
+  let queued: QueuedJob
+  try {
+    const imposed = await imposeIppJob(submission, request.signal)
+    submission = imposed.job
+    imposedPdf = imposed.imposedPdf
+    // Checked and queued one request at a time, so concurrent requests can't both squeeze under
+    // the limits
+    queued = await withQuotaLock(request.session, async () => {
+      await checkQuota(counted?.pages ?? 0, quotaJobs, request.session)
+      takeJobToken(request.session)
+      return enqueueJob({
+        printer: job.printer,
+        title: job.title,
+        pages: counted?.pages,
+        tool: request.tool,
+        session: request.session,
+        client,
+        submit: async (warn, attempt) => {
+          const jobId = await submitPrintJob(submission, undefined, warn)
+          await recordJob({
+            jobId,
+            tool: request.tool,
+            printer: job.printer || printerFromJobId(jobId),
+            title: job.title ?? "",
+            filePath: request.filePath,
+            attempts: attempt,
+            printedPages: counted?.pages,
+            session: request.session,
+            client,
+          })
+          return jobId
+        },
+        cleanup: () => {
+          cleanupRenderedPdf(imposedPdf)
+          cleanupRenderedPdf(coverPdf)
+          request.cleanup?.()
+        },
+      })
+    })
+  } catch (error) {
+    cleanupRenderedPdf(imposedPdf)
+    cleanupRenderedPdf(coverPdf)
+    throw error
+  }
+  if (fingerprint) {
+    rememberJob(fingerprint, queued.id)
+  }
+
+  return {
+    printerName: job.printer || "default printer",
+    allOptions: job.options ?? [],
+    job: queued,
+    duplicate: false,
+    warnings,
+  }
+}
+
+/**
+ * Pages a PDF job prints: the pages page_ranges selects, times copies.
+ */
+export interface JobPages {
+  /** Pages printed in all */
+  pages: number
+  /** Pages selected from the document, and the cover page if the job has one */
+  selected: number
+  copies: number
+  /** Whether a cover page is printed with each copy */
+  coverPage?: boolean
+}
+
+/**
+ * Adds a job's cover page to its pages: one more page with each copy.
+ */
+function withCoverPage(counted: JobPages): JobPages {
+  const selected = counted.selected + 1
+  return { pages: selected * counted.copies, selected, copies: counted.copies, coverPage: true }
+}
+
+/**
+ * Whether the pages of jobs are limited, by MCP_PRINTER_MAX_PAGES_PER_JOB,
+ * MCP_PRINTER_ABSOLUTE_MAX_PAGES, or MCP_PRINTER_MAX_PAGES_PER_DAY. While any of them is on,
+ * print_text estimates the pages of the plain text it streams to the printer.
+ *
+ * @returns True if a page limit or the daily page quota is set
+ */
+export function pagesAreLimited(): boolean {
+  return config.maxPagesPerJob > 0 || config.absoluteMaxPages > 0 || config.maxPagesPerDay > 0
+}
+
+/**
+ * Counts the pages a job prints. Files that aren't PDFs (like plain text sent as it is) can't
+ * be counted.
+ *
+ * @param filePath - The file that would be sent to the printer
+ * @param jobOptions - Typed print options (copies and page_ranges)
+ * @returns The pages, or undefined if the file isn't a PDF or can't be read
+ * @internal Exported for testing purposes
+ */
+export async function countJobPages(
+  filePath: string,
+  jobOptions: PrintJobOptions = {}
+): Promise<JobPages | undefined> {
+  let documentPages: number
+  try {
+    if ((await sniffFile(filePath)).type !== "pdf") {
+      return undefined
+    }
+    documentPages = await getPdfPageCount(filePath)
+  } catch {
+    // A PDF that can't be read is left to the printing system
+    return undefined
+  }
+  return selectJobPages(documentPages, jobOptions)
+}
+
+/**
+ * Counts the pages a job prints from its document's: those page_ranges selects, times copies.
+ */
+function selectJobPages(documentPages: number, jobOptions: PrintJobOptions = {}): JobPages {
+  const selected = jobOptions.page_ranges
+    ? countSelectedPages(jobOptions.page_ranges, documentPages)
+    : documentPages
+  const copies = jobOptions.copies ?? 1
+  return { pages: selected * copies, selected, copies }
+}
+
+/**
+ * Checks the pages a PDF job prints against MCP_PRINTER_MAX_PAGES_PER_JOB, which
+ * confirm_large_job lifts, and MCP_PRINTER_ABSOLUTE_MAX_PAGES, which nothing does. Jobs whose
+ * pages can't be counted aren't limited.
+ *
+ * @param counted - Pages the job prints, from countJobPages
+ * @param confirmLargeJob - Whether the user confirmed a job over MCP_PRINTER_MAX_PAGES_PER_JOB
+ * @throws {PrinterError} PAGE_LIMIT_EXCEEDED if the job prints more pages than allowed
+ * @internal Exported for testing purposes
+ */
+export function checkPageLimit(counted: JobPages, confirmLargeJob = false): void {
+  const { maxPagesPerJob, absoluteMaxPages } = config
+  const { pages, selected, copies, coverPage } = counted
+  const cover = coverPage ? ", including the cover page" : ""
+  const described =
+    copies > 1
+      ? `${pages} pages (${selected} pages${cover && `${cover},`} × ${copies} copies)`
+      : `${pages} pages${cover}`
+
+  if (absoluteMaxPages > 0 && pages > absoluteMaxPages) {
+    throw new PrinterError(
+      "PAGE_LIMIT_EXCEEDED",
+      `Job prints ${described}, over the absolute limit of ${absoluteMaxPages} pages per job (MCP_PRINTER_ABSOLUTE_MAX_PAGES), which confirm_large_job can't lift.`,
+      {
+        suggestion:
+          "Print fewer pages with page_ranges or fewer copies, or split the document into several jobs.",
+      }
+    )
+  }
+  if (maxPagesPerJob > 0 && pages > maxPagesPerJob && !confirmLargeJob) {
+    const ceiling = absoluteMaxPages > 0 ? ` (up to ${absoluteMaxPages} pages)` : ""
+    throw new PrinterError(
+      "PAGE_LIMIT_EXCEEDED",
+      `Job prints ${described}, over the limit of ${maxPagesPerJob} pages per job (MCP_PRINTER_MAX_PAGES_PER_JOB).`,
+      {
+        suggestion: `Ask the user before printing this much, then pass confirm_large_job: true to print it${ceiling}, or print fewer pages with page_ranges.`,
+      }
+    )
+  }
+}
+
+/**
+ * Checks a job's color mode and quality against the printer's capabilities.
+ * Printers that can't be looked up (including the system default printer) get no warnings:
+ * the job is still sent, and the printing system decides.
+ */
+async function optionWarnings(
+  printer: string | undefined,
+  jobOptions: PrintJobOptions = {},
+  signal?: AbortSignal
+): Promise<string[]> {
+  if (!printer || (!jobOptions.color_mode && !jobOptions.quality)) {
+    return []
+  }
+  try {
+    return printOptionWarnings(await getPrinterInfo(printer, signal), jobOptions)
+  } catch {
+    return []
+  }
+}
+
+/**
+ * Looks up the status of any job ID the print tools return: queued jobs, IPP jobs, and jobs
+ * of the printing backend.
+ *
+ * @param jobId - Job ID from a print tool
+ * @param signal - The MCP request's signal
+ * @returns The job's status. Queued jobs are "queued" until submitted (with the attempts so far
+ *   and the next retry time while retrying), then report the printing system's job (with the
+ *   queued ID in queue_id); failed submissions are "aborted".
+ * @throws {Error} If the printing system can't be queried or doesn't answer in time
+ */
+export async function getPrintJobStatus(jobId: string, signal?: AbortSignal): Promise<JobStatus> {
+  if (!isQueueJobId(jobId)) {
+    return parseIppJobId(jobId)
+      ? getIppJobStatus(jobId, signal)
+      : getBackend().getJobStatus(jobId, signal)
+  }
+
+  const entry = queuedJobs.get(jobId)
+  if (!entry) {
+    return { job_id: jobId, state: "not-found" }
+  }
+
+  const { job } = entry
+  const printer = job.printer ? { printer: job.printer } : {}
+  const attempts = job.attempts > 1 ? { attempts: job.attempts } : {}
+  switch (job.state) {
+    case "queued":
+      return {
+        job_id: jobId,
+        state: "queued",
+        ...printer,
+        submitted: job.queued_at,
+        position: queuePosition(job),
+      }
+    case "submitting":
+      return { job_id: jobId, state: "queued", ...printer, submitted: job.queued_at, position: 0 }
+    case "retrying":
+      return {
+        job_id: jobId,
+        state: "queued",
+        ...printer,
+        submitted: job.queued_at,
+        position: 0,
+        attempts: job.attempts,
+        next_retry_at: job.next_retry_at,
+        status_message: job.error,
+      }
+    case "failed":
+      return { job_id: jobId, state: "aborted", ...printer, ...attempts, status_message: job.error }
+    case "canceled":
+      return { job_id: jobId, state: "canceled", ...printer }
+    case "submitted":
+      return {
+        ...(await getPrintJobStatus(job.job_id ?? "", signal)),
+        queue_id: jobId,
+        ...attempts,
+        ...(job.warnings ? { warnings: job.warnings } : {}),
+      }
+  }
+}
@@ -0,0 +1,236 @@
+/**
+ * @fileoverview Structured logging.
+ * Log records are written as JSON lines to stderr, or appended to MCP_PRINTER_LOG_FILE, and
+ * never to stdout, which carries JSON-RPC on the stdio transport. Records below
+ * MCP_PRINTER_LOG_LEVEL are not written. Handlers added with addLogHandler (MCP sessions that
+ * set a level with logging/setLevel) see every record and filter it themselves.
+ *
+ * Tool arguments are logged with summarizeArguments, so document content never reaches the log.
+ */
+
+import { appendFileSync } from "fs"
+import { format } from "util"
+import type { LoggingLevel } from "@modelcontextprotocol/sdk/types.js"
+import { config, type LogLevel } from "./config.js"
+
+/** Rank of each log level, from most to least verbose. */
+const LOG_LEVEL_RANKS: Record<LogLevel, number> = { debug: 0, info: 1, warn: 2, error: 3 }
+
+/** MCP logging levels from least to most severe, as in the MCP specification. */
+const MCP_LOGGING_LEVELS: LoggingLevel[] = [
+  "debug",
+  "info",
+  "notice",
+  "warning",
+  "error",
+  "critical",
+  "alert",
+  "emergency",
+]
+
+/** MCP logging level of each log level. */
+export const MCP_LOG_LEVELS: Record<LogLevel, LoggingLevel> = {
+  debug: "debug",
+  info: "info",
+  warn: "warning",
+  error: "error",
+}
+
+/** Strings longer than this are logged as their length. */
+const MAX_LOGGED_STRING_LENGTH = 80
+
+/** Arguments that hold document content, always logged as their length. */
+const CONTENT_ARGUMENTS = new Set(["content", "data"])
+
+/** Array entries logged before the rest are counted. */
+const MAX_LOGGED_ARRAY_ENTRIES = 10
+
+/**
+ * Attributes of a log record (e.g., { tool: "print_file", duration_ms: 120 }).
+ */
+export type LogAttributes = Record<string, unknown>
+
+/**
+ * A log record.
+ */
+export interface LogRecord {
+  /** When the record was logged (ISO 8601) */
+  time: string
+  level: LogLevel
+  msg: string
+  attrs: LogAttributes
+}
+
+/**
+ * Receives every log record, whatever MCP_PRINTER_LOG_LEVEL is.
+ */
+export type LogHandler = (record: LogRecord) => void
+
+const handlers = new Set<LogHandler>()
+
+/**
+ * Checks whether an MCP logging level is at or above a minimum level.
+ *
+ * @param level - Level of the message
+ * @param minimum - Lowest level wanted (e.g., from logging/setLevel)
+ * @returns True if the message should be sent
+ */
+export function isLoggingLevelEnabled(level: LoggingLevel, minimum: LoggingLevel): boolean {
+  return MCP_LOGGING_LEVELS.indexOf(level) >= MCP_LOGGING_LEVELS.indexOf(minimum)
+}
+
+/**
+ * Summarizes tool arguments for logging: document content and long strings are replaced by
+ * their length, and long arrays are cut short.
+ *
+ * @param value - Tool arguments
+ * @param key - Name of the argument holding the value, if any
+ * @returns A copy that is safe and short enough to log
+ */
+export function summarizeArguments(value: unknown, key?: string): unknown {
+  if (typeof value === "string") {
+    const isContent = key !== undefined && CONTENT_ARGUMENTS.has(key)
+    if (isContent || value.length > MAX_LOGGED_STRING_LENGTH) {
+      return `<${value.length} chars>`
+    }
+    return value
+  }
+  if (Array.isArray(value)) {
+    const entries = value
+      .slice(0, MAX_LOGGED_ARRAY_ENTRIES)
+      .map((entry) => summarizeArguments(entry))
+    if (value.length > MAX_LOGGED_ARRAY_ENTRIES) {
+      entries.push(`<${value.length - MAX_LOGGED_ARRAY_ENTRIES} more>`)
+    }
+    return entries
+  }
+  if (value !== null && typeof value === "object") {
+    return Object.fromEntries(
+      Object.entries(value).map(([name, entry]) => [name, summarizeArguments(entry, name)])
+    )
+  }
+  return value
+}
+
+/**
+ * Builds the data of a log record: its message and attributes, with errors as their messages.
+ *
+ * @param record - The record
+ * @returns A JSON-serializable object
+ */
+export function logRecordData(record: LogRecord): LogAttributes {
+  const data: LogAttributes = { msg: record.msg }
+  for (const [name, value] of Object.entries(record.attrs)) {
+    data[name] = value instanceof Error ? value.message : value
+  }
+  return data
+}
+
+/**
+ * Formats a log record as a JSON line (without the newline).
+ *
+ * @param record - The record
+ * @returns e.g. {"time":"...","level":"info","msg":"tool call","tool":"print_file"}
+ */
+export function formatLogRecord(record: LogRecord): string {
+  return JSON.stringify({ time: record.time, level: record.level, ...logRecordData(record) })
+}
+
+/**
+ * Writes a formatted record to the log file, or stderr without one (or when it can't be
+ * written).
+ */
+function writeLogLine(line: string): void {
+  if (config.logFile) {
+    try {
+      appendFileSync(config.logFile, `${line}\n`)
+      return
+    } catch {
+      // Fall back to stderr so the record isn't lost
+    }
+  }
+  console.error(line)
+}
+
+/**
+ * Adds a handler that receives every log record.
+ *
+ * @param handler - The handler; errors it throws are ignored
+ * @returns A function that removes the handler
+ */
+export function addLogHandler(handler: LogHandler): () => void {
+  handlers.add(handler)
+  return () => {
+    handlers.delete(handler)
+  }
+}
+
+/**
+ * Logs a record.
+ *
+ * @param level - Level of the record
+ * @param msg - What happened (e.g., "tool call")
+ * @param attrs - Details of it
+ */
+export function log(level: LogLevel, msg: string, attrs: LogAttributes = {}): void {
+  const record: LogRecord = { time: new Date().toISOString(), level, msg, attrs }
+  const minimum = LOG_LEVEL_RANKS[config.logLevel] ?? LOG_LEVEL_RANKS.info
+  if (LOG_LEVEL_RANKS[level] >= minimum) {
+    writeLogLine(formatLogRecord(record))
+  }
+  for (const handler of handlers) {
+    try {
+      handler(record)
+    } catch {
+      // A failing handler (e.g., a closed session) mustn't break logging
+    }
+  }
+}
+
+/**
+ * Logs at each level.
+ *
+ * @example
+ * ```typescript
+ * logger.info("job state", { job_id: "queue#1", to: "submitted" })
+ * ```
+ */
+export const logger = {
+  debug: (msg: string, attrs?: LogAttributes) => log("debug", msg, attrs),
+  info: (msg: string, attrs?: LogAttributes) => log("info", msg, attrs),
+  warn: (msg: string, attrs?: LogAttributes) => log("warn", msg, attrs),
+  error: (msg: string, attrs?: LogAttributes) => log("error", msg, attrs),
+}
+
+/**
+ * Sends console.log, console.info, and console.debug output (e.g., from a dependency) to the
+ * log, so nothing but JSON-RPC is written to stdout on the stdio transport.
+ */
+export function redirectConsoleToLog(): void {
+  const toLog = (...args: unknown[]) => logger.info("console output", { text: format(...args) })
+  console.log = toLog
+  console.info = toLog
+  console.debug = toLog
+}
+
+/**
+ * Logs a command the server ran (at debug), with its exit code and how long it took.
+ *
+ * @param command - The command (e.g., "lp")
+ * @param args - Its arguments
+ * @param exitCode - Its exit code (undefined if it couldn't be started or was killed)
+ * @param startedAt - When it started (Date.now())
+ */
+export function logCommand(
+  command: string,
+  args: readonly string[],
+  exitCode: number | undefined,
+  startedAt: number
+): void {
+  logger.debug("command", {
+    command,
+    args: summarizeArguments(args),
+    exit_code: exitCode ?? null,
+    duration_ms: Date.now() - startedAt,
+  })
+}
@@ -0,0 +1,222 @@
+/**
+ * @fileoverview Minimal DNS message encoding and decoding for mDNS (RFC 6762) service discovery.
+ * Supports the record types DNS-SD uses: PTR, SRV, TXT, A, and AAAA.
+ */
+
+/** DNS record types used by DNS-SD. */
+export const RECORD_TYPES = {
+  A: 1,
+  PTR: 12,
+  TXT: 16,
+  AAAA: 28,
+  SRV: 33,
+} as const
+
+/** The cache-flush bit mDNS responders set on the record class. */
+const CACHE_FLUSH_BIT = 0x8000
+
+/**
+ * A question in a DNS query.
+ */
+export interface DnsQuestion {
+  name: string
+  type: number
+}
+
+/**
+ * SRV record data.
+ */
+export interface SrvData {
+  priority: number
+  weight: number
+  port: number
+  target: string
+}
+
+/**
+ * A resource record from a DNS response.
+ * `data` is a name (PTR), SrvData (SRV), key/value pairs (TXT), an address (A/AAAA),
+ * or the raw bytes for other types.
+ */
+export interface DnsRecord {
+  name: string
+  type: number
+  ttl: number
+  data: string | SrvData | Record<string, string> | Buffer
+}
+
+/**
+ * Encodes a domain name as DNS labels (no compression).
+ */
+function encodeName(name: string): Buffer {
+  const labels = name.replace(/\.$/, "").split(".")
+  const parts = labels.flatMap((label) => {
+    const bytes = Buffer.from(label, "utf-8")
+    return [Buffer.from([bytes.length]), bytes]
+  })
+  return Buffer.concat([...parts, Buffer.from([0])])
+}
+
+/**
+ * Encodes a DNS query for the given questions.
+ *
+ * @param questions - Names and record types to ask for
+ * @returns The query message
+ */
+export function encodeDnsQuery(questions: DnsQuestion[]): Buffer {
+  const header = Buffer.alloc(12)
+  header.writeUInt16BE(questions.length, 4)
+
+  const body = questions.map(({ name, type }) => {
+    const fields = Buffer.alloc(4)
+    fields.writeUInt16BE(type, 0)
+    fields.writeUInt16BE(1, 2) // class IN
+    return Buffer.concat([encodeName(name), fields])
+  })
+
+  return Buffer.concat([header, ...body])
+}
+
+/**
+ * Decodes a possibly compressed domain name.
+ *
+ * @returns The name and the offset just past it in the original position
+ */
+function decodeName(buffer: Buffer, start: number): { name: string; end: number } {
+  const labels: string[] = []
+  let offset = start
+  let end = -1
+  let jumps = 0
+
+  for (;;) {
+    if (offset >= buffer.length) {
+      throw new Error(`Malformed DNS message: name runs past end of data at byte ${offset}`)
+    }
+    const length = buffer[offset]
+
+    if (length === 0) {
+      offset += 1
+      break
+    }
+
+    if ((length & 0xc0) === 0xc0) {
+      // Compression pointer to an earlier name
+      if (++jumps > 32) {
+        throw new Error("Malformed DNS message: compression loop")
+      }
+      if (end < 0) {
+        end = offset + 2
+      }
+      offset = buffer.readUInt16BE(offset) & 0x3fff
+      continue
+    }
+
+    labels.push(buffer.toString("utf-8", offset + 1, offset + 1 + length))
+    offset += 1 + length
+  }
+
+  return { name: labels.join("."), end: end < 0 ? offset : end }
+}
+
+/**
+ * Decodes TXT record strings into key/value pairs (keys lowercased, as DNS-SD keys are
+ * case-insensitive). Keys without a value map to an empty string.
+ */
+function decodeTxt(data: Buffer): Record<string, string> {
+  const entries: Record<string, string> = {}
+  let offset = 0
+  while (offset < data.length) {
+    const length = data[offset]
+    const entry = data.toString("utf-8", offset + 1, offset + 1 + length)
+    offset += 1 + length
+    if (!entry) continue
+
+    const separator = entry.indexOf("=")
+    const key = (separator < 0 ? entry : entry.slice(0, separator)).toLowerCase()
+    if (!(key in entries)) {
+      entries[key] = separator < 0 ? "" : entry.slice(separator + 1)
+    }
+  }
+  return entries
+}
+
+/**
+ * Formats the 16 bytes of an IPv6 address.
+ */
+function formatIpv6(data: Buffer): string {
+  const groups: string[] = []
+  for (let i = 0; i < 16; i += 2) {
+    groups.push(data.readUInt16BE(i).toString(16))
+  }
+  return groups.join(":").replace(/(^|:)0(:0)+(:|$)/, "::")
+}
+
+/**
+ * Decodes the data of a resource record.
+ */
+function decodeRecordData(buffer: Buffer, type: number, start: number, length: number) {
+  const data = buffer.subarray(start, start + length)
+  switch (type) {
+    case RECORD_TYPES.PTR:
+      return decodeName(buffer, start).name
+    case RECORD_TYPES.SRV:
+      return {
+        priority: data.readUInt16BE(0),
+        weight: data.readUInt16BE(2),
+        port: data.readUInt16BE(4),
+        target: decodeName(buffer, start + 6).name,
+      }
+    case RECORD_TYPES.TXT:
+      return decodeTxt(data)
+    case RECORD_TYPES.A:
+      return [...data].join(".")
+    case RECORD_TYPES.AAAA:
+      return formatIpv6(data)
+    default:
+      return Buffer.from(data)
+  }
+}
+
+/**
+ * Decodes the resource records of a DNS response (answers, authority, and additional records).
+ *
+ * @param buffer - Raw DNS message
+ * @returns Every resource record in the message
+ * @throws {Error} If the message is truncated or malformed
+ */
+export function decodeDnsRecords(buffer: Buffer): DnsRecord[] {
+  if (buffer.length < 12) {
+    throw new Error("Malformed DNS message: shorter than the 12-byte header")
+  }
+
+  const questionCount = buffer.readUInt16BE(4)
+  const recordCount = buffer.readUInt16BE(6) + buffer.readUInt16BE(8) + buffer.readUInt16BE(10)
+  let offset = 12
+
+  for (let i = 0; i < questionCount; i++) {
+    offset = decodeName(buffer, offset).end + 4
+  }
+
+  const records: DnsRecord[] = []
+  for (let i = 0; i < recordCount; i++) {
+    const { name, end } = decodeName(buffer, offset)
+    if (end + 10 > buffer.length) {
+      throw new Error(`Malformed DNS message: unexpected end of data at byte ${end}`)
+    }
+    const type = buffer.readUInt16BE(end)
+    const recordClass = buffer.readUInt16BE(end + 2) & ~CACHE_FLUSH_BIT
+    const ttl = buffer.readUInt32BE(end + 4)
+    const length = buffer.readUInt16BE(end + 8)
+    const dataStart = end + 10
+    if (dataStart + length > buffer.length) {
+      throw new Error(`Malformed DNS message: unexpected end of data at byte ${buffer.length}`)
+    }
+
+    if (recordClass === 1) {
+      records.push({ name, type, ttl, data: decodeRecordData(buffer, type, dataStart, length) })
+    }
+    offset = dataStart + length
+  }
+
+  return records
+}
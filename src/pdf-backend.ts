@@ -0,0 +1,316 @@
+/**
+ * @fileoverview Virtual PDF printer, for development and tests on a machine without a printer.
+ * With MCP_PRINTER_BACKEND=pdf the printing system is replaced by a single printer,
+ * Virtual_PDF, which writes each job's document to MCP_PRINTER_PDF_OUTPUT_DIR and then plays
+ * the job through the states a real printer reports: pending, processing, and completed once
+ * MCP_PRINTER_PDF_JOB_DELAY_SECONDS have passed. Job IDs have the usual "<printer>-<number>"
+ * form, so get_job_status, release_job, cancel_print_job, and list_recent_jobs work as they do
+ * with CUPS. Jobs are kept in memory (the documents stay in the output directory), so after a
+ * restart earlier jobs are reported as "not-found".
+ */
+
+import { copyFile, mkdir, readdir, rm, stat, writeFile } from "fs/promises"
+import { basename, join } from "path"
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+import { logger } from "./logger.js"
+import { QUALITY_LEVELS } from "./print-options.js"
+import { RAW_OPTION } from "./raw.js"
+import { throwIfAborted } from "./timeouts.js"
+import type { JobState, JobStatus, LpJobOptions, PrinterSummary } from "./cups.js"
+import type { PrinterCapabilities } from "./printer-info.js"
+
+/**
+ * Name of the virtual printer.
+ */
+export const VIRTUAL_PDF_PRINTER = "Virtual_PDF"
+
+/** Media sizes the virtual printer reports. */
+const VIRTUAL_MEDIA_SIZES = ["Letter", "Legal", "Tabloid", "A3", "A4", "A5", "B5", "Executive"]
+
+/** Resolutions the virtual printer reports. */
+const VIRTUAL_RESOLUTIONS = ["300dpi", "600dpi", "1200dpi"]
+
+/** Output files are named "<job ID>-<document>", e.g. "Virtual_PDF-3-README.pdf". */
+const OUTPUT_NAME_PATTERN = new RegExp(`^${VIRTUAL_PDF_PRINTER}-(\\d+)-`)
+
+/**
+ * A job printed to the virtual printer.
+ */
+interface VirtualJob {
+  jobId: string
+  outputPath: string
+  size: number
+  submittedAt: Date
+  /** When the job started printing: its submission, or its release if it was held */
+  startedAt?: Date
+  /** When a job held until a time of day releases itself */
+  heldUntil?: Date
+  /** How long the job takes to print (MCP_PRINTER_PDF_JOB_DELAY_SECONDS when it was sent) */
+  durationMs: number
+  canceled: boolean
+}
+
+const jobs = new Map<string, VirtualJob>()
+let nextJobNumber: number | undefined
+
+/**
+ * Checks that a printer is the virtual printer.
+ *
+ * @throws {PrinterError} PRINTER_NOT_FOUND for any other printer
+ */
+function checkPrinter(printer: string): void {
+  if (printer.toLowerCase() !== VIRTUAL_PDF_PRINTER.toLowerCase()) {
+    throw new PrinterError(
+      "PRINTER_NOT_FOUND",
+      `Printer "${printer}" not found: the pdf backend has a single printer, ${VIRTUAL_PDF_PRINTER}.`,
+      {
+        suggestion: `Print to ${VIRTUAL_PDF_PRINTER}, or set MCP_PRINTER_BACKEND to cups (or auto) to use the system's printers.`,
+      }
+    )
+  }
+}
+
+/**
+ * Picks the next job number, continuing after the jobs already in the output directory so a
+ * restarted server doesn't reuse their job IDs.
+ */
+async function takeJobNumber(): Promise<number> {
+  if (nextJobNumber === undefined) {
+    const numbers = (await readdir(config.pdfOutputDir)).map(
+      (name) => Number(name.match(OUTPUT_NAME_PATTERN)?.[1] ?? 0)
+    )
+    nextJobNumber = Math.max(0, ...numbers) + 1
+  }
+  return nextJobNumber++
+}
+
+/**
+ * Finds when a job-hold-until value releases the job on its own.
+ *
+ * @param holdUntil - A job-hold-until value: a keyword, or a UTC time of day ("HH:MM:SS")
+ * @param now - Current time
+ * @returns The next time of day it names, or undefined for keywords (held until released)
+ */
+function holdReleaseTime(holdUntil: string, now: Date): Date | undefined {
+  const match = holdUntil.match(/^(\d{2}):(\d{2})(?::(\d{2}))?$/)
+  if (!match) {
+    return undefined
+  }
+  const time = new Date(now)
+  time.setUTCHours(Number(match[1]), Number(match[2]), Number(match[3] ?? 0), 0)
+  if (time <= now) {
+    time.setUTCDate(time.getUTCDate() + 1)
+  }
+  return time
+}
+
+/**
+ * Works out a job's state from the time that has passed since it started printing.
+ * A job is pending for the first half of MCP_PRINTER_PDF_JOB_DELAY_SECONDS and processing for
+ * the second half.
+ */
+function jobState(job: VirtualJob, now = Date.now()): JobState {
+  if (job.canceled) {
+    return "canceled"
+  }
+  const startedAt =
+    job.startedAt ?? (job.heldUntil && job.heldUntil.getTime() <= now ? job.heldUntil : undefined)
+  if (!startedAt) {
+    return "held"
+  }
+  const elapsed = now - startedAt.getTime()
+  if (elapsed >= job.durationMs) {
+    return "completed"
+  }
+  return elapsed < job.durationMs / 2 ? "pending" : "processing"
+}
+
+/** Job state reasons reported for each state, worded like CUPS's. */
+const STATE_ALERTS: Partial<Record<JobState, string[]>> = {
+  held: ["job-hold-until-specified"],
+  processing: ["job-printing"],
+  completed: ["job-completed-successfully"],
+  canceled: ["job-canceled-by-user"],
+}
+
+/**
+ * Looks up a job by its full job ID or its job number.
+ */
+function findJob(jobId: string): VirtualJob | undefined {
+  return jobs.get(/^\d+$/.test(jobId) ? `${VIRTUAL_PDF_PRINTER}-${jobId}` : jobId)
+}
+
+/**
+ * "Prints" a job: writes its document to MCP_PRINTER_PDF_OUTPUT_DIR and starts its simulated
+ * lifecycle. A job with job-hold-until is held until it is released, or until the time of day
+ * it names. Copies and the other CUPS options can't be applied to a file and are only logged.
+ *
+ * @param job - Job options
+ * @param signal - Signal that cancels the submission
+ * @returns The job ID (e.g., "Virtual_PDF-3")
+ * @throws {PrinterError} PRINTER_NOT_FOUND if the job is for another printer
+ * @throws {Error} If the document can't be written to the output directory
+ */
+export async function submitPdfJob(job: LpJobOptions, signal?: AbortSignal): Promise<string> {
+  checkPrinter(job.printer || VIRTUAL_PDF_PRINTER)
+  throwIfAborted(`Printing to ${VIRTUAL_PDF_PRINTER}`, signal)
+
+  await mkdir(config.pdfOutputDir, { recursive: true })
+  const jobId = `${VIRTUAL_PDF_PRINTER}-${await takeJobNumber()}`
+  // Raw content (label or receipt printer commands) is written as printer data, not text
+  const extension = job.options?.includes(RAW_OPTION) ? "prn" : "txt"
+  const document = job.filePath
+    ? basename(job.filePath)
+    : `${job.title || "mcp-printer"}.${extension}`
+  const outputPath = join(config.pdfOutputDir, `${jobId}-${document.replace(/[^\w.-]+/g, "_")}`)
+  if (job.filePath) {
+    await copyFile(job.filePath, outputPath)
+  } else {
+    await writeFile(outputPath, job.content ?? "")
+  }
+
+  const now = new Date()
+  const holdUntil = job.options
+    ?.find((option) => option.startsWith("job-hold-until="))
+    ?.slice("job-hold-until=".length)
+  const held = holdUntil !== undefined && holdUntil !== "no-hold"
+  jobs.set(jobId, {
+    jobId,
+    outputPath,
+    size: (await stat(outputPath)).size,
+    submittedAt: now,
+    ...(held ? { heldUntil: holdReleaseTime(holdUntil, now) } : { startedAt: now }),
+    durationMs: Math.max(config.pdfJobDelaySeconds ?? 0, 0) * 1000,
+    canceled: false,
+  })
+  logger.info("job written to the virtual PDF printer", {
+    job_id: jobId,
+    path: outputPath,
+    copies: job.copies ?? 1,
+    options: job.options ?? [],
+  })
+  return jobId
+}
+
+/**
+ * Lists the virtual printer, the default and only printer.
+ *
+ * @returns The virtual printer's summary
+ */
+export function listPdfPrinters(): PrinterSummary[] {
+  const printing = [...jobs.values()].some((job) => jobState(job) === "processing")
+  return [
+    {
+      name: VIRTUAL_PDF_PRINTER,
+      description: `Virtual PDF printer (writes to ${config.pdfOutputDir})`,
+      is_default: true,
+      state: printing ? "printing" : "idle",
+      accepting_jobs: true,
+      location: config.pdfOutputDir,
+    },
+  ]
+}
+
+/**
+ * Reports a virtual job's state, with the file it was written to.
+ *
+ * @param jobId - Job ID (e.g., "Virtual_PDF-3") or job number (e.g., "3")
+ * @returns The job's status ("not-found" for jobs this server didn't print)
+ */
+export function getPdfJobStatus(jobId: string): JobStatus {
+  const job = findJob(jobId)
+  if (!job) {
+    return { job_id: jobId, state: "not-found" }
+  }
+  const state = jobState(job)
+  return {
+    job_id: job.jobId,
+    state,
+    printer: VIRTUAL_PDF_PRINTER,
+    size: job.size,
+    submitted: job.submittedAt.toISOString(),
+    alerts: STATE_ALERTS[state] ?? [],
+    status_message:
+      state === "canceled" ? "Canceled; the file was removed" : `Written to ${job.outputPath}`,
+  }
+}
+
+/**
+ * Releases a held virtual job, which then plays through its lifecycle from now.
+ *
+ * @param jobId - Full job ID (e.g., "Virtual_PDF-3")
+ * @throws {Error} If the job doesn't exist
+ */
+export function releasePdfJob(jobId: string): void {
+  const job = findJob(jobId)
+  if (!job) {
+    throw new Error(`Job ${jobId} not found`)
+  }
+  if (jobState(job) === "held") {
+    job.startedAt = new Date()
+  }
+}
+
+/**
+ * Cancels a virtual job that hasn't completed, removing the file it was written to.
+ *
+ * @param jobId - Full job ID (e.g., "Virtual_PDF-3")
+ * @throws {Error} If the job doesn't exist or has already completed
+ */
+export async function cancelPdfJob(jobId: string): Promise<void> {
+  const job = findJob(jobId)
+  if (!job) {
+    throw new Error(`Job ${jobId} not found`)
+  }
+  if (jobState(job) === "completed") {
+    throw new Error(`Job ${job.jobId} is already completed - can't cancel.`)
+  }
+  job.canceled = true
+  await rm(job.outputPath, { force: true })
+}
+
+/**
+ * Cancels every virtual job that hasn't completed.
+ *
+ * @param printer - Printer name (must be the virtual printer)
+ * @throws {PrinterError} PRINTER_NOT_FOUND for any other printer
+ */
+export async function cancelAllPdfJobs(printer: string): Promise<void> {
+  checkPrinter(printer)
+  for (const job of jobs.values()) {
+    const state = jobState(job)
+    if (state !== "completed" && state !== "canceled") {
+      await cancelPdfJob(job.jobId)
+    }
+  }
+}
+
+/**
+ * Describes the virtual printer for get_printer_info: it reports every duplex mode, color,
+ * every quality level, and the common media sizes, so any print option can be tried against it.
+ *
+ * @param printer - Printer name (must be the virtual printer)
+ * @returns The virtual printer's capabilities
+ * @throws {PrinterError} PRINTER_NOT_FOUND for any other printer
+ */
+export function getPdfPrinterInfo(printer: string): PrinterCapabilities {
+  checkPrinter(printer)
+  const [summary] = listPdfPrinters()
+  return {
+    printer: VIRTUAL_PDF_PRINTER,
+    source: "pdf",
+    make_and_model: "MCP Printer Virtual PDF",
+    state: summary.state,
+    state_reasons: [],
+    accepting_jobs: true,
+    duplex: true,
+    duplex_modes: ["none", "long-edge", "short-edge"],
+    color: true,
+    quality_levels: [...QUALITY_LEVELS],
+    media_sizes: VIRTUAL_MEDIA_SIZES,
+    default_media: "Letter",
+    resolutions: VIRTUAL_RESOLUTIONS,
+    default_resolution: "600dpi",
+  }
+}
@@ -0,0 +1,482 @@
+/**
+ * @fileoverview Finding the pages of a PDF that print in color.
+ *
+ * Most printers charge more for color pages, so job estimates count them separately. A page
+ * counts as color when its content sets a color that isn't a shade of gray, or draws an image
+ * or a shading in a color space that isn't gray. This looks at the content, not at what it
+ * renders to, and errs toward color:
+ *
+ * - Images are judged by their color space, not their pixels, so a gray photo saved as RGB
+ *   counts as color.
+ * - Spot colors, patterns, and content that can't be decoded count as color.
+ * - Forms the page draws (Form XObjects) are checked too; annotations aren't.
+ */
+
+import {
+  PdfDocument,
+  PdfName,
+  PdfRef,
+  PdfStream,
+  isDict,
+  nameOf,
+  type PdfDict,
+  type PdfPage,
+  type PdfValue,
+} from "./document.js"
+
+/**
+ * What a color space can print: only grays, colors checked by their RGB or CMYK values, or
+ * colors (spot colors, patterns, Lab, and anything unknown).
+ */
+type ColorSpaceKind = "gray" | "rgb" | "cmyk" | "color"
+
+/** Difference between color components below which a color is taken as gray. */
+const GRAY_TOLERANCE = 0.01
+
+/** How deeply color spaces and forms are followed, so malformed files can't loop. */
+const MAX_DEPTH = 8
+
+/** Color space names of inline images and device color spaces. */
+const DEVICE_COLOR_SPACES: Record<string, ColorSpaceKind> = {
+  DeviceGray: "gray",
+  G: "gray",
+  CalGray: "gray",
+  DeviceRGB: "rgb",
+  RGB: "rgb",
+  CalRGB: "rgb",
+  DeviceCMYK: "cmyk",
+  CMYK: "cmyk",
+}
+
+/** Colorants that print on the black plate (or nowhere) in Separation and DeviceN spaces. */
+const NEUTRAL_COLORANTS = new Set(["Black", "All", "None"])
+
+/** Bytes that end a token. */
+const DELIMITERS = "()<>[]{}/%"
+
+/** Whitespace bytes. */
+const WHITESPACE = "\x00\t\n\f\r "
+
+/** A token of a content stream; strings, arrays, and dictionaries are only delimited. */
+type Token =
+  | { kind: "number"; value: number }
+  | { kind: "name"; value: string }
+  | { kind: "keyword"; value: string }
+  | { kind: "open" | "close" | "other" }
+
+/**
+ * Reads the operators of a content stream with their operands. Only numbers and names are
+ * kept as operands, which is all color operators take.
+ */
+class ContentScanner {
+  private readonly text: string
+  private pos = 0
+
+  constructor(text: string) {
+    this.text = text
+  }
+
+  /**
+   * Reads the next operator.
+   *
+   * @returns The operator and the numbers and names before it, or undefined at the end
+   */
+  nextOperator(): { operator: string; operands: Array<number | PdfName> } | undefined {
+    const operands: Array<number | PdfName> = []
+    for (let token = this.readToken(); token; token = this.readToken()) {
+      if (token.kind === "number") {
+        operands.push(token.value)
+      } else if (token.kind === "name") {
+        operands.push(new PdfName(token.value))
+      } else if (token.kind === "keyword" && !["true", "false", "null"].includes(token.value)) {
+        return { operator: token.value, operands }
+      }
+    }
+    return undefined
+  }
+
+  /**
+   * Reads the dictionary of an inline image (after BI) and skips its data.
+   *
+   * @returns The image's entries; arrays are read as lists of names and numbers
+   */
+  readInlineImage(): PdfDict {
+    const dict: PdfDict = new Map()
+    let key: string | undefined
+    for (let token = this.readToken(); token; token = this.readToken()) {
+      if (token.kind === "keyword" && token.value === "ID") {
+        break
+      }
+      if (key === undefined) {
+        key = token.kind === "name" ? token.value : undefined
+        continue
+      }
+      if (token.kind === "open") {
+        const items: PdfValue[] = []
+        for (let item = this.readToken(); item && item.kind !== "close"; item = this.readToken()) {
+          if (item.kind === "name") items.push(new PdfName(item.value))
+          if (item.kind === "number") items.push(item.value)
+        }
+        dict.set(key, items)
+      } else if (token.kind === "name") {
+        dict.set(key, new PdfName(token.value))
+      } else if (token.kind === "number") {
+        dict.set(key, token.value)
+      } else if (token.kind === "keyword") {
+        dict.set(key, token.value === "true")
+      }
+      key = undefined
+    }
+
+    // The data runs to an EI keyword on its own, after the single whitespace byte after ID
+    const start = this.pos + 1
+    const length = dict.get("L") ?? dict.get("Length")
+    const from = typeof length === "number" ? start + length : start
+    const end = /[\x00\t\n\f\r ]EI(?=[\x00\t\n\f\r /]|$)/g
+    end.lastIndex = Math.min(from, this.text.length)
+    const match = end.exec(this.text)
+    this.pos = match ? match.index + match[0].length : this.text.length
+    return dict
+  }
+
+  private readToken(): Token | undefined {
+    const text = this.text
+    for (;;) {
+      while (this.pos < text.length && WHITESPACE.includes(text[this.pos])) this.pos++
+      if (text[this.pos] !== "%") break
+      while (this.pos < text.length && !"\r\n".includes(text[this.pos])) this.pos++
+    }
+    if (this.pos >= text.length) {
+      return undefined
+    }
+
+    const char = text[this.pos]
+    if (char === "(") {
+      this.skipLiteralString()
+      return { kind: "other" }
+    }
+    if (char === "<" || char === ">") {
+      if (text[this.pos + 1] === char) {
+        this.pos += 2
+      } else if (char === "<") {
+        const end = text.indexOf(">", this.pos)
+        this.pos = end < 0 ? text.length : end + 1
+      } else {
+        this.pos++
+      }
+      return { kind: "other" }
+    }
+    if (char === "[" || char === "]") {
+      this.pos++
+      return { kind: char === "[" ? "open" : "close" }
+    }
+    if (char === "{" || char === "}" || char === ")") {
+      this.pos++
+      return { kind: "other" }
+    }
+
+    const start = char === "/" ? this.pos + 1 : this.pos
+    this.pos = start
+    while (
+      this.pos < text.length &&
+      !WHITESPACE.includes(text[this.pos]) &&
+      !DELIMITERS.includes(text[this.pos])
+    ) {
+      this.pos++
+    }
+    const word = text.slice(start, this.pos)
+    if (char === "/") {
+      return { kind: "name", value: word }
+    }
+    const number = Number(word)
+    return /^[+-]?(\d+\.?\d*|\.\d+)$/.test(word) && Number.isFinite(number)
+      ? { kind: "number", value: number }
+      : { kind: "keyword", value: word }
+  }
+
+  private skipLiteralString(): void {
+    let depth = 0
+    while (this.pos < this.text.length) {
+      const char = this.text[this.pos++]
+      if (char === "\\") {
+        this.pos++
+      } else if (char === "(") {
+        depth++
+      } else if (char === ")" && --depth === 0) {
+        return
+      }
+    }
+  }
+}
+
+/**
+ * Checks whether color components are far enough apart to be a color rather than a gray.
+ */
+function isColorful(components: number[]): boolean {
+  return Math.max(...components) - Math.min(...components) > GRAY_TOLERANCE
+}
+
+/**
+ * Finds the pages of a document that print in color.
+ */
+class ColorScanner {
+  private readonly document: PdfDocument
+  /** Results for Form XObjects, by object number */
+  private readonly forms = new Map<number, boolean>()
+
+  constructor(document: PdfDocument) {
+    this.document = document
+  }
+
+  /**
+   * Checks whether a page prints in color.
+   */
+  pageUsesColor(page: PdfPage): boolean {
+    const resources = this.dictOf(page.dict.get("Resources") ?? page.inherited.get("Resources"))
+    const contents = this.document.resolve(page.dict.get("Contents") ?? null)
+    const streams = Array.isArray(contents) ? contents : [contents]
+    try {
+      const text = streams
+        .map((stream) => this.document.resolve(stream))
+        .filter((stream) => stream instanceof PdfStream)
+        .map((stream) => this.document.decodeStream(stream).toString("latin1"))
+        .join("\n")
+      return this.contentUsesColor(text, resources, 0)
+    } catch {
+      // Content this module can't decode (a filter other than Flate) is counted as color
+      return true
+    }
+  }
+
+  private dictOf(value: PdfValue | undefined): PdfDict | undefined {
+    const resolved = this.document.resolve(value ?? null)
+    if (resolved instanceof PdfStream) {
+      return resolved.dict
+    }
+    return isDict(resolved) ? resolved : undefined
+  }
+
+  private resource(resources: PdfDict | undefined, category: string, name: string): PdfValue {
+    const entries = this.dictOf(resources?.get(category))
+    return this.document.resolve(entries?.get(name) ?? null)
+  }
+
+  /**
+   * Works out what a color space can print.
+   *
+   * @param value - A color space: a name (device or resource name) or an array
+   * @param resources - Resources to look color space names up in
+   */
+  private colorSpaceKind(
+    value: PdfValue,
+    resources: PdfDict | undefined,
+    depth: number
+  ): ColorSpaceKind {
+    const space = this.document.resolve(value)
+    if (depth > MAX_DEPTH) {
+      return "color"
+    }
+    if (space instanceof PdfName) {
+      const kind = DEVICE_COLOR_SPACES[space.name]
+      if (kind) {
+        return kind
+      }
+      const named = this.resource(resources, "ColorSpace", space.name)
+      return named === null ? "color" : this.colorSpaceKind(named, resources, depth + 1)
+    }
+    if (!Array.isArray(space)) {
+      return "color"
+    }
+
+    const [family, base] = space.map((item) => this.document.resolve(item))
+    switch (nameOf(family ?? undefined)) {
+      case "ICCBased": {
+        const components = base instanceof PdfStream ? base.dict.get("N") : undefined
+        return ({ 1: "gray", 3: "rgb", 4: "cmyk" } as const)[String(components)] ?? "color"
+      }
+      case "Indexed":
+      case "I":
+        // A palette over a gray base is gray; other palettes aren't worth decoding
+        return this.colorSpaceKind(base ?? null, resources, depth + 1) === "gray" ? "gray" : "color"
+      case "Separation":
+        return base instanceof PdfName && NEUTRAL_COLORANTS.has(base.name) ? "gray" : "color"
+      case "DeviceN":
+        return Array.isArray(base) &&
+          base.every((colorant) => {
+            const name = nameOf(this.document.resolve(colorant) ?? undefined)
+            return name !== undefined && NEUTRAL_COLORANTS.has(name)
+          })
+          ? "gray"
+          : "color"
+      case "CalGray":
+        return "gray"
+      case "CalRGB":
+        return "rgb"
+      default:
+        return "color"
+    }
+  }
+
+  /**
+   * Checks whether an image or form XObject prints in color.
+   */
+  private xobjectUsesColor(value: PdfValue, resources: PdfDict | undefined, depth: number) {
+    const ref = value instanceof PdfRef ? value : undefined
+    const xobject = this.document.resolve(value)
+    if (!(xobject instanceof PdfStream)) {
+      return false
+    }
+
+    const subtype = nameOf(xobject.dict.get("Subtype"))
+    if (subtype === "Image") {
+      // Masks paint in the fill color, which is checked where it is set
+      if (this.document.resolve(xobject.dict.get("ImageMask") ?? null) === true) {
+        return false
+      }
+      const space = xobject.dict.get("ColorSpace")
+      return space === undefined || this.colorSpaceKind(space, resources, 0) !== "gray"
+    }
+    if (subtype !== "Form") {
+      return false
+    }
+    if (depth >= MAX_DEPTH) {
+      return true
+    }
+
+    const cached = ref ? this.forms.get(ref.num) : undefined
+    if (cached !== undefined) {
+      return cached
+    }
+    if (ref) {
+      // A form that draws itself is counted as it is so far
+      this.forms.set(ref.num, false)
+    }
+    const formResources = this.dictOf(xobject.dict.get("Resources")) ?? resources
+    const text = this.document.decodeStream(xobject).toString("latin1")
+    const usesColor = this.contentUsesColor(text, formResources, depth + 1)
+    if (ref) {
+      this.forms.set(ref.num, usesColor)
+    }
+    return usesColor
+  }
+
+  /**
+   * Checks whether a content stream sets a color, or draws an image or shading in color.
+   */
+  private contentUsesColor(text: string, resources: PdfDict | undefined, depth: number): boolean {
+    const scanner = new ContentScanner(text)
+    let fill: ColorSpaceKind = "gray"
+    let stroke: ColorSpaceKind = "gray"
+    const saved: Array<[ColorSpaceKind, ColorSpaceKind]> = []
+
+    const numbers = (operands: Array<number | PdfName>) =>
+      operands.filter((operand): operand is number => typeof operand === "number")
+    const isColor = (kind: ColorSpaceKind, operands: Array<number | PdfName>) => {
+      const values = numbers(operands)
+      // A pattern name as an operand paints with a pattern
+      if (kind === "color" || operands.some((operand) => operand instanceof PdfName)) {
+        return true
+      }
+      if (kind === "rgb") {
+        return values.length >= 3 && isColorful(values.slice(-3))
+      }
+      return kind === "cmyk" && values.length >= 4 && isColorful(values.slice(-4, -1))
+    }
+
+    for (let next = scanner.nextOperator(); next; next = scanner.nextOperator()) {
+      const { operator, operands } = next
+      const [name] = operands.filter((operand) => operand instanceof PdfName)
+      switch (operator) {
+        case "q":
+          saved.push([fill, stroke])
+          break
+        case "Q": {
+          const [savedFill, savedStroke] = saved.pop() ?? ["gray", "gray"]
+          fill = savedFill
+          stroke = savedStroke
+          break
+        }
+        case "g":
+          fill = "gray"
+          break
+        case "G":
+          stroke = "gray"
+          break
+        case "rg":
+        case "RG":
+          if (operator === "rg") fill = "rgb"
+          else stroke = "rgb"
+          if (isColor("rgb", operands)) return true
+          break
+        case "k":
+        case "K":
+          if (operator === "k") fill = "cmyk"
+          else stroke = "cmyk"
+          if (isColor("cmyk", operands)) return true
+          break
+        case "cs":
+        case "CS": {
+          const kind = name ? this.colorSpaceKind(name, resources, 0) : "color"
+          if (operator === "cs") fill = kind
+          else stroke = kind
+          break
+        }
+        case "sc":
+        case "scn":
+          if (isColor(fill, operands)) return true
+          break
+        case "SC":
+        case "SCN":
+          if (isColor(stroke, operands)) return true
+          break
+        case "sh": {
+          const shading = name && this.dictOf(this.resource(resources, "Shading", name.name))
+          const space = shading ? (shading.get("ColorSpace") ?? null) : null
+          if (this.colorSpaceKind(space, resources, 0) !== "gray") {
+            return true
+          }
+          break
+        }
+        case "Do": {
+          const xobjects = this.dictOf(resources?.get("XObject"))
+          const xobject = name ? xobjects?.get(name.name) : undefined
+          if (xobject !== undefined && this.xobjectUsesColor(xobject, resources, depth)) {
+            return true
+          }
+          break
+        }
+        case "BI": {
+          const image = scanner.readInlineImage()
+          const mask = image.get("IM") ?? image.get("ImageMask")
+          const space = image.get("CS") ?? image.get("ColorSpace")
+          if (mask === true || space === undefined) {
+            break
+          }
+          if (this.colorSpaceKind(space, resources, 0) !== "gray") {
+            return true
+          }
+          break
+        }
+      }
+    }
+    return false
+  }
+}
+
+/**
+ * Finds the pages of a document that print in color.
+ *
+ * @param document - The document (not encrypted: encrypted content can't be read)
+ * @returns Page numbers of the color pages, from 1
+ * @throws {PdfFormatError} If the page tree can't be read
+ */
+export function findColorPages(document: PdfDocument): Set<number> {
+  const scanner = new ColorScanner(document)
+  const colorPages = new Set<number>()
+  document.getPages().forEach((page, i) => {
+    if (scanner.pageUsesColor(page)) {
+      colorPages.add(i + 1)
+    }
+  })
+  return colorPages
+}
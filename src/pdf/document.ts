@@ -0,0 +1,867 @@
+/**
+ * @fileoverview Reading and incrementally updating PDF files.
+ *
+ * Only as much of PDF as stamping pages needs: the cross-reference table (classic tables,
+ * cross-reference streams, and object streams), the page tree, and an incremental update that
+ * appends new and replaced objects after the original bytes. The original file is never
+ * rewritten, so form fields, annotations, outlines, and anything else this module doesn't
+ * understand are kept exactly as they were.
+ *
+ * Values are parsed to a small object model: numbers, booleans, and null are JavaScript
+ * values, dictionaries are Maps keyed by name, and names, strings, and references have their
+ * own classes. Strings keep their raw bytes, so they are written back unchanged.
+ */
+
+import { inflateSync } from "zlib"
+
+/** A name object (e.g., /Type), without its slash. */
+export class PdfName {
+  readonly name: string
+
+  constructor(name: string) {
+    this.name = name
+  }
+}
+
+/** A literal or hex string, kept as its raw bytes including the delimiters. */
+export class PdfString {
+  readonly raw: string
+
+  constructor(raw: string) {
+    this.raw = raw
+  }
+}
+
+/** A reference to an indirect object. */
+export class PdfRef {
+  readonly num: number
+  readonly gen: number
+
+  constructor(num: number, gen: number) {
+    this.num = num
+    this.gen = gen
+  }
+}
+
+/** A dictionary, keyed by name (without the slash). */
+export type PdfDict = Map<string, PdfValue>
+
+/** A stream: its dictionary and its (still encoded) data. */
+export class PdfStream {
+  readonly dict: PdfDict
+  readonly data: Buffer
+
+  constructor(dict: PdfDict, data: Buffer) {
+    this.dict = dict
+    this.data = data
+  }
+}
+
+/** Any PDF value. */
+export type PdfValue =
+  | number
+  | boolean
+  | null
+  | PdfName
+  | PdfString
+  | PdfRef
+  | PdfValue[]
+  | PdfDict
+  | PdfStream
+
+/** Where an object is stored: at a byte offset, or inside an object stream. */
+type XrefEntry =
+  | { type: "offset"; offset: number; gen: number }
+  | { type: "compressed"; stream: number; index: number }
+
+/**
+ * A page of the document, with the attributes it inherits from the page tree.
+ */
+export interface PdfPage {
+  ref: PdfRef
+  dict: PdfDict
+  /** Resources, MediaBox, CropBox, and Rotate from the nearest ancestor that sets them */
+  inherited: PdfDict
+}
+
+/** Page attributes that are inherited from the page tree. */
+const INHERITED_KEYS = ["Resources", "MediaBox", "CropBox", "Rotate"]
+
+/** Bytes that end a token. */
+const DELIMITERS = "()<>[]{}/%"
+
+/** Whitespace bytes. */
+const WHITESPACE = "\x00\t\n\f\r "
+
+/**
+ * Error for a PDF this module can't read.
+ */
+export class PdfFormatError extends Error {
+  constructor(message: string) {
+    super(message)
+    this.name = "PdfFormatError"
+  }
+}
+
+/**
+ * Returns the value of a dictionary entry as a name, or undefined if it isn't one.
+ */
+export function nameOf(value: PdfValue | undefined): string | undefined {
+  return value instanceof PdfName ? value.name : undefined
+}
+
+/**
+ * Checks whether a value is a dictionary.
+ */
+export function isDict(value: PdfValue | undefined): value is PdfDict {
+  return value instanceof Map
+}
+
+/**
+ * Parses PDF values out of the text of a file (or of a decoded object stream).
+ */
+class Parser {
+  private readonly text: string
+  pos: number
+
+  constructor(text: string, pos = 0) {
+    this.text = text
+    this.pos = pos
+  }
+
+  /** Skips whitespace and comments. */
+  skipWhitespace(): void {
+    while (this.pos < this.text.length) {
+      const char = this.text[this.pos]
+      if (WHITESPACE.includes(char)) {
+        this.pos++
+      } else if (char === "%") {
+        while (this.pos < this.text.length && !"\r\n".includes(this.text[this.pos])) {
+          this.pos++
+        }
+      } else {
+        break
+      }
+    }
+  }
+
+  /** Reads a run of regular characters (a number, keyword, or name without its slash). */
+  readToken(): string {
+    const start = this.pos
+    while (
+      this.pos < this.text.length &&
+      !WHITESPACE.includes(this.text[this.pos]) &&
+      !DELIMITERS.includes(this.text[this.pos])
+    ) {
+      this.pos++
+    }
+    return this.text.slice(start, this.pos)
+  }
+
+  /** Reads a keyword, failing if it isn't the expected one. */
+  expectKeyword(keyword: string): void {
+    this.skipWhitespace()
+    const token = this.readToken()
+    if (token !== keyword) {
+      throw new PdfFormatError(`Expected "${keyword}" at byte ${this.pos}, found "${token}"`)
+    }
+  }
+
+  /** Reads a non-negative integer. */
+  readInteger(): number {
+    this.skipWhitespace()
+    const token = this.readToken()
+    if (!/^\d+$/.test(token)) {
+      throw new PdfFormatError(`Expected an integer at byte ${this.pos}, found "${token}"`)
+    }
+    return parseInt(token, 10)
+  }
+
+  /** Parses the value at the current position. */
+  parseValue(): PdfValue {
+    this.skipWhitespace()
+    const char = this.text[this.pos]
+
+    if (char === "/") {
+      this.pos++
+      return new PdfName(this.readToken())
+    }
+    if (char === "<" && this.text[this.pos + 1] === "<") {
+      return this.parseDict()
+    }
+    if (char === "<") {
+      const end = this.text.indexOf(">", this.pos)
+      if (end < 0) {
+        throw new PdfFormatError(`Unterminated hex string at byte ${this.pos}`)
+      }
+      const raw = this.text.slice(this.pos, end + 1)
+      this.pos = end + 1
+      return new PdfString(raw)
+    }
+    if (char === "(") {
+      return this.parseLiteralString()
+    }
+    if (char === "[") {
+      this.pos++
+      const array: PdfValue[] = []
+      for (;;) {
+        this.skipWhitespace()
+        if (this.text[this.pos] === "]") {
+          this.pos++
+          return array
+        }
+        if (this.pos >= this.text.length) {
+          throw new PdfFormatError("Unterminated array")
+        }
+        array.push(this.parseValue())
+      }
+    }
+
+    const start = this.pos
+    const token = this.readToken()
+    if (token === "true" || token === "false") {
+      return token === "true"
+    }
+    if (token === "null") {
+      return null
+    }
+    if (/^[+-]?(\d+\.?\d*|\.\d+)$/.test(token)) {
+      // An integer followed by another and R is a reference
+      const rest = this.text.slice(this.pos, this.pos + 32)
+      const ref = /^\s*(\d+)\s+R(?=[\s()<>[\]{}/%]|$)/.exec(rest)
+      if (/^\d+$/.test(token) && ref) {
+        this.pos += ref[0].length
+        return new PdfRef(parseInt(token, 10), parseInt(ref[1], 10))
+      }
+      return parseFloat(token)
+    }
+    throw new PdfFormatError(`Unexpected "${token || char}" at byte ${start}`)
+  }
+
+  /** Parses a dictionary. */
+  private parseDict(): PdfDict {
+    this.pos += 2
+    const dict: PdfDict = new Map()
+    for (;;) {
+      this.skipWhitespace()
+      if (this.text.startsWith(">>", this.pos)) {
+        this.pos += 2
+        return dict
+      }
+      const key = this.parseValue()
+      if (!(key instanceof PdfName)) {
+        throw new PdfFormatError(`Expected a name as a dictionary key at byte ${this.pos}`)
+      }
+      dict.set(key.name, this.parseValue())
+    }
+  }
+
+  /** Parses a literal string, with nested parentheses and escapes. */
+  private parseLiteralString(): PdfString {
+    const start = this.pos
+    let depth = 0
+    while (this.pos < this.text.length) {
+      const char = this.text[this.pos++]
+      if (char === "\\") {
+        this.pos++
+      } else if (char === "(") {
+        depth++
+      } else if (char === ")" && --depth === 0) {
+        return new PdfString(this.text.slice(start, this.pos))
+      }
+    }
+    throw new PdfFormatError(`Unterminated string at byte ${start}`)
+  }
+}
+
+/**
+ * Undoes a PNG predictor (used by cross-reference and object streams).
+ */
+function unpredict(data: Buffer, params: PdfDict | undefined): Buffer {
+  const predictor = (params?.get("Predictor") as number | undefined) ?? 1
+  if (predictor === 1) {
+    return data
+  }
+  if (predictor < 10) {
+    throw new PdfFormatError(`Unsupported predictor ${predictor}`)
+  }
+
+  const colors = (params?.get("Colors") as number | undefined) ?? 1
+  const bits = (params?.get("BitsPerComponent") as number | undefined) ?? 8
+  const columns = (params?.get("Columns") as number | undefined) ?? 1
+  const bpp = Math.max(1, Math.ceil((colors * bits) / 8))
+  const rowLength = Math.ceil((columns * colors * bits) / 8)
+
+  const rows = Math.floor(data.length / (rowLength + 1))
+  const output = Buffer.alloc(rows * rowLength)
+  let previous = Buffer.alloc(rowLength)
+  for (let row = 0; row < rows; row++) {
+    const filter = data[row * (rowLength + 1)]
+    const input = data.subarray(row * (rowLength + 1) + 1, (row + 1) * (rowLength + 1))
+    const current = output.subarray(row * rowLength, (row + 1) * rowLength)
+    for (let i = 0; i < rowLength; i++) {
+      const left = i >= bpp ? current[i - bpp] : 0
+      const up = previous[i]
+      const upLeft = i >= bpp ? previous[i - bpp] : 0
+      let value: number
+      switch (filter) {
+        case 0:
+          value = input[i]
+          break
+        case 1:
+          value = input[i] + left
+          break
+        case 2:
+          value = input[i] + up
+          break
+        case 3:
+          value = input[i] + Math.floor((left + up) / 2)
+          break
+        case 4: {
+          const p = left + up - upLeft
+          const pa = Math.abs(p - left)
+          const pb = Math.abs(p - up)
+          const pc = Math.abs(p - upLeft)
+          value = input[i] + (pa <= pb && pa <= pc ? left : pb <= pc ? up : upLeft)
+          break
+        }
+        default:
+          throw new PdfFormatError(`Unsupported PNG filter ${filter}`)
+      }
+      current[i] = value & 0xff
+    }
+    previous = current
+  }
+  return output
+}
+
+/**
+ * Formats a number for a PDF file (no exponents, at most 4 decimal places).
+ */
+export function formatNumber(value: number): string {
+  return Number.isInteger(value) ? String(value) : String(+value.toFixed(4))
+}
+
+/**
+ * Serializes a value (not a stream) as PDF syntax.
+ *
+ * @param value - Value to write
+ * @returns PDF syntax for the value
+ */
+export function serializeValue(value: PdfValue): string {
+  if (value === null) return "null"
+  if (typeof value === "boolean") return String(value)
+  if (typeof value === "number") return formatNumber(value)
+  if (value instanceof PdfName) return `/${value.name}`
+  if (value instanceof PdfString) return value.raw
+  if (value instanceof PdfRef) return `${value.num} ${value.gen} R`
+  if (Array.isArray(value)) return `[${value.map(serializeValue).join(" ")}]`
+  if (value instanceof PdfStream) {
+    throw new PdfFormatError("Streams can only be written as indirect objects")
+  }
+  const entries = [...value].map(([key, entry]) => `/${key} ${serializeValue(entry)}`)
+  return `<<${entries.join(" ")}>>`
+}
+
+/**
+ * A parsed PDF file, read lazily: objects are parsed the first time they are looked up.
+ */
+export class PdfDocument {
+  /** Dictionary of the newest trailer (or cross-reference stream) */
+  readonly trailer: PdfDict
+  /** Offset of the newest cross-reference section */
+  readonly startXref: number
+  /** Whether the newest cross-reference section is a stream */
+  readonly xrefIsStream: boolean
+
+  private readonly text: string
+  private readonly xref = new Map<number, XrefEntry>()
+  private readonly objects = new Map<number, PdfValue>()
+  private readonly objectStreams = new Map<number, { text: string; offsets: number[] }>()
+
+  /**
+   * Parses the cross-reference sections of a PDF file.
+   *
+   * @param data - The file's bytes
+   * @throws {PdfFormatError} If the file isn't a PDF or its cross-reference data can't be read
+   */
+  constructor(data: Buffer) {
+    this.data = data
+    this.text = data.toString("latin1")
+    if (!this.text.slice(0, 1024).includes("%PDF-")) {
+      throw new PdfFormatError("Not a PDF file")
+    }
+
+    const marker = this.text.lastIndexOf("startxref")
+    if (marker < 0) {
+      throw new PdfFormatError("No startxref")
+    }
+    const parser = new Parser(this.text, marker + "startxref".length)
+    this.startXref = parser.readInteger()
+
+    let trailer: PdfDict | undefined
+    let xrefIsStream = false
+    const seen = new Set<number>()
+    let offset: number | undefined = this.startXref
+    while (offset !== undefined && !seen.has(offset)) {
+      seen.add(offset)
+      const section = this.readXrefSection(offset)
+      if (!trailer) {
+        trailer = section.trailer
+        xrefIsStream = section.isStream
+      }
+      const prev = section.trailer.get("Prev")
+      offset = typeof prev === "number" ? prev : undefined
+    }
+    if (!trailer || !(trailer.get("Root") instanceof PdfRef)) {
+      throw new PdfFormatError("No document catalog in the trailer")
+    }
+    this.trailer = trailer
+    this.xrefIsStream = xrefIsStream
+  }
+
+  /** The file's bytes */
+  readonly data: Buffer
+
+  /** Highest object number in use, plus one. */
+  get size(): number {
+    const size = this.trailer.get("Size")
+    const highest = Math.max(0, ...this.xref.keys()) + 1
+    return typeof size === "number" ? Math.max(size, highest) : highest
+  }
+
+  /** Whether the document is encrypted. */
+  get encrypted(): boolean {
+    return this.trailer.has("Encrypt")
+  }
+
+  /**
+   * Reads one cross-reference section (a table and its trailer, or a stream), adding the
+   * entries not already set by a newer section.
+   */
+  private readXrefSection(offset: number): { trailer: PdfDict; isStream: boolean } {
+    const parser = new Parser(this.text, offset)
+    parser.skipWhitespace()
+
+    if (!this.text.startsWith("xref", parser.pos)) {
+      const stream = this.parseIndirectObject(offset).value
+      if (!(stream instanceof PdfStream) || nameOf(stream.dict.get("Type")) !== "XRef") {
+        throw new PdfFormatError(`No cross-reference section at byte ${offset}`)
+      }
+      this.addXrefStreamEntries(stream)
+      return { trailer: stream.dict, isStream: true }
+    }
+
+    parser.expectKeyword("xref")
+    for (;;) {
+      parser.skipWhitespace()
+      if (this.text.startsWith("trailer", parser.pos)) {
+        break
+      }
+      const first = parser.readInteger()
+      const count = parser.readInteger()
+      for (let i = 0; i < count; i++) {
+        const entryOffset = parser.readInteger()
+        const gen = parser.readInteger()
+        parser.skipWhitespace()
+        const type = parser.readToken()
+        if (type === "n" && !this.xref.has(first + i)) {
+          this.xref.set(first + i, { type: "offset", offset: entryOffset, gen })
+        }
+      }
+    }
+    parser.expectKeyword("trailer")
+    const trailer = parser.parseValue()
+    if (!isDict(trailer)) {
+      throw new PdfFormatError("Trailer is not a dictionary")
+    }
+
+    // Hybrid files list compressed objects in a cross-reference stream as well
+    const xrefStm = trailer.get("XRefStm")
+    if (typeof xrefStm === "number") {
+      const stream = this.parseIndirectObject(xrefStm).value
+      if (stream instanceof PdfStream) {
+        this.addXrefStreamEntries(stream)
+      }
+    }
+    return { trailer, isStream: false }
+  }
+
+  /**
+   * Adds the entries of a cross-reference stream.
+   */
+  private addXrefStreamEntries(stream: PdfStream): void {
+    const data = this.decodeStream(stream)
+    const widths = stream.dict.get("W")
+    if (!Array.isArray(widths) || widths.length !== 3 || !widths.every(Number.isInteger)) {
+      throw new PdfFormatError("Invalid /W in cross-reference stream")
+    }
+    const [w1, w2, w3] = widths as number[]
+    const size = stream.dict.get("Size") as number
+    const index = (stream.dict.get("Index") as number[] | undefined) ?? [0, size]
+
+    const field = (start: number, width: number) => {
+      let value = 0
+      for (let i = 0; i < width; i++) {
+        value = value * 256 + data[start + i]
+      }
+      return value
+    }
+
+    let pos = 0
+    for (let section = 0; section + 1 < index.length; section += 2) {
+      for (let i = 0; i < index[section + 1]; i++) {
+        const num = index[section] + i
+        const type = w1 === 0 ? 1 : field(pos, w1)
+        const f2 = field(pos + w1, w2)
+        const f3 = field(pos + w1 + w2, w3)
+        pos += w1 + w2 + w3
+        if (this.xref.has(num)) {
+          continue
+        }
+        if (type === 1) {
+          this.xref.set(num, { type: "offset", offset: f2, gen: f3 })
+        } else if (type === 2) {
+          this.xref.set(num, { type: "compressed", stream: f2, index: f3 })
+        }
+      }
+    }
+  }
+
+  /**
+   * Parses the indirect object at a byte offset.
+   */
+  private parseIndirectObject(offset: number): { num: number; gen: number; value: PdfValue } {
+    const parser = new Parser(this.text, offset)
+    const num = parser.readInteger()
+    const gen = parser.readInteger()
+    parser.expectKeyword("obj")
+    const value = parser.parseValue()
+
+    parser.skipWhitespace()
+    if (!isDict(value) || !this.text.startsWith("stream", parser.pos)) {
+      return { num, gen, value }
+    }
+
+    // Stream data starts after the end of the line with the stream keyword
+    let start = parser.pos + "stream".length
+    if (this.text[start] === "\r") start++
+    if (this.text[start] === "\n") start++
+
+    const length = this.resolve(value.get("Length") ?? null)
+    let end = typeof length === "number" ? start + length : -1
+    if (end < 0 || !/^\s*endstream/.test(this.text.slice(end, end + 64))) {
+      // The length is wrong or missing: the data runs to the endstream keyword
+      end = this.text.indexOf("endstream", start)
+      if (end < 0) {
+        throw new PdfFormatError(`Unterminated stream in object ${num}`)
+      }
+      while (end > start && "\r\n".includes(this.text[end - 1])) end--
+    }
+    return { num, gen, value: new PdfStream(value, this.data.subarray(start, end)) }
+  }
+
+  /**
+   * Decodes the data of a stream. Only FlateDecode (with or without a predictor) is
+   * supported, which is what cross-reference and object streams use.
+   *
+   * @param stream - Stream to decode
+   * @returns The decoded data
+   * @throws {PdfFormatError} If the stream uses another filter
+   */
+  decodeStream(stream: PdfStream): Buffer {
+    const filterValue = this.resolve(stream.dict.get("Filter") ?? null)
+    const filters = Array.isArray(filterValue) ? filterValue : filterValue ? [filterValue] : []
+    const paramsValue = this.resolve(stream.dict.get("DecodeParms") ?? null)
+    const params = Array.isArray(paramsValue) ? paramsValue : [paramsValue]
+
+    let data = stream.data
+    filters.forEach((filter, i) => {
+      const name = nameOf(filter)
+      if (name !== "FlateDecode" && name !== "Fl") {
+        throw new PdfFormatError(`Unsupported stream filter ${name}`)
+      }
+      const filterParams = this.resolve(params[i] ?? null)
+      data = unpredict(inflateSync(data), isDict(filterParams) ? filterParams : undefined)
+    })
+    return data
+  }
+
+  /**
+   * Looks up an indirect object.
+   *
+   * @param num - Object number
+   * @returns The object's value (null for objects that don't exist, as PDF readers treat them)
+   */
+  getObject(num: number): PdfValue {
+    if (this.objects.has(num)) {
+      return this.objects.get(num) as PdfValue
+    }
+    // Mark the object as being read, so a Length that refers back to it can't loop
+    this.objects.set(num, null)
+
+    const entry = this.xref.get(num)
+    let value: PdfValue = null
+    if (entry?.type === "offset") {
+      value = this.parseIndirectObject(entry.offset).value
+    } else if (entry?.type === "compressed") {
+      const objectStream = this.readObjectStream(entry.stream)
+      value = new Parser(objectStream.text, objectStream.offsets[entry.index]).parseValue()
+    }
+    this.objects.set(num, value)
+    return value
+  }
+
+  /**
+   * Reads and indexes an object stream.
+   */
+  private readObjectStream(num: number): { text: string; offsets: number[] } {
+    const cached = this.objectStreams.get(num)
+    if (cached) {
+      return cached
+    }
+    const stream = this.getObject(num)
+    if (!(stream instanceof PdfStream)) {
+      throw new PdfFormatError(`Object stream ${num} is missing`)
+    }
+    const text = this.decodeStream(stream).toString("latin1")
+    const count = stream.dict.get("N") as number
+    const first = stream.dict.get("First") as number
+    const header = new Parser(text)
+    const offsets: number[] = []
+    for (let i = 0; i < count; i++) {
+      header.readInteger()
+      offsets.push(first + header.readInteger())
+    }
+    const objectStream = { text, offsets }
+    this.objectStreams.set(num, objectStream)
+    return objectStream
+  }
+
+  /**
+   * Resolves a reference to the object it points to; other values are returned as they are.
+   *
+   * @param value - Value that may be a reference
+   * @returns The value, with a reference replaced by its object
+   */
+  resolve(value: PdfValue): PdfValue {
+    return value instanceof PdfRef ? this.getObject(value.num) : value
+  }
+
+  /**
+   * Generation number of an existing object (0 if it isn't in the cross-reference data).
+   */
+  generationOf(num: number): number {
+    const entry = this.xref.get(num)
+    return entry?.type === "offset" ? entry.gen : 0
+  }
+
+  /**
+   * Lists the pages of the document in order.
+   *
+   * @returns Each page's reference, dictionary, and inherited attributes
+   * @throws {PdfFormatError} If the page tree is missing or malformed
+   */
+  getPages(): PdfPage[] {
+    const catalog = this.resolve(this.trailer.get("Root") ?? null)
+    const root = isDict(catalog) ? catalog.get("Pages") : undefined
+    if (!(root instanceof PdfRef)) {
+      throw new PdfFormatError("No page tree in the document catalog")
+    }
+
+    const pages: PdfPage[] = []
+    const visited = new Set<number>()
+    const walk = (ref: PdfRef, inherited: PdfDict) => {
+      if (visited.has(ref.num)) {
+        throw new PdfFormatError(`Page tree loops back to object ${ref.num}`)
+      }
+      visited.add(ref.num)
+
+      const node = this.resolve(ref)
+      if (!isDict(node)) {
+        throw new PdfFormatError(`Page tree node ${ref.num} is not a dictionary`)
+      }
+      const kids = this.resolve(node.get("Kids") ?? null)
+      if (nameOf(node.get("Type")) === "Page" || !Array.isArray(kids)) {
+        pages.push({ ref, dict: node, inherited })
+        return
+      }
+
+      const attributes: PdfDict = new Map(inherited)
+      for (const key of INHERITED_KEYS) {
+        if (node.has(key)) {
+          attributes.set(key, node.get(key) as PdfValue)
+        }
+      }
+      for (const kid of kids) {
+        if (kid instanceof PdfRef) {
+          walk(kid, attributes)
+        }
+      }
+    }
+    walk(root, new Map())
+    return pages
+  }
+}
+
+/**
+ * An incremental update to a PDF: new objects and new versions of existing ones, written
+ * after the original file with a cross-reference section that points back to the original's.
+ */
+export class PdfUpdate {
+  private readonly document: PdfDocument
+  private readonly changes = new Map<number, { gen: number; value: PdfValue }>()
+  private nextNum: number
+
+  constructor(document: PdfDocument) {
+    this.document = document
+    this.nextNum = document.size
+  }
+
+  /**
+   * Adds a new object.
+   *
+   * @param value - The object (a stream's Length is filled in when it is written)
+   * @returns A reference to the object
+   */
+  add(value: PdfValue): PdfRef {
+    const ref = new PdfRef(this.nextNum++, 0)
+    this.changes.set(ref.num, { gen: 0, value })
+    return ref
+  }
+
+  /**
+   * Replaces an existing object.
+   *
+   * @param ref - Reference to the object
+   * @param value - Its new value
+   */
+  set(ref: PdfRef, value: PdfValue): void {
+    this.changes.set(ref.num, { gen: ref.gen, value })
+  }
+
+  /**
+   * Builds the updated file: the original bytes, the changed objects, and a new
+   * cross-reference section (a stream if the original's newest one is a stream).
+   *
+   * @returns The updated file's bytes
+   */
+  toBuffer(): Buffer {
+    const original = this.document.data
+    const chunks: Buffer[] = [original]
+    let length = original.length
+    const push = (chunk: Buffer | string) => {
+      const buffer = typeof chunk === "string" ? Buffer.from(chunk, "latin1") : chunk
+      chunks.push(buffer)
+      length += buffer.length
+    }
+    const lastByte = original[original.length - 1]
+    if (lastByte !== 0x0a && lastByte !== 0x0d) {
+      push("\n")
+    }
+
+    const offsets = new Map<number, { offset: number; gen: number }>()
+    for (const [num, { gen, value }] of [...this.changes].sort(([a], [b]) => a - b)) {
+      offsets.set(num, { offset: length, gen })
+      if (value instanceof PdfStream) {
+        const dict = new Map(value.dict).set("Length", value.data.length)
+        push(`${num} ${gen} obj\n${serializeValue(dict)}\nstream\n`)
+        push(value.data)
+        push("\nendstream\nendobj\n")
+      } else {
+        push(`${num} ${gen} obj\n${serializeValue(value)}\nendobj\n`)
+      }
+    }
+
+    const trailer: PdfDict = new Map()
+    for (const key of ["Root", "Info", "ID"]) {
+      const value = this.document.trailer.get(key)
+      if (value !== undefined) {
+        trailer.set(key, value)
+      }
+    }
+    trailer.set("Prev", this.document.startXref)
+
+    const xrefOffset = length
+    if (this.document.xrefIsStream) {
+      const xrefNum = this.nextNum++
+      offsets.set(xrefNum, { offset: xrefOffset, gen: 0 })
+      push(this.xrefStream(xrefNum, offsets, trailer))
+    } else {
+      trailer.set("Size", this.nextNum)
+      push(`xref\n${this.xrefTable(offsets)}trailer\n${serializeValue(trailer)}\n`)
+    }
+    push(`startxref\n${xrefOffset}\n%%EOF\n`)
+    return Buffer.concat(chunks, length)
+  }
+
+  /**
+   * Groups object numbers into runs of consecutive numbers.
+   */
+  private static subsections(nums: number[]): Array<[number, number]> {
+    const runs: Array<[number, number]> = []
+    for (const num of nums) {
+      const last = runs.at(-1)
+      if (last && last[0] + last[1] === num) {
+        last[1]++
+      } else {
+        runs.push([num, 1])
+      }
+    }
+    return runs
+  }
+
+  /**
+   * Builds the entries of a cross-reference table.
+   */
+  private xrefTable(offsets: Map<number, { offset: number; gen: number }>): string {
+    const nums = [...offsets.keys()].sort((a, b) => a - b)
+    return PdfUpdate.subsections(nums)
+      .map(([first, count]) => {
+        const entries = nums.slice(nums.indexOf(first), nums.indexOf(first) + count)
+        const lines = entries.map((num) => {
+          const { offset, gen } = offsets.get(num) as { offset: number; gen: number }
+          return `${String(offset).padStart(10, "0")} ${String(gen).padStart(5, "0")} n\r\n`
+        })
+        return `${first} ${count}\n${lines.join("")}`
+      })
+      .join("")
+  }
+
+  /**
+   * Builds a cross-reference stream object (uncompressed).
+   */
+  private xrefStream(
+    xrefNum: number,
+    offsets: Map<number, { offset: number; gen: number }>,
+    trailer: PdfDict
+  ): Buffer {
+    const nums = [...offsets.keys()].sort((a, b) => a - b)
+    const maxOffset = Math.max(...[...offsets.values()].map(({ offset }) => offset))
+    const offsetWidth = Math.max(4, Math.ceil(Math.log2(maxOffset + 1) / 8))
+    const rowWidth = 1 + offsetWidth + 2
+
+    const data = Buffer.alloc(nums.length * rowWidth)
+    nums.forEach((num, row) => {
+      const { offset, gen } = offsets.get(num) as { offset: number; gen: number }
+      const start = row * rowWidth
+      data[start] = 1
+      data.writeUIntBE(offset, start + 1, offsetWidth)
+      data.writeUInt16BE(gen, start + 1 + offsetWidth)
+    })
+
+    const dict: PdfDict = new Map<string, PdfValue>([
+      ["Type", new PdfName("XRef")],
+      ["Size", this.nextNum],
+      ["Index", PdfUpdate.subsections(nums).flat()],
+      ["W", [1, offsetWidth, 2]],
+      ...trailer,
+      ["Length", data.length],
+    ])
+    return Buffer.concat([
+      Buffer.from(`${xrefNum} 0 obj\n${serializeValue(dict)}\nstream\n`, "latin1"),
+      data,
+      Buffer.from("\nendstream\nendobj\n", "latin1"),
+    ])
+  }
+}
@@ -0,0 +1,130 @@
+/**
+ * @fileoverview Helvetica and Courier, standard PDF fonts, for text drawn straight into a PDF
+ * (watermarks, separator pages, and HTML laid out without Chrome). Every PDF reader has the
+ * fonts, so they need no embedding; text is encoded in WinAnsiEncoding and measured with the
+ * fonts' AFM metrics.
+ */
+
+import { WINDOWS_1252_HIGH } from "../renderers/encoding.js"
+import { PdfName, type PdfDict, type PdfValue } from "./document.js"
+
+/** Cap height of Helvetica Bold, in thousandths of the font size. */
+export const CAP_HEIGHT = 718
+
+/** Standard fonts text can be drawn in. Oblique widths are those of the upright font. */
+export type StandardFont =
+  | "Helvetica"
+  | "Helvetica-Bold"
+  | "Helvetica-Oblique"
+  | "Helvetica-BoldOblique"
+  | "Courier"
+
+/**
+ * Widths of the printable ASCII characters (space to ~) in Helvetica, in thousandths of the
+ * font size (from the font's AFM metrics).
+ */
+// prettier-ignore
+const HELVETICA_WIDTHS = [
+  278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+  556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+  1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+  667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+  333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+  556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+]
+
+/**
+ * Widths of the printable ASCII characters (space to ~) in Helvetica Bold, in thousandths of
+ * the font size (from the font's AFM metrics).
+ */
+// prettier-ignore
+const HELVETICA_BOLD_WIDTHS = [
+  278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+  556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+  975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+  667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+  333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+  611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+]
+
+/** Width used for accented and other non-ASCII characters in Helvetica Bold. */
+const DEFAULT_CHARACTER_WIDTH = 611
+
+/** Width used for accented and other non-ASCII characters in Helvetica. */
+const DEFAULT_REGULAR_WIDTH = 556
+
+/** Width of every character in Courier, which is monospaced. */
+const COURIER_WIDTH = 600
+
+/**
+ * Builds the font dictionary of a standard font in WinAnsiEncoding.
+ *
+ * @param font - Font to use
+ * @returns A font dictionary to add as an indirect object
+ */
+export function standardFont(font: StandardFont): PdfDict {
+  return new Map<string, PdfValue>([
+    ["Type", new PdfName("Font")],
+    ["Subtype", new PdfName("Type1")],
+    ["BaseFont", new PdfName(font)],
+    ["Encoding", new PdfName("WinAnsiEncoding")],
+  ])
+}
+
+/**
+ * Builds the font dictionary of Helvetica Bold in WinAnsiEncoding.
+ *
+ * @returns A font dictionary to add as an indirect object
+ */
+export function helveticaBoldFont(): PdfDict {
+  return standardFont("Helvetica-Bold")
+}
+
+/**
+ * Encodes text in WinAnsiEncoding, the encoding of the standard PDF fonts (Windows-1252, as
+ * far as printable characters go).
+ *
+ * @param text - Text to encode
+ * @param replacement - Character to encode in place of ones that can't be (default: none)
+ * @returns The encoded bytes, or undefined if a character can't be encoded and there's no
+ *   replacement
+ */
+export function encodeWinAnsi(text: string, replacement?: string): Buffer | undefined {
+  const bytes: number[] = []
+  for (const char of text) {
+    const code = char.codePointAt(0) ?? 0
+    const high = WINDOWS_1252_HIGH.indexOf(char)
+    if ((code >= 0x20 && code < 0x7f) || (code >= 0xa0 && code <= 0xff)) {
+      bytes.push(code)
+    } else if (high >= 0 && char.charCodeAt(0) > 0xff) {
+      bytes.push(0x80 + high)
+    } else if (replacement) {
+      bytes.push(replacement.charCodeAt(0))
+    } else {
+      return undefined
+    }
+  }
+  return Buffer.from(bytes)
+}
+
+/**
+ * Measures text in a standard font.
+ *
+ * @param text - Text to measure
+ * @param font - Font the text is drawn in (default: Helvetica Bold)
+ * @returns Width in thousandths of the font size
+ */
+export function measureText(text: string, font: StandardFont = "Helvetica-Bold"): number {
+  if (font === "Courier") {
+    return [...text].length * COURIER_WIDTH
+  }
+  const bold = font === "Helvetica-Bold" || font === "Helvetica-BoldOblique"
+  const widths = bold ? HELVETICA_BOLD_WIDTHS : HELVETICA_WIDTHS
+  const fallback = bold ? DEFAULT_CHARACTER_WIDTH : DEFAULT_REGULAR_WIDTH
+  let width = 0
+  for (const char of text) {
+    const code = char.charCodeAt(0)
+    width += code >= 0x20 && code < 0x7f ? widths[code - 0x20] : fallback
+  }
+  return width
+}
@@ -0,0 +1,208 @@
+/**
+ * @fileoverview Image XObjects for PDFs written without Chrome.
+ * JPEGs are embedded as they are (PDF readers decode them with DCTDecode). PNGs keep their
+ * compressed data when they have no alpha channel, using the PNG predictors PDF supports;
+ * PNGs with alpha are unfiltered and split into color and a soft mask. Interlaced and 16-bit
+ * PNGs with alpha, CMYK JPEGs, and other formats (GIF, WebP) can't be embedded.
+ */
+
+import { deflateSync, inflateSync } from "zlib"
+import { PdfName, PdfStream, PdfString, type PdfDict, type PdfValue } from "./document.js"
+
+/**
+ * An image ready to be added to a PDF.
+ */
+export interface PdfImage {
+  /** Width in pixels */
+  width: number
+  /** Height in pixels */
+  height: number
+  /** The image XObject */
+  stream: PdfStream
+  /** Soft mask holding the image's alpha channel, which the XObject's SMask must refer to */
+  mask?: PdfStream
+}
+
+/**
+ * Builds the dictionary of an image XObject.
+ */
+function imageDict(
+  width: number,
+  height: number,
+  colorSpace: PdfValue,
+  bitsPerComponent: number,
+  filter: string
+): PdfDict {
+  return new Map<string, PdfValue>([
+    ["Type", new PdfName("XObject")],
+    ["Subtype", new PdfName("Image")],
+    ["Width", width],
+    ["Height", height],
+    ["ColorSpace", colorSpace],
+    ["BitsPerComponent", bitsPerComponent],
+    ["Filter", new PdfName(filter)],
+  ])
+}
+
+/**
+ * Embeds a grayscale or RGB JPEG, reading its size and components from the frame header.
+ */
+function jpegImage(data: Buffer): PdfImage | undefined {
+  let offset = 2
+  while (offset + 4 <= data.length && data[offset] === 0xff) {
+    const marker = data[offset + 1]
+    const isStartOfFrame =
+      marker >= 0xc0 && marker <= 0xcf && marker !== 0xc4 && marker !== 0xc8 && marker !== 0xcc
+    if (isStartOfFrame && offset + 10 <= data.length) {
+      const height = data.readUInt16BE(offset + 5)
+      const width = data.readUInt16BE(offset + 7)
+      const components = data[offset + 9]
+      if (components !== 1 && components !== 3) {
+        return undefined
+      }
+      const space = new PdfName(components === 1 ? "DeviceGray" : "DeviceRGB")
+      const dict = imageDict(width, height, space, 8, "DCTDecode")
+      return { width, height, stream: new PdfStream(dict, data) }
+    }
+    offset += 2 + data.readUInt16BE(offset + 2)
+  }
+  return undefined
+}
+
+/**
+ * Reverses the PNG filter of each scanline.
+ */
+function unfilterPng(data: Buffer, rowBytes: number, pixelBytes: number, height: number): Buffer {
+  const output = Buffer.alloc(rowBytes * height)
+  for (let row = 0; row < height; row++) {
+    const filter = data[row * (rowBytes + 1)]
+    const input = row * (rowBytes + 1) + 1
+    const start = row * rowBytes
+    for (let i = 0; i < rowBytes; i++) {
+      const left = i >= pixelBytes ? output[start + i - pixelBytes] : 0
+      const up = row > 0 ? output[start + i - rowBytes] : 0
+      const upLeft = row > 0 && i >= pixelBytes ? output[start + i - rowBytes - pixelBytes] : 0
+      let predicted = 0
+      if (filter === 1) {
+        predicted = left
+      } else if (filter === 2) {
+        predicted = up
+      } else if (filter === 3) {
+        predicted = (left + up) >> 1
+      } else if (filter === 4) {
+        const estimate = left + up - upLeft
+        const [a, b, c] = [estimate - left, estimate - up, estimate - upLeft].map(Math.abs)
+        predicted = a <= b && a <= c ? left : b <= c ? up : upLeft
+      }
+      output[start + i] = (data[input + i] + predicted) & 0xff
+    }
+  }
+  return output
+}
+
+/**
+ * Embeds a PNG: grayscale, RGB, and palette images keep their compressed data; grayscale and
+ * RGB images with alpha are split into color and a soft mask.
+ */
+function pngImage(data: Buffer): PdfImage | undefined {
+  let header = { width: 0, height: 0, depth: 0, type: -1, interlace: 0 }
+  let palette: Buffer | undefined
+  const idat: Buffer[] = []
+  for (let offset = 8; offset + 8 <= data.length; ) {
+    const length = data.readUInt32BE(offset)
+    const type = data.toString("latin1", offset + 4, offset + 8)
+    const chunk = data.subarray(offset + 8, offset + 8 + length)
+    if (type === "IHDR" && chunk.length >= 13) {
+      header = {
+        width: chunk.readUInt32BE(0),
+        height: chunk.readUInt32BE(4),
+        depth: chunk[8],
+        type: chunk[9],
+        interlace: chunk[12],
+      }
+    } else if (type === "PLTE") {
+      palette = chunk
+    } else if (type === "IDAT") {
+      idat.push(chunk)
+    } else if (type === "IEND") {
+      break
+    }
+    offset += 12 + length
+  }
+
+  const { width, height, depth, type, interlace } = header
+  const colors = type === 2 || type === 6 ? 3 : 1
+  if (width === 0 || height === 0 || interlace !== 0 || idat.length === 0) {
+    return undefined
+  }
+  // RGB images may carry a suggested palette, which isn't used
+  const indexed = type === 3 ? palette : undefined
+  if (type === 3 && !indexed) {
+    return undefined
+  }
+  const space: PdfValue = indexed
+    ? [
+        new PdfName("Indexed"),
+        new PdfName("DeviceRGB"),
+        Math.floor(indexed.length / 3) - 1,
+        new PdfString(`<${indexed.toString("hex")}>`),
+      ]
+    : new PdfName(colors === 3 ? "DeviceRGB" : "DeviceGray")
+
+  if (type === 0 || type === 2 || type === 3) {
+    const dict = imageDict(width, height, space, depth, "FlateDecode")
+    dict.set(
+      "DecodeParms",
+      new Map<string, PdfValue>([
+        ["Predictor", 15],
+        ["Colors", colors],
+        ["BitsPerComponent", depth],
+        ["Columns", width],
+      ])
+    )
+    return { width, height, stream: new PdfStream(dict, Buffer.concat(idat)) }
+  }
+  if ((type !== 4 && type !== 6) || depth !== 8) {
+    return undefined
+  }
+
+  // Alpha isn't a PDF color component, so each pixel is split into color and mask bytes
+  const pixelBytes = colors + 1
+  const filtered = inflateSync(Buffer.concat(idat))
+  const pixels = unfilterPng(filtered, width * pixelBytes, pixelBytes, height)
+  const color = Buffer.alloc(width * height * colors)
+  const alpha = Buffer.alloc(width * height)
+  for (let i = 0; i < width * height; i++) {
+    pixels.copy(color, i * colors, i * pixelBytes, i * pixelBytes + colors)
+    alpha[i] = pixels[i * pixelBytes + colors]
+  }
+  return {
+    width,
+    height,
+    stream: new PdfStream(imageDict(width, height, space, 8, "FlateDecode"), deflateSync(color)),
+    mask: new PdfStream(
+      imageDict(width, height, new PdfName("DeviceGray"), 8, "FlateDecode"),
+      deflateSync(alpha)
+    ),
+  }
+}
+
+/**
+ * Builds an image XObject from a JPEG or PNG file's contents.
+ *
+ * @param data - Image file contents
+ * @returns The image, or undefined if it isn't a JPEG or PNG that can be embedded
+ */
+export function pdfImage(data: Buffer): PdfImage | undefined {
+  try {
+    if (data.length >= 4 && data[0] === 0xff && data[1] === 0xd8) {
+      return jpegImage(data)
+    }
+    if (data.length >= 8 && data.toString("latin1", 0, 8) === "\x89PNG\r\n\x1a\n") {
+      return pngImage(data)
+    }
+  } catch {
+    // Truncated or corrupt data
+  }
+  return undefined
+}
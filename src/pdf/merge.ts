@@ -0,0 +1,337 @@
+/**
+ * @fileoverview Merging PDFs into one file.
+ *
+ * Each document's pages are copied into a new file with every object they use (content
+ * streams, fonts, images, annotations), renumbered so documents can't collide. Streams are
+ * copied as they are, still compressed, so nothing is re-rendered:
+ *
+ * 1. **Pages**: A page takes along the attributes it inherited from its document's page tree
+ *    (resources, media box, rotation), since the merged file has a page tree of its own.
+ *
+ * 2. **Links**: References between copied objects are kept, so annotations that point at
+ *    another page land on the copy of that page. References to a document's catalog or page
+ *    tree are dropped.
+ *
+ * 3. **Forms**: Form fields of every document are collected in the merged file's form.
+ *
+ * Pages can also be copied as form XObjects instead, to be drawn at any size and position on
+ * pages of the merged file (as booklets are imposed).
+ */
+
+import {
+  PdfDocument,
+  PdfName,
+  PdfRef,
+  PdfStream,
+  isDict,
+  serializeValue,
+  type PdfDict,
+  type PdfPage,
+  type PdfValue,
+} from "./document.js"
+
+/** Box of pages that have no usable crop or media box (US Letter). */
+const DEFAULT_PAGE_BOX = [0, 0, 612, 792]
+
+/**
+ * A page copied as a form XObject.
+ */
+export interface PageForm {
+  /** The form */
+  form: PdfRef
+  /** The page's crop box [left, bottom, right, top], which is the form's bounding box */
+  box: number[]
+  /** The page's /Rotate (0, 90, 180, or 270), which the form doesn't apply */
+  rotate: number
+}
+
+/**
+ * Lists a document's catalog and page tree nodes, which aren't copied: the merged file has its
+ * own.
+ *
+ * @returns The objects' numbers, mapped to null
+ */
+function excludedTreeObjects(document: PdfDocument, pages: PdfPage[]): Map<number, PdfRef | null> {
+  const excluded = new Map<number, PdfRef | null>()
+  const root = document.trailer.get("Root")
+  if (root instanceof PdfRef) {
+    excluded.set(root.num, null)
+  }
+  for (const page of pages) {
+    let parent = page.dict.get("Parent")
+    while (parent instanceof PdfRef && !excluded.has(parent.num)) {
+      excluded.set(parent.num, null)
+      const node = document.resolve(parent)
+      parent = isDict(node) ? node.get("Parent") : undefined
+    }
+  }
+  return excluded
+}
+
+/**
+ * Normalizes a page box to [left, bottom, right, top].
+ *
+ * @returns The box, or undefined if the value isn't one
+ */
+function pageBox(document: PdfDocument, value: PdfValue): number[] | undefined {
+  const box = document.resolve(value)
+  if (!Array.isArray(box) || box.length !== 4) {
+    return undefined
+  }
+  const coordinates = box.map((coordinate) => document.resolve(coordinate))
+  if (!coordinates.every((coordinate) => typeof coordinate === "number")) {
+    return undefined
+  }
+  const [x1, y1, x2, y2] = coordinates as number[]
+  return [Math.min(x1, x2), Math.min(y1, y2), Math.max(x1, x2), Math.max(y1, y2)]
+}
+
+/**
+ * Builds a PDF out of the pages of other PDFs, and pages drawn for it.
+ */
+export class PdfMerger {
+  /** Objects by number, from 1; the catalog and page tree are written last */
+  private readonly objects: PdfValue[] = [null, null]
+  private readonly catalogRef = new PdfRef(1, 0)
+  private readonly pagesRef = new PdfRef(2, 0)
+  private readonly pageRefs: PdfRef[] = []
+  private readonly fields: PdfValue[] = []
+  private form: PdfDict | undefined
+
+  /** Number of pages added so far. */
+  get pageCount(): number {
+    return this.pageRefs.length
+  }
+
+  /**
+   * Adds an object.
+   *
+   * @param value - The object (a stream's Length is filled in when it is written)
+   * @returns A reference to the object
+   */
+  add(value: PdfValue): PdfRef {
+    this.objects.push(value)
+    return new PdfRef(this.objects.length, 0)
+  }
+
+  /**
+   * Adds a page drawn for the merged file.
+   *
+   * @param dict - The page's dictionary, without /Type and /Parent
+   */
+  addPage(dict: PdfDict): void {
+    const page: PdfDict = new Map<string, PdfValue>([
+      ["Type", new PdfName("Page")],
+      ["Parent", this.pagesRef],
+    ])
+    for (const [key, value] of dict) {
+      page.set(key, value)
+    }
+    this.pageRefs.push(this.add(page))
+  }
+
+  /**
+   * Copies every page of a document, in order.
+   *
+   * @param document - The document to copy
+   * @returns The number of pages copied
+   * @throws {PdfFormatError} If the document's page tree can't be read
+   */
+  appendDocument(document: PdfDocument): number {
+    const pages = document.getPages()
+    const copies = excludedTreeObjects(document, pages)
+
+    // Pages are numbered first, so references to them from other pages' annotations resolve
+    const pageRefs = pages.map((page) => {
+      const ref = this.add(null)
+      copies.set(page.ref.num, ref)
+      return ref
+    })
+    const { copy, copyDict, finish } = this.copier(document, copies)
+
+    pages.forEach((page, i) => {
+      const dict: PdfDict = new Map()
+      for (const [key, value] of [...page.inherited, ...page.dict]) {
+        if (key !== "Parent") {
+          dict.set(key, copy(value))
+        }
+      }
+      dict.set("Parent", this.pagesRef)
+      this.objects[pageRefs[i].num - 1] = dict
+      this.pageRefs.push(pageRefs[i])
+    })
+
+    const root = document.trailer.get("Root")
+    const catalog = document.resolve(root ?? null)
+    const form = isDict(catalog) ? document.resolve(catalog.get("AcroForm") ?? null) : null
+    if (isDict(form)) {
+      const fields = document.resolve(form.get("Fields") ?? null)
+      if (Array.isArray(fields)) {
+        this.fields.push(...fields.map(copy))
+      }
+      // Default appearances and resources come from the first document with a form
+      this.form ??= copyDict(new Map([...form].filter(([key]) => key !== "Fields")))
+    }
+
+    finish()
+    return pages.length
+  }
+
+  /**
+   * Copies every page of a document as a form XObject, to be drawn on pages of the merged
+   * file (e.g., two to a sheet). The form shows the page's crop box; its annotations and form
+   * fields aren't copied. Content split over several streams is decoded and joined, since a
+   * form has a single stream.
+   *
+   * @param document - The document to copy
+   * @returns Each page's form, in order, with its box and rotation
+   * @throws {PdfFormatError} If the document's page tree can't be read, or split content uses a
+   *   filter this module can't decode
+   */
+  appendPageForms(document: PdfDocument): PageForm[] {
+    const pages = document.getPages()
+    const copies = excludedTreeObjects(document, pages)
+    for (const page of pages) {
+      copies.set(page.ref.num, null)
+    }
+    const { copy, finish } = this.copier(document, copies)
+
+    const forms = pages.map((page) => {
+      const attribute = (key: string) => page.dict.get(key) ?? page.inherited.get(key) ?? null
+      const box =
+        pageBox(document, attribute("CropBox")) ??
+        pageBox(document, attribute("MediaBox")) ??
+        DEFAULT_PAGE_BOX
+      const rotateValue = document.resolve(attribute("Rotate"))
+      const rotate =
+        typeof rotateValue === "number"
+          ? (((Math.round(rotateValue / 90) * 90) % 360) + 360) % 360
+          : 0
+
+      const dict: PdfDict = new Map<string, PdfValue>([
+        ["Type", new PdfName("XObject")],
+        ["Subtype", new PdfName("Form")],
+        ["BBox", box],
+        ["Resources", copy(attribute("Resources")) ?? new Map()],
+      ])
+      const contents = document.resolve(page.dict.get("Contents") ?? null)
+      let data = Buffer.alloc(0)
+      if (contents instanceof PdfStream) {
+        // A single stream is copied as it is, still compressed
+        for (const key of ["Filter", "DecodeParms"]) {
+          if (contents.dict.has(key)) {
+            dict.set(key, copy(contents.dict.get(key) as PdfValue))
+          }
+        }
+        data = contents.data
+      } else if (Array.isArray(contents)) {
+        const streams = contents
+          .map((part) => document.resolve(part))
+          .filter((part): part is PdfStream => part instanceof PdfStream)
+        data = Buffer.concat(
+          streams.flatMap((part) => [document.decodeStream(part), Buffer.from("\n")])
+        )
+      }
+      return { form: this.add(new PdfStream(dict, data)), box, rotate }
+    })
+
+    finish()
+    return forms
+  }
+
+  /**
+   * Creates the functions that copy a document's values into the merged file. Each reference
+   * copied gets a new object number; the objects themselves are copied by finish, breadth
+   * first (long chains can't overflow the stack).
+   *
+   * @param document - The document values are copied from
+   * @param copies - Objects already copied (or left out, as null), by their number
+   */
+  private copier(document: PdfDocument, copies: Map<number, PdfRef | null>) {
+    const pending: Array<[number, PdfRef]> = []
+
+    const copy = (value: PdfValue): PdfValue => {
+      if (value instanceof PdfRef) {
+        if (!copies.has(value.num)) {
+          const ref = this.add(null)
+          copies.set(value.num, ref)
+          pending.push([value.num, ref])
+        }
+        return copies.get(value.num) ?? null
+      }
+      if (value instanceof PdfStream) {
+        // The Length is written with the data, so a Length object isn't copied
+        const dict = new Map([...value.dict].filter(([key]) => key !== "Length"))
+        return new PdfStream(copyDict(dict), value.data)
+      }
+      if (Array.isArray(value)) {
+        return value.map(copy)
+      }
+      return isDict(value) ? copyDict(value) : value
+    }
+    const copyDict = (dict: PdfDict): PdfDict =>
+      new Map([...dict].map(([key, entry]) => [key, copy(entry)]))
+
+    const finish = () => {
+      for (let i = 0; i < pending.length; i++) {
+        const [num, ref] = pending[i]
+        this.objects[ref.num - 1] = copy(document.getObject(num))
+      }
+      pending.length = 0
+    }
+    return { copy, copyDict, finish }
+  }
+
+  /**
+   * Writes the merged file.
+   *
+   * @returns The file's bytes
+   */
+  toBuffer(): Buffer {
+    const catalog: PdfDict = new Map<string, PdfValue>([
+      ["Type", new PdfName("Catalog")],
+      ["Pages", this.pagesRef],
+    ])
+    if (this.form || this.fields.length > 0) {
+      catalog.set("AcroForm", new Map([...(this.form ?? []), ["Fields", this.fields]]))
+    }
+    this.objects[this.catalogRef.num - 1] = catalog
+    this.objects[this.pagesRef.num - 1] = new Map<string, PdfValue>([
+      ["Type", new PdfName("Pages")],
+      ["Kids", this.pageRefs],
+      ["Count", this.pageRefs.length],
+    ])
+
+    const chunks: Buffer[] = []
+    let length = 0
+    const push = (chunk: Buffer | string) => {
+      const buffer = typeof chunk === "string" ? Buffer.from(chunk, "latin1") : chunk
+      chunks.push(buffer)
+      length += buffer.length
+    }
+
+    push("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+    const offsets: number[] = []
+    this.objects.forEach((value, i) => {
+      offsets.push(length)
+      if (value instanceof PdfStream) {
+        const dict = new Map(value.dict).set("Length", value.data.length)
+        push(`${i + 1} 0 obj\n${serializeValue(dict)}\nstream\n`)
+        push(value.data)
+        push("\nendstream\nendobj\n")
+      } else {
+        push(`${i + 1} 0 obj\n${serializeValue(value)}\nendobj\n`)
+      }
+    })
+
+    const xrefOffset = length
+    const entries = offsets.map((offset) => `${String(offset).padStart(10, "0")} 00000 n\r\n`)
+    const trailer = new Map<string, PdfValue>([
+      ["Size", this.objects.length + 1],
+      ["Root", this.catalogRef],
+    ])
+    push(`xref\n0 ${this.objects.length + 1}\n0000000000 65535 f\r\n${entries.join("")}`)
+    push(`trailer\n${serializeValue(trailer)}\nstartxref\n${xrefOffset}\n%%EOF\n`)
+    return Buffer.concat(chunks, length)
+  }
+}
@@ -0,0 +1,136 @@
+/**
+ * @fileoverview Dry-run previews for the print tools.
+ * Saves the document that would have been sent to the printer (after rendering) to the
+ * preview directory, with its page count and an optional first-page thumbnail.
+ */
+
+import { copyFile, mkdir, readFile, writeFile } from "fs/promises"
+import { extname, join } from "path"
+import { randomBytes } from "crypto"
+import { PDFParse } from "pdf-parse"
+import { config } from "./config.js"
+import { getPdfPageCount } from "./utils.js"
+
+/** Width of preview thumbnails, in pixels. */
+const THUMBNAIL_WIDTH = 600
+
+/**
+ * A saved dry-run preview.
+ */
+export interface Preview {
+  /** Path of the saved preview file */
+  path: string
+  /** Page count, when the preview is a PDF */
+  pages?: number
+  /** PNG of the first page, when requested and the preview is a PDF */
+  thumbnail?: Buffer
+}
+
+/**
+ * Builds a unique preview filename from a document name, keeping the given extension.
+ */
+function previewFilename(name: string, extension: string): string {
+  const stem = name.replace(/\.[^.]*$/, "").replace(/[^\w.-]+/g, "_") || "document"
+  const suffix = randomBytes(4).toString("hex")
+  return `${stem}-${suffix}${extension}`
+}
+
+/**
+ * Renders the first page of a PDF to PNG.
+ *
+ * @param pdfPath - Path to the PDF
+ * @returns PNG image data
+ * @throws {Error} If the PDF cannot be rendered
+ */
+export async function renderPdfThumbnail(pdfPath: string): Promise<Buffer> {
+  const parser = new PDFParse({ data: await readFile(pdfPath) })
+  try {
+    const result = await parser.getScreenshot({
+      partial: [1],
+      desiredWidth: THUMBNAIL_WIDTH,
+      imageDataUrl: false,
+    })
+    const page = result.pages[0]
+    if (!page) {
+      throw new Error("PDF has no pages")
+    }
+    return Buffer.from(page.data)
+  } finally {
+    await parser.destroy()
+  }
+}
+
+/**
+ * Describes a saved file: page count and thumbnail for PDFs, nothing extra otherwise.
+ */
+async function describePreview(path: string, includeThumbnail: boolean): Promise<Preview> {
+  let pages: number
+  try {
+    pages = await getPdfPageCount(path)
+  } catch {
+    // Not a PDF (plain text, images) - there's no page count to report
+    return { path }
+  }
+
+  if (!includeThumbnail) {
+    return { path, pages }
+  }
+
+  try {
+    return { path, pages, thumbnail: await renderPdfThumbnail(path) }
+  } catch {
+    // A missing thumbnail shouldn't fail the dry run
+    return { path, pages }
+  }
+}
+
+/**
+ * Saves a copy of a file that would have been printed into the preview directory.
+ *
+ * @param filePath - File that would have been sent to the printer (original or rendered PDF)
+ * @param name - Document name to base the preview filename on
+ * @param includeThumbnail - Whether to render the first page as a PNG
+ * @returns The saved preview
+ */
+export async function savePreview(
+  filePath: string,
+  name: string,
+  includeThumbnail = false
+): Promise<Preview> {
+  await mkdir(config.previewDir, { recursive: true })
+  const path = join(config.previewDir, previewFilename(name, extname(filePath)))
+  await copyFile(filePath, path)
+  return describePreview(path, includeThumbnail)
+}
+
+/**
+ * Saves text content that would have been printed into the preview directory.
+ *
+ * @param content - Text that would have been sent to the printer
+ * @param name - Document name to base the preview filename on
+ * @returns The saved preview
+ */
+export async function saveTextPreview(content: string, name: string): Promise<Preview> {
+  await mkdir(config.previewDir, { recursive: true })
+  const path = join(config.previewDir, previewFilename(name, ".txt"))
+  await writeFile(path, content)
+  return { path }
+}
+
+/**
+ * Builds the image content block for a preview thumbnail, if there is one.
+ *
+ * @param preview - Saved preview
+ * @returns MCP image content (empty when the preview has no thumbnail)
+ */
+export function thumbnailContent(preview: Preview) {
+  return preview.thumbnail
+    ? [
+        {
+          type: "image" as const,
+          data: preview.thumbnail.toString("base64"),
+          mimeType: "image/png",
+        },
+      ]
+    : []
+}
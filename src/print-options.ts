@@ -0,0 +1,313 @@
+/**
+ * @fileoverview Typed print job options (copies, duplex, page ranges, media size, pages per sheet,
+ * color mode, quality, holding, orientation).
+ * Validates tool input before anything is sent to CUPS and translates it into lp options.
+ */
+
+import type { PageOrientation } from "./renderers/page-layout.js"
+
+/** Maximum copies accepted by the print tools for a single job. */
+export const MAX_COPIES_PER_JOB = 100
+
+/** Supported duplex modes. */
+export const DUPLEX_MODES = ["long-edge", "short-edge", "none"] as const
+export type DuplexMode = (typeof DUPLEX_MODES)[number]
+
+/** Supported media sizes (CUPS media names). */
+export const MEDIA_SIZES = ["A4", "Letter", "Legal"] as const
+export type MediaSize = (typeof MEDIA_SIZES)[number]
+
+/** Supported pages per sheet (N-up). */
+export const NUMBER_UP_VALUES = [1, 2, 4, 6, 9, 16] as const
+export type NumberUp = (typeof NUMBER_UP_VALUES)[number]
+
+/** Supported color modes (IPP print-color-mode keywords). */
+export const COLOR_MODES = ["color", "monochrome", "auto"] as const
+export type ColorMode = (typeof COLOR_MODES)[number]
+
+/** Supported print quality levels. */
+export const QUALITY_LEVELS = ["draft", "normal", "high"] as const
+export type QualityLevel = (typeof QUALITY_LEVELS)[number]
+
+/** IPP print-quality enum value of each quality level (RFC 8011). */
+export const PRINT_QUALITY_VALUES: Record<QualityLevel, number> = {
+  draft: 3,
+  normal: 4,
+  high: 5,
+}
+
+/**
+ * job-hold-until keywords accepted by hold_until (RFC 8011). The printing system decides when
+ * each period (e.g., "evening") starts.
+ */
+export const HOLD_UNTIL_KEYWORDS = [
+  "indefinite",
+  "day-time",
+  "evening",
+  "night",
+  "weekend",
+  "second-shift",
+  "third-shift",
+] as const
+export type HoldUntilKeyword = (typeof HOLD_UNTIL_KEYWORDS)[number]
+
+/**
+ * Matches RFC 3339 date-times (e.g., "2026-10-14T18:30:00Z" or "2026-10-14T18:30:00-04:00").
+ */
+const RFC3339_PATTERN =
+  /^\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})$/
+
+/** Furthest ahead a hold_until time can be: CUPS holds until the next time the clock shows it. */
+const MAX_HOLD_MS = 24 * 60 * 60 * 1000
+
+/**
+ * Job options that only ask the printer for a preference. A printer that rejects them still
+ * gets the job, without them.
+ */
+export const OPTIONAL_CUPS_OPTIONS = ["print-color-mode", "print-quality"] as const
+
+/** Portrait width and height of each media size, in PostScript points (1/72 inch). */
+export const MEDIA_DIMENSIONS: Record<MediaSize, { width: number; height: number }> = {
+  A4: { width: 595.28, height: 841.89 },
+  Letter: { width: 612, height: 792 },
+  Legal: { width: 612, height: 1008 },
+}
+
+/**
+ * Typed print options accepted by the print tools.
+ */
+export interface PrintJobOptions {
+  /** Number of copies (1-100) */
+  copies?: number
+  /** Duplex mode, mapped to the CUPS `sides` option */
+  duplex?: DuplexMode
+  /** Pages to print, e.g. "1-3,7" */
+  page_ranges?: string
+  /** Paper size */
+  media?: MediaSize
+  /** Pages per sheet, mapped to the CUPS `number-up` option */
+  number_up?: NumberUp
+  /** Color or grayscale, mapped to the CUPS `print-color-mode` option */
+  color_mode?: ColorMode
+  /** Print quality, mapped to the CUPS `print-quality` option */
+  quality?: QualityLevel
+  /** Hold the job until it is released with release_job (`job-hold-until=indefinite`) */
+  hold?: boolean
+  /** When to release the job: an RFC 3339 time or a job-hold-until keyword (implies hold) */
+  hold_until?: string
+  /** Start the job with a cover page naming its owner (default: MCP_PRINTER_COVER_PAGE) */
+  cover_page?: boolean
+  /**
+   * Orientation the printer turns the pages to (`-o landscape` or `-o portrait`), for PDFs
+   * printed as they are; rendered documents are laid out in theirs (see renderers/page-layout.ts)
+   */
+  orientation?: PageOrientation
+}
+
+/**
+ * Maps duplex modes to CUPS `sides` values.
+ */
+const SIDES_BY_DUPLEX: Record<DuplexMode, string> = {
+  "long-edge": "two-sided-long-edge",
+  "short-edge": "two-sided-short-edge",
+  none: "one-sided",
+}
+
+/** Matches page range lists like "1-3,7" (whitespace already removed). */
+const PAGE_RANGES_PATTERN = /^\d+(-\d+)?(,\d+(-\d+)?)*$/
+
+/**
+ * Parses a page range list into [first, last] pairs.
+ *
+ * @param pageRanges - Page range list (e.g., "1-3,7"); whitespace is ignored
+ * @returns Array of inclusive [first, last] page pairs
+ * @throws {Error} If the syntax is malformed, a page is 0, or a range is descending
+ */
+export function parsePageRanges(pageRanges: string): Array<[number, number]> {
+  const normalized = pageRanges.replace(/\s+/g, "")
+  if (!PAGE_RANGES_PATTERN.test(normalized)) {
+    throw new Error(
+      `Invalid page_ranges "${pageRanges}": use page numbers and ranges separated by commas, ` +
+        `e.g. "1-3,7".`
+    )
+  }
+
+  return normalized.split(",").map((range) => {
+    const [first, last = first] = range.split("-").map((page) => parseInt(page, 10))
+    if (first < 1) {
+      throw new Error(`Invalid page_ranges "${pageRanges}": page numbers start at 1.`)
+    }
+    if (last < first) {
+      throw new Error(
+        `Invalid page_ranges "${pageRanges}": range "${range}" ends before it starts.`
+      )
+    }
+    return [first, last]
+  })
+}
+
+/**
+ * Resolves a hold_until value to a CUPS job-hold-until value.
+ * Keywords are passed through; RFC 3339 times become the UTC time of day ("HH:MM:SS") that
+ * lp -H takes, so they must be in the next 24 hours.
+ *
+ * @param holdUntil - A keyword (e.g., "evening") or an RFC 3339 time
+ * @param now - Current time (default: now)
+ * @returns The job-hold-until value (e.g., "evening" or "22:30:00")
+ * @throws {Error} If the value is neither, or the time is not in the next 24 hours
+ */
+export function resolveHoldUntil(holdUntil: string, now: Date = new Date()): string {
+  const value = holdUntil.trim()
+  const keyword = value.toLowerCase()
+  if ((HOLD_UNTIL_KEYWORDS as readonly string[]).includes(keyword)) {
+    return keyword
+  }
+
+  const time = RFC3339_PATTERN.test(value) ? new Date(value) : undefined
+  if (!time || Number.isNaN(time.getTime())) {
+    throw new Error(
+      `Invalid hold_until "${holdUntil}": use an RFC 3339 time (e.g., "2026-10-14T18:30:00Z") ` +
+        `or one of ${HOLD_UNTIL_KEYWORDS.join(", ")}.`
+    )
+  }
+  const delay = time.getTime() - now.getTime()
+  if (delay <= 0 || delay > MAX_HOLD_MS) {
+    throw new Error(
+      `Invalid hold_until "${holdUntil}": the time must be in the next 24 hours. ` +
+        `Use hold to keep the job until it is released.`
+    )
+  }
+  return time.toISOString().slice(11, 19)
+}
+
+/**
+ * Checks whether a number of pages per sheet is supported.
+ *
+ * @param value - Pages per sheet
+ * @returns True for 1, 2, 4, 6, 9, and 16
+ */
+export function isNumberUp(value: number): value is NumberUp {
+  return (NUMBER_UP_VALUES as readonly number[]).includes(value)
+}
+
+/**
+ * Validates typed print options.
+ *
+ * @param options - Print options from the tool call
+ * @throws {Error} With a descriptive message if any option is invalid
+ */
+export function validatePrintOptions(options: PrintJobOptions): void {
+  const { copies, duplex, page_ranges, media, number_up, color_mode, quality, hold_until } =
+    options
+
+  if (
+    copies !== undefined &&
+    (!Number.isInteger(copies) || copies < 1 || copies > MAX_COPIES_PER_JOB)
+  ) {
+    throw new Error(
+      `Invalid copies (${copies}): must be a whole number from 1 to ${MAX_COPIES_PER_JOB}.`
+    )
+  }
+
+  if (duplex !== undefined && !DUPLEX_MODES.includes(duplex)) {
+    throw new Error(`Invalid duplex "${duplex}": use one of ${DUPLEX_MODES.join(", ")}.`)
+  }
+
+  if (page_ranges !== undefined) {
+    parsePageRanges(page_ranges)
+  }
+
+  if (media !== undefined && !MEDIA_SIZES.includes(media)) {
+    throw new Error(`Invalid media "${media}": use one of ${MEDIA_SIZES.join(", ")}.`)
+  }
+
+  if (number_up !== undefined && !isNumberUp(number_up)) {
+    throw new Error(
+      `Invalid number_up (${number_up}): use one of ${NUMBER_UP_VALUES.join(", ")} pages per sheet.`
+    )
+  }
+
+  if (color_mode !== undefined && !COLOR_MODES.includes(color_mode)) {
+    throw new Error(`Invalid color_mode "${color_mode}": use one of ${COLOR_MODES.join(", ")}.`)
+  }
+
+  if (quality !== undefined && !QUALITY_LEVELS.includes(quality)) {
+    throw new Error(`Invalid quality "${quality}": use one of ${QUALITY_LEVELS.join(", ")}.`)
+  }
+
+  if (hold_until !== undefined) {
+    resolveHoldUntil(hold_until)
+  }
+}
+
+/**
+ * Translates typed print options into CUPS options (passed to lp with -o).
+ * Copies are not included since lp takes them via -n.
+ *
+ * @param options - Validated print options
+ * @returns Array of option strings (e.g., ["sides=two-sided-long-edge", "media=A4",
+ *   "print-quality=3", "job-hold-until=evening", "landscape"])
+ */
+export function printOptionsToCupsOptions(options: PrintJobOptions): string[] {
+  const cupsOptions: string[] = []
+
+  if (options.duplex) {
+    cupsOptions.push(`sides=${SIDES_BY_DUPLEX[options.duplex]}`)
+  }
+  if (options.page_ranges) {
+    cupsOptions.push(`page-ranges=${options.page_ranges.replace(/\s+/g, "")}`)
+  }
+  if (options.media) {
+    cupsOptions.push(`media=${options.media}`)
+  }
+  if (options.number_up !== undefined) {
+    cupsOptions.push(`number-up=${options.number_up}`)
+  }
+  if (options.color_mode) {
+    cupsOptions.push(`print-color-mode=${options.color_mode}`)
+  }
+  if (options.quality) {
+    cupsOptions.push(`print-quality=${PRINT_QUALITY_VALUES[options.quality]}`)
+  }
+  // The same attribute lp -H sets; it reaches IPP printers as job-hold-until too
+  if (options.hold_until !== undefined) {
+    cupsOptions.push(`job-hold-until=${resolveHoldUntil(options.hold_until)}`)
+  } else if (options.hold) {
+    cupsOptions.push("job-hold-until=indefinite")
+  }
+  // Sent to IPP printers as orientation-requested
+  if (options.orientation) {
+    cupsOptions.push(options.orientation)
+  }
+
+  return cupsOptions
+}
+
+/**
+ * Lists the pages of a document a page range list selects, in document order.
+ * Ranges beyond the end of the document are clipped and overlapping ranges count once.
+ *
+ * @param pageRanges - Page range list (e.g., "1-3,7")
+ * @param totalPages - Number of pages in the document
+ * @returns Page numbers that will be printed
+ */
+export function selectPages(pageRanges: string, totalPages: number): number[] {
+  const selected = new Set<number>()
+  for (const [first, last] of parsePageRanges(pageRanges)) {
+    for (let page = first; page <= Math.min(last, totalPages); page++) {
+      selected.add(page)
+    }
+  }
+  return [...selected].sort((a, b) => a - b)
+}
+
+/**
+ * Counts how many pages of a document a page range list selects.
+ *
+ * @param pageRanges - Page range list (e.g., "1-3,7")
+ * @param totalPages - Number of pages in the document
+ * @returns Number of pages that will be printed
+ */
+export function countSelectedPages(pageRanges: string, totalPages: number): number {
+  return selectPages(pageRanges, totalPages).length
+}
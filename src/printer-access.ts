@@ -0,0 +1,138 @@
+/**
+ * @fileoverview Printer allow-list enforcement.
+ * Restricts which printers the tools may use, based on MCP_PRINTER_ALLOWED_PRINTERS
+ * (or `allowed_printers` in the config file). An empty allow-list allows every printer.
+ * Raw jobs, which bypass the printing system's filters, have an allow-list of their own
+ * (MCP_PRINTER_RAW_ALLOWED_PRINTERS), and an empty one allows none.
+ */
+
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+import { getBackend } from "./backend.js"
+import type { PrinterSummary } from "./cups.js"
+
+/**
+ * Checks whether a printer may be used. CUPS printer names are case-insensitive.
+ *
+ * @param printer - Printer name
+ * @returns True if the allow-list is empty or contains the printer
+ */
+export function isPrinterAllowed(printer: string): boolean {
+  if (config.allowedPrinters.length === 0) {
+    return true
+  }
+  const name = printer.toLowerCase()
+  return config.allowedPrinters.some((allowed) => allowed.toLowerCase() === name)
+}
+
+/**
+ * Validates that a printer is on the allow-list.
+ *
+ * @param printer - Printer name
+ * @throws {PrinterError} PERMISSION_DENIED (listing the allowed printers) if it is not allowed
+ */
+export function validatePrinter(printer: string): void {
+  if (!isPrinterAllowed(printer)) {
+    throw new PrinterError(
+      "PERMISSION_DENIED",
+      `Access denied: Printer "${printer}" is not in the allowed printers list. ` +
+        `Allowed printers: ${config.allowedPrinters.join(", ")}`,
+      { suggestion: "Run list_printers to see the printers you may use." }
+    )
+  }
+}
+
+/**
+ * Resolves the printer a job should go to and checks it against the allow-list.
+ * Falls back to the configured default printer when none is specified. When neither is set,
+ * CUPS would use the system default, so with an allow-list the system default is looked up
+ * and checked as well.
+ *
+ * @param printer - Printer name from the tool call (optional)
+ * @param signal - The MCP request's signal
+ * @returns Printer name, or undefined to let CUPS use the system default (no allow-list)
+ * @throws {Error} If the resolved printer is not allowed or no printer can be determined
+ */
+export async function resolvePrinter(
+  printer?: string,
+  signal?: AbortSignal
+): Promise<string | undefined> {
+  const target = printer || config.defaultPrinter
+  if (target) {
+    validatePrinter(target)
+    return target
+  }
+
+  if (config.allowedPrinters.length === 0) {
+    return undefined
+  }
+
+  const systemDefault = (await getBackend().listPrinters(signal)).find((p) => p.is_default)
+  if (!systemDefault) {
+    throw new PrinterError(
+      "PRINTER_NOT_FOUND",
+      `No printer specified and no default printer is set. ` +
+        `Specify one of the allowed printers: ${config.allowedPrinters.join(", ")}`,
+      { suggestion: "Pass one of the allowed printers as the printer parameter." }
+    )
+  }
+  validatePrinter(systemDefault.name)
+  return systemDefault.name
+}
+
+/**
+ * Resolves the printer a raw job goes to and checks that it may receive raw jobs. Raw data is
+ * only meaningful to the printer it was written for (a label or receipt printer), so the
+ * printer must be listed in MCP_PRINTER_RAW_ALLOWED_PRINTERS, default printer or not.
+ *
+ * @param printer - Printer resolved by resolvePrinter (undefined for the system default)
+ * @param signal - The MCP request's signal
+ * @returns Printer name (the system default is looked up by name)
+ * @throws {PrinterError} PERMISSION_DENIED if the printer isn't allowed raw jobs
+ * @throws {PrinterError} PRINTER_NOT_FOUND if no printer is given and there is no default
+ */
+export async function resolveRawPrinter(
+  printer: string | undefined,
+  signal?: AbortSignal
+): Promise<string> {
+  let target = printer
+  if (!target) {
+    target = (await getBackend().listPrinters(signal)).find((p) => p.is_default)?.name
+    if (!target) {
+      throw new PrinterError(
+        "PRINTER_NOT_FOUND",
+        "No printer specified and no default printer is set for the raw job.",
+        { suggestion: "Pass the label or receipt printer as the printer parameter." }
+      )
+    }
+  }
+
+  const name = target.toLowerCase()
+  if (!config.rawAllowedPrinters.some((allowed) => allowed.toLowerCase() === name)) {
+    const allowed =
+      config.rawAllowedPrinters.length > 0
+        ? `Printers allowed raw jobs: ${config.rawAllowedPrinters.join(", ")}`
+        : "No printers are allowed raw jobs."
+    throw new PrinterError(
+      "PERMISSION_DENIED",
+      `Access denied: Raw data can't be sent to "${target}": raw jobs bypass the printing ` +
+        `system's filters, so they only go to printers in MCP_PRINTER_RAW_ALLOWED_PRINTERS. ` +
+        allowed,
+      {
+        suggestion:
+          "Send raw data (ZPL, ESC/POS) only to the printer it was written for. If this is that printer, add it to MCP_PRINTER_RAW_ALLOWED_PRINTERS (raw_allowed_printers in the config file).",
+      }
+    )
+  }
+  return target
+}
+
+/**
+ * Filters a printer list down to the allowed printers.
+ *
+ * @param printers - Printers reported by CUPS
+ * @returns Printers on the allow-list (all printers if the allow-list is empty)
+ */
+export function filterAllowedPrinters(printers: PrinterSummary[]): PrinterSummary[] {
+  return printers.filter((printer) => isPrinterAllowed(printer.name))
+}
@@ -0,0 +1,300 @@
+/**
+ * @fileoverview Printer capability discovery for get_printer_info.
+ * Normalizes CUPS printer options (`lpoptions -l`) and IPP printer attributes
+ * (Get-Printer-Attributes) into a single capabilities shape. The virtual PDF printer describes
+ * itself.
+ */
+
+import {
+  listPrinters,
+  getPrinterOptions,
+  type PrinterOption,
+  type PrinterSummary,
+} from "./cups.js"
+import { getBackend } from "./backend.js"
+import { getPrinterAttributes, isIppUri } from "./ipp/client.js"
+import { getPdfPrinterInfo } from "./pdf-backend.js"
+import type { IppResolution, IppValue } from "./ipp/encoding.js"
+import { PWG_MEDIA_NAMES } from "./ipp/options.js"
+import {
+  PRINT_QUALITY_VALUES,
+  QUALITY_LEVELS,
+  type DuplexMode,
+  type PrintJobOptions,
+  type QualityLevel,
+} from "./print-options.js"
+
+/**
+ * Capabilities and current state of a printer, as returned by get_printer_info.
+ */
+export interface PrinterCapabilities {
+  /** Printer name or IPP URI */
+  printer: string
+  /** Where the information came from */
+  source: "cups" | "ipp" | "pdf"
+  /** Make and model, if reported */
+  make_and_model?: string
+  /** Current printer state */
+  state: PrinterSummary["state"]
+  /** Printer state reasons (e.g., "media-empty-error", "toner-low-report") */
+  state_reasons: string[]
+  /** Whether the printer is accepting new jobs, if known */
+  accepting_jobs?: boolean
+  /** Whether two-sided printing is supported */
+  duplex: boolean
+  /** Supported duplex modes (values accepted by the `duplex` print option) */
+  duplex_modes: DuplexMode[]
+  /** Whether the printer can print in color */
+  color: boolean
+  /** Supported print quality levels (values accepted by the `quality` print option) */
+  quality_levels: QualityLevel[]
+  /** Supported media sizes (e.g., "Letter", "A4") */
+  media_sizes: string[]
+  /** Default media size, if known */
+  default_media?: string
+  /** Supported resolutions (e.g., "600dpi") */
+  resolutions: string[]
+  /** Default resolution, if known */
+  default_resolution?: string
+}
+
+/**
+ * Maps CUPS Duplex choices and IPP sides keywords to duplex modes.
+ */
+const DUPLEX_CHOICES: Record<string, DuplexMode> = {
+  None: "none",
+  DuplexNoTumble: "long-edge",
+  DuplexTumble: "short-edge",
+  "one-sided": "none",
+  "two-sided-long-edge": "long-edge",
+  "two-sided-short-edge": "short-edge",
+}
+
+/**
+ * Maps CUPS cupsPrintQuality choices and print-quality enum values to quality levels.
+ */
+const QUALITY_CHOICES: Record<string, QualityLevel> = {
+  Draft: "draft",
+  Normal: "normal",
+  High: "high",
+  ...Object.fromEntries(
+    QUALITY_LEVELS.map((level) => [String(PRINT_QUALITY_VALUES[level]), level])
+  ),
+}
+
+/** Maps the IPP printer-state enum to printer states. */
+const IPP_PRINTER_STATES: Record<number, PrinterSummary["state"]> = {
+  3: "idle",
+  4: "printing",
+  5: "stopped",
+}
+
+/** Printer attributes requested for get_printer_info. */
+const IPP_REQUESTED_ATTRIBUTES = [
+  "printer-make-and-model",
+  "printer-state",
+  "printer-state-reasons",
+  "printer-is-accepting-jobs",
+  "sides-supported",
+  "color-supported",
+  "print-color-mode-supported",
+  "print-quality-supported",
+  "media-supported",
+  "media-default",
+  "printer-resolution-supported",
+  "printer-resolution-default",
+]
+
+/** Choices that mean the printer can only print in grayscale. */
+const MONOCHROME_CHOICE_PATTERN = /^(gray|grey|mono|monochrome|black|kgray|process-monochrome)/i
+
+/**
+ * Converts choices to duplex modes, dropping choices that aren't duplex modes.
+ */
+function toDuplexModes(choices: string[]): DuplexMode[] {
+  const modes = choices.map((choice) => DUPLEX_CHOICES[choice]).filter(Boolean)
+  return [...new Set(modes)]
+}
+
+/**
+ * Converts choices to quality levels, dropping choices that aren't quality levels.
+ */
+function toQualityLevels(choices: Array<string | number>): QualityLevel[] {
+  const levels = choices.map((choice) => QUALITY_CHOICES[String(choice)]).filter(Boolean)
+  return [...new Set(levels)]
+}
+
+/**
+ * Removes custom-size placeholders from a media list.
+ */
+function withoutCustomSizes(media: string[]): string[] {
+  return media.filter((size) => !/^custom[._]/i.test(size))
+}
+
+/**
+ * Builds capabilities from CUPS printer options and the printer's lpstat summary.
+ *
+ * @param printer - Printer name
+ * @param options - Options parsed from `lpoptions -p <printer> -l`
+ * @param summary - The printer's entry from listPrinters
+ * @returns Normalized capabilities
+ */
+export function capabilitiesFromLpoptions(
+  printer: string,
+  options: PrinterOption[],
+  summary?: PrinterSummary
+): PrinterCapabilities {
+  const option = (...names: string[]) => options.find((o) => names.includes(o.name))
+
+  const duplexOption = option("Duplex", "sides")
+  const duplexModes = toDuplexModes(duplexOption?.choices ?? [])
+  const colorOption = option("ColorModel", "print-color-mode")
+  const qualityOption = option("cupsPrintQuality", "print-quality")
+  const pageSize = option("PageSize", "media")
+  const resolution = option("Resolution", "printer-resolution")
+
+  return {
+    printer,
+    source: "cups",
+    state: summary?.state ?? "unknown",
+    state_reasons: summary?.state_reasons ?? [],
+    ...(summary ? { accepting_jobs: summary.accepting_jobs } : {}),
+    duplex: duplexModes.some((mode) => mode !== "none"),
+    duplex_modes: duplexModes,
+    color: (colorOption?.choices ?? []).some((choice) => !MONOCHROME_CHOICE_PATTERN.test(choice)),
+    quality_levels: toQualityLevels(qualityOption?.choices ?? []),
+    media_sizes: withoutCustomSizes(pageSize?.choices ?? []),
+    ...(pageSize?.default ? { default_media: pageSize.default } : {}),
+    resolutions: resolution?.choices ?? [],
+    ...(resolution?.default ? { default_resolution: resolution.default } : {}),
+  }
+}
+
+/**
+ * Formats an IPP resolution as a CUPS-style resolution string (e.g., "600dpi", "1200x600dpi").
+ */
+function formatResolution({ x, y, units }: IppResolution): string {
+  const unit = units === 4 ? "dpcm" : "dpi"
+  return x === y ? `${x}${unit}` : `${x}x${y}${unit}`
+}
+
+/**
+ * Converts a PWG media name to its CUPS name when one is known.
+ */
+function mediaName(keyword: string): string {
+  return PWG_MEDIA_NAMES[keyword] ?? keyword
+}
+
+/**
+ * Builds capabilities from IPP printer attributes.
+ *
+ * @param printer - Printer URI
+ * @param attributes - Attributes from Get-Printer-Attributes
+ * @returns Normalized capabilities
+ */
+export function capabilitiesFromIppAttributes(
+  printer: string,
+  attributes: Record<string, IppValue[]>
+): PrinterCapabilities {
+  const strings = (name: string) =>
+    (attributes[name] ?? []).filter((value): value is string => typeof value === "string")
+  const first = (name: string) => attributes[name]?.[0]
+
+  const duplexModes = toDuplexModes(strings("sides-supported"))
+  const colorModes = strings("print-color-mode-supported")
+  const makeAndModel = first("printer-make-and-model")
+  const accepting = first("printer-is-accepting-jobs")
+  const defaultMedia = first("media-default")
+  const defaultResolution = first("printer-resolution-default")
+  const resolutions = (attributes["printer-resolution-supported"] ?? []) as IppResolution[]
+
+  return {
+    printer,
+    source: "ipp",
+    ...(typeof makeAndModel === "string" ? { make_and_model: makeAndModel } : {}),
+    state: IPP_PRINTER_STATES[first("printer-state") as number] ?? "unknown",
+    state_reasons: strings("printer-state-reasons").filter((reason) => reason !== "none"),
+    ...(typeof accepting === "boolean" ? { accepting_jobs: accepting } : {}),
+    duplex: duplexModes.some((mode) => mode !== "none"),
+    duplex_modes: duplexModes,
+    color:
+      first("color-supported") === true ||
+      colorModes.some((mode) => !MONOCHROME_CHOICE_PATTERN.test(mode)),
+    quality_levels: toQualityLevels(
+      (attributes["print-quality-supported"] ?? []).filter(
+        (value): value is number => typeof value === "number"
+      )
+    ),
+    media_sizes: withoutCustomSizes(strings("media-supported")).map(mediaName),
+    ...(typeof defaultMedia === "string" ? { default_media: mediaName(defaultMedia) } : {}),
+    resolutions: resolutions.map(formatResolution),
+    ...(defaultResolution && typeof defaultResolution === "object"
+      ? { default_resolution: formatResolution(defaultResolution as IppResolution) }
+      : {}),
+  }
+}
+
+/**
+ * Looks up a printer's capabilities: with Get-Printer-Attributes for IPP URIs, from the
+ * virtual PDF printer with the pdf backend, otherwise from CUPS with lpoptions and lpstat.
+ *
+ * @param printer - CUPS printer name or ipp:// / ipps:// URI
+ * @param signal - The MCP request's signal
+ * @returns Normalized capabilities
+ * @throws {Error} If the printer does not exist, cannot be queried, or doesn't answer in time
+ */
+export async function getPrinterInfo(
+  printer: string,
+  signal?: AbortSignal
+): Promise<PrinterCapabilities> {
+  if (isIppUri(printer)) {
+    const attributes = await getPrinterAttributes(printer, IPP_REQUESTED_ATTRIBUTES, signal)
+    return capabilitiesFromIppAttributes(printer, attributes)
+  }
+  if (getBackend().name === "pdf") {
+    return getPdfPrinterInfo(printer)
+  }
+
+  const summary = (await listPrinters(signal)).find(
+    (p) => p.name.toLowerCase() === printer.toLowerCase()
+  )
+  if (!summary) {
+    throw new Error(`Printer "${printer}" not found. Use list_printers to see available printers.`)
+  }
+
+  const options = await getPrinterOptions(summary.name, signal)
+  return capabilitiesFromLpoptions(summary.name, options, summary)
+}
+
+/**
+ * Checks the color mode and quality of a job against what the printer reports, so the
+ * assistant learns up front when an option will probably be ignored.
+ *
+ * @param capabilities - The printer's capabilities from getPrinterInfo
+ * @param jobOptions - Typed print options of the job
+ * @returns A warning for each option the printer doesn't list (empty when all are supported,
+ *   or the printer doesn't say)
+ */
+export function printOptionWarnings(
+  capabilities: PrinterCapabilities,
+  jobOptions: PrintJobOptions
+): string[] {
+  const warnings: string[] = []
+  const { printer, color, quality_levels } = capabilities
+
+  if (jobOptions.color_mode === "color" && !color) {
+    warnings.push(`${printer} doesn't report color support; color_mode "color" may be ignored.`)
+  }
+  if (
+    jobOptions.quality &&
+    quality_levels.length > 0 &&
+    !quality_levels.includes(jobOptions.quality)
+  ) {
+    warnings.push(
+      `${printer} supports quality ${quality_levels.join(", ")}; ` +
+        `quality "${jobOptions.quality}" may be ignored.`
+    )
+  }
+
+  return warnings
+}
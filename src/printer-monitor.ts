@@ -0,0 +1,260 @@
+/**
+ * @fileoverview Printer status monitor.
+ * Polls printers and recent jobs every MCP_PRINTER_MONITOR_INTERVAL_SECONDS and tells the
+ * MCP client what changed, so it hears about a jammed or empty printer without asking:
+ *
+ * - **Printer state reasons** (e.g., "media-empty-error") are sent as logging notifications,
+ *   "printer Office_HP: media-empty" when a reason appears and "... cleared" when it goes.
+ * - **Job state changes** are sent as resources/updated notifications for the recent jobs
+ *   resource, which the client reads again to see the new states.
+ *
+ * The monitor only polls while the client wants one of these: it has set a log level with
+ * logging/setLevel, or subscribed to the recent jobs resource. It stops for good when the
+ * session closes.
+ */
+
+import type { LoggingLevel } from "@modelcontextprotocol/sdk/types.js"
+import type { JobState, PrinterSummary } from "./cups.js"
+import { isLoggingLevelEnabled } from "./logger.js"
+
+/** Name of the logger in the monitor's logging notifications. */
+export const MONITOR_LOGGER = "printer-monitor"
+
+/**
+ * Where the monitor reads printer and job states from.
+ */
+export interface MonitorSource {
+  /** Lists the printers to watch, with their state reasons */
+  listPrinters(signal: AbortSignal): Promise<PrinterSummary[]>
+  /** Lists the jobs shown by the recent jobs resource, with their current state */
+  listJobs(signal: AbortSignal): Promise<Array<{ job_id: string; status: JobState }>>
+}
+
+/**
+ * How the monitor tells the client about changes.
+ */
+export interface MonitorNotifier {
+  /** Sends a logging notification */
+  log(level: LoggingLevel, message: string): Promise<void>
+  /** Sends a resources/updated notification for the recent jobs resource */
+  jobsUpdated(): Promise<void>
+}
+
+/**
+ * Picks the logging level of a printer state reason from its IPP severity suffix.
+ */
+function reasonLevel(reason: string): LoggingLevel {
+  if (reason.endsWith("-error")) {
+    return "error"
+  }
+  if (reason.endsWith("-report")) {
+    return "info"
+  }
+  return "warning"
+}
+
+/**
+ * Removes the IPP severity suffix from a state reason ("media-empty-error" → "media-empty").
+ */
+function reasonName(reason: string): string {
+  return reason.replace(/-(error|warning|report)$/, "")
+}
+
+/**
+ * Polls printer and job states for one MCP session and sends notifications when they change.
+ *
+ * @example
+ * ```typescript
+ * const monitor = new PrinterMonitor(30, source, notifier)
+ * monitor.setLogLevel("info") // starts polling
+ * monitor.close() // when the session ends
+ * ```
+ */
+export class PrinterMonitor {
+  private readonly intervalMs: number
+  private readonly source: MonitorSource
+  private readonly notifier: MonitorNotifier
+  /** Lowest level of logging notifications to send, once the client has set one */
+  private logLevel: LoggingLevel | undefined
+  /** Whether the client is subscribed to the recent jobs resource */
+  private jobsSubscribed = false
+  private timer: NodeJS.Timeout | undefined
+  /** Cancels the poll in progress when the monitor stops */
+  private controller: AbortController | undefined
+  private closed = false
+  /** State reasons of each printer at the last poll (undefined before the first one) */
+  private printerReasons: Map<string, Set<string>> | undefined
+  /** State of each job at the last poll (undefined before the first one) */
+  private jobStates: Map<string, JobState> | undefined
+
+  /**
+   * @param intervalSeconds - Seconds between polls
+   * @param source - Where printer and job states are read from
+   * @param notifier - Where notifications are sent
+   */
+  constructor(intervalSeconds: number, source: MonitorSource, notifier: MonitorNotifier) {
+    this.intervalMs = intervalSeconds * 1000
+    this.source = source
+    this.notifier = notifier
+  }
+
+  /** Whether the monitor is polling. */
+  get running(): boolean {
+    return this.timer !== undefined || this.controller !== undefined
+  }
+
+  /**
+   * Sets the lowest level of logging notifications the client wants (from logging/setLevel).
+   */
+  setLogLevel(level: LoggingLevel): void {
+    this.logLevel = level
+    this.update()
+  }
+
+  /**
+   * Records whether the client is subscribed to the recent jobs resource.
+   */
+  setJobsSubscribed(subscribed: boolean): void {
+    this.jobsSubscribed = subscribed
+    this.update()
+  }
+
+  /**
+   * Stops polling for good, canceling a poll in progress. Called when the session closes.
+   */
+  close(): void {
+    this.closed = true
+    this.update()
+  }
+
+  /**
+   * Checks printers and jobs once and sends notifications for what changed since the last
+   * check. The first check sends the state reasons printers already have, but no job updates.
+   * Printers or jobs that can't be listed are skipped until the next poll.
+   */
+  async poll(): Promise<void> {
+    const controller = new AbortController()
+    this.controller = controller
+    try {
+      await Promise.all([this.checkPrinters(controller.signal), this.checkJobs(controller.signal)])
+    } finally {
+      if (this.controller === controller) {
+        this.controller = undefined
+      }
+    }
+  }
+
+  /** Whether the client wants any of the monitor's notifications. */
+  private get wanted(): boolean {
+    return !this.closed && (this.logLevel !== undefined || this.jobsSubscribed)
+  }
+
+  /**
+   * Starts or stops polling to match what the client wants.
+   */
+  private update(): void {
+    if (this.wanted && !this.running) {
+      this.schedule(0)
+    } else if (!this.wanted && this.running) {
+      clearTimeout(this.timer)
+      this.timer = undefined
+      this.controller?.abort()
+      this.controller = undefined
+    }
+  }
+
+  /**
+   * Runs the next poll after a delay, and schedules the one after it when it's done, so slow
+   * printers never cause polls to pile up.
+   */
+  private schedule(delayMs: number): void {
+    this.timer = setTimeout(() => {
+      this.timer = undefined
+      void this.poll().finally(() => {
+        if (this.wanted) {
+          this.schedule(this.intervalMs)
+        }
+      })
+    }, delayMs)
+    // Polling alone doesn't keep the server running
+    this.timer.unref()
+  }
+
+  /**
+   * Compares printer state reasons with the last poll and logs the ones that appeared or
+   * cleared.
+   */
+  private async checkPrinters(signal: AbortSignal): Promise<void> {
+    if (this.logLevel === undefined) {
+      return
+    }
+    let printers: PrinterSummary[]
+    try {
+      printers = await this.source.listPrinters(signal)
+    } catch {
+      return
+    }
+    if (signal.aborted) {
+      return
+    }
+
+    const previous = this.printerReasons ?? new Map<string, Set<string>>()
+    const current = new Map(printers.map((p) => [p.name, new Set(p.state_reasons ?? [])]))
+    this.printerReasons = current
+
+    for (const [printer, reasons] of current) {
+      const before = previous.get(printer) ?? new Set()
+      for (const reason of reasons) {
+        if (!before.has(reason)) {
+          await this.log(reasonLevel(reason), `printer ${printer}: ${reasonName(reason)}`)
+        }
+      }
+      for (const reason of before) {
+        if (!reasons.has(reason)) {
+          await this.log("info", `printer ${printer}: ${reasonName(reason)} cleared`)
+        }
+      }
+    }
+  }
+
+  /**
+   * Compares job states with the last poll and sends a resource update if any changed.
+   */
+  private async checkJobs(signal: AbortSignal): Promise<void> {
+    if (!this.jobsSubscribed) {
+      // States seen before an unsubscribe aren't compared with after a new subscribe
+      this.jobStates = undefined
+      return
+    }
+    let jobs: Array<{ job_id: string; status: JobState }>
+    try {
+      jobs = await this.source.listJobs(signal)
+    } catch {
+      return
+    }
+    if (signal.aborted) {
+      return
+    }
+
+    const previous = this.jobStates
+    const current = new Map(jobs.map((job) => [job.job_id, job.status]))
+    this.jobStates = current
+    const changed =
+      previous !== undefined &&
+      (previous.size !== current.size ||
+        [...current].some(([jobId, state]) => previous.get(jobId) !== state))
+    if (changed) {
+      await this.notifier.jobsUpdated().catch(() => {})
+    }
+  }
+
+  /**
+   * Sends a logging notification if it's at or above the client's level.
+   */
+  private async log(level: LoggingLevel, message: string): Promise<void> {
+    if (!isLoggingLevelEnabled(level, this.logLevel ?? "debug")) {
+      return
+    }
+    await this.notifier.log(level, message).catch(() => {})
+  }
+}
@@ -0,0 +1,175 @@
+/**
+ * @fileoverview Print quotas.
+ * MCP_PRINTER_MAX_JOBS_PER_HOUR caps the jobs printed in each clock hour and
+ * MCP_PRINTER_MAX_PAGES_PER_DAY the pages printed each day (from local midnight), e.g. to limit
+ * what a child's assistant can print. Usage is counted from the job history ledger, so
+ * restarting the server doesn't reset it, plus the jobs still waiting in the server's queue.
+ * Dry runs and estimates never reach the queue, so they don't count. With
+ * MCP_PRINTER_QUOTA_SCOPE=session, each MCP session of the HTTP transport has quotas of its own,
+ * counted from the jobs it queued (the stdio client's are the jobs no HTTP session queued); a
+ * client that reconnects starts a new session.
+ */
+
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+import { readJobHistory } from "./job-history.js"
+import { logger } from "./logger.js"
+
+/**
+ * A job counted against the quotas.
+ */
+export interface QuotaJob {
+  /** Printing system's job ID once the job is submitted, so it isn't counted twice */
+  job_id?: string
+  /** When the job was submitted, or queued if it hasn't been yet (ISO 8601) */
+  at: string
+  /** Pages the job prints (0 when they couldn't be counted) */
+  pages: number
+  /** MCP session that queued the job (undefined for stdio) */
+  session?: string
+}
+
+/**
+ * Jobs and pages counted against the quotas in the current hour and day.
+ */
+export interface QuotaUsage {
+  jobsThisHour: number
+  pagesToday: number
+  /** Start of the next clock hour, when the job count resets */
+  hourResetsAt: Date
+  /** Next local midnight, when the page count resets */
+  dayResetsAt: Date
+}
+
+/**
+ * Counts the jobs printed this clock hour and the pages printed today (local time).
+ *
+ * @param jobs - Jobs printed or queued
+ * @param now - Current time
+ * @returns Usage in the current periods, and when each resets
+ */
+export function countQuotaUsage(jobs: QuotaJob[], now: Date): QuotaUsage {
+  const hourStart = new Date(now)
+  hourStart.setMinutes(0, 0, 0)
+  const dayStart = new Date(now)
+  dayStart.setHours(0, 0, 0, 0)
+
+  const hourResetsAt = new Date(hourStart)
+  hourResetsAt.setHours(hourResetsAt.getHours() + 1)
+  const dayResetsAt = new Date(dayStart)
+  dayResetsAt.setDate(dayResetsAt.getDate() + 1)
+
+  let jobsThisHour = 0
+  let pagesToday = 0
+  for (const job of jobs) {
+    const at = new Date(job.at)
+    if (at >= hourStart && at < hourResetsAt) {
+      jobsThisHour++
+    }
+    if (at >= dayStart && at < dayResetsAt) {
+      pagesToday += job.pages
+    }
+  }
+  return { jobsThisHour, pagesToday, hourResetsAt, dayResetsAt }
+}
+
+/** The last quota check of each quota scope, which the next one waits for. */
+const quotaChecks = new Map<string, Promise<void>>()
+
+/**
+ * Runs a quota check and the queuing of its job one request at a time per quota scope (every
+ * client, or each session with MCP_PRINTER_QUOTA_SCOPE=session). The ledger is read while the
+ * check waits on it, so two concurrent requests would otherwise both see the usage from before
+ * either was queued, and both squeeze under a quota that has room for one.
+ *
+ * @param session - MCP session queuing the job (undefined for stdio)
+ * @param task - Checks the quota and queues the job
+ * @returns What the task returns
+ */
+export async function withQuotaLock<T>(
+  session: string | undefined,
+  task: () => Promise<T>
+): Promise<T> {
+  const scope = config.quotaScope === "session" ? `session:${session ?? ""}` : "global"
+  const run = (quotaChecks.get(scope) ?? Promise.resolve()).then(task)
+  const settled = run.then(() => undefined, () => undefined)
+  quotaChecks.set(scope, settled)
+  try {
+    return await run
+  } finally {
+    if (quotaChecks.get(scope) === settled) {
+      quotaChecks.delete(scope)
+    }
+  }
+}
+
+/**
+ * Checks a job against MCP_PRINTER_MAX_JOBS_PER_HOUR and MCP_PRINTER_MAX_PAGES_PER_DAY.
+ * Jobs are counted from the job history ledger and the jobs waiting in the server's queue:
+ * all of them, or the session's own with MCP_PRINTER_QUOTA_SCOPE=session.
+ *
+ * @param pages - Pages the job prints (0 when they can't be counted)
+ * @param pending - Lists the jobs in the server's queue (ones already in the ledger are
+ *   skipped). It is called after the ledger is read, so a job queued meanwhile is counted, as
+ *   long as the check and the queuing of its job run in withQuotaLock.
+ * @param session - MCP session queuing the job (undefined for stdio)
+ * @param now - Current time (default: now)
+ * @throws {PrinterError} QUOTA_EXCEEDED with the quota, the usage, and when it resets
+ * @throws {Error} If the ledger can't be read
+ */
+export async function checkQuota(
+  pages: number,
+  pending: () => QuotaJob[] = () => [],
+  session?: string,
+  now: Date = new Date()
+): Promise<void> {
+  const { maxJobsPerHour, maxPagesPerDay } = config
+  if (!(maxJobsPerHour > 0) && !(maxPagesPerDay > 0)) {
+    return
+  }
+
+  // Jobs canceled before they were submitted (at shutdown) never printed
+  const perSession = config.quotaScope === "session"
+  const counted = (job: QuotaJob) => !perSession || job.session === session
+  const recorded = (await readJobHistory())
+    .filter((job) => !job.canceled_reason)
+    .map(
+      (job): QuotaJob => ({
+        job_id: job.job_id,
+        at: job.submitted_at,
+        pages: job.printed_pages ?? job.pages ?? 0,
+        session: job.session,
+      })
+    )
+    .filter(counted)
+  const recordedIds = new Set(recorded.map((job) => job.job_id))
+  const waiting = pending().filter(
+    (job) => counted(job) && (!job.job_id || !recordedIds.has(job.job_id))
+  )
+  const usage = countQuotaUsage([...recorded, ...waiting], now)
+  const whose = perSession ? " by this session" : ""
+
+  if (maxJobsPerHour > 0 && usage.jobsThisHour >= maxJobsPerHour) {
+    logger.info("quota exceeded", { quota: "jobs per hour", used: usage.jobsThisHour, session })
+    throw new PrinterError(
+      "QUOTA_EXCEEDED",
+      `Print quota reached: ${usage.jobsThisHour} of ${maxJobsPerHour} jobs per hour used${whose} (MCP_PRINTER_MAX_JOBS_PER_HOUR). It resets at ${usage.hourResetsAt.toISOString()}.`
+    )
+  }
+  if (
+    maxPagesPerDay > 0 &&
+    (usage.pagesToday >= maxPagesPerDay || usage.pagesToday + pages > maxPagesPerDay)
+  ) {
+    logger.info("quota exceeded", {
+      quota: "pages per day",
+      used: usage.pagesToday,
+      pages,
+      session,
+    })
+    const job = pages > 0 ? `this job prints ${pages} pages, and ` : ""
+    throw new PrinterError(
+      "QUOTA_EXCEEDED",
+      `Print quota reached: ${job}${usage.pagesToday} of ${maxPagesPerDay} pages per day used${whose} (MCP_PRINTER_MAX_PAGES_PER_DAY). It resets at ${usage.dayResetsAt.toISOString()}.`
+    )
+  }
+}
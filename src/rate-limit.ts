@@ -0,0 +1,121 @@
+/**
+ * @fileoverview Rate limit on print jobs.
+ * Each MCP session (each client of the HTTP transport, or the one stdio client) has a token
+ * bucket holding MCP_PRINTER_MAX_JOBS_PER_MINUTE tokens, refilled at that many a minute.
+ * Queuing a job takes a token, and with the bucket empty jobs are refused with RATE_LIMITED, so
+ * an assistant stuck in a loop can't keep the printer busy. A burst of jobs (a batch of files)
+ * goes through at once as long as the bucket holds enough, and a batch is checked as a whole
+ * before its first file is printed, so it is never refused partway through. Duplicate requests
+ * (see dedupe.ts) aren't queued, so they don't take a token.
+ */
+
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+import { logger } from "./logger.js"
+
+const MS_PER_MINUTE = 60_000
+
+/**
+ * A session's token bucket.
+ */
+interface Bucket {
+  /** Tokens left (fractions build up as it refills) */
+  tokens: number
+  /** When tokens was last brought up to date, in milliseconds */
+  updatedAt: number
+}
+
+// Sessions are forgotten once their bucket is full again, so ended sessions aren't kept
+const buckets = new Map<string, Bucket>()
+
+/**
+ * Refills a bucket for the time since it was last updated.
+ */
+function refill(bucket: Bucket, capacity: number, now: number): void {
+  const elapsed = Math.max(0, now - bucket.updatedAt)
+  bucket.tokens = Math.min(capacity, bucket.tokens + (elapsed * capacity) / MS_PER_MINUTE)
+  bucket.updatedAt = now
+}
+
+/**
+ * Gets a session's bucket, refilled up to now. Full buckets of other sessions are forgotten.
+ */
+function sessionBucket(key: string, capacity: number, now: number): Bucket {
+  for (const [other, bucket] of buckets) {
+    refill(bucket, capacity, now)
+    if (bucket.tokens >= capacity) {
+      buckets.delete(other)
+    }
+  }
+  return buckets.get(key) ?? { tokens: capacity, updatedAt: now }
+}
+
+/**
+ * Formats the wait until a bucket holds a number of tokens.
+ */
+function waitFor(bucket: Bucket, tokens: number, capacity: number): string {
+  const seconds = Math.ceil((((tokens - bucket.tokens) / capacity) * MS_PER_MINUTE) / 1000)
+  return `Try again in ${seconds} second${seconds === 1 ? "" : "s"}.`
+}
+
+/**
+ * Checks that a session's bucket holds a token for every job of a batch, without taking them
+ * (each job takes its own as it is queued).
+ *
+ * @param session - MCP session ID (undefined for the stdio transport)
+ * @param jobs - Jobs the batch would queue
+ * @param now - The current time, in milliseconds
+ * @throws {PrinterError} RATE_LIMITED if the batch is larger than the bucket, or the bucket
+ *   doesn't hold enough tokens yet
+ */
+export function checkJobTokens(session: string | undefined, jobs: number, now = Date.now()): void {
+  const capacity = config.maxJobsPerMinute
+  if (!(capacity > 0) || jobs <= 1) {
+    return
+  }
+
+  const key = session ?? ""
+  if (jobs > capacity) {
+    logger.info("rate limited", { session: key, max_jobs_per_minute: capacity, batch: jobs })
+    throw new PrinterError(
+      "RATE_LIMITED",
+      `Too many print jobs: a batch of ${jobs} files is more than the ${capacity} jobs each session may queue per minute (MCP_PRINTER_MAX_JOBS_PER_MINUTE).`,
+      { suggestion: `Print the files in batches of ${capacity} or fewer, a minute apart.` }
+    )
+  }
+  const bucket = sessionBucket(key, capacity, now)
+  if (bucket.tokens < jobs) {
+    logger.info("rate limited", { session: key, max_jobs_per_minute: capacity, batch: jobs })
+    throw new PrinterError(
+      "RATE_LIMITED",
+      `Too many print jobs: each session may queue ${capacity} jobs per minute (MCP_PRINTER_MAX_JOBS_PER_MINUTE), and a batch of ${jobs} files doesn't fit in what is left. ${waitFor(bucket, jobs, capacity)}`
+    )
+  }
+}
+
+/**
+ * Takes a token from a session's bucket for a job about to be queued.
+ *
+ * @param session - MCP session ID (undefined for the stdio transport)
+ * @param now - The current time, in milliseconds
+ * @throws {PrinterError} RATE_LIMITED if the session's bucket is empty, saying when the next
+ *   token is there
+ */
+export function takeJobToken(session: string | undefined, now = Date.now()): void {
+  const capacity = config.maxJobsPerMinute
+  if (!(capacity > 0)) {
+    return
+  }
+
+  const key = session ?? ""
+  const bucket = sessionBucket(key, capacity, now)
+  if (bucket.tokens < 1) {
+    logger.info("rate limited", { session: key, max_jobs_per_minute: capacity })
+    throw new PrinterError(
+      "RATE_LIMITED",
+      `Too many print jobs: each session may queue ${capacity} jobs per minute (MCP_PRINTER_MAX_JOBS_PER_MINUTE). ${waitFor(bucket, 1, capacity)}`
+    )
+  }
+  bucket.tokens -= 1
+  buckets.set(key, bucket)
+}
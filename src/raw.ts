@@ -0,0 +1,56 @@
+/**
+ * @fileoverview Raw printing.
+ * Label and receipt printers take their own command languages (ZPL, ESC/POS), which any
+ * rendering or filtering corrupts. Raw jobs skip the render pipeline and are sent untouched:
+ * with `-o raw` through CUPS, as application/octet-stream over IPP, and as RAW data to the
+ * Windows spooler. They only go to printers listed in MCP_PRINTER_RAW_ALLOWED_PRINTERS (see
+ * resolveRawPrinter), so raw data can't end up on the office laser. Raw content is recognized
+ * by rawLanguage in renderers/file-type.ts.
+ */
+
+import type { PrintJobOptions } from "./print-options.js"
+
+/** CUPS option that sends a job to the printer without filtering it. */
+export const RAW_OPTION = "raw"
+
+/**
+ * Checks that print options can be used for a raw job. The printer gets the data as it is,
+ * so options that would change which pages print or how they are laid out can't apply.
+ *
+ * @param options - Print options from the tool call
+ * @throws {Error} If the options ask for page ranges or more than one page per sheet
+ */
+export function validateRawOptions(options: PrintJobOptions): void {
+  if (options.page_ranges !== undefined) {
+    throw new Error(
+      "Cannot print page_ranges in a raw job: it is sent to the printer untouched. Leave page_ranges out."
+    )
+  }
+  if (options.number_up !== undefined && options.number_up !== 1) {
+    throw new Error(
+      `Invalid number_up (${options.number_up}) for a raw job: it is sent to the printer untouched. Leave number_up out.`
+    )
+  }
+}
+
+/**
+ * Decodes base64-encoded data for print_raw and print_data. Line breaks and other whitespace
+ * are ignored, as in MIME.
+ *
+ * @param data - Base64-encoded bytes
+ * @returns The bytes
+ * @throws {Error} If the data is empty or isn't valid base64
+ */
+export function decodeRawData(data: string): Buffer {
+  const encoded = data.replace(/\s+/g, "")
+  if (encoded.length === 0) {
+    throw new Error("Cannot print empty data. Provide the base64-encoded bytes in data.")
+  }
+  // Groups of four characters, then two or three more (padded or not)
+  if (!/^(?:[A-Za-z0-9+/]{4})*(?:[A-Za-z0-9+/]{2}(?:==)?|[A-Za-z0-9+/]{3}=?)?$/.test(encoded)) {
+    throw new Error(
+      "Invalid data: expected base64-encoded bytes (A-Z, a-z, 0-9, +, /, padded with =)."
+    )
+  }
+  return Buffer.from(encoded, "base64")
+}
@@ -0,0 +1,53 @@
+/**
+ * @fileoverview Limit on concurrent PDF renders.
+ * Every render starts a headless Chrome (or LibreOffice, for office documents), so the number of
+ * renders in flight is capped at MCP_PRINTER_MAX_CONCURRENT_RENDERS; further renders wait for a
+ * free slot in the order they asked for one.
+ */
+
+import { config } from "./config.js"
+
+let activeRenders = 0
+const waitingRenders: Array<() => void> = []
+
+/**
+ * Runs a render once a render slot is free.
+ * Only wrap the step that starts Chrome or LibreOffice: a render that waits for a slot while
+ * holding one would deadlock when the limit is 1.
+ *
+ * @param render - The render to run
+ * @returns The render's result
+ */
+export async function withRenderSlot<T>(render: () => Promise<T>): Promise<T> {
+  await acquireRenderSlot()
+  try {
+    return await render()
+  } finally {
+    releaseRenderSlot()
+  }
+}
+
+/**
+ * Takes a render slot, waiting for one if the limit is reached (0 or less means no limit).
+ */
+function acquireRenderSlot(): Promise<void> {
+  const limit = config.maxConcurrentRenders
+  if (!(limit > 0) || activeRenders < limit) {
+    activeRenders++
+    return Promise.resolve()
+  }
+  return new Promise((resolve) =>
+    waitingRenders.push(() => {
+      activeRenders++
+      resolve()
+    })
+  )
+}
+
+/**
+ * Frees a render slot and hands it to the longest-waiting render.
+ */
+function releaseRenderSlot(): void {
+  activeRenders--
+  waitingRenders.shift()?.()
+}
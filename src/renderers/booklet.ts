@@ -0,0 +1,265 @@
+/**
+ * @fileoverview Booklets: pages imposed two to a sheet side in signature order, so the printed
+ * stack folds in half into a booklet (e.g., A5 pages on A4 paper).
+ *
+ * The PDF that is printed, whether it was rendered (markdown, code, text) or was a PDF to begin
+ * with, is rebuilt without re-rendering anything:
+ *
+ * 1. **Order**: The pages are padded with blanks to a multiple of four, then laid out side by
+ *    side: the last and first pages on the front of the first sheet, the second and
+ *    second-to-last on its back, and so on inward.
+ *
+ * 2. **Layout**: Each page is copied as a form XObject (see PdfMerger) and scaled onto its half
+ *    of a landscape sheet, the media size or else the first page's size, keeping its shape.
+ *
+ * 3. **Printing**: The sheets are printed two-sided and flipped on the short edge, so the back
+ *    of each sheet reads the right way up. The stack is then folded along the long edge of the
+ *    booklet's pages, down the middle of the sheets.
+ */
+
+import { rmSync } from "fs"
+import { readFile, writeFile } from "fs/promises"
+import { basename, join } from "path"
+import { PrinterError } from "../errors.js"
+import { throwIfAborted } from "../timeouts.js"
+import { MEDIA_DIMENSIONS, type MediaSize, type PrintJobOptions } from "../print-options.js"
+import {
+  PdfDocument,
+  PdfFormatError,
+  PdfStream,
+  formatNumber,
+  type PdfDict,
+  type PdfValue,
+} from "../pdf/document.js"
+import { PdfMerger, type PageForm } from "../pdf/merge.js"
+import { createTempDir } from "../temp-files.js"
+
+/** How to fold a printed booklet, for the print result. */
+export const BOOKLET_FOLDING =
+  "keep the sheets in the order they print and fold along the long edge of the booklet's pages (down the middle of the sheets)"
+
+/**
+ * A booklet imposed from a PDF.
+ */
+export interface Booklet {
+  /** The imposed PDF's bytes, one page per sheet side */
+  data: Buffer
+  /** Pages of the original document */
+  pages: number
+  /** Pages of the booklet, blanks included (a multiple of four) */
+  slots: number
+  /** Sheets of paper the booklet is printed on */
+  sheets: number
+}
+
+/**
+ * Checks that print options can be used for a booklet: they are printed two-sided on the short
+ * edge, two pages per side, with every page in the booklet.
+ *
+ * @param options - Print options from the tool call
+ * @throws {Error} If the options ask for another duplex mode, number-up, or page ranges
+ */
+export function validateBookletOptions(options: PrintJobOptions): void {
+  if (options.duplex !== undefined && options.duplex !== "short-edge") {
+    throw new Error(
+      `Invalid duplex "${options.duplex}" for a booklet: booklets are printed two-sided, flipped on the short edge. Leave duplex out.`
+    )
+  }
+  if (options.number_up !== undefined && options.number_up !== 1) {
+    throw new Error(
+      `Invalid number_up (${options.number_up}) for a booklet: booklets already print two pages per side. Leave number_up out.`
+    )
+  }
+  if (options.page_ranges !== undefined) {
+    throw new Error(
+      "Cannot print page_ranges as a booklet: every page is reordered onto the sheets. Print the whole document, or print the pages without booklet."
+    )
+  }
+}
+
+/**
+ * Lays out a document's pages in booklet order: the sides of each sheet, front then back, with
+ * the pages on the left and right halves.
+ *
+ * @param pageCount - Pages in the document
+ * @returns Page numbers (from 1) of each side's left and right halves; null for blank halves
+ */
+export function bookletSides(pageCount: number): Array<[number | null, number | null]> {
+  const slots = Math.max(4, Math.ceil(pageCount / 4) * 4)
+  const page = (number: number) => (number <= pageCount ? number : null)
+  const sides: Array<[number | null, number | null]> = []
+  for (let sheet = 0; sheet < slots / 4; sheet++) {
+    sides.push([page(slots - 2 * sheet), page(2 * sheet + 1)])
+    sides.push([page(2 * sheet + 2), page(slots - 2 * sheet - 1)])
+  }
+  return sides
+}
+
+/**
+ * Builds the transformation that draws a page's form in a cell, scaled to fit without
+ * changing its shape, centered, and turned by the page's /Rotate.
+ *
+ * @param page - The page's form, box, and rotation
+ * @param cell - The cell [left, bottom, width, height] on the sheet
+ * @returns The matrix [a, b, c, d, e, f] for the cm operator
+ * @internal Exported for testing purposes
+ */
+export function placePage(page: Omit<PageForm, "form">, cell: number[]): number[] {
+  const [left, bottom, right, top] = page.box
+  const width = right - left
+  const height = top - bottom
+  const turned = page.rotate === 90 || page.rotate === 270
+  const [shownWidth, shownHeight] = turned ? [height, width] : [width, height]
+
+  // Map the page's box, from its lower-left corner, onto the page as shown
+  const shown: Record<number, number[]> = {
+    0: [1, 0, 0, 1, 0, 0],
+    90: [0, -1, 1, 0, 0, width],
+    180: [-1, 0, 0, -1, width, height],
+    270: [0, 1, -1, 0, height, 0],
+  }
+  const [a, b, c, d, e, f] = shown[page.rotate] ?? shown[0]
+  const [cellLeft, cellBottom, cellWidth, cellHeight] = cell
+  const scale = Math.min(cellWidth / shownWidth, cellHeight / shownHeight)
+  const x = cellLeft + (cellWidth - shownWidth * scale) / 2
+  const y = cellBottom + (cellHeight - shownHeight * scale) / 2
+  return [
+    a * scale,
+    b * scale,
+    c * scale,
+    d * scale,
+    (e - a * left - c * bottom) * scale + x,
+    (f - b * left - d * bottom) * scale + y,
+  ]
+}
+
+/**
+ * Imposes a PDF as a booklet.
+ *
+ * @param data - The PDF's bytes
+ * @param options - Paper size of the sheets (default: the size of the first page)
+ * @param name - Name of the file, for error messages
+ * @returns The imposed PDF and its page and sheet counts
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the PDF is encrypted, has no pages, or can't be
+ *   read
+ */
+export function imposeBooklet(
+  data: Buffer,
+  options: { media?: MediaSize } = {},
+  name = "the PDF"
+): Booklet {
+  const merger = new PdfMerger()
+  let forms: PageForm[]
+  try {
+    const document = new PdfDocument(data)
+    if (document.encrypted) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot print ${name} as a booklet: it is encrypted.`,
+        { suggestion: "Print it without booklet, or remove the password protection first." }
+      )
+    }
+    forms = merger.appendPageForms(document)
+  } catch (error) {
+    if (error instanceof PdfFormatError) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot print ${name} as a booklet: its structure can't be read (${error.message}).`,
+        {
+          cause: error,
+          suggestion: "Print it without booklet, or save it again from a PDF viewer first.",
+        }
+      )
+    }
+    throw error
+  }
+  if (forms.length === 0) {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot print ${name} as a booklet: it has no pages.`
+    )
+  }
+
+  // Sheets are landscape: the media size turned, or the first page as shown, long side across
+  const [left, bottom, right, top] = forms[0].box
+  const [portraitWidth, portraitHeight] = options.media
+    ? [MEDIA_DIMENSIONS[options.media].width, MEDIA_DIMENSIONS[options.media].height]
+    : [Math.min(right - left, top - bottom), Math.max(right - left, top - bottom)]
+  const sheetWidth = portraitHeight
+  const sheetHeight = portraitWidth
+  const cells = [
+    [0, 0, sheetWidth / 2, sheetHeight],
+    [sheetWidth / 2, 0, sheetWidth / 2, sheetHeight],
+  ]
+
+  const sides = bookletSides(forms.length)
+  for (const halves of sides) {
+    const xobjects: PdfDict = new Map()
+    const content: string[] = []
+    halves.forEach((page, half) => {
+      if (page === null) {
+        return
+      }
+      const form = forms[page - 1]
+      const matrix = placePage(form, cells[half]).map(formatNumber).join(" ")
+      xobjects.set(`P${page}`, form.form)
+      content.push(`q ${matrix} cm /P${page} Do Q`)
+    })
+    const stream = new PdfStream(new Map(), Buffer.from(`${content.join("\n")}\n`, "latin1"))
+    merger.addPage(
+      new Map<string, PdfValue>([
+        ["MediaBox", [0, 0, sheetWidth, sheetHeight]],
+        ["Resources", new Map([["XObject", xobjects]])],
+        ["Contents", merger.add(stream)],
+      ])
+    )
+  }
+
+  return {
+    data: merger.toBuffer(),
+    pages: forms.length,
+    slots: sides.length * 2,
+    sheets: sides.length / 2,
+  }
+}
+
+/**
+ * Imposes a PDF file as a booklet, writing the result to a temp file.
+ *
+ * @param pdfPath - Path to the PDF
+ * @param options - Paper size of the sheets (default: the size of the first page)
+ * @param signal - The MCP request's signal
+ * @returns Path to the booklet (in its own temp directory; remove it with
+ *   cleanupRenderedPdf), and the sheets it is printed on
+ * @throws {Error} If the request is canceled
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the PDF is encrypted, has no pages, or can't be
+ *   read
+ */
+export async function bookletPdf(
+  pdfPath: string,
+  options: { media?: MediaSize } = {},
+  signal?: AbortSignal
+): Promise<{ pdfPath: string; sheets: number }> {
+  const booklet = imposeBooklet(await readFile(pdfPath), options, basename(pdfPath))
+  throwIfAborted("Imposing the booklet", signal)
+
+  const tempDir = createTempDir("booklet-")
+  const outputPath = join(tempDir, basename(pdfPath))
+  try {
+    await writeFile(outputPath, booklet.data)
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return { pdfPath: outputPath, sheets: booklet.sheets }
+}
+
+/**
+ * Describes a printed booklet and how to fold it, for the print result.
+ *
+ * @param sheets - Sheets the booklet is printed on (per copy)
+ * @returns e.g. "2 sheets: keep the sheets in the order they print and fold ..."
+ */
+export function describeBooklet(sheets: number): string {
+  return `${sheets} sheet${sheets === 1 ? "" : "s"}: ${BOOKLET_FOLDING}`
+}
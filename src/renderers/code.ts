@@ -10,10 +10,13 @@
  *    boundaries, which would interfere with line-by-line table rendering.
  *
  * 3. **HTML Table Structure**: Builds an HTML table where each line of code is a table row.
- *    Optionally adds line numbers in a separate column with configurable visibility.
+ *    Optionally adds line numbers in a separate column with configurable visibility. The
+ *    filename is placed in the table header so it repeats at the top of every printed page,
+ *    unless a header template replaces it.
  *
  * 4. **CSS Styling**: Loads the selected color scheme from highlight.js styles directory
- *    and applies print-optimized CSS (fonts, spacing, margins, page setup).
+ *    and applies print-optimized CSS (fonts, spacing, margins, page setup). Header and footer
+ *    templates become CSS @page margin boxes.
  *
  * 5. **PDF Generation**: Uses Chrome headless to convert the styled HTML to PDF format,
  *    which preserves syntax colors and formatting for printing.
@@ -30,6 +33,9 @@ import he from "he"
 import { convertHtmlToPdf, hasShebang } from "../utils.js"
 import { validateFilePath } from "../file-security.js"
 import { config } from "../config.js"
+import { buildHeaderFooterCss, hasHeaderFooter, resolveHeaderFooter } from "./header-footer.js"
+import { CJK_FONT_FAMILIES, readTextFile } from "./encoding.js"
+import { pageLayoutCss, validatePageMargins, type PageLayout } from "./page-layout.js"
 
 /**
  * Determines if a file should be rendered with syntax highlighting.
@@ -207,17 +213,38 @@ export function fixMultilineSpans(text: string): string {
     .join("\n")
 }
 
+/**
+ * Checks source text for a shebang line, using the same lenient rules as hasShebang
+ * (any line within the first 1024 characters).
+ */
+function containsShebang(sourceCode: string): boolean {
+  return sourceCode
+    .slice(0, 1024)
+    .split(/\r?\n|\r/)
+    .some((line) => line.trim().startsWith("#!"))
+}
+
 /**
  * Applies syntax highlighting to source code using highlight.js.
  *
  * Strategy: Prefers extension-based language detection over auto-detection for accuracy.
  * If the specified language fails or produces no highlighted tokens, falls back to auto-detection.
+ * Files with unknown extensions are only auto-detected when they start with a shebang;
+ * anything else is escaped and printed as plain text rather than guessing a language.
  *
  * @param sourceCode - Raw source code to highlight
- * @param language - Language identifier from file extension
+ * @param language - Language identifier from file extension (empty string if unknown)
  * @returns HTML string with syntax highlighting span elements
  */
 function applySyntaxHighlighting(sourceCode: string, language: string): string {
+  if (language === "") {
+    // Unknown extension: only guess a language for scripts, print everything else as plain text
+    if (!containsShebang(sourceCode)) {
+      return he.escape(sourceCode)
+    }
+    return hljs.highlightAuto(sourceCode).value
+  }
+
   try {
     const highlighted = hljs.highlight(sourceCode, { language }).value
 
@@ -311,24 +338,38 @@ function buildTableRows(lines: string[], showLineNumbers: boolean): string {
 
 /**
  * Generates the complete HTML document with embedded CSS for printing.
+ * The file path is placed in the table header so Chrome repeats it at the top of every page,
+ * unless `filePath` is empty (a header template is printed instead).
  */
 function generateHTML(
   filePath: string,
   tableRows: string,
+  columnCount: number,
   colorSchemeCSS: string,
   fontSize: string,
-  lineSpacing: string
+  lineSpacing: string,
+  headerFooterCSS: string,
+  layout: PageLayout
 ): string {
+  const tableHeader = filePath
+    ? `<thead>
+      <tr><th class="filepath" colspan="${columnCount}">${he.encode(filePath)}</th></tr>
+    </thead>`
+    : ""
+
   return `<!DOCTYPE html>
 <html>
 <head>
   <meta charset="utf-8">
   <style>
-    /* Print page setup - standard margins */
+    /* Print page setup - standard margins unless others are set */
     @page {
-      margin: 0.5in;
+      ${pageLayoutCss(layout, { margin: "0.5in" })}
     }
     
+    /* Header and footer templates */
+    ${headerFooterCSS}
+    
     /* Highlight.js color scheme */
     ${colorSchemeCSS}
     
@@ -340,13 +381,22 @@ function generateHTML(
     html, body {
       margin: 0;
       padding: 0;
-      font-family: Menlo, Monaco, 'Courier New', monospace;
+      font-family: Menlo, Monaco, 'Courier New', ${CJK_FONT_FAMILIES}, monospace;
       font-size: ${fontSize};
       line-height: ${lineSpacing}em;
     }
     
     table {
       border-collapse: collapse;
+      width: 100%;
+    }
+    
+    thead {
+      display: table-header-group;
+    }
+    
+    tr {
+      break-inside: avoid;
     }
     
     .hljs {
@@ -366,16 +416,20 @@ function generateHTML(
       white-space: pre-wrap;
     }
     
-    h3.filepath {
-      margin: 0 0 1em 0;
+    th.filepath {
+      padding: 0 0 1em 0;
+      font-size: 1.17em;
       font-weight: normal;
+      text-align: left;
     }
   </style>
 </head>
 <body>
-  <h3 class="filepath">${he.encode(filePath)}</h3>
   <table class="hljs">
+    ${tableHeader}
+    <tbody>
     ${tableRows}
+    </tbody>
   </table>
 </body>
 </html>`
@@ -384,57 +438,103 @@ function generateHTML(
 /**
  * Options for rendering code to PDF.
  */
-export interface RenderCodeOptions {
+export interface RenderCodeOptions extends PageLayout {
   lineNumbers?: boolean
   colorScheme?: string
   fontSize?: string
   lineSpacing?: string
+  /** Header template (default: MCP_PRINTER_HEADER; empty string for none) */
+  header?: string
+  /** Footer template (default: MCP_PRINTER_FOOTER; empty string for none) */
+  footer?: string
+  /** Value of {title} in header and footer templates (default: the file name) */
+  title?: string
+  /** Character encoding of the file (default: detected) */
+  encoding?: string
+  /** The MCP request's signal, which cancels the render */
+  signal?: AbortSignal
 }
 
 /**
- * Renders a source code file to PDF with syntax highlighting.
- * Uses highlight.js for syntax highlighting and Chrome for PDF generation.
- * Supports configurable color schemes, line numbers, font size, and line spacing.
+ * Builds the print-ready HTML document for a source file.
+ * Language is detected from the file extension; unknown extensions render as plain text.
  *
- * @param filePath - Path to the source code file to render
- * @param options - Optional rendering options (lineNumbers, colorScheme, fontSize, lineSpacing)
- * @returns Path to the generated temporary PDF file
- * @throws {Error} If Chrome is not found or PDF generation fails
+ * @param filePath - Path of the source file (used for language detection and the page header)
+ * @param sourceCode - Contents of the source file
+ * @param options - Optional rendering options (lineNumbers, colorScheme, fontSize, lineSpacing,
+ *   orientation, margins, header, footer, title)
+ * @returns Complete HTML document
+ * @internal Exported for testing purposes
  */
-export async function renderCodeToPdf(
+export function buildCodeHtml(
   filePath: string,
+  sourceCode: string,
   options?: RenderCodeOptions
-): Promise<string> {
-  // Step 1: Validate file path
-  validateFilePath(filePath)
-
-  // Step 2: Read source code and identify language
-  const sourceCode = readFileSync(filePath, "utf-8")
+): string {
+  // Step 1: Apply syntax highlighting with extension-based language, fallback to auto-detect
   const language = getLanguageFromExtension(filePath)
-
-  // Step 3: Apply syntax highlighting with extension-based language, fallback to auto-detect
   const highlightedCode = applySyntaxHighlighting(sourceCode, language)
 
-  // Step 4: Fix multiline spans and split into lines
+  // Step 2: Fix multiline spans and split into lines
   const lines = fixMultilineSpans(highlightedCode).split("\n")
 
-  // Step 5: Build HTML structure with configuration
+  // Step 3: Build HTML structure with configuration
   const showLineNumbers = options?.lineNumbers ?? config.code.autoLineNumbers
   const tableRows = buildTableRows(lines, showLineNumbers)
 
   const selectedColorScheme = options?.colorScheme ?? config.code.colorScheme
   const colorSchemeCSS = loadColorSchemeCSS(selectedColorScheme)
 
-  const html = generateHTML(
-    filePath,
+  const headerFooter = resolveHeaderFooter({ header: options?.header, footer: options?.footer })
+  const filename = basename(filePath)
+  const headerFooterCSS = buildHeaderFooterCss(headerFooter, {
+    filename,
+    title: options?.title || filename,
+  })
+
+  return generateHTML(
+    headerFooter.header ? "" : filePath,
     tableRows,
+    showLineNumbers ? 2 : 1,
     colorSchemeCSS,
     options?.fontSize ?? config.code.fontSize,
-    options?.lineSpacing ?? config.code.lineSpacing
+    options?.lineSpacing ?? config.code.lineSpacing,
+    headerFooterCSS,
+    { orientation: options?.orientation, margins: options?.margins }
   )
+}
+
+/**
+ * Renders a source code file to PDF with syntax highlighting.
+ * Uses highlight.js for syntax highlighting and Chrome for PDF generation.
+ * Supports configurable color schemes, line numbers, font size, and line spacing.
+ *
+ * @param filePath - Path to the source code file to render
+ * @param options - Optional rendering options (lineNumbers, colorScheme, fontSize, lineSpacing,
+ *   orientation, margins, header, footer, title, encoding)
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the margins are invalid, the file can't be decoded, Chrome is not found,
+ *   or PDF generation fails
+ */
+export async function renderCodeToPdf(
+  filePath: string,
+  options?: RenderCodeOptions
+): Promise<string> {
+  // Validate file path and margins
+  validateFilePath(filePath)
+  if (options?.margins) {
+    validatePageMargins(options.margins)
+  }
+
+  // Read source code (decoded to UTF-8) and build the highlighted HTML document
+  const sourceCode = readTextFile(filePath, options?.encoding).text
+  const html = buildCodeHtml(filePath, sourceCode, options)
 
-  // Step 6: Convert HTML to PDF
+  // Convert HTML to PDF (Chrome's own header and footer would cover the template margin boxes)
+  const headerFooter = resolveHeaderFooter({ header: options?.header, footer: options?.footer })
   return await convertHtmlToPdf(html, {
-    tempDirPrefix: "mcp-printer-code-",
+    chromeFlags: hasHeaderFooter(headerFooter) ? ["--no-pdf-header-footer"] : [],
+    tempDirPrefix: "code-",
+    signal: options?.signal,
   })
 }
@@ -0,0 +1,306 @@
+/**
+ * @fileoverview Cover pages: a page before the document naming whose job it is, so jobs on a
+ * shared printer can be told apart.
+ *
+ * By default the cover is drawn into the PDF, in the size of the document's first page, with
+ * the owner (MCP_PRINTER_JOB_OWNER), the title, when the job was queued, its source, and its
+ * page count. Blank pages after it fill the rest of the sheet, so the document starts on a
+ * sheet of its own when it is printed two-sided or several pages per sheet. With
+ * MCP_PRINTER_COVER_PAGE_MODE=job-sheets, CUPS prints its own banner page instead (only for
+ * printers reached through CUPS; other jobs still get a generated cover).
+ */
+
+import { rmSync } from "fs"
+import { readFile, writeFile } from "fs/promises"
+import { basename, join } from "path"
+import { userInfo } from "os"
+import { config } from "../config.js"
+import { PrinterError } from "../errors.js"
+import { getBackend } from "../backend.js"
+import { isIppUri } from "../ipp/client.js"
+import { throwIfAborted } from "../timeouts.js"
+import { parsePageRanges } from "../print-options.js"
+import type { LpJobOptions } from "../cups.js"
+import {
+  PdfDocument,
+  PdfFormatError,
+  PdfStream,
+  formatNumber,
+  type PdfValue,
+} from "../pdf/document.js"
+import { PdfMerger } from "../pdf/merge.js"
+import {
+  encodeWinAnsi,
+  helveticaBoldFont,
+  measureText,
+  standardFont,
+  type StandardFont,
+} from "../pdf/helvetica.js"
+import { firstPageBox } from "./merge.js"
+import { createTempDir } from "../temp-files.js"
+
+/** CUPS option that prints a standard banner page before the job and none after it. */
+export const JOB_SHEETS_OPTION = "job-sheets=standard,none"
+
+/** Margin around the cover's text, in points. */
+const COVER_MARGIN = 72
+
+/** Font size of the owner's name. */
+const COVER_OWNER_SIZE = 32
+
+/** Font size of the title. */
+const COVER_TITLE_SIZE = 18
+
+/** Font size of the details below the title. */
+const COVER_DETAIL_SIZE = 12
+
+/**
+ * What a cover page shows.
+ */
+export interface CoverPageInfo {
+  /** Whose job it is (see coverPageOwner) */
+  owner: string
+  /** Job title */
+  title: string
+  /** When the job was queued */
+  queuedAt: Date
+  /** File or URL the job came from, if it has one */
+  source?: string
+  /** Pages of the document printed (the cover not included) */
+  pages: number
+  copies: number
+}
+
+/**
+ * Decides how a job's cover page is printed.
+ *
+ * @param printer - The job's printer or IPP printer URI
+ * @param coverPage - The cover_page option (default: MCP_PRINTER_COVER_PAGE)
+ * @returns "job-sheets" for a CUPS banner page, "generate" to draw one into the PDF, or
+ *   undefined for no cover page
+ */
+export function coverPageMode(
+  printer: string | undefined,
+  coverPage: boolean | undefined
+): "generate" | "job-sheets" | undefined {
+  if (!(coverPage ?? config.coverPage)) {
+    return undefined
+  }
+  const throughCups = getBackend().name === "cups" && !isIppUri(printer)
+  return config.coverPageMode === "job-sheets" && throughCups ? "job-sheets" : "generate"
+}
+
+/**
+ * Finds the owner named on cover pages: MCP_PRINTER_JOB_OWNER, or the user running the server.
+ *
+ * @returns The owner's name
+ */
+export function coverPageOwner(): string {
+  if (config.jobOwner) {
+    return config.jobOwner
+  }
+  try {
+    return userInfo().username
+  } catch {
+    return "unknown"
+  }
+}
+
+/**
+ * Formats when a job was queued for its cover page, in local time (e.g., "2026-10-14 09:30").
+ */
+function formatQueuedAt(date: Date): string {
+  const pad = (value: number) => String(value).padStart(2, "0")
+  return (
+    `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())} ` +
+    `${pad(date.getHours())}:${pad(date.getMinutes())}`
+  )
+}
+
+/**
+ * Encodes a line of text for the cover, cut short with an ellipsis if it is wider than the
+ * page allows. Characters the standard PDF fonts can't show are printed as "?".
+ */
+function fitLine(text: string, font: StandardFont, size: number, width: number): Buffer {
+  const fits = (line: string) => (measureText(line, font) * size) / 1000 <= width
+  let line = (encodeWinAnsi(text, "?") as Buffer).toString("latin1")
+  if (!fits(line)) {
+    while (line.length > 0 && !fits(`${line}\x85`)) {
+      line = line.slice(0, -1)
+    }
+    line = `${line}\x85`
+  }
+  return Buffer.from(line, "latin1")
+}
+
+/**
+ * Builds the content of a cover page: the owner in large type, the title, and the details,
+ * from the top left of the page.
+ *
+ * @param info - What the cover shows
+ * @param box - Page box [left, bottom, right, top]
+ * @returns Content stream operators (font /F0 is Helvetica Bold, /F1 Helvetica)
+ * @internal Exported for testing purposes
+ */
+export function buildCoverPageContent(info: CoverPageInfo, box: number[]): string {
+  const left = Math.min(box[0], box[2]) + COVER_MARGIN
+  const top = Math.max(box[1], box[3]) - COVER_MARGIN
+  const width = Math.max(Math.abs(box[2] - box[0]) - 2 * COVER_MARGIN, 72)
+
+  const pages = `${info.pages} ${info.pages === 1 ? "page" : "pages"}`
+  const lines: Array<{ text: string; bold: boolean; size: number; gap: number }> = [
+    { text: info.owner, bold: true, size: COVER_OWNER_SIZE, gap: COVER_OWNER_SIZE },
+    { text: info.title, bold: true, size: COVER_TITLE_SIZE, gap: 2 * COVER_TITLE_SIZE },
+    {
+      text: `Queued: ${formatQueuedAt(info.queuedAt)}`,
+      bold: false,
+      size: COVER_DETAIL_SIZE,
+      gap: 3 * COVER_DETAIL_SIZE,
+    },
+    ...(info.source
+      ? [{ text: `Source: ${info.source}`, bold: false, size: COVER_DETAIL_SIZE, gap: 18 }]
+      : []),
+    {
+      text: info.copies > 1 ? `Pages: ${pages} × ${info.copies} copies` : `Pages: ${pages}`,
+      bold: false,
+      size: COVER_DETAIL_SIZE,
+      gap: 18,
+    },
+  ]
+
+  const operators = ["q", "0 g"]
+  let y = top
+  for (const { text, bold, size, gap } of lines) {
+    y -= gap
+    const encoded = fitLine(text, bold ? "Helvetica-Bold" : "Helvetica", size, width)
+    operators.push(
+      "BT",
+      `/${bold ? "F0" : "F1"} ${formatNumber(size)} Tf`,
+      `${formatNumber(left)} ${formatNumber(y)} Td`,
+      `<${encoded.toString("hex").toUpperCase()}> Tj`,
+      "ET"
+    )
+  }
+  return [...operators, "Q", ""].join("\n")
+}
+
+/**
+ * Finds the last value of a CUPS option (lp uses the last one).
+ */
+function lastOptionValue(options: string[], name: string): string | undefined {
+  const option = options.filter((entry) => entry.startsWith(`${name}=`)).pop()
+  return option?.slice(name.length + 1)
+}
+
+/**
+ * Moves a page range list past the pages put in front of the document, keeping them.
+ *
+ * @param pageRanges - Page range list of the document (e.g., "1-3,7")
+ * @param added - Pages in front of the document
+ * @returns The page range list of the covered document (e.g., "1-2,3-5,9")
+ * @internal Exported for testing purposes
+ */
+export function shiftPageRanges(pageRanges: string, added: number): string {
+  const shifted = parsePageRanges(pageRanges).map(([first, last]) =>
+    first === last ? `${first + added}` : `${first + added}-${last + added}`
+  )
+  return [added === 1 ? "1" : `1-${added}`, ...shifted].join(",")
+}
+
+/**
+ * Reads the PDF a cover page is added to.
+ *
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if it is encrypted or can't be read
+ */
+function readCoveredPdf(data: Buffer, name: string): PdfDocument {
+  try {
+    const document = new PdfDocument(data)
+    if (document.encrypted) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot add a cover page to ${name}: it is encrypted.`,
+        { suggestion: "Print it with cover_page: false, or remove the password protection first." }
+      )
+    }
+    document.getPages()
+    return document
+  } catch (error) {
+    if (error instanceof PdfFormatError) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot add a cover page to ${name}: its structure can't be read (${error.message}).`,
+        {
+          cause: error,
+          suggestion: "Print it with cover_page: false, or save it again from a PDF viewer.",
+        }
+      )
+    }
+    throw error
+  }
+}
+
+/**
+ * Puts a cover page in front of a PDF job. The cover is followed by blank pages filling the
+ * rest of its sheet (two-sided printing and number-up are read from the job's options), and
+ * page-ranges options are moved past them so the same pages of the document print.
+ *
+ * @param job - Job options from buildPrintJob, with the PDF to print
+ * @param info - What the cover shows
+ * @param signal - The MCP request's signal
+ * @returns The job printing the covered PDF, and that PDF (remove it with cleanupRenderedPdf)
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the PDF is encrypted or can't be read
+ * @throws {Error} If the request is canceled
+ */
+export async function addCoverPage(
+  job: LpJobOptions & { filePath: string },
+  info: CoverPageInfo,
+  signal?: AbortSignal
+): Promise<{ job: LpJobOptions; coverPdf: string }> {
+  const name = info.title || basename(job.filePath)
+  const document = readCoveredPdf(await readFile(job.filePath), name)
+  const options = job.options ?? []
+  const twoSided = lastOptionValue(options, "sides")?.startsWith("two-sided") ?? false
+  const numberUp = Math.max(parseInt(lastOptionValue(options, "number-up") ?? "1", 10) || 1, 1)
+  const sheetPages = numberUp * (twoSided ? 2 : 1)
+
+  const merger = new PdfMerger()
+  const box = firstPageBox(document)
+  const fonts = new Map<string, PdfValue>([
+    ["F0", merger.add(helveticaBoldFont())],
+    ["F1", merger.add(standardFont("Helvetica"))],
+  ])
+  const content = Buffer.from(buildCoverPageContent(info, box), "latin1")
+  merger.addPage(
+    new Map<string, PdfValue>([
+      ["MediaBox", box],
+      ["Resources", new Map([["Font", fonts]])],
+      ["Contents", merger.add(new PdfStream(new Map(), content))],
+    ])
+  )
+  for (let page = 1; page < sheetPages; page++) {
+    merger.addPage(new Map<string, PdfValue>([["MediaBox", box]]))
+  }
+  merger.appendDocument(document)
+  throwIfAborted("Rendering", signal)
+
+  const tempDir = createTempDir("cover-")
+  const coverPdf = join(tempDir, "cover.pdf")
+  try {
+    await writeFile(coverPdf, merger.toBuffer())
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return {
+    job: {
+      ...job,
+      filePath: coverPdf,
+      options: options.map((option) =>
+        option.startsWith("page-ranges=")
+          ? `page-ranges=${shiftPageRanges(option.slice("page-ranges=".length), sheetPages)}`
+          : option
+      ),
+    },
+    coverPdf,
+  }
+}
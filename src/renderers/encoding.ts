@@ -0,0 +1,376 @@
+/**
+ * @fileoverview Character encoding detection and conversion for text files.
+ * Text is rendered and printed as UTF-8, so legacy files (Windows-1252 reports, Shift_JIS
+ * exports) are decoded first instead of coming out as mojibake. The `encoding` option names
+ * the file's encoding; otherwise it is detected: a byte order mark, then valid UTF-8, then
+ * Shift_JIS, EUC-JP, GB18030, or EUC-KR when the text reads as Japanese, Chinese, or Korean,
+ * and Windows-1252 for the rest. Large files are decoded as a stream, a chunk at a time.
+ */
+
+import { createReadStream, createWriteStream, readFileSync } from "fs"
+import { open } from "fs/promises"
+import { basename } from "path"
+import { pipeline } from "stream/promises"
+import { PrinterError } from "../errors.js"
+
+/** Encodings text files can be decoded from (WHATWG names, as TextDecoder reports them). */
+export const CHARACTER_ENCODINGS = [
+  "utf-8",
+  "utf-16le",
+  "utf-16be",
+  "windows-1252",
+  "iso-8859-2",
+  "iso-8859-15",
+  "windows-1250",
+  "windows-1251",
+  "koi8-r",
+  "shift_jis",
+  "euc-jp",
+  "iso-2022-jp",
+  "gb18030",
+  "gbk",
+  "big5",
+  "euc-kr",
+] as const
+export type CharacterEncoding = (typeof CHARACTER_ENCODINGS)[number]
+
+/**
+ * Fonts with CJK glyphs, for renderers to list after their own fonts so decoded Japanese,
+ * Chinese, and Korean text doesn't print as empty boxes. Chrome uses the first one installed.
+ */
+export const CJK_FONT_FAMILIES =
+  "'Noto Sans Mono CJK JP', 'Noto Sans CJK JP', 'Hiragino Sans', 'Yu Gothic', 'MS Gothic', 'Microsoft YaHei', 'Malgun Gothic'"
+
+/**
+ * Encodings tried on text that isn't UTF-8 and has runs of non-ASCII bytes, in order of
+ * preference when they score the same. Big5 and the Cyrillic encodings can't be told apart
+ * from these reliably, so they have to be named with the `encoding` option.
+ */
+const CJK_CANDIDATES: CharacterEncoding[] = ["shift_jis", "gb18030", "euc-jp", "euc-kr"]
+
+/** Bytes read from the start of a file to detect its encoding. */
+const DETECT_BYTES = 64 * 1024
+
+/** Encodings whose text is expected to have kana. */
+const JAPANESE_ENCODINGS: CharacterEncoding[] = ["shift_jis", "euc-jp", "iso-2022-jp"]
+
+/**
+ * Characters of bytes 0x80-0x9F in Windows-1252 (the five unassigned bytes stay control
+ * characters, as in the WHATWG encoding).
+ */
+export const WINDOWS_1252_HIGH = "€\x81‚ƒ„…†‡ˆ‰Š‹Œ\x8dŽ\x8f\x90‘’“”•–—˜™š›œ\x9džŸ"
+
+/**
+ * Finds a supported encoding by name. Any WHATWG label works (e.g., "Shift-JIS", "sjis",
+ * "cp1252", "latin1").
+ *
+ * @param name - Encoding name or label
+ * @returns The encoding's canonical name
+ * @throws {Error} If the encoding is not supported
+ */
+export function resolveEncoding(name: string): CharacterEncoding {
+  let encoding: string | undefined
+  try {
+    encoding = new TextDecoder(name.trim()).encoding
+  } catch {
+    encoding = undefined
+  }
+  if (!encoding || !(CHARACTER_ENCODINGS as readonly string[]).includes(encoding)) {
+    throw new Error(
+      `Unsupported encoding "${name}": use one of ${CHARACTER_ENCODINGS.join(", ")}.`
+    )
+  }
+  return encoding as CharacterEncoding
+}
+
+/**
+ * Encoding given by a byte order mark, if the data starts with one.
+ */
+function bomEncoding(data: Buffer): CharacterEncoding | undefined {
+  if (data[0] === 0xef && data[1] === 0xbb && data[2] === 0xbf) return "utf-8"
+  if (data[0] === 0xff && data[1] === 0xfe) return "utf-16le"
+  if (data[0] === 0xfe && data[1] === 0xff) return "utf-16be"
+  return undefined
+}
+
+/**
+ * A strict decoder, used like TextDecoder: pass `{ stream: true }` for every chunk but the
+ * last. Throws a TypeError on bytes that aren't valid in the encoding.
+ */
+export interface TextChunkDecoder {
+  decode(data?: Buffer, options?: { stream?: boolean }): string
+}
+
+/**
+ * Creates a strict decoder for an encoding.
+ *
+ * @param encoding - Encoding to decode
+ * @returns A decoder that drops a leading byte order mark
+ */
+export function createDecoder(encoding: CharacterEncoding): TextChunkDecoder {
+  // Node's TextDecoder decodes windows-1252 as ISO-8859-1, so 0x80-0x9F are mapped here
+  if (encoding === "windows-1252") {
+    return {
+      decode: (data = Buffer.alloc(0)) =>
+        Array.from(data, (byte) =>
+          byte >= 0x80 && byte < 0xa0 ? WINDOWS_1252_HIGH[byte - 0x80] : String.fromCharCode(byte)
+        ).join(""),
+    }
+  }
+  return new TextDecoder(encoding, { fatal: true })
+}
+
+/**
+ * Decodes data strictly, returning undefined if it isn't valid in the encoding. With `partial`,
+ * a character cut off at the end of the data is allowed (for the start of a file).
+ */
+function tryDecode(data: Buffer, encoding: CharacterEncoding, partial = false): string | undefined {
+  try {
+    return createDecoder(encoding).decode(data, { stream: partial })
+  } catch {
+    return undefined
+  }
+}
+
+/**
+ * Error for data that isn't valid in its encoding.
+ */
+function invalidEncodingError(name: string, encoding: CharacterEncoding): PrinterError {
+  return new PrinterError(
+    "UNSUPPORTED_FORMAT",
+    `Cannot decode ${name} as ${encoding}: it contains bytes that aren't valid ${encoding}.`,
+    {
+      suggestion: `Set encoding to the file's encoding (one of ${CHARACTER_ENCODINGS.join(", ")}), or leave it out to detect it.`,
+    }
+  )
+}
+
+/**
+ * Checks whether non-ASCII bytes come in runs, as in multibyte text, rather than one at a
+ * time between ASCII letters, as in accented Latin text.
+ */
+function hasMultibyteRuns(data: Buffer): boolean {
+  let runs = 0
+  let highBytes = 0
+  let previousHigh = false
+  for (const byte of data) {
+    const high = byte >= 0x80
+    if (high) {
+      highBytes++
+      if (!previousHigh) runs++
+    }
+    previousHigh = high
+  }
+  return runs > 0 && highBytes / runs >= 2
+}
+
+/**
+ * Scores how much decoded text reads like Japanese, Chinese, or Korean: kana (in Japanese
+ * encodings), ideographs, CJK punctuation, and Hangul count for it, and anything else outside
+ * ASCII (halfwidth katakana, control characters, stray symbols) against it. Hangul counts
+ * double in text with spaces between short words, so Chinese decoded as Korean loses.
+ */
+function cjkScore(text: string, encoding: CharacterEncoding): number {
+  const japanese = JAPANESE_ENCODINGS.includes(encoding)
+  const words = text.split(/[\x00-\x7f]+/).filter((word) => word !== "")
+  const spaced = words.length > 0 && [...words.join("")].length / words.length <= 4
+
+  let score = 0
+  for (const char of text) {
+    const code = char.codePointAt(0) ?? 0
+    if (code < 0x80) continue
+    if (code >= 0x3040 && code <= 0x30ff) {
+      score += japanese ? 2 : 1
+    } else if (code >= 0xac00 && code <= 0xd7a3) {
+      score += spaced ? 2 : 1
+    } else if (
+      (code >= 0x4e00 && code <= 0x9fff) ||
+      (code >= 0x3000 && code <= 0x303f) ||
+      (code >= 0xff01 && code <= 0xff5e)
+    ) {
+      score += 1
+    } else {
+      score -= 2
+    }
+  }
+  return score
+}
+
+/**
+ * Detects the encoding of text.
+ *
+ * @param data - The text's bytes, or the first bytes of a file
+ * @param name - Name of the file, for the error message
+ * @param truncated - Whether the data is only the start of the file (a character cut off at
+ *   the end is then allowed)
+ * @returns The detected encoding
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the encoding can't be worked out
+ */
+export function detectEncoding(
+  data: Buffer,
+  name = "the text",
+  truncated = false
+): CharacterEncoding {
+  const bom = bomEncoding(data)
+  if (bom) {
+    return bom
+  }
+  if (tryDecode(data, "utf-8", truncated) !== undefined) {
+    return "utf-8"
+  }
+
+  if (hasMultibyteRuns(data)) {
+    let best: { encoding: CharacterEncoding; score: number } | undefined
+    for (const encoding of CJK_CANDIDATES) {
+      const text = tryDecode(data, encoding, truncated)
+      const score = text === undefined ? 0 : cjkScore(text, encoding)
+      if (score > 0 && (!best || score > best.score)) {
+        best = { encoding, score }
+      }
+    }
+    if (best) {
+      return best.encoding
+    }
+  } else {
+    // C1 control characters mean the bytes aren't Windows-1252 text either
+    const text = tryDecode(data, "windows-1252") ?? ""
+    if (!/[\x80-\x9f]/.test(text)) {
+      return "windows-1252"
+    }
+  }
+
+  throw new PrinterError(
+    "UNSUPPORTED_FORMAT",
+    `Cannot detect the character encoding of ${name}.`,
+    {
+      suggestion: `Set encoding to the file's encoding: one of ${CHARACTER_ENCODINGS.join(", ")}.`,
+    }
+  )
+}
+
+/**
+ * Decodes text in a known or detected encoding. A byte order mark is dropped.
+ *
+ * @param data - The text's bytes
+ * @param encoding - Encoding name or label (default: detected)
+ * @param name - Name of the file, for error messages
+ * @returns The decoded text and its encoding
+ * @throws {Error} If the encoding is not supported
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the bytes aren't valid in the encoding, or the
+ *   encoding can't be detected
+ */
+export function decodeText(
+  data: Buffer,
+  encoding?: string,
+  name = "the text"
+): { text: string; encoding: CharacterEncoding } {
+  const resolved = encoding ? resolveEncoding(encoding) : detectEncoding(data, name)
+  const text = tryDecode(data, resolved)
+  if (text === undefined) {
+    throw invalidEncodingError(name, resolved)
+  }
+  return { text, encoding: resolved }
+}
+
+/**
+ * Reads a text file as a string, decoding it from its encoding.
+ *
+ * @param filePath - Path to the file
+ * @param encoding - Encoding name or label (default: detected)
+ * @returns The decoded text and its encoding
+ * @throws {Error} If the file can't be read or the encoding is not supported
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the file can't be decoded
+ */
+export function readTextFile(
+  filePath: string,
+  encoding?: string
+): { text: string; encoding: CharacterEncoding } {
+  return decodeText(readFileSync(filePath), encoding, basename(filePath))
+}
+
+/**
+ * Detects the encoding of a text file from its first 64 KB.
+ *
+ * @param filePath - Path to the file
+ * @returns The detected encoding
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the encoding can't be worked out
+ */
+export async function detectFileEncoding(filePath: string): Promise<CharacterEncoding> {
+  const file = await open(filePath, "r")
+  try {
+    const buffer = Buffer.alloc(DETECT_BYTES)
+    const { bytesRead } = await file.read(buffer, 0, DETECT_BYTES, 0)
+    const truncated = bytesRead === DETECT_BYTES && (await file.stat()).size > DETECT_BYTES
+    return detectEncoding(buffer.subarray(0, bytesRead), basename(filePath), truncated)
+  } finally {
+    await file.close()
+  }
+}
+
+/**
+ * Reads a text file one line at a time, decoding it as it is streamed, so large files never
+ * sit in memory whole. Line breaks (LF or CRLF) are not included.
+ *
+ * @param filePath - Path to the file
+ * @param encoding - Encoding of the file
+ * @yields Each line of the file
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the file isn't valid in the encoding
+ */
+export async function* readTextLines(
+  filePath: string,
+  encoding: CharacterEncoding
+): AsyncGenerator<string> {
+  const decoder = createDecoder(encoding)
+  const decode = (chunk?: Buffer) => {
+    try {
+      return decoder.decode(chunk, { stream: chunk !== undefined })
+    } catch {
+      throw invalidEncodingError(basename(filePath), encoding)
+    }
+  }
+  const stripCr = (line: string) => (line.endsWith("\r") ? line.slice(0, -1) : line)
+
+  let pending = ""
+  for await (const chunk of createReadStream(filePath)) {
+    const parts = decode(chunk as Buffer).split("\n")
+    parts[0] = pending + parts[0]
+    pending = parts.pop() ?? ""
+    for (const line of parts) {
+      yield stripCr(line)
+    }
+  }
+  pending += decode()
+  if (pending !== "") {
+    yield stripCr(pending)
+  }
+}
+
+/**
+ * Writes a UTF-8 copy of a text file, decoding it as it is streamed.
+ *
+ * @param filePath - Path to the file
+ * @param outputPath - Path of the copy
+ * @param encoding - Encoding of the file
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the file isn't valid in the encoding
+ */
+export async function transcodeToUtf8(
+  filePath: string,
+  outputPath: string,
+  encoding: CharacterEncoding
+): Promise<void> {
+  const decoder = createDecoder(encoding)
+  try {
+    await pipeline(
+      createReadStream(filePath),
+      async function* (source: AsyncIterable<Buffer>) {
+        for await (const chunk of source) {
+          yield decoder.decode(chunk, { stream: true })
+        }
+        yield decoder.decode()
+      },
+      createWriteStream(outputPath)
+    )
+  } catch (error) {
+    throw error instanceof TypeError ? invalidEncodingError(basename(filePath), encoding) : error
+  }
+}
@@ -0,0 +1,385 @@
+/**
+ * @fileoverview File type detection from content.
+ * The extension alone can't be trusted: a PDF saved as notes.txt would be printed as text,
+ * and files without an extension would be guessed at. The first bytes of a file are checked
+ * for magic numbers (PDF, PNG, JPEG, GIF, WebP, TIFF, PostScript, PCL, ZIP-based office
+ * documents) and byte order marks, and the content decides when the extension is missing or
+ * contradicts it. Binary files of unknown type are refused rather than printed as garbage.
+ * Label and receipt printer commands (ZPL, ESC/POS) are recognized too, so they are sent raw
+ * (to a printer allowed raw jobs) instead of being rendered as text.
+ */
+
+import { open } from "fs/promises"
+import { basename, extname } from "path"
+import { PrinterError } from "../errors.js"
+import { getLanguageFromExtension } from "./code.js"
+import type { CharacterEncoding } from "./encoding.js"
+
+/** Bytes read from the start of a file to detect its type. */
+export const SNIFF_BYTES = 8192
+
+/** Types of content that can be recognized. */
+export const CONTENT_TYPES = [
+  "pdf",
+  "png",
+  "jpeg",
+  "gif",
+  "webp",
+  "tiff",
+  "postscript",
+  "pcl",
+  "office",
+  "zpl",
+  "escpos",
+  "text",
+] as const
+export type ContentType = (typeof CONTENT_TYPES)[number]
+
+/** Values of the `format` option, which overrides detection. */
+export const FILE_FORMATS = ["pdf", "image", "markdown", "html", "code", "text"] as const
+export type FileFormat = (typeof FILE_FORMATS)[number]
+
+/**
+ * How a file is printed: rendered to PDF (image, markdown, html, code, text), sent as it is,
+ * or sent raw, bypassing the printing system's filters (label and receipt printer commands).
+ */
+export type PrintFormat = FileFormat | "postscript" | "tiff" | "pcl" | "office" | "raw"
+
+/** Text encodings recognized by their byte order mark. */
+export type TextEncoding = "utf-8" | "utf-16le" | "utf-16be"
+
+/**
+ * What the first bytes of a file contain.
+ */
+export interface SniffedContent {
+  /** Recognized content, or "unknown" for binary data of no known type */
+  type: ContentType | "unknown"
+  /** Encoding given by the byte order mark of a text file */
+  encoding?: TextEncoding
+  /** File extension for the content (e.g., "docx" for a ZIP holding a Word document) */
+  extension?: string
+}
+
+/**
+ * How print_file will treat a file.
+ */
+export interface FileTypeResolution {
+  format: PrintFormat
+  /** Recognized content (undefined when the format option was given) */
+  type?: ContentType
+  /** Whether the type came from the extension, the content, or the format option */
+  source: "extension" | "content" | "format"
+  /** Encoding of a text file, when it has a byte order mark or isn't UTF-8 */
+  encoding?: CharacterEncoding
+  /**
+   * Extension the file must be sent with so the printing system sees the right type, when
+   * its own extension says otherwise (the file is then printed from a copy)
+   */
+  extension?: string
+}
+
+/** Content types implied by file extensions. */
+const EXTENSION_TYPES: Record<string, ContentType> = {
+  pdf: "pdf",
+  png: "png",
+  jpg: "jpeg",
+  jpeg: "jpeg",
+  gif: "gif",
+  webp: "webp",
+  tif: "tiff",
+  tiff: "tiff",
+  ps: "postscript",
+  eps: "postscript",
+  pcl: "pcl",
+  docx: "office",
+  xlsx: "office",
+  pptx: "office",
+  odt: "office",
+  ods: "office",
+  odp: "office",
+  zpl: "zpl",
+  txt: "text",
+  text: "text",
+  md: "text",
+  markdown: "text",
+  html: "text",
+  htm: "text",
+  xhtml: "text",
+  csv: "text",
+  log: "text",
+}
+
+/** Extensions used for files sent as they are, by content type (raw content needs none). */
+const CONTENT_EXTENSIONS: Record<Exclude<ContentType, "office" | "zpl" | "escpos">, string> = {
+  pdf: "pdf",
+  png: "png",
+  jpeg: "jpg",
+  gif: "gif",
+  webp: "webp",
+  tiff: "tiff",
+  postscript: "ps",
+  pcl: "pcl",
+  text: "txt",
+}
+
+/** Folders that tell Word, Excel, and PowerPoint documents apart. */
+const OOXML_FOLDERS: Array<[string, string]> = [
+  ["word/", "docx"],
+  ["xl/", "xlsx"],
+  ["ppt/", "pptx"],
+]
+
+/** OpenDocument mimetype entries and their extensions. */
+const ODF_MIMETYPES: Array<[string, string]> = [
+  ["application/vnd.oasis.opendocument.text", "odt"],
+  ["application/vnd.oasis.opendocument.spreadsheet", "ods"],
+  ["application/vnd.oasis.opendocument.presentation", "odp"],
+]
+
+/**
+ * Recognizes a ZIP archive holding an office document (OOXML or OpenDocument).
+ */
+function sniffZip(data: Buffer): SniffedContent {
+  const text = data.toString("latin1")
+  const odf = ODF_MIMETYPES.find(([mimetype]) => text.includes(mimetype))
+  if (odf) {
+    return { type: "office", extension: odf[1] }
+  }
+  if (text.includes("[Content_Types].xml")) {
+    const ooxml = OOXML_FOLDERS.find(([folder]) => text.includes(folder))
+    if (ooxml) {
+      return { type: "office", extension: ooxml[1] }
+    }
+  }
+  return { type: "unknown" }
+}
+
+/**
+ * Checks whether bytes without a byte order mark look like text: no NUL bytes, and almost no
+ * control characters other than tab, line breaks, form feed, and escape.
+ */
+function looksLikeText(data: Buffer): boolean {
+  let control = 0
+  for (const byte of data) {
+    if (byte === 0) {
+      return false
+    }
+    if (byte < 0x20 && ![0x09, 0x0a, 0x0c, 0x0d, 0x1b].includes(byte)) {
+      control++
+    }
+  }
+  return control <= data.length / 100
+}
+
+/**
+ * Detects the type of content from its first bytes.
+ *
+ * @param data - The start of the file (a few KB is enough)
+ * @returns The content type, with the encoding of text that starts with a byte order mark
+ */
+export function sniffContent(data: Buffer): SniffedContent {
+  const starts = (signature: string) => data.toString("latin1", 0, signature.length) === signature
+
+  // Some PDF writers put a few bytes of junk before the header, which readers accept
+  if (data.toString("latin1", 0, 1024).includes("%PDF-")) return { type: "pdf" }
+  if (starts("\x89PNG\r\n\x1a\n")) return { type: "png" }
+  if (starts("\xff\xd8\xff")) return { type: "jpeg" }
+  if (starts("GIF87a") || starts("GIF89a")) return { type: "gif" }
+  if (starts("RIFF") && data.toString("latin1", 8, 12) === "WEBP") return { type: "webp" }
+  if (starts("II*\x00") || starts("MM\x00*")) return { type: "tiff" }
+  if (starts("%!") || starts("\xc5\xd0\xd3\xc6")) return { type: "postscript" }
+  if (starts("\x1bE") || starts("\x1b%-12345X")) return { type: "pcl" }
+  if (starts("PK\x03\x04")) return sniffZip(data)
+  // ESC/POS receipts start by resetting the printer (ESC @); ZPL labels open with ^XA, perhaps
+  // after a few ~ control commands
+  if (starts("\x1b@")) return { type: "escpos" }
+  if (/^\s*(?:~[A-Z]{2}[^^~]*)*\^XA/.test(data.toString("latin1", 0, 1024))) return { type: "zpl" }
+
+  if (starts("\xef\xbb\xbf")) return { type: "text", encoding: "utf-8" }
+  if (starts("\xff\xfe")) return { type: "text", encoding: "utf-16le" }
+  if (starts("\xfe\xff")) return { type: "text", encoding: "utf-16be" }
+  return looksLikeText(data) ? { type: "text" } : { type: "unknown" }
+}
+
+/** Names of the raw printer languages recognized from content. */
+const RAW_LANGUAGES: Partial<Record<ContentType, string>> = {
+  zpl: "ZPL",
+  escpos: "ESC/POS",
+}
+
+/**
+ * Recognizes label and receipt printer commands at the start of some data.
+ *
+ * @param data - The data, or its first few KB
+ * @returns "ZPL" or "ESC/POS", or undefined for anything else
+ */
+export function rawLanguage(data: Buffer): string | undefined {
+  const { type } = sniffContent(data)
+  return type === "unknown" ? undefined : RAW_LANGUAGES[type]
+}
+
+/**
+ * Finds the content type a file's extension (or, for files like Makefile, its name) implies.
+ *
+ * @param filePath - Path to the file
+ * @returns The implied content type, or undefined for missing and unrecognized extensions
+ */
+export function extensionType(filePath: string): ContentType | undefined {
+  const ext = extname(filePath).slice(1).toLowerCase()
+  if (ext in EXTENSION_TYPES) {
+    return EXTENSION_TYPES[ext]
+  }
+  return getLanguageFromExtension(filePath) !== "" ? "text" : undefined
+}
+
+/**
+ * Reads the first bytes of a file and detects its content.
+ *
+ * @param filePath - Path to the file
+ * @returns The detected content
+ */
+export async function sniffFile(filePath: string): Promise<SniffedContent> {
+  const file = await open(filePath, "r")
+  try {
+    const buffer = Buffer.alloc(SNIFF_BYTES)
+    const { bytesRead } = await file.read(buffer, 0, SNIFF_BYTES, 0)
+    return sniffContent(buffer.subarray(0, bytesRead))
+  } finally {
+    await file.close()
+  }
+}
+
+/**
+ * Checks whether content matches what an extension implies. PostScript is text, so either
+ * way round counts as a match. ZPL is text too, so a .zpl file that doesn't open with ^XA is
+ * still a label; text that does is a label whatever its extension.
+ */
+export function matchesExtension(content: ContentType, implied: ContentType): boolean {
+  const textual = (type: ContentType) => type === "text" || type === "postscript"
+  return (
+    content === implied ||
+    (textual(content) && textual(implied)) ||
+    (content === "text" && implied === "zpl")
+  )
+}
+
+/**
+ * Print format of recognized content.
+ */
+function contentFormat(type: ContentType, filePath: string): PrintFormat {
+  switch (type) {
+    case "png":
+    case "jpeg":
+    case "gif":
+    case "webp":
+      return "image"
+    case "text": {
+      const ext = extname(filePath).slice(1).toLowerCase()
+      if (ext === "md" || ext === "markdown") {
+        return "markdown"
+      }
+      return ext === "html" || ext === "htm" || ext === "xhtml" ? "html" : "text"
+    }
+    case "pdf":
+    case "tiff":
+    case "postscript":
+    case "pcl":
+    case "office":
+      return type
+    case "zpl":
+    case "escpos":
+      return "raw"
+  }
+}
+
+/**
+ * Decides how a file is printed. An explicit format wins. Otherwise the extension is used
+ * when it agrees with the content, and the content when the extension is missing or
+ * contradicts it.
+ *
+ * @param filePath - Path to the file
+ * @param format - The `format` option, if given
+ * @returns The print format and where it came from
+ * @throws {PrinterError} UNSUPPORTED_FORMAT for binary content of unknown type
+ */
+export async function resolveFileType(
+  filePath: string,
+  format?: FileFormat
+): Promise<FileTypeResolution> {
+  const implied = extensionType(filePath)
+
+  if (format) {
+    const type: ContentType | undefined =
+      format === "pdf" ? "pdf" : format === "image" ? undefined : "text"
+    const extension =
+      type && implied !== undefined && !matchesExtension(type, implied)
+        ? CONTENT_EXTENSIONS[type]
+        : undefined
+    return { format, source: "format", ...(extension ? { extension } : {}) }
+  }
+
+  const sniffed = await sniffFile(filePath)
+  if (sniffed.type === "unknown") {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot print ${basename(filePath)}: its content isn't a recognized document type ` +
+        `(PDF, image, text, PostScript, PCL, TIFF, or office document).`,
+      {
+        suggestion:
+          "Check that this is the file the user meant. To print it anyway, set format (e.g., 'pdf' or 'text').",
+      }
+    )
+  }
+
+  const encoding = sniffed.encoding ? { encoding: sniffed.encoding } : {}
+  if (implied !== undefined && matchesExtension(sniffed.type, implied)) {
+    return {
+      format: contentFormat(implied, filePath),
+      type: implied,
+      source: "extension",
+      ...encoding,
+    }
+  }
+
+  // Text with a missing or unknown extension (README, notes.log) is sent as it always was, and
+  // raw content needs no extension; anything else gets the extension of its content
+  const extension =
+    (sniffed.type === "text" && implied === undefined) ||
+    sniffed.type === "zpl" ||
+    sniffed.type === "escpos"
+      ? undefined
+      : sniffed.type === "office"
+        ? sniffed.extension
+        : CONTENT_EXTENSIONS[sniffed.type]
+  return {
+    format: contentFormat(sniffed.type, filePath),
+    type: sniffed.type,
+    source: "content",
+    ...encoding,
+    ...(extension ? { extension } : {}),
+  }
+}
+
+/**
+ * Describes a resolved file type for tool results (e.g., "pdf (detected from content)").
+ *
+ * @param resolution - Result of resolveFileType
+ * @returns Short description
+ */
+export function describeFileType(resolution: FileTypeResolution): string {
+  // Images and raw content are named by their type (e.g., "png", "zpl"); everything else by how
+  // it is printed
+  const type =
+    (resolution.format === "image" || resolution.format === "raw") && resolution.type
+      ? resolution.type
+      : resolution.format
+  const encoding = resolution.encoding ? `, ${resolution.encoding.toUpperCase()}` : ""
+  switch (resolution.source) {
+    case "extension":
+      return `${type}${encoding}`
+    case "content":
+      return `${type}${encoding} (detected from content)`
+    case "format":
+      return `${type} (format option)`
+  }
+}
@@ -0,0 +1,257 @@
+/**
+ * @fileoverview Header and footer templates for rendered output.
+ * Templates are plain text with {filename}, {title}, {date}, {page}, and {pages} placeholders,
+ * e.g. "{filename} — printed {date} — page {page} of {pages}". A template may be split into
+ * left, center, and right parts with "|" (e.g. "{title}||{page}/{pages}").
+ *
+ * Markdown is rendered with Puppeteer, so templates become Puppeteer header/footer HTML;
+ * code and plain text are rendered with the Chrome CLI, so templates become CSS @page margin
+ * boxes. Pre-made PDFs and images are printed untouched.
+ */
+
+import he from "he"
+import { config } from "../config.js"
+
+/** Placeholders a template may use. */
+export const TEMPLATE_PLACEHOLDERS = ["filename", "title", "date", "page", "pages"] as const
+
+/** Longest filename or title shown before it is truncated with an ellipsis. */
+export const MAX_PLACEHOLDER_LENGTH = 60
+
+/** Alignment of the "|"-separated parts of a template. */
+const ALIGNMENTS = ["left", "center", "right"] as const
+
+/**
+ * Header and footer templates. An empty string means no header (or footer).
+ */
+export interface HeaderFooter {
+  header?: string
+  footer?: string
+}
+
+/**
+ * Values substituted into a template (page numbers are filled in by Chrome).
+ */
+export interface TemplateContext {
+  filename: string
+  title: string
+  /** Print date (default: now) */
+  date?: Date
+}
+
+/**
+ * Resolves the header and footer for a render, with per-call templates overriding the
+ * configured MCP_PRINTER_HEADER / MCP_PRINTER_FOOTER. An empty per-call template turns the
+ * configured one off.
+ *
+ * @param options - Per-call templates
+ * @returns The templates in effect
+ */
+export function resolveHeaderFooter(options: HeaderFooter = {}): HeaderFooter {
+  return {
+    header: options.header ?? config.header,
+    footer: options.footer ?? config.footer,
+  }
+}
+
+/**
+ * Checks whether a header or footer is set.
+ *
+ * @param headerFooter - Resolved templates
+ * @returns True if there is something to print in the page margins
+ */
+export function hasHeaderFooter(headerFooter: HeaderFooter): boolean {
+  return Boolean(headerFooter.header || headerFooter.footer)
+}
+
+/**
+ * Validates that a template only uses known placeholders.
+ *
+ * @param template - Header or footer template
+ * @throws {Error} Naming the unknown placeholder and listing the supported ones
+ */
+export function validateTemplate(template: string): void {
+  for (const [, name] of template.matchAll(/\{(\w+)\}/g)) {
+    if (!(TEMPLATE_PLACEHOLDERS as readonly string[]).includes(name)) {
+      throw new Error(
+        `Unknown placeholder {${name}} in header/footer template. ` +
+          `Supported: ${TEMPLATE_PLACEHOLDERS.map((p) => `{${p}}`).join(", ")}`
+      )
+    }
+  }
+}
+
+/**
+ * Shortens text to at most `maxLength` characters by replacing the start with an ellipsis,
+ * keeping the end (the file name and extension of a long path).
+ *
+ * @param text - Text to shorten
+ * @param maxLength - Maximum length, including the ellipsis
+ * @returns The text, truncated if needed
+ */
+export function truncateStart(text: string, maxLength = MAX_PLACEHOLDER_LENGTH): string {
+  const chars = [...text]
+  return chars.length <= maxLength ? text : `…${chars.slice(-(maxLength - 1)).join("")}`
+}
+
+/**
+ * Formats a date as YYYY-MM-DD in local time.
+ */
+function formatDate(date: Date): string {
+  const pad = (value: number) => String(value).padStart(2, "0")
+  return `${date.getFullYear()}-${pad(date.getMonth() + 1)}-${pad(date.getDate())}`
+}
+
+/**
+ * A template split into text and page-number tokens.
+ */
+type TemplatePart = { text: string } | { counter: "page" | "pages" }
+
+/**
+ * Substitutes the text placeholders of a template and splits it into its aligned parts.
+ *
+ * @returns Up to three parts (left, center, right), each a list of tokens
+ */
+function parseTemplate(template: string, context: TemplateContext): TemplatePart[][] {
+  validateTemplate(template)
+  const values: Record<string, string> = {
+    filename: truncateStart(context.filename),
+    title: truncateStart(context.title),
+    date: formatDate(context.date ?? new Date()),
+  }
+
+  return template
+    .split("|")
+    .slice(0, ALIGNMENTS.length)
+    .map((section) =>
+      section
+        .split(/(\{page\}|\{pages\})/)
+        .filter(Boolean)
+        .map((piece): TemplatePart => {
+          if (piece === "{page}") return { counter: "page" }
+          if (piece === "{pages}") return { counter: "pages" }
+          return { text: piece.replace(/\{(\w+)\}/g, (_match, name: string) => values[name]) }
+        })
+    )
+}
+
+/** Style of header and footer text (inline, since Puppeteer templates can't load CSS). */
+const TEXT_STYLE =
+  "font-size: 8px; color: #666; font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', 'Noto Sans', Helvetica, Arial, sans-serif"
+
+/**
+ * Builds one Puppeteer header/footer template. Each part is clipped with an ellipsis if the
+ * text is still too wide for its third of the page.
+ */
+function puppeteerTemplate(template: string | undefined, context: TemplateContext): string {
+  if (!template) {
+    return "<div></div>"
+  }
+
+  const parts = parseTemplate(template, context).map((tokens, index) => {
+    const html = tokens
+      .map((token) =>
+        "counter" in token
+          ? `<span class="${token.counter === "page" ? "pageNumber" : "totalPages"}"></span>`
+          : he.encode(token.text)
+      )
+      .join("")
+    const style = `flex: 1; text-align: ${ALIGNMENTS[index]}; white-space: nowrap; overflow: hidden; text-overflow: ellipsis`
+    return `<span style="${style}">${html}</span>`
+  })
+
+  return `<div style="${TEXT_STYLE}; width: 100%; margin: 0; padding: 0 1cm; display: flex; gap: 1em">${parts.join("")}</div>`
+}
+
+/**
+ * Builds Puppeteer PDF options (as used in crossnote's `chrome` front-matter) that print the
+ * header and footer.
+ *
+ * @param headerFooter - Resolved templates
+ * @param context - Filename, title, and date
+ * @returns displayHeaderFooter, header/footer templates, and margins with room for them
+ */
+export function buildPuppeteerHeaderFooter(headerFooter: HeaderFooter, context: TemplateContext) {
+  return {
+    displayHeaderFooter: true,
+    headerTemplate: puppeteerTemplate(headerFooter.header, context),
+    footerTemplate: puppeteerTemplate(headerFooter.footer, context),
+    margin: {
+      top: headerFooter.header ? "1.5cm" : "1cm",
+      bottom: headerFooter.footer ? "1.5cm" : "1cm",
+      left: "1cm",
+      right: "1cm",
+    },
+  }
+}
+
+/**
+ * Encodes text as a CSS string literal.
+ */
+function cssString(text: string): string {
+  return `"${text.replace(/[\\"]/g, "\\$&").replace(/\n/g, "\\A ")}"`
+}
+
+/**
+ * Builds the @page margin box rules for one template.
+ */
+function cssMarginBoxes(
+  template: string | undefined,
+  edge: "top" | "bottom",
+  context: TemplateContext
+): string {
+  if (!template) {
+    return ""
+  }
+
+  return parseTemplate(template, context)
+    .map((tokens, index) => {
+      if (tokens.length === 0) {
+        return ""
+      }
+      const content = tokens
+        .map((token) => ("counter" in token ? `counter(${token.counter})` : cssString(token.text)))
+        .join(" ")
+      return `@${edge}-${ALIGNMENTS[index]} { content: ${content}; }`
+    })
+    .join("\n      ")
+}
+
+/**
+ * Builds CSS @page margin boxes that print the header and footer. Used for documents rendered
+ * with the Chrome CLI, which has no header/footer template option. Each box is clipped with
+ * an ellipsis if the text is still too wide for it.
+ *
+ * @param headerFooter - Resolved templates
+ * @param context - Filename, title, and date
+ * @returns CSS to add to the document's styles (empty if there is no header or footer)
+ */
+export function buildHeaderFooterCss(headerFooter: HeaderFooter, context: TemplateContext): string {
+  if (!hasHeaderFooter(headerFooter)) {
+    return ""
+  }
+
+  const boxes = [
+    cssMarginBoxes(headerFooter.header, "top", context),
+    cssMarginBoxes(headerFooter.footer, "bottom", context),
+  ].filter(Boolean)
+
+  const boxSelectors = ["top", "bottom"]
+    .flatMap((edge) => ALIGNMENTS.map((alignment) => `@${edge}-${alignment}`))
+    .join(", ")
+
+  return `@page {
+      ${boxes.join("\n      ")}
+    }
+
+    @page {
+      ${boxSelectors} {
+        font-size: 8pt;
+        color: #666;
+        font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Helvetica, Arial, sans-serif;
+        white-space: nowrap;
+        overflow: hidden;
+        text-overflow: ellipsis;
+      }
+    }`
+}
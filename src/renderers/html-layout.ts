@@ -0,0 +1,881 @@
+/**
+ * @fileoverview Basic HTML layout, used when Chrome isn't installed.
+ *
+ * Chrome renders HTML the way a browser shows it, but not every machine has it. This module
+ * lays simple documents out itself and writes the PDF directly, in the standard PDF fonts:
+ *
+ * 1. **Parsing**: Headings, paragraphs, line breaks, bold, italic, and monospace text, lists,
+ *    block quotes, preformatted text, tables, rules, and images are read from the markup.
+ *    There's no CSS, so styles are ignored, as are scripts, forms, frames, and the head.
+ *
+ * 2. **Layout**: Text is wrapped to the page width, and tables get columns sized to their
+ *    content, with borders and shaded header cells. Rows and lines move to the next page when
+ *    they don't fit.
+ *
+ * 3. **Images**: PNG and JPEG data: URIs (which inlineLocalImages makes of local images) are
+ *    embedded, scaled down to fit the page. Other images are shown by their alt text; nothing
+ *    is ever fetched.
+ */
+
+import he from "he"
+import { deflateSync } from "zlib"
+import { PdfMerger } from "../pdf/merge.js"
+import {
+  formatNumber,
+  PdfName,
+  PdfStream,
+  type PdfDict,
+  type PdfRef,
+  type PdfValue,
+} from "../pdf/document.js"
+import { encodeWinAnsi, measureText, standardFont, type StandardFont } from "../pdf/helvetica.js"
+import { pdfImage } from "../pdf/image.js"
+import type { MediaSize } from "../print-options.js"
+import { marginPoints, pageDimensions, type PageLayout } from "./page-layout.js"
+import { DEFAULT_TAB_WIDTH, expandTabs } from "./text.js"
+
+/** Page margin on every side unless others are set, in points (three quarters of an inch). */
+const MARGIN = 54
+
+/** Font size of body text, in points. */
+const BODY_SIZE = 11
+
+/** Font size of preformatted text, in points. */
+const PRE_SIZE = 9
+
+/** Line height, as a multiple of the font size. */
+const LINE_HEIGHT = 1.3
+
+/** Font sizes of h1 to h6, in points. */
+const HEADING_SIZES: Record<string, number> = { h1: 22, h2: 17, h3: 14, h4: 12, h5: 11, h6: 10 }
+
+/** Indent of each level of list or block quote, in points. */
+const INDENT = 20
+
+/** Space between a table cell's border and its text, in points. */
+const CELL_PADDING = 4
+
+/** Points per CSS pixel (96 pixels per inch, 72 points per inch). */
+const POINTS_PER_PIXEL = 0.75
+
+/** Elements skipped along with everything in them. */
+const SKIPPED_ELEMENTS =
+  /<(head|script|style|title|noscript|template|svg|math|iframe|object|select|textarea)\b[\s\S]*?<\/\1\s*>/gi
+
+/** Elements that start a new block of text. */
+const BLOCK_ELEMENTS = new Set([
+  "address",
+  "article",
+  "aside",
+  "blockquote",
+  "body",
+  "caption",
+  "dd",
+  "div",
+  "dl",
+  "dt",
+  "fieldset",
+  "figcaption",
+  "figure",
+  "footer",
+  "form",
+  "h1",
+  "h2",
+  "h3",
+  "h4",
+  "h5",
+  "h6",
+  "header",
+  "hr",
+  "html",
+  "li",
+  "main",
+  "nav",
+  "ol",
+  "p",
+  "pre",
+  "section",
+  "table",
+  "ul",
+])
+
+/** Tags, attributes, and text of the markup, in order. */
+const TOKEN = /<!--[\s\S]*?-->|<[!?][^>]*>|<(\/?)([a-zA-Z][\w:-]*)([^>]*)>|([^<]+)|</g
+
+/** An attribute, with its value in double, single, or no quotes. */
+const ATTRIBUTE = /([^\s"'>/=]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>`]+)))?/g
+
+/**
+ * Text in one font and size.
+ */
+interface Run {
+  text: string
+  font: StandardFont
+  size: number
+}
+
+/**
+ * A table cell.
+ */
+interface Cell {
+  runs: Run[]
+  /** Whether it is a header cell (th), drawn bold on a shaded background */
+  header: boolean
+  /** Columns the cell spans */
+  span: number
+}
+
+/**
+ * Something laid out on the page, one after another.
+ */
+type Block =
+  | { type: "text"; runs: Run[]; indent: number; marker?: string; spaceBefore: number }
+  | { type: "pre"; text: string; indent: number }
+  | { type: "table"; rows: Cell[][] }
+  | { type: "rule" }
+  | { type: "image"; src: string; alt: string; width?: number; height?: number; indent: number }
+
+/**
+ * A wrapped line of text, in segments of one font and size (text in WinAnsi bytes).
+ */
+interface Line {
+  segments: Run[]
+  /** Width in points */
+  width: number
+  /** Largest font size on the line */
+  size: number
+}
+
+/**
+ * Reads the attributes of a tag, decoding character references in their values.
+ */
+function parseAttributes(source: string): Map<string, string> {
+  const attributes = new Map<string, string>()
+  for (const match of source.matchAll(ATTRIBUTE)) {
+    const value = match[2] ?? match[3] ?? match[4] ?? ""
+    attributes.set(match[1].toLowerCase(), he.decode(value))
+  }
+  return attributes
+}
+
+/**
+ * Reads a length in CSS pixels from a width or height attribute ("120" or "120px").
+ */
+function pixels(value: string | undefined): number | undefined {
+  const match = value?.trim().match(/^(\d+(?:\.\d+)?)(px)?$/i)
+  return match ? parseFloat(match[1]) : undefined
+}
+
+/**
+ * Builds the list of blocks from HTML, keeping track of the open inline styles, lists, and
+ * the table being read.
+ */
+class HtmlParser {
+  readonly blocks: Block[] = []
+  private runs: Run[] = []
+  private preText = ""
+  private bold = 0
+  private italic = 0
+  private mono = 0
+  private pre = 0
+  private quotes = 0
+  private heading: number | undefined
+  private marker: string | undefined
+  private readonly lists: Array<{ ordered: boolean; count: number }> = []
+  private table: Cell[][] | undefined
+  private tableDepth = 0
+  private row: Cell[] | undefined
+  private cell: Cell | undefined
+
+  /**
+   * Reads a document.
+   */
+  parse(html: string): Block[] {
+    for (const match of html.replace(SKIPPED_ELEMENTS, "").matchAll(TOKEN)) {
+      const [token, closing, name, attributes, text] = match
+      if (name) {
+        if (closing) {
+          this.close(name.toLowerCase())
+        } else {
+          this.open(name.toLowerCase(), attributes)
+        }
+      } else if (text !== undefined || token === "<") {
+        this.text(he.decode(text ?? token))
+      }
+    }
+    this.flush()
+    if (this.table) {
+      this.blocks.push({ type: "table", rows: this.table })
+    }
+    return this.blocks
+  }
+
+  private open(name: string, attributeSource: string): void {
+    if (BLOCK_ELEMENTS.has(name) && this.cell === undefined) {
+      this.flush()
+    }
+    const attributes = () => parseAttributes(attributeSource)
+    switch (name) {
+      case "b":
+      case "strong":
+        this.bold++
+        break
+      case "i":
+      case "em":
+      case "cite":
+      case "var":
+      case "dfn":
+        this.italic++
+        break
+      case "code":
+      case "kbd":
+      case "samp":
+      case "tt":
+        this.mono++
+        break
+      case "br":
+        this.addRun("\n")
+        break
+      case "h1":
+      case "h2":
+      case "h3":
+      case "h4":
+      case "h5":
+      case "h6":
+        this.heading = HEADING_SIZES[name]
+        this.bold++
+        break
+      case "ul":
+      case "ol":
+        this.lists.push({
+          ordered: name === "ol",
+          count: (pixels(attributes().get("start")) ?? 1) - 1,
+        })
+        break
+      case "li": {
+        const list = this.lists[this.lists.length - 1]
+        this.marker = list?.ordered ? `${++list.count}.` : "•"
+        break
+      }
+      case "blockquote":
+        this.quotes++
+        break
+      case "pre":
+        this.pre++
+        break
+      case "hr":
+        this.blocks.push({ type: "rule" })
+        break
+      case "img":
+        this.image(attributes())
+        break
+      case "table":
+        if (this.tableDepth++ === 0) {
+          this.table = []
+        }
+        break
+      case "tr":
+        if (this.tableDepth === 1) {
+          this.row = []
+          this.table?.push(this.row)
+        } else if (this.cell) {
+          this.addRun("\n")
+        }
+        break
+      case "td":
+      case "th":
+        if (this.tableDepth === 1) {
+          if (!this.row) {
+            this.row = []
+            this.table?.push(this.row)
+          }
+          const span = Math.max(1, Math.min(pixels(attributes().get("colspan")) ?? 1, 100))
+          this.cell = { runs: [], header: name === "th", span: Math.floor(span) }
+          this.row.push(this.cell)
+        } else {
+          this.addRun(" ")
+        }
+        break
+    }
+  }
+
+  private close(name: string): void {
+    switch (name) {
+      case "b":
+      case "strong":
+        this.bold = Math.max(this.bold - 1, 0)
+        break
+      case "i":
+      case "em":
+      case "cite":
+      case "var":
+      case "dfn":
+        this.italic = Math.max(this.italic - 1, 0)
+        break
+      case "code":
+      case "kbd":
+      case "samp":
+      case "tt":
+        this.mono = Math.max(this.mono - 1, 0)
+        break
+      case "h1":
+      case "h2":
+      case "h3":
+      case "h4":
+      case "h5":
+      case "h6":
+        this.flush()
+        this.heading = undefined
+        this.bold = Math.max(this.bold - 1, 0)
+        break
+      case "ul":
+      case "ol":
+        this.flush()
+        this.lists.pop()
+        break
+      case "blockquote":
+        this.flush()
+        this.quotes = Math.max(this.quotes - 1, 0)
+        break
+      case "pre":
+        this.flush()
+        this.pre = Math.max(this.pre - 1, 0)
+        break
+      case "td":
+      case "th":
+        if (this.tableDepth === 1) {
+          this.cell = undefined
+        }
+        break
+      case "tr":
+        if (this.tableDepth === 1) {
+          this.row = undefined
+        }
+        break
+      case "table":
+        if (this.tableDepth > 0 && --this.tableDepth === 0) {
+          this.flush()
+          this.blocks.push({ type: "table", rows: this.table ?? [] })
+          this.table = this.row = this.cell = undefined
+        }
+        break
+      default:
+        if (BLOCK_ELEMENTS.has(name) && this.cell === undefined) {
+          this.flush()
+        }
+    }
+  }
+
+  /**
+   * Adds text, collapsing white space outside preformatted text.
+   */
+  private text(text: string): void {
+    if (this.pre > 0 && this.cell === undefined) {
+      this.preText += text
+      return
+    }
+    this.addRun(text.replace(/\s+/g, " "))
+  }
+
+  /**
+   * Adds text in the current style to the cell or block being read.
+   */
+  private addRun(text: string): void {
+    const runs = this.cell?.runs ?? this.runs
+    const last = runs[runs.length - 1]
+    if (!last || /[ \n]$/.test(last.text)) {
+      text = text.replace(/^ +/, "")
+    }
+    if (!text) {
+      return
+    }
+    const header = this.cell?.header ?? false
+    const bold = this.bold > 0 || header
+    const font: StandardFont =
+      this.mono > 0
+        ? "Courier"
+        : bold && this.italic > 0
+          ? "Helvetica-BoldOblique"
+          : bold
+            ? "Helvetica-Bold"
+            : this.italic > 0
+              ? "Helvetica-Oblique"
+              : "Helvetica"
+    const size = this.heading ?? BODY_SIZE
+    if (last && last.font === font && last.size === size) {
+      last.text += text
+    } else {
+      runs.push({ text, font, size })
+    }
+  }
+
+  /**
+   * Adds an image as a block of its own, or its alt text inside a table.
+   */
+  private image(attributes: Map<string, string>): void {
+    const alt = attributes.get("alt") ?? ""
+    if (this.cell) {
+      this.addRun(alt ? `[${alt}]` : "[image]")
+      return
+    }
+    this.flush()
+    this.blocks.push({
+      type: "image",
+      src: attributes.get("src") ?? "",
+      alt,
+      width: pixels(attributes.get("width")),
+      height: pixels(attributes.get("height")),
+      indent: this.indent,
+    })
+  }
+
+  private get indent(): number {
+    return (this.lists.length + this.quotes) * INDENT
+  }
+
+  /**
+   * Ends the block of text being read.
+   */
+  private flush(): void {
+    const text = this.preText.replace(/^\r?\n/, "").trimEnd()
+    this.preText = ""
+    if (text) {
+      this.blocks.push({ type: "pre", text, indent: this.indent })
+    }
+
+    const runs = this.runs
+    this.runs = []
+    while (runs.length > 0 && !runs[runs.length - 1].text.trim()) {
+      runs.pop()
+    }
+    if (runs.length === 0) {
+      return
+    }
+    runs[runs.length - 1].text = runs[runs.length - 1].text.trimEnd()
+    const spaceBefore = this.heading
+      ? this.heading * 0.6
+      : this.marker
+        ? BODY_SIZE * 0.25
+        : BODY_SIZE * 0.6
+    this.blocks.push({ type: "text", runs, indent: this.indent, marker: this.marker, spaceBefore })
+    this.marker = undefined
+  }
+}
+
+/**
+ * Encodes text for a standard font, replacing characters it doesn't have with "?".
+ */
+function winAnsi(text: string): string {
+  return (encodeWinAnsi(text, "?") ?? Buffer.alloc(0)).toString("latin1")
+}
+
+/**
+ * Measures encoded text, in points.
+ */
+function width(text: string, run: { font: StandardFont; size: number }): number {
+  return (measureText(text, run.font) * run.size) / 1000
+}
+
+/**
+ * Builds a line of encoded text in one font and size.
+ */
+function textLine(text: string, font: StandardFont, size: number): Line {
+  return { segments: [{ text, font, size }], width: width(text, { font, size }), size }
+}
+
+/**
+ * Wraps runs of text to a width, at spaces, breaking words only when they are wider than a
+ * line.
+ */
+function wrapRuns(runs: Run[], maxWidth: number): Line[] {
+  const lines: Line[] = []
+  let line: Line = { segments: [], width: 0, size: runs[0]?.size ?? BODY_SIZE }
+  const append = (text: string, run: Run) => {
+    const last = line.segments[line.segments.length - 1]
+    if (last && last.font === run.font && last.size === run.size) {
+      last.text += text
+    } else {
+      line.segments.push({ text, font: run.font, size: run.size })
+    }
+    line.width += width(text, run)
+    line.size = line.segments.length === 1 ? run.size : Math.max(line.size, run.size)
+  }
+  const breakLine = (run: Run) => {
+    const last = line.segments[line.segments.length - 1]
+    if (last) {
+      const trimmed = last.text.trimEnd()
+      line.width -= width(last.text.slice(trimmed.length), last)
+      last.text = trimmed
+    }
+    lines.push(line)
+    line = { segments: [], width: 0, size: run.size }
+  }
+
+  for (const run of runs) {
+    for (const part of run.text.split(/(\n)/)) {
+      if (part === "\n") {
+        breakLine(run)
+        continue
+      }
+      for (const word of part.match(/\S+\s*|\s+/g) ?? []) {
+        let text = winAnsi(word)
+        if (line.segments.length > 0 && line.width + width(text.trimEnd(), run) > maxWidth) {
+          breakLine(run)
+        }
+        if (line.segments.length === 0) {
+          text = text.trimStart()
+        }
+        while (text.length > 1 && width(text.trimEnd(), run) > maxWidth - line.width) {
+          let fits = text.length - 1
+          while (fits > 1 && width(text.slice(0, fits), run) > maxWidth - line.width) {
+            fits--
+          }
+          append(text.slice(0, fits), run)
+          breakLine(run)
+          text = text.slice(fits)
+        }
+        if (text) {
+          append(text, run)
+        }
+      }
+    }
+  }
+  if (line.segments.length > 0) {
+    breakLine(runs[runs.length - 1])
+  }
+  return lines
+}
+
+/**
+ * Writes pages one after another, moving down each page as things are drawn.
+ */
+class PageWriter {
+  readonly merger = new PdfMerger()
+  readonly left: number
+  readonly right: number
+  readonly top: number
+  readonly bottom: number
+  /** Position of the next thing drawn, from the bottom of the page */
+  y: number
+  private readonly width: number
+  private readonly height: number
+  private readonly fonts: PdfDict = new Map()
+  /** Resource names of the fonts used so far */
+  private readonly fontNames = new Map<StandardFont, string>()
+  private readonly xobjects: PdfDict = new Map()
+  /** Resources shared by every page (filled in as fonts and images are used) */
+  private readonly resources: PdfRef
+  private content: string[] = []
+
+  constructor(media: MediaSize, layout: PageLayout) {
+    const { width, height } = pageDimensions(media, layout.orientation)
+    this.width = width
+    this.height = height
+    this.left = marginPoints(layout.margins, "left", MARGIN)
+    this.right = width - marginPoints(layout.margins, "right", MARGIN)
+    this.top = height - marginPoints(layout.margins, "top", MARGIN)
+    this.bottom = marginPoints(layout.margins, "bottom", MARGIN)
+    this.y = this.top
+    this.resources = this.merger.add(
+      new Map<string, PdfValue>([
+        ["Font", this.fonts],
+        ["XObject", this.xobjects],
+      ])
+    )
+  }
+
+  /** Whether nothing has been drawn on the page yet. */
+  get atTop(): boolean {
+    return this.y >= this.top
+  }
+
+  /**
+   * Leaves space before the next thing drawn, except at the top of a page.
+   */
+  gap(space: number): void {
+    if (!this.atTop) {
+      this.y -= space
+    }
+  }
+
+  /**
+   * Moves to a new page unless there's room for something this tall (or the page is empty).
+   */
+  fit(height: number): void {
+    if (this.y - height < this.bottom && !this.atTop) {
+      this.endPage()
+    }
+  }
+
+  /**
+   * Draws a line of text with its top at the given position.
+   */
+  drawLine(line: Line, x: number, top: number): void {
+    const baseline = top - line.size
+    const ops = ["BT", `1 0 0 1 ${formatNumber(x)} ${formatNumber(baseline)} Tm`]
+    for (const segment of line.segments) {
+      ops.push(`/${this.font(segment.font)} ${formatNumber(segment.size)} Tf`)
+      ops.push(`<${Buffer.from(segment.text, "latin1").toString("hex")}> Tj`)
+    }
+    ops.push("ET")
+    this.content.push(...ops)
+  }
+
+  /**
+   * Draws lines of text down the page, moving to new pages as needed.
+   */
+  writeLines(lines: Line[], x: number): void {
+    for (const line of lines) {
+      const height = line.size * LINE_HEIGHT
+      this.fit(height)
+      this.drawLine(line, x, this.y)
+      this.y -= height
+    }
+  }
+
+  /**
+   * Adds raw content stream operators (for rules, borders, and shading).
+   */
+  draw(...ops: string[]): void {
+    this.content.push(...ops)
+  }
+
+  /**
+   * Adds an image and returns its resource name.
+   */
+  addImage(data: Buffer): { name: string; width: number; height: number } | undefined {
+    const image = pdfImage(data)
+    if (!image) {
+      return undefined
+    }
+    if (image.mask) {
+      image.stream.dict.set("SMask", this.merger.add(image.mask))
+    }
+    const name = `Im${this.xobjects.size + 1}`
+    this.xobjects.set(name, this.merger.add(image.stream))
+    return { name, width: image.width, height: image.height }
+  }
+
+  /**
+   * Finishes the last page and writes the PDF.
+   */
+  finish(): Buffer {
+    if (this.content.length > 0 || this.merger.pageCount === 0) {
+      this.endPage()
+    }
+    return this.merger.toBuffer()
+  }
+
+  private font(font: StandardFont): string {
+    const existing = this.fontNames.get(font)
+    if (existing) {
+      return existing
+    }
+    const name = `F${this.fonts.size + 1}`
+    this.fonts.set(name, this.merger.add(standardFont(font)))
+    this.fontNames.set(font, name)
+    return name
+  }
+
+  private endPage(): void {
+    const data = deflateSync(Buffer.from(this.content.join("\n"), "latin1"))
+    this.merger.addPage(
+      new Map<string, PdfValue>([
+        ["MediaBox", [0, 0, this.width, this.height]],
+        ["Resources", this.resources],
+        [
+          "Contents",
+          this.merger.add(new PdfStream(new Map([["Filter", new PdfName("FlateDecode")]]), data)),
+        ],
+      ])
+    )
+    this.content = []
+    this.y = this.top
+  }
+}
+
+/**
+ * Lays out a table: columns are sized between the longest word and the whole text of their
+ * cells, and rows move to the next page when they don't fit.
+ */
+function writeTable(writer: PageWriter, rows: Cell[][]): void {
+  const columns = Math.max(0, ...rows.map((row) => row.reduce((sum, cell) => sum + cell.span, 0)))
+  if (columns === 0) {
+    return
+  }
+  const available = writer.right - writer.left
+  const minimum = new Array<number>(columns).fill(2 * CELL_PADDING + 12)
+  const natural = [...minimum]
+  for (const row of rows) {
+    let column = 0
+    for (const cell of row) {
+      if (cell.span === 1) {
+        for (const run of cell.runs) {
+          for (const part of run.text.split("\n")) {
+            const words = part.split(/\s+/).map((word) => width(winAnsi(word), run))
+            minimum[column] = Math.max(minimum[column], 2 * CELL_PADDING + Math.max(0, ...words))
+            natural[column] = Math.max(
+              natural[column],
+              2 * CELL_PADDING + width(winAnsi(part), run)
+            )
+          }
+        }
+      }
+      column += cell.span
+    }
+  }
+
+  // Whole text when it fits, shrinking toward the longest words when it doesn't
+  const sum = (values: number[]) => values.reduce((total, value) => total + value, 0)
+  const [minTotal, naturalTotal] = [sum(minimum), sum(natural)]
+  const widths =
+    naturalTotal <= available
+      ? natural
+      : minTotal >= available
+        ? minimum.map((value) => (value * available) / minTotal)
+        : minimum.map(
+            (value, i) =>
+              value + ((natural[i] - value) * (available - minTotal)) / (naturalTotal - minTotal)
+          )
+
+  for (const row of rows) {
+    let column = 0
+    const cells = row.map((cell) => {
+      const cellWidth = sum(widths.slice(column, column + cell.span))
+      const x = writer.left + sum(widths.slice(0, column))
+      column += cell.span
+      const lines = wrapRuns(cell.runs, cellWidth - 2 * CELL_PADDING)
+      const textHeight = sum(lines.map((line) => line.size * LINE_HEIGHT))
+      return { cell, x, width: cellWidth, lines, height: textHeight + 2 * CELL_PADDING }
+    })
+    const height = Math.max(
+      BODY_SIZE * LINE_HEIGHT + 2 * CELL_PADDING,
+      ...cells.map((cell) => cell.height)
+    )
+    writer.fit(height)
+    const bottom = writer.y - height
+    for (const { cell, x, width: cellWidth, lines } of cells) {
+      const box = [x, bottom, cellWidth, height].map(formatNumber).join(" ")
+      if (cell.header) {
+        writer.draw("0.9 g", `${box} re f`, "0 g")
+      }
+      writer.draw("0.5 w 0.6 G", `${box} re S`, "0 G")
+      let top = writer.y - CELL_PADDING
+      for (const line of lines) {
+        writer.drawLine(line, x + CELL_PADDING, top)
+        top -= line.size * LINE_HEIGHT
+      }
+    }
+    writer.y = bottom
+  }
+}
+
+/**
+ * Draws an image scaled down to fit the page, or its alt text when it can't be embedded.
+ */
+function writeImage(writer: PageWriter, block: Extract<Block, { type: "image" }>): void {
+  const data = block.src.match(/^data:[^,]*;base64,(.*)$/is)
+  const image = data ? writer.addImage(Buffer.from(data[1], "base64")) : undefined
+  const left = writer.left + block.indent
+  if (!image) {
+    const alt: Run = {
+      text: block.alt ? `[image: ${block.alt}]` : "[image]",
+      font: "Helvetica-Oblique",
+      size: BODY_SIZE,
+    }
+    writer.gap(BODY_SIZE * 0.6)
+    writer.draw("0.4 g")
+    writer.writeLines(wrapRuns([alt], writer.right - left), left)
+    writer.draw("0 g")
+    return
+  }
+
+  const aspect = image.height / image.width
+  const widthPx = block.width ?? (block.height ? block.height / aspect : image.width)
+  const heightPx = block.height ?? widthPx * aspect
+  const scale = Math.min(
+    1,
+    (writer.right - left) / (widthPx * POINTS_PER_PIXEL),
+    (writer.top - writer.bottom) / (heightPx * POINTS_PER_PIXEL)
+  )
+  const [w, h] = [widthPx * POINTS_PER_PIXEL * scale, heightPx * POINTS_PER_PIXEL * scale]
+  writer.gap(BODY_SIZE * 0.6)
+  writer.fit(h)
+  writer.draw(
+    "q",
+    `${[w, 0, 0, h, left, writer.y - h].map(formatNumber).join(" ")} cm`,
+    `/${image.name} Do`,
+    "Q"
+  )
+  writer.y -= h
+}
+
+/**
+ * Lays out an HTML document on pages of the given size and writes it as a PDF.
+ *
+ * @param html - The document
+ * @param media - Paper size (default: Letter)
+ * @param layout - Page orientation and margins (default: portrait, three quarters of an inch)
+ * @returns The PDF's bytes
+ */
+export function layoutHtmlToPdf(
+  html: string,
+  media: MediaSize = "Letter",
+  layout: PageLayout = {}
+): Buffer {
+  const writer = new PageWriter(media, layout)
+  for (const block of new HtmlParser().parse(html)) {
+    switch (block.type) {
+      case "text": {
+        const left = writer.left + block.indent
+        const lines = wrapRuns(block.runs, writer.right - left)
+        writer.gap(block.spaceBefore)
+        if (block.marker && lines.length > 0) {
+          // The marker hangs in the indent, level with the first line
+          const marker = textLine(winAnsi(block.marker), "Helvetica", lines[0].size)
+          writer.fit(marker.size * LINE_HEIGHT)
+          writer.drawLine(marker, left - marker.width - 6, writer.y)
+        }
+        writer.writeLines(lines, left)
+        break
+      }
+      case "pre": {
+        const left = writer.left + block.indent
+        const run = { font: "Courier" as const, size: PRE_SIZE }
+        const columns = Math.max(1, Math.floor((writer.right - left) / width("M", run)))
+        const lines = block.text.split(/\r?\n/).flatMap((source) => {
+          const expanded = winAnsi(expandTabs(source, DEFAULT_TAB_WIDTH))
+          const pieces: string[] = []
+          for (let i = 0; i < expanded.length; i += columns) {
+            pieces.push(expanded.slice(i, i + columns))
+          }
+          return (pieces.length > 0 ? pieces : [""]).map((text) =>
+            textLine(text, "Courier", PRE_SIZE)
+          )
+        })
+        writer.gap(BODY_SIZE * 0.6)
+        writer.writeLines(lines, left)
+        break
+      }
+      case "table":
+        writer.gap(BODY_SIZE * 0.6)
+        writeTable(writer, block.rows)
+        break
+      case "rule":
+        writer.gap(BODY_SIZE * 0.6)
+        writer.fit(1)
+        writer.draw(
+          "0.5 w 0.6 G",
+          `${formatNumber(writer.left)} ${formatNumber(writer.y)} m`,
+          `${formatNumber(writer.right)} ${formatNumber(writer.y)} l S`,
+          "0 G"
+        )
+        writer.y -= 1
+        break
+      case "image":
+        writeImage(writer, block)
+        break
+    }
+  }
+  return writer.finish()
+}
@@ -0,0 +1,239 @@
+/**
+ * @fileoverview HTML renderer.
+ *
+ * Saved reports and pages printed with print_text may come from anywhere, so HTML is rendered
+ * in a sandbox:
+ *
+ * 1. **Local images**: Relative `<img src>` paths (and file: URLs) are read from disk and
+ *    inlined as data: URIs, when they pass path validation. The page is rendered from a temp
+ *    file, so nothing else on disk can be reached from it.
+ *
+ * 2. **Sandbox**: JavaScript is disabled, and a Content Security Policy stops the page from
+ *    loading frames, stylesheets, fonts, or images other than inline ones. Chrome runs without
+ *    network access unless `allowRemoteResources` is set, which lets the page load http(s)
+ *    images, stylesheets, and fonts (scripts stay disabled).
+ *
+ * 3. **PDF Generation**: Chrome headless renders the page (MCP_PRINTER_CHROME_PATH, or an
+ *    installed Chrome, Chromium, or Edge). Without Chrome, the basic layout in html-layout.ts
+ *    renders simple documents itself; it never fetches anything. An orientation or margins
+ *    given to the renderer win over the page's own @page rules.
+ */
+
+import { readFileSync, rmSync, writeFileSync } from "fs"
+import { dirname, join, resolve } from "path"
+import { fileURLToPath } from "url"
+import he from "he"
+import { convertHtmlToPdf, findChrome } from "../utils.js"
+import { validateFilePath } from "../file-security.js"
+import { throwIfAborted } from "../timeouts.js"
+import type { MediaSize } from "../print-options.js"
+import { readImageInfo } from "./image.js"
+import { readTextFile, type CharacterEncoding } from "./encoding.js"
+import { layoutHtmlToPdf } from "./html-layout.js"
+import { pageLayoutCss, validatePageMargins, type PageLayout } from "./page-layout.js"
+import { createTempDir } from "../temp-files.js"
+
+/** Chrome flag that disables JavaScript, kept when remote resources are allowed. */
+const NO_SCRIPT_FLAG = "--blink-settings=scriptEnabled=false"
+
+/**
+ * Chrome flags for rendering untrusted HTML: no JavaScript and no network access, so the page
+ * can't load subresources from (or send requests to) other hosts.
+ */
+export const SANDBOX_CHROME_FLAGS = [
+  NO_SCRIPT_FLAG,
+  "--host-resolver-rules=MAP * ~NOTFOUND",
+  "--proxy-server=127.0.0.1:9",
+  "--proxy-bypass-list=<-loopback>",
+]
+
+/**
+ * Content Security Policy of sandboxed HTML: the page is rendered from a local file, so this
+ * stops it from pulling in other local files as images, frames, or stylesheets.
+ */
+const HTML_CSP = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; font-src data:"
+
+/** Content Security Policy when remote resources are allowed: http(s) subresources load too. */
+const REMOTE_HTML_CSP =
+  "default-src 'none'; style-src 'unsafe-inline' http: https:; img-src data: http: https:; " +
+  "font-src data: http: https:"
+
+/**
+ * Options for rendering HTML to PDF.
+ */
+export interface RenderHtmlOptions extends PageLayout {
+  /** Let the page load http(s) images, stylesheets, and fonts (default: false) */
+  allowRemoteResources?: boolean
+  /** Character encoding of the file (default: detected) */
+  encoding?: CharacterEncoding
+  /**
+   * Paper size of the basic layout used without Chrome, and of Chrome's pages when an
+   * orientation or margins are set (default: Letter)
+   */
+  media?: MediaSize
+  /** The MCP request's signal, which cancels the render */
+  signal?: AbortSignal
+}
+
+/**
+ * A rendered HTML document.
+ */
+export interface RenderedHtml {
+  /** Path to the generated temporary PDF file */
+  pdfPath: string
+  /** Description of the rendering (e.g., "html → PDF") */
+  renderType: string
+}
+
+/**
+ * Adds a Content Security Policy to a page, inside <head> when there is one so the doctype is
+ * preserved, and removes meta refreshes, which could send the page somewhere else.
+ *
+ * @param html - The page
+ * @param allowRemoteResources - Whether http(s) images, stylesheets, and fonts may load
+ * @returns The page with the policy
+ */
+export function withContentSecurityPolicy(html: string, allowRemoteResources = false): string {
+  const policy = allowRemoteResources ? REMOTE_HTML_CSP : HTML_CSP
+  const meta = `<meta http-equiv="Content-Security-Policy" content="${policy}">`
+  const page = html.replace(/<meta\b[^>]*http-equiv\s*=\s*["']?refresh[^>]*>/gi, "")
+  const head = page.match(/<head(\s[^>]*)?>/i)
+  if (head?.index !== undefined) {
+    const end = head.index + head[0].length
+    return page.slice(0, end) + meta + page.slice(end)
+  }
+  return meta + page
+}
+
+/**
+ * Adds a @page rule with the orientation and margins to the end of a page, so it wins over the
+ * page's own. A page is left as it is when neither is set.
+ *
+ * @param html - The page
+ * @param layout - Page orientation and margins
+ * @param media - Paper size (default: the page's, or Chrome's)
+ * @returns The page with the rule
+ */
+export function withPageLayout(html: string, layout: PageLayout, media?: MediaSize): string {
+  if (!layout.orientation && !layout.margins) {
+    return html
+  }
+  return `${html}\n<style>@page { ${pageLayoutCss(layout, { media })} }</style>\n`
+}
+
+/**
+ * Reads a local image an `<img src>` refers to, if the path is allowed.
+ */
+function readLocalImage(src: string, baseDir: string | undefined): string | undefined {
+  let imagePath: string
+  try {
+    if (/^file:/i.test(src)) {
+      imagePath = fileURLToPath(src)
+    } else if (/^([a-z][a-z0-9+.-]*:|\/\/|#)/i.test(src)) {
+      return undefined
+    } else if (src.startsWith("/")) {
+      imagePath = decodeURI(src)
+    } else if (baseDir !== undefined) {
+      imagePath = resolve(baseDir, decodeURI(src))
+    } else {
+      return undefined
+    }
+    validateFilePath(imagePath)
+    const data = readFileSync(imagePath)
+    return `data:${readImageInfo(data).mimeType};base64,${data.toString("base64")}`
+  } catch {
+    return undefined
+  }
+}
+
+/**
+ * Inlines local images as data: URIs. Relative paths are resolved against `baseDir`; images
+ * that fail path validation (outside allowed directories, dotfiles) or aren't PNG, JPEG, GIF,
+ * or WebP are left untouched and won't load.
+ *
+ * @param html - The page
+ * @param baseDir - Directory relative paths are resolved against (none for inline content)
+ * @returns The page with local images inlined
+ */
+export function inlineLocalImages(html: string, baseDir?: string): string {
+  return html.replace(
+    /(<img\b[^>]*?\bsrc\s*=\s*)(["'])(.*?)\2/gi,
+    (match, open: string, quote: string, src: string) => {
+      const dataUri = readLocalImage(he.decode(src).trim(), baseDir)
+      return dataUri ? `${open}${quote}${dataUri}${quote}` : match
+    }
+  )
+}
+
+/**
+ * Renders sandboxed HTML with Chrome, or with the basic layout when Chrome isn't installed.
+ */
+async function renderSandboxedHtml(
+  html: string,
+  options: RenderHtmlOptions
+): Promise<RenderedHtml> {
+  const { allowRemoteResources = false, media, orientation, margins, signal } = options
+  if (margins) {
+    validatePageMargins(margins)
+  }
+  const chromeFound = await findChrome().then(
+    () => true,
+    () => false
+  )
+
+  if (chromeFound) {
+    const page = withPageLayout(html, { orientation, margins }, media)
+    const pdfPath = await convertHtmlToPdf(withContentSecurityPolicy(page, allowRemoteResources), {
+      chromeFlags: allowRemoteResources ? [NO_SCRIPT_FLAG] : SANDBOX_CHROME_FLAGS,
+      tempDirPrefix: "html-",
+      signal,
+    })
+    return { pdfPath, renderType: "html → PDF" }
+  }
+
+  throwIfAborted("Rendering", signal)
+  const data = layoutHtmlToPdf(html, media, { orientation, margins })
+  const tempDir = createTempDir("html-")
+  const pdfPath = join(tempDir, "output.pdf")
+  try {
+    writeFileSync(pdfPath, data)
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return { pdfPath, renderType: "html → PDF (basic layout, Chrome not found)" }
+}
+
+/**
+ * Renders an HTML file to PDF in a sandbox, with its relative images inlined.
+ *
+ * @param filePath - Path to the HTML file
+ * @param options - Remote resources, encoding, paper size, orientation, margins, and signal
+ * @returns The PDF and how it was rendered
+ * @throws {Error} If the margins are invalid, the file can't be read or decoded, or rendering
+ *   fails or is canceled
+ */
+export async function renderHtmlToPdf(
+  filePath: string,
+  options: RenderHtmlOptions = {}
+): Promise<RenderedHtml> {
+  validateFilePath(filePath)
+  const html = readTextFile(filePath, options.encoding).text
+  return renderSandboxedHtml(inlineLocalImages(html, dirname(resolve(filePath))), options)
+}
+
+/**
+ * Renders HTML content (e.g., inline content from print_text) to PDF in a sandbox. Images
+ * given as absolute paths or file: URLs are inlined when allowed.
+ *
+ * @param html - HTML content to render
+ * @param options - Remote resources, paper size, orientation, margins, and signal
+ * @returns The PDF and how it was rendered
+ * @throws {Error} If the margins are invalid, or rendering fails or is canceled
+ */
+export async function renderHtmlContentToPdf(
+  html: string,
+  options: RenderHtmlOptions = {}
+): Promise<RenderedHtml> {
+  return renderSandboxedHtml(inlineLocalImages(html), options)
+}
@@ -0,0 +1,394 @@
+/**
+ * @fileoverview Image renderer.
+ *
+ * Sending a PNG or JPEG straight to lp prints it at whatever size the printer driver picks
+ * (often tiny, in a corner) or fails outright. This module lays the image out on a single PDF
+ * page instead:
+ *
+ * 1. **Header parsing**: Reads the pixel size of PNG, JPEG, GIF, and WebP files, plus the EXIF
+ *    orientation of JPEGs, without decoding the image data.
+ *
+ * 2. **Layout**: Picks the page orientation (matching the image's shape when "auto"), then
+ *    scales the image into the printable area: "contain" fits the whole image, "fill" covers
+ *    the area and crops the overflow, and "actual-size" prints at 96 DPI.
+ *
+ * 3. **PDF Generation**: Chrome headless renders a page of exactly the media size with the
+ *    image embedded as a data URI. Chrome applies EXIF orientation when drawing the image.
+ */
+
+import { readFileSync } from "fs"
+import { extname } from "path"
+import { convertHtmlToPdf } from "../utils.js"
+import { validateFilePath } from "../file-security.js"
+import { config } from "../config.js"
+import { MEDIA_DIMENSIONS, type MediaSize } from "../print-options.js"
+
+/** File extensions rendered as images. */
+export const IMAGE_EXTENSIONS = ["png", "jpg", "jpeg", "gif", "webp"]
+
+/** How an image is scaled onto the page. */
+export const IMAGE_FIT_MODES = ["contain", "fill", "actual-size"] as const
+export type ImageFit = (typeof IMAGE_FIT_MODES)[number]
+
+/** Page orientation for an image. */
+export const IMAGE_ORIENTATIONS = ["auto", "portrait", "landscape"] as const
+export type ImageOrientation = (typeof IMAGE_ORIENTATIONS)[number]
+
+/** Points per CSS pixel (96 pixels per inch, 72 points per inch). */
+const POINTS_PER_PIXEL = 0.75
+
+/** Points per millimeter. */
+const POINTS_PER_MM = 72 / 25.4
+
+/**
+ * Header information for an image file.
+ */
+export interface ImageInfo {
+  /** MIME type of the image */
+  mimeType: string
+  /** Stored width in pixels */
+  width: number
+  /** Stored height in pixels */
+  height: number
+  /** EXIF orientation (1-8, 1 = as stored); only JPEGs carry one */
+  orientation: number
+}
+
+/**
+ * Page and image placement for a rendered image, in points.
+ */
+export interface ImageLayout {
+  orientation: "portrait" | "landscape"
+  pageWidth: number
+  pageHeight: number
+  /** Printable area inside the margins */
+  areaWidth: number
+  areaHeight: number
+  /** Image size on the page (may exceed the printable area for "fill" and "actual-size") */
+  imageWidth: number
+  imageHeight: number
+}
+
+/**
+ * Options for rendering an image to PDF.
+ */
+export interface RenderImageOptions {
+  fit?: ImageFit
+  orientation?: ImageOrientation
+  /** Paper size (default: Letter) */
+  media?: MediaSize
+  /** Margin on every side, in millimeters (default: MCP_PRINTER_IMAGE_MARGIN_MM) */
+  marginMm?: number
+  /** The MCP request's signal, which cancels the render */
+  signal?: AbortSignal
+}
+
+/**
+ * Checks whether a file should be rendered as an image, based on its extension.
+ *
+ * @param filePath - Path to the file to check
+ * @returns True for PNG, JPEG, GIF, and WebP files
+ */
+export function isImageFile(filePath: string): boolean {
+  return IMAGE_EXTENSIONS.includes(extname(filePath).slice(1).toLowerCase())
+}
+
+/**
+ * Reads the EXIF orientation from a JPEG APP1 segment.
+ *
+ * @returns Orientation 1-8, or 1 if the segment has none
+ */
+function readExifOrientation(data: Buffer, start: number, end: number): number {
+  const tiff = start + 6
+  if (tiff + 8 > end || data.toString("latin1", start, tiff) !== "Exif\0\0") {
+    return 1
+  }
+  const littleEndian = data.toString("latin1", tiff, tiff + 2) === "II"
+  const read16 = (offset: number) =>
+    littleEndian ? data.readUInt16LE(offset) : data.readUInt16BE(offset)
+  const read32 = (offset: number) =>
+    littleEndian ? data.readUInt32LE(offset) : data.readUInt32BE(offset)
+
+  const ifd = tiff + read32(tiff + 4)
+  if (ifd + 2 > end) {
+    return 1
+  }
+  const entries = read16(ifd)
+  for (let i = 0; i < entries; i++) {
+    const entry = ifd + 2 + i * 12
+    if (entry + 12 > end) break
+    if (read16(entry) === 0x0112) {
+      const orientation = read16(entry + 8)
+      return orientation >= 1 && orientation <= 8 ? orientation : 1
+    }
+  }
+  return 1
+}
+
+/**
+ * Reads the dimensions and EXIF orientation of a JPEG by walking its segments up to the
+ * first start-of-frame marker.
+ */
+function readJpegInfo(data: Buffer): ImageInfo {
+  let orientation = 1
+  let offset = 2
+
+  while (offset + 4 <= data.length) {
+    if (data[offset] !== 0xff) {
+      break
+    }
+    const marker = data[offset + 1]
+    const length = data.readUInt16BE(offset + 2)
+    const segmentStart = offset + 4
+    const segmentEnd = offset + 2 + length
+
+    if (marker === 0xe1) {
+      orientation = readExifOrientation(data, segmentStart, Math.min(segmentEnd, data.length))
+    }
+
+    // SOF0-SOF15, except DHT (C4), JPG (C8), and DAC (CC)
+    const isStartOfFrame =
+      marker >= 0xc0 && marker <= 0xcf && marker !== 0xc4 && marker !== 0xc8 && marker !== 0xcc
+    if (isStartOfFrame && segmentStart + 5 <= data.length) {
+      return {
+        mimeType: "image/jpeg",
+        height: data.readUInt16BE(segmentStart + 1),
+        width: data.readUInt16BE(segmentStart + 3),
+        orientation,
+      }
+    }
+
+    offset = segmentEnd
+  }
+
+  throw new Error("Invalid JPEG: no frame header found")
+}
+
+/**
+ * Reads the dimensions of a WebP image from its VP8, VP8L, or VP8X chunk.
+ */
+function readWebpInfo(data: Buffer): ImageInfo {
+  const chunk = data.toString("latin1", 12, 16)
+  const info = (width: number, height: number) => ({
+    mimeType: "image/webp",
+    width,
+    height,
+    orientation: 1,
+  })
+
+  if (chunk === "VP8 " && data.length >= 30) {
+    return info(data.readUInt16LE(26) & 0x3fff, data.readUInt16LE(28) & 0x3fff)
+  }
+  if (chunk === "VP8L" && data.length >= 25) {
+    const bits = data.readUInt32LE(21)
+    return info((bits & 0x3fff) + 1, ((bits >> 14) & 0x3fff) + 1)
+  }
+  if (chunk === "VP8X" && data.length >= 30) {
+    return info(data.readUIntLE(24, 3) + 1, data.readUIntLE(27, 3) + 1)
+  }
+  throw new Error(`Invalid WebP: unsupported chunk "${chunk.trim()}"`)
+}
+
+/**
+ * Reads an image's type, pixel dimensions, and EXIF orientation from its header.
+ *
+ * @param data - Image file contents
+ * @returns Image header information
+ * @throws {Error} If the data isn't a PNG, JPEG, GIF, or WebP image
+ */
+export function readImageInfo(data: Buffer): ImageInfo {
+  if (data.length >= 24 && data.readUInt32BE(0) === 0x89504e47) {
+    return {
+      mimeType: "image/png",
+      width: data.readUInt32BE(16),
+      height: data.readUInt32BE(20),
+      orientation: 1,
+    }
+  }
+  if (data.length >= 4 && data[0] === 0xff && data[1] === 0xd8) {
+    return readJpegInfo(data)
+  }
+  if (data.length >= 10 && data.toString("latin1", 0, 3) === "GIF") {
+    return {
+      mimeType: "image/gif",
+      width: data.readUInt16LE(6),
+      height: data.readUInt16LE(8),
+      orientation: 1,
+    }
+  }
+  if (
+    data.length >= 16 &&
+    data.toString("latin1", 0, 4) === "RIFF" &&
+    data.toString("latin1", 8, 12) === "WEBP"
+  ) {
+    return readWebpInfo(data)
+  }
+  throw new Error("Unsupported image format: expected PNG, JPEG, GIF, or WebP")
+}
+
+/**
+ * Gets an image's displayed size, swapping width and height when the EXIF orientation
+ * rotates it by 90 degrees (orientations 5-8).
+ *
+ * @param info - Image header information
+ * @returns Width and height as displayed, in pixels
+ */
+export function displayedSize(info: ImageInfo): { width: number; height: number } {
+  return info.orientation >= 5
+    ? { width: info.height, height: info.width }
+    : { width: info.width, height: info.height }
+}
+
+/**
+ * Computes the page size and image placement for an image.
+ *
+ * @param size - Displayed image size in pixels
+ * @param options - Fit mode, orientation, media, and margin
+ * @returns Page and image dimensions in points
+ * @throws {Error} If the margins leave no printable area
+ */
+export function computeImageLayout(
+  size: { width: number; height: number },
+  options: Required<RenderImageOptions>
+): ImageLayout {
+  const media = MEDIA_DIMENSIONS[options.media]
+  const orientation =
+    options.orientation === "auto"
+      ? size.width > size.height
+        ? "landscape"
+        : "portrait"
+      : options.orientation
+  const [pageWidth, pageHeight] =
+    orientation === "landscape" ? [media.height, media.width] : [media.width, media.height]
+
+  const margin = options.marginMm * POINTS_PER_MM
+  const areaWidth = pageWidth - 2 * margin
+  const areaHeight = pageHeight - 2 * margin
+  if (areaWidth <= 0 || areaHeight <= 0) {
+    throw new Error(
+      `Image margin of ${options.marginMm}mm leaves no printable area on ${options.media} paper`
+    )
+  }
+
+  let scale: number
+  if (options.fit === "actual-size") {
+    scale = POINTS_PER_PIXEL
+  } else {
+    const widthScale = areaWidth / size.width
+    const heightScale = areaHeight / size.height
+    scale =
+      options.fit === "fill"
+        ? Math.max(widthScale, heightScale)
+        : Math.min(widthScale, heightScale)
+  }
+
+  return {
+    orientation,
+    pageWidth,
+    pageHeight,
+    areaWidth,
+    areaHeight,
+    imageWidth: size.width * scale,
+    imageHeight: size.height * scale,
+  }
+}
+
+/**
+ * Builds the single-page HTML document for an image. The printable area is a fixed-position
+ * box (so it never spills onto a second page) that clips the image, which is centered in it.
+ *
+ * @param dataUri - Image as a data URI
+ * @param layout - Page and image placement
+ * @param marginMm - Margin on every side, in millimeters
+ * @returns Complete HTML document
+ * @internal Exported for testing purposes
+ */
+export function buildImageHtml(dataUri: string, layout: ImageLayout, marginMm: number): string {
+  const pt = (value: number) => `${+value.toFixed(3)}pt`
+  const left = (layout.areaWidth - layout.imageWidth) / 2
+  const top = (layout.areaHeight - layout.imageHeight) / 2
+
+  return `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <style>
+    @page {
+      size: ${pt(layout.pageWidth)} ${pt(layout.pageHeight)};
+      margin: 0;
+    }
+
+    html, body {
+      margin: 0;
+      padding: 0;
+    }
+
+    .area {
+      position: fixed;
+      top: ${marginMm}mm;
+      left: ${marginMm}mm;
+      width: ${pt(layout.areaWidth)};
+      height: ${pt(layout.areaHeight)};
+      overflow: hidden;
+    }
+
+    img {
+      position: absolute;
+      left: ${pt(left)};
+      top: ${pt(top)};
+      width: ${pt(layout.imageWidth)};
+      height: ${pt(layout.imageHeight)};
+      image-orientation: from-image;
+    }
+  </style>
+</head>
+<body>
+  <div class="area"><img src="${dataUri}"></div>
+</body>
+</html>`
+}
+
+/**
+ * Renders image data to a single-page PDF sized to the media.
+ *
+ * @param data - PNG, JPEG, GIF, or WebP file contents
+ * @param options - Fit mode, orientation, media, and margin
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the format is unsupported, or Chrome is not found or PDF generation fails
+ */
+export async function renderImageDataToPdf(
+  data: Buffer,
+  options: RenderImageOptions = {}
+): Promise<string> {
+  const info = readImageInfo(data)
+  const marginMm = options.marginMm ?? config.imageMarginMm
+  const layout = computeImageLayout(displayedSize(info), {
+    fit: options.fit ?? "contain",
+    orientation: options.orientation ?? "auto",
+    media: options.media ?? "Letter",
+    marginMm,
+  })
+
+  const dataUri = `data:${info.mimeType};base64,${data.toString("base64")}`
+  return await convertHtmlToPdf(buildImageHtml(dataUri, layout, marginMm), {
+    chromeFlags: ["--no-pdf-header-footer"],
+    tempDirPrefix: "image-",
+    signal: options.signal,
+  })
+}
+
+/**
+ * Renders an image file to a single-page PDF sized to the media.
+ *
+ * @param filePath - Path to the PNG, JPEG, GIF, or WebP file
+ * @param options - Fit mode, orientation, media, and margin
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the image can't be read, or Chrome is not found or PDF generation fails
+ */
+export async function renderImageToPdf(
+  filePath: string,
+  options: RenderImageOptions = {}
+): Promise<string> {
+  validateFilePath(filePath)
+  return await renderImageDataToPdf(readFileSync(filePath), options)
+}
@@ -2,18 +2,41 @@
  * @fileoverview Markdown file renderer.
  * Converts markdown files to PDF using crossnote.
  * Provides beautiful Markdown Preview Enhanced-quality output with Mermaid diagram support.
- * Automatically adds page numbering to all rendered PDFs.
+ * Automatically adds page numbering to all rendered PDFs, or the configured header and footer.
  */
 
-import { basename, join } from "path"
-import { readFileSync, writeFileSync, mkdtempSync, unlinkSync } from "fs"
-import { tmpdir } from "os"
+import { basename, dirname, join, resolve } from "path"
+import { writeFileSync, unlinkSync, rmSync } from "fs"
+import { pathToFileURL } from "url"
 import matter from "gray-matter"
 import he from "he"
 import { findChrome } from "../utils.js"
 import { validateFilePath } from "../file-security.js"
 import { config } from "../config.js"
+import { withRenderSlot } from "../render-limit.js"
+import { throwIfAborted } from "../timeouts.js"
+import {
+  buildPuppeteerHeaderFooter,
+  hasHeaderFooter,
+  resolveHeaderFooter,
+  type HeaderFooter,
+} from "./header-footer.js"
+import { readTextFile } from "./encoding.js"
+import { validatePageMargins, type PageLayout } from "./page-layout.js"
 import { Notebook } from "crossnote"
+import { createTempDir } from "../temp-files.js"
+
+/**
+ * Options for rendering markdown to PDF.
+ */
+export interface RenderMarkdownOptions extends HeaderFooter, PageLayout {
+  /** Value of {title} in header and footer templates when there is no front-matter title */
+  title?: string
+  /** Character encoding of the file (default: detected) */
+  encoding?: string
+  /** The MCP request's signal (Chrome can't be stopped mid-export, so it is checked after) */
+  signal?: AbortSignal
+}
 
 /**
  * Page numbering configuration function for Puppeteer PDF generation.
@@ -57,15 +80,41 @@ function getPageNumberConfig(filename: string) {
   }
 }
 
+/**
+ * Turns Puppeteer PDF options to landscape and sets the margins that are given, in place of
+ * those of the header and footer.
+ */
+function withPageLayout(pdfOptions: { margin: Record<string, string> }, layout: PageLayout) {
+  const margin: Record<string, string> = { ...pdfOptions.margin }
+  for (const side of ["top", "right", "bottom", "left"] as const) {
+    if (layout.margins?.[side] !== undefined) {
+      margin[side] = `${layout.margins[side]}mm`
+    }
+  }
+  const landscape = layout.orientation === "landscape" ? { landscape: true } : {}
+  return { ...pdfOptions, ...landscape, margin }
+}
+
 /**
  * Injects page numbering configuration into markdown content.
  * Properly merges with existing front-matter if present.
  * Uses gray-matter's stringify for robust formatting.
+ * A header or footer template replaces the default footer; {title} is taken from the
+ * front-matter `title` when there is one.
  * @param content - Original markdown content
  * @param filename - Name of the file being rendered (displayed in footer)
+ * @param headerFooter - Resolved header and footer templates
+ * @param title - Fallback for {title} (default: the filename)
+ * @param layout - Page orientation and margins
  * @returns Markdown content with page numbering front-matter added/merged
  */
-function injectPageNumbering(content: string, filename: string): string {
+function injectPageNumbering(
+  content: string,
+  filename: string,
+  headerFooter: HeaderFooter,
+  title = filename,
+  layout: PageLayout = {}
+): string {
   const { data, content: body } = matter(content)
 
   // Check if user already has chrome or puppeteer config in their frontmatter -
@@ -77,36 +126,130 @@ function injectPageNumbering(content: string, filename: string): string {
   // Merge in the chrome config with existing front-matter (even if empty)
   const mergedFrontMatter = {
     ...data,
-    chrome: getPageNumberConfig(filename),
+    chrome: withPageLayout(
+      hasHeaderFooter(headerFooter)
+        ? buildPuppeteerHeaderFooter(headerFooter, {
+            filename,
+            title: typeof data.title === "string" && data.title ? data.title : title,
+          })
+        : getPageNumberConfig(filename),
+      layout
+    ),
   }
 
   // Use gray-matter's stringify to properly format the document
   return matter.stringify(body, mergedFrontMatter)
 }
 
+/**
+ * Checks whether an image reference is relative to the markdown file.
+ * URLs with a scheme (https:, data:, file:), protocol-relative URLs, and
+ * absolute paths are left alone.
+ */
+function isRelativeImagePath(src: string): boolean {
+  return !/^([a-z][a-z0-9+.-]*:|\/|#)/i.test(src)
+}
+
+/**
+ * Rewrites relative image references to absolute file:// URLs.
+ * The markdown is rendered from a temp directory, so relative paths would otherwise
+ * break. Images that fail path validation (outside allowed directories, dotfiles)
+ * are left untouched and will not load.
+ *
+ * Handles both markdown image syntax (`![alt](path "title")`) and HTML `<img src="path">`.
+ *
+ * @param content - Markdown content
+ * @param baseDir - Directory containing the original markdown file
+ * @returns Markdown content with relative images resolved
+ * @internal Exported for testing purposes
+ */
+export function resolveRelativeImages(content: string, baseDir: string): string {
+  const toFileUrl = (src: string): string => {
+    if (!isRelativeImagePath(src)) {
+      return src
+    }
+    const imagePath = resolve(baseDir, decodeURI(src))
+    try {
+      validateFilePath(imagePath)
+    } catch {
+      return src
+    }
+    return pathToFileURL(imagePath).href
+  }
+
+  return content
+    .replace(
+      /(!\[[^\]]*\]\()(\S+?)((?:\s+"[^"]*")?\))/g,
+      (_match, open: string, src: string, close: string) => `${open}${toFileUrl(src)}${close}`
+    )
+    .replace(
+      /(<img\b[^>]*?\bsrc=)(["'])(.*?)\2/gi,
+      (_match, open: string, quote: string, src: string) =>
+        `${open}${quote}${toFileUrl(src)}${quote}`
+    )
+}
+
 /**
  * Renders a markdown file to PDF using crossnote.
  * Provides beautiful Markdown Preview Enhanced-quality output with
  * comprehensive diagram support. Automatically adds page numbering (Page X /
- * Y) to the footer of each page.
+ * Y) to the footer of each page. Relative image paths are resolved against
+ * the file's directory.
  *
  * @param filePath - Path to the markdown file to render
+ * @param options - Header and footer templates (default: MCP_PRINTER_HEADER / MCP_PRINTER_FOOTER),
+ *   page orientation and margins, and the file's encoding (default: detected)
  * @returns Path to the generated temporary PDF file
- * @throws {Error} If Chrome is not found or rendering fails
+ * @throws {Error} If the margins are invalid, the file can't be decoded, Chrome is not found,
+ *   or rendering fails
  */
-export async function renderMarkdownToPdf(filePath: string): Promise<string> {
+export async function renderMarkdownToPdf(
+  filePath: string,
+  options: RenderMarkdownOptions = {}
+): Promise<string> {
   // Validate file path security
   validateFilePath(filePath)
 
-  // Read the original markdown content
-  const originalContent = readFileSync(filePath, "utf-8")
+  // Read the original markdown content and resolve relative images before moving it
+  const originalContent = readTextFile(filePath, options.encoding).text
+  const content = resolveRelativeImages(originalContent, dirname(resolve(filePath)))
+
+  return renderMarkdownContentToPdf(content, basename(filePath), options)
+}
+
+/**
+ * Renders markdown content (e.g., inline content from print_text) to PDF using crossnote.
+ * Adds the same page numbering as file rendering, using `filename` in the footer.
+ *
+ * @param content - Markdown content to render
+ * @param filename - Name shown in the footer and used for the temp file (e.g., "notes.md")
+ * @param options - Header and footer templates (default: MCP_PRINTER_HEADER / MCP_PRINTER_FOOTER),
+ *   page orientation and margins, and the {title} to use when the content has no front-matter
+ *   title
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the margins are invalid, Chrome is not found, or rendering fails
+ */
+export async function renderMarkdownContentToPdf(
+  content: string,
+  filename: string,
+  options: RenderMarkdownOptions = {}
+): Promise<string> {
+  if (options.margins) {
+    validatePageMargins(options.margins)
+  }
 
   // Inject page numbering configuration if not already present
-  const contentWithPageNumbers = injectPageNumbering(originalContent, basename(filePath))
+  const contentWithPageNumbers = injectPageNumbering(
+    content,
+    filename,
+    resolveHeaderFooter(options),
+    options.title,
+    { orientation: options.orientation, margins: options.margins }
+  )
 
   // Create a temporary directory for the modified markdown file
-  const tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-markdown-"))
-  const tempFileName = basename(filePath)
+  const tempDir = createTempDir("markdown-")
+  const tempFileName = basename(filename)
   const tempFilePath = join(tempDir, tempFileName)
 
   // Write the modified content to temp file
@@ -148,16 +291,20 @@ export async function renderMarkdownToPdf(filePath: string): Promise<string> {
     // Get the markdown engine for the temp file
     const engine = notebook.getNoteMarkdownEngine(tempFileName)
 
-    // Export to PDF using Chrome/Puppeteer
+    // Export to PDF using Chrome/Puppeteer (waiting for a render slot)
     // crossnote returns the path to the generated PDF
-    outputPath = await engine.chromeExport({
-      fileType: "pdf",
-      runAllCodeChunks: false, // Don't execute code chunks for security
+    outputPath = await withRenderSlot(() => {
+      throwIfAborted("Rendering", options.signal)
+      return engine.chromeExport({
+        fileType: "pdf",
+        runAllCodeChunks: false, // Don't execute code chunks for security
+      })
     })
+    throwIfAborted("Rendering", options.signal)
   } catch (error: unknown) {
-    // Clean up temp file before throwing
+    // Clean up the temp directory before throwing
     try {
-      unlinkSync(tempFilePath)
+      rmSync(tempDir, { recursive: true, force: true })
     } catch {
       // Ignore cleanup errors
     }
@@ -166,7 +313,7 @@ export async function renderMarkdownToPdf(filePath: string): Promise<string> {
     )
   }
 
-  // Clean up temp markdown file (PDF is in a different location)
+  // Clean up temp markdown file (the PDF is removed with its directory by cleanupRenderedPdf)
   try {
     unlinkSync(tempFilePath)
   } catch {
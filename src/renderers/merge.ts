@@ -0,0 +1,343 @@
+/**
+ * @fileoverview Merged print jobs: several files printed as one job, in order.
+ *
+ * Related files printed one job at a time can come out interleaved with other people's jobs
+ * on a shared printer. A merged job keeps them together:
+ *
+ * 1. **Rendering**: Each file goes through prepareFileForPrinting, just as print_file would
+ *    print it, and must come out as a PDF (rendered markdown, code, text, images, or a PDF).
+ *
+ * 2. **Separators**: Before each file after the first, a separator page names it, in the size
+ *    of the file's first page.
+ *
+ * 3. **Merging**: The PDFs' pages are copied into one file (see PdfMerger), which is stamped
+ *    with the watermark, if one is given, and printed as a single job.
+ */
+
+import { rmSync } from "fs"
+import { readFile, writeFile } from "fs/promises"
+import { basename, join } from "path"
+import {
+  cleanupRenderedPdf,
+  prepareFileForPrinting,
+  type RenderOptions,
+  type RenderResult,
+} from "../utils.js"
+import { validateFilePath } from "../file-security.js"
+import { PrinterError, describeError } from "../errors.js"
+import { throwIfAborted } from "../timeouts.js"
+import {
+  PdfDocument,
+  PdfFormatError,
+  PdfRef,
+  PdfStream,
+  formatNumber,
+  type PdfValue,
+} from "../pdf/document.js"
+import { PdfMerger } from "../pdf/merge.js"
+import { CAP_HEIGHT, encodeWinAnsi, helveticaBoldFont, measureText } from "../pdf/helvetica.js"
+import { sniffContent } from "./file-type.js"
+import { stampWatermark, validateWatermark, type WatermarkOptions } from "./watermark.js"
+import { createTempDir } from "../temp-files.js"
+
+/** What to do when a file can't be rendered: stop, or leave it out with a warning. */
+export const MERGE_ERROR_MODES = ["fail", "skip"] as const
+export type MergeErrorMode = (typeof MERGE_ERROR_MODES)[number]
+
+/** Size of separator pages when the next file's first page has no usable media box. */
+const DEFAULT_SEPARATOR_BOX = [0, 0, 612, 792]
+
+/** Font size of the file name on separator pages (shrunk for long names). */
+const SEPARATOR_NAME_SIZE = 28
+
+/** Font size of the "Next file" line above the name. */
+const SEPARATOR_LABEL_SIZE = 14
+
+/** Margin that long file names are kept inside, in points. */
+const SEPARATOR_MARGIN = 54
+
+/**
+ * Options for a merged job.
+ */
+export interface MergeOptions {
+  /** Rendering options applied to every file (as in print_file) */
+  render?: Omit<RenderOptions, "filePath" | "watermark" | "signal">
+  /** What to do when a file can't be rendered (default: "fail") */
+  onError?: MergeErrorMode
+  /** Text to stamp across every page of the merged PDF */
+  watermark?: WatermarkOptions
+  /** The MCP request's signal, which cancels rendering */
+  signal?: AbortSignal
+}
+
+/**
+ * A file in a merged job.
+ */
+export interface MergedFile {
+  /** Path of the file */
+  filePath: string
+  /** Pages of the file in the merged PDF */
+  pages: number
+  /** Description of rendering performed (empty string if the file was already a PDF) */
+  renderType: string
+  /** Type the file was printed as */
+  fileType: string
+}
+
+/**
+ * The merged PDF and what went into it.
+ */
+export interface MergedPdf {
+  /** Path to the merged PDF (remove it with cleanupRenderedPdf) */
+  pdfPath: string
+  /** Files in the merged PDF, in order */
+  files: MergedFile[]
+  /** Files left out because they couldn't be rendered, with the reason */
+  skipped: Array<{ filePath: string; message: string }>
+  /** Number of separator pages */
+  separatorPages: number
+  /** Pages in the merged PDF, separators included */
+  totalPages: number
+}
+
+/**
+ * Reads a prepared file as a PDF to merge.
+ *
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if it isn't printed as a PDF, or the PDF is
+ *   encrypted or can't be read
+ */
+function readMergeablePdf(data: Buffer, filePath: string, fileType: string): PdfDocument {
+  const name = basename(filePath)
+  if (sniffContent(data).type !== "pdf") {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot merge ${name}: it is printed as ${fileType}, not as a PDF.`,
+      {
+        suggestion:
+          "Merged jobs take PDFs and rendered markdown, code, text, and images. Print this file on its own with print_file.",
+      }
+    )
+  }
+  try {
+    const document = new PdfDocument(data)
+    if (document.encrypted) {
+      throw new PrinterError("UNSUPPORTED_FORMAT", `Cannot merge ${name}: it is encrypted.`, {
+        suggestion: "Print it on its own with print_file, or remove the password protection first.",
+      })
+    }
+    document.getPages()
+    return document
+  } catch (error) {
+    if (error instanceof PdfFormatError) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot merge ${name}: its structure can't be read (${error.message}).`,
+        {
+          cause: error,
+          suggestion: "Print it on its own with print_file, or save it again from a PDF viewer.",
+        }
+      )
+    }
+    throw error
+  }
+}
+
+/**
+ * Finds the media box of a document's first page, for a separator or cover page before it.
+ *
+ * @param document - The document
+ * @returns The box [left, bottom, right, top] (US Letter if the page has no usable one)
+ */
+export function firstPageBox(document: PdfDocument): number[] {
+  const page = document.getPages()[0]
+  const box = document.resolve(
+    page?.dict.get("MediaBox") ?? page?.inherited.get("MediaBox") ?? null
+  )
+  if (!Array.isArray(box) || box.length !== 4) {
+    return DEFAULT_SEPARATOR_BOX
+  }
+  const coordinates = box.map((value) => document.resolve(value))
+  return coordinates.every((value) => typeof value === "number")
+    ? (coordinates as number[])
+    : DEFAULT_SEPARATOR_BOX
+}
+
+/**
+ * Builds the content of a separator page: "Next file (2 of 3)" and the file's name, centered.
+ * Characters the standard PDF fonts can't show are printed as "?".
+ *
+ * @param name - Name of the next file
+ * @param position - Position of the file in the job, from 1
+ * @param count - Number of files in the job
+ * @param box - Page box [left, bottom, right, top]
+ * @returns Content stream operators (font /F0)
+ * @internal Exported for testing purposes
+ */
+export function buildSeparatorContent(
+  name: string,
+  position: number,
+  count: number,
+  box: number[]
+): string {
+  const [left, bottom, right, top] = [
+    Math.min(box[0], box[2]),
+    Math.min(box[1], box[3]),
+    Math.max(box[0], box[2]),
+    Math.max(box[1], box[3]),
+  ]
+  const centerX = (left + right) / 2
+  const centerY = (bottom + top) / 2
+  const available = Math.max(right - left - 2 * SEPARATOR_MARGIN, 72)
+
+  const line = (text: string, maxSize: number, y: number, gray: number) => {
+    const encoded = encodeWinAnsi(text, "?") as Buffer
+    const width = measureText(encoded.toString("latin1"))
+    const size = Math.min(maxSize, (available * 1000) / width)
+    const x = centerX - (width * size) / 2000
+    return [
+      `${gray} g`,
+      "BT",
+      `/F0 ${formatNumber(size)} Tf`,
+      `${formatNumber(x)} ${formatNumber(y - (CAP_HEIGHT * size) / 2000)} Td`,
+      `<${encoded.toString("hex").toUpperCase()}> Tj`,
+      "ET",
+    ]
+  }
+
+  return [
+    "q",
+    ...line(`Next file (${position} of ${count})`, SEPARATOR_LABEL_SIZE, centerY + 36, 0.4),
+    ...line(name, SEPARATOR_NAME_SIZE, centerY, 0),
+    "Q",
+    "",
+  ].join("\n")
+}
+
+/**
+ * Adds a separator page naming the next file, in the size of its first page.
+ */
+function addSeparatorPage(
+  merger: PdfMerger,
+  font: PdfRef,
+  next: PdfDocument,
+  name: string,
+  position: number,
+  count: number
+): void {
+  const box = firstPageBox(next)
+  const content = buildSeparatorContent(name, position, count, box)
+  merger.addPage(
+    new Map<string, PdfValue>([
+      ["MediaBox", box],
+      ["Resources", new Map([["Font", new Map([["F0", font]])]])],
+      ["Contents", merger.add(new PdfStream(new Map(), Buffer.from(content, "latin1")))],
+    ])
+  )
+}
+
+/**
+ * Wraps an error with the path of the file it came from, keeping its code.
+ */
+function fileError(filePath: string, error: unknown): Error {
+  const { message, code, suggestion } = describeError(error)
+  const text = `${filePath}: ${message}`
+  return code
+    ? new PrinterError(code, text, { cause: error, suggestion })
+    : new Error(text, { cause: error })
+}
+
+/**
+ * Renders files and merges them into one PDF, with a separator page before each file after
+ * the first.
+ *
+ * Every path is checked against the allowed and denied directories before anything is
+ * rendered, so a disallowed path fails the whole job whatever `onError` says.
+ *
+ * @param filePaths - Files to merge, in order
+ * @param options - Rendering options, error mode, watermark, and signal
+ * @returns The merged PDF, with the page count of each file
+ * @throws {PrinterError} PERMISSION_DENIED if any path is not allowed
+ * @throws {PrinterError} With the failing file's path, if a file can't be rendered (or isn't
+ *   printed as a PDF) and `onError` is "fail"
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if no file could be merged
+ * @throws {Error} If the watermark options are invalid or the request is canceled
+ */
+export async function mergeFilesToPdf(
+  filePaths: string[],
+  options: MergeOptions = {}
+): Promise<MergedPdf> {
+  const { render = {}, onError = "fail", watermark, signal } = options
+  for (const filePath of filePaths) {
+    validateFilePath(filePath)
+  }
+  if (watermark) {
+    validateWatermark(watermark)
+  }
+
+  const merger = new PdfMerger()
+  const font = merger.add(helveticaBoldFont())
+  const files: MergedFile[] = []
+  const skipped: MergedPdf["skipped"] = []
+  let separatorPages = 0
+
+  for (const [index, filePath] of filePaths.entries()) {
+    throwIfAborted("Rendering", signal)
+    let renderedPdf: string | null = null
+    let document: PdfDocument
+    let prepared: RenderResult
+    try {
+      prepared = await prepareFileForPrinting({ ...render, filePath, signal })
+      renderedPdf = prepared.renderedPdf
+      const data = await readFile(prepared.actualFilePath)
+      document = readMergeablePdf(data, filePath, prepared.fileType)
+    } catch (error) {
+      cleanupRenderedPdf(renderedPdf)
+      if (onError === "fail" || signal?.aborted) {
+        throw fileError(filePath, error)
+      }
+      skipped.push({ filePath, message: describeError(error).message })
+      continue
+    }
+
+    try {
+      if (files.length > 0) {
+        addSeparatorPage(merger, font, document, basename(filePath), index + 1, filePaths.length)
+        separatorPages++
+      }
+      const pages = merger.appendDocument(document)
+      files.push({
+        filePath,
+        pages,
+        renderType: prepared.renderType,
+        fileType: prepared.fileType,
+      })
+    } finally {
+      cleanupRenderedPdf(renderedPdf)
+    }
+  }
+
+  if (files.length === 0) {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `None of the ${filePaths.length} files could be merged: ` +
+        skipped.map(({ filePath, message }) => `${filePath}: ${message}`).join("; "),
+      { suggestion: "Fix the files listed, or print them one at a time with print_file." }
+    )
+  }
+
+  let data = merger.toBuffer()
+  if (watermark) {
+    data = stampWatermark(data, watermark, "the merged PDF")
+  }
+  throwIfAborted("Rendering", signal)
+
+  const tempDir = createTempDir("merge-")
+  const pdfPath = join(tempDir, "merged.pdf")
+  try {
+    await writeFile(pdfPath, data)
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return { pdfPath, files, skipped, separatorPages, totalPages: merger.pageCount }
+}
@@ -0,0 +1,282 @@
+/**
+ * @fileoverview N-up imposition (several pages per sheet).
+ *
+ * CUPS lays pages out itself for `-o number-up=N`, but many printers reached directly over IPP
+ * ignore the number-up attribute. For those printers, this module imposes the pages onto the
+ * sheets before the job is sent:
+ *
+ * 1. **Page images**: Each selected page of the PDF is rendered to PNG at 200 DPI for the size
+ *    it will have on the sheet, so text stays sharp on paper.
+ *
+ * 2. **Layout**: Pages fill a grid in reading order. 2-up and 6-up sheets are landscape (2×1
+ *    and 3×2); 4-up, 9-up, and 16-up sheets are portrait (2×2, 3×3, and 4×4), as with CUPS.
+ *    Each page is scaled to fit its cell without changing its shape.
+ *
+ * 3. **PDF Generation**: Chrome headless renders one page of the media size per sheet.
+ */
+
+import { readFile } from "fs/promises"
+import { extname } from "path"
+import { PDFParse } from "pdf-parse"
+import { convertHtmlToPdf } from "../utils.js"
+import { isIppUri } from "../ipp/client.js"
+import { throwIfAborted } from "../timeouts.js"
+import type { LpJobOptions } from "../cups.js"
+import {
+  MEDIA_DIMENSIONS,
+  MEDIA_SIZES,
+  NUMBER_UP_VALUES,
+  isNumberUp,
+  selectPages,
+  type MediaSize,
+  type NumberUp,
+} from "../print-options.js"
+
+/** Resolution pages are rendered at for imposition. */
+const IMPOSITION_DPI = 200
+
+/** Margin around the grid on every side of the sheet, in millimeters. */
+const SHEET_MARGIN_MM = 6
+
+/** Space between pages on the sheet, in millimeters. */
+const CELL_GAP_MM = 3
+
+/** Points per millimeter. */
+const POINTS_PER_MM = 72 / 25.4
+
+/**
+ * Grid and sheet orientation for a number of pages per sheet.
+ */
+export interface NUpLayout {
+  columns: number
+  rows: number
+  orientation: "portrait" | "landscape"
+}
+
+/** Grid of each N-up value, for portrait pages. */
+export const N_UP_LAYOUTS: Record<NumberUp, NUpLayout> = {
+  1: { columns: 1, rows: 1, orientation: "portrait" },
+  2: { columns: 2, rows: 1, orientation: "landscape" },
+  4: { columns: 2, rows: 2, orientation: "portrait" },
+  6: { columns: 3, rows: 2, orientation: "landscape" },
+  9: { columns: 3, rows: 3, orientation: "portrait" },
+  16: { columns: 4, rows: 4, orientation: "portrait" },
+}
+
+/**
+ * Options for imposing a PDF.
+ */
+export interface ImposeOptions {
+  /** Paper size of the sheets (default: Letter) */
+  media?: MediaSize
+  /** Pages to lay out, e.g. "1-3,7" (default: every page) */
+  pageRanges?: string
+  /** The MCP request's signal, which cancels imposition */
+  signal?: AbortSignal
+}
+
+/**
+ * Computes the sheet size and the size of each page's cell, in points.
+ *
+ * @param numberUp - Pages per sheet
+ * @param media - Paper size of the sheets
+ * @returns Sheet width and height, and cell width and height
+ */
+export function computeSheetLayout(numberUp: NumberUp, media: MediaSize) {
+  const { columns, rows, orientation } = N_UP_LAYOUTS[numberUp]
+  const { width, height } = MEDIA_DIMENSIONS[media]
+  const [sheetWidth, sheetHeight] = orientation === "landscape" ? [height, width] : [width, height]
+  const margin = SHEET_MARGIN_MM * POINTS_PER_MM
+  const gap = CELL_GAP_MM * POINTS_PER_MM
+
+  return {
+    sheetWidth,
+    sheetHeight,
+    cellWidth: (sheetWidth - 2 * margin - (columns - 1) * gap) / columns,
+    cellHeight: (sheetHeight - 2 * margin - (rows - 1) * gap) / rows,
+  }
+}
+
+/**
+ * Builds the HTML document for imposed sheets: one grid per sheet, with a page break after
+ * each.
+ *
+ * @param pageImages - Page images as data URIs, in print order
+ * @param numberUp - Pages per sheet
+ * @param media - Paper size of the sheets
+ * @returns Complete HTML document
+ * @internal Exported for testing purposes
+ */
+export function buildNUpHtml(pageImages: string[], numberUp: NumberUp, media: MediaSize): string {
+  const pt = (value: number) => `${+value.toFixed(3)}pt`
+  const { columns, rows } = N_UP_LAYOUTS[numberUp]
+  const { sheetWidth, sheetHeight } = computeSheetLayout(numberUp, media)
+
+  const sheets: string[] = []
+  for (let start = 0; start < pageImages.length; start += numberUp) {
+    const cells = pageImages
+      .slice(start, start + numberUp)
+      .map((image) => `<div class="cell"><img src="${image}"></div>`)
+    sheets.push(`  <div class="sheet">${cells.join("")}</div>`)
+  }
+
+  return `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <style>
+    @page {
+      size: ${pt(sheetWidth)} ${pt(sheetHeight)};
+      margin: 0;
+    }
+
+    html, body {
+      margin: 0;
+      padding: 0;
+    }
+
+    .sheet {
+      box-sizing: border-box;
+      width: ${pt(sheetWidth)};
+      height: ${pt(sheetHeight - 1)};
+      padding: ${SHEET_MARGIN_MM}mm;
+      display: grid;
+      grid-template-columns: repeat(${columns}, minmax(0, 1fr));
+      grid-template-rows: repeat(${rows}, minmax(0, 1fr));
+      gap: ${CELL_GAP_MM}mm;
+      overflow: hidden;
+      break-after: page;
+    }
+
+    .sheet:last-child {
+      break-after: auto;
+    }
+
+    .cell {
+      display: flex;
+      align-items: center;
+      justify-content: center;
+      overflow: hidden;
+    }
+
+    img {
+      width: 100%;
+      height: 100%;
+      object-fit: contain;
+    }
+  </style>
+</head>
+<body>
+${sheets.join("\n")}
+</body>
+</html>`
+}
+
+/**
+ * Imposes the pages of a PDF onto N-up sheets.
+ *
+ * @param pdfPath - Path to the PDF
+ * @param numberUp - Pages per sheet
+ * @param options - Paper size, pages to lay out, and signal
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the PDF can't be read or has no pages in range, or Chrome is not found or
+ *   PDF generation fails
+ */
+export async function imposePdf(
+  pdfPath: string,
+  numberUp: NumberUp,
+  options: ImposeOptions = {}
+): Promise<string> {
+  const media = options.media ?? "Letter"
+  const { cellWidth } = computeSheetLayout(numberUp, media)
+
+  const parser = new PDFParse({ data: await readFile(pdfPath) })
+  let pageImages: string[]
+  try {
+    const { total } = await parser.getInfo()
+    const pages = options.pageRanges
+      ? selectPages(options.pageRanges, total)
+      : Array.from({ length: total }, (_, index) => index + 1)
+    if (pages.length === 0) {
+      throw new Error(`No pages to print: the document has ${total} pages`)
+    }
+
+    throwIfAborted("Imposition", options.signal)
+    const result = await parser.getScreenshot({
+      partial: pages,
+      desiredWidth: Math.ceil((cellWidth / 72) * IMPOSITION_DPI),
+      imageDataUrl: false,
+    })
+    pageImages = result.pages.map(
+      (page) => `data:image/png;base64,${Buffer.from(page.data).toString("base64")}`
+    )
+  } finally {
+    await parser.destroy()
+  }
+
+  return await convertHtmlToPdf(buildNUpHtml(pageImages, numberUp, media), {
+    chromeFlags: ["--no-pdf-header-footer"],
+    tempDirPrefix: "n-up-",
+    signal: options.signal,
+  })
+}
+
+/**
+ * Finds the value of the last option with a name (lp uses the last value).
+ */
+function lastOptionValue(options: string[], name: string): string | undefined {
+  const option = options.filter((candidate) => candidate.startsWith(`${name}=`)).pop()
+  return option?.slice(name.length + 1)
+}
+
+/**
+ * Imposes a PDF job bound for an IPP printer when it asks for more than one page per sheet.
+ * The number-up and page-ranges options are taken out of the job, since the imposed PDF
+ * holds just the selected pages, already laid out on its sheets.
+ *
+ * @param job - Job options with the file to print (its media option sets the paper size of the
+ *   sheets; Letter if it has none)
+ * @param signal - The MCP request's signal
+ * @returns The job to submit, and the imposed PDF to remove once it is submitted (null when
+ *   the job is sent as it is: not an IPP printer, not a PDF, or one page per sheet)
+ * @throws {Error} If the number-up value is not supported or imposition fails
+ */
+export async function imposeIppJob(
+  job: LpJobOptions,
+  signal?: AbortSignal
+): Promise<{ job: LpJobOptions; imposedPdf: string | null }> {
+  const options = job.options ?? []
+  const numberUp = parseInt(lastOptionValue(options, "number-up") ?? "1", 10)
+  if (
+    !isIppUri(job.printer) ||
+    !job.filePath ||
+    extname(job.filePath).toLowerCase() !== ".pdf" ||
+    numberUp === 1
+  ) {
+    return { job, imposedPdf: null }
+  }
+  if (!isNumberUp(numberUp)) {
+    throw new Error(
+      `Invalid number-up=${numberUp}: use one of ${NUMBER_UP_VALUES.join(", ")} pages per sheet.`
+    )
+  }
+
+  const mediaOption = lastOptionValue(options, "media")?.toLowerCase()
+  const media = MEDIA_SIZES.find((size) => size.toLowerCase() === mediaOption)
+
+  const imposedPdf = await imposePdf(job.filePath, numberUp, {
+    media,
+    pageRanges: lastOptionValue(options, "page-ranges"),
+    signal,
+  })
+  return {
+    job: {
+      ...job,
+      filePath: imposedPdf,
+      options: options.filter(
+        (option) => !option.startsWith("number-up=") && !option.startsWith("page-ranges=")
+      ),
+    },
+    imposedPdf,
+  }
+}
@@ -0,0 +1,163 @@
+/**
+ * @fileoverview Office document conversion.
+ * Word processor documents, spreadsheets, and presentations (.docx, .xlsx, .pptx, .odt, .ods,
+ * .odp) are converted to PDF before they are printed, by a converter program. The converter is
+ * LibreOffice, run headless from MCP_PRINTER_LIBREOFFICE_PATH; without one, office documents
+ * are refused rather than sent to a printer that can't read them.
+ *
+ * LibreOffice keeps its settings in a user profile that only one instance can use at a time,
+ * so every conversion runs in a temp directory of its own with its own profile
+ * (-env:UserInstallation), and concurrent conversions don't collide. Conversions share the
+ * render slots with Chrome (MCP_PRINTER_MAX_CONCURRENT_RENDERS) and stop after
+ * MCP_PRINTER_CONVERT_TIMEOUT_SECONDS.
+ */
+
+import { existsSync, readdirSync, rmSync } from "fs"
+import { basename, extname, join } from "path"
+import { pathToFileURL } from "url"
+import { execa, type ExecaError } from "execa"
+import { config } from "../config.js"
+import { PrinterError } from "../errors.js"
+import { logCommand } from "../logger.js"
+import { withRenderSlot } from "../render-limit.js"
+import { abortError, operationSignal, throwIfAborted } from "../timeouts.js"
+import { createTempDir } from "../temp-files.js"
+
+/**
+ * A program that converts office documents to PDF.
+ */
+export interface OfficeConverter {
+  /** Name used in render types and errors (e.g., "LibreOffice") */
+  name: string
+  /**
+   * Converts a document to PDF.
+   *
+   * @param filePath - Document to convert
+   * @param workDir - Empty directory of the conversion's own, for the PDF and any state
+   * @param signal - Signal that stops the conversion
+   * @returns Path to the PDF, in workDir
+   */
+  convert(filePath: string, workDir: string, signal: AbortSignal): Promise<string>
+}
+
+/**
+ * Options for converting an office document.
+ */
+export interface RenderOfficeOptions {
+  /** The MCP request's signal, which stops the conversion */
+  signal?: AbortSignal
+}
+
+/**
+ * Builds the converter that runs LibreOffice headless.
+ *
+ * @param sofficePath - Path to LibreOffice's soffice executable
+ * @returns The converter
+ */
+export function libreOfficeConverter(sofficePath: string): OfficeConverter {
+  return {
+    name: "LibreOffice",
+    async convert(filePath, workDir, signal) {
+      const args = [
+        `-env:UserInstallation=${pathToFileURL(join(workDir, "profile")).href}`,
+        "--headless",
+        "--norestore",
+        "--convert-to",
+        "pdf",
+        "--outdir",
+        workDir,
+        filePath,
+      ]
+      const startedAt = Date.now()
+      try {
+        await execa(sofficePath, args, { cancelSignal: signal })
+        logCommand(sofficePath, args, 0, startedAt)
+      } catch (error) {
+        logCommand(sofficePath, args, (error as ExecaError).exitCode, startedAt)
+        if (signal.aborted) {
+          throw abortError("LibreOffice", signal)
+        }
+        const message = error instanceof Error ? error.message : String(error)
+        throw new Error(`LibreOffice failed to convert ${basename(filePath)}: ${message}`)
+      } finally {
+        // The profile is only needed while LibreOffice runs
+        rmSync(join(workDir, "profile"), { recursive: true, force: true })
+      }
+
+      // soffice exits successfully even when it can't load the document, writing nothing
+      const pdf = readdirSync(workDir).find((name) => name.toLowerCase().endsWith(".pdf"))
+      if (!pdf) {
+        throw new Error(
+          `LibreOffice failed to convert ${basename(filePath)}: no PDF was written (the ` +
+            "document may be damaged or password protected)"
+        )
+      }
+      return join(workDir, pdf)
+    },
+  }
+}
+
+/**
+ * Finds the converter for office documents: LibreOffice at MCP_PRINTER_LIBREOFFICE_PATH.
+ *
+ * @param filePath - Document to print, named in the error
+ * @param extension - The document's type (default: its extension), named in the error
+ * @returns The configured converter
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if no converter is configured, or the configured
+ *   one doesn't exist
+ */
+export function getOfficeConverter(filePath: string, extension?: string): OfficeConverter {
+  const name = basename(filePath)
+  const type = `.${extension ?? extname(filePath).slice(1).toLowerCase()}`
+
+  if (!config.libreofficePath) {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot print ${name}: ${type} documents are converted to PDF with LibreOffice, and libreoffice_path (MCP_PRINTER_LIBREOFFICE_PATH) isn't set.`,
+      {
+        suggestion:
+          "Install LibreOffice and set libreoffice_path in the config file (or MCP_PRINTER_LIBREOFFICE_PATH) to its soffice executable, or export the document to PDF and print that.",
+      }
+    )
+  }
+  if (!existsSync(config.libreofficePath)) {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot print ${name}: ${type} documents are converted to PDF with LibreOffice, and libreoffice_path (MCP_PRINTER_LIBREOFFICE_PATH) is ${config.libreofficePath}, which doesn't exist.`,
+      {
+        suggestion:
+          "Set libreoffice_path to LibreOffice's soffice executable (e.g., /usr/bin/soffice, or /Applications/LibreOffice.app/Contents/MacOS/soffice on macOS).",
+      }
+    )
+  }
+  return libreOfficeConverter(config.libreofficePath)
+}
+
+/**
+ * Converts an office document to PDF in a temp directory of its own, once a render slot is
+ * free.
+ *
+ * @param filePath - Document to convert
+ * @param converter - Converter from getOfficeConverter
+ * @param options - The MCP request's signal
+ * @returns Path to the PDF (remove it with cleanupRenderedPdf)
+ * @throws {PrinterError} TIMEOUT if the conversion takes longer than
+ *   MCP_PRINTER_CONVERT_TIMEOUT_SECONDS
+ * @throws {Error} If the conversion fails or the request is canceled
+ */
+export async function renderOfficeToPdf(
+  filePath: string,
+  converter: OfficeConverter,
+  options: RenderOfficeOptions = {}
+): Promise<string> {
+  const tempDir = createTempDir("office-")
+  try {
+    return await withRenderSlot(() => {
+      throwIfAborted("Rendering", options.signal)
+      return converter.convert(filePath, tempDir, operationSignal("convert", options.signal))
+    })
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+}
@@ -0,0 +1,116 @@
+/**
+ * @fileoverview Page orientation and margins of rendered documents.
+ * Plain text, code, markdown, and HTML are laid out on pages turned to landscape when asked,
+ * with margins in millimeters in place of each renderer's own (sides left out keep theirs).
+ * A PDF printed as it is can't be laid out again, so its orientation is asked of the printer
+ * instead: `-o landscape` through CUPS, or orientation-requested over IPP.
+ */
+
+import { MEDIA_DIMENSIONS, type MediaSize } from "../print-options.js"
+
+/** Orientations a page is laid out in. */
+export const PAGE_ORIENTATIONS = ["portrait", "landscape"] as const
+export type PageOrientation = (typeof PAGE_ORIENTATIONS)[number]
+
+/** Widest margin allowed on a side, in millimeters. */
+export const MAX_PAGE_MARGIN_MM = 50
+
+/** Points per millimeter. */
+export const POINTS_PER_MM = 72 / 25.4
+
+/** Sides of the page, in the order of the CSS margin shorthand. */
+const MARGIN_SIDES = ["top", "right", "bottom", "left"] as const
+
+/**
+ * Page margins in millimeters. Sides left out keep the renderer's own margin.
+ */
+export interface PageMargins {
+  top?: number
+  right?: number
+  bottom?: number
+  left?: number
+}
+
+/**
+ * Orientation and margins of a rendered document's pages.
+ */
+export interface PageLayout {
+  /** Page orientation (default: portrait) */
+  orientation?: PageOrientation
+  /** Margins in millimeters (default: the renderer's) */
+  margins?: PageMargins
+}
+
+/**
+ * Validates page margins.
+ *
+ * @param margins - Margins in millimeters
+ * @throws {Error} If a side isn't a number greater than 0 and at most MAX_PAGE_MARGIN_MM
+ */
+export function validatePageMargins(margins: PageMargins): void {
+  for (const side of MARGIN_SIDES) {
+    const margin = margins[side]
+    if (
+      margin !== undefined &&
+      (!Number.isFinite(margin) || margin <= 0 || margin > MAX_PAGE_MARGIN_MM)
+    ) {
+      throw new Error(
+        `Invalid margins.${side} ${margin}: use millimeters greater than 0 and at most ${MAX_PAGE_MARGIN_MM}.`
+      )
+    }
+  }
+}
+
+/**
+ * Gets the size of a page in points, turned for landscape.
+ *
+ * @param media - Paper size (default: Letter)
+ * @param orientation - Page orientation (default: portrait)
+ * @returns Width and height in points
+ */
+export function pageDimensions(
+  media: MediaSize = "Letter",
+  orientation: PageOrientation = "portrait"
+): { width: number; height: number } {
+  const { width, height } = MEDIA_DIMENSIONS[media]
+  return orientation === "landscape" ? { width: height, height: width } : { width, height }
+}
+
+/**
+ * Gets a page margin in points.
+ *
+ * @param margins - Margins in millimeters
+ * @param side - Side of the page
+ * @param fallback - Renderer's own margin, in points
+ * @returns The margin on that side, in points
+ */
+export function marginPoints(
+  margins: PageMargins | undefined,
+  side: keyof PageMargins,
+  fallback: number
+): number {
+  const margin = margins?.[side]
+  return margin === undefined ? fallback : margin * POINTS_PER_MM
+}
+
+/**
+ * Builds the size and margin declarations of a CSS @page rule.
+ *
+ * @param layout - Orientation and margins
+ * @param defaults - The renderer's own margin (a CSS length; default: the browser's) and paper
+ *   size
+ * @returns Declarations to put in @page
+ */
+export function pageLayoutCss(
+  layout: PageLayout,
+  defaults: { margin?: string; media?: MediaSize } = {}
+): string {
+  const size = [defaults.media, layout.orientation].filter(Boolean).join(" ")
+  return [
+    ...(size ? [`size: ${size};`] : []),
+    ...(defaults.margin ? [`margin: ${defaults.margin};`] : []),
+    ...MARGIN_SIDES.filter((side) => layout.margins?.[side] !== undefined).map(
+      (side) => `margin-${side}: ${layout.margins?.[side]}mm;`
+    ),
+  ].join(" ")
+}
@@ -0,0 +1,459 @@
+/**
+ * @fileoverview Plain text renderer.
+ *
+ * Plain text sent straight to lp is at the mercy of the queue's text filter: some cut lines off
+ * at 80 columns, and tabs land wherever the filter puts its tab stops. This module renders text
+ * to PDF instead, in a monospace font:
+ *
+ * 1. **Streaming**: The file is decoded and read one line at a time, and the HTML is written
+ *    to disk as it is built, so a large log never sits in memory as a single string.
+ *
+ * 2. **Tabs**: Tabs are expanded to stops every `tabWidth` columns (default: 4), so mixed tab
+ *    and space indentation lines up.
+ *
+ * 3. **Long lines**: Lines wrap at spaces ("word", breaking a word only when it is wider than
+ *    the page), at any character ("character"), or not at all ("none"), in which case they are
+ *    cut off at the right margin and end with an ellipsis to show the cut.
+ *
+ * 4. **Orientation**: Pages are portrait or landscape as asked. With "auto", the file is read
+ *    once first, and landscape is chosen when more than a tenth of its lines are wider than a
+ *    portrait page has columns at the font size.
+ *
+ * 5. **PDF Generation**: Chrome headless renders the HTML file, with the header and footer
+ *    templates as page margin boxes (the filename and page numbers when none are set).
+ */
+
+import { createWriteStream, rmSync, writeFileSync } from "fs"
+import { once } from "events"
+import { basename, join } from "path"
+import he from "he"
+import { convertHtmlToPdf } from "../utils.js"
+import { validateFilePath } from "../file-security.js"
+import { config } from "../config.js"
+import { throwIfAborted } from "../timeouts.js"
+import type { MediaSize } from "../print-options.js"
+import { buildHeaderFooterCss, hasHeaderFooter, resolveHeaderFooter } from "./header-footer.js"
+import {
+  CJK_FONT_FAMILIES,
+  detectFileEncoding,
+  readTextLines,
+  resolveEncoding,
+  type CharacterEncoding,
+} from "./encoding.js"
+import {
+  marginPoints,
+  pageDimensions,
+  pageLayoutCss,
+  validatePageMargins,
+  type PageMargins,
+  type PageOrientation,
+} from "./page-layout.js"
+import { createTempDir } from "../temp-files.js"
+
+/** How long lines are broken. */
+export const TEXT_WRAP_MODES = ["word", "character", "none"] as const
+export type TextWrap = (typeof TEXT_WRAP_MODES)[number]
+
+/** Columns between tab stops when no tab width is given. */
+export const DEFAULT_TAB_WIDTH = 4
+
+/** Widest tab stop spacing allowed. */
+export const MAX_TAB_WIDTH = 16
+
+/** Footer printed when no header or footer template is set. */
+const DEFAULT_TEXT_FOOTER = "{filename}||{page} / {pages}"
+
+/** Lines written to the HTML file at a time. */
+const LINES_PER_WRITE = 500
+
+/** Page margin on every side, in points (half an inch). */
+const TEXT_MARGIN = 36
+
+/** Width of a character of the monospace font, as a multiple of the font size. */
+const CHARACTER_WIDTH = 0.6
+
+/** Share of lines wider than a portrait page above which "auto" turns the page to landscape. */
+const LANDSCAPE_LINE_SHARE = 0.1
+
+/** Points per unit of the font sizes that can be measured. */
+const POINTS_PER_UNIT: Record<string, number> = { pt: 1, px: 0.75, mm: 72 / 25.4, in: 72 }
+
+/**
+ * Options for rendering text to PDF.
+ */
+export interface RenderTextOptions {
+  /** How long lines are broken (default: "word") */
+  wrap?: TextWrap
+  /** Columns between tab stops (default: 4) */
+  tabWidth?: number
+  /** Font size (default: MCP_PRINTER_CODE_FONT_SIZE) */
+  fontSize?: string
+  /** Line spacing (default: MCP_PRINTER_CODE_LINE_SPACING) */
+  lineSpacing?: string
+  /** Paper size (default: Chrome's, Letter) */
+  media?: MediaSize
+  /** Page orientation; "auto" picks landscape for files of long lines (default: portrait) */
+  orientation?: PageOrientation | "auto"
+  /** Page margins in millimeters (default: half an inch) */
+  margins?: PageMargins
+  /** Header template (default: MCP_PRINTER_HEADER; empty string for none) */
+  header?: string
+  /** Footer template (default: MCP_PRINTER_FOOTER; empty string for none) */
+  footer?: string
+  /** Value of {title} in header and footer templates (default: the file name) */
+  title?: string
+  /** Character encoding of the file (default: detected) */
+  encoding?: string
+  /** The MCP request's signal, which cancels the render */
+  signal?: AbortSignal
+}
+
+/**
+ * Expands tabs to spaces, with a tab stop every `tabWidth` columns. A tab after spaces (or
+ * text) moves to the next stop, so mixed indentation keeps its alignment.
+ *
+ * @param line - Line of text (without its line break)
+ * @param tabWidth - Columns between tab stops
+ * @returns The line with tabs replaced by spaces
+ */
+export function expandTabs(line: string, tabWidth: number): string {
+  if (!line.includes("\t")) {
+    return line
+  }
+
+  let column = 0
+  let expanded = ""
+  for (const char of line) {
+    if (char === "\t") {
+      const spaces = tabWidth - (column % tabWidth)
+      expanded += " ".repeat(spaces)
+      column += spaces
+    } else {
+      expanded += char
+      column++
+    }
+  }
+  return expanded
+}
+
+/**
+ * Validates a tab width.
+ *
+ * @param tabWidth - Columns between tab stops
+ * @throws {Error} If it isn't a whole number from 1 to MAX_TAB_WIDTH
+ */
+export function validateTabWidth(tabWidth: number): void {
+  if (!Number.isInteger(tabWidth) || tabWidth < 1 || tabWidth > MAX_TAB_WIDTH) {
+    throw new Error(
+      `Invalid tab_width ${tabWidth}: use a whole number from 1 to ${MAX_TAB_WIDTH}.`
+    )
+  }
+}
+
+/**
+ * Converts a font size to points, or to MCP_PRINTER_CODE_FONT_SIZE's default of 10pt when its
+ * unit can't be measured (e.g., "small").
+ */
+function fontSizePoints(fontSize: string): number {
+  const match = fontSize.trim().match(/^(\d+(?:\.\d+)?)\s*(pt|px|mm|in)?$/i)
+  return match ? parseFloat(match[1]) * POINTS_PER_UNIT[(match[2] ?? "pt").toLowerCase()] : 10
+}
+
+/**
+ * Counts the characters that fit across a portrait page at the font size, between the margins.
+ *
+ * @param options - Font size, media, and margins
+ * @returns Columns of a portrait page (at least 1)
+ * @internal Exported for testing purposes
+ */
+export function portraitColumns(options: RenderTextOptions = {}): number {
+  const { width } = pageDimensions(options.media, "portrait")
+  const printable =
+    width -
+    marginPoints(options.margins, "left", TEXT_MARGIN) -
+    marginPoints(options.margins, "right", TEXT_MARGIN)
+  const characterWidth = fontSizePoints(options.fontSize ?? config.code.fontSize) * CHARACTER_WIDTH
+  return Math.max(1, Math.floor(printable / characterWidth))
+}
+
+/**
+ * Converts a line spacing to points at the font size: a plain number is a multiple of the font
+ * size, like CSS line-height, and a spacing that can't be measured counts as 1.5.
+ */
+function lineSpacingPoints(lineSpacing: string, fontSize: number): number {
+  const trimmed = lineSpacing.trim()
+  if (/^\d+(?:\.\d+)?$/.test(trimmed)) {
+    return parseFloat(trimmed) * fontSize
+  }
+  const match = trimmed.match(/^(\d+(?:\.\d+)?)\s*(pt|px|mm|in)$/i)
+  return match ? parseFloat(match[1]) * POINTS_PER_UNIT[match[2].toLowerCase()] : 1.5 * fontSize
+}
+
+/**
+ * Estimates the pages text prints as a portrait page of the renderer would lay it out, without
+ * rendering it: each line (with tabs expanded) takes as many rows as it wraps to, and the rows
+ * are divided by those a page holds between the margins. Plain text streamed to the printer is
+ * counted this way for the page limits and the daily page quota.
+ *
+ * @param content - Text to print
+ * @param options - Tab width, font size, line spacing, media, and margins
+ * @returns Estimated pages (at least 1)
+ */
+export function estimateTextPages(content: string, options: RenderTextOptions = {}): number {
+  const columns = portraitColumns(options)
+  const tabWidth = options.tabWidth ?? DEFAULT_TAB_WIDTH
+  const fontSize = fontSizePoints(options.fontSize ?? config.code.fontSize)
+  const { height } = pageDimensions(options.media, "portrait")
+  const printable =
+    height -
+    marginPoints(options.margins, "top", TEXT_MARGIN) -
+    marginPoints(options.margins, "bottom", TEXT_MARGIN)
+  const lineHeight = lineSpacingPoints(options.lineSpacing ?? config.code.lineSpacing, fontSize)
+  const rowsPerPage = Math.max(1, Math.floor(printable / lineHeight))
+
+  const lines = content.split(/\r?\n/)
+  if (lines.length > 1 && lines[lines.length - 1] === "") {
+    lines.pop()
+  }
+  let rows = 0
+  for (const line of lines) {
+    rows += Math.max(1, Math.ceil(expandTabs(line, tabWidth).length / columns))
+  }
+  return Math.max(1, Math.ceil(rows / rowsPerPage))
+}
+
+/**
+ * Chooses the orientation of "auto": landscape when more than a tenth of the lines (with tabs
+ * expanded) are wider than a portrait page has columns, portrait otherwise.
+ *
+ * @param lines - Lines of the text
+ * @param options - Tab width, font size, media, margins, and signal
+ * @returns The orientation to print the text in
+ * @internal Exported for testing purposes
+ */
+export async function chooseTextOrientation(
+  lines: AsyncIterable<string>,
+  options: RenderTextOptions = {}
+): Promise<PageOrientation> {
+  const columns = portraitColumns(options)
+  const tabWidth = options.tabWidth ?? DEFAULT_TAB_WIDTH
+  let count = 0
+  let wide = 0
+  for await (const line of lines) {
+    if (expandTabs(line, tabWidth).length > columns) {
+      wide++
+    }
+    if (++count % LINES_PER_WRITE === 0) {
+      throwIfAborted("Rendering", options.signal)
+    }
+  }
+  return count > 0 && wide / count > LANDSCAPE_LINE_SHARE ? "landscape" : "portrait"
+}
+
+/**
+ * CSS for each wrap mode. Lines are blocks of their own, so "none" can clip each one at the
+ * margin with an ellipsis.
+ */
+const WRAP_CSS: Record<TextWrap, string> = {
+  word: "white-space: pre-wrap; overflow-wrap: anywhere;",
+  character: "white-space: pre-wrap; word-break: break-all;",
+  none: "white-space: pre; overflow: hidden; text-overflow: ellipsis;",
+}
+
+/**
+ * Builds the start of the HTML document for a text file, up to the opening of its body.
+ *
+ * @param filePath - Path of the text file (its name goes in the header and footer)
+ * @param options - Wrap mode, font size, line spacing, media, orientation ("auto" lays out
+ *   portrait: it is settled before the head is built), margins, header, footer, and title
+ * @returns HTML to write before the lines
+ * @internal Exported for testing purposes
+ */
+export function buildTextHtmlHead(filePath: string, options: RenderTextOptions = {}): string {
+  const wrap = options.wrap ?? "word"
+  const fontSize = options.fontSize ?? config.code.fontSize
+  const lineSpacing = options.lineSpacing ?? config.code.lineSpacing
+
+  const pageCSS = pageLayoutCss(
+    {
+      orientation: options.orientation === "auto" ? undefined : options.orientation,
+      margins: options.margins,
+    },
+    { margin: "0.5in", media: options.media }
+  )
+
+  const headerFooter = resolveHeaderFooter({ header: options.header, footer: options.footer })
+  const filename = basename(filePath)
+  const headerFooterCSS = buildHeaderFooterCss(
+    hasHeaderFooter(headerFooter) ? headerFooter : { footer: DEFAULT_TEXT_FOOTER },
+    { filename, title: options.title || filename }
+  )
+
+  return `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <style>
+    @page {
+      ${pageCSS}
+    }
+
+    /* Header and footer templates */
+    ${headerFooterCSS}
+
+    html, body {
+      margin: 0;
+      padding: 0;
+      font-family: Menlo, Monaco, 'Courier New', ${CJK_FONT_FAMILIES}, monospace;
+      font-size: ${fontSize};
+      line-height: ${lineSpacing};
+    }
+
+    .line {
+      min-height: ${lineSpacing}em;
+      ${WRAP_CSS[wrap]}
+    }
+  </style>
+</head>
+<body>
+`
+}
+
+/**
+ * Builds the HTML for one line of text.
+ *
+ * @param line - Line of text (without its line break)
+ * @param tabWidth - Columns between tab stops
+ * @returns A line element
+ * @internal Exported for testing purposes
+ */
+export function buildTextLine(line: string, tabWidth: number): string {
+  return `<div class="line">${he.escape(expandTabs(line, tabWidth))}</div>\n`
+}
+
+/**
+ * Writes the HTML document for a text file, a batch of lines at a time.
+ */
+async function writeTextHtml(
+  htmlPath: string,
+  filePath: string,
+  lines: AsyncIterable<string>,
+  options: RenderTextOptions
+): Promise<void> {
+  const tabWidth = options.tabWidth ?? DEFAULT_TAB_WIDTH
+  const output = createWriteStream(htmlPath, "utf-8")
+  const closed = once(output, "close")
+  const write = async (html: string) => {
+    if (!output.write(html)) {
+      await once(output, "drain")
+    }
+  }
+
+  try {
+    await write(buildTextHtmlHead(filePath, options))
+    let batch = ""
+    let count = 0
+    for await (const line of lines) {
+      batch += buildTextLine(line, tabWidth)
+      if (++count % LINES_PER_WRITE === 0) {
+        throwIfAborted("Rendering", options.signal)
+        await write(batch)
+        batch = ""
+      }
+    }
+    await write(`${batch}</body>\n</html>\n`)
+  } finally {
+    output.end()
+    await closed
+  }
+}
+
+/**
+ * Renders a plain text file to PDF in a monospace font, with tabs expanded and long lines
+ * wrapped (or cut off) as `wrap` asks. The file is streamed line by line, so very large
+ * files can be rendered.
+ *
+ * @param filePath - Path to the text file to render
+ * @param options - Optional rendering options (wrap, tabWidth, fontSize, lineSpacing, media,
+ *   orientation, margins, header, footer, title, encoding)
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the tab width, margins, or encoding is invalid, the file can't be decoded,
+ *   Chrome is not found, or PDF generation fails
+ */
+export async function renderTextToPdf(
+  filePath: string,
+  options: RenderTextOptions = {}
+): Promise<string> {
+  // Validate file path and options before Chrome is started
+  validateFilePath(filePath)
+  if (options.tabWidth !== undefined) {
+    validateTabWidth(options.tabWidth)
+  }
+  if (options.margins) {
+    validatePageMargins(options.margins)
+  }
+  const encoding = options.encoding
+    ? resolveEncoding(options.encoding)
+    : await detectFileEncoding(filePath)
+
+  return await convertTextFileToPdf(filePath, encoding, options)
+}
+
+/**
+ * Renders text content (e.g., inline content from print_text) to PDF, the same way as a text
+ * file, with `filename` in the default footer.
+ *
+ * @param content - Text to render
+ * @param filename - Name shown in the footer and used for the temp file (e.g., "notes.txt")
+ * @param options - Optional rendering options (the encoding is ignored: content is UTF-8)
+ * @returns Path to the generated temporary PDF file
+ * @throws {Error} If the tab width or margins are invalid, Chrome is not found, or PDF
+ *   generation fails
+ */
+export async function renderTextContentToPdf(
+  content: string,
+  filename: string,
+  options: RenderTextOptions = {}
+): Promise<string> {
+  if (options.tabWidth !== undefined) {
+    validateTabWidth(options.tabWidth)
+  }
+  if (options.margins) {
+    validatePageMargins(options.margins)
+  }
+
+  const tempDir = createTempDir("text-")
+  const tempFilePath = join(tempDir, basename(filename))
+  try {
+    writeFileSync(tempFilePath, content, "utf-8")
+    return await convertTextFileToPdf(tempFilePath, "utf-8", options)
+  } finally {
+    rmSync(tempDir, { recursive: true, force: true })
+  }
+}
+
+/**
+ * Streams a text file in a known encoding into HTML and converts it to PDF. For "auto"
+ * orientation, the file is read through once first to measure its lines.
+ */
+async function convertTextFileToPdf(
+  filePath: string,
+  encoding: CharacterEncoding,
+  textOptions: RenderTextOptions
+): Promise<string> {
+  const options =
+    textOptions.orientation === "auto"
+      ? {
+          ...textOptions,
+          orientation: await chooseTextOrientation(readTextLines(filePath, encoding), textOptions),
+        }
+      : textOptions
+  return await convertHtmlToPdf(
+    (htmlPath) => writeTextHtml(htmlPath, filePath, readTextLines(filePath, encoding), options),
+    {
+      chromeFlags: ["--no-pdf-header-footer"],
+      tempDirPrefix: "text-",
+      signal: options.signal,
+    }
+  )
+}
@@ -0,0 +1,423 @@
+/**
+ * @fileoverview Watermarks ("DRAFT", "CONFIDENTIAL") stamped across every page of a PDF.
+ *
+ * The stamp is added to the PDF that is printed, whether it was rendered (markdown, code,
+ * text, images) or was a PDF to begin with, without re-rendering anything:
+ *
+ * 1. **Incremental update**: New objects (a form XObject with the text, its font and
+ *    transparency) and new versions of the page objects are appended after the original
+ *    bytes. Form fields, annotations, and everything else in the file are left as they are.
+ *
+ * 2. **Page content**: Each page's content is wrapped in q/Q, so state it leaves behind can't
+ *    move the stamp, and the stamp is drawn after it. Annotations and form fields are still
+ *    drawn on top, as always.
+ *
+ * 3. **Layout**: The text runs corner to corner across the page's visible area (its crop box),
+ *    in light gray Helvetica Bold, turned with the page's /Rotate so it reads as the page is
+ *    shown.
+ */
+
+import { rmSync } from "fs"
+import { readFile, writeFile } from "fs/promises"
+import { basename, join } from "path"
+import { PrinterError } from "../errors.js"
+import { throwIfAborted } from "../timeouts.js"
+import {
+  PdfDocument,
+  PdfFormatError,
+  PdfName,
+  PdfRef,
+  PdfStream,
+  PdfUpdate,
+  formatNumber,
+  isDict,
+  type PdfDict,
+  type PdfPage,
+  type PdfValue,
+} from "../pdf/document.js"
+import { CAP_HEIGHT, encodeWinAnsi, helveticaBoldFont, measureText } from "../pdf/helvetica.js"
+import { createTempDir } from "../temp-files.js"
+
+/** Opacity of the stamp when none is given. */
+export const DEFAULT_WATERMARK_OPACITY = 0.25
+
+/** Largest font size used when none is given; longer text is shrunk to fit the page. */
+export const DEFAULT_WATERMARK_FONT_SIZE = 96
+
+/** Range of the watermark_opacity option. */
+export const MIN_WATERMARK_OPACITY = 0.05
+export const MAX_WATERMARK_OPACITY = 1
+
+/** Range of the watermark_font_size option, in points. */
+export const MIN_WATERMARK_FONT_SIZE = 6
+export const MAX_WATERMARK_FONT_SIZE = 300
+
+/** Longest watermark text. */
+export const MAX_WATERMARK_LENGTH = 60
+
+/** Gray level of the stamp (0 is black, 1 is white). */
+const WATERMARK_GRAY = 0.5
+
+/** Share of the page's diagonal that text of the default size may cover. */
+const DIAGONAL_FILL = 0.8
+
+/**
+ * Watermark options.
+ */
+export interface WatermarkOptions {
+  /** Text to stamp (e.g., "DRAFT" or "CONFIDENTIAL") */
+  text: string
+  /** Opacity from 0.05 to 1 (default: 0.25) */
+  opacity?: number
+  /** Font size in points (default: up to 96pt, shrunk to fit the page) */
+  fontSize?: number
+}
+
+/**
+ * Builds watermark options from the tool parameters.
+ *
+ * @param text - The watermark parameter
+ * @param opacity - The watermark_opacity parameter
+ * @param fontSize - The watermark_font_size parameter
+ * @returns Watermark options, or undefined when no watermark is asked for
+ * @throws {Error} If an opacity or font size is given without the text
+ */
+export function watermarkOptions(
+  text?: string,
+  opacity?: number,
+  fontSize?: number
+): WatermarkOptions | undefined {
+  if (text === undefined) {
+    if (opacity !== undefined || fontSize !== undefined) {
+      throw new Error(
+        "watermark_opacity and watermark_font_size need watermark: set it to the text to stamp."
+      )
+    }
+    return undefined
+  }
+  return { text, opacity, fontSize }
+}
+
+/**
+ * Validates watermark options.
+ *
+ * @param options - Watermark options
+ * @throws {Error} If the text is empty, too long, or has characters the stamp font can't
+ *   print, or the opacity or font size is out of range
+ */
+export function validateWatermark(options: WatermarkOptions): void {
+  const text = options.text.trim()
+  if (text.length === 0) {
+    throw new Error("Invalid watermark: the text is empty.")
+  }
+  if ([...text].length > MAX_WATERMARK_LENGTH) {
+    throw new Error(
+      `Invalid watermark: use at most ${MAX_WATERMARK_LENGTH} characters (got ${[...text].length}).`
+    )
+  }
+  if (!encodeWinAnsi(text)) {
+    throw new Error(
+      `Invalid watermark "${text}": use Latin letters, digits, and punctuation (the stamp is ` +
+        `printed in Helvetica).`
+    )
+  }
+  const { opacity, fontSize } = options
+  if (
+    opacity !== undefined &&
+    !(opacity >= MIN_WATERMARK_OPACITY && opacity <= MAX_WATERMARK_OPACITY)
+  ) {
+    throw new Error(
+      `Invalid watermark_opacity ${opacity}: use a number from ${MIN_WATERMARK_OPACITY} to ` +
+        `${MAX_WATERMARK_OPACITY}.`
+    )
+  }
+  if (
+    fontSize !== undefined &&
+    !(fontSize >= MIN_WATERMARK_FONT_SIZE && fontSize <= MAX_WATERMARK_FONT_SIZE)
+  ) {
+    throw new Error(
+      `Invalid watermark_font_size ${fontSize}: use a size from ${MIN_WATERMARK_FONT_SIZE} to ` +
+        `${MAX_WATERMARK_FONT_SIZE} points.`
+    )
+  }
+}
+
+/**
+ * Picks the font size of a stamp: the requested size, or the default shrunk so the text
+ * covers no more than 80% of the page's diagonal.
+ *
+ * @param text - Watermark text
+ * @param width - Width of the page as shown, in points
+ * @param height - Height of the page as shown, in points
+ * @param fontSize - Requested font size, if any
+ * @returns Font size in points
+ */
+export function watermarkFontSize(
+  text: string,
+  width: number,
+  height: number,
+  fontSize?: number
+): number {
+  if (fontSize !== undefined) {
+    return fontSize
+  }
+  const fitted = (DIAGONAL_FILL * Math.hypot(width, height) * 1000) / measureText(text)
+  return Math.min(DEFAULT_WATERMARK_FONT_SIZE, fitted)
+}
+
+/**
+ * Normalizes a page box to [left, bottom, right, top].
+ */
+function normalizeBox(value: PdfValue, document: PdfDocument): number[] | undefined {
+  const box = document.resolve(value)
+  if (!Array.isArray(box) || box.length !== 4) {
+    return undefined
+  }
+  const [x1, y1, x2, y2] = box.map((coordinate) => document.resolve(coordinate))
+  if (![x1, y1, x2, y2].every((coordinate) => typeof coordinate === "number")) {
+    return undefined
+  }
+  const [a, b, c, d] = [x1, y1, x2, y2] as number[]
+  return [Math.min(a, c), Math.min(b, d), Math.max(a, c), Math.max(b, d)]
+}
+
+/**
+ * Normalizes a /Rotate value to 0, 90, 180, or 270.
+ */
+function normalizeRotation(rotate: number): number {
+  return (((Math.round(rotate / 90) * 90) % 360) + 360) % 360
+}
+
+/**
+ * Looks up a page attribute, on the page itself or inherited from the page tree.
+ */
+function pageAttribute(page: PdfPage, key: string): PdfValue | undefined {
+  return page.dict.get(key) ?? page.inherited.get(key)
+}
+
+/**
+ * Builds the content of the stamp for a page box and rotation: the text is centered on the
+ * box and runs across it from the bottom-left corner to the top-right one, as the page is
+ * shown.
+ *
+ * @param text - Watermark text
+ * @param box - Page box [left, bottom, right, top]
+ * @param rotate - The page's /Rotate (0, 90, 180, or 270)
+ * @param options - Watermark options (font size)
+ * @returns Content stream operators
+ * @internal Exported for testing purposes
+ */
+export function buildStampContent(
+  text: string,
+  box: number[],
+  rotate: number,
+  options: Pick<WatermarkOptions, "fontSize"> = {}
+): string {
+  const [left, bottom, right, top] = box
+  const width = right - left
+  const height = top - bottom
+  const turned = rotate === 90 || rotate === 270
+  const [shownWidth, shownHeight] = turned ? [height, width] : [width, height]
+
+  // Map the page as shown onto the page's own coordinates
+  const shown: Record<number, number[]> = {
+    0: [1, 0, 0, 1, left, bottom],
+    90: [0, 1, -1, 0, right, bottom],
+    180: [-1, 0, 0, -1, right, top],
+    270: [0, -1, 1, 0, left, top],
+  }
+  const angle = Math.atan2(shownHeight, shownWidth)
+  const cos = Math.cos(angle)
+  const sin = Math.sin(angle)
+  const fontSize = watermarkFontSize(text, shownWidth, shownHeight, options.fontSize)
+  const textWidth = (measureText(text) * fontSize) / 1000
+  const hex = encodeWinAnsi(text)?.toString("hex").toUpperCase() ?? ""
+
+  const matrix = (values: number[]) => values.map(formatNumber).join(" ")
+  return [
+    "q",
+    "/GS0 gs",
+    `${WATERMARK_GRAY} g`,
+    `${matrix(shown[rotate])} cm`,
+    `1 0 0 1 ${formatNumber(shownWidth / 2)} ${formatNumber(shownHeight / 2)} cm`,
+    `${matrix([cos, sin, -sin, cos, 0, 0])} cm`,
+    "BT",
+    `/F0 ${formatNumber(fontSize)} Tf`,
+    `${formatNumber(-textWidth / 2)} ${formatNumber((-CAP_HEIGHT * fontSize) / 2000)} Td`,
+    `<${hex}> Tj`,
+    "ET",
+    "Q",
+    "",
+  ].join("\n")
+}
+
+/**
+ * Finds a resource name for the stamp that none of the pages use for an XObject, so a PDF
+ * that was already stamped can be stamped again.
+ */
+function stampResourceName(pages: PdfPage[], document: PdfDocument): string {
+  const used = new Set<string>()
+  for (const page of pages) {
+    const resources = document.resolve(pageAttribute(page, "Resources") ?? null)
+    const xobjects = isDict(resources) ? document.resolve(resources.get("XObject") ?? null) : null
+    if (isDict(xobjects)) {
+      for (const name of xobjects.keys()) {
+        used.add(name)
+      }
+    }
+  }
+  let name = "Watermark"
+  for (let i = 1; used.has(name); i++) {
+    name = `Watermark${i}`
+  }
+  return name
+}
+
+/**
+ * Creates an uncompressed stream object from content operators.
+ */
+function contentStream(content: string, dict: PdfDict = new Map()): PdfStream {
+  return new PdfStream(dict, Buffer.from(content, "latin1"))
+}
+
+/**
+ * Stamps a watermark on every page of a PDF.
+ *
+ * @param data - The PDF's bytes
+ * @param options - Watermark text, opacity, and font size
+ * @param name - Name of the file, for error messages
+ * @returns The stamped PDF's bytes (the original followed by an incremental update)
+ * @throws {Error} If the options are invalid
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the PDF is encrypted or can't be read
+ */
+export function stampWatermark(data: Buffer, options: WatermarkOptions, name = "the PDF"): Buffer {
+  validateWatermark(options)
+  const text = options.text.trim()
+
+  let document: PdfDocument
+  let pages: PdfPage[]
+  try {
+    document = new PdfDocument(data)
+    if (document.encrypted) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot add a watermark to ${name}: it is encrypted.`,
+        { suggestion: "Print it without a watermark, or remove the password protection first." }
+      )
+    }
+    pages = document.getPages()
+  } catch (error) {
+    if (error instanceof PdfFormatError) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot add a watermark to ${name}: its structure can't be read (${error.message}).`,
+        {
+          cause: error,
+          suggestion: "Print it without a watermark, or save it again from a PDF viewer first.",
+        }
+      )
+    }
+    throw error
+  }
+
+  const update = new PdfUpdate(document)
+  const font = update.add(helveticaBoldFont())
+  const opacity = options.opacity ?? DEFAULT_WATERMARK_OPACITY
+  const graphicsState = update.add(
+    new Map<string, PdfValue>([
+      ["Type", new PdfName("ExtGState")],
+      ["ca", opacity],
+      ["CA", opacity],
+    ])
+  )
+  const resourceName = stampResourceName(pages, document)
+  const open = update.add(contentStream("q\n"))
+  const close = update.add(contentStream("Q\n"))
+  const draw = update.add(contentStream(`q /${resourceName} Do Q\n`))
+
+  // One stamp per page size and rotation
+  const stamps = new Map<string, PdfRef>()
+  for (const page of pages) {
+    const box =
+      normalizeBox(pageAttribute(page, "CropBox") ?? null, document) ??
+      normalizeBox(pageAttribute(page, "MediaBox") ?? null, document) ??
+      [0, 0, 612, 792]
+    const rotateValue = document.resolve(pageAttribute(page, "Rotate") ?? 0)
+    const rotate = typeof rotateValue === "number" ? normalizeRotation(rotateValue) : 0
+
+    const key = `${box.join(",")}@${rotate}`
+    let stamp = stamps.get(key)
+    if (!stamp) {
+      stamp = update.add(
+        contentStream(
+          buildStampContent(text, box, rotate, options),
+          new Map<string, PdfValue>([
+            ["Type", new PdfName("XObject")],
+            ["Subtype", new PdfName("Form")],
+            ["BBox", box],
+            [
+              "Resources",
+              new Map<string, PdfValue>([
+                ["Font", new Map([["F0", font]])],
+                ["ExtGState", new Map([["GS0", graphicsState]])],
+              ]),
+            ],
+          ])
+        )
+      )
+      stamps.set(key, stamp)
+    }
+
+    // The page's own resources, or a copy of the inherited ones, with the stamp added
+    const resourcesValue = document.resolve(pageAttribute(page, "Resources") ?? null)
+    const resources: PdfDict = isDict(resourcesValue) ? new Map(resourcesValue) : new Map()
+    const xobjectsValue = document.resolve(resources.get("XObject") ?? null)
+    const xobjects: PdfDict = isDict(xobjectsValue) ? new Map(xobjectsValue) : new Map()
+    xobjects.set(resourceName, stamp)
+    resources.set("XObject", xobjects)
+
+    const contentsValue = page.dict.get("Contents")
+    const resolvedContents = document.resolve(contentsValue ?? null)
+    const contents: PdfValue[] = Array.isArray(resolvedContents)
+      ? resolvedContents
+      : contentsValue instanceof PdfRef
+        ? [contentsValue]
+        : []
+
+    const dict: PdfDict = new Map(page.dict)
+    dict.set("Resources", resources)
+    dict.set("Contents", contents.length > 0 ? [open, ...contents, close, draw] : [draw])
+    update.set(page.ref, dict)
+  }
+
+  return update.toBuffer()
+}
+
+/**
+ * Stamps a watermark on every page of a PDF file, writing the result to a temp file.
+ *
+ * @param pdfPath - Path to the PDF
+ * @param options - Watermark text, opacity, and font size
+ * @param signal - The MCP request's signal
+ * @returns Path to the stamped PDF (in its own temp directory; remove it with cleanupRenderedPdf)
+ * @throws {Error} If the options are invalid or the request is canceled
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the PDF is encrypted or can't be read
+ */
+export async function watermarkPdf(
+  pdfPath: string,
+  options: WatermarkOptions,
+  signal?: AbortSignal
+): Promise<string> {
+  const stamped = stampWatermark(await readFile(pdfPath), options, basename(pdfPath))
+  throwIfAborted("Watermarking", signal)
+
+  const tempDir = createTempDir("watermark-")
+  const outputPath = join(tempDir, basename(pdfPath))
+  try {
+    await writeFile(outputPath, stamped)
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return outputPath
+}
@@ -0,0 +1,140 @@
+/**
+ * @fileoverview The server's own health, for server_status.
+ * Gathers what an assistant needs to work out why printing fails: the backend and whether it
+ * answers, the default printer, the jobs still in the queue, the temp directory's usage, the
+ * configured limits, and the server's version. Everything is read the way the print tools read
+ * it (the backend's printer list, the queue, the config), so nothing needs more permissions
+ * than printing does. A backend that can't be reached is reported, not thrown.
+ */
+
+import { config, type QuotaScope } from "./config.js"
+import { getBackend, type BackendName } from "./backend.js"
+import { describeError, type PrinterErrorCode } from "./errors.js"
+import { countQueuedJobs, type QueueCounts } from "./job-queue.js"
+import { getTempUsage, type TempUsage } from "./temp-files.js"
+import packageJson from "../package.json" with { type: "json" }
+
+/**
+ * Whether the printing backend answers.
+ */
+export interface BackendStatus {
+  /** Backend jobs are sent through (ipp:// printers are reached directly, whatever it is) */
+  name: BackendName
+  /** CUPS server the commands run against ("(local)" for this machine; CUPS only) */
+  cups_server?: string
+  /** Whether listing the printers worked */
+  reachable: boolean
+  /** Printers the backend lists (when reachable) */
+  printers?: number
+  /** Why the backend couldn't be reached */
+  error?: string
+  /** Error code of the failure, if it could be classified */
+  code?: PrinterErrorCode
+}
+
+/**
+ * The printer jobs go to when a tool is called without one.
+ */
+export interface DefaultPrinterStatus {
+  name: string
+  /** MCP_PRINTER_DEFAULT_PRINTER, or the printing system's own default */
+  source: "config" | "system"
+}
+
+/**
+ * The server's health, as server_status reports it.
+ */
+export interface ServerStatus {
+  /** Version of mcp-printer */
+  version: string
+  /** Node.js version the server runs on */
+  node: string
+  /** Operating system */
+  platform: NodeJS.Platform
+  /** Seconds since the server started */
+  uptime_seconds: number
+  backend: BackendStatus
+  /** Default printer, or null if there is none (or the backend can't be reached to ask) */
+  default_printer: DefaultPrinterStatus | null
+  /** Jobs the queue hasn't handed to the printing system yet */
+  queue: QueueCounts
+  temp: TempUsage
+  /** Limits on print jobs (0 = no limit) */
+  limits: {
+    max_copies: number
+    max_pages_per_job: number
+    absolute_max_pages: number
+    confirm_if_over_pages: number
+    max_jobs_per_hour: number
+    max_pages_per_day: number
+    /** Whether the quotas count every client's jobs or each session's own */
+    quota_scope: QuotaScope
+    max_jobs_per_minute: number
+    dedupe_window_seconds: number
+    max_upload_bytes: number
+    max_concurrent_renders: number
+    max_retries: number
+    session_ttl_minutes: number
+  }
+}
+
+/**
+ * Gathers the server's health. Never rejects because of the backend: if it can't be reached,
+ * backend.reachable is false and the error is given.
+ *
+ * @param signal - The MCP request's signal
+ * @returns The server's status
+ */
+export async function getServerStatus(signal?: AbortSignal): Promise<ServerStatus> {
+  const backend = getBackend()
+  const backendStatus: BackendStatus = {
+    name: backend.name,
+    ...(backend.name === "cups" ? { cups_server: config.cupsServer || "(local)" } : {}),
+    reachable: false,
+  }
+  let systemDefault: string | undefined
+  try {
+    const printers = await backend.listPrinters(signal)
+    backendStatus.reachable = true
+    backendStatus.printers = printers.length
+    systemDefault = printers.find((printer) => printer.is_default)?.name
+  } catch (error) {
+    const { message, code } = describeError(error)
+    backendStatus.error = message
+    if (code) {
+      backendStatus.code = code
+    }
+  }
+
+  const defaultPrinter: DefaultPrinterStatus | null = config.defaultPrinter
+    ? { name: config.defaultPrinter, source: "config" }
+    : systemDefault
+      ? { name: systemDefault, source: "system" }
+      : null
+
+  return {
+    version: packageJson.version,
+    node: process.version,
+    platform: process.platform,
+    uptime_seconds: Math.round(process.uptime()),
+    backend: backendStatus,
+    default_printer: defaultPrinter,
+    queue: countQueuedJobs(),
+    temp: getTempUsage(),
+    limits: {
+      max_copies: config.maxCopies,
+      max_pages_per_job: config.maxPagesPerJob,
+      absolute_max_pages: config.absoluteMaxPages,
+      confirm_if_over_pages: config.confirmIfOverPages,
+      max_jobs_per_hour: config.maxJobsPerHour,
+      max_pages_per_day: config.maxPagesPerDay,
+      quota_scope: config.quotaScope,
+      max_jobs_per_minute: config.maxJobsPerMinute,
+      dedupe_window_seconds: config.dedupeWindowSeconds,
+      max_upload_bytes: config.maxUploadBytes,
+      max_concurrent_renders: config.maxConcurrentRenders,
+      max_retries: config.maxRetries,
+      session_ttl_minutes: config.sessionTtlMinutes,
+    },
+  }
+}
@@ -1,45 +1,85 @@
 /**
  * @fileoverview MCP Server implementation for printing operations.
- * Provides a Model Context Protocol server that exposes printing tools via CUPS.
+ * Provides a Model Context Protocol server that exposes printing tools via CUPS or the Windows
+ * print spooler, over stdio (default) or the Streamable HTTP transport.
  */
 
 import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
 import { StdioServerTransport } from "@modelcontextprotocol/sdk/server/stdio.js"
+import type { AddressInfo } from "net"
 import { registerAllTools } from "./tools/index.js"
+import { config } from "./config.js"
+import { getBackend } from "./backend.js"
+import { closeHttpServer, startHttpServer, MCP_ENDPOINT } from "./http-server.js"
+import { DEFAULT_LISTEN, parseListenAddress, type CliOptions } from "./cli.js"
+import { logger, redirectConsoleToLog } from "./logger.js"
+import { exitAfterShutdown, installShutdownHandlers, onShutdown } from "./shutdown.js"
+import { sweepTempDir } from "./temp-files.js"
 import packageJson from "../package.json" with { type: "json" }
 
 /**
- * MCP Server instance for printing via CUPS.
+ * Creates an MCP Server instance for printing, with every tool registered.
  * Handles printer management, print jobs, and document rendering.
+ *
+ * @returns A new McpServer ready to connect to a transport
  */
-const mcpServer = new McpServer({
-  name: "mcp-printer",
-  version: packageJson.version,
-})
+export function createMcpServer(): McpServer {
+  const server = new McpServer({
+    name: "mcp-printer",
+    version: packageJson.version,
+  })
 
-// Register all tools with the server
-registerAllTools(mcpServer)
+  // Register all tools with the server
+  registerAllTools(server)
+  return server
+}
 
 /**
- * Starts the MCP Printer server and connects it to stdio transport.
- * The server will handle tool requests for printer operations via stdin/stdout.
+ * Starts the MCP Printer server on the requested transport.
+ * With stdio (the default), tool requests are handled via stdin/stdout. With http, the server
+ * listens for Streamable HTTP connections at /mcp. SIGINT and SIGTERM (and, with stdio, the
+ * client closing stdin) shut the server down gracefully (see shutdown.ts). Old temp files left
+ * in the work directory are swept first (see temp-files.ts).
  *
- * @throws {Error} If server connection fails or unsupported OS detected
+ * @param options - Transport and listen address (default: stdio)
+ * @throws {Error} If server connection fails or MCP_PRINTER_BACKEND is not a known backend
  */
-export async function startServer() {
-  // Check for unsupported operating systems
-  if (process.platform === "win32") {
-    throw new Error(
-      "MCP Printer is not supported on Windows. " +
-        "This server requires CUPS printing system, which is only available on macOS and Linux. " +
-        "Windows uses a different printing architecture that is not currently supported."
-    )
-  }
+export async function startServer(
+  options: CliOptions = { transport: "stdio", listen: parseListenAddress(DEFAULT_LISTEN) }
+) {
+  // Log platform information, and the backend it prints with (refusing an unknown one)
+  logger.info("MCP Printer Server starting", {
+    platform: process.platform,
+    backend: getBackend().name,
+    version: packageJson.version,
+  })
 
-  // Log platform information
-  console.error(`MCP Printer Server starting on ${process.platform}...`)
+  // Remove temp files left by renders that never finished (a crash, or being killed)
+  sweepTempDir()
+
+  if (options.transport === "http") {
+    const server = await startHttpServer(createMcpServer, options.listen, {
+      authToken: config.authToken,
+    })
+    const { address, port } = server.address() as AddressInfo
+    const host = address.includes(":") ? `[${address}]` : address
+    logger.info("MCP Printer Server listening", { url: `http://${host}:${port}${MCP_ENDPOINT}` })
+    if (!config.authToken) {
+      logger.warn("MCP_PRINTER_AUTH_TOKEN is not set, so anyone who can reach this port can print")
+    }
+    onShutdown(() => closeHttpServer(server))
+    installShutdownHandlers()
+    return
+  }
 
+  // stdout carries JSON-RPC
+  redirectConsoleToLog()
   const transport = new StdioServerTransport()
-  await mcpServer.connect(transport)
-  console.error("MCP Printer Server running on stdio")
+  const server = createMcpServer()
+  await server.connect(transport)
+  onShutdown(() => server.close())
+  installShutdownHandlers()
+  // The client closing stdin ends the session
+  process.stdin.once("end", () => exitAfterShutdown("session closed"))
+  logger.info("MCP Printer Server running on stdio")
 }
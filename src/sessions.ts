@@ -0,0 +1,116 @@
+/**
+ * @fileoverview MCP sessions of the HTTP transport and the clients behind them.
+ * Over HTTP, several clients (each family member's assistant) can be connected at once, each
+ * with its own Mcp-Session-Id. Every session is recorded here with the name and version its
+ * client declared in initialize, and when it last sent a request. The job history records the
+ * session and client that queued each job (so list_recent_jobs can list a client's own jobs),
+ * the print quotas can be counted per session (MCP_PRINTER_QUOTA_SCOPE), and sessions idle for
+ * longer than MCP_PRINTER_SESSION_TTL_MINUTES are closed by the HTTP transport, with their jobs
+ * that haven't been submitted yet canceled. The stdio transport has one client and no session
+ * ID, so nothing is recorded for it.
+ */
+
+import { logger } from "./logger.js"
+
+/**
+ * The name and version a client declared in initialize.
+ */
+export interface ClientInfo {
+  name: string
+  version: string
+}
+
+/**
+ * An MCP session of the HTTP transport.
+ */
+export interface ClientSession {
+  /** Mcp-Session-Id */
+  id: string
+  /** Client that opened the session, if it said */
+  client?: ClientInfo
+  /** When the session was opened (ISO 8601) */
+  opened_at: string
+  /** When the session last sent a request, in milliseconds */
+  lastActiveAt: number
+}
+
+const sessions = new Map<string, ClientSession>()
+
+/**
+ * Records a session the HTTP transport has opened.
+ *
+ * @param id - Mcp-Session-Id
+ * @param client - clientInfo from the initialize request
+ * @param now - The current time, in milliseconds
+ * @returns The session
+ */
+export function openSession(id: string, client?: ClientInfo, now = Date.now()): ClientSession {
+  const session: ClientSession = {
+    id,
+    ...(client ? { client: { name: client.name, version: client.version } } : {}),
+    opened_at: new Date(now).toISOString(),
+    lastActiveAt: now,
+  }
+  sessions.set(id, session)
+  logger.info("session opened", { session: id, client: clientLabel(id) })
+  return session
+}
+
+/**
+ * Marks a session as active, for MCP_PRINTER_SESSION_TTL_MINUTES.
+ *
+ * @param id - Mcp-Session-Id
+ * @param now - The current time, in milliseconds
+ */
+export function touchSession(id: string, now = Date.now()): void {
+  const session = sessions.get(id)
+  if (session) {
+    session.lastActiveAt = now
+  }
+}
+
+/**
+ * Forgets a session that has been closed, by the client or because it was idle.
+ *
+ * @param id - Mcp-Session-Id
+ */
+export function closeSession(id: string): void {
+  if (sessions.delete(id)) {
+    logger.info("session closed", { session: id })
+  }
+}
+
+/**
+ * Looks up a session.
+ *
+ * @param id - Mcp-Session-Id (undefined for the stdio transport)
+ * @returns The session, or undefined if it isn't open
+ */
+export function getSession(id: string | undefined): ClientSession | undefined {
+  return id === undefined ? undefined : sessions.get(id)
+}
+
+/**
+ * Names a session's client for the job history and the logs (e.g., "claude-ai 0.1.0").
+ *
+ * @param id - Mcp-Session-Id (undefined for the stdio transport)
+ * @returns The client's name and version, or undefined if the session didn't declare them
+ */
+export function clientLabel(id: string | undefined): string | undefined {
+  const client = getSession(id)?.client
+  return client ? `${client.name} ${client.version}`.trim() : undefined
+}
+
+/**
+ * Lists the sessions that haven't sent a request for longer than a TTL.
+ *
+ * @param ttlMs - Idle time after which a session expires, in milliseconds
+ * @param now - The current time, in milliseconds
+ * @returns IDs of the expired sessions, oldest activity first
+ */
+export function idleSessions(ttlMs: number, now = Date.now()): string[] {
+  return [...sessions.values()]
+    .filter((session) => now - session.lastActiveAt > ttlMs)
+    .sort((a, b) => a.lastActiveAt - b.lastActiveAt)
+    .map((session) => session.id)
+}
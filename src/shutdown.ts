@@ -0,0 +1,166 @@
+/**
+ * @fileoverview Graceful shutdown.
+ * On SIGINT or SIGTERM, or when the client ends a stdio session, the server stops accepting
+ * tool calls and waits up to MCP_PRINTER_SHUTDOWN_TIMEOUT_SECONDS for the tool calls in flight
+ * (renders) and the job queue (submissions, and the jobs waiting behind them) to finish. What is
+ * still running then is stopped, which removes its temp files, and the jobs still waiting in
+ * the queue are canceled and recorded in the job history as canceled (reason "shutdown"). The
+ * transport is closed last (HTTP sessions get a final notification before their streams end),
+ * and the process exits with 0 if everything finished in time, or 1 if work had to be stopped.
+ * A second Ctrl-C quits right away.
+ */
+
+import { config } from "./config.js"
+import { cancelWaitingJobs, drainQueue } from "./job-queue.js"
+import { logger } from "./logger.js"
+import { abortAllOperations, shutdownSignal } from "./timeouts.js"
+
+/** Longest wait, once work in flight has been stopped, for it to settle and clean up. */
+const SETTLE_TIMEOUT_MS = 5000
+
+let shuttingDown: Promise<number> | undefined
+let activeToolCalls = 0
+const idleListeners: Array<() => void> = []
+const shutdownSteps: Array<() => Promise<void> | void> = []
+
+/**
+ * Checks whether the server is shutting down.
+ *
+ * @returns True once a shutdown has started
+ */
+export function isShuttingDown(): boolean {
+  return shuttingDown !== undefined
+}
+
+/**
+ * Runs a tool call, counting it as work in flight until it settles.
+ *
+ * @param call - The tool call, given the signal it should use: the request's, which also fires
+ *   when the shutdown stops waiting for it
+ * @param signal - The MCP request's signal
+ * @returns The call's result
+ * @throws {Error} If the server is shutting down
+ */
+export async function trackToolCall<T>(
+  call: (signal: AbortSignal) => Promise<T>,
+  signal?: AbortSignal
+): Promise<T> {
+  if (shuttingDown) {
+    throw new Error("The server is shutting down and isn't accepting new requests.")
+  }
+  activeToolCalls++
+  try {
+    return await call(signal ? AbortSignal.any([signal, shutdownSignal]) : shutdownSignal)
+  } finally {
+    activeToolCalls--
+    if (activeToolCalls === 0) {
+      idleListeners.splice(0).forEach((listener) => listener())
+    }
+  }
+}
+
+/**
+ * Adds a step to run at the end of the shutdown, like closing the transport.
+ *
+ * @param step - The step (steps run in the order they were added)
+ */
+export function onShutdown(step: () => Promise<void> | void): void {
+  shutdownSteps.push(step)
+}
+
+/**
+ * Waits for the tool calls in flight, then for the job queue (including jobs they queued).
+ */
+async function waitForWork(): Promise<void> {
+  if (activeToolCalls > 0) {
+    await new Promise<void>((resolve) => idleListeners.push(resolve))
+  }
+  await drainQueue()
+}
+
+/**
+ * Waits for work, giving up after a timeout.
+ *
+ * @returns True if the work finished in time
+ */
+function finishesWithin(work: Promise<void>, ms: number): Promise<boolean> {
+  return new Promise((resolve) => {
+    const timer = setTimeout(() => resolve(false), ms)
+    void work.then(() => {
+      clearTimeout(timer)
+      resolve(true)
+    })
+  })
+}
+
+/**
+ * Shuts the server down: stops accepting tool calls, drains the work in flight (stopping what's
+ * left after MCP_PRINTER_SHUTDOWN_TIMEOUT_SECONDS and canceling the jobs still waiting), and
+ * runs the shutdown steps. Calling it again returns the same shutdown.
+ *
+ * @param reason - Why the server is shutting down (e.g., "SIGTERM"), for the log
+ * @returns The exit code: 0 if all work finished in time, 1 if some had to be stopped
+ */
+export function shutdown(reason: string): Promise<number> {
+  shuttingDown ??= runShutdown(reason)
+  return shuttingDown
+}
+
+/**
+ * Runs the shutdown started by shutdown().
+ */
+async function runShutdown(reason: string): Promise<number> {
+  const startedAt = Date.now()
+  logger.info("shutting down", { reason, tool_calls: activeToolCalls })
+
+  const timeoutMs = Math.max(config.shutdownTimeoutSeconds, 0) * 1000
+  const drained = await finishesWithin(waitForWork(), timeoutMs)
+  if (!drained) {
+    // Waiting jobs are canceled first, so stopping a submission doesn't start the next job
+    const canceled = await cancelWaitingJobs("shutdown")
+    abortAllOperations()
+    const settled = await finishesWithin(waitForWork(), SETTLE_TIMEOUT_MS)
+    logger.warn("stopped work in flight at shutdown", {
+      timeout_seconds: config.shutdownTimeoutSeconds,
+      canceled_jobs: canceled,
+      settled,
+    })
+  }
+
+  for (const step of shutdownSteps) {
+    try {
+      await step()
+    } catch (error) {
+      logger.error("shutdown step failed", { error })
+    }
+  }
+  logger.info("shut down", { drained, duration_ms: Date.now() - startedAt })
+  return drained ? 0 : 1
+}
+
+/**
+ * Shuts the server down, then exits with the shutdown's exit code.
+ *
+ * @param reason - Why the server is shutting down
+ * @param exit - Ends the process (default: process.exit)
+ */
+export function exitAfterShutdown(
+  reason: string,
+  exit: (code: number) => void = (code) => process.exit(code)
+): void {
+  void shutdown(reason).then(exit)
+}
+
+/**
+ * Shuts the server down gracefully on the first SIGINT or SIGTERM. The handlers are only
+ * installed once, so a second signal ends the process right away.
+ *
+ * @param exit - Ends the process (default: process.exit)
+ */
+export function installShutdownHandlers(
+  exit: (code: number) => void = (code) => process.exit(code)
+): void {
+  for (const signal of ["SIGINT", "SIGTERM"] as const) {
+    process.once(signal, () => exitAfterShutdown(signal, exit))
+  }
+}
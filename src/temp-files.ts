@@ -0,0 +1,237 @@
+/**
+ * @fileoverview Temp files of the render pipeline.
+ * Every intermediate file (rendered PDFs, watermarked, imposed, and merged copies, office
+ * conversions, fetched documents) is written under one work directory, MCP_PRINTER_TEMP_DIR,
+ * each render in a subdirectory of its own. A job's subdirectories are removed when it reaches a
+ * final state (see cleanupRenderedPdf and the job queue's cleanup), so anything still there
+ * after a restart was left by a crash:
+ *
+ * 1. **Sweep**: At startup, subdirectories older than MCP_PRINTER_TEMP_MAX_AGE_HOURS are
+ *    removed. Younger ones may belong to another server sharing the work directory, and only
+ *    directories named like a render's are touched, so a work directory pointed at a folder
+ *    with other files in it (or owned by another user) doesn't lose them.
+ *
+ * 2. **Budget**: While the work directory holds more than MCP_PRINTER_TEMP_MAX_MB, new renders
+ *    are refused with TEMP_SPACE_EXCEEDED instead of filling the disk. Renders already running
+ *    finish, and the space comes back as their jobs print.
+ */
+
+import {
+  chmodSync,
+  existsSync,
+  lstatSync,
+  mkdirSync,
+  mkdtempSync,
+  readdirSync,
+  rmSync,
+} from "fs"
+import { tmpdir } from "os"
+import { dirname, join } from "path"
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+import { logger } from "./logger.js"
+
+/** Bytes in a megabyte, for MCP_PRINTER_TEMP_MAX_MB. */
+const BYTES_PER_MB = 1024 * 1024
+
+/**
+ * Prefixes the renders give createTempDir, which the startup sweep recognizes their directories
+ * by. Add a render's prefix here when it gets one of its own.
+ */
+export const TEMP_DIR_PREFIXES = [
+  "booklet-",
+  "code-",
+  "cover-",
+  "data-",
+  "html-",
+  "image-",
+  "markdown-",
+  "merge-",
+  "n-up-",
+  "office-",
+  "render-",
+  "text-",
+  "typed-",
+  "url-",
+  "watermark-",
+] as const
+
+/**
+ * Usage of the work directory, for server_status.
+ */
+export interface TempUsage {
+  /** The work directory */
+  directory: string
+  /** Bytes of the files in it */
+  bytes: number
+  /** Subdirectories in it: renders in progress, jobs waiting to print, and any left by a crash */
+  directories: number
+  /** Bytes it may hold before new renders are refused (0 = no limit) */
+  max_bytes: number
+  /** Hours after which leftover subdirectories are swept at startup (0 = never) */
+  max_age_hours: number
+}
+
+/**
+ * The work directory temp files are written under (MCP_PRINTER_TEMP_DIR).
+ */
+export function tempRoot(): string {
+  return config.tempDir || join(tmpdir(), "mcp-printer")
+}
+
+/**
+ * Bytes the work directory may hold (0 = no limit).
+ */
+function maxTempBytes(): number {
+  return config.tempMaxMb > 0 ? Math.round(config.tempMaxMb * BYTES_PER_MB) : 0
+}
+
+/**
+ * Adds up the size of a file, or of every file under a directory. Files removed while they are
+ * counted (a job finishing) count as nothing.
+ */
+function treeSize(path: string): number {
+  try {
+    const stats = lstatSync(path)
+    if (!stats.isDirectory()) {
+      return stats.size
+    }
+    return readdirSync(path).reduce((total, name) => total + treeSize(join(path, name)), 0)
+  } catch {
+    return 0
+  }
+}
+
+/**
+ * Measures the work directory.
+ *
+ * @returns Its path, size, subdirectory count, and limits
+ */
+export function getTempUsage(): TempUsage {
+  const directory = tempRoot()
+  const names = existsSync(directory) ? readdirSync(directory) : []
+  return {
+    directory,
+    bytes: names.reduce((total, name) => total + treeSize(join(directory, name)), 0),
+    directories: names.length,
+    max_bytes: maxTempBytes(),
+    max_age_hours: config.tempMaxAgeHours > 0 ? config.tempMaxAgeHours : 0,
+  }
+}
+
+/**
+ * Formats a byte count in megabytes, e.g. "12.5 MB".
+ */
+function formatMb(bytes: number): string {
+  return `${Math.round((bytes / BYTES_PER_MB) * 10) / 10} MB`
+}
+
+/**
+ * Creates a temp directory for a render, in the work directory (created, readable only by the
+ * user running the server, if it doesn't exist).
+ *
+ * @param prefix - Start of the directory's name, saying what it is for (e.g., "markdown-")
+ * @returns Path of the new directory. Remove it when the job is done (cleanupRenderedPdf removes
+ *   the directory of a PDF in it)
+ * @throws {PrinterError} TEMP_SPACE_EXCEEDED if the work directory holds more than
+ *   MCP_PRINTER_TEMP_MAX_MB
+ */
+export function createTempDir(prefix: string): string {
+  const root = tempRoot()
+  const limit = maxTempBytes()
+  if (limit > 0) {
+    const { bytes } = getTempUsage()
+    if (bytes >= limit) {
+      throw new PrinterError(
+        "TEMP_SPACE_EXCEEDED",
+        `Cannot render the document: the temp directory ${root} holds ${formatMb(bytes)}, ` +
+          `over its ${formatMb(limit)} limit (MCP_PRINTER_TEMP_MAX_MB).`
+      )
+    }
+  }
+  mkdirSync(root, { recursive: true, mode: 0o700 })
+  return mkdtempSync(join(root, prefix))
+}
+
+/**
+ * Checks whether a directory was made by createTempDir, so it can be removed with everything in
+ * it.
+ *
+ * @param path - A directory
+ * @returns True if it is a subdirectory of the work directory
+ */
+export function isTempDir(path: string): boolean {
+  return dirname(path) === tempRoot()
+}
+
+/**
+ * Checks that the work directory is safe to sweep: a directory of its own (not a symlink) owned
+ * by the user running the server. Its permissions are tightened to that user alone, as
+ * createTempDir creates it, in case it was made by hand.
+ *
+ * @returns Why it can't be swept, or undefined if it can
+ */
+function unsafeTempRoot(root: string): string | undefined {
+  const stats = lstatSync(root)
+  if (stats.isSymbolicLink()) {
+    return "it is a symlink"
+  }
+  if (!stats.isDirectory()) {
+    return "it is not a directory"
+  }
+  const uid = process.getuid?.()
+  if (uid !== undefined && stats.uid !== uid) {
+    return `it is owned by uid ${stats.uid}, not ${uid}`
+  }
+  if ((stats.mode & 0o077) !== 0) {
+    chmodSync(root, 0o700)
+  }
+  return undefined
+}
+
+/**
+ * Removes subdirectories of the work directory older than MCP_PRINTER_TEMP_MAX_AGE_HOURS,
+ * which were left by renders that never finished (a crash, or the server being killed).
+ * Runs at startup; only directories named with one of TEMP_DIR_PREFIXES are removed, and a
+ * subdirectory that can't be removed is logged and skipped. A work directory that is a symlink
+ * or belongs to another user isn't swept at all.
+ *
+ * @param now - The current time, in milliseconds
+ * @returns Names of the subdirectories removed
+ */
+export function sweepTempDir(now = Date.now()): string[] {
+  const root = tempRoot()
+  const maxAgeMs = config.tempMaxAgeHours * 60 * 60 * 1000
+  if (!(maxAgeMs > 0) || !existsSync(root)) {
+    return []
+  }
+  const unsafe = unsafeTempRoot(root)
+  if (unsafe) {
+    logger.warn("temp directory not swept", { directory: root, reason: unsafe })
+    return []
+  }
+
+  const removed: string[] = []
+  for (const name of readdirSync(root)) {
+    if (!TEMP_DIR_PREFIXES.some((prefix) => name.startsWith(prefix))) {
+      continue
+    }
+    const path = join(root, name)
+    try {
+      const stats = lstatSync(path)
+      if (stats.isDirectory() && now - stats.mtimeMs > maxAgeMs) {
+        rmSync(path, { recursive: true, force: true })
+        removed.push(name)
+      }
+    } catch (error) {
+      logger.warn("temp directory not swept", {
+        path,
+        error: error instanceof Error ? error.message : String(error),
+      })
+    }
+  }
+  if (removed.length > 0) {
+    logger.info("temp directories swept", { directory: root, removed: removed.length })
+  }
+  return removed
+}
@@ -0,0 +1,102 @@
+/**
+ * @fileoverview Timeouts and cancellation for printing operations.
+ * Every printing command and IPP request runs with an AbortSignal that fires when the MCP request
+ * is canceled, the operation's timeout passes, or the server shuts down, so a hung CUPS
+ * scheduler or a printer that drops off the network fails the tool call instead of wedging the
+ * session.
+ */
+
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+
+/**
+ * Kinds of operations with their own timeout: submitting a job, converting an office document
+ * to PDF, and everything else (listing printers, job status, printer capabilities, and
+ * cancellation).
+ */
+export type OperationKind = "submit" | "convert" | "status"
+
+/**
+ * Setting that controls each kind of timeout.
+ */
+const TIMEOUT_SETTINGS: Record<OperationKind, string> = {
+  submit: "MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS",
+  convert: "MCP_PRINTER_CONVERT_TIMEOUT_SECONDS",
+  status: "MCP_PRINTER_STATUS_TIMEOUT_SECONDS",
+}
+
+// Aborted when the server stops waiting for work in flight at shutdown (see shutdown.ts)
+const shutdownController = new AbortController()
+
+/**
+ * Signal that fires when the server shuts down. Every operation signal includes it.
+ */
+export const shutdownSignal: AbortSignal = shutdownController.signal
+
+/**
+ * Stops every operation still running, because the server is shutting down.
+ */
+export function abortAllOperations(): void {
+  shutdownController.abort(new Error("The server is shutting down"))
+}
+
+/**
+ * Returns the signal for one operation: it aborts when the request's signal does, when the
+ * operation's timeout passes, or when the server shuts down. A timeout of 0 (or less) means the
+ * operation is only canceled with the request (or by the shutdown).
+ *
+ * @param kind - Which timeout applies
+ * @param signal - The MCP request's signal, if the operation runs on behalf of a tool call
+ * @returns Signal to pass to the command or request
+ */
+export function operationSignal(kind: OperationKind, signal?: AbortSignal): AbortSignal {
+  const seconds = {
+    submit: config.submitTimeoutSeconds,
+    convert: config.convertTimeoutSeconds,
+    status: config.statusTimeoutSeconds,
+  }[kind]
+  const signals = signal ? [signal, shutdownSignal] : [shutdownSignal]
+
+  if (seconds > 0) {
+    const controller = new AbortController()
+    const timer = setTimeout(
+      () =>
+        controller.abort(
+          new PrinterError("TIMEOUT", `timed out after ${seconds}s (${TIMEOUT_SETTINGS[kind]})`)
+        ),
+      seconds * 1000
+    )
+    timer.unref()
+    signals.push(controller.signal)
+  }
+
+  return AbortSignal.any(signals)
+}
+
+/**
+ * Builds the error for an operation whose signal fired.
+ *
+ * @param operation - What was running (e.g., "lp", or "Print-Job request to printer.local")
+ * @param signal - The operation's signal
+ * @returns A TIMEOUT PrinterError if the operation timed out, otherwise a cancellation Error
+ */
+export function abortError(operation: string, signal: AbortSignal): Error {
+  const reason: unknown = signal.reason
+  if (reason instanceof PrinterError && reason.code === "TIMEOUT") {
+    return new PrinterError("TIMEOUT", `${operation} ${reason.message}`, { cause: reason })
+  }
+  return new Error(`${operation} was canceled`, { cause: reason })
+}
+
+/**
+ * Throws if a signal has already fired, so work is not started for a canceled request.
+ *
+ * @param operation - What is about to run
+ * @param signal - The request's or operation's signal
+ * @throws {Error} The abortError for the signal
+ */
+export function throwIfAborted(operation: string, signal?: AbortSignal): void {
+  if (signal?.aborted) {
+    throw abortError(operation, signal)
+  }
+}
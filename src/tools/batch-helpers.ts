@@ -1,19 +1,50 @@
 /**
- * @fileoverview Batch operation helpers for print, page metadata, and job cancellation operations.
+ * @fileoverview Batch operation helpers for print, page metadata, and job cancellation operations,
+ * and releasing held jobs.
  * Provides interfaces, processing functions, and result formatting for batch tool operations.
  */
 
-import { execa } from "execa"
+import { basename } from "path"
 import {
-  executePrintJob,
   getPdfPageCount,
   calculatePhysicalSheets,
   shouldTriggerConfirmation,
   prepareFileForPrinting,
   isDuplexEnabled,
+  getPagesPerSheet,
   cleanupRenderedPdf,
 } from "../utils.js"
 import { config } from "../config.js"
+import { getBackend } from "../backend.js"
+import type { JobState } from "../cups.js"
+import { cancelIppJob, isIppUri, parseIppJobId, releaseIppJob } from "../ipp/client.js"
+import { validatePrinter } from "../printer-access.js"
+import { savePreview, thumbnailContent, type Preview } from "../preview.js"
+import {
+  cancelQueuedJob,
+  cancelQueuedJobs,
+  getPrintJobStatus,
+  isQueueJobId,
+  queuePrintJob,
+} from "../job-queue.js"
+import { describeError, type PrinterErrorCode } from "../errors.js"
+import {
+  validatePrintOptions,
+  countSelectedPages,
+  type ColorMode,
+  type DuplexMode,
+  type MediaSize,
+  type NumberUp,
+  type QualityLevel,
+} from "../print-options.js"
+import type { ImageFit, ImageOrientation } from "../renderers/image.js"
+import type { PageMargins } from "../renderers/page-layout.js"
+import type { FileFormat } from "../renderers/file-type.js"
+import type { TextWrap } from "../renderers/text.js"
+import { watermarkOptions } from "../renderers/watermark.js"
+import { describeBooklet, validateBookletOptions } from "../renderers/booklet.js"
+import { validateRawOptions } from "../raw.js"
+import { mergeFilesToPdf, type MergeErrorMode, type MergedPdf } from "../renderers/merge.js"
 
 /**
  * Error codes used in batch operations.
@@ -39,6 +70,14 @@ export const RECOMMENDED_BATCH_SIZE = 50
  */
 const formatDuplexInfo = (isDuplex?: boolean) => (isDuplex ? ", duplex" : "")
 
+/**
+ * Format N-up information for display.
+ * @param pagesPerSheet - Pages printed on each side of a sheet
+ * @returns Formatted N-up string (e.g., ", 2-up") or empty string
+ */
+const formatNumberUpInfo = (pagesPerSheet?: number) =>
+  pagesPerSheet && pagesPerSheet > 1 ? `, ${pagesPerSheet}-up` : ""
+
 /**
  * Format render type information for successful operations.
  * @param renderType - The type of rendering performed (e.g., "markdown", "code")
@@ -46,6 +85,35 @@ const formatDuplexInfo = (isDuplex?: boolean) => (isDuplex ? ", duplex" : "")
  */
 const formatRenderInfo = (renderType?: string) => (renderType ? ` (rendered: ${renderType})` : "")
 
+/**
+ * Format the error code and suggestion of a failure, each on its own indented line.
+ * @param failure - Failure with an optional code and suggestion
+ * @returns Formatted lines (with leading newlines) or empty string
+ */
+const formatErrorHint = (failure: { code?: PrinterErrorCode; suggestion?: string }) =>
+  (failure.code ? `\n  Code: ${failure.code}` : "") +
+  (failure.suggestion ? `\n  Suggestion: ${failure.suggestion}` : "")
+
+/**
+ * Build an MCP error result for a failed tool call.
+ *
+ * @param error - Caught error (or an error message)
+ * @returns MCP response flagged as an error. Errors with a code also get a suggestion and
+ *   structured content ({ code, message, suggestion }) the assistant can act on.
+ */
+export function formatErrorResult(error: unknown): {
+  content: Array<{ type: "text"; text: string }>
+  structuredContent?: { code: PrinterErrorCode; message: string; suggestion?: string }
+  isError: true
+} {
+  const { message, code, suggestion } = describeError(error)
+  return {
+    content: [{ type: "text", text: `✗ ${message}${formatErrorHint({ code, suggestion })}` }],
+    ...(code ? { structuredContent: { code, message, suggestion } } : {}),
+    isError: true,
+  }
+}
+
 /**
  * Format render type information for failed operations that would have rendered.
  * @param renderType - The type of rendering that would have been performed
@@ -65,14 +133,43 @@ export interface FilePrintSpec {
   file_path: string
   printer?: string
   copies?: number
+  duplex?: DuplexMode
+  page_ranges?: string
+  media?: MediaSize
+  number_up?: NumberUp
+  color_mode?: ColorMode
+  quality?: QualityLevel
+  hold?: boolean
+  hold_until?: string
+  cover_page?: boolean
   options?: string
   skip_confirmation?: boolean
+  confirm_large_job?: boolean
+  force?: boolean
   line_numbers?: boolean
   color_scheme?: string
   font_size?: string
   line_spacing?: string
   force_markdown_render?: boolean
   force_code_render?: boolean
+  fit?: ImageFit
+  orientation?: ImageOrientation
+  margin_mm?: number
+  margins?: PageMargins
+  header?: string
+  footer?: string
+  format?: FileFormat
+  encoding?: string
+  wrap?: TextWrap
+  tab_width?: number
+  allow_remote_resources?: boolean
+  watermark?: string
+  watermark_opacity?: number
+  watermark_font_size?: number
+  booklet?: boolean
+  raw?: boolean
+  dry_run?: boolean
+  thumbnail?: boolean
 }
 
 /**
@@ -82,46 +179,131 @@ export interface PrintResult {
   success: boolean
   file_path: string
   message: string
+  job_id?: string
   error?: string
+  /** Error code of a failure the assistant can act on */
+  code?: PrinterErrorCode
+  /** What to do about the failure */
+  suggestion?: string
   renderType?: string
+  /** Type the file was printed as (e.g., "pdf (detected from content)") */
+  fileType?: string
+  preview?: Preview
+  /** Options the printer may ignore */
+  warnings?: string[]
+  /** The booklet's sheets and how to fold them, for files printed as booklets */
+  booklet?: string
+  /** The job was queued moments before by an identical request, and wasn't printed again */
+  duplicate?: boolean
 }
 
 /**
  * Handle a file print operation within a batch.
  *
  * This function handles the complete print workflow for one file:
- * - Prepares the file for printing (renders markdown/code if needed)
+ * - Validates print options (copies, duplex, page ranges, media, pages per sheet, color mode,
+ *   quality, holding, cover page, booklet, raw)
+ * - Prepares the file for printing (renders markdown/code if needed, imposes booklets); raw
+ *   files and detected label or receipt printer commands are sent untouched
  * - Checks page count against confirmation threshold
- * - Executes the print job
- * - Cleans up temporary files
+ * - Queues the print job (it is submitted and recorded in the job history when the printer's
+ *   earlier jobs are done), or saves a preview instead for dry runs
+ * - Cleans up temporary files (the queue removes them once a queued job is submitted)
  *
  * @param spec - File print specification including path, printer, and rendering options
+ * @param signal - The MCP request's signal, which cancels rendering and validation
+ * @param session - MCP session the request came from, for the rate limit and the job history
  * @returns PrintResult object with success status and details
  * @throws Never throws - all errors are captured in the result object
  *
  * @remarks
  * - If page count exceeds threshold and skip_confirmation is false, returns error with PAGE_COUNT_CONFIRMATION_REQUIRED
- * - Temporary rendered PDFs are automatically cleaned up in finally block
+ * - Temporary rendered PDFs are cleaned up in the finally block unless the job was queued
+ * - The returned job_id is the queued job ID ("queue#<n>")
  * - Page count check only applies to PDF files (including rendered markdown/code)
+ * - Jobs over the page limits fail with PAGE_LIMIT_EXCEEDED unless confirm_large_job lifts it
+ * - Dry runs skip the confirmation check and leave the preview in MCP_PRINTER_PREVIEW_DIR
+ * - Raw jobs fail with PERMISSION_DENIED unless the printer is in MCP_PRINTER_RAW_ALLOWED_PRINTERS
+ * - Repeating a request within MCP_PRINTER_DEDUPE_WINDOW_SECONDS returns the earlier job, with
+ *   duplicate set, unless force is
  */
-export async function handlePrint(spec: FilePrintSpec): Promise<PrintResult> {
+export async function handlePrint(
+  spec: FilePrintSpec,
+  signal?: AbortSignal,
+  session?: string
+): Promise<PrintResult> {
   const {
     file_path,
     printer,
     copies = 1,
+    duplex,
+    page_ranges,
+    media,
+    number_up,
+    color_mode,
+    quality,
+    hold,
+    hold_until,
+    cover_page,
     options,
     skip_confirmation,
+    confirm_large_job,
+    force,
     line_numbers,
     color_scheme,
     font_size,
     line_spacing,
     force_markdown_render,
     force_code_render,
+    fit,
+    orientation,
+    margin_mm,
+    margins,
+    header,
+    footer,
+    format,
+    encoding,
+    wrap,
+    tab_width,
+    allow_remote_resources,
+    watermark,
+    watermark_opacity,
+    watermark_font_size,
+    booklet,
+    raw,
+    dry_run,
+    thumbnail,
   } = spec
+  const jobOptions = {
+    copies,
+    duplex,
+    page_ranges,
+    media,
+    number_up,
+    color_mode,
+    quality,
+    hold,
+    hold_until,
+    cover_page,
+  }
 
   try {
+    // Reject bad options and disallowed printers before rendering or shelling out to lp
+    validatePrintOptions(jobOptions)
+    if (booklet) {
+      // Booklets are always printed two-sided, flipped on the short edge
+      validateBookletOptions(jobOptions)
+      jobOptions.duplex = "short-edge"
+    }
+    if (raw) {
+      validateRawOptions(jobOptions)
+    }
+    if (printer) {
+      validatePrinter(printer)
+    }
+
     // Use shared rendering function
-    const { actualFilePath, renderedPdf, renderType } = await prepareFileForPrinting({
+    const prepared = await prepareFileForPrinting({
       filePath: file_path,
       lineNumbers: line_numbers,
       colorScheme: color_scheme,
@@ -129,23 +311,72 @@ export async function handlePrint(spec: FilePrintSpec): Promise<PrintResult> {
       lineSpacing: line_spacing,
       forceMarkdownRender: force_markdown_render,
       forceCodeRender: force_code_render,
+      imageFit: fit,
+      orientation,
+      imageMarginMm: margin_mm,
+      margins,
+      header,
+      footer,
+      format,
+      encoding,
+      textWrap: wrap,
+      tabWidth: tab_width,
+      allowRemoteResources: allow_remote_resources,
+      watermark: watermarkOptions(watermark, watermark_opacity, watermark_font_size),
+      media,
+      booklet,
+      raw,
+      signal,
     })
+    const { actualFilePath, renderedPdf, renderType, fileType, bookletSheets } = prepared
+    const bookletInfo =
+      bookletSheets !== undefined ? { booklet: describeBooklet(bookletSheets) } : {}
 
+    let queued = false
     try {
+      if (dry_run) {
+        const preview = await savePreview(actualFilePath, basename(file_path), thumbnail)
+        let pagesInfo = ""
+        if (preview.pages !== undefined) {
+          const pdfPages = page_ranges
+            ? countSelectedPages(page_ranges, preview.pages)
+            : preview.pages
+          const isDuplex = isDuplexEnabled(options, jobOptions.duplex)
+          const pagesPerSheet = getPagesPerSheet(options, number_up)
+          const physicalSheets = calculatePhysicalSheets(pdfPages, isDuplex, pagesPerSheet)
+          pagesInfo =
+            `: ${pdfPages} pages (${physicalSheets} sheets` +
+            `${formatDuplexInfo(isDuplex)}${formatNumberUpInfo(pagesPerSheet)})`
+        }
+        return {
+          success: true,
+          file_path,
+          message: `Dry run, not printed${pagesInfo}${formatRenderInfo(renderType)}`,
+          renderType,
+          fileType,
+          preview,
+          ...bookletInfo,
+        }
+      }
+
       // Check if we need to trigger page count confirmation
       // Try to parse as PDF - if it works, do the page count check. If it fails, it's not a PDF.
-      if (!skip_confirmation && config.confirmIfOverPages > 0) {
+      if (!skip_confirmation && !prepared.raw && config.confirmIfOverPages > 0) {
         try {
-          const pdfPages = await getPdfPageCount(actualFilePath)
-          const isDuplex = isDuplexEnabled(options)
-          const physicalSheets = calculatePhysicalSheets(pdfPages, isDuplex)
+          const documentPages = await getPdfPageCount(actualFilePath)
+          const pdfPages = page_ranges
+            ? countSelectedPages(page_ranges, documentPages)
+            : documentPages
+          const isDuplex = isDuplexEnabled(options, jobOptions.duplex)
+          const pagesPerSheet = getPagesPerSheet(options, number_up)
+          const physicalSheets = calculatePhysicalSheets(pdfPages, isDuplex, pagesPerSheet)
 
           // If exceeds threshold, return error indicating confirmation needed
           if (shouldTriggerConfirmation(physicalSheets)) {
             return {
               success: false,
               file_path,
-              message: `Confirmation required: ${pdfPages} pages (${physicalSheets} sheets${formatDuplexInfo(isDuplex)})`,
+              message: `Confirmation required: ${pdfPages} pages (${physicalSheets} sheets${formatDuplexInfo(isDuplex)}${formatNumberUpInfo(pagesPerSheet)})`,
               error: ERROR_CODES.PAGE_COUNT_CONFIRMATION_REQUIRED,
               renderType,
             }
@@ -156,27 +387,55 @@ export async function handlePrint(spec: FilePrintSpec): Promise<PrintResult> {
         }
       }
 
-      // Execute print job
-      const { printerName } = await executePrintJob(actualFilePath, printer, copies, options)
+      // Queue the job; the queue removes the rendered PDF once the job is submitted
+      const { printerName, job, duplicate, warnings } = await queuePrintJob({
+        filePath: actualFilePath,
+        printer,
+        jobOptions: { ...jobOptions, orientation: prepared.orientation },
+        options,
+        title: basename(file_path),
+        source: file_path,
+        tool: "print_file",
+        raw: prepared.raw,
+        confirmLargeJob: confirm_large_job,
+        cleanup: () => cleanupRenderedPdf(renderedPdf),
+        // Renders differ from one to the next, so the file as given is what repeats
+        identity: { files: [file_path], settings: { ...spec, force: undefined } },
+        force,
+        session,
+        signal,
+      })
+      queued = true
 
       const copiesInfo = copies > 1 ? ` × ${copies} copies` : ""
       return {
         success: true,
         file_path,
-        message: `Printed to ${printerName}${copiesInfo}${formatRenderInfo(renderType)}`,
+        message: duplicate
+          ? `Already queued for ${printerName}${copiesInfo} by an identical request, not printed again (pass force: true to print another one)`
+          : `Queued for ${printerName}${copiesInfo}${formatRenderInfo(renderType)}`,
+        job_id: job.id,
         renderType,
+        fileType,
+        ...bookletInfo,
+        ...(duplicate ? { duplicate } : {}),
+        ...(warnings.length > 0 ? { warnings } : {}),
       }
     } finally {
-      // Clean up rendered PDF if it was created
-      cleanupRenderedPdf(renderedPdf)
+      // Clean up rendered PDF if it was created and not handed to the queue
+      if (!queued) {
+        cleanupRenderedPdf(renderedPdf)
+      }
     }
   } catch (error) {
-    const message = error instanceof Error ? error.message : String(error)
+    const { message, code, suggestion } = describeError(error)
     return {
       success: false,
       file_path,
       message: `Failed to print: ${message}`,
       error: message,
+      code,
+      suggestion,
     }
   }
 }
@@ -192,11 +451,26 @@ export async function handlePrint(spec: FilePrintSpec): Promise<PrintResult> {
  *
  * @remarks
  * - Successful prints show checkmark (✓) with printer name and options
+ * - Dry runs show the preview path, followed by any thumbnails as image content
  * - Failed prints show cross (✗) with error details
  * - Confirmation-required errors are shown without full error stack
+ * - The response is flagged as an error when nothing printed and at least one file failed
+ *   for a reason other than confirmation (e.g., a printer that is not allowed)
+ * - Failures with an error code are also listed in structured content, with their suggestions
  */
 export function formatPrintResults(results: PrintResult[]): {
-  content: Array<{ type: "text"; text: string }>
+  content: Array<
+    { type: "text"; text: string } | { type: "image"; data: string; mimeType: string }
+  >
+  structuredContent?: {
+    errors: Array<{
+      file_path: string
+      code: PrinterErrorCode
+      message: string
+      suggestion?: string
+    }>
+  }
+  isError?: boolean
 } {
   const successful = results.filter((r) => r.success)
   const failed = results.filter((r) => !r.success)
@@ -209,7 +483,26 @@ export function formatPrintResults(results: PrintResult[]): {
 
   // Show successful prints
   for (const result of successful) {
-    text += `✓ ${result.file_path}\n  ${result.message}\n\n`
+    text += `✓ ${result.file_path}\n  ${result.message}\n`
+    if (result.fileType) {
+      text += `  Type: ${result.fileType}\n`
+    }
+    if (result.job_id) {
+      text += `  Job ID: ${result.job_id}\n`
+    }
+    if (result.duplicate) {
+      text += "  Duplicate: true\n"
+    }
+    if (result.booklet) {
+      text += `  Booklet: ${result.booklet}\n`
+    }
+    for (const warning of result.warnings ?? []) {
+      text += `  Warning: ${warning}\n`
+    }
+    if (result.preview) {
+      text += `  Preview: ${result.preview.path}\n`
+    }
+    text += "\n"
   }
 
   // Show failed prints
@@ -218,16 +511,26 @@ export function formatPrintResults(results: PrintResult[]): {
     if (result.error && result.error !== ERROR_CODES.PAGE_COUNT_CONFIRMATION_REQUIRED) {
       text += `: ${result.error}`
     }
-    text += "\n\n"
+    text += `${formatErrorHint(result)}\n\n`
   }
 
+  const hasRealFailure = failed.some(
+    (result) => result.error !== ERROR_CODES.PAGE_COUNT_CONFIRMATION_REQUIRED
+  )
+  const errors = failed.flatMap(({ file_path, code, error, suggestion }) =>
+    code ? [{ file_path, code, message: error ?? "", suggestion }] : []
+  )
+
   return {
     content: [
       {
         type: "text",
         text: text.trim(),
       },
+      ...successful.flatMap((result) => (result.preview ? thumbnailContent(result.preview) : [])),
     ],
+    ...(errors.length > 0 ? { structuredContent: { errors } } : {}),
+    ...(successful.length === 0 && hasRealFailure ? { isError: true } : {}),
   }
 }
 
@@ -247,6 +550,17 @@ export interface FilePageMetaSpec {
   line_spacing?: string
   force_markdown_render?: boolean
   force_code_render?: boolean
+  fit?: ImageFit
+  orientation?: ImageOrientation
+  margin_mm?: number
+  margins?: PageMargins
+  header?: string
+  footer?: string
+  format?: FileFormat
+  encoding?: string
+  wrap?: TextWrap
+  tab_width?: number
+  allow_remote_resources?: boolean
 }
 
 /**
@@ -258,7 +572,11 @@ export interface PageMetaResult {
   pages?: number
   sheets?: number
   duplex?: boolean
+  /** Pages printed on each side of a sheet */
+  number_up?: number
   renderType?: string
+  /** Type the file was read as (e.g., "pdf (detected from content)") */
+  fileType?: string
   error?: string
 }
 
@@ -268,10 +586,11 @@ export interface PageMetaResult {
  * This function:
  * - Prepares the file for printing (renders if needed)
  * - Extracts page count from the PDF
- * - Calculates physical sheets based on duplex settings
+ * - Calculates physical sheets based on duplex and N-up settings
  * - Cleans up temporary files
  *
  * @param spec - File page metadata specification including path and rendering options
+ * @param signal - The MCP request's signal, which cancels rendering
  * @returns PageMetaResult object with success status and page/sheet counts or error details
  * @throws Never throws - all errors are captured in the result object
  *
@@ -280,9 +599,12 @@ export interface PageMetaResult {
  * - Non-PDF files (plain text, images) will return success=false with error message
  * - Temporary rendered PDFs are automatically cleaned up in finally block
  * - Page count is the total number of pages in the PDF
- * - Sheets is the physical paper count (pages/2 for duplex)
+ * - Sheets is the physical paper count (pages/2 for duplex, divided again by number-up)
  */
-export async function handlePageMeta(spec: FilePageMetaSpec): Promise<PageMetaResult> {
+export async function handlePageMeta(
+  spec: FilePageMetaSpec,
+  signal?: AbortSignal
+): Promise<PageMetaResult> {
   const {
     file_path,
     options,
@@ -292,11 +614,22 @@ export async function handlePageMeta(spec: FilePageMetaSpec): Promise<PageMetaRe
     line_spacing,
     force_markdown_render,
     force_code_render,
+    fit,
+    orientation,
+    margin_mm,
+    margins,
+    header,
+    footer,
+    format,
+    encoding,
+    wrap,
+    tab_width,
+    allow_remote_resources,
   } = spec
 
   try {
     // Use shared rendering function
-    const { actualFilePath, renderedPdf, renderType } = await prepareFileForPrinting({
+    const { actualFilePath, renderedPdf, renderType, fileType } = await prepareFileForPrinting({
       filePath: file_path,
       lineNumbers: line_numbers,
       colorScheme: color_scheme,
@@ -304,13 +637,26 @@ export async function handlePageMeta(spec: FilePageMetaSpec): Promise<PageMetaRe
       lineSpacing: line_spacing,
       forceMarkdownRender: force_markdown_render,
       forceCodeRender: force_code_render,
+      imageFit: fit,
+      orientation,
+      imageMarginMm: margin_mm,
+      margins,
+      header,
+      footer,
+      format,
+      encoding,
+      textWrap: wrap,
+      tabWidth: tab_width,
+      allowRemoteResources: allow_remote_resources,
+      signal,
     })
 
     try {
       // Get page count from the file
       const pdfPages = await getPdfPageCount(actualFilePath)
       const isDuplex = isDuplexEnabled(options)
-      const physicalSheets = calculatePhysicalSheets(pdfPages, isDuplex)
+      const pagesPerSheet = getPagesPerSheet(options)
+      const physicalSheets = calculatePhysicalSheets(pdfPages, isDuplex, pagesPerSheet)
 
       return {
         success: true,
@@ -318,7 +664,9 @@ export async function handlePageMeta(spec: FilePageMetaSpec): Promise<PageMetaRe
         pages: pdfPages,
         sheets: physicalSheets,
         duplex: isDuplex,
+        number_up: pagesPerSheet,
         renderType,
+        fileType,
       }
     } finally {
       // Clean up rendered PDF if it was created
@@ -346,6 +694,7 @@ export async function handlePageMeta(spec: FilePageMetaSpec): Promise<PageMetaRe
  * - Successful results show checkmark (✓) with page count, sheet count, and duplex status
  * - Failed results show cross (✗) with error details
  * - Render type is shown for files that were auto-rendered (markdown, code)
+ * - The file type is shown with how it was decided (extension, content, or format option)
  */
 export function formatPageMetaResults(results: PageMetaResult[]): {
   content: Array<{ type: "text"; text: string }>
@@ -361,7 +710,11 @@ export function formatPageMetaResults(results: PageMetaResult[]): {
 
   // Show successful metadata
   for (const result of successful) {
-    text += `✓ ${result.file_path}\n  ${result.pages} pages (${result.sheets} sheets${formatDuplexInfo(result.duplex)})${formatRenderInfo(result.renderType)}\n\n`
+    text += `✓ ${result.file_path}\n  ${result.pages} pages (${result.sheets} sheets${formatDuplexInfo(result.duplex)}${formatNumberUpInfo(result.number_up)})${formatRenderInfo(result.renderType)}\n`
+    if (result.fileType) {
+      text += `  Type: ${result.fileType}\n`
+    }
+    text += "\n"
   }
 
   // Show failed metadata
@@ -399,8 +752,19 @@ export interface CancelJobResult {
   success: boolean
   message: string
   error?: string
+  /** Error code of a failure the assistant can act on */
+  code?: PrinterErrorCode
+  /** What to do about the failure */
+  suggestion?: string
+  /** State of the job before cancellation was attempted (single-job cancellations only) */
+  state?: JobState
 }
 
+/**
+ * Job states in which there is nothing left to cancel.
+ */
+const FINISHED_JOB_STATES: JobState[] = ["completed", "canceled", "aborted"]
+
 /**
  * Handle a job cancellation operation within a batch.
  *
@@ -409,31 +773,47 @@ export interface CancelJobResult {
  * - All jobs for a specific printer
  *
  * @param spec - Job cancellation specification with job_id or printer+cancel_all
+ * @param signal - The MCP request's signal
  * @returns CancelJobResult object with success status and message or error details
  * @throws Never throws - all errors are captured in the result object
  *
  * @remarks
  * - Requires either job_id OR (printer + cancel_all=true)
  * - Invalid parameters return success=false with error message
- * - Uses lprm command for cancellation
+ * - Looks up the job first so a job that already finished is reported differently
+ *   from a job that doesn't exist
+ * - Queued jobs ("queue#<n>") that haven't been submitted yet are dropped from the server's
+ *   queue; cancel_all also drops the printer's queued jobs
+ * - Uses the cancel command for cancellation
  */
-export async function handleCancel(spec: JobCancelSpec): Promise<CancelJobResult> {
+export async function handleCancel(
+  spec: JobCancelSpec,
+  signal?: AbortSignal
+): Promise<CancelJobResult> {
   const { job_id, printer, cancel_all = false } = spec
 
   // Determine the action description for consistent messaging
   const actionDescription = cancel_all ? `all jobs for printer: ${printer}` : `job: ${job_id}`
 
   try {
-    const lprmArgs: string[] = []
-
     if (cancel_all && printer) {
-      lprmArgs.push("-P", printer, "-")
-    } else if (job_id) {
-      if (printer) {
-        lprmArgs.push("-P", printer)
+      if (isIppUri(printer)) {
+        return {
+          success: false,
+          message: `Failed to cancel ${actionDescription}`,
+          error: "cancel_all is not supported for IPP printer URIs; cancel jobs by job_id instead",
+        }
       }
-      lprmArgs.push(job_id)
-    } else {
+      // Drop jobs still waiting in the server's queue, then cancel the ones CUPS has
+      const dropped = cancelQueuedJobs(printer)
+      await getBackend().cancelAllJobs(printer, signal)
+      return {
+        success: true,
+        message: `Cancelled ${actionDescription}${dropped > 0 ? ` (${dropped} queued)` : ""}`,
+      }
+    }
+
+    if (!job_id) {
       return {
         success: false,
         message: "Invalid parameters",
@@ -441,18 +821,67 @@ export async function handleCancel(spec: JobCancelSpec): Promise<CancelJobResult
       }
     }
 
-    await execa("lprm", lprmArgs)
+    // A job still waiting in the server's queue is simply dropped
+    if (isQueueJobId(job_id) && cancelQueuedJob(job_id)) {
+      return {
+        success: true,
+        message: `Cancelled ${actionDescription}`,
+        state: "queued",
+      }
+    }
+
+    // Queued jobs that were already submitted report the printing system's job ID
+    const status = await getPrintJobStatus(job_id, signal)
+    const isIppJob = parseIppJobId(status.job_id) !== null
+
+    if (status.state === "queued") {
+      return {
+        success: false,
+        message: `Failed to cancel ${actionDescription}`,
+        error: "Job is being submitted to the printer; try again in a moment",
+        state: status.state,
+      }
+    }
+
+    if (status.state === "not-found") {
+      return {
+        success: false,
+        message: `Failed to cancel ${actionDescription}`,
+        error: isIppJob
+          ? "Job does not exist on the printer (it was never submitted or has been purged)"
+          : "Job does not exist (it was never submitted or has been purged from CUPS history)",
+        state: status.state,
+      }
+    }
+
+    if (FINISHED_JOB_STATES.includes(status.state)) {
+      return {
+        success: false,
+        message: `Failed to cancel ${actionDescription}`,
+        error: `Job already ${status.state}, nothing to cancel`,
+        state: status.state,
+      }
+    }
+
+    if (isIppJob) {
+      await cancelIppJob(status.job_id, signal)
+    } else {
+      await getBackend().cancelJob(status.job_id, signal)
+    }
 
     return {
       success: true,
       message: `Cancelled ${actionDescription}`,
+      state: status.state,
     }
   } catch (error) {
-    const message = error instanceof Error ? error.message : String(error)
+    const { message, code, suggestion } = describeError(error)
     return {
       success: false,
       message: `Failed to cancel ${actionDescription}`,
       error: message,
+      code,
+      suggestion,
     }
   }
 }
@@ -492,7 +921,7 @@ export function formatCancelResults(results: CancelJobResult[]): {
     if (result.error) {
       text += `: ${result.error}`
     }
-    text += "\n\n"
+    text += `${formatErrorHint(result)}\n\n`
   }
 
   return {
@@ -505,6 +934,309 @@ export function formatCancelResults(results: CancelJobResult[]): {
   }
 }
 
+// ============================================================================
+// JOB RELEASE OPERATIONS
+// ============================================================================
+
+/**
+ * Release a held job so it prints.
+ *
+ * @param jobId - Job ID from a print tool ("queue#<n>") or from get_print_queue
+ * @param signal - The MCP request's signal
+ * @returns MCP response saying whether the job was released
+ * @throws Never throws - errors are returned as error results
+ *
+ * @remarks
+ * - Queued jobs are looked up by the printing system's job ID once they are submitted
+ * - A job that isn't held (already released, printing, or finished) is left alone and the
+ *   response says why; that is not an error
+ */
+export async function handleRelease(
+  jobId: string,
+  signal?: AbortSignal
+): Promise<{ content: Array<{ type: "text"; text: string }>; isError?: true }> {
+  try {
+    const status = await getPrintJobStatus(jobId, signal)
+    const isIppJob = parseIppJobId(status.job_id) !== null
+    const text = (message: string) => ({ content: [{ type: "text" as const, text: message }] })
+
+    if (status.state === "queued") {
+      return formatErrorResult(
+        `Job ${jobId} hasn't reached the printer yet; try again in a moment. It will be held there until it is released.`
+      )
+    }
+    if (status.state === "not-found") {
+      return formatErrorResult(
+        isIppJob
+          ? `Job ${jobId} does not exist on the printer (it was never submitted or has been purged)`
+          : `Job ${jobId} does not exist (it was never submitted or has been purged from CUPS history)`
+      )
+    }
+    if (FINISHED_JOB_STATES.includes(status.state)) {
+      return text(`Job ${status.job_id} is already ${status.state}; nothing to release.`)
+    }
+    if (status.state !== "held") {
+      return text(`Job ${status.job_id} is not held (it is ${status.state}); nothing to release.`)
+    }
+
+    if (isIppJob) {
+      await releaseIppJob(status.job_id, signal)
+    } else {
+      await getBackend().releaseJob(status.job_id, signal)
+    }
+    return text(`✓ Released job ${status.job_id}; it will print now.`)
+  } catch (error) {
+    return formatErrorResult(error)
+  }
+}
+
+// ============================================================================
+// MERGED PRINT OPERATIONS
+// ============================================================================
+
+/**
+ * Specification for a merged print job: several files printed as one job, in order.
+ */
+export interface MergedPrintSpec
+  extends Omit<FilePrintSpec, "file_path" | "format" | "encoding" | "dry_run" | "thumbnail"> {
+  file_paths: string[]
+  title?: string
+  on_error?: MergeErrorMode
+  dry_run?: boolean
+  thumbnail?: boolean
+}
+
+/**
+ * Format the files of a merged job, one indented line each, with the page totals.
+ * @param merged - The merged PDF
+ * @returns Formatted lines, each starting with a newline
+ */
+const formatMergedFiles = (merged: MergedPdf) =>
+  merged.files
+    .map(
+      (file, i) =>
+        `\n  ${i + 1}. ${file.filePath}: ${file.pages} page${file.pages === 1 ? "" : "s"}` +
+        formatRenderInfo(file.renderType)
+    )
+    .join("") +
+  (merged.separatorPages > 0 ? `\n  Separator pages: ${merged.separatorPages}` : "") +
+  `\n  Total: ${merged.totalPages} pages` +
+  merged.skipped
+    .map(({ filePath, message }) => `\n  Warning: Skipped ${filePath}: ${message}`)
+    .join("")
+
+/**
+ * Handle a merged print job: render every file, merge them into one PDF with a separator
+ * page before each file after the first, and queue it as a single job.
+ *
+ * @param spec - Files in order, printer, print options, rendering options, and error mode
+ * @param signal - The MCP request's signal, which cancels rendering
+ * @param session - MCP session the request came from, for the rate limit and the job history
+ * @returns MCP response with the job ID, per-file page counts, and total pages
+ * @throws Never throws - errors are returned as error results
+ *
+ * @remarks
+ * - Every path is checked against the allowed directories before anything is rendered
+ * - With on_error "fail" (the default) the first file that can't be rendered fails the job;
+ *   with "skip" it is left out and reported as a warning
+ * - The page count confirmation and page limits apply to the merged PDF as a whole
+ * - Repeating a request within MCP_PRINTER_DEDUPE_WINDOW_SECONDS returns the earlier job
+ */
+export async function handleMergedPrint(
+  spec: MergedPrintSpec,
+  signal?: AbortSignal,
+  session?: string
+): Promise<{
+  content: Array<
+    { type: "text"; text: string } | { type: "image"; data: string; mimeType: string }
+  >
+  structuredContent?: { code: PrinterErrorCode; message: string; suggestion?: string }
+  isError?: true
+}> {
+  const {
+    file_paths,
+    printer,
+    copies = 1,
+    duplex,
+    page_ranges,
+    media,
+    number_up,
+    color_mode,
+    quality,
+    hold,
+    hold_until,
+    cover_page,
+    options,
+    skip_confirmation,
+    confirm_large_job,
+    force,
+    title,
+    on_error,
+    line_numbers,
+    color_scheme,
+    font_size,
+    line_spacing,
+    force_markdown_render,
+    force_code_render,
+    fit,
+    orientation,
+    margin_mm,
+    margins,
+    header,
+    footer,
+    wrap,
+    tab_width,
+    allow_remote_resources,
+    watermark,
+    watermark_opacity,
+    watermark_font_size,
+    dry_run,
+    thumbnail,
+  } = spec
+  const jobOptions = {
+    copies,
+    duplex,
+    page_ranges,
+    media,
+    number_up,
+    color_mode,
+    quality,
+    hold,
+    hold_until,
+    cover_page,
+  }
+
+  try {
+    // Reject bad options and disallowed printers before rendering or shelling out to lp
+    validatePrintOptions(jobOptions)
+    if (printer) {
+      validatePrinter(printer)
+    }
+
+    const merged = await mergeFilesToPdf(file_paths, {
+      render: {
+        lineNumbers: line_numbers,
+        colorScheme: color_scheme,
+        fontSize: font_size,
+        lineSpacing: line_spacing,
+        forceMarkdownRender: force_markdown_render,
+        forceCodeRender: force_code_render,
+        imageFit: fit,
+        orientation,
+        imageMarginMm: margin_mm,
+        margins,
+        header,
+        footer,
+        textWrap: wrap,
+        tabWidth: tab_width,
+        allowRemoteResources: allow_remote_resources,
+        media,
+      },
+      onError: on_error,
+      watermark: watermarkOptions(watermark, watermark_opacity, watermark_font_size),
+      signal,
+    })
+    const jobTitle =
+      title ||
+      (merged.files.length > 1
+        ? `${basename(merged.files[0].filePath)} + ${merged.files.length - 1} more`
+        : basename(merged.files[0].filePath))
+
+    let queued = false
+    try {
+      const pdfPages = page_ranges
+        ? countSelectedPages(page_ranges, merged.totalPages)
+        : merged.totalPages
+      const isDuplex = isDuplexEnabled(options, duplex)
+      const pagesPerSheet = getPagesPerSheet(options, number_up)
+      const physicalSheets = calculatePhysicalSheets(pdfPages, isDuplex, pagesPerSheet)
+      const sheetsInfo =
+        `${pdfPages} pages (${physicalSheets} sheets` +
+        `${formatDuplexInfo(isDuplex)}${formatNumberUpInfo(pagesPerSheet)})`
+
+      if (dry_run) {
+        const preview = await savePreview(merged.pdfPath, jobTitle, thumbnail)
+        return {
+          content: [
+            {
+              type: "text",
+              text:
+                "✓ Dry run: nothing was sent to the printer\n" +
+                `  Preview: ${preview.path}\n` +
+                `  Title: ${jobTitle}\n` +
+                `  Printing: ${sheetsInfo}${formatMergedFiles(merged)}`,
+            },
+            ...thumbnailContent(preview),
+          ],
+        }
+      }
+
+      // The confirmation threshold applies to the merged job as a whole
+      if (
+        !skip_confirmation &&
+        config.confirmIfOverPages > 0 &&
+        shouldTriggerConfirmation(physicalSheets)
+      ) {
+        return {
+          content: [
+            {
+              type: "text",
+              text: `✗ Confirmation required: ${sheetsInfo}${formatMergedFiles(merged)}`,
+            },
+          ],
+        }
+      }
+
+      // Queue the job; the queue removes the merged PDF once the job is submitted
+      const { printerName, job, duplicate, warnings } = await queuePrintJob({
+        filePath: merged.pdfPath,
+        printer,
+        jobOptions,
+        options,
+        title: jobTitle,
+        source: merged.files.map((file) => basename(file.filePath)).join(", "),
+        tool: "print_files",
+        confirmLargeJob: confirm_large_job,
+        cleanup: () => cleanupRenderedPdf(merged.pdfPath),
+        // The files that were merged, as given: merged PDFs differ from one merge to the next
+        identity: {
+          files: merged.files.map((file) => file.filePath),
+          settings: { ...spec, force: undefined },
+        },
+        force,
+        session,
+        signal,
+      })
+      queued = true
+
+      const copiesInfo = copies > 1 ? ` × ${copies} copies` : ""
+      return {
+        content: [
+          {
+            type: "text",
+            text:
+              `✓ ${merged.files.length} files queued as one job for ${printerName}${copiesInfo}\n` +
+              `  Job ID: ${job.id}\n` +
+              `  Title: ${jobTitle}` +
+              formatMergedFiles(merged) +
+              (duplicate
+                ? "\n  Duplicate: true (an identical job was just queued, so it wasn't printed again; pass force: true to print another one)"
+                : "") +
+              warnings.map((warning) => `\n  Warning: ${warning}`).join(""),
+          },
+        ],
+      }
+    } finally {
+      // Clean up the merged PDF if it was not handed to the queue
+      if (!queued) {
+        cleanupRenderedPdf(merged.pdfPath)
+      }
+    }
+  } catch (error) {
+    return formatErrorResult(error)
+  }
+}
+
 // ============================================================================
 // SHARED BATCH UTILITIES
 // ============================================================================
@@ -0,0 +1,82 @@
+/**
+ * @fileoverview Job history tool and resource registration.
+ * Registers the list_recent_jobs tool and the printer://jobs/recent resource with the MCP server.
+ */
+
+import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { z } from "zod"
+import { listRecentJobs, MAX_HISTORY_ENTRIES } from "../job-history.js"
+
+/** Number of jobs returned when no limit is given. */
+export const DEFAULT_RECENT_JOBS = 20
+
+/** URI of the recent jobs resource. */
+export const RECENT_JOBS_URI = "printer://jobs/recent"
+
+/**
+ * Registers job history tools and resources with the MCP server.
+ *
+ * @param server - The McpServer instance to register with
+ */
+export function registerHistoryTools(server: McpServer) {
+  // list_recent_jobs - Jobs submitted by the print tools, newest first
+  server.registerTool(
+    "list_recent_jobs",
+    {
+      title: "List Recent Jobs",
+      description:
+        "List jobs recently submitted by the print tools, newest first. Returns JSON with each job's ID, tool, printer, title, page count (if known), submission time, current status, and the client that queued it (over HTTP). Use this to answer questions like 'what did I print today?'; set mine to list only the jobs this session queued when other clients share the server.",
+      inputSchema: {
+        limit: z
+          .number()
+          .int()
+          .min(1)
+          .max(MAX_HISTORY_ENTRIES)
+          .optional()
+          .default(DEFAULT_RECENT_JOBS)
+          .describe(`Maximum number of jobs to return (default: ${DEFAULT_RECENT_JOBS})`),
+        mine: z
+          .boolean()
+          .optional()
+          .default(false)
+          .describe(
+            "Only list the jobs this session queued (over HTTP, this client's connection; over stdio, the jobs no HTTP client queued)"
+          ),
+      },
+    },
+    async ({ limit, mine }, { signal, sessionId }) => {
+      const jobs = await listRecentJobs(limit, signal, mine ? { session: sessionId } : undefined)
+      return {
+        content: [
+          {
+            type: "text",
+            text: JSON.stringify({ jobs }, null, 2),
+          },
+        ],
+      }
+    }
+  )
+
+  // printer://jobs/recent - Same history as list_recent_jobs, for clients that read resources
+  server.registerResource(
+    "recent-jobs",
+    RECENT_JOBS_URI,
+    {
+      title: "Recent Print Jobs",
+      description: `The ${DEFAULT_RECENT_JOBS} most recent jobs submitted by the print tools, with their current status`,
+      mimeType: "application/json",
+    },
+    async (uri, { signal }) => {
+      const jobs = await listRecentJobs(DEFAULT_RECENT_JOBS, signal)
+      return {
+        contents: [
+          {
+            uri: uri.href,
+            mimeType: "application/json",
+            text: JSON.stringify({ jobs }, null, 2),
+          },
+        ],
+      }
+    }
+  )
+}
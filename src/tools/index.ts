@@ -1,27 +1,46 @@
 /**
  * @fileoverview Central tool registry.
- * Registers all MCP tools and prompts with the server instance.
+ * Registers all MCP tools, resources, and prompts with the server instance.
  */
 
 import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
 import { registerPrinterTools } from "./printer.js"
 import { registerPrintTools } from "./print.js"
+import { registerHistoryTools } from "./history.js"
+import { registerStatusTools } from "./status.js"
+import { registerPrinterResources } from "./resources.js"
 import { registerPrompts } from "./prompts.js"
+import { registerPrinterMonitor } from "./monitor.js"
+import { logToolCalls, registerLogging } from "./logging.js"
+import { trackToolCalls } from "./shutdown.js"
 import { config } from "../config.js"
 
 /**
  * Registers all available MCP tools and prompts with the given server.
- * Includes printer management tools, file printing, markdown rendering, and workflow prompts.
+ * Includes printer management tools, file printing, markdown rendering, job history, server
+ * status, printer resources, and workflow prompts.
  * Write operations (set_default_printer, cancel_print_job) are conditionally
  * registered based on the MCP_PRINTER_ENABLE_MANAGEMENT configuration.
  * Prompts are conditionally registered based on the MCP_PRINTER_ENABLE_PROMPTS configuration.
+ * Every tool call is logged, and clients receive the server's log as logging notifications
+ * once they set a level. Tool calls are refused once the server is shutting down.
+ * The printer status monitor is registered when MCP_PRINTER_MONITOR_INTERVAL_SECONDS is set.
  *
  * @param server - The McpServer instance to register tools and prompts with
  */
 export function registerAllTools(server: McpServer) {
+  logToolCalls(server)
+  trackToolCalls(server)
+  const logging = registerLogging(server)
   registerPrinterTools(server)
   registerPrintTools(server)
+  registerHistoryTools(server)
+  registerStatusTools(server)
+  registerPrinterResources(server)
   if (config.enablePrompts) {
     registerPrompts(server)
   }
+  if (config.monitorIntervalSeconds > 0) {
+    registerPrinterMonitor(server, logging)
+  }
 }
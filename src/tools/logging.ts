@@ -0,0 +1,115 @@
+/**
+ * @fileoverview MCP logging.
+ * Logs every tool call (with its arguments summarized) and sends the server's log records to
+ * clients as notifications/message once they set a level with logging/setLevel, so a client can
+ * turn up the verbosity of a running server to see why a page didn't print.
+ */
+
+import type { McpServer, RegisteredTool } from "@modelcontextprotocol/sdk/server/mcp.js"
+import {
+  SetLevelRequestSchema,
+  type CallToolResult,
+  type LoggingLevel,
+} from "@modelcontextprotocol/sdk/types.js"
+import {
+  addLogHandler,
+  isLoggingLevelEnabled,
+  logger,
+  logRecordData,
+  MCP_LOG_LEVELS,
+  summarizeArguments,
+} from "../logger.js"
+
+/** Name of the logger in the server's logging notifications. */
+export const SERVER_LOGGER = "mcp-printer"
+
+/**
+ * The logging level of an MCP session, which other notifications (e.g., the printer monitor's)
+ * follow too.
+ */
+export interface SessionLogging {
+  /** Calls the listener whenever the client sets a level */
+  onSetLevel(listener: (level: LoggingLevel) => void): void
+}
+
+/** Tool callback, called with (args, extra) or, for tools without parameters, (extra). */
+export type ToolCallback = (...params: unknown[]) => CallToolResult | Promise<CallToolResult>
+
+/** McpServer.registerTool, loosened so its callback can be wrapped for any tool. */
+export type RegisterTool = (
+  name: string,
+  toolConfig: { inputSchema?: unknown },
+  callback: ToolCallback
+) => RegisteredTool
+
+/**
+ * Logs every tool registered with the server after this is called: each call (with its
+ * arguments summarized), its result, and how long it took.
+ *
+ * @param server - The McpServer instance, before any tool is registered
+ */
+export function logToolCalls(server: McpServer) {
+  const registerTool = server.registerTool.bind(server) as unknown as RegisterTool
+  const loggedRegisterTool: RegisterTool = (name, toolConfig, callback) =>
+    registerTool(name, toolConfig, async (...params) => {
+      const startedAt = Date.now()
+      const args = toolConfig.inputSchema ? params[0] : undefined
+      logger.info("tool call", { tool: name, args: summarizeArguments(args) })
+      try {
+        const result = await callback(...params)
+        logger.info("tool result", {
+          tool: name,
+          is_error: result.isError === true,
+          duration_ms: Date.now() - startedAt,
+        })
+        return result
+      } catch (error) {
+        logger.error("tool failed", { tool: name, error, duration_ms: Date.now() - startedAt })
+        throw error
+      }
+    })
+  server.registerTool = loggedRegisterTool as unknown as McpServer["registerTool"]
+}
+
+/**
+ * Registers logging/setLevel with the MCP server and sends log records at or above the
+ * client's level as notifications/message until the session closes.
+ *
+ * @param server - The McpServer instance, before it connects
+ * @returns The session's logging level, for other notifications to follow
+ */
+export function registerLogging(server: McpServer): SessionLogging {
+  let level: LoggingLevel | undefined
+  const listeners: Array<(level: LoggingLevel) => void> = []
+
+  const removeHandler = addLogHandler((record) => {
+    const recordLevel = MCP_LOG_LEVELS[record.level]
+    if (level !== undefined && isLoggingLevelEnabled(recordLevel, level)) {
+      const message = { level: recordLevel, logger: SERVER_LOGGER, data: logRecordData(record) }
+      server.server.sendLoggingMessage(message).catch(() => {
+        // The session is closing; the record is still in the server's own log
+      })
+    }
+  })
+
+  server.server.registerCapabilities({ logging: {} })
+  server.server.setRequestHandler(SetLevelRequestSchema, async (request) => {
+    level = request.params.level
+    for (const listener of listeners) {
+      listener(level)
+    }
+    return {}
+  })
+
+  const onclose = server.server.onclose
+  server.server.onclose = () => {
+    removeHandler()
+    onclose?.()
+  }
+
+  return {
+    onSetLevel: (listener) => {
+      listeners.push(listener)
+    },
+  }
+}
@@ -0,0 +1,63 @@
+/**
+ * @fileoverview Printer status notifications.
+ * Connects a PrinterMonitor to each MCP session: clients opt in with logging/setLevel (printer
+ * state reasons, at the session's logging level) or resources/subscribe on printer://jobs/recent
+ * (job state changes).
+ */
+
+import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import {
+  SubscribeRequestSchema,
+  UnsubscribeRequestSchema,
+} from "@modelcontextprotocol/sdk/types.js"
+import { config } from "../config.js"
+import { getBackend } from "../backend.js"
+import { listRecentJobs } from "../job-history.js"
+import { filterAllowedPrinters } from "../printer-access.js"
+import { MONITOR_LOGGER, PrinterMonitor } from "../printer-monitor.js"
+import { DEFAULT_RECENT_JOBS, RECENT_JOBS_URI } from "./history.js"
+import type { SessionLogging } from "./logging.js"
+
+/**
+ * Registers the printer status monitor with the MCP server. Must be called before the server
+ * connects, after the recent jobs resource and logging are registered.
+ *
+ * @param server - The McpServer instance to register with
+ * @param logging - The session's logging level, which the monitor's log messages follow
+ */
+export function registerPrinterMonitor(server: McpServer, logging: SessionLogging) {
+  const monitor = new PrinterMonitor(
+    config.monitorIntervalSeconds,
+    {
+      listPrinters: async (signal) =>
+        filterAllowedPrinters(await getBackend().listPrinters(signal)),
+      listJobs: (signal) => listRecentJobs(DEFAULT_RECENT_JOBS, signal),
+    },
+    {
+      log: (level, message) =>
+        server.server.sendLoggingMessage({ level, logger: MONITOR_LOGGER, data: message }),
+      jobsUpdated: () => server.server.sendResourceUpdated({ uri: RECENT_JOBS_URI }),
+    }
+  )
+
+  server.server.registerCapabilities({ resources: { subscribe: true } })
+  logging.onSetLevel((level) => monitor.setLogLevel(level))
+  server.server.setRequestHandler(SubscribeRequestSchema, async (request) => {
+    if (request.params.uri === RECENT_JOBS_URI) {
+      monitor.setJobsSubscribed(true)
+    }
+    return {}
+  })
+  server.server.setRequestHandler(UnsubscribeRequestSchema, async (request) => {
+    if (request.params.uri === RECENT_JOBS_URI) {
+      monitor.setJobsSubscribed(false)
+    }
+    return {}
+  })
+
+  const onclose = server.server.onclose
+  server.server.onclose = () => {
+    monitor.close()
+    onclose?.()
+  }
+}
@@ -1,22 +1,557 @@
 /**
  * @fileoverview File printing tool registration.
- * Registers print_file and get_page_meta tools with the MCP server.
+ * Registers print_file, print_files, print_text, print_raw, print_url, print_data, estimate_job,
+ * and get_page_meta tools with the MCP server.
  */
 
+import { basename } from "path"
 import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
 import { z } from "zod"
 import {
   handlePrint,
+  handleMergedPrint,
   formatPrintResults,
+  formatErrorResult,
   handlePageMeta,
   formatPageMetaResults,
   checkBatchSizeLimit,
   type PrintResult,
   type PageMetaResult,
 } from "./batch-helpers.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../utils.js"
+import { resolvePrinter } from "../printer-access.js"
+import {
+  COLOR_MODES,
+  DUPLEX_MODES,
+  MEDIA_SIZES,
+  QUALITY_LEVELS,
+  HOLD_UNTIL_KEYWORDS,
+  NUMBER_UP_VALUES,
+  isNumberUp,
+  MAX_COPIES_PER_JOB,
+  validatePrintOptions,
+  type MediaSize,
+} from "../print-options.js"
+import { renderMarkdownContentToPdf } from "../renderers/markdown.js"
+import { renderHtmlContentToPdf } from "../renderers/html.js"
+import { prepareUrlForPrinting, type PreparedUrl } from "../url-fetch.js"
+import { savePreview, saveTextPreview, thumbnailContent, type Preview } from "../preview.js"
+import { pagesAreLimited, queuePrintJob } from "../job-queue.js"
+import { checkJobTokens } from "../rate-limit.js"
+import { coverPageMode } from "../renderers/cover-page.js"
+import { IMAGE_FIT_MODES, IMAGE_ORIENTATIONS, type ImageOrientation } from "../renderers/image.js"
+import { FILE_FORMATS, rawLanguage, sniffFile } from "../renderers/file-type.js"
+import { MERGE_ERROR_MODES } from "../renderers/merge.js"
+import {
+  MAX_TAB_WIDTH,
+  TEXT_WRAP_MODES,
+  estimateTextPages,
+  renderTextContentToPdf,
+} from "../renderers/text.js"
+import {
+  MAX_WATERMARK_FONT_SIZE,
+  MAX_WATERMARK_OPACITY,
+  MIN_WATERMARK_FONT_SIZE,
+  MIN_WATERMARK_OPACITY,
+  validateWatermark,
+  watermarkOptions,
+  watermarkPdf,
+  type WatermarkOptions,
+} from "../renderers/watermark.js"
+import { bookletPdf, describeBooklet, validateBookletOptions } from "../renderers/booklet.js"
+import {
+  MAX_PAGE_MARGIN_MM,
+  validatePageMargins,
+  type PageMargins,
+} from "../renderers/page-layout.js"
+import { PrinterError } from "../errors.js"
+import { decodeRawData } from "../raw.js"
+import { UPLOAD_MEDIA_TYPES, storeUpload, type StoredUpload } from "../upload.js"
+import { estimatePdf, formatCost, type JobEstimate } from "../estimate.js"
+
+/**
+ * Default job title for print_text when none is given.
+ */
+const DEFAULT_TEXT_TITLE = "MCP Printer text"
+
+/**
+ * Default job title for print_raw when none is given.
+ */
+const DEFAULT_RAW_TITLE = "MCP Printer raw data"
+
+/** Formats of print_text and estimate_job content. */
+const CONTENT_FORMATS = ["text", "markdown", "html"] as const
+type ContentFormat = (typeof CONTENT_FORMATS)[number]
+
+/**
+ * Builds the result for a dry run: where the preview was saved, its page count, and the
+ * first-page thumbnail if one was rendered.
+ */
+function dryRunResult(preview: Preview, details: string[]) {
+  const lines = [
+    "✓ Dry run: nothing was sent to the printer",
+    `  Preview: ${preview.path}`,
+    ...(preview.pages !== undefined ? [`  Pages: ${preview.pages}`] : []),
+    ...details.map((line) => `  ${line}`),
+  ]
+  return {
+    content: [{ type: "text" as const, text: lines.join("\n") }, ...thumbnailContent(preview)],
+  }
+}
+
+/**
+ * Builds the result of estimate_job: what was estimated, then pages, sheets, and cost.
+ */
+function estimateResult(estimate: JobEstimate, details: string[]) {
+  const { pages, documentPages, sides, colorSides, copies, sheets, cost } = estimate
+  const color = estimate.monochrome
+    ? "printed in grayscale"
+    : estimate.colorChecked
+      ? `${estimate.colorPages} with color`
+      : "color not checked, all counted as color"
+  const layout = [
+    `${sides} printed side${sides === 1 ? "" : "s"} per copy`,
+    ...(estimate.duplex ? ["duplex"] : []),
+    ...(estimate.numberUp > 1 ? [`${estimate.numberUp}-up`] : []),
+    ...(copies > 1 ? [`${copies} copies`] : []),
+  ]
+  const costInfo =
+    cost === undefined
+      ? "not estimated (set MCP_PRINTER_COST_PER_PAGE and MCP_PRINTER_COST_PER_COLOR_PAGE)"
+      : `${formatCost(cost)} (${copies * (sides - colorSides)} black-and-white and ` +
+        `${copies * colorSides} color sides)`
+
+  const lines = [
+    "✓ Estimate: nothing was sent to the printer",
+    ...details.map((line) => `  ${line}`),
+    `  Pages: ${pages}${pages !== documentPages ? ` of ${documentPages}` : ""} per copy, ${color}`,
+    `  Sheets: ${sheets} (${layout.join(", ")})`,
+    `  Cost: ${costInfo}`,
+  ]
+  return { content: [{ type: "text" as const, text: lines.join("\n") }] }
+}
+
+/**
+ * Describes the booklet a file or content was imposed as, for a result's details.
+ */
+function bookletDetails(sheets: number | undefined): string[] {
+  return sheets !== undefined ? [`Booklet: ${describeBooklet(sheets)}`] : []
+}
+
+/**
+ * Formats the line flagging a request that repeated a job queued moments before it, which was
+ * returned instead of printing the document again.
+ */
+function duplicateLine(duplicate: boolean): string {
+  return duplicate
+    ? "\n  Duplicate: true (an identical job was just queued, so it wasn't printed again; pass force: true to print another one)"
+    : ""
+}
+
+/**
+ * Formats warnings about options the printer may ignore, one indented line each.
+ */
+function warningLines(warnings: string[]): string {
+  return warnings.map((warning) => `\n  Warning: ${warning}`).join("")
+}
+
+/**
+ * Builds a temp markdown filename from a job title (shown in the rendered page footer).
+ */
+function markdownFilename(title: string): string {
+  const stem = title.replace(/\.(md|markdown)$/i, "").replace(/[^\w.-]+/g, "_")
+  return `${stem || "document"}.md`
+}
+
+/**
+ * Builds a temp text filename from a job title (shown in the rendered page footer).
+ */
+function textFilename(title: string): string {
+  const stem = title.replace(/\.txt$/i, "").replace(/[^\w.-]+/g, "_")
+  return `${stem || "document"}.txt`
+}
+
+/**
+ * Renders print_text content to PDF (as markdown or HTML, or as plain text when only a
+ * watermark, cover page, booklet, or page layout calls for a PDF), stamped with
+ * the watermark if one is given and imposed as a booklet if one is asked for.
+ */
+async function renderContentToPdf(
+  content: string,
+  format: ContentFormat,
+  options: {
+    title: string
+    header?: string
+    footer?: string
+    media?: MediaSize
+    orientation?: ImageOrientation
+    margins?: PageMargins
+    allowRemoteResources?: boolean
+    watermark?: WatermarkOptions
+    booklet?: boolean
+    signal: AbortSignal
+  }
+): Promise<{ renderedPdf: string; renderType: string; bookletSheets?: number }> {
+  const {
+    title,
+    header,
+    footer,
+    media,
+    margins,
+    allowRemoteResources,
+    watermark,
+    booklet,
+    signal,
+  } = options
+  // Only plain text works out "auto" itself; markdown and HTML are portrait
+  const orientation = options.orientation === "auto" ? undefined : options.orientation
+  let renderedPdf: string
+  let renderType: string
+  if (format === "html") {
+    const rendered = await renderHtmlContentToPdf(content, {
+      allowRemoteResources,
+      media,
+      orientation,
+      margins,
+      signal,
+    })
+    renderedPdf = rendered.pdfPath
+    renderType = rendered.renderType
+  } else if (format === "markdown") {
+    renderedPdf = await renderMarkdownContentToPdf(content, markdownFilename(title), {
+      header,
+      footer,
+      title,
+      orientation,
+      margins,
+      signal,
+    })
+    renderType = "markdown → PDF"
+  } else {
+    renderedPdf = await renderTextContentToPdf(content, textFilename(title), {
+      header,
+      footer,
+      title,
+      media,
+      orientation: options.orientation,
+      margins,
+      signal,
+    })
+    renderType = "text → PDF"
+  }
+  if (watermark) {
+    const unstamped = renderedPdf
+    try {
+      renderedPdf = await watermarkPdf(unstamped, watermark, signal)
+      renderType = `${renderType}, watermarked`
+    } finally {
+      cleanupRenderedPdf(unstamped)
+    }
+  }
+  if (!booklet) {
+    return { renderedPdf, renderType }
+  }
+
+  try {
+    const imposed = await bookletPdf(renderedPdf, { media }, signal)
+    return {
+      renderedPdf: imposed.pdfPath,
+      renderType: `${renderType}, booklet`,
+      bookletSheets: imposed.sheets,
+    }
+  } finally {
+    cleanupRenderedPdf(renderedPdf)
+  }
+}
+
+/**
+ * Stamps a watermark on a fetched document, which must be printed as a PDF (fetched as one or
+ * rendered to one). The unstamped file is removed once the stamped one is written.
+ */
+async function watermarkPreparedUrl(
+  prepared: PreparedUrl,
+  watermark: WatermarkOptions,
+  signal: AbortSignal
+): Promise<PreparedUrl> {
+  if (prepared.type !== "pdf" && !prepared.renderType) {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot add a watermark to ${prepared.url}: it is printed as ${prepared.type}, not as a PDF.`,
+      {
+        suggestion:
+          "Watermarks are stamped on PDFs and on rendered HTML, markdown, and images. Print the URL without a watermark.",
+      }
+    )
+  }
+
+  const stamped = await watermarkPdf(prepared.filePath, watermark, signal)
+  cleanupRenderedPdf(prepared.tempFile)
+  return {
+    ...prepared,
+    filePath: stamped,
+    tempFile: stamped,
+    renderType: prepared.renderType ? `${prepared.renderType}, watermarked` : "watermarked",
+  }
+}
+
+/**
+ * Shared parameter schema for print job options used by both print_file and print_text.
+ */
+const printOptionsSchema = {
+  copies: z
+    .number()
+    .int()
+    .min(1)
+    .max(MAX_COPIES_PER_JOB)
+    .optional()
+    .default(1)
+    .describe(`Number of copies to print (1-${MAX_COPIES_PER_JOB}, default: 1)`),
+  duplex: z
+    .enum(DUPLEX_MODES)
+    .optional()
+    .describe("Two-sided printing: 'long-edge', 'short-edge', or 'none' (default: use config)"),
+  page_ranges: z.string().optional().describe("Pages to print (e.g., '1-3,7')"),
+  media: z.enum(MEDIA_SIZES).optional().describe("Paper size: 'A4', 'Letter', or 'Legal'"),
+  number_up: z
+    .number()
+    .refine(isNumberUp, {
+      message: `number_up must be one of ${NUMBER_UP_VALUES.join(", ")} pages per sheet`,
+    })
+    .optional()
+    .describe(
+      `Pages per side of each sheet, to save paper: ${NUMBER_UP_VALUES.join(", ")} (default: 1). For ipp:// printers the pages are laid out before sending.`
+    ),
+  color_mode: z
+    .enum(COLOR_MODES)
+    .optional()
+    .describe(
+      "'color', 'monochrome' (grayscale, e.g. to avoid color page charges), or 'auto' (default: printer's choice). get_printer_info reports whether the printer supports color."
+    ),
+  quality: z
+    .enum(QUALITY_LEVELS)
+    .optional()
+    .describe(
+      "Print quality: 'draft' (saves toner), 'normal', or 'high' (default: printer's choice)"
+    ),
+}
+
+/**
+ * Shared parameter schema for holding jobs, used by every print tool.
+ */
+const holdSchema = {
+  hold: z
+    .boolean()
+    .optional()
+    .describe(
+      "Hold the job in the printer's queue until it is released with release_job (default: false)"
+    ),
+  hold_until: z
+    .string()
+    .optional()
+    .describe(
+      `Hold the job until a time: an RFC 3339 time in the next 24 hours (e.g., '2026-10-14T18:30:00Z') or one of ${HOLD_UNTIL_KEYWORDS.join(", ")}. release_job prints it sooner.`
+    ),
+}
+
+/**
+ * Shared parameter schema for cover pages, used by every print tool.
+ */
+const coverPageSchema = {
+  cover_page: z
+    .boolean()
+    .optional()
+    .describe(
+      "Start the job with a cover page naming its owner, title, source, and page count, so it can be picked out on a shared printer (default: MCP_PRINTER_COVER_PAGE). The cover counts toward the page limits."
+    ),
+}
+
+/**
+ * Shared parameter schema for lifting the page limit, used by every print tool.
+ */
+const largeJobSchema = {
+  confirm_large_job: z
+    .boolean()
+    .optional()
+    .describe(
+      "Print a job over MCP_PRINTER_MAX_PAGES_PER_JOB pages, once the user has confirmed it (default: false). Jobs over MCP_PRINTER_ABSOLUTE_MAX_PAGES are refused anyway."
+    ),
+}
+
+/**
+ * Shared parameter schema for printing a repeated request again, used by every print tool.
+ */
+const forceSchema = {
+  force: z
+    .boolean()
+    .optional()
+    .describe(
+      "Print even if an identical job was queued in the last MCP_PRINTER_DEDUPE_WINDOW_SECONDS (default: false). Without it, repeating a request (e.g., after a timeout) returns the earlier job's ID with Duplicate: true instead of printing twice."
+    ),
+}
+
+/**
+ * Shared parameter schema for dry runs, used by every print tool.
+ */
+const dryRunSchema = {
+  dry_run: z
+    .boolean()
+    .optional()
+    .describe(
+      "Render the document but save it to the preview directory instead of printing (default: false). Returns the preview path and page count."
+    ),
+  thumbnail: z
+    .boolean()
+    .optional()
+    .describe("With dry_run, also return the first page as a PNG image (default: false)"),
+}
+
+/**
+ * Shared parameter schema for image layout, used by print_file, print_url, and get_page_meta.
+ */
+const imageOptionsSchema = {
+  fit: z
+    .enum(IMAGE_FIT_MODES)
+    .optional()
+    .describe(
+      "How images (PNG, JPEG, GIF, WebP) are scaled onto the page: 'contain' fits the whole image (default), 'fill' covers the printable area and crops the overflow, 'actual-size' prints at 96 DPI"
+    ),
+  margin_mm: z
+    .number()
+    .min(0)
+    .max(50)
+    .optional()
+    .describe("Margin around images in millimeters (overrides global setting)"),
+}
+
+/** A page margin in millimeters. */
+const pageMarginSchema = z.number().positive().max(MAX_PAGE_MARGIN_MM).optional()
+
+/**
+ * Shared parameter schema for page orientation and margins, used by print_file, print_text,
+ * print_url, print_data, estimate_job, and get_page_meta.
+ */
+const pageLayoutSchema = {
+  orientation: z
+    .enum(IMAGE_ORIENTATIONS)
+    .optional()
+    .describe(
+      "Page orientation: 'portrait', 'landscape', or 'auto' (default). Rendered markdown, HTML, code, and text are laid out in it; with 'auto', images match their shape, plain text turns to landscape when more than a tenth of its lines are too wide for a portrait page, and other documents are portrait. PDFs printed as they are are turned by the printer (-o landscape)."
+    ),
+  margins: z
+    .object({
+      top: pageMarginSchema,
+      right: pageMarginSchema,
+      bottom: pageMarginSchema,
+      left: pageMarginSchema,
+    })
+    .optional()
+    .describe(
+      `Page margins of rendered markdown, HTML, code, and text in millimeters, greater than 0 and at most ${MAX_PAGE_MARGIN_MM} (e.g., {"top": 20, "left": 25}); sides left out keep the default`
+    ),
+}
+
+/**
+ * Shared parameter schema for header and footer templates, used by print_file, print_text,
+ * and get_page_meta.
+ */
+const headerFooterSchema = {
+  header: z
+    .string()
+    .optional()
+    .describe(
+      "Header template for rendered markdown, code, and text. Placeholders: {filename}, {title}, {date}, {page}, {pages}; split into left|center|right parts with '|'. Empty string for no header (overrides global setting)"
+    ),
+  footer: z
+    .string()
+    .optional()
+    .describe(
+      "Footer template, e.g. '{filename}||Page {page} of {pages}'. Same placeholders as header. Empty string for no footer (overrides global setting)"
+    ),
+}
+
+/**
+ * Shared parameter schema for watermarks, used by print_file, print_text, and print_url.
+ */
+const watermarkSchema = {
+  watermark: z
+    .string()
+    .optional()
+    .describe(
+      "Text stamped diagonally in light gray across every page (e.g., 'DRAFT', 'CONFIDENTIAL'). PDFs are stamped as they are, keeping form fields and annotations; markdown, code, text, and images are rendered to PDF first. Refused for files that aren't printed as PDFs."
+    ),
+  watermark_opacity: z
+    .number()
+    .min(MIN_WATERMARK_OPACITY)
+    .max(MAX_WATERMARK_OPACITY)
+    .optional()
+    .describe("Opacity of the watermark, from 0.05 to 1 (default: 0.25)"),
+  watermark_font_size: z
+    .number()
+    .min(MIN_WATERMARK_FONT_SIZE)
+    .max(MAX_WATERMARK_FONT_SIZE)
+    .optional()
+    .describe("Font size of the watermark in points (default: 96, shrunk to fit across the page)"),
+}
+
+/**
+ * Shared parameter schema for booklets, used by print_file, print_text, and estimate_job.
+ */
+const bookletSchema = {
+  booklet: z
+    .boolean()
+    .optional()
+    .describe(
+      "Print as a booklet to fold in half (e.g., A5 pages on A4 paper): pages are laid out two to a side in booklet order, padded with blank pages to a multiple of four, on landscape sheets of the media size, and printed two-sided on the short edge. Works on PDFs and on rendered markdown, code, text, HTML, and images. Can't be combined with page_ranges, number_up, or another duplex mode."
+    ),
+}
+
+/**
+ * Shared parameter schema for raw printing, used by print_file and print_text.
+ */
+const rawSchema = {
+  raw: z
+    .boolean()
+    .optional()
+    .describe(
+      "Send the document to the printer untouched, skipping rendering and the printing system's filters (-o raw), e.g. ZPL for a label printer or ESC/POS for a receipt printer. Content that starts with ZPL or ESC/POS commands is sent raw without this. Only allowed for printers in MCP_PRINTER_RAW_ALLOWED_PRINTERS; can't be combined with page_ranges, number_up, watermark, or booklet."
+    ),
+}
+
+/**
+ * Shared parameter schema for HTML rendering, used by print_file, print_files, print_text,
+ * estimate_job, and get_page_meta.
+ */
+const htmlOptionsSchema = {
+  allow_remote_resources: z
+    .boolean()
+    .optional()
+    .describe(
+      "Let HTML load images, stylesheets, and fonts from http(s) URLs while it is rendered (default: false). Off by default because the HTML may come from untrusted pages; scripts never run either way."
+    ),
+}
 
 /**
- * Shared parameter schema for rendering options used by both print_file and get_page_meta.
+ * Shared parameter schema for a file's type and encoding, used by print_file and get_page_meta
+ * (print_files detects them for each file).
+ */
+const fileTypeSchema = {
+  format: z
+    .enum(FILE_FORMATS)
+    .optional()
+    .describe(
+      "Print the file as 'pdf', 'image', 'markdown', 'html', 'code', or 'text', whatever its extension or content ('code' prints the source of HTML). By default the type comes from the extension, or from the content when the extension is missing or contradicts it; binary files of unknown type are refused."
+    ),
+  encoding: z
+    .string()
+    .optional()
+    .describe(
+      "Character encoding of a text, markdown, HTML, or code file (e.g., 'windows-1252', 'shift_jis', 'euc-kr'). By default it is detected (byte order mark, UTF-8, Japanese, Chinese, or Korean encodings, else Windows-1252). Text is printed as UTF-8."
+    ),
+}
+
+/**
+ * Shared parameter schema for rendering options used by print_file, print_files, and
+ * get_page_meta.
  */
 const renderingParametersSchema = {
   line_numbers: z
@@ -32,11 +567,11 @@ const renderingParametersSchema = {
   font_size: z
     .string()
     .optional()
-    .describe("Font size for code files (e.g., '8pt', '10pt', '12pt')"),
+    .describe("Font size for code and plain text files (e.g., '8pt', '10pt', '12pt')"),
   line_spacing: z
     .string()
     .optional()
-    .describe("Line spacing for code files (e.g., '1', '1.5', '2')"),
+    .describe("Line spacing for code and plain text files (e.g., '1', '1.5', '2')"),
   force_markdown_render: z
     .boolean()
     .optional()
@@ -49,6 +584,23 @@ const renderingParametersSchema = {
     .describe(
       "Force code rendering to PDF with syntax highlighting (true=always render, false=never render, undefined=use config)"
     ),
+  wrap: z
+    .enum(TEXT_WRAP_MODES)
+    .optional()
+    .describe(
+      "How long lines of plain text files are broken: 'word' (at spaces, default), 'character' (at any character), or 'none' (cut off at the margin, marked with an ellipsis)"
+    ),
+  tab_width: z
+    .number()
+    .int()
+    .min(1)
+    .max(MAX_TAB_WIDTH)
+    .optional()
+    .describe("Columns between tab stops in plain text files (default: 4)"),
+  ...imageOptionsSchema,
+  ...pageLayoutSchema,
+  ...headerFooterSchema,
+  ...htmlOptionsSchema,
 }
 
 /**
@@ -64,7 +616,7 @@ export function registerPrintTools(server: McpServer) {
     {
       title: "Print File",
       description:
-        "Print a file to a specified printer. Supports PDF, text, and other common formats. Can specify number of copies and print options.",
+        "Print a file to a specified printer. Supports PDF, text, and other common formats; images (PNG, JPEG, GIF, WebP) are scaled onto a page using fit and orientation, and HTML is rendered with scripts and network access disabled. The file type is detected from the content when the extension is missing or wrong, and reported in the result. Can specify copies, duplex, page ranges, paper size, color mode, quality, and print options. Jobs are queued and sent to each printer one at a time; returns the queued job ID for get_job_status.",
       inputSchema: {
         files: z
           .array(
@@ -74,14 +626,11 @@ export function registerPrintTools(server: McpServer) {
                 .string()
                 .optional()
                 .describe(
-                  "Printer name (use list_printers to see available printers). Optional if default printer is set."
+                  "Printer name (use list_printers to see available printers), or an ipp:// or ipps:// printer URI to print directly over IPP. Optional if default printer is set."
                 ),
-              copies: z
-                .number()
-                .min(1)
-                .optional()
-                .default(1)
-                .describe("Number of copies to print (default: 1)"),
+              ...printOptionsSchema,
+              ...holdSchema,
+              ...coverPageSchema,
               options: z
                 .string()
                 .optional()
@@ -94,23 +643,37 @@ export function registerPrintTools(server: McpServer) {
                 .describe(
                   "Skip page count confirmation check (bypasses MCP_PRINTER_CONFIRM_IF_OVER_PAGES threshold)"
                 ),
+              ...largeJobSchema,
+              ...forceSchema,
+              ...fileTypeSchema,
               ...renderingParametersSchema,
+              ...watermarkSchema,
+              ...bookletSchema,
+              ...rawSchema,
+              ...dryRunSchema,
             })
           )
           .describe("Array of files to print (use single-element array for one file)"),
       },
     },
-    async ({ files }) => {
+    async ({ files }, { signal, sessionId }) => {
       // Check for large batch size
       const batchSizeWarning = checkBatchSizeLimit(files.length, "files")
       if (batchSizeWarning) {
         return batchSizeWarning
       }
+      // A batch the rate limit can't take whole is refused before anything prints (dry runs
+      // don't count)
+      try {
+        checkJobTokens(sessionId, files.filter((file) => !file.dry_run).length)
+      } catch (error) {
+        return formatErrorResult(error)
+      }
 
       // Process each file in the batch
       const results: PrintResult[] = []
       for (const fileSpec of files) {
-        const result = await handlePrint(fileSpec)
+        const result = await handlePrint(fileSpec, signal, sessionId)
         results.push(result)
       }
 
@@ -118,6 +681,895 @@ export function registerPrintTools(server: McpServer) {
     }
   )
 
+  // Register print_files tool
+  server.registerTool(
+    "print_files",
+    {
+      title: "Print Files as One Job",
+      description:
+        "Print several related files as a single print job, in order, so they come out together instead of interleaved with other jobs. Each file is rendered as print_file would render it (and must come out as a PDF), then the PDFs are merged with a separator page naming each file after the first. Returns the queued job ID with each file's page count and the total pages.",
+      inputSchema: {
+        file_paths: z
+          .array(z.string())
+          .min(1)
+          .describe("Full paths of the files to print, in the order they should come out"),
+        printer: z
+          .string()
+          .optional()
+          .describe(
+            "Printer name (use list_printers to see available printers), or an ipp:// or ipps:// printer URI to print directly over IPP. Optional if default printer is set."
+          ),
+        title: z
+          .string()
+          .optional()
+          .describe(
+            "Job title shown in the print queue (default: the first file's name and how many follow)"
+          ),
+        on_error: z
+          .enum(MERGE_ERROR_MODES)
+          .optional()
+          .describe(
+            "What to do when a file can't be rendered: 'fail' (default) prints nothing, 'skip' leaves it out and reports a warning"
+          ),
+        ...printOptionsSchema,
+        ...holdSchema,
+        ...coverPageSchema,
+        options: z
+          .string()
+          .optional()
+          .describe("Additional CUPS options (e.g., 'landscape', 'sides=two-sided-long-edge')"),
+        skip_confirmation: z
+          .boolean()
+          .optional()
+          .describe(
+            "Skip page count confirmation check (bypasses MCP_PRINTER_CONFIRM_IF_OVER_PAGES threshold)"
+          ),
+        ...largeJobSchema,
+        ...forceSchema,
+        ...renderingParametersSchema,
+        ...watermarkSchema,
+        ...dryRunSchema,
+      },
+    },
+    async (spec, { signal, sessionId }) => {
+      // Check for large batch size
+      const batchSizeWarning = checkBatchSizeLimit(spec.file_paths.length, "files")
+      if (batchSizeWarning) {
+        return batchSizeWarning
+      }
+
+      return await handleMergedPrint(spec, signal, sessionId)
+    }
+  )
+
+  // Register print_text tool
+  server.registerTool(
+    "print_text",
+    {
+      title: "Print Text",
+      description:
+        "Print text content directly without a file on disk. Plain text is streamed to the printer, so no temp file is written. Use format 'markdown' to render markdown (tables, code blocks, diagrams) to PDF first, or 'html' to render HTML with scripts and network access disabled. Returns the queued job ID for get_job_status.",
+      inputSchema: {
+        content: z.string().describe("Text content to print"),
+        title: z.string().optional().describe("Job title shown in the print queue"),
+        printer: z
+          .string()
+          .optional()
+          .describe(
+            "Printer name (use list_printers to see available printers), or an ipp:// or ipps:// printer URI to print directly over IPP. Optional if default printer is set."
+          ),
+        options: z
+          .string()
+          .optional()
+          .describe("Additional CUPS options (e.g., 'landscape', 'sides=two-sided-long-edge')"),
+        ...printOptionsSchema,
+        ...holdSchema,
+        ...coverPageSchema,
+        format: z
+          .enum(CONTENT_FORMATS)
+          .optional()
+          .describe(
+            "Content format: 'text' (default) prints as-is, 'markdown' and 'html' render to PDF"
+          ),
+        render: z
+          .boolean()
+          .optional()
+          .describe(
+            "Render markdown or HTML content to PDF before printing (default: true). Set false to print the raw source."
+          ),
+        ...pageLayoutSchema,
+        ...headerFooterSchema,
+        ...htmlOptionsSchema,
+        ...largeJobSchema,
+        ...forceSchema,
+        ...watermarkSchema,
+        ...bookletSchema,
+        ...rawSchema,
+        ...dryRunSchema,
+      },
+    },
+    async (
+      {
+        content,
+        title,
+        printer,
+        options,
+        format,
+        render,
+        orientation,
+        margins,
+        header,
+        footer,
+        allow_remote_resources,
+        watermark,
+        watermark_opacity,
+        watermark_font_size,
+        booklet,
+        raw,
+        confirm_large_job,
+        force,
+        dry_run,
+        thumbnail,
+        ...jobOptions
+      },
+      { signal, sessionId }
+    ) => {
+      if (content.trim().length === 0) {
+        return formatErrorResult(
+          "Cannot print empty content. Provide the text to print in the content parameter."
+        )
+      }
+
+      // Label and receipt printer commands are sent raw unless a format says otherwise
+      const rendered = format !== undefined && format !== "text" && render !== false
+      const laidOut = (orientation !== undefined && orientation !== "auto") || margins !== undefined
+      const language = format === undefined ? rawLanguage(Buffer.from(content, "utf-8")) : undefined
+      const sendRaw = raw === true || language !== undefined
+
+      // Reject bad options and disallowed printers before rendering or shelling out to lp
+      let targetPrinter: string | undefined
+      let stamp: WatermarkOptions | undefined
+      try {
+        validatePrintOptions(jobOptions)
+        if (booklet) {
+          validateBookletOptions(jobOptions)
+          jobOptions.duplex = "short-edge"
+        }
+        stamp = watermarkOptions(watermark, watermark_opacity, watermark_font_size)
+        if (stamp) {
+          validateWatermark(stamp)
+        }
+        if (sendRaw && (stamp || booklet || rendered || laidOut)) {
+          const change = stamp
+            ? "a watermark"
+            : booklet
+              ? "booklet"
+              : rendered
+                ? `format "${format}"`
+                : "an orientation or margins"
+          throw new PrinterError(
+            "UNSUPPORTED_FORMAT",
+            `Cannot print ${language ?? "raw"} content with ${change}: it is sent to the printer untouched.`,
+            {
+              suggestion:
+                "Leave out watermark, booklet, format, orientation, and margins to send it raw.",
+            }
+          )
+        }
+        targetPrinter = await resolvePrinter(printer, signal)
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      const jobTitle = title || DEFAULT_TEXT_TITLE
+
+      // A watermark, generated cover page, booklet, orientation, or margins need a PDF, so plain
+      // text is rendered too (raw content never is)
+      const covered = coverPageMode(targetPrinter, jobOptions.cover_page) === "generate"
+      if (!sendRaw && (rendered || stamp || covered || booklet || laidOut)) {
+        let render
+        try {
+          render = await renderContentToPdf(content, rendered ? format : "text", {
+            title: jobTitle,
+            header,
+            footer,
+            media: jobOptions.media,
+            orientation,
+            margins,
+            allowRemoteResources: allow_remote_resources,
+            watermark: stamp,
+            booklet,
+            signal,
+          })
+        } catch (error) {
+          return formatErrorResult(error)
+        }
+        const { renderedPdf, renderType, bookletSheets } = render
+        const label = !rendered ? "Text" : format === "html" ? "HTML" : "Markdown"
+        const bookletInfo = bookletDetails(bookletSheets)
+        let queued = false
+        try {
+          if (dry_run) {
+            const preview = await savePreview(renderedPdf, jobTitle, thumbnail)
+            return dryRunResult(preview, [
+              `Title: ${jobTitle}`,
+              `Rendered: ${renderType}`,
+              ...bookletInfo,
+            ])
+          }
+
+          const { printerName, job, duplicate, warnings } = await queuePrintJob({
+            filePath: renderedPdf,
+            printer: targetPrinter,
+            jobOptions,
+            options,
+            title: jobTitle,
+            tool: "print_text",
+            confirmLargeJob: confirm_large_job,
+            cleanup: () => cleanupRenderedPdf(renderedPdf),
+            // Renders differ from one to the next, so the content is what repeats
+            identity: {
+              content,
+              settings: {
+                format,
+                orientation,
+                margins,
+                header,
+                footer,
+                allow_remote_resources,
+                stamp,
+                booklet,
+              },
+            },
+            force,
+            session: sessionId,
+            signal,
+          })
+          queued = true
+          return {
+            content: [
+              {
+                type: "text",
+                text:
+                  `✓ ${label} queued for printer: ${printerName}\n` +
+                  `  Job ID: ${job.id}\n` +
+                  `  Title: ${jobTitle}\n` +
+                  `  Rendered: ${renderType}` +
+                  bookletInfo.map((line) => `\n  ${line}`).join("") +
+                  duplicateLine(duplicate) +
+                  warningLines(warnings),
+              },
+            ],
+          }
+        } catch (error) {
+          return formatErrorResult(error)
+        } finally {
+          if (!queued) {
+            cleanupRenderedPdf(renderedPdf)
+          }
+        }
+      }
+
+      if (dry_run) {
+        return dryRunResult(await saveTextPreview(content, jobTitle), [`Title: ${jobTitle}`])
+      }
+
+      // Streamed text isn't rendered, so its pages are estimated for the page limits
+      let queued
+      try {
+        queued = await queuePrintJob({
+          content,
+          pages:
+            !sendRaw && pagesAreLimited()
+              ? estimateTextPages(content, { media: jobOptions.media })
+              : undefined,
+          printer: targetPrinter,
+          jobOptions,
+          options,
+          title: jobTitle,
+          tool: "print_text",
+          raw: sendRaw,
+          confirmLargeJob: confirm_large_job,
+          force,
+          session: sessionId,
+          signal,
+        })
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      return {
+        content: [
+          {
+            type: "text",
+            text:
+              `✓ ${sendRaw ? "Raw content" : "Text"} queued for printer: ${queued.printerName}\n` +
+              `  Job ID: ${queued.job.id}\n` +
+              `  Title: ${jobTitle}` +
+              (sendRaw ? `\n  Sent raw${language ? `: ${language}` : ""}` : "") +
+              duplicateLine(queued.duplicate) +
+              warningLines(queued.warnings),
+          },
+        ],
+      }
+    }
+  )
+
+  // Register print_raw tool
+  server.registerTool(
+    "print_raw",
+    {
+      title: "Print Raw Data",
+      description:
+        "Send bytes to a printer untouched, bypassing rendering and the printing system's filters: ZPL for label printers, ESC/POS for receipt printers, or other data in the printer's own language. The data is base64-encoded, so binary commands arrive intact. Only allowed for printers in MCP_PRINTER_RAW_ALLOWED_PRINTERS. Returns the queued job ID for get_job_status.",
+      inputSchema: {
+        data: z.string().describe("The bytes to send, base64-encoded"),
+        title: z.string().optional().describe("Job title shown in the print queue"),
+        printer: z
+          .string()
+          .optional()
+          .describe(
+            "Printer name, or an ipp:// or ipps:// printer URI. Must be in MCP_PRINTER_RAW_ALLOWED_PRINTERS; optional if the default printer is."
+          ),
+        copies: printOptionsSchema.copies,
+        ...holdSchema,
+        ...forceSchema,
+      },
+    },
+    async ({ data, title, printer, copies, hold, hold_until, force }, { signal, sessionId }) => {
+      let bytes: Buffer
+      try {
+        bytes = decodeRawData(data)
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      const jobTitle = title || DEFAULT_RAW_TITLE
+      let queued
+      try {
+        queued = await queuePrintJob({
+          content: bytes,
+          printer: await resolvePrinter(printer, signal),
+          jobOptions: { copies, hold, hold_until },
+          title: jobTitle,
+          tool: "print_raw",
+          raw: true,
+          force,
+          session: sessionId,
+          signal,
+        })
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      const language = rawLanguage(bytes)
+      return {
+        content: [
+          {
+            type: "text",
+            text:
+              `✓ Raw data queued for printer: ${queued.printerName}\n` +
+              `  Job ID: ${queued.job.id}\n` +
+              `  Title: ${jobTitle}\n` +
+              `  Bytes: ${bytes.length}${language ? ` (${language})` : ""}` +
+              duplicateLine(queued.duplicate) +
+              warningLines(queued.warnings),
+          },
+        ],
+      }
+    }
+  )
+
+  // Register print_url tool
+  server.registerTool(
+    "print_url",
+    {
+      title: "Print URL",
+      description:
+        "Fetch a document from an http(s) URL and print it. PDFs, plain text, and TIFF images are printed as-is; HTML, markdown, and PNG/JPEG/GIF/WebP images are rendered to PDF first (images scaled to fit the page). Localhost and private network addresses are refused unless MCP_PRINTER_ALLOW_PRIVATE_URLS is set. Returns the queued job ID, detected type, and bytes fetched.",
+      inputSchema: {
+        url: z.string().describe("http or https URL of the document to print"),
+        printer: z
+          .string()
+          .optional()
+          .describe(
+            "Printer name (use list_printers to see available printers), or an ipp:// or ipps:// printer URI to print directly over IPP. Optional if default printer is set."
+          ),
+        options: z
+          .string()
+          .optional()
+          .describe("Additional CUPS options (e.g., 'landscape', 'sides=two-sided-long-edge')"),
+        ...printOptionsSchema,
+        ...holdSchema,
+        ...coverPageSchema,
+        ...imageOptionsSchema,
+        ...pageLayoutSchema,
+        ...largeJobSchema,
+        ...forceSchema,
+        ...watermarkSchema,
+        ...dryRunSchema,
+      },
+    },
+    async (
+      {
+        url,
+        printer,
+        options,
+        dry_run,
+        thumbnail,
+        fit,
+        orientation,
+        margin_mm,
+        margins,
+        watermark,
+        watermark_opacity,
+        watermark_font_size,
+        confirm_large_job,
+        force,
+        ...jobOptions
+      },
+      { signal, sessionId }
+    ) => {
+      // Reject bad options and disallowed printers before fetching anything
+      let targetPrinter: string | undefined
+      let stamp: WatermarkOptions | undefined
+      try {
+        validatePrintOptions(jobOptions)
+        stamp = watermarkOptions(watermark, watermark_opacity, watermark_font_size)
+        if (stamp) {
+          validateWatermark(stamp)
+        }
+        targetPrinter = await resolvePrinter(printer, signal)
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      let prepared
+      try {
+        prepared = await prepareUrlForPrinting(
+          url,
+          { fit, orientation, marginMm: margin_mm, media: jobOptions.media, margins },
+          signal
+        )
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      if (stamp) {
+        try {
+          prepared = await watermarkPreparedUrl(prepared, stamp, signal)
+        } catch (error) {
+          cleanupRenderedPdf(prepared.tempFile)
+          return formatErrorResult(error)
+        }
+      }
+
+      const type = prepared.contentType
+        ? `${prepared.type} (${prepared.contentType})`
+        : prepared.type
+
+      let queued = false
+      try {
+        if (dry_run) {
+          const name = new URL(prepared.url).pathname.split("/").pop() || "document"
+          const preview = await savePreview(prepared.filePath, name, thumbnail)
+          return dryRunResult(preview, [
+            `URL: ${prepared.url}`,
+            `Type: ${type}`,
+            `Fetched: ${prepared.bytes} bytes`,
+            ...(prepared.renderType ? [`Rendered: ${prepared.renderType}`] : []),
+          ])
+        }
+
+        const { printerName, job, duplicate, warnings } = await queuePrintJob({
+          filePath: prepared.filePath,
+          printer: targetPrinter,
+          jobOptions: { ...jobOptions, orientation: prepared.orientation },
+          options,
+          title: prepared.url,
+          source: prepared.url,
+          tool: "print_url",
+          confirmLargeJob: confirm_large_job,
+          cleanup: () => cleanupRenderedPdf(prepared.tempFile),
+          // Renders differ from one to the next, so a rendered page is recognized by its URL
+          identity:
+            prepared.renderType || stamp
+              ? {
+                  content: prepared.url,
+                  settings: { fit, orientation, margin_mm, margins, stamp },
+                }
+              : undefined,
+          force,
+          session: sessionId,
+          signal,
+        })
+        queued = true
+        return {
+          content: [
+            {
+              type: "text",
+              text:
+                `✓ URL queued for printer: ${printerName}\n` +
+                `  Job ID: ${job.id}\n` +
+                `  URL: ${prepared.url}\n` +
+                `  Type: ${type}\n` +
+                `  Fetched: ${prepared.bytes} bytes` +
+                (prepared.renderType ? `\n  Rendered: ${prepared.renderType}` : "") +
+                duplicateLine(duplicate) +
+                warningLines(warnings),
+            },
+          ],
+        }
+      } catch (error) {
+        return formatErrorResult(error)
+      } finally {
+        if (!queued) {
+          cleanupRenderedPdf(prepared.tempFile)
+        }
+      }
+    }
+  )
+
+  // Register print_data tool
+  server.registerTool(
+    "print_data",
+    {
+      title: "Print Data",
+      description:
+        "Print a document sent as base64-encoded bytes, for documents the client has but the server can't read from a path (e.g., a PDF the user attached to the chat). The data is checked against mime_type and MCP_PRINTER_MAX_UPLOAD_BYTES, then printed like print_file: PDFs, PostScript, and TIFF as they are; markdown, HTML, text, CSV, PNG/JPEG/GIF/WebP images, and office documents rendered to PDF. Returns the queued job ID, detected type, and bytes decoded.",
+      inputSchema: {
+        data: z.string().describe("The document's bytes, base64-encoded"),
+        mime_type: z
+          .string()
+          .describe(
+            `Media type of the document, optionally with a charset for text (e.g., 'text/plain; charset=windows-1252'). One of: ${UPLOAD_MEDIA_TYPES.join(", ")}`
+          ),
+        filename: z
+          .string()
+          .describe("Name of the document (e.g., 'invoice.pdf'), used as the job title"),
+        printer: z
+          .string()
+          .optional()
+          .describe(
+            "Printer name (use list_printers to see available printers), or an ipp:// or ipps:// printer URI to print directly over IPP. Optional if default printer is set."
+          ),
+        options: z
+          .string()
+          .optional()
+          .describe("Additional CUPS options (e.g., 'landscape', 'sides=two-sided-long-edge')"),
+        allow_type_mismatch: z
+          .boolean()
+          .optional()
+          .describe(
+            "Print the data even if its content contradicts mime_type (default: false), as detected from the content and with a warning in the result. Without it, mismatched data is refused."
+          ),
+        encoding: fileTypeSchema.encoding,
+        ...printOptionsSchema,
+        ...holdSchema,
+        ...coverPageSchema,
+        ...imageOptionsSchema,
+        ...pageLayoutSchema,
+        ...headerFooterSchema,
+        ...htmlOptionsSchema,
+        ...largeJobSchema,
+        ...forceSchema,
+        ...watermarkSchema,
+        ...bookletSchema,
+        ...dryRunSchema,
+      },
+    },
+    async (
+      {
+        data,
+        mime_type,
+        filename,
+        printer,
+        options,
+        allow_type_mismatch,
+        encoding,
+        fit,
+        orientation,
+        margin_mm,
+        margins,
+        header,
+        footer,
+        allow_remote_resources,
+        watermark,
+        watermark_opacity,
+        watermark_font_size,
+        booklet,
+        confirm_large_job,
+        force,
+        dry_run,
+        thumbnail,
+        ...jobOptions
+      },
+      { signal, sessionId }
+    ) => {
+      // Reject bad options and disallowed printers before decoding anything
+      let targetPrinter: string | undefined
+      let stamp: WatermarkOptions | undefined
+      let upload: StoredUpload
+      try {
+        validatePrintOptions(jobOptions)
+        if (booklet) {
+          validateBookletOptions(jobOptions)
+          jobOptions.duplex = "short-edge"
+        }
+        stamp = watermarkOptions(watermark, watermark_opacity, watermark_font_size)
+        if (stamp) {
+          validateWatermark(stamp)
+        }
+        if (margins) {
+          validatePageMargins(margins)
+        }
+        targetPrinter = await resolvePrinter(printer, signal)
+        upload = storeUpload(data, mime_type, filename, { allowTypeMismatch: allow_type_mismatch })
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+
+      let renderedPdf: string | null = null
+      let queued = false
+      try {
+        const prepared = await prepareFileForPrinting({
+          filePath: upload.filePath,
+          imageFit: fit,
+          orientation,
+          imageMarginMm: margin_mm,
+          margins,
+          header,
+          footer,
+          encoding: encoding ?? upload.encoding,
+          allowRemoteResources: allow_remote_resources,
+          watermark: stamp,
+          media: jobOptions.media,
+          booklet,
+          uploaded: true,
+          signal,
+        })
+        renderedPdf = prepared.renderedPdf
+        const details = [
+          `File: ${filename}`,
+          `Type: ${prepared.fileType}`,
+          `Decoded: ${upload.bytes} bytes`,
+          ...(prepared.renderType ? [`Rendered: ${prepared.renderType}`] : []),
+          ...bookletDetails(prepared.bookletSheets),
+        ]
+
+        if (dry_run) {
+          const preview = await savePreview(
+            prepared.actualFilePath,
+            basename(upload.filePath),
+            thumbnail
+          )
+          return dryRunResult(preview, [
+            ...details,
+            ...upload.warnings.map((warning) => `Warning: ${warning}`),
+          ])
+        }
+
+        const { printerName, job, duplicate, warnings } = await queuePrintJob({
+          filePath: prepared.actualFilePath,
+          printer: targetPrinter,
+          jobOptions: { ...jobOptions, orientation: prepared.orientation },
+          options,
+          title: filename,
+          source: filename,
+          tool: "print_data",
+          raw: prepared.raw,
+          confirmLargeJob: confirm_large_job,
+          cleanup: () => {
+            cleanupRenderedPdf(renderedPdf)
+            cleanupRenderedPdf(upload.filePath)
+          },
+          // Renders differ from one to the next, so the data as sent is what repeats
+          identity: {
+            files: [upload.filePath],
+            settings: {
+              mime_type: upload.mediaType,
+              encoding,
+              fit,
+              orientation,
+              margin_mm,
+              margins,
+              header,
+              footer,
+              allow_remote_resources,
+              stamp,
+              booklet,
+            },
+          },
+          force,
+          session: sessionId,
+          signal,
+        })
+        queued = true
+        return {
+          content: [
+            {
+              type: "text",
+              text:
+                `✓ Data queued for printer: ${printerName}\n` +
+                `  Job ID: ${job.id}` +
+                details.map((line) => `\n  ${line}`).join("") +
+                duplicateLine(duplicate) +
+                warningLines([...upload.warnings, ...warnings]),
+            },
+          ],
+        }
+      } catch (error) {
+        return formatErrorResult(error)
+      } finally {
+        if (!queued) {
+          cleanupRenderedPdf(renderedPdf)
+          cleanupRenderedPdf(upload.filePath)
+        }
+      }
+    }
+  )
+
+  // Register estimate_job tool
+  server.registerTool(
+    "estimate_job",
+    {
+      title: "Estimate Print Job",
+      description:
+        "Estimate a print job without printing it: takes a file (as print_file) or text content (as print_text), renders it as it would be printed, and returns the pages, the sheets of paper (with duplex, number-up, and copies), and the cost from the configured prices per black-and-white and color side. Color pages are found from the PDF's content. Nothing is sent to the printer.",
+      inputSchema: {
+        file_path: z
+          .string()
+          .optional()
+          .describe("Full path to the file to estimate (give this or content)"),
+        content: z
+          .string()
+          .optional()
+          .describe("Text content to estimate (give this or file_path)"),
+        title: z
+          .string()
+          .optional()
+          .describe("Title of the content, shown in header and footer templates"),
+        ...printOptionsSchema,
+        options: z
+          .string()
+          .optional()
+          .describe(
+            "Additional CUPS options for duplex, N-up, and color detection (e.g., 'sides=two-sided-long-edge', 'number-up=2', 'print-color-mode=monochrome')"
+          ),
+        ...bookletSchema,
+        ...fileTypeSchema,
+        format: z
+          .enum(FILE_FORMATS)
+          .optional()
+          .describe(
+            "For a file, print it as 'pdf', 'image', 'markdown', 'html', 'code', or 'text' (as in print_file). For content, 'markdown' and 'html' render it to PDF and 'text' (default) lays it out as plain text."
+          ),
+        ...renderingParametersSchema,
+      },
+    },
+    async (
+      {
+        file_path,
+        content,
+        title,
+        options,
+        format,
+        encoding,
+        line_numbers,
+        color_scheme,
+        font_size,
+        line_spacing,
+        force_markdown_render,
+        force_code_render,
+        wrap,
+        tab_width,
+        fit,
+        orientation,
+        margin_mm,
+        margins,
+        header,
+        footer,
+        allow_remote_resources,
+        booklet,
+        ...jobOptions
+      },
+      { signal }
+    ) => {
+      if ((file_path === undefined) === (content === undefined)) {
+        return formatErrorResult(
+          "Give either file_path (a file to estimate) or content (text to estimate), not both."
+        )
+      }
+
+      let renderedPdf: string | null = null
+      try {
+        validatePrintOptions(jobOptions)
+        if (booklet) {
+          validateBookletOptions(jobOptions)
+          jobOptions.duplex = "short-edge"
+        }
+
+        if (content !== undefined) {
+          if (
+            format !== undefined &&
+            format !== "text" &&
+            format !== "markdown" &&
+            format !== "html"
+          ) {
+            throw new Error(
+              `Invalid format "${format}" for content: use 'text', 'markdown', or 'html'.`
+            )
+          }
+          const jobTitle = title || DEFAULT_TEXT_TITLE
+          const rendered = await renderContentToPdf(content, format ?? "text", {
+            title: jobTitle,
+            header,
+            footer,
+            media: jobOptions.media,
+            orientation,
+            margins,
+            allowRemoteResources: allow_remote_resources,
+            booklet,
+            signal,
+          })
+          renderedPdf = rendered.renderedPdf
+          const estimate = await estimatePdf(renderedPdf, jobOptions, options)
+          return estimateResult(estimate, [
+            `Title: ${jobTitle}`,
+            `Rendered: ${rendered.renderType}`,
+            ...bookletDetails(rendered.bookletSheets),
+          ])
+        }
+
+        const filePath = file_path ?? ""
+        const prepared = await prepareFileForPrinting({
+          filePath,
+          lineNumbers: line_numbers,
+          colorScheme: color_scheme,
+          fontSize: font_size,
+          lineSpacing: line_spacing,
+          forceMarkdownRender: force_markdown_render,
+          forceCodeRender: force_code_render,
+          imageFit: fit,
+          orientation,
+          imageMarginMm: margin_mm,
+          margins,
+          header,
+          footer,
+          format,
+          encoding,
+          textWrap: wrap,
+          tabWidth: tab_width,
+          allowRemoteResources: allow_remote_resources,
+          media: jobOptions.media,
+          booklet,
+          signal,
+        })
+        renderedPdf = prepared.renderedPdf
+        if ((await sniffFile(prepared.actualFilePath)).type !== "pdf") {
+          throw new PrinterError(
+            "UNSUPPORTED_FORMAT",
+            `Cannot estimate ${filePath}: it is printed as ${prepared.fileType}, not as a PDF, so its pages can't be counted.`,
+            {
+              suggestion:
+                "Estimates cover PDFs and files rendered to PDF (markdown, HTML, code, text, and images). Plain text files are counted only when MCP_PRINTER_AUTO_RENDER_TEXT renders them.",
+            }
+          )
+        }
+        const estimate = await estimatePdf(prepared.actualFilePath, jobOptions, options)
+        return estimateResult(estimate, [
+          `File: ${filePath}`,
+          ...(prepared.renderType ? [`Rendered: ${prepared.renderType}`] : []),
+          ...bookletDetails(prepared.bookletSheets),
+        ])
+      } catch (error) {
+        return formatErrorResult(error)
+      } finally {
+        cleanupRenderedPdf(renderedPdf)
+      }
+    }
+  )
+
   // Register get_page_meta tool
   server.registerTool(
     "get_page_meta",
@@ -134,15 +1586,16 @@ export function registerPrintTools(server: McpServer) {
                 .string()
                 .optional()
                 .describe(
-                  "Additional CUPS options for duplex detection (e.g., 'sides=two-sided-long-edge')"
+                  "Additional CUPS options for duplex and N-up detection (e.g., 'sides=two-sided-long-edge', 'number-up=2')"
                 ),
+              ...fileTypeSchema,
               ...renderingParametersSchema,
             })
           )
           .describe("Array of files to get metadata for (use single-element array for one file)"),
       },
     },
-    async ({ files }) => {
+    async ({ files }, { signal }) => {
       // Check for large batch size
       const batchSizeWarning = checkBatchSizeLimit(files.length, "files")
       if (batchSizeWarning) {
@@ -152,7 +1605,7 @@ export function registerPrintTools(server: McpServer) {
       // Process each file in the batch
       const results: PageMetaResult[] = []
       for (const fileSpec of files) {
-        const result = await handlePageMeta(fileSpec)
+        const result = await handlePageMeta(fileSpec, signal)
         results.push(result)
       }
 
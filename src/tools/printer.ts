@@ -1,23 +1,39 @@
 /**
  * @fileoverview Printer management tools registration.
- * Registers printer query, management, and job cancellation tools with the MCP server.
+ * Registers printer query, management, job release, and job cancellation tools with the MCP
+ * server.
  */
 
 import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
 import { z } from "zod"
 import { execCommand } from "../utils.js"
 import { config } from "../config.js"
-import { execa } from "execa"
+import { getBackend } from "../backend.js"
+import { cupsEnv } from "../cups.js"
+import { getPrintJobStatus } from "../job-queue.js"
+import { filterAllowedPrinters, isPrinterAllowed, validatePrinter } from "../printer-access.js"
+import { discoverPrinters } from "../discovery.js"
+import { getPrinterInfo } from "../printer-info.js"
+import { operationSignal } from "../timeouts.js"
 import {
   handleCancel,
+  handleRelease,
   formatCancelResults,
+  formatErrorResult,
   checkBatchSizeLimit,
   type CancelJobResult,
 } from "./batch-helpers.js"
 
+/** How long discover_printers browses when no duration is given, in seconds. */
+const DEFAULT_DISCOVERY_SECONDS = 3
+
+/** Longest browse discover_printers allows, in seconds. */
+const MAX_DISCOVERY_SECONDS = 30
+
 /**
  * Registers printer management tools with the MCP server.
- * Includes read-only tools (list, query, get) and optionally write tools (cancel, set default)
+ * Includes read-only tools (list, query, get), release_job for held jobs, and optionally write
+ * tools (cancel, set default)
  * based on the MCP_PRINTER_ENABLE_MANAGEMENT configuration.
  *
  * @param server - The McpServer instance to register tools with
@@ -34,17 +50,81 @@ export function registerPrinterTools(server: McpServer) {
     },
     () => {
       const configData = {
+        MCP_PRINTER_CONFIG_FILE: config.configFile || "(not set)",
+        MCP_PRINTER_BACKEND: config.backend,
+        MCP_PRINTER_PDF_OUTPUT_DIR: config.pdfOutputDir,
+        MCP_PRINTER_PDF_JOB_DELAY_SECONDS: String(config.pdfJobDelaySeconds),
+        MCP_PRINTER_CUPS_SERVER: config.cupsServer || "(local)",
+        MCP_PRINTER_CUPS_ENCRYPTION: config.cupsEncryption,
         MCP_PRINTER_DEFAULT_PRINTER: config.defaultPrinter || "(not set)",
+        MCP_PRINTER_ALLOWED_PRINTERS:
+          config.allowedPrinters.length > 0 ? config.allowedPrinters.join(", ") : "(all printers)",
+        MCP_PRINTER_RAW_ALLOWED_PRINTERS:
+          config.rawAllowedPrinters.length > 0 ? config.rawAllowedPrinters.join(", ") : "(none)",
+        MCP_PRINTER_IPP_INSECURE_TLS: config.ippInsecureTls ? "true" : "false",
+        MCP_PRINTER_ALLOW_PRIVATE_URLS: config.allowPrivateUrls ? "true" : "false",
+        MCP_PRINTER_URL_TIMEOUT_SECONDS: String(config.urlTimeoutSeconds),
+        MCP_PRINTER_URL_MAX_SIZE_MB: String(config.urlMaxSizeMb),
+        MCP_PRINTER_MAX_UPLOAD_BYTES:
+          config.maxUploadBytes > 0 ? String(config.maxUploadBytes) : "0 (no limit)",
+        MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS:
+          config.submitTimeoutSeconds > 0 ? String(config.submitTimeoutSeconds) : "0 (none)",
+        MCP_PRINTER_STATUS_TIMEOUT_SECONDS:
+          config.statusTimeoutSeconds > 0 ? String(config.statusTimeoutSeconds) : "0 (none)",
+        MCP_PRINTER_CONVERT_TIMEOUT_SECONDS:
+          config.convertTimeoutSeconds > 0 ? String(config.convertTimeoutSeconds) : "0 (none)",
+        MCP_PRINTER_SHUTDOWN_TIMEOUT_SECONDS: String(config.shutdownTimeoutSeconds),
+        MCP_PRINTER_MAX_RETRIES: config.maxRetries > 0 ? String(config.maxRetries) : "0 (off)",
+        MCP_PRINTER_RETRY_DELAY_SECONDS: String(config.retryDelaySeconds),
+        MCP_PRINTER_LOG_LEVEL: config.logLevel,
+        MCP_PRINTER_LOG_FILE: config.logFile || "(stderr)",
+        MCP_PRINTER_MONITOR_INTERVAL_SECONDS:
+          config.monitorIntervalSeconds > 0 ? String(config.monitorIntervalSeconds) : "0 (off)",
+        MCP_PRINTER_PREVIEW_DIR: config.previewDir,
+        MCP_PRINTER_TEMP_DIR: config.tempDir,
+        MCP_PRINTER_TEMP_MAX_AGE_HOURS:
+          config.tempMaxAgeHours > 0 ? String(config.tempMaxAgeHours) : "0 (never swept)",
+        MCP_PRINTER_TEMP_MAX_MB: config.tempMaxMb > 0 ? String(config.tempMaxMb) : "0 (no limit)",
+        MCP_PRINTER_HISTORY_FILE: config.historyFile,
+        MCP_PRINTER_AUTH_TOKEN: config.authToken ? "(set)" : "(not set)",
+        MCP_PRINTER_SESSION_TTL_MINUTES:
+          config.sessionTtlMinutes > 0 ? String(config.sessionTtlMinutes) : "0 (never)",
+        MCP_PRINTER_IMAGE_MARGIN_MM: String(config.imageMarginMm),
+        MCP_PRINTER_HEADER: config.header || "(none)",
+        MCP_PRINTER_FOOTER: config.footer || "(none)",
         MCP_PRINTER_AUTO_DUPLEX: config.autoDuplex ? "true" : "false",
         MCP_PRINTER_DEFAULT_OPTIONS:
           config.defaultOptions.length > 0 ? config.defaultOptions.join(" ") : "(not set)",
         MCP_PRINTER_CHROME_PATH: config.chromePath || "(auto-detected)",
+        MCP_PRINTER_LIBREOFFICE_PATH: config.libreofficePath || "(not set)",
         MCP_PRINTER_AUTO_RENDER_MARKDOWN: config.autoRenderMarkdown ? "true" : "false",
         MCP_PRINTER_AUTO_RENDER_CODE: config.autoRenderCode ? "true" : "false",
+        MCP_PRINTER_AUTO_RENDER_TEXT: config.autoRenderText ? "true" : "false",
         MCP_PRINTER_ENABLE_MANAGEMENT: config.enableManagement ? "true" : "false",
         MCP_PRINTER_ENABLE_PROMPTS: config.enablePrompts ? "true" : "false",
         MCP_PRINTER_CONFIRM_IF_OVER_PAGES:
           config.confirmIfOverPages > 0 ? String(config.confirmIfOverPages) : "0 (disabled)",
+        MCP_PRINTER_MAX_PAGES_PER_JOB:
+          config.maxPagesPerJob > 0 ? String(config.maxPagesPerJob) : "0 (no limit)",
+        MCP_PRINTER_ABSOLUTE_MAX_PAGES:
+          config.absoluteMaxPages > 0 ? String(config.absoluteMaxPages) : "0 (no ceiling)",
+        MCP_PRINTER_MAX_JOBS_PER_HOUR:
+          config.maxJobsPerHour > 0 ? String(config.maxJobsPerHour) : "0 (no quota)",
+        MCP_PRINTER_MAX_PAGES_PER_DAY:
+          config.maxPagesPerDay > 0 ? String(config.maxPagesPerDay) : "0 (no quota)",
+        MCP_PRINTER_QUOTA_SCOPE: config.quotaScope,
+        MCP_PRINTER_MAX_JOBS_PER_MINUTE:
+          config.maxJobsPerMinute > 0 ? String(config.maxJobsPerMinute) : "0 (no limit)",
+        MCP_PRINTER_DEDUPE_WINDOW_SECONDS:
+          config.dedupeWindowSeconds > 0 ? String(config.dedupeWindowSeconds) : "0 (off)",
+        MCP_PRINTER_COST_PER_PAGE: String(config.costPerPage),
+        MCP_PRINTER_COST_PER_COLOR_PAGE: String(config.costPerColorPage),
+        MCP_PRINTER_COST_CURRENCY: config.costCurrency || "(none)",
+        MCP_PRINTER_COVER_PAGE: String(config.coverPage),
+        MCP_PRINTER_COVER_PAGE_MODE: config.coverPageMode,
+        MCP_PRINTER_JOB_OWNER: config.jobOwner || "(user running the server)",
+        MCP_PRINTER_MAX_CONCURRENT_RENDERS:
+          config.maxConcurrentRenders > 0 ? String(config.maxConcurrentRenders) : "0 (unlimited)",
         MCP_PRINTER_ALLOWED_PATHS: config.allowedPaths.join(":"),
         MCP_PRINTER_DENIED_PATHS: config.deniedPaths.join(":"),
         MCP_PRINTER_CODE_EXCLUDE_EXTENSIONS:
@@ -78,22 +158,86 @@ export function registerPrinterTools(server: McpServer) {
     {
       title: "List Printers",
       description:
-        "List all available printers on the system with their status. Returns printer names, states, and whether they're accepting jobs.",
+        "List all available printers on the system with their status. Returns JSON with each printer's name, description, state, whether it's accepting jobs, and whether it's the system default. Only printers on the configured allow-list are shown.",
       inputSchema: {},
     },
-    async () => {
-      const output = await execCommand("lpstat", ["-p", "-d"])
+    async (_args, { signal }) => {
+      const printers = filterAllowedPrinters(await getBackend().listPrinters(signal))
+      return {
+        content: [
+          {
+            type: "text",
+            text: JSON.stringify({ printers }, null, 2),
+          },
+        ],
+      }
+    }
+  )
+
+  // discover_printers - Browse the local network for IPP printers via mDNS
+  server.registerTool(
+    "discover_printers",
+    {
+      title: "Discover Printers",
+      description:
+        "Browse the local network for IPP printers (AirPrint / IPP Everywhere) via mDNS, including printers not set up in CUPS. Returns JSON with each printer's name, host, port, ipp:// or ipps:// URI, and TXT-record hints (accepted formats, color, duplex). Pass the URI as the printer argument of the print tools to print without adding a CUPS queue. If multicast isn't available (e.g., in a container), returns an empty list with a warning.",
+      inputSchema: {
+        duration_seconds: z
+          .number()
+          .min(1)
+          .max(MAX_DISCOVERY_SECONDS)
+          .optional()
+          .default(DEFAULT_DISCOVERY_SECONDS)
+          .describe(
+            `How long to listen for printers, in seconds (default: ${DEFAULT_DISCOVERY_SECONDS})`
+          ),
+      },
+    },
+    async ({ duration_seconds }) => {
+      const result = await discoverPrinters({ durationMs: duration_seconds * 1000 })
+      const printers = result.printers.filter((printer) => isPrinterAllowed(printer.uri))
       return {
         content: [
           {
             type: "text",
-            text: output || "No printers found",
+            text: JSON.stringify({ ...result, printers }, null, 2),
           },
         ],
       }
     }
   )
 
+  // get_printer_info - Describe a printer's capabilities
+  server.registerTool(
+    "get_printer_info",
+    {
+      title: "Get Printer Info",
+      description:
+        "Get a printer's capabilities before choosing print options. Returns JSON with duplex support and modes, color vs monochrome (to choose color_mode), quality levels, supported media sizes, resolutions, and current state reasons (e.g., out of paper, toner low). Works for CUPS printers and ipp:// / ipps:// printer URIs.",
+      inputSchema: {
+        printer: z
+          .string()
+          .describe("Printer name (use list_printers to see available printers) or IPP printer URI"),
+      },
+    },
+    async ({ printer }, { signal }) => {
+      try {
+        validatePrinter(printer)
+        const info = await getPrinterInfo(printer, signal)
+        return {
+          content: [
+            {
+              type: "text",
+              text: JSON.stringify(info, null, 2),
+            },
+          ],
+        }
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+    }
+  )
+
   // get_print_queue - Check print queue
   server.registerTool(
     "get_print_queue",
@@ -108,13 +252,13 @@ export function registerPrinterTools(server: McpServer) {
           .describe("Printer name to check queue for (optional, checks all if not specified)"),
       },
     },
-    async ({ printer }) => {
+    async ({ printer }, { signal }) => {
       const lpqArgs: string[] = []
       if (printer) {
         lpqArgs.push("-P", printer)
       }
 
-      const output = await execCommand("lpq", lpqArgs)
+      const output = await execCommand("lpq", lpqArgs, operationSignal("status", signal), cupsEnv())
       return {
         content: [
           {
@@ -126,6 +270,56 @@ export function registerPrinterTools(server: McpServer) {
     }
   )
 
+  // get_job_status - Check the state of a submitted job
+  server.registerTool(
+    "get_job_status",
+    {
+      title: "Get Job Status",
+      description:
+        "Get the status of a print job by the job ID returned from print_file, print_text, or print_url. Returns JSON with the job state: queued (waiting for the printer's earlier jobs, with its position, or waiting to retry after the printer couldn't be reached, with attempts and next_retry_at), pending, held (submitted with hold or hold_until; release it with release_job), processing, completed, canceled, aborted, or not-found (never submitted or already purged from CUPS history). Includes warnings when the printer rejected the job's color_mode or quality and it was submitted without them.",
+      inputSchema: {
+        job_id: z
+          .string()
+          .describe(
+            "Job ID returned by a print tool (e.g., 'queue#7', 'HP_LaserJet-123', '123', or 'ipp://printer.local/ipp/print#42')"
+          ),
+      },
+    },
+    async ({ job_id }, { signal }) => {
+      try {
+        const status = await getPrintJobStatus(job_id, signal)
+        return {
+          content: [
+            {
+              type: "text",
+              text: JSON.stringify(status, null, 2),
+            },
+          ],
+        }
+      } catch (error) {
+        return formatErrorResult(error)
+      }
+    }
+  )
+
+  // release_job - Print a job submitted with hold or hold_until
+  server.registerTool(
+    "release_job",
+    {
+      title: "Release Held Job",
+      description:
+        "Release a job that was printed with hold or hold_until, so it prints now. Releasing a job that isn't held (already released, printing, or finished) does nothing and says so.",
+      inputSchema: {
+        job_id: z
+          .string()
+          .describe(
+            "Job ID returned by a print tool (e.g., 'queue#7', 'HP_LaserJet-123', or 'ipp://printer.local/ipp/print#42')"
+          ),
+      },
+    },
+    async ({ job_id }, { signal }) => handleRelease(job_id, signal)
+  )
+
   // get_default_printer - Get the default printer
   server.registerTool(
     "get_default_printer",
@@ -134,8 +328,13 @@ export function registerPrinterTools(server: McpServer) {
       description: "Get the name of the default printer",
       inputSchema: {},
     },
-    async () => {
-      const output = await execCommand("lpstat", ["-d"])
+    async (_args, { signal }) => {
+      const output = await execCommand(
+        "lpstat",
+        ["-d"],
+        operationSignal("status", signal),
+        cupsEnv()
+      )
       const defaultPrinter = output.split(": ")[1] || "No default printer set"
       return {
         content: [
@@ -162,7 +361,9 @@ export function registerPrinterTools(server: McpServer) {
                 job_id: z
                   .string()
                   .optional()
-                  .describe("Job ID to cancel (get from get_print_queue)"),
+                  .describe(
+                    "Job ID to cancel (from a print tool, e.g. 'queue#7', or from get_print_queue)"
+                  ),
                 printer: z
                   .string()
                   .optional()
@@ -177,7 +378,7 @@ export function registerPrinterTools(server: McpServer) {
             .describe("Array of job cancellations (use single-element array for one job)"),
         },
       },
-      async ({ jobs }) => {
+      async ({ jobs }, { signal }) => {
         // Check for large batch size
         const batchSizeWarning = checkBatchSizeLimit(jobs.length, "jobs")
         if (batchSizeWarning) {
@@ -187,7 +388,7 @@ export function registerPrinterTools(server: McpServer) {
         // Process each cancellation in the batch
         const results: CancelJobResult[] = []
         for (const jobSpec of jobs) {
-          const result = await handleCancel(jobSpec)
+          const result = await handleCancel(jobSpec, signal)
           results.push(result)
         }
 
@@ -207,8 +408,19 @@ export function registerPrinterTools(server: McpServer) {
           printer: z.string().describe("Printer name to set as default"),
         },
       },
-      async ({ printer }) => {
-        await execa("lpoptions", ["-d", printer])
+      async ({ printer }, { signal }) => {
+        try {
+          validatePrinter(printer)
+        } catch (error) {
+          return formatErrorResult(error)
+        }
+
+        await execCommand(
+          "lpoptions",
+          ["-d", printer],
+          operationSignal("status", signal),
+          cupsEnv()
+        )
         return {
           content: [
             {
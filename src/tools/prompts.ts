@@ -1,10 +1,138 @@
 /**
  * @fileoverview MCP prompts implementation.
- * Provides reusable prompt templates for common workflows.
+ * Provides reusable prompt templates for common workflows. The `printer` argument of each
+ * prompt completes from the live printer list, and print-document's `media` argument from the
+ * sizes that printer supports, so clients can offer them as the user types.
  */
 
 import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { completable } from "@modelcontextprotocol/sdk/server/completable.js"
+import type { GetPromptResult } from "@modelcontextprotocol/sdk/types.js"
 import { z } from "zod"
+import { completeMediaSizes, completePrinterNames } from "../completions.js"
+
+/**
+ * Splits a prompt's file list (comma- or newline-separated) into paths.
+ *
+ * @param value - The file_paths argument
+ * @returns The paths, trimmed, without empty entries
+ */
+export function parseFileList(value: string): string[] {
+  return value
+    .split(/[,\n]/)
+    .map((path) => path.trim())
+    .filter((path) => path.length > 0)
+}
+
+/**
+ * The optional printer argument shared by the prompts, with completion.
+ */
+function printerArgument() {
+  return completable(
+    z
+      .string()
+      .optional()
+      .describe(
+        "Printer name (use list_printers to see available printers; default printer if omitted)"
+      ),
+    completePrinterNames
+  )
+}
+
+/**
+ * Wraps prompt text as a single user message.
+ */
+function userMessage(text: string): GetPromptResult {
+  return { messages: [{ role: "user", content: { type: "text", text } }] }
+}
+
+/**
+ * Builds the print-code-review prompt: the files rendered with syntax highlighting and line
+ * numbers, two pages per side, on both sides of the paper.
+ *
+ * @param args - The file_paths (comma- or newline-separated) and printer arguments
+ * @returns The prompt messages
+ */
+export function buildPrintCodeReviewPrompt(args: {
+  file_paths: string
+  printer?: string
+}): GetPromptResult {
+  const files = parseFileList(args.file_paths)
+  const printer = args.printer?.trim()
+  const printerField = printer ? `, printer: ${JSON.stringify(printer)}` : ""
+  const entries = files
+    .map(
+      (path) =>
+        `  { file_path: ${JSON.stringify(path)}${printerField}, force_code_render: true, ` +
+        `line_numbers: true, number_up: 2, duplex: "short-edge" }`
+    )
+    .join(",\n")
+
+  return userMessage(`Print source files for a code review on paper.
+
+FILES:
+${files.map((path) => `- ${path}`).join("\n")}
+PRINTER: ${printer || "the default printer"}
+
+INSTRUCTIONS:
+
+1. Print all the files in one print_file call, with syntax highlighting and line numbers,
+   2 pages per side (number_up: 2), on both sides of the paper. 2-up pages are laid out on
+   landscape sides, so flip on the short edge (duplex: "short-edge"):
+
+print_file({ files: [
+${entries}
+] })
+
+2. Report what was printed:
+   - The files and the job IDs
+   - How many sheets each file took
+   - Any files that couldn't be printed, and why
+
+Execute this now.`)
+}
+
+/**
+ * Builds the print-document prompt: the document's size is estimated with estimate_job and
+ * confirmed with the user before it's printed.
+ *
+ * @param args - The path, printer, and media arguments
+ * @returns The prompt messages
+ */
+export function buildPrintDocumentPrompt(args: {
+  path: string
+  printer?: string
+  media?: string
+}): GetPromptResult {
+  const path = args.path.trim()
+  const printer = args.printer?.trim()
+  const media = args.media?.trim()
+  const printerField = printer ? `, printer: ${JSON.stringify(printer)}` : ""
+  const mediaField = media ? `, media: ${JSON.stringify(media)}` : ""
+
+  return userMessage(`Print a document, after checking how big it is.
+
+DOCUMENT: ${path}
+PRINTER: ${printer || "the default printer"}${media ? `\nMEDIA: ${media}` : ""}
+
+INSTRUCTIONS:
+
+1. Estimate the job first, without printing anything:
+
+estimate_job({ file_path: ${JSON.stringify(path)}${mediaField} })
+
+2. Tell me the page count, the sheets of paper, and the cost (if one is reported), and ask
+   me to confirm. Don't print until I say yes.
+
+3. Once I confirm, print it:
+
+print_file({ files: [{ file_path: ${JSON.stringify(path)}${printerField}${mediaField} }] })
+
+   If print_file refuses the job for its page count, I've already confirmed it: print it
+   again with confirm_large_job: true.
+
+4. Report the job ID, or why the document couldn't be printed.`)
+}
 
 /**
  * Registers prompts with the MCP server.
@@ -65,4 +193,48 @@ Execute this now for: ${context}`,
       }
     }
   )
+  // print-code-review - Print source files 2-up duplex with syntax highlighting
+  server.registerPrompt(
+    "print-code-review",
+    {
+      title: "Print for Code Review",
+      description:
+        "Print source files with syntax highlighting and line numbers, 2 pages per side, two-sided",
+      argsSchema: {
+        file_paths: z
+          .string()
+          .refine((value) => parseFileList(value).length > 0, {
+            message: "file_paths must name at least one file",
+          })
+          .describe("Files to print, separated by commas or newlines"),
+        printer: printerArgument(),
+      },
+    },
+    buildPrintCodeReviewPrompt
+  )
+
+  // print-document - Estimate a document's size and confirm before printing it
+  server.registerPrompt(
+    "print-document",
+    {
+      title: "Print Document",
+      description: "Print a document after confirming its page count with estimate_job",
+      argsSchema: {
+        path: z
+          .string()
+          .trim()
+          .min(1, "path must name a file")
+          .describe("Full path to the document to print"),
+        printer: printerArgument(),
+        media: completable(
+          z
+            .string()
+            .optional()
+            .describe("Paper size (A4, Letter, or Legal; the printer's default if omitted)"),
+          (value, context) => completeMediaSizes(value, context?.arguments?.printer)
+        ),
+      },
+    },
+    buildPrintDocumentPrompt
+  )
 }
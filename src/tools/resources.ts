@@ -0,0 +1,169 @@
+/**
+ * @fileoverview Printer resource registration.
+ * Registers printer://printers (the allowed printers, like list_printers) and the
+ * printer://printers/{name} template (one printer's capabilities and status, like
+ * get_printer_info) with the MCP server. Printer names are percent-encoded in resource URIs, so
+ * names with spaces (common on Windows) round-trip; printerResourceUri builds them, so status
+ * notifications can name the resource of a printer that changed.
+ */
+
+import { McpServer, ResourceTemplate } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { McpError } from "@modelcontextprotocol/sdk/types.js"
+import { getBackend } from "../backend.js"
+import { completePrinterNames } from "../completions.js"
+import type { PrinterSummary } from "../cups.js"
+import { filterAllowedPrinters } from "../printer-access.js"
+import { getPrinterInfo, type PrinterCapabilities } from "../printer-info.js"
+import { logger } from "../logger.js"
+
+/** URI of the printer list resource. */
+export const PRINTERS_URI = "printer://printers"
+
+/** URI template of a printer's resource. */
+export const PRINTER_URI_TEMPLATE = `${PRINTERS_URI}/{name}`
+
+/** JSON-RPC error code MCP uses for a resource that doesn't exist. */
+export const RESOURCE_NOT_FOUND = -32002
+
+/**
+ * A printer in the printer list resource.
+ */
+export interface PrinterResourceEntry extends PrinterSummary {
+  /** URI of the printer's own resource */
+  uri: string
+}
+
+/**
+ * Builds the resource URI of a printer.
+ *
+ * @param name - Printer name
+ * @returns "printer://printers/<name>", with the name percent-encoded
+ */
+export function printerResourceUri(name: string): string {
+  return `${PRINTERS_URI}/${encodeURIComponent(name)}`
+}
+
+/**
+ * Builds the error for a printer resource that doesn't exist.
+ */
+function printerNotFound(name: string): McpError {
+  return new McpError(RESOURCE_NOT_FOUND, `Resource not found: no printer named "${name}"`, {
+    uri: printerResourceUri(name),
+  })
+}
+
+/**
+ * Reads the printer list resource: the allowed printers, with the URI of each one's resource.
+ *
+ * @param signal - The MCP request's signal
+ * @returns The printers, in the same form as list_printers
+ * @throws {Error} If the printers can't be listed
+ */
+export async function readPrintersResource(
+  signal?: AbortSignal
+): Promise<{ printers: PrinterResourceEntry[] }> {
+  const printers = filterAllowedPrinters(await getBackend().listPrinters(signal))
+  return {
+    printers: printers.map((printer) => ({ ...printer, uri: printerResourceUri(printer.name) })),
+  }
+}
+
+/**
+ * Reads a printer's resource. Printers that don't exist and printers that aren't on the
+ * allow-list (which the printer list hides) are both reported as not found.
+ *
+ * @param encodedName - The {name} of the resource URI, still percent-encoded
+ * @param signal - The MCP request's signal
+ * @returns The printer's capabilities and status, in the same form as get_printer_info
+ * @throws {McpError} RESOURCE_NOT_FOUND if there is no such printer
+ * @throws {Error} If the printer can't be queried
+ */
+export async function readPrinterResource(
+  encodedName: string | string[],
+  signal?: AbortSignal
+): Promise<PrinterCapabilities> {
+  const raw = Array.isArray(encodedName) ? encodedName.join(",") : encodedName
+  let name: string
+  try {
+    name = decodeURIComponent(raw)
+  } catch {
+    throw printerNotFound(raw)
+  }
+
+  const printers = filterAllowedPrinters(await getBackend().listPrinters(signal))
+  const printer = printers.find((p) => p.name.toLowerCase() === name.toLowerCase())
+  if (!printer) {
+    throw printerNotFound(name)
+  }
+  return getPrinterInfo(printer.name, signal)
+}
+
+/**
+ * Registers printer resources with the MCP server.
+ *
+ * @param server - The McpServer instance to register with
+ */
+export function registerPrinterResources(server: McpServer) {
+  // printer://printers - Same list as list_printers, for clients that browse resources
+  server.registerResource(
+    "printers",
+    PRINTERS_URI,
+    {
+      title: "Printers",
+      description:
+        "The printers the tools may use, with their state and the URI of each printer's resource",
+      mimeType: "application/json",
+    },
+    async (uri, { signal }) => ({
+      contents: [
+        {
+          uri: uri.href,
+          mimeType: "application/json",
+          text: JSON.stringify(await readPrintersResource(signal), null, 2),
+        },
+      ],
+    })
+  )
+
+  // printer://printers/{name} - Same document as get_printer_info, one resource per printer;
+  // {name} completes from the allowed printers
+  server.registerResource(
+    "printer",
+    new ResourceTemplate(PRINTER_URI_TEMPLATE, {
+      list: async ({ signal }) => {
+        let printers: PrinterSummary[]
+        try {
+          printers = filterAllowedPrinters(await getBackend().listPrinters(signal))
+        } catch (error) {
+          // The other resources are still listed when the printing system is down
+          logger.warn("failed to list printer resources", { error })
+          return { resources: [] }
+        }
+        return {
+          resources: printers.map((printer) => ({
+            uri: printerResourceUri(printer.name),
+            name: printer.name,
+            title: printer.description || printer.name,
+            mimeType: "application/json",
+          })),
+        }
+      },
+      complete: { name: completePrinterNames },
+    }),
+    {
+      title: "Printer",
+      description:
+        "A printer's capabilities (duplex, color, quality, media, resolutions) and current state reasons",
+      mimeType: "application/json",
+    },
+    async (uri, { name }, { signal }) => ({
+      contents: [
+        {
+          uri: uri.href,
+          mimeType: "application/json",
+          text: JSON.stringify(await readPrinterResource(name, signal), null, 2),
+        },
+      ],
+    })
+  )
+}
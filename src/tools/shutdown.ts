@@ -0,0 +1,29 @@
+/**
+ * @fileoverview Tool calls and the graceful shutdown.
+ * Every tool call counts as work in flight, which the shutdown waits for (see ../shutdown.ts);
+ * once the server is shutting down new calls are refused, and calls still running when it
+ * stops waiting are canceled through their signal.
+ */
+
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { trackToolCall } from "../shutdown.js"
+import type { RegisterTool } from "./logging.js"
+
+/**
+ * Tracks every tool registered with the server after this is called.
+ *
+ * @param server - The McpServer instance, before any tool is registered
+ */
+export function trackToolCalls(server: McpServer) {
+  const registerTool = server.registerTool.bind(server) as unknown as RegisterTool
+  const trackedRegisterTool: RegisterTool = (name, toolConfig, callback) =>
+    registerTool(name, toolConfig, (...params) => {
+      // The request's extra (with its signal) always comes last
+      const extra = params[params.length - 1] as { signal?: AbortSignal }
+      return trackToolCall(
+        async (signal) => callback(...params.slice(0, -1), { ...extra, signal }),
+        extra.signal
+      )
+    })
+  server.registerTool = trackedRegisterTool as unknown as McpServer["registerTool"]
+}
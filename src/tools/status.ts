@@ -0,0 +1,34 @@
+/**
+ * @fileoverview Server status tool registration.
+ * Registers the server_status tool, which reports the state of the server itself rather than
+ * of a printer.
+ */
+
+import { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { getServerStatus } from "../server-status.js"
+
+/**
+ * Registers server status tools with the MCP server.
+ *
+ * @param server - The McpServer instance to register with
+ */
+export function registerStatusTools(server: McpServer) {
+  // server_status - Health of the server: backend, queue, temp directory, and limits
+  server.registerTool(
+    "server_status",
+    {
+      title: "Server Status",
+      description:
+        "Get the MCP Printer server's status, to work out why printing fails. Returns JSON with the server version; the printing backend (cups, windows, or pdf), whether it answers (with the error if not), and its printer count; the default printer and where it comes from; the jobs still queued, being submitted, or waiting to retry; the temp directory's path, usage, and size limit; and the limits on jobs (pages, quotas, rate limit, upload size; 0 means none). An unreachable backend is reported in the result, not as an error. Use this when jobs fail for no clear reason or renders are refused with TEMP_SPACE_EXCEEDED.",
+      inputSchema: {},
+    },
+    async (_args, { signal }) => ({
+      content: [
+        {
+          type: "text",
+          text: JSON.stringify(await getServerStatus(signal), null, 2),
+        },
+      ],
+    })
+  )
+}
@@ -0,0 +1,163 @@
+/**
+ * @fileoverview Documents sent as data for print_data.
+ * A client may hold a document's bytes (a PDF the user attached to the chat) without a path to
+ * it on the server. print_data takes them base64-encoded, with their media type and filename:
+ * they are decoded, checked against MCP_PRINTER_MAX_UPLOAD_BYTES, and checked against the media
+ * type, so a mislabeled upload is refused instead of printed as something else. The document is
+ * then written to a temp directory in the work directory (see temp-files.ts), from where it goes
+ * through the same rendering as print_file. The server wrote the file, so the allowed paths
+ * don't apply to it.
+ */
+
+import { rmSync, writeFileSync } from "fs"
+import { extname, join } from "path"
+import { config } from "./config.js"
+import { PrinterError } from "./errors.js"
+import { logger } from "./logger.js"
+import { decodeRawData } from "./raw.js"
+import {
+  SNIFF_BYTES,
+  extensionType,
+  matchesExtension,
+  sniffContent,
+} from "./renderers/file-type.js"
+import { createTempDir } from "./temp-files.js"
+
+/** Media types print_data accepts, with the extension the document is saved under. */
+const UPLOAD_EXTENSIONS: Record<string, string> = {
+  "application/pdf": "pdf",
+  "image/png": "png",
+  "image/jpeg": "jpg",
+  "image/gif": "gif",
+  "image/webp": "webp",
+  "image/tiff": "tiff",
+  "application/postscript": "ps",
+  "text/plain": "txt",
+  "text/markdown": "md",
+  "text/html": "html",
+  "text/csv": "csv",
+  "application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+  "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": "xlsx",
+  "application/vnd.openxmlformats-officedocument.presentationml.presentation": "pptx",
+  "application/vnd.oasis.opendocument.text": "odt",
+  "application/vnd.oasis.opendocument.spreadsheet": "ods",
+  "application/vnd.oasis.opendocument.presentation": "odp",
+}
+
+/** Media types print_data accepts. */
+export const UPLOAD_MEDIA_TYPES = Object.keys(UPLOAD_EXTENSIONS)
+
+/** Longest name (before the extension) an upload is saved under. */
+const MAX_STEM_LENGTH = 100
+
+/**
+ * A document from print_data, saved to print.
+ */
+export interface StoredUpload {
+  /** The saved document, in a temp directory of its own (remove it with cleanupRenderedPdf) */
+  filePath: string
+  /** Media type, without parameters (e.g., "text/plain") */
+  mediaType: string
+  /** Character encoding from the media type's charset parameter */
+  encoding?: string
+  /** Bytes decoded */
+  bytes: number
+  /** How the content contradicts the media type, when allow_type_mismatch let it through */
+  warnings: string[]
+}
+
+/**
+ * Builds a safe name to save an upload under: the filename's stem, without path separators or
+ * leading dots, and the extension of its media type.
+ */
+function uploadFilename(filename: string, extension: string): string {
+  const name = filename.split(/[\\/]/).pop() ?? ""
+  const stem = name
+    .slice(0, name.length - extname(name).length)
+    .replace(/[^\w.-]+/g, "_")
+    .replace(/^\.+/, "")
+    .slice(0, MAX_STEM_LENGTH)
+  return `${stem || "document"}.${extension}`
+}
+
+/**
+ * Formats a byte count in megabytes for error messages (e.g., "20 MB").
+ */
+function formatMb(bytes: number): string {
+  return `${+(bytes / (1024 * 1024)).toFixed(2)} MB`
+}
+
+/**
+ * Decodes a document sent to print_data, checks it, and saves it to print.
+ *
+ * @param data - The document's bytes, base64-encoded
+ * @param mimeType - Its media type, perhaps with a charset (e.g., "text/plain; charset=utf-8")
+ * @param filename - Its name, for the job title and the saved file
+ * @param options - allowTypeMismatch prints content that contradicts the media type, with a
+ *   warning, as detected from the content
+ * @returns The saved document and what was decoded
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the media type isn't supported, or the content
+ *   doesn't match it (without allowTypeMismatch)
+ * @throws {PrinterError} TEMP_SPACE_EXCEEDED if the temp directory is over its size limit
+ * @throws {Error} If the data is empty, isn't valid base64, or is over
+ *   MCP_PRINTER_MAX_UPLOAD_BYTES once decoded
+ */
+export function storeUpload(
+  data: string,
+  mimeType: string,
+  filename: string,
+  options: { allowTypeMismatch?: boolean } = {}
+): StoredUpload {
+  const [type, ...parameters] = mimeType.split(";")
+  const mediaType = type.trim().toLowerCase()
+  const extension = UPLOAD_EXTENSIONS[mediaType]
+  if (!extension) {
+    throw new PrinterError(
+      "UNSUPPORTED_FORMAT",
+      `Cannot print ${filename}: unsupported mime_type "${mediaType}". ` +
+        `Supported: ${UPLOAD_MEDIA_TYPES.join(", ")}.`,
+      {
+        suggestion:
+          "Send the document with the mime_type of its content, or convert it to PDF first.",
+      }
+    )
+  }
+  const encoding = parameters
+    .map((parameter) => parameter.match(/^\s*charset=["']?([\w.:-]+)/i)?.[1])
+    .find((charset) => charset !== undefined)
+
+  const bytes = decodeRawData(data)
+  if (config.maxUploadBytes > 0 && bytes.length > config.maxUploadBytes) {
+    throw new Error(
+      `Cannot print ${filename}: it is ${formatMb(bytes.length)} once decoded, over the ` +
+        `${formatMb(config.maxUploadBytes)} limit (MCP_PRINTER_MAX_UPLOAD_BYTES).`
+    )
+  }
+
+  // Text types all imply text content, so markdown, HTML, and CSV match plain text
+  const warnings: string[] = []
+  const sniffed = sniffContent(bytes.subarray(0, SNIFF_BYTES))
+  const implied = extensionType(`document.${extension}`)
+  if (implied && (sniffed.type === "unknown" || !matchesExtension(sniffed.type, implied))) {
+    const detected = sniffed.type === "unknown" ? "binary data of unknown type" : sniffed.type
+    const mismatch = `was sent as ${mediaType}, but its content looks like ${detected}`
+    if (!options.allowTypeMismatch) {
+      throw new PrinterError("UNSUPPORTED_FORMAT", `Cannot print ${filename}: it ${mismatch}.`, {
+        suggestion:
+          "Check that the data is the document the user meant, and send it with the mime_type of its content. To print it as its content is detected anyway, set allow_type_mismatch.",
+      })
+    }
+    logger.warn("upload type mismatch", { filename, mime_type: mediaType, detected: sniffed.type })
+    warnings.push(`${filename} ${mismatch}; it is printed as detected from its content`)
+  }
+
+  const tempDir = createTempDir("data-")
+  const filePath = join(tempDir, uploadFilename(filename, extension))
+  try {
+    writeFileSync(filePath, bytes)
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return { filePath, mediaType, ...(encoding ? { encoding } : {}), bytes: bytes.length, warnings }
+}
@@ -0,0 +1,443 @@
+/**
+ * @fileoverview Fetching remote documents for print_url.
+ * Downloads http(s) URLs with a timeout and size cap, refusing localhost and private network
+ * addresses (including after redirects) unless MCP_PRINTER_ALLOW_PRIVATE_URLS is set, so a
+ * prompt-injected page can't make the server reach internal services. Fetched documents are
+ * written to a temp file and, for HTML and markdown, rendered to PDF (in the orientation and
+ * margins asked for; a fetched PDF is turned by the printer instead).
+ */
+
+import http from "http"
+import https from "https"
+import { lookup, type LookupAddress } from "dns"
+import { BlockList, isIP, type LookupFunction } from "net"
+import { rmSync, writeFileSync } from "fs"
+import { basename, extname, join } from "path"
+import { config } from "./config.js"
+import { abortError } from "./timeouts.js"
+import { convertHtmlToPdf } from "./utils.js"
+import { renderMarkdownContentToPdf } from "./renderers/markdown.js"
+import {
+  SANDBOX_CHROME_FLAGS,
+  withContentSecurityPolicy,
+  withPageLayout,
+} from "./renderers/html.js"
+import { renderImageDataToPdf, type RenderImageOptions } from "./renderers/image.js"
+import {
+  validatePageMargins,
+  type PageMargins,
+  type PageOrientation,
+} from "./renderers/page-layout.js"
+import { createTempDir } from "./temp-files.js"
+
+/** Maximum number of redirects followed for a single URL. */
+const MAX_REDIRECTS = 5
+
+/** HTTP status codes that carry a Location to follow. */
+const REDIRECT_STATUSES = [301, 302, 303, 307, 308]
+
+/**
+ * Address ranges print_url refuses by default: loopback, private, link-local, CGNAT,
+ * multicast, and other special-purpose ranges.
+ */
+const PRIVATE_ADDRESSES = new BlockList()
+for (const [network, prefix] of [
+  ["0.0.0.0", 8],
+  ["10.0.0.0", 8],
+  ["100.64.0.0", 10],
+  ["127.0.0.0", 8],
+  ["169.254.0.0", 16],
+  ["172.16.0.0", 12],
+  ["192.0.0.0", 24],
+  ["192.168.0.0", 16],
+  ["198.18.0.0", 15],
+  ["224.0.0.0", 4],
+  ["240.0.0.0", 4],
+] as const) {
+  PRIVATE_ADDRESSES.addSubnet(network, prefix, "ipv4")
+}
+for (const [network, prefix] of [
+  ["::", 128],
+  ["::1", 128],
+  ["fc00::", 7],
+  ["fe80::", 10],
+  ["ff00::", 8],
+] as const) {
+  PRIVATE_ADDRESSES.addSubnet(network, prefix, "ipv6")
+}
+
+/**
+ * Kinds of documents print_url can print.
+ */
+export type UrlDocumentType = "pdf" | "text" | "image" | "html" | "markdown"
+
+/** Image types print_url accepts, with the file extension to save them under. */
+const IMAGE_EXTENSIONS: Record<string, string> = {
+  "image/png": "png",
+  "image/jpeg": "jpg",
+  "image/gif": "gif",
+  "image/webp": "webp",
+  "image/tiff": "tiff",
+}
+
+/** Image types laid out on a PDF page by the image renderer (TIFF is sent as-is). */
+const RENDERED_IMAGE_TYPES = ["image/png", "image/jpeg", "image/gif", "image/webp"]
+
+/**
+ * A document downloaded by fetchUrl.
+ */
+export interface FetchedUrl {
+  /** Response body */
+  data: Buffer
+  /** Content-Type header (media type and parameters), or "" if none was sent */
+  contentType: string
+  /** URL the document was finally fetched from, after redirects */
+  url: string
+}
+
+/**
+ * Checks whether an IP address is loopback, private, link-local, or otherwise not public.
+ *
+ * @param address - IPv4 or IPv6 address
+ * @returns True if print_url should refuse the address by default
+ */
+export function isPrivateAddress(address: string): boolean {
+  const family = isIP(address)
+  if (family === 4) {
+    return PRIVATE_ADDRESSES.check(address, "ipv4")
+  }
+  if (family === 6) {
+    // IPv4-mapped addresses (::ffff:127.0.0.1) are checked as IPv4
+    const mapped = address.match(/^::ffff:(\d+\.\d+\.\d+\.\d+)$/i)
+    return mapped
+      ? PRIVATE_ADDRESSES.check(mapped[1], "ipv4")
+      : PRIVATE_ADDRESSES.check(address, "ipv6")
+  }
+  return false
+}
+
+/**
+ * Builds the error for a refused private address.
+ */
+function privateAddressError(url: URL, address: string): Error {
+  return new Error(
+    `Refusing to fetch ${url.href}: ${url.hostname} resolves to the private address ${address}. ` +
+      `Set MCP_PRINTER_ALLOW_PRIVATE_URLS=true to allow printing from local and private networks.`
+  )
+}
+
+/**
+ * Checks a URL before requesting it: only http and https are allowed, and IP literals must be
+ * public unless private URLs are allowed.
+ *
+ * @param url - URL to check
+ * @throws {Error} If the URL may not be fetched
+ */
+export function validateFetchUrl(url: URL): void {
+  if (url.protocol !== "http:" && url.protocol !== "https:") {
+    throw new Error(`Refusing to fetch ${url.href}: only http and https URLs can be printed`)
+  }
+
+  const host = url.hostname.replace(/^\[|\]$/g, "")
+  if (!config.allowPrivateUrls && isPrivateAddress(host)) {
+    throw privateAddressError(url, host)
+  }
+}
+
+/**
+ * Wraps dns.lookup so every address a hostname resolves to is checked before connecting.
+ * Checking at connect time (rather than resolving separately first) prevents DNS rebinding.
+ */
+function safeLookup(url: URL): LookupFunction {
+  return (hostname, options, callback) => {
+    lookup(hostname, { ...options, all: true }, (error, addresses: LookupAddress[]) => {
+      if (error) {
+        callback(error, "", 0)
+        return
+      }
+      const refused = config.allowPrivateUrls
+        ? undefined
+        : addresses.find((entry) => isPrivateAddress(entry.address))
+      if (refused) {
+        callback(privateAddressError(url, refused.address), "", 0)
+        return
+      }
+      if (options.all) {
+        ;(callback as unknown as (err: null, addresses: LookupAddress[]) => void)(null, addresses)
+      } else {
+        callback(null, addresses[0].address, addresses[0].family)
+      }
+    })
+  }
+}
+
+/**
+ * Performs a single GET request, without following redirects.
+ */
+function get(
+  url: URL,
+  maxBytes: number,
+  deadline: number,
+  signal?: AbortSignal
+): Promise<{ status: number; location?: string; contentType: string; data: Buffer }> {
+  const transport = url.protocol === "https:" ? https : http
+
+  return new Promise((resolve, reject) => {
+    const fail = (error: Error) => {
+      reject(error)
+      request.destroy()
+    }
+
+    const request = transport.get(url, { lookup: safeLookup(url), signal }, (response) => {
+      const status = response.statusCode ?? 0
+      const contentType = response.headers["content-type"] ?? ""
+
+      if (REDIRECT_STATUSES.includes(status)) {
+        response.resume()
+        resolve({ status, location: response.headers.location, contentType, data: Buffer.alloc(0) })
+        return
+      }
+
+      const declaredLength = parseInt(response.headers["content-length"] ?? "", 10)
+      if (declaredLength > maxBytes) {
+        fail(sizeError(url, maxBytes))
+        return
+      }
+
+      const chunks: Buffer[] = []
+      let received = 0
+      response.on("data", (chunk: Buffer) => {
+        received += chunk.length
+        if (received > maxBytes) {
+          fail(sizeError(url, maxBytes))
+          return
+        }
+        chunks.push(chunk)
+      })
+      response.on("end", () => resolve({ status, contentType, data: Buffer.concat(chunks) }))
+      response.on("error", reject)
+    })
+
+    const timer = setTimeout(
+      () => fail(new Error(`Timed out fetching ${url.href}`)),
+      Math.max(deadline - Date.now(), 0)
+    )
+    request.on("close", () => clearTimeout(timer))
+    request.on("error", (error) =>
+      reject(signal?.aborted ? abortError(`Fetching ${url.href}`, signal) : error)
+    )
+  })
+}
+
+/**
+ * Builds the error for a document over the size cap.
+ */
+function sizeError(url: URL, maxBytes: number): Error {
+  const limitMb = +(maxBytes / (1024 * 1024)).toFixed(2)
+  return new Error(
+    `Refusing to fetch ${url.href}: document is larger than ${limitMb} MB ` +
+      `(MCP_PRINTER_URL_MAX_SIZE_MB)`
+  )
+}
+
+/**
+ * Downloads a URL, following redirects and re-checking each hop.
+ *
+ * @param url - http or https URL
+ * @param options - Timeout (default MCP_PRINTER_URL_TIMEOUT_SECONDS), size cap in bytes
+ *   (default MCP_PRINTER_URL_MAX_SIZE_MB), and the MCP request's signal
+ * @returns The downloaded document
+ * @throws {Error} If the URL is refused, the request fails, times out, or is canceled, or the
+ *   document is too large
+ */
+export async function fetchUrl(
+  url: string,
+  options: { timeoutMs?: number; maxBytes?: number; signal?: AbortSignal } = {}
+): Promise<FetchedUrl> {
+  const {
+    timeoutMs = config.urlTimeoutSeconds * 1000,
+    maxBytes = config.urlMaxSizeMb * 1024 * 1024,
+    signal,
+  } = options
+  const deadline = Date.now() + timeoutMs
+
+  let current: URL
+  try {
+    current = new URL(url)
+  } catch {
+    throw new Error(`Invalid URL "${url}"`)
+  }
+
+  for (let redirects = 0; ; redirects++) {
+    validateFetchUrl(current)
+    const response = await get(current, maxBytes, deadline, signal)
+
+    if (REDIRECT_STATUSES.includes(response.status)) {
+      if (!response.location) {
+        throw new Error(`${current.href} redirected without a Location header`)
+      }
+      if (redirects >= MAX_REDIRECTS) {
+        throw new Error(`Too many redirects fetching ${url}`)
+      }
+      current = new URL(response.location, current)
+      continue
+    }
+
+    if (response.status < 200 || response.status >= 300) {
+      throw new Error(`Failed to fetch ${current.href}: HTTP ${response.status}`)
+    }
+
+    return { data: response.data, contentType: response.contentType, url: current.href }
+  }
+}
+
+/**
+ * Determines how a fetched document should be printed from its Content-Type.
+ * Markdown served as text/plain (e.g., raw files on code hosts) is recognized by the URL's
+ * extension, and PDFs served as application/octet-stream by their signature.
+ *
+ * @param fetched - Downloaded document
+ * @returns The document type
+ * @throws {Error} If the content type can't be printed
+ */
+export function detectUrlDocumentType(fetched: FetchedUrl): UrlDocumentType {
+  const mediaType = fetched.contentType.split(";")[0].trim().toLowerCase()
+  const extension = extname(new URL(fetched.url).pathname).slice(1).toLowerCase()
+
+  if (mediaType === "application/pdf") return "pdf"
+  if (mediaType in IMAGE_EXTENSIONS) return "image"
+  if (mediaType === "text/html" || mediaType === "application/xhtml+xml") return "html"
+  if (mediaType === "text/markdown" || mediaType === "text/x-markdown") return "markdown"
+  if (mediaType === "text/plain") {
+    return extension === "md" || extension === "markdown" ? "markdown" : "text"
+  }
+  if (fetched.data.subarray(0, 5).toString("latin1") === "%PDF-") return "pdf"
+
+  throw new Error(
+    `Cannot print ${fetched.url}: unsupported content type "${mediaType || "(none)"}". ` +
+      `Supported: PDF, plain text, images (PNG, JPEG, GIF, WebP, TIFF), HTML, and markdown.`
+  )
+}
+
+/**
+ * Decodes a text document using the charset from its Content-Type (default UTF-8).
+ */
+function decodeText(fetched: FetchedUrl): string {
+  const charset = fetched.contentType.match(/charset=["']?([\w.:-]+)/i)?.[1] ?? "utf-8"
+  try {
+    return new TextDecoder(charset).decode(fetched.data)
+  } catch {
+    return fetched.data.toString("utf-8")
+  }
+}
+
+/**
+ * A fetched document ready to print.
+ */
+export interface PreparedUrl {
+  /** File to print */
+  filePath: string
+  /** Temp file to clean up with cleanupRenderedPdf after printing */
+  tempFile: string
+  /** Detected document type */
+  type: UrlDocumentType
+  /** Content-Type reported by the server */
+  contentType: string
+  /** Number of bytes fetched */
+  bytes: number
+  /** URL the document was fetched from, after redirects */
+  url: string
+  /** Description of rendering performed (empty string if printed as-is) */
+  renderType: string
+  /** Orientation to ask of the printer, for a PDF printed as it is (PrintJobOptions.orientation) */
+  orientation?: PageOrientation
+}
+
+/**
+ * How a fetched document is laid out: the image options, and the page margins of rendered HTML
+ * and markdown.
+ */
+export interface UrlLayoutOptions extends Omit<RenderImageOptions, "signal"> {
+  /** Page margins of rendered HTML and markdown, in millimeters */
+  margins?: PageMargins
+}
+
+/**
+ * Fetches a URL and prepares it for printing: PDFs, text, and TIFF images are saved as-is;
+ * HTML, markdown, and other images are rendered to PDF.
+ *
+ * @param url - http or https URL
+ * @param layout - Fit mode, orientation, media, and margin for images, and the page margins of
+ *   rendered HTML and markdown ("auto" orientation lays them out portrait)
+ * @param signal - The MCP request's signal, which cancels the download and rendering
+ * @returns The file to print and details about what was fetched
+ * @throws {Error} If the margins are invalid, fetching fails, the content type is unsupported,
+ *   rendering fails, or the request is canceled
+ */
+export async function prepareUrlForPrinting(
+  url: string,
+  layout: UrlLayoutOptions = {},
+  signal?: AbortSignal
+): Promise<PreparedUrl> {
+  const { margins, ...imageOptions } = layout
+  if (margins) {
+    validatePageMargins(margins)
+  }
+  const orientation = layout.orientation === "auto" ? undefined : layout.orientation
+  const fetched = await fetchUrl(url, { signal })
+  const type = detectUrlDocumentType(fetched)
+  const mediaType = fetched.contentType.split(";")[0].trim().toLowerCase()
+  const details = {
+    type,
+    contentType: fetched.contentType,
+    bytes: fetched.data.length,
+    url: fetched.url,
+  }
+
+  if (type === "html") {
+    const page = withPageLayout(decodeText(fetched), { orientation, margins }, layout.media)
+    const pdf = await convertHtmlToPdf(withContentSecurityPolicy(page), {
+      chromeFlags: SANDBOX_CHROME_FLAGS,
+      tempDirPrefix: "url-",
+      signal,
+    })
+    return { ...details, filePath: pdf, tempFile: pdf, renderType: "html → PDF" }
+  }
+
+  if (type === "markdown") {
+    const name = basename(new URL(fetched.url).pathname) || "document.md"
+    const pdf = await renderMarkdownContentToPdf(decodeText(fetched), name, {
+      orientation,
+      margins,
+      signal,
+    })
+    return { ...details, filePath: pdf, tempFile: pdf, renderType: "markdown → PDF" }
+  }
+
+  if (type === "image" && RENDERED_IMAGE_TYPES.includes(mediaType)) {
+    const pdf = await renderImageDataToPdf(fetched.data, { ...imageOptions, signal })
+    return { ...details, filePath: pdf, tempFile: pdf, renderType: "image → PDF" }
+  }
+
+  const extension =
+    type === "image"
+      ? IMAGE_EXTENSIONS[mediaType]
+      : type === "pdf"
+        ? "pdf"
+        : "txt"
+  const tempDir = createTempDir("url-")
+  const filePath = join(tempDir, `download.${extension}`)
+  try {
+    writeFileSync(filePath, type === "text" ? decodeText(fetched) : fetched.data)
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return {
+    ...details,
+    filePath,
+    tempFile: filePath,
+    renderType: "",
+    ...(type === "pdf" && orientation ? { orientation } : {}),
+  }
+}
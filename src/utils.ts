@@ -6,14 +6,60 @@
 import { execa, type ExecaError } from "execa"
 import { access, readFile } from "fs/promises"
 import { constants } from "fs"
-import { writeFileSync, mkdtempSync, unlinkSync } from "fs"
-import { extname, join } from "path"
-import { tmpdir } from "os"
+import { copyFileSync, existsSync, writeFileSync, unlinkSync, rmSync } from "fs"
+import { basename, dirname, extname, join } from "path"
 import { config, MARKDOWN_EXTENSIONS, type MarkdownExtension } from "./config.js"
 import { PDFParse } from "pdf-parse"
 import { validateFilePath } from "./file-security.js"
+import { PrinterError } from "./errors.js"
+import { withRenderSlot } from "./render-limit.js"
+import { abortError } from "./timeouts.js"
+import { logCommand, logger } from "./logger.js"
 import { renderMarkdownToPdf } from "./renderers/markdown.js"
+import { renderHtmlToPdf } from "./renderers/html.js"
 import { renderCodeToPdf, shouldRenderCode } from "./renderers/code.js"
+import {
+  describeFileType,
+  resolveFileType,
+  type FileFormat,
+  type PrintFormat,
+} from "./renderers/file-type.js"
+import {
+  detectFileEncoding,
+  resolveEncoding,
+  transcodeToUtf8,
+  type CharacterEncoding,
+} from "./renderers/encoding.js"
+import { renderTextToPdf, type TextWrap } from "./renderers/text.js"
+import { getOfficeConverter, renderOfficeToPdf } from "./renderers/office.js"
+import { validateWatermark, watermarkPdf, type WatermarkOptions } from "./renderers/watermark.js"
+import { bookletPdf } from "./renderers/booklet.js"
+import { hasHeaderFooter, resolveHeaderFooter } from "./renderers/header-footer.js"
+import {
+  validatePageMargins,
+  type PageMargins,
+  type PageOrientation,
+} from "./renderers/page-layout.js"
+import { PdfDocument } from "./pdf/document.js"
+import {
+  renderImageToPdf,
+  type ImageFit,
+  type ImageOrientation,
+} from "./renderers/image.js"
+import { printerFromJobId, type LpJobOptions } from "./cups.js"
+import { getBackend } from "./backend.js"
+import { isIppUri, submitIppJob } from "./ipp/client.js"
+import { resolvePrinter } from "./printer-access.js"
+import {
+  OPTIONAL_CUPS_OPTIONS,
+  validatePrintOptions,
+  printOptionsToCupsOptions,
+  type DuplexMode,
+  type MediaSize,
+  type NumberUp,
+  type PrintJobOptions,
+} from "./print-options.js"
+import { createTempDir, isTempDir } from "./temp-files.js"
 
 /**
  * Parse a delimited string into an array of strings.
@@ -50,14 +96,27 @@ export function parseDelimitedString(
  *
  * @param command - The command binary to execute
  * @param args - Array of arguments to pass to the command
+ * @param signal - Signal that kills the command (e.g., from operationSignal)
+ * @param env - Variables added to the command's environment (e.g., cupsEnv() for CUPS commands)
  * @returns The trimmed stdout output from the command
- * @throws {Error} If the command fails or returns an error
+ * @throws {Error} If the command fails or returns an error, or the signal fires
  */
-export async function execCommand(command: string, args: string[] = []): Promise<string> {
+export async function execCommand(
+  command: string,
+  args: string[] = [],
+  signal?: AbortSignal,
+  env?: Record<string, string>
+): Promise<string> {
+  const startedAt = Date.now()
   try {
-    const { stdout } = await execa(command, args)
+    const { stdout } = await execa(command, args, { cancelSignal: signal, env })
+    logCommand(command, args, 0, startedAt)
     return stdout.trim()
   } catch (error) {
+    logCommand(command, args, (error as ExecaError).exitCode, startedAt)
+    if (signal?.aborted) {
+      throw abortError(command, signal)
+    }
     const message = error instanceof Error ? error.message : String(error)
     throw new Error(`Command failed: ${message}`)
   }
@@ -136,7 +195,7 @@ export async function checkDependency(command: string, name: string): Promise<vo
 /**
  * Locates a Chrome or Chromium installation on the system.
  * First checks the MCP_PRINTER_CHROME_PATH environment variable,
- * then searches common macOS and Linux installation paths.
+ * then searches common macOS, Windows, and Linux installation paths.
  *
  * @returns Path to Chrome/Chromium executable
  * @throws {Error} If Chrome is not found
@@ -165,6 +224,25 @@ export async function findChrome(): Promise<string> {
     }
   }
 
+  // Check Windows paths (Chrome, then Edge, which is Chromium-based and always installed)
+  if (process.platform === "win32") {
+    const programDirs = [
+      process.env.PROGRAMFILES,
+      process.env["PROGRAMFILES(X86)"],
+      process.env.LOCALAPPDATA,
+    ].filter((dir): dir is string => Boolean(dir))
+    const windowsPaths = [
+      ...programDirs.map((dir) => join(dir, "Google", "Chrome", "Application", "chrome.exe")),
+      ...programDirs.map((dir) => join(dir, "Microsoft", "Edge", "Application", "msedge.exe")),
+    ]
+
+    for (const path of windowsPaths) {
+      if (await fileExists(path)) {
+        return path
+      }
+    }
+  }
+
   // Check Linux paths
   if (process.platform === "linux") {
     const linuxCommands = ["google-chrome", "chromium", "chromium-browser"]
@@ -187,41 +265,59 @@ export async function findChrome(): Promise<string> {
  * Converts HTML content to PDF using Chrome headless.
  * Handles Chrome detection, temp file creation, execution, error handling, and cleanup.
  *
- * @param htmlContent - HTML content to convert to PDF
+ * @param htmlContent - HTML content to convert to PDF, or a function that writes the HTML to the
+ *   path it is given (for documents too large to build as one string)
  * @param options - Optional configuration
  * @param options.chromeFlags - Additional Chrome flags (e.g., ['--disable-javascript'])
- * @param options.tempDirPrefix - Prefix for temp directory name (default: 'mcp-printer-')
+ * @param options.tempDirPrefix - Prefix for temp directory name (default: 'render-')
+ * @param options.signal - The MCP request's signal (Chrome is killed and the temp directory
+ *   removed when it fires)
  * @returns Path to the generated temporary PDF file
- * @throws {Error} If Chrome is not found or PDF generation fails
+ * @throws {Error} If Chrome is not found, PDF generation fails, or the request is canceled
+ * @throws {PrinterError} TEMP_SPACE_EXCEEDED if the temp directory is over its size limit
  */
 export async function convertHtmlToPdf(
-  htmlContent: string,
-  options: { chromeFlags?: string[]; tempDirPrefix?: string } = {}
+  htmlContent: string | ((htmlPath: string) => Promise<void>),
+  options: { chromeFlags?: string[]; tempDirPrefix?: string; signal?: AbortSignal } = {}
 ): Promise<string> {
-  const { chromeFlags = [], tempDirPrefix = "mcp-printer-" } = options
+  const { chromeFlags = [], tempDirPrefix = "render-", signal } = options
 
   // Find Chrome/Chromium executable
   const chromePath = await findChrome()
 
   // Create secure temp directory
-  const tmpDir = mkdtempSync(join(tmpdir(), tempDirPrefix))
+  const tmpDir = createTempDir(tempDirPrefix)
   const tmpHtml = join(tmpDir, "input.html")
   const tmpPdf = join(tmpDir, "output.pdf")
 
   try {
     // Write HTML to temp file
-    writeFileSync(tmpHtml, htmlContent, "utf-8")
+    if (typeof htmlContent === "string") {
+      writeFileSync(tmpHtml, htmlContent, "utf-8")
+    } else {
+      await htmlContent(tmpHtml)
+    }
 
-    // Convert HTML to PDF with Chrome headless
+    // Convert HTML to PDF with Chrome headless (waiting for a render slot)
+    const chromeArgs = [
+      "--headless",
+      "--disable-gpu",
+      ...chromeFlags,
+      `--print-to-pdf=${tmpPdf}`,
+      tmpHtml,
+    ]
+    let startedAt = Date.now()
     try {
-      await execa(chromePath, [
-        "--headless",
-        "--disable-gpu",
-        ...chromeFlags,
-        `--print-to-pdf=${tmpPdf}`,
-        tmpHtml,
-      ])
+      await withRenderSlot(() => {
+        startedAt = Date.now()
+        return execa(chromePath, chromeArgs, { cancelSignal: signal })
+      })
+      logCommand(chromePath, chromeArgs, 0, startedAt)
     } catch (error) {
+      logCommand(chromePath, chromeArgs, (error as ExecaError).exitCode, startedAt)
+      if (signal?.aborted) {
+        throw abortError("Rendering", signal)
+      }
       // Chrome outputs success messages to stderr, check if PDF was actually created
       const execaError = error as ExecaError
       const stderr = String(execaError.stderr ?? "")
@@ -240,12 +336,9 @@ export async function convertHtmlToPdf(
 
     return tmpPdf
   } catch (error) {
-    // Clean up temp files on error
-    try {
-      unlinkSync(tmpHtml)
-    } catch {}
+    // Clean up temp directory on error
     try {
-      unlinkSync(tmpPdf)
+      rmSync(tmpDir, { recursive: true, force: true })
     } catch {}
     throw error
   }
@@ -268,22 +361,62 @@ export function shouldRenderToPdf(filePath: string): boolean {
 }
 
 /**
- * Execute a print job with the given file and options.
- * Handles copy validation, lpr argument building, and execution.
+ * Builds the full list of CUPS options for a job, applying configured defaults.
+ * Adds default duplex (if enabled and not overridden) and MCP_PRINTER_DEFAULT_OPTIONS,
+ * followed by the user-specified options and typed print options so they take precedence.
+ *
+ * @param options - Optional user-specified CUPS options string (space-separated)
+ * @param jobOptions - Typed print options (duplex, page_ranges, media, number_up)
+ * @returns Array of option strings to pass with -o
+ */
+export function buildCupsOptions(options?: string, jobOptions: PrintJobOptions = {}): string[] {
+  const allOptions: string[] = []
+
+  // Add default duplex if auto-enabled in config and not already specified
+  if (config.autoDuplex && !jobOptions.duplex && !options?.includes("sides=")) {
+    allOptions.push("sides=two-sided-long-edge")
+  }
+
+  // Add default options if configured
+  if (config.defaultOptions.length > 0) {
+    allOptions.push(...config.defaultOptions)
+  }
+
+  // Add user-specified options (these override defaults, split by spaces)
+  if (options) {
+    allOptions.push(...options.split(/\s+/).filter((option) => option.length > 0))
+  }
+
+  // Typed options come last so they win over raw options (lp uses the last value)
+  allOptions.push(...printOptionsToCupsOptions(jobOptions))
+
+  return allOptions
+}
+
+/**
+ * Validates print options and builds an lp job (without the document to print).
+ * Applies the configured default printer, printer allow-list, default options, and copy limit.
  *
- * @param filePath - Path to the file to print
  * @param printer - Optional printer name
- * @param copies - Number of copies to print
+ * @param jobOptions - Typed print options (copies, duplex, page_ranges, media)
  * @param options - Optional CUPS options string
- * @returns Object with printer name and formatted options
+ * @param title - Optional job title
+ * @param signal - The MCP request's signal
+ * @returns Job options ready for submitPrintJob (add filePath or content)
+ * @throws {Error} If any option is invalid, the printer is not allowed, or copies exceed
+ *   MCP_PRINTER_MAX_COPIES
  */
-export async function executePrintJob(
-  filePath: string,
+export async function buildPrintJob(
   printer?: string,
-  copies: number = 1,
-  options?: string
-): Promise<{ printerName: string; allOptions: string[] }> {
+  jobOptions: PrintJobOptions = {},
+  options?: string,
+  title?: string,
+  signal?: AbortSignal
+): Promise<LpJobOptions> {
+  validatePrintOptions(jobOptions)
+
   // Validate copy count against configured maximum
+  const copies = jobOptions.copies ?? 1
   if (config.maxCopies > 0 && copies > config.maxCopies) {
     throw new Error(
       `Copy count (${copies}) exceeds maximum allowed (${config.maxCopies}). ` +
@@ -291,51 +424,100 @@ export async function executePrintJob(
     )
   }
 
-  const args: string[] = []
-
-  // Use configured default printer if none specified
-  const targetPrinter = printer || config.defaultPrinter
-  if (targetPrinter) {
-    args.push("-P", targetPrinter)
-  }
-
-  if (copies > 1) {
-    args.push(`-#${copies}`)
-  }
-
-  // Build options with defaults
-  let allOptions = []
-
-  // Add default duplex if auto-enabled in config and not already specified
-  if (config.autoDuplex && !options?.includes("sides=")) {
-    allOptions.push("sides=two-sided-long-edge")
+  return {
+    // Use configured default printer if none specified, restricted to allowed printers
+    printer: await resolvePrinter(printer, signal),
+    title,
+    options: buildCupsOptions(options, jobOptions),
+    copies,
   }
+}
 
-  // Add default options if configured
-  if (config.defaultOptions.length > 0) {
-    allOptions.push(...config.defaultOptions)
+/**
+ * Finds the optional options (color mode, quality) a rejected job asked for, when the rejection
+ * was about unsupported attributes or names one of them.
+ *
+ * @param error - Error from the submission
+ * @param options - The job's CUPS options
+ * @returns The optional options to drop before resubmitting (empty when the job can't be saved)
+ */
+function rejectedOptionalOptions(error: unknown, options: string[]): string[] {
+  if (!(error instanceof PrinterError) || error.code !== "JOB_REJECTED") {
+    return []
   }
+  const aboutOptions =
+    /attributes-or-values/.test(error.message) ||
+    OPTIONAL_CUPS_OPTIONS.some((name) => error.message.includes(name))
+  const isOptional = (option: string) =>
+    OPTIONAL_CUPS_OPTIONS.some((name) => option.startsWith(`${name}=`))
+  return aboutOptions ? options.filter(isOptional) : []
+}
 
-  // Add user-specified options (these override defaults, split by spaces)
-  if (options) {
-    allOptions.push(...options.split(/\s+/))
-  }
+/**
+ * Submits a job to its printer: straight to the printer over IPP when the printer is an
+ * ipp:// or ipps:// URI, otherwise through the printing backend (CUPS lp, or the Windows
+ * print spooler). A job the printer rejects because of its color mode or quality is sent again
+ * without them.
+ *
+ * @param job - Job options from buildPrintJob, plus the file or content to print
+ * @param signal - Signal that cancels the submission (it is also stopped after
+ *   MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS)
+ * @param warn - Called with a warning when options were dropped to get the job accepted
+ * @returns The job ID ("<printer>-<number>", or "<printer-uri>#<job-id>" for IPP printers)
+ */
+export async function submitPrintJob(
+  job: LpJobOptions,
+  signal?: AbortSignal,
+  warn?: (warning: string) => void
+): Promise<string> {
+  const submit = (submission: LpJobOptions) =>
+    isIppUri(submission.printer)
+      ? submitIppJob(submission, signal)
+      : getBackend().submitJob(submission, signal)
 
-  // Add each option with -o flag
-  for (const option of allOptions) {
-    args.push("-o", option)
+  try {
+    return await submit(job)
+  } catch (error) {
+    const rejected = rejectedOptionalOptions(error, job.options ?? [])
+    if (rejected.length === 0) {
+      throw error
+    }
+    warn?.(
+      `The printer rejected ${rejected.join(", ")}; the job was sent without ` +
+        `${rejected.length > 1 ? "them" : "it"}, so the option may be ignored.`
+    )
+    return await submit({
+      ...job,
+      options: job.options?.filter((option) => !rejected.includes(option)),
+    })
   }
+}
 
-  // Add file path
-  args.push(filePath)
-
-  await execa("lpr", args)
+/**
+ * Execute a print job with the given file and options.
+ * Handles option validation, lp argument building, and execution.
+ *
+ * @param filePath - Path to the file to print
+ * @param printer - Optional printer name
+ * @param jobOptions - Typed print options (copies, duplex, page_ranges, media)
+ * @param options - Optional CUPS options string
+ * @param title - Optional job title (defaults to the file name)
+ * @returns Object with printer name, formatted options, and the job ID
+ */
+export async function executePrintJob(
+  filePath: string,
+  printer?: string,
+  jobOptions: PrintJobOptions = {},
+  options?: string,
+  title?: string
+): Promise<{ printerName: string; allOptions: string[]; jobId: string }> {
+  const job = await buildPrintJob(printer, jobOptions, options, title)
+  const jobId = await submitPrintJob({ ...job, filePath })
 
-  // Determine the printer name used
-  const printerName =
-    targetPrinter || (await execCommand("lpstat", ["-d"])).split(": ")[1] || "default"
+  // The job ID is "<printer>-<number>", which also tells us the default printer used
+  const printerName = job.printer || printerFromJobId(jobId)
 
-  return { printerName, allOptions }
+  return { printerName, allOptions: job.options ?? [], jobId }
 }
 
 /**
@@ -376,14 +558,23 @@ export function formatPrintResponse(
 }
 
 /**
- * Gets the page count from a PDF file using pdf-parse.
+ * Gets the page count from a PDF file by walking its page tree. Classic cross-reference
+ * tables, cross-reference streams, and linearized files are read directly; files whose
+ * structure can't be followed (damaged or encrypted ones) are counted with pdf-parse.
  *
  * @param filePath - Path to the PDF file
  * @returns Number of pages in the PDF
  * @throws {Error} If the file cannot be read or parsed
  */
 export async function getPdfPageCount(filePath: string): Promise<number> {
-  const parser = new PDFParse({ data: await readFile(filePath) })
+  const data = await readFile(filePath)
+  try {
+    return new PdfDocument(data).getPages().length
+  } catch {
+    // pdf-parse rebuilds broken cross-reference data and decrypts, so it is the fallback
+  }
+
+  const parser = new PDFParse({ data })
   try {
     const result = await parser.getInfo()
     return result.total
@@ -396,14 +587,17 @@ export async function getPdfPageCount(filePath: string): Promise<number> {
 }
 
 /**
- * Calculates the number of physical sheets needed based on page count and duplex settings.
+ * Calculates the number of physical sheets needed based on page count, duplex, and N-up
+ * settings.
  *
  * @param pdfPages - Total number of PDF pages
  * @param isDuplex - Whether duplex printing is enabled
+ * @param numberUp - Pages printed on each side of a sheet (default: 1)
  * @returns Number of physical sheets that will be used
  */
-export function calculatePhysicalSheets(pdfPages: number, isDuplex: boolean): number {
-  return isDuplex ? Math.ceil(pdfPages / 2) : pdfPages
+export function calculatePhysicalSheets(pdfPages: number, isDuplex: boolean, numberUp = 1): number {
+  const sides = Math.ceil(pdfPages / numberUp)
+  return isDuplex ? Math.ceil(sides / 2) : sides
 }
 
 /**
@@ -466,6 +660,14 @@ export interface RenderResult {
   renderedPdf: string | null
   /** Description of rendering performed (empty string if no rendering) */
   renderType: string
+  /** Type the file was printed as and how it was decided (e.g., "pdf (detected from content)") */
+  fileType: string
+  /** Sheets the booklet is printed on, when the pages were imposed as a booklet */
+  bookletSheets?: number
+  /** Whether the file is sent raw: the raw option, or label or receipt printer commands */
+  raw?: boolean
+  /** Orientation to ask of the printer, for a PDF printed as it is (PrintJobOptions.orientation) */
+  orientation?: PageOrientation
 }
 
 /**
@@ -486,6 +688,40 @@ export interface RenderOptions {
   forceMarkdownRender?: boolean
   /** Force code rendering to PDF with syntax highlighting */
   forceCodeRender?: boolean
+  /** How images are scaled onto the page */
+  imageFit?: ImageFit
+  /** Page orientation of rendered documents and images, and of PDFs printed as they are */
+  orientation?: ImageOrientation
+  /** Margin around images, in millimeters */
+  imageMarginMm?: number
+  /** Page margins of rendered text, code, markdown, and HTML, in millimeters */
+  margins?: PageMargins
+  /** Paper size images are laid out on */
+  media?: MediaSize
+  /** Header template for rendered markdown, code, and text */
+  header?: string
+  /** Footer template for rendered markdown, code, and text */
+  footer?: string
+  /** How to print the file, overriding detection from its extension and content */
+  format?: FileFormat
+  /** Character encoding of text files (default: detected) */
+  encoding?: string
+  /** How long lines of plain text are broken */
+  textWrap?: TextWrap
+  /** Columns between tab stops in plain text */
+  tabWidth?: number
+  /** Text to stamp across every page, with its opacity and font size */
+  watermark?: WatermarkOptions
+  /** Impose the pages as a booklet, two to a side in signature order */
+  booklet?: boolean
+  /** Send the file to the printer untouched, whatever its type (skips rendering) */
+  raw?: boolean
+  /** Let HTML files load remote images, stylesheets, and fonts while rendering */
+  allowRemoteResources?: boolean
+  /** The file was written by print_data in the work directory, so the allowed paths don't apply */
+  uploaded?: boolean
+  /** The MCP request's signal, which cancels rendering */
+  signal?: AbortSignal
 }
 
 /**
@@ -495,13 +731,46 @@ export interface RenderOptions {
  * It determines whether a file needs to be rendered to PDF (for enhanced formatting)
  * or can be printed as-is.
  *
+ * **File Type:** The type comes from the `format` option when given. Otherwise the file's first
+ * bytes are checked, and the content decides when the extension is missing or contradicts it
+ * (a PDF named notes.txt prints as a PDF). Binary files of unknown type are refused.
+ *
+ * **Encoding:** Text (markdown, HTML, code, plain text) is decoded from the `encoding` option or
+ * its detected encoding, and rendered or sent to the printer as UTF-8.
+ *
  * **Rendering Behavior:**
  * - **Markdown files** (`.md`, `.markdown`): Rendered to PDF with full formatting, unless
  *   auto-rendering is disabled or `forceMarkdownRender` is explicitly set to false
+ * - **Images** (`.png`, `.jpg`, `.jpeg`, `.gif`, `.webp`): Scaled onto a single PDF page of the
+ *   selected media, using `imageFit`, `orientation`, and `imageMarginMm`
+ * - **HTML files** (`.html`, `.htm`, `.xhtml`): Rendered to PDF in a sandbox, with scripts off
+ *   and remote resources blocked unless `allowRemoteResources` is set (see renderers/html.ts)
  * - **Code files**: Rendered to PDF with syntax highlighting, unless auto-rendering is
  *   disabled or `forceCodeRender` is explicitly set to false, or the extension is excluded
- * - **PDF files**: Used as-is (no re-rendering)
- * - **Other files** (text, images, etc.): Passed through without modification
+ * - **Plain text files** (`.txt`): Rendered to PDF in a monospace font, with tabs expanded to
+ *   `tabWidth` and long lines handled as `textWrap` asks, unless auto-rendering is disabled and
+ *   no header or footer is set
+ * - **Office documents** (`.docx`, `.xlsx`, `.pptx`, `.odt`, `.ods`, `.odp`): Converted to PDF
+ *   with LibreOffice (MCP_PRINTER_LIBREOFFICE_PATH), and refused when it isn't configured
+ * - **PDF files**: Used as-is (no re-rendering), unless they are watermarked
+ * - **Other files** (PostScript, TIFF, PCL): Passed through without modification, from a copy
+ *   with the right extension when the file's own extension is wrong
+ * - **Label and receipt printer commands** (ZPL, ESC/POS): Passed through untouched and
+ *   reported as `raw`, so they are sent raw (see raw.ts); `raw` does the same for any file
+ *
+ * **Orientation and Margins:** Rendered markdown, HTML, code, and text are laid out in
+ * `orientation` with `margins` (see renderers/page-layout.ts): "auto" is portrait, except for
+ * plain text, which turns to landscape when many of its lines are too wide for a portrait page.
+ * A PDF printed as it is can't be laid out again, so a portrait or landscape `orientation` is
+ * returned for the printer to turn its pages (`-o landscape`); booklets impose their own.
+ *
+ * **Watermark:** With `watermark`, the PDF to print (rendered or not) is stamped on every
+ * page by an incremental update, and printed from a temp copy. Files not printed as PDFs are
+ * refused, and a failed stamp is never skipped by the render fallback.
+ *
+ * **Booklet:** With `booklet`, the PDF to print (rendered or not, and stamped first) is imposed
+ * two pages to a side of landscape `media` sheets in signature order (see renderers/booklet.ts).
+ * Files not printed as PDFs are refused, as with watermarks.
  *
  * **Security:** All file paths are validated against allowed/denied paths before processing.
  *
@@ -516,15 +785,55 @@ export interface RenderOptions {
  * @param options.lineSpacing - Line spacing multiplier for code (e.g., "1", "1.5", "2")
  * @param options.forceMarkdownRender - Explicitly enable/disable markdown rendering
  * @param options.forceCodeRender - Explicitly enable/disable code rendering
+ * @param options.imageFit - Image scaling: "contain", "fill", or "actual-size"
+ * @param options.orientation - Page orientation: "auto", "portrait", or "landscape" ("auto"
+ *   matches an image's shape, and the width of plain text's lines)
+ * @param options.imageMarginMm - Margin around images in millimeters (overrides global setting)
+ * @param options.margins - Page margins of rendered documents, in millimeters (top, right,
+ *   bottom, left; sides left out keep the renderer's own)
+ * @param options.media - Paper size for images
+ * @param options.header - Header template (overrides MCP_PRINTER_HEADER; "" for none)
+ * @param options.footer - Footer template (overrides MCP_PRINTER_FOOTER; "" for none)
+ * @param options.format - Print the file as pdf, image, markdown, html, code, or text, whatever
+ *   its extension and content
+ * @param options.encoding - Character encoding of text files (e.g., "shift_jis"; default: detected)
+ * @param options.textWrap - How long lines of plain text are broken: "word", "character", or
+ *   "none" (cut off with an ellipsis)
+ * @param options.tabWidth - Columns between tab stops in plain text (default: 4)
+ * @param options.watermark - Text stamped diagonally across every page (e.g., "DRAFT"), with
+ *   its opacity and font size
+ * @param options.booklet - Impose the pages as a booklet (the sheets are `media`, or the size
+ *   of the first page)
+ * @param options.raw - Send the file untouched, without detecting its type or rendering it
+ * @param options.allowRemoteResources - Let HTML load http(s) images, stylesheets, and fonts
+ * @param options.uploaded - Skip the path checks for a document print_data wrote (see upload.ts)
+ * @param options.signal - The MCP request's signal (a canceled render never falls back)
  *
  * @returns Promise resolving to a RenderResult object
  * @returns result.actualFilePath - The file path to actually print (original or rendered PDF)
  * @returns result.renderedPdf - Path to temporary PDF if rendered, null if using original file
  * @returns result.renderType - Human-readable description of rendering (e.g., "markdown → PDF"),
  *                               empty string if no rendering occurred
+ * @returns result.fileType - Type the file was printed as (e.g., "pdf (detected from content)")
+ * @returns result.bookletSheets - Sheets the booklet is printed on (booklets only)
+ * @returns result.raw - Whether the file must be sent raw
+ * @returns result.orientation - Orientation to ask of the printer (PDFs printed as they are)
  *
- * @throws {Error} If file path validation fails (security check)
- * @throws {Error} If rendering fails and fallback is disabled
+ * @throws {PrinterError} PERMISSION_DENIED if file path validation fails (security check)
+ * @throws {PrinterError} FILE_NOT_FOUND if the file does not exist
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if the file is binary data of unknown type, or text
+ *   that isn't valid in its encoding (or whose encoding can't be detected)
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if a watermark or booklet is requested for a file
+ *   that isn't printed as a PDF, or for an encrypted or unreadable PDF
+ * @throws {PrinterError} UNSUPPORTED_FORMAT if `raw` is combined with a watermark or booklet
+ * @throws {PrinterError} UNSUPPORTED_FORMAT for an office document when no converter is
+ *   configured (see renderers/office.ts)
+ * @throws {PrinterError} TIMEOUT if converting an office document takes too long
+ * @throws {PrinterError} TEMP_SPACE_EXCEEDED if a render is needed while the temp directory is
+ *   over its size limit (MCP_PRINTER_TEMP_MAX_MB)
+ * @throws {Error} If the encoding, tab width, margins, or watermark options are not supported
+ * @throws {Error} If rendering fails and fallback is disabled, or converting an office document
+ *   fails (office documents never fall back: printers can't read them)
  *
  * @example
  * // Prepare a markdown file (will be rendered to PDF)
@@ -532,6 +841,7 @@ export interface RenderOptions {
  * // result.actualFilePath = "/tmp/rendered-abc123.pdf"
  * // result.renderedPdf = "/tmp/rendered-abc123.pdf"
  * // result.renderType = "markdown → PDF"
+ * // result.fileType = "markdown"
  *
  * @example
  * // Prepare a PDF file (used as-is)
@@ -539,71 +849,331 @@ export interface RenderOptions {
  * // result.actualFilePath = "document.pdf"
  * // result.renderedPdf = null
  * // result.renderType = ""
+ * // result.fileType = "pdf"
  */
 export async function prepareFileForPrinting(options: RenderOptions): Promise<RenderResult> {
-  // Validate file path security
-  validateFilePath(options.filePath)
+  // Validate file path security (uploads are written by the server, outside the allowed paths)
+  if (!options.uploaded) {
+    validateFilePath(options.filePath)
+  }
+  if (!existsSync(options.filePath)) {
+    throw new PrinterError("FILE_NOT_FOUND", `File not found: ${options.filePath}`)
+  }
+
+  // Raw files go to the printer as they are, so nothing may be rendered, stamped, or imposed
+  if (options.raw) {
+    if (options.watermark || options.booklet) {
+      throw new PrinterError(
+        "UNSUPPORTED_FORMAT",
+        `Cannot ${options.watermark ? "add a watermark to" : "impose a booklet from"} ` +
+          `${basename(options.filePath)}: raw files are sent to the printer untouched.`,
+        { suggestion: "Print it without raw to stamp or impose it." }
+      )
+    }
+    return {
+      actualFilePath: options.filePath,
+      renderedPdf: null,
+      renderType: "",
+      fileType: "raw (raw option)",
+      raw: true,
+    }
+  }
+
+  if (options.watermark) {
+    validateWatermark(options.watermark)
+  }
+  if (options.margins) {
+    validatePageMargins(options.margins)
+  }
+
+  const requestedEncoding = options.encoding ? resolveEncoding(options.encoding) : undefined
+  const resolved = await resolveFileType(options.filePath, options.format)
+  const { format } = resolved
+  const isText =
+    format === "markdown" || format === "html" || format === "code" || format === "text"
 
-  let actualFilePath = options.filePath
-  let renderedPdf: string | null = null
-  let renderType = ""
+  // The encoding of text is worked out up front, so an undetectable one fails before rendering
+  const encoding = isText
+    ? (requestedEncoding ?? (await detectFileEncoding(options.filePath)))
+    : undefined
+  const fileType = encoding && encoding !== "utf-8" ? { ...resolved, encoding } : resolved
 
-  // Check if file should be auto-rendered to PDF (markdown)
+  const startedAt = Date.now()
+  const fallBack = (render: () => Promise<RenderedPdf>) =>
+    renderWithFallback(render, options.filePath, format, options.signal)
+
+  // Documents are portrait unless asked otherwise; only plain text works out "auto" itself
+  const layout = {
+    orientation: options.orientation === "auto" ? undefined : options.orientation,
+    margins: options.margins,
+  }
+
+  // Check if file should be auto-rendered to PDF (markdown); an explicit format always renders
   const shouldRenderMarkdown =
-    options.forceMarkdownRender !== undefined
-      ? options.forceMarkdownRender &&
-        MARKDOWN_EXTENSIONS.some((ext) => options.filePath.toLowerCase().endsWith(`.${ext}`))
-      : shouldRenderToPdf(options.filePath)
+    format === "markdown" &&
+    (options.forceMarkdownRender ?? (fileType.source === "format" || config.autoRenderMarkdown))
 
+  let rendered: RenderedPdf | undefined
   if (shouldRenderMarkdown) {
-    try {
-      renderedPdf = await renderMarkdownToPdf(options.filePath)
-      actualFilePath = renderedPdf
-      renderType = "markdown → PDF"
-    } catch (error) {
-      // If fallback is enabled, use original file; otherwise throw error
-      if (config.fallbackOnRenderError) {
-        console.error(`Warning: Failed to render ${options.filePath}, using as-is:`, error)
-      } else {
-        throw error
-      }
-    }
+    rendered = await fallBack(async () => ({
+      pdfPath: await renderMarkdownToPdf(options.filePath, {
+        header: options.header,
+        footer: options.footer,
+        ...layout,
+        encoding,
+        signal: options.signal,
+      }),
+      renderType: "markdown → PDF",
+    }))
+  }
+  // Images are laid out on a PDF page so they print at a sensible size
+  else if (format === "image") {
+    rendered = await fallBack(async () => ({
+      pdfPath: await renderImageToPdf(options.filePath, {
+        fit: options.imageFit,
+        orientation: options.orientation,
+        marginMm: options.imageMarginMm,
+        media: options.media,
+        signal: options.signal,
+      }),
+      renderType: "image → PDF",
+    }))
+  }
+  // HTML is rendered in a sandbox, like a page printed from a browser
+  else if (format === "html") {
+    rendered = await fallBack(() =>
+      renderHtmlToPdf(options.filePath, {
+        allowRemoteResources: options.allowRemoteResources,
+        encoding,
+        media: options.media,
+        ...layout,
+        signal: options.signal,
+      })
+    )
   }
   // Check if file should be rendered as code with syntax highlighting
   else if (
-    options.forceCodeRender !== undefined
-      ? options.forceCodeRender
-      : await shouldRenderCode(options.filePath)
+    isText &&
+    (options.forceCodeRender ?? (format === "code" || (await shouldRenderCode(options.filePath))))
   ) {
-    try {
-      renderedPdf = await renderCodeToPdf(options.filePath, {
+    rendered = await fallBack(async () => ({
+      pdfPath: await renderCodeToPdf(options.filePath, {
         lineNumbers: options.lineNumbers,
         colorScheme: options.colorScheme,
         fontSize: options.fontSize,
         lineSpacing: options.lineSpacing,
-      })
-      actualFilePath = renderedPdf
-      renderType = "code → PDF (syntax highlighted)"
+        ...layout,
+        header: options.header,
+        footer: options.footer,
+        encoding,
+        signal: options.signal,
+      }),
+      renderType: "code → PDF (syntax highlighted)",
+    }))
+  }
+  // Plain text is rendered unless auto-rendering is off and there's no header or footer to print
+  else if (
+    format === "text" &&
+    (config.autoRenderText ||
+      hasHeaderFooter(resolveHeaderFooter({ header: options.header, footer: options.footer })))
+  ) {
+    rendered = await fallBack(async () => ({
+      pdfPath: await renderTextToPdf(options.filePath, {
+        wrap: options.textWrap,
+        tabWidth: options.tabWidth,
+        fontSize: options.fontSize,
+        lineSpacing: options.lineSpacing,
+        media: options.media,
+        orientation: options.orientation,
+        margins: options.margins,
+        header: options.header,
+        footer: options.footer,
+        encoding,
+        signal: options.signal,
+      }),
+      renderType: "text → PDF",
+    }))
+  }
+  // Office documents are converted to PDF; printers can't read them, so a converter that is
+  // missing or fails refuses the file instead of falling back to sending it as is
+  else if (format === "office") {
+    const converter = getOfficeConverter(options.filePath, fileType.extension)
+    rendered = {
+      pdfPath: await renderOfficeToPdf(options.filePath, converter, { signal: options.signal }),
+      renderType: "office → PDF",
+    }
+  }
+
+  let actualFilePath = rendered?.pdfPath ?? options.filePath
+  let renderedPdf: string | null = rendered?.pdfPath ?? null
+  let renderType = rendered?.renderType ?? ""
+
+  if (renderType) {
+    logger.info("rendered", {
+      file: options.filePath,
+      render_type: renderType,
+      duration_ms: Date.now() - startedAt,
+    })
+  }
+
+  // A file sent as it is keeps its content's type, even if its own extension says otherwise,
+  // and text in another encoding (or with a byte order mark) is sent as plain UTF-8
+  const transcode = encoding !== undefined && fileType.encoding !== undefined
+  if (!renderedPdf && (fileType.extension || transcode)) {
+    renderedPdf = await copyForPrinting(
+      options.filePath,
+      fileType.extension,
+      transcode ? encoding : undefined
+    )
+    actualFilePath = renderedPdf
+  }
+
+  // The watermark is stamped on the PDF that is printed, whether it was rendered or not; a
+  // file that isn't printed as a PDF (or failed to render) is refused rather than printed bare
+  if (options.watermark) {
+    try {
+      if (!renderType && format !== "pdf") {
+        throw new PrinterError(
+          "UNSUPPORTED_FORMAT",
+          `Cannot add a watermark to ${basename(options.filePath)}: it is printed as ` +
+            `${describeFileType(fileType)}, not as a PDF.`,
+          {
+            suggestion:
+              "Watermarks are stamped on PDFs and on rendered markdown, HTML, code, text, images, and office documents. Convert the file to PDF, or print it without a watermark.",
+          }
+        )
+      }
+      const stamped = await watermarkPdf(actualFilePath, options.watermark, options.signal)
+      cleanupRenderedPdf(renderedPdf)
+      renderedPdf = stamped
+      actualFilePath = stamped
+      renderType = renderType ? `${renderType}, watermarked` : "watermarked"
     } catch (error) {
-      // If fallback is enabled, use original file; otherwise throw error
-      if (config.fallbackOnRenderError) {
-        console.error(`Warning: Failed to render code ${options.filePath}, using as-is:`, error)
-      } else {
-        throw error
+      cleanupRenderedPdf(renderedPdf)
+      throw error
+    }
+  }
+
+  // The booklet is imposed last, so each of its pages carries the watermark
+  let bookletSheets: number | undefined
+  if (options.booklet) {
+    try {
+      if (!renderType && format !== "pdf") {
+        throw new PrinterError(
+          "UNSUPPORTED_FORMAT",
+          `Cannot print ${basename(options.filePath)} as a booklet: it is printed as ` +
+            `${describeFileType(fileType)}, not as a PDF.`,
+          {
+            suggestion:
+              "Booklets are imposed from PDFs and from rendered markdown, HTML, code, text, images, and office documents. Convert the file to PDF, or print it without booklet.",
+          }
+        )
       }
+      const booklet = await bookletPdf(actualFilePath, { media: options.media }, options.signal)
+      cleanupRenderedPdf(renderedPdf)
+      renderedPdf = booklet.pdfPath
+      actualFilePath = booklet.pdfPath
+      bookletSheets = booklet.sheets
+      renderType = renderType ? `${renderType}, booklet` : "booklet"
+    } catch (error) {
+      cleanupRenderedPdf(renderedPdf)
+      throw error
     }
   }
 
-  return { actualFilePath, renderedPdf, renderType }
+  // A PDF printed as it is is turned by the printer (a booklet's sheets are already landscape)
+  const printerOrientation = format === "pdf" && !options.booklet ? layout.orientation : undefined
+
+  return {
+    actualFilePath,
+    renderedPdf,
+    renderType,
+    fileType: describeFileType(fileType),
+    ...(bookletSheets !== undefined ? { bookletSheets } : {}),
+    ...(format === "raw" ? { raw: true } : {}),
+    ...(printerOrientation ? { orientation: printerOrientation } : {}),
+  }
+}
+
+/**
+ * A file rendered to PDF, and how it was rendered.
+ */
+interface RenderedPdf {
+  pdfPath: string
+  renderType: string
+}
+
+/**
+ * Runs a render. When it fails and MCP_PRINTER_FALLBACK_ON_RENDER_ERROR is on, the failure is
+ * logged and the file is printed as it is instead, unless the request was canceled.
+ *
+ * @returns The rendered PDF, or undefined if the render failed and fell back
+ * @throws {Error} The render's error, if fallback is off or the request was canceled
+ */
+async function renderWithFallback(
+  render: () => Promise<RenderedPdf>,
+  filePath: string,
+  format: PrintFormat,
+  signal?: AbortSignal
+): Promise<RenderedPdf | undefined> {
+  try {
+    return await render()
+  } catch (error) {
+    if (!config.fallbackOnRenderError || signal?.aborted) {
+      throw error
+    }
+    logger.warn("render failed, printing the file as it is", { file: filePath, format, error })
+    return undefined
+  }
+}
+
+/**
+ * Copies a file into its own temp directory, for files sent as they are: under a new extension
+ * when the file's own contradicts its content, and as UTF-8 when it is text to transcode.
+ *
+ * @param filePath - File to copy
+ * @param extension - Extension of the copy (default: the file's name is kept)
+ * @param encoding - Encoding to transcode the file from (default: the bytes are copied)
+ * @returns Path to the copy (remove it with cleanupRenderedPdf)
+ */
+async function copyForPrinting(
+  filePath: string,
+  extension?: string,
+  encoding?: CharacterEncoding
+): Promise<string> {
+  const tempDir = createTempDir("typed-")
+  const name = extension
+    ? `${basename(filePath, extname(filePath)) || "document"}.${extension}`
+    : basename(filePath)
+  const copy = join(tempDir, name)
+  try {
+    if (encoding === undefined) {
+      copyFileSync(filePath, copy)
+    } else {
+      await transcodeToUtf8(filePath, copy, encoding)
+    }
+  } catch (error) {
+    rmSync(tempDir, { recursive: true, force: true })
+    throw error
+  }
+  return copy
 }
 
 /**
  * Determines if duplex printing is enabled based on configuration and options.
+ * An explicit duplex mode takes precedence over the options string and configuration.
  *
  * @param options - CUPS options string (may contain sides= option)
+ * @param duplex - Optional typed duplex mode
  * @returns True if duplex printing is enabled
  */
-export function isDuplexEnabled(options?: string): boolean {
+export function isDuplexEnabled(options?: string, duplex?: DuplexMode): boolean {
+  if (duplex) {
+    return duplex !== "none"
+  }
+  if (options?.includes("sides=one-sided")) {
+    return false
+  }
   return (
     config.autoDuplex ||
     options?.includes("sides=two-sided") ||
@@ -611,15 +1181,41 @@ export function isDuplexEnabled(options?: string): boolean {
   )
 }
 
+/**
+ * Determines how many pages are printed on each side of a sheet.
+ * An explicit number_up takes precedence over the options string and configured defaults;
+ * the last number-up option wins, as with lp.
+ *
+ * @param options - CUPS options string (may contain number-up= option)
+ * @param numberUp - Optional typed pages per sheet
+ * @returns Pages per side (1 when N-up isn't requested)
+ */
+export function getPagesPerSheet(options?: string, numberUp?: NumberUp): number {
+  if (numberUp !== undefined) {
+    return numberUp
+  }
+  const allOptions = [...config.defaultOptions, ...(options?.split(/\s+/) ?? [])]
+  const last = allOptions.filter((option) => option.startsWith("number-up=")).pop()
+  const value = last ? parseInt(last.slice("number-up=".length), 10) : NaN
+  return value > 1 ? value : 1
+}
+
 /**
  * Cleans up a rendered PDF temp file if it exists.
+ * Renderers write into a temp directory of their own in the work directory (see
+ * temp-files.ts), which is removed as well.
  *
  * @param renderedPdf - Path to rendered PDF temp file (or null)
  */
 export function cleanupRenderedPdf(renderedPdf: string | null): void {
   if (renderedPdf) {
+    const renderDir = dirname(renderedPdf)
     try {
-      unlinkSync(renderedPdf)
+      if (isTempDir(renderDir)) {
+        rmSync(renderDir, { recursive: true, force: true })
+      } else {
+        unlinkSync(renderedPdf)
+      }
     } catch {
       // Ignore cleanup errors
     }
@@ -0,0 +1,478 @@
+/**
+ * @fileoverview Windows print spooler helpers and output parsers.
+ * Node has no binding for the winspool API, so jobs are written with OpenPrinter /
+ * StartDocPrinter / WritePrinter from a small C# shim compiled by PowerShell's Add-Type,
+ * and printers and jobs are queried with Win32_Printer and the PrintManagement cmdlets.
+ * Every command's output is JSON so it can be parsed without depending on the Windows locale.
+ */
+
+import { execa } from "execa"
+import { win32 } from "path"
+import { printerFromJobId } from "./cups.js"
+import { PrinterError, commandError } from "./errors.js"
+import { abortError, operationSignal, type OperationKind } from "./timeouts.js"
+import { logCommand, logger } from "./logger.js"
+import { RAW_OPTION } from "./raw.js"
+import type { JobState, JobStatus, LpJobOptions, PrinterSummary } from "./cups.js"
+
+/**
+ * PowerShell executable (Windows PowerShell 5.1 ships with every supported Windows version).
+ */
+const POWERSHELL = "powershell.exe"
+
+/**
+ * Prefix of the environment variables that pass arguments to PowerShell scripts.
+ * Arguments are never interpolated into the script, so printer names and paths need no quoting.
+ */
+const PARAM_PREFIX = "MCP_PRINTER_PS_"
+
+/**
+ * Runs a PowerShell script and returns its stdout.
+ *
+ * @param script - Script to run (errors stop the script)
+ * @param params - Arguments, available to the script as $env:MCP_PRINTER_PS_<NAME>
+ * @param options - Data streamed to the script's stdin, which timeout applies (default: the
+ *   status timeout), and the MCP request's signal
+ * @returns The script's stdout
+ * @throws {Error} If PowerShell exits with an error, with its error message, or times out
+ */
+async function runPowerShell(
+  script: string,
+  params: Record<string, string> = {},
+  options: { input?: string | Buffer; kind?: OperationKind; signal?: AbortSignal } = {}
+): Promise<string> {
+  const { input, kind = "status", signal } = options
+  const env = Object.fromEntries(
+    Object.entries(params).map(([name, value]) => [`${PARAM_PREFIX}${name}`, value])
+  )
+  const encodedScript = Buffer.from(
+    `$ErrorActionPreference = 'Stop'\n$ProgressPreference = 'SilentlyContinue'\n${script}`,
+    "utf16le"
+  ).toString("base64")
+
+  const operation = operationSignal(kind, signal)
+  const args = [
+    "-NoProfile",
+    "-NonInteractive",
+    "-ExecutionPolicy",
+    "Bypass",
+    "-EncodedCommand",
+    encodedScript,
+  ]
+  const startedAt = Date.now()
+  const result = await execa(POWERSHELL, args, {
+    env,
+    reject: false,
+    cancelSignal: operation,
+    ...(input !== undefined ? { input } : {}),
+  })
+  logCommand(POWERSHELL, args, result.exitCode, startedAt)
+
+  if (result.isCanceled) {
+    throw abortError("PowerShell", operation)
+  }
+
+  if (result.exitCode !== 0) {
+    const stderr = String(result.stderr).trim()
+    throw commandError(
+      `PowerShell failed: ${stderr || `powershell exited with ${result.exitCode}`}`,
+      stderr
+    )
+  }
+  return String(result.stdout)
+}
+
+/**
+ * Parses ConvertTo-Json output, which is empty when there is nothing to report.
+ */
+function parseJson<T>(output: string): T | null {
+  const trimmed = output.trim()
+  return trimmed ? (JSON.parse(trimmed) as T) : null
+}
+
+/**
+ * C# shim that writes a document to a printer through the winspool API.
+ * The data is spooled as RAW, so it reaches the printer unchanged (like `lp -o raw`): the
+ * printer must understand the format (PDF, PostScript, PCL, or plain text).
+ */
+const SPOOLER_SHIM = `
+Add-Type -TypeDefinition @"
+using System;
+using System.ComponentModel;
+using System.Runtime.InteropServices;
+
+public static class McpPrinterSpooler {
+  [StructLayout(LayoutKind.Sequential, CharSet = CharSet.Unicode)]
+  public class DocInfo {
+    public string pDocName;
+    public string pOutputFile;
+    public string pDataType;
+  }
+
+  [DllImport("winspool.drv", CharSet = CharSet.Unicode, SetLastError = true)]
+  static extern bool OpenPrinter(string pPrinterName, out IntPtr phPrinter, IntPtr pDefault);
+  [DllImport("winspool.drv", SetLastError = true)]
+  static extern bool ClosePrinter(IntPtr hPrinter);
+  [DllImport("winspool.drv", CharSet = CharSet.Unicode, SetLastError = true)]
+  static extern int StartDocPrinter(IntPtr hPrinter, int level, [In] DocInfo pDocInfo);
+  [DllImport("winspool.drv", SetLastError = true)]
+  static extern bool EndDocPrinter(IntPtr hPrinter);
+  [DllImport("winspool.drv", SetLastError = true)]
+  static extern bool StartPagePrinter(IntPtr hPrinter);
+  [DllImport("winspool.drv", SetLastError = true)]
+  static extern bool EndPagePrinter(IntPtr hPrinter);
+  [DllImport("winspool.drv", SetLastError = true)]
+  static extern bool WritePrinter(IntPtr hPrinter, byte[] pBuf, int cbBuf, out int pcWritten);
+
+  public static int Submit(string printer, string title, byte[] data) {
+    IntPtr handle;
+    if (!OpenPrinter(printer, out handle, IntPtr.Zero)) {
+      throw new Win32Exception(Marshal.GetLastWin32Error(), "OpenPrinter failed for " + printer);
+    }
+    try {
+      DocInfo info = new DocInfo();
+      info.pDocName = title;
+      info.pDataType = "RAW";
+      int jobId = StartDocPrinter(handle, 1, info);
+      if (jobId == 0) {
+        throw new Win32Exception(Marshal.GetLastWin32Error(), "StartDocPrinter failed");
+      }
+      try {
+        int written;
+        if (!StartPagePrinter(handle) || !WritePrinter(handle, data, data.Length, out written)) {
+          throw new Win32Exception(Marshal.GetLastWin32Error(), "WritePrinter failed");
+        }
+        EndPagePrinter(handle);
+      } finally {
+        EndDocPrinter(handle);
+      }
+      return jobId;
+    } finally {
+      ClosePrinter(handle);
+    }
+  }
+}
+"@
+`
+
+/**
+ * Submits the document (from a file, or from stdin) once per copy and writes the printer name
+ * and job IDs as JSON.
+ */
+const SUBMIT_SCRIPT = `${SPOOLER_SHIM}
+$printer = $env:MCP_PRINTER_PS_PRINTER
+if (-not $printer) {
+  $printer = (Get-CimInstance -ClassName Win32_Printer -Filter "Default = TRUE").Name
+}
+if (-not $printer) { throw "No printer specified and no default printer is set" }
+if ($env:MCP_PRINTER_PS_FILE) {
+  $data = [System.IO.File]::ReadAllBytes($env:MCP_PRINTER_PS_FILE)
+} else {
+  $buffer = New-Object System.IO.MemoryStream
+  [Console]::OpenStandardInput().CopyTo($buffer)
+  $data = $buffer.ToArray()
+}
+$jobIds = @()
+for ($copy = 0; $copy -lt [int]$env:MCP_PRINTER_PS_COPIES; $copy++) {
+  $jobIds += [McpPrinterSpooler]::Submit($printer, $env:MCP_PRINTER_PS_TITLE, $data)
+}
+ConvertTo-Json -Compress -InputObject @{ printer = $printer; job_ids = $jobIds }
+`
+
+/**
+ * Submits a print job to the Windows spooler and returns its job ID ("<printer>-<number>").
+ * When `content` is given it is streamed to PowerShell over stdin, so no temp file is written.
+ *
+ * The document is spooled unchanged, so CUPS options (`-o`) cannot be applied and are
+ * ignored with a warning. Each copy is spooled as its own job; the first job's ID is returned.
+ *
+ * @param job - Job options
+ * @param signal - Signal that cancels the submission
+ * @returns The job ID (e.g., "Office HP-12")
+ * @throws {Error} If the printer can't be opened, the spooler rejects the job, or the
+ *   submission times out
+ */
+export async function submitWindowsJob(job: LpJobOptions, signal?: AbortSignal): Promise<string> {
+  // Ignoring the hold would print a job the user asked to keep back
+  if (job.options?.some((option) => option.startsWith("job-hold-until="))) {
+    throw new PrinterError(
+      "JOB_REJECTED",
+      "The Windows print spooler backend can't hold jobs (hold, hold_until).",
+      { suggestion: "Print without hold or hold_until, or pause the printer's queue instead." }
+    )
+  }
+  // Documents are always spooled as RAW data, so a raw job needs nothing more
+  const options = job.options?.filter((option) => option !== RAW_OPTION) ?? []
+  if (options.length > 0) {
+    logger.warn("the Windows print spooler backend ignores print options", { options })
+  }
+
+  const output = await runPowerShell(
+    SUBMIT_SCRIPT,
+    {
+      PRINTER: job.printer ?? "",
+      FILE: job.filePath ?? "",
+      TITLE: job.title || (job.filePath ? win32.basename(job.filePath) : "mcp-printer"),
+      COPIES: String(Math.max(1, job.copies ?? 1)),
+    },
+    { input: job.filePath ? undefined : (job.content ?? ""), kind: "submit", signal }
+  )
+
+  const result = parseJson<{ printer: string; job_ids: number[] | number }>(output)
+  const jobIds = [result?.job_ids ?? []].flat()
+  if (!result || jobIds.length === 0) {
+    throw new Error(`The Windows print spooler did not report a job ID: ${output}`)
+  }
+  return `${result.printer}-${jobIds[0]}`
+}
+
+/**
+ * A printer as reported by Win32_Printer.
+ */
+export interface WindowsPrinter {
+  name: string
+  comment?: string | null
+  location?: string | null
+  default?: boolean
+  /** Win32_Printer.PrinterStatus (3 = idle, 4 = printing, 7 = offline, ...) */
+  status?: number
+  /** True when the printer is set to "Use Printer Offline" */
+  offline?: boolean
+}
+
+/**
+ * Printer states for Win32_Printer.PrinterStatus values.
+ */
+const WINDOWS_PRINTER_STATES: Record<number, PrinterSummary["state"]> = {
+  3: "idle",
+  4: "printing",
+  5: "idle",
+  6: "stopped",
+  7: "stopped",
+}
+
+/**
+ * Parses the printer listing written by listWindowsPrinters.
+ *
+ * @param output - JSON array of Win32_Printer fields
+ * @returns Array of printer summaries in the order Windows listed them
+ */
+export function parseWindowsPrinters(output: string): PrinterSummary[] {
+  const printers = [parseJson<WindowsPrinter[] | WindowsPrinter>(output) ?? []].flat()
+
+  return printers.map((printer) => {
+    const summary: PrinterSummary = {
+      name: printer.name,
+      description: printer.comment?.trim() || printer.name,
+      is_default: printer.default === true,
+      state: printer.offline
+        ? "stopped"
+        : (WINDOWS_PRINTER_STATES[printer.status ?? 0] ?? "unknown"),
+      accepting_jobs: true,
+    }
+    if (printer.offline || printer.status === 7) {
+      summary.state_message = "Offline"
+    }
+    if (printer.location?.trim()) {
+      summary.location = printer.location.trim()
+    }
+    return summary
+  })
+}
+
+/**
+ * Lists the Windows printers with their description, state, and default status.
+ *
+ * @param signal - The MCP request's signal
+ * @returns Array of printer summaries (empty when no printers are installed)
+ * @throws {Error} If the printers can't be queried
+ */
+export async function listWindowsPrinters(signal?: AbortSignal): Promise<PrinterSummary[]> {
+  const output = await runPowerShell(
+    `
+$printers = @(Get-CimInstance -ClassName Win32_Printer | ForEach-Object {
+  @{
+    name = $_.Name
+    comment = $_.Comment
+    location = $_.Location
+    default = $_.Default
+    status = [int]$_.PrinterStatus
+    offline = $_.WorkOffline
+  }
+})
+ConvertTo-Json -Compress -InputObject $printers
+`,
+    {},
+    { signal }
+  )
+  return parseWindowsPrinters(output)
+}
+
+/**
+ * A print job as reported by Get-PrintJob.
+ */
+export interface WindowsJob {
+  id: number
+  printer: string
+  user?: string | null
+  size?: number
+  submitted?: string | null
+  /** Get-PrintJob JobStatus flags (e.g., "Printing, Retained"), "Normal" when none are set */
+  status?: string | null
+}
+
+/**
+ * Infers a job's state from its Windows JobStatus flags.
+ *
+ * @param flags - Lowercased JobStatus flags (e.g., ["printing", "retained"])
+ * @returns The inferred job state
+ */
+export function inferWindowsJobState(flags: string[]): JobState {
+  if (flags.includes("deleting") || flags.includes("deleted")) return "canceled"
+  if (flags.includes("printed") || flags.includes("complete")) return "completed"
+  if (flags.includes("printing") || flags.includes("spooling")) return "processing"
+  if (flags.includes("paused")) return "held"
+  return "pending"
+}
+
+/**
+ * Converts a job written by getWindowsJobStatus into a job status.
+ *
+ * @param job - Job fields from Get-PrintJob
+ * @returns The job's status, with its JobStatus flags as alerts
+ */
+export function windowsJobToStatus(job: WindowsJob): JobStatus {
+  const flags = (job.status ?? "")
+    .split(",")
+    .map((flag) => flag.trim().toLowerCase())
+    .filter((flag) => flag && flag !== "normal")
+
+  return {
+    job_id: `${job.printer}-${job.id}`,
+    state: inferWindowsJobState(flags),
+    printer: job.printer,
+    ...(job.user ? { user: job.user } : {}),
+    ...(job.size !== undefined ? { size: job.size } : {}),
+    ...(job.submitted ? { submitted: job.submitted } : {}),
+    alerts: flags,
+  }
+}
+
+/**
+ * Splits a job ID into its printer and spooler job number.
+ * A bare number ("12") matches the job on any printer.
+ *
+ * @throws {Error} If the job ID doesn't end in a job number
+ */
+function parseWindowsJobId(jobId: string): { printer: string; id: string } {
+  if (/^\d+$/.test(jobId)) {
+    return { printer: "", id: jobId }
+  }
+  const number = jobId.slice(jobId.lastIndexOf("-") + 1)
+  if (!jobId.includes("-") || !/^\d+$/.test(number)) {
+    throw new Error(`Invalid job ID "${jobId}": expected "<printer>-<number>"`)
+  }
+  return { printer: printerFromJobId(jobId), id: number }
+}
+
+/**
+ * Finds the job given as $env:MCP_PRINTER_PS_PRINTER / $env:MCP_PRINTER_PS_ID (into $job).
+ */
+const FIND_JOB_SCRIPT = `
+$id = [int]$env:MCP_PRINTER_PS_ID
+if ($env:MCP_PRINTER_PS_PRINTER) {
+  $queues = @($env:MCP_PRINTER_PS_PRINTER)
+} else {
+  $queues = @(Get-Printer | ForEach-Object { $_.Name })
+}
+$job = $queues |
+  ForEach-Object { Get-PrintJob -PrinterName $_ -ErrorAction SilentlyContinue } |
+  Where-Object { $_.Id -eq $id } |
+  Select-Object -First 1
+`
+
+/**
+ * Looks up the current state of a print job.
+ * Windows removes jobs from the queue once they have printed (unless the printer keeps
+ * printed documents), so finished jobs are usually reported with state "not-found".
+ *
+ * @param jobId - Job ID (e.g., "Office HP-12") or job number (e.g., "12")
+ * @param signal - The MCP request's signal
+ * @returns The job's status
+ * @throws {Error} If the job ID is malformed or the queue can't be queried
+ */
+export async function getWindowsJobStatus(jobId: string, signal?: AbortSignal): Promise<JobStatus> {
+  const { printer, id } = parseWindowsJobId(jobId)
+  const output = await runPowerShell(
+    `${FIND_JOB_SCRIPT}
+if ($job) {
+  ConvertTo-Json -Compress -InputObject @{
+    id = $job.Id
+    printer = $job.PrinterName
+    user = $job.UserName
+    size = $job.Size
+    submitted = $job.SubmittedTime.ToString("o")
+    status = [string]$job.JobStatus
+  }
+}
+`,
+    { PRINTER: printer, ID: id },
+    { signal }
+  )
+
+  const job = parseJson<WindowsJob>(output)
+  return job ? windowsJobToStatus(job) : { job_id: jobId, state: "not-found" }
+}
+
+/**
+ * Cancels a single job with Remove-PrintJob.
+ *
+ * @param jobId - Full job ID (e.g., "Office HP-12")
+ * @param signal - The MCP request's signal
+ * @throws {Error} If the job doesn't exist or can't be removed
+ */
+export async function cancelWindowsJob(jobId: string, signal?: AbortSignal): Promise<void> {
+  const { printer, id } = parseWindowsJobId(jobId)
+  await runPowerShell(
+    `${FIND_JOB_SCRIPT}
+if (-not $job) { throw "Job $id not found" }
+Remove-PrintJob -InputObject $job
+`,
+    { PRINTER: printer, ID: id },
+    { signal }
+  )
+}
+
+/**
+ * Releases a paused job with Resume-PrintJob.
+ *
+ * @param jobId - Full job ID (e.g., "Office HP-12")
+ * @param signal - The MCP request's signal
+ * @throws {Error} If the job doesn't exist or can't be resumed
+ */
+export async function releaseWindowsJob(jobId: string, signal?: AbortSignal): Promise<void> {
+  const { printer, id } = parseWindowsJobId(jobId)
+  await runPowerShell(
+    `${FIND_JOB_SCRIPT}
+if (-not $job) { throw "Job $id not found" }
+Resume-PrintJob -InputObject $job
+`,
+    { PRINTER: printer, ID: id },
+    { signal }
+  )
+}
+
+/**
+ * Cancels every job queued on a printer.
+ *
+ * @param printer - Printer name
+ * @param signal - The MCP request's signal
+ * @throws {Error} If the printer doesn't exist or its jobs can't be removed
+ */
+export async function cancelAllWindowsJobs(printer: string, signal?: AbortSignal): Promise<void> {
+  await runPowerShell(
+    "Get-PrintJob -PrinterName $env:MCP_PRINTER_PS_PRINTER | Remove-PrintJob",
+    { PRINTER: printer },
+    { signal }
+  )
+}
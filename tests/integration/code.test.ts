@@ -3,7 +3,9 @@
  */
 
 import { describe, it, expect, vi } from "vitest"
-import { unlinkSync } from "fs"
+import { readFileSync, unlinkSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
 
 // Mock config to allow access to test directory
 vi.mock("../../src/config.js", () => {
@@ -34,9 +36,12 @@ vi.mock("../../src/config.js", () => {
 import {
   getLanguageFromExtension,
   fixMultilineSpans,
+  buildCodeHtml,
   renderCodeToPdf,
 } from "../../src/renderers/code.js"
 
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+
 describe("getLanguageFromExtension", () => {
   it("should map whitelisted extensions to highlight.js language names", () => {
     expect(getLanguageFromExtension("file.ts")).toBe("typescript")
@@ -140,6 +145,70 @@ describe("fixMultilineSpans", () => {
   })
 })
 
+describe("buildCodeHtml", () => {
+  const goFixture = join(fixturesDir, "handler.go")
+  const goSource = readFileSync(goFixture, "utf-8")
+
+  it("should style Go keywords in the handler fixture", () => {
+    const html = buildCodeHtml(goFixture, goSource, { lineNumbers: true })
+
+    expect(html).toContain('<span class="hljs-keyword">package</span>')
+    expect(html).toContain('<span class="hljs-keyword">func</span>')
+  })
+
+  it("should number every line from 1 to N", () => {
+    const html = buildCodeHtml(goFixture, goSource, { lineNumbers: true })
+    const lineNumbers = [...html.matchAll(/<td class="line-number">(\d+)<\/td>/g)].map((m) =>
+      Number(m[1])
+    )
+    const lineCount = goSource.split("\n").length
+
+    expect(lineNumbers).toEqual(Array.from({ length: lineCount }, (_, i) => i + 1))
+  })
+
+  it("should repeat the filename header on every page", () => {
+    const html = buildCodeHtml(goFixture, goSource, { lineNumbers: true })
+
+    expect(html).toMatch(/<thead>\s*<tr><th class="filepath" colspan="2">[^<]*handler\.go<\/th>/)
+    expect(html).toContain("display: table-header-group")
+  })
+
+  it("should span the header across a single column without line numbers", () => {
+    const html = buildCodeHtml(goFixture, goSource, { lineNumbers: false })
+
+    expect(html).toContain('colspan="1"')
+    expect(html).not.toContain('class="line-number"')
+  })
+
+  it("should fall back to escaped plain text for unknown extensions", () => {
+    const html = buildCodeHtml("notes.unknown", "if (a < b && c) { return }", {
+      lineNumbers: true,
+    })
+
+    expect(html).toContain("if (a &lt; b &amp;&amp; c) { return }")
+    expect(html).not.toContain('<span class="hljs-')
+  })
+
+  it("should print header and footer templates in the page margins", () => {
+    const html = buildCodeHtml(goFixture, goSource, {
+      header: "{filename}||{date}",
+      footer: "Page {page} of {pages}",
+    })
+
+    expect(html).toContain('@top-left { content: "handler.go"; }')
+    expect(html).toMatch(/@top-right \{ content: "\d{4}-\d{2}-\d{2}"; \}/)
+    expect(html).toContain('@bottom-left { content: "Page " counter(page) " of " counter(pages); }')
+    expect(html).not.toContain('class="filepath"')
+  })
+
+  it("should keep the filename table header when only a footer is set", () => {
+    const html = buildCodeHtml(goFixture, goSource, { footer: "{page}" })
+
+    expect(html).toContain('class="filepath"')
+    expect(html).not.toContain("@top-left {")
+  })
+})
+
 describe("renderCodeToPdf", () => {
   it("should render a simple JavaScript file to PDF", async () => {
     // Create a simple test file in the test tmp directory
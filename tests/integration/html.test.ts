@@ -0,0 +1,47 @@
+/**
+ * @fileoverview Integration tests for sandboxed HTML rendering with Chrome
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { cleanupRenderedPdf } from "../../src/utils.js"
+
+// Mock config to allow access to test directory
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      chromePath: "",
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import { renderHtmlToPdf } from "../../src/renderers/html.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures", "html")
+
+describe("renderHtmlToPdf", () => {
+  it("should render a report with its local image to one Letter page", async () => {
+    const { pdfPath, renderType } = await renderHtmlToPdf(join(fixturesDir, "report.html"))
+    try {
+      expect(renderType).toBe("html → PDF")
+      const pdf = readFileSync(pdfPath, "latin1")
+      expect([...pdf.matchAll(/\/Type\s*\/Page\b/g)]).toHaveLength(1)
+      expect(pdf).toMatch(/\/MediaBox\s*\[\s*0 0 612 792\s*\]/)
+      // The inlined chart is drawn; the remote logo is blocked
+      expect([...pdf.matchAll(/\/Subtype\s*\/Image\b/g)]).toHaveLength(1)
+    } finally {
+      cleanupRenderedPdf(pdfPath)
+    }
+  })
+})
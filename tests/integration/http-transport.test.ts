@@ -0,0 +1,184 @@
+/**
+ * @fileoverview Integration tests for the Streamable HTTP transport.
+ * Starts the server on an ephemeral port and performs MCP round trips over HTTP.
+ */
+
+import { describe, it, expect, beforeAll, afterAll } from "vitest"
+import type { Server } from "http"
+import type { AddressInfo } from "net"
+import { LATEST_PROTOCOL_VERSION } from "@modelcontextprotocol/sdk/types.js"
+import { config } from "../../src/config.js"
+import { reapIdleSessions, startHttpServer, MCP_ENDPOINT } from "../../src/http-server.js"
+import { createMcpServer } from "../../src/server.js"
+import { clientLabel, getSession } from "../../src/sessions.js"
+
+interface JsonRpcResponse {
+  jsonrpc: "2.0"
+  id: number | null
+  result?: Record<string, unknown>
+  error?: { code: number; message: string }
+}
+
+describe("Streamable HTTP transport", () => {
+  let server: Server
+  let endpoint: string
+
+  beforeAll(async () => {
+    server = await startHttpServer(createMcpServer, { host: "127.0.0.1", port: 0 })
+    endpoint = `http://127.0.0.1:${(server.address() as AddressInfo).port}${MCP_ENDPOINT}`
+  })
+
+  afterAll(async () => {
+    server.closeAllConnections()
+    await new Promise((resolve) => server.close(resolve))
+  })
+
+  function post(message: object, sessionId?: string) {
+    return fetch(endpoint, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        Accept: "application/json, text/event-stream",
+        ...(sessionId
+          ? { "Mcp-Session-Id": sessionId, "Mcp-Protocol-Version": LATEST_PROTOCOL_VERSION }
+          : {}),
+      },
+      body: JSON.stringify({ jsonrpc: "2.0", ...message }),
+    })
+  }
+
+  /**
+   * Reads a JSON-RPC response from a JSON or SSE response body.
+   */
+  async function readResponse(response: Response): Promise<JsonRpcResponse> {
+    const text = await response.text()
+    if (response.headers.get("content-type")?.includes("text/event-stream")) {
+      const data = text
+        .split("\n")
+        .filter((line) => line.startsWith("data: "))
+        .map((line) => line.slice("data: ".length))
+      return JSON.parse(data[data.length - 1])
+    }
+    return JSON.parse(text)
+  }
+
+  async function initialize(clientInfo = { name: "integration-test", version: "1.0.0" }) {
+    const response = await post({
+      id: 1,
+      method: "initialize",
+      params: {
+        protocolVersion: LATEST_PROTOCOL_VERSION,
+        capabilities: {},
+        clientInfo,
+      },
+    })
+    expect(response.status).toBe(200)
+
+    const sessionId = response.headers.get("mcp-session-id")
+    expect(sessionId).toBeTruthy()
+    const { result } = await readResponse(response)
+    expect(result?.serverInfo).toMatchObject({ name: "mcp-printer" })
+
+    const initialized = await post({ method: "notifications/initialized" }, sessionId!)
+    expect(initialized.status).toBe(202)
+    return sessionId!
+  }
+
+  it("should initialize, list tools, and call a tool", async () => {
+    const sessionId = await initialize()
+
+    const list = await readResponse(await post({ id: 2, method: "tools/list" }, sessionId))
+    const tools = (list.result?.tools as Array<{ name: string }>).map((tool) => tool.name)
+    expect(tools).toEqual(expect.arrayContaining(["get_config", "list_printers", "print_file"]))
+
+    const call = await readResponse(
+      await post(
+        { id: 3, method: "tools/call", params: { name: "get_config", arguments: {} } },
+        sessionId
+      )
+    )
+    const content = call.result?.content as Array<{ type: string; text: string }>
+    expect(content[0].text).toContain("Current MCP Printer Configuration")
+  })
+
+  it("should keep sessions separate", async () => {
+    const first = await initialize()
+    const second = await initialize()
+
+    expect(first).not.toBe(second)
+  })
+
+  it("should record the client each session declared", async () => {
+    const first = await initialize({ name: "alice-desktop", version: "1.0.0" })
+    const second = await initialize({ name: "bob-laptop", version: "2.1.0" })
+
+    expect(clientLabel(first)).toBe("alice-desktop 1.0.0")
+    expect(clientLabel(second)).toBe("bob-laptop 2.1.0")
+  })
+
+  it("should close sessions idle longer than the TTL", async () => {
+    const idle = await initialize()
+    const active = await initialize()
+    // As if its last request came just over the TTL ago
+    getSession(idle)!.lastActiveAt -= config.sessionTtlMinutes * 60 * 1000 + 1
+
+    expect(await reapIdleSessions(server)).toEqual([idle])
+    expect(getSession(idle)).toBeUndefined()
+    expect((await post({ id: 2, method: "tools/list" }, idle)).status).toBe(404)
+    expect((await post({ id: 2, method: "tools/list" }, active)).status).toBe(200)
+  })
+
+  it("should keep a session with an open SSE stream, however long it is quiet", async () => {
+    const sessionId = await initialize()
+    const ttlMs = config.sessionTtlMinutes * 60 * 1000
+    const listening = new AbortController()
+    const stream = await fetch(endpoint, {
+      method: "GET",
+      headers: {
+        Accept: "text/event-stream",
+        "Mcp-Session-Id": sessionId,
+        "Mcp-Protocol-Version": LATEST_PROTOCOL_VERSION,
+      },
+      signal: listening.signal,
+    })
+    expect(stream.status).toBe(200)
+
+    getSession(sessionId)!.lastActiveAt -= ttlMs + 1
+    expect(await reapIdleSessions(server)).toEqual([])
+    expect((await post({ id: 2, method: "tools/list" }, sessionId)).status).toBe(200)
+
+    // Once the stream closes, the session is idle from then on
+    listening.abort()
+    await stream.body?.cancel().catch(() => {})
+    await new Promise((resolve) => setTimeout(resolve, 50))
+    expect(await reapIdleSessions(server)).toEqual([])
+    getSession(sessionId)!.lastActiveAt -= ttlMs + 1
+    expect(await reapIdleSessions(server)).toEqual([sessionId])
+  })
+
+  it("should reject requests without a session", async () => {
+    const response = await post({ id: 1, method: "tools/list" })
+
+    expect(response.status).toBe(400)
+    expect((await readResponse(response)).error?.message).toMatch(/no valid session ID/)
+  })
+
+  it("should reject unknown and terminated sessions", async () => {
+    const sessionId = await initialize()
+
+    const deleted = await fetch(endpoint, {
+      method: "DELETE",
+      headers: { "Mcp-Session-Id": sessionId, "Mcp-Protocol-Version": LATEST_PROTOCOL_VERSION },
+    })
+    expect(deleted.status).toBe(200)
+
+    const response = await post({ id: 2, method: "tools/list" }, sessionId)
+    expect(response.status).toBe(404)
+  })
+
+  it("should only serve the MCP endpoint", async () => {
+    const response = await fetch(endpoint.replace(MCP_ENDPOINT, "/other"))
+
+    expect(response.status).toBe(404)
+  })
+})
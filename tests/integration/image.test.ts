@@ -0,0 +1,74 @@
+/**
+ * @fileoverview Integration tests for image rendering with Chrome (checks rendered PDF page sizes)
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { cleanupRenderedPdf } from "../../src/utils.js"
+
+// Mock config to allow access to test directory
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      chromePath: "",
+      imageMarginMm: 6,
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import { renderImageToPdf, type RenderImageOptions } from "../../src/renderers/image.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures", "images")
+
+/**
+ * Reads the page MediaBoxes (in points) from a PDF written by Chrome.
+ */
+function pageSizes(pdfPath: string): Array<{ width: number; height: number }> {
+  const pdf = readFileSync(pdfPath, "latin1")
+  return [...pdf.matchAll(/\/MediaBox\s*\[\s*0 0 ([\d.]+) ([\d.]+)\s*\]/g)].map((match) => ({
+    width: Math.round(parseFloat(match[1])),
+    height: Math.round(parseFloat(match[2])),
+  }))
+}
+
+describe("renderImageToPdf", () => {
+  const cases: Array<{
+    file: string
+    options: RenderImageOptions
+    expected: { width: number; height: number }
+  }> = [
+    { file: "landscape.png", options: {}, expected: { width: 792, height: 612 } },
+    { file: "portrait.gif", options: { media: "A4" }, expected: { width: 595, height: 842 } },
+    // Stored 32x16 but EXIF orientation 6 displays it 16x32, so the page is portrait
+    { file: "exif-rotated.jpg", options: {}, expected: { width: 612, height: 792 } },
+    {
+      file: "landscape.png",
+      options: { orientation: "portrait", fit: "fill", media: "Legal" },
+      expected: { width: 612, height: 1008 },
+    },
+    { file: "square.webp", options: { fit: "actual-size" }, expected: { width: 612, height: 792 } },
+  ]
+
+  for (const { file, options, expected } of cases) {
+    const size = `${expected.width}x${expected.height}pt`
+    it(`should render ${file} ${JSON.stringify(options)} to one ${size} page`, async () => {
+      const pdfPath = await renderImageToPdf(join(fixturesDir, file), options)
+      try {
+        expect(pageSizes(pdfPath)).toEqual([expected])
+      } finally {
+        cleanupRenderedPdf(pdfPath)
+      }
+    })
+  }
+})
@@ -0,0 +1,81 @@
+/**
+ * @fileoverview Integration tests for N-up imposition with Chrome (checks the imposed PDF's sheets)
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { calculatePhysicalSheets, cleanupRenderedPdf, getPdfPageCount } from "../../src/utils.js"
+
+// Mock config to allow access to test directory
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderCode: true,
+      chromePath: "",
+      header: "",
+      footer: "",
+      code: {
+        excludeExtensions: [],
+        colorScheme: "atom-one-light",
+        enableLineNumbers: true,
+        fontSize: "10pt",
+        lineSpacing: "1.5",
+      },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import { renderCodeToPdf } from "../../src/renderers/code.js"
+import { imposeIppJob } from "../../src/renderers/n-up.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+
+/**
+ * Reads the page MediaBoxes (in points) from a PDF written by Chrome.
+ */
+function pageSizes(pdfPath: string): Array<{ width: number; height: number }> {
+  const pdf = readFileSync(pdfPath, "latin1")
+  return [...pdf.matchAll(/\/MediaBox\s*\[\s*0 0 ([\d.]+) ([\d.]+)\s*\]/g)].map((match) => ({
+    width: Math.round(parseFloat(match[1])),
+    height: Math.round(parseFloat(match[2])),
+  }))
+}
+
+describe("N-up imposition", () => {
+  it("should print handler.go 2-up duplex on a single physical sheet", async () => {
+    const renderedPdf = await renderCodeToPdf(join(fixturesDir, "handler.go"))
+    let imposedPdf: string | null = null
+    try {
+      const { job } = await imposeIppJob({
+        printer: "ipp://printer.local/ipp/print",
+        filePath: renderedPdf,
+        options: ["sides=two-sided-long-edge", "media=Letter", "number-up=2"],
+      })
+      imposedPdf = job.filePath ?? null
+
+      expect(imposedPdf).not.toBe(renderedPdf)
+      expect(job.options).toEqual(["sides=two-sided-long-edge", "media=Letter"])
+
+      const sides = await getPdfPageCount(imposedPdf ?? "")
+      expect(sides).toBe(Math.ceil((await getPdfPageCount(renderedPdf)) / 2))
+      expect(calculatePhysicalSheets(sides, true)).toBe(1)
+      expect(pageSizes(imposedPdf ?? "")).toEqual(
+        Array.from({ length: sides }, () => ({ width: 792, height: 612 }))
+      )
+    } finally {
+      cleanupRenderedPdf(imposedPdf)
+      cleanupRenderedPdf(renderedPdf)
+    }
+  })
+})
@@ -0,0 +1,43 @@
+/**
+ * @fileoverview Integration tests for converting office documents with LibreOffice.
+ * They run only when MCP_PRINTER_TEST_LIBREOFFICE is set to LibreOffice's soffice executable
+ * (e.g., MCP_PRINTER_TEST_LIBREOFFICE=/usr/bin/soffice pnpm run test:integration).
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { PdfDocument } from "../../src/pdf/document.js"
+import { cleanupRenderedPdf } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    libreofficePath: process.env.MCP_PRINTER_TEST_LIBREOFFICE ?? "",
+    convertTimeoutSeconds: 60,
+    maxConcurrentRenders: 2,
+  },
+}))
+
+import { getOfficeConverter, renderOfficeToPdf } from "../../src/renderers/office.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures", "office")
+
+describe.skipIf(!process.env.MCP_PRINTER_TEST_LIBREOFFICE)("renderOfficeToPdf", () => {
+  it("should convert a Word document and an OpenDocument text at the same time", async () => {
+    const documents = [join(fixturesDir, "budget.docx"), join(fixturesDir, "minutes.odt")]
+
+    const pdfs = await Promise.all(
+      documents.map((document) => renderOfficeToPdf(document, getOfficeConverter(document)))
+    )
+    try {
+      for (const pdf of pdfs) {
+        expect(new PdfDocument(readFileSync(pdf)).getPages()).toHaveLength(1)
+      }
+      expect(pdfs[0]).toMatch(/budget\.pdf$/)
+      expect(pdfs[1]).toMatch(/minutes\.pdf$/)
+    } finally {
+      pdfs.forEach(cleanupRenderedPdf)
+    }
+  })
+})
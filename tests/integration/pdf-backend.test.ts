@@ -0,0 +1,95 @@
+/**
+ * @fileoverview Integration tests for printing end to end through the virtual PDF printer.
+ * The print, status, release, and cancel handlers run with MCP_PRINTER_BACKEND=pdf, so the
+ * jobs go through the queue and the job history without a CUPS install.
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll, afterEach } from "vitest"
+import { existsSync, mkdtempSync, readFileSync, rmSync } from "fs"
+import { tmpdir } from "os"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { config } from "../../src/config.js"
+import { listRecentJobs } from "../../src/job-history.js"
+import { getPrintJobStatus } from "../../src/job-queue.js"
+import { handleCancel, handlePrint, handleRelease } from "../../src/tools/batch-helpers.js"
+
+const document = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures", "pdfs", "form.pdf")
+
+/** Waits for a job to reach a state. */
+async function waitForState(jobId: string, state: string) {
+  await vi.waitFor(async () => expect((await getPrintJobStatus(jobId)).state).toBe(state), {
+    timeout: 5000,
+  })
+  return getPrintJobStatus(jobId)
+}
+
+describe("printing to the virtual PDF printer", () => {
+  let tempDir = ""
+  const original = { ...config }
+
+  beforeAll(() => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-pdf-integration-"))
+    Object.assign(config, {
+      backend: "pdf",
+      pdfOutputDir: join(tempDir, "printed"),
+      pdfJobDelaySeconds: 0.2,
+      historyFile: join(tempDir, "history.json"),
+      allowedPaths: [dirname(document)],
+      deniedPaths: [],
+      allowedPrinters: [],
+      defaultPrinter: "",
+      defaultOptions: [],
+      confirmIfOverPages: 0,
+      maxJobsPerHour: 0,
+      maxPagesPerDay: 0,
+      coverPage: false,
+    })
+  })
+
+  afterEach(() => {
+    config.pdfJobDelaySeconds = 0.2
+  })
+
+  afterAll(() => {
+    Object.assign(config, original)
+    rmSync(tempDir, { recursive: true, force: true })
+  })
+
+  it("should write the document and complete the job, recording it in the history", async () => {
+    const result = await handlePrint({ file_path: document, printer: "Virtual_PDF" })
+    expect(result).toMatchObject({ success: true, job_id: expect.stringMatching(/^queue#/) })
+
+    const status = await waitForState(result.job_id!, "completed")
+    expect(status.job_id).toMatch(/^Virtual_PDF-\d+$/)
+    const printed = join(config.pdfOutputDir, `${status.job_id}-form.pdf`)
+    expect(readFileSync(printed)).toEqual(readFileSync(document))
+
+    expect(await listRecentJobs(10)).toContainEqual(
+      expect.objectContaining({
+        job_id: status.job_id,
+        printer: "Virtual_PDF",
+        status: "completed",
+      })
+    )
+  })
+
+  it("should hold a job until it is released", async () => {
+    const result = await handlePrint({ file_path: document, hold: true })
+
+    await waitForState(result.job_id!, "held")
+    const released = await handleRelease(result.job_id!)
+    expect(released.content[0].text).toMatch(/^✓ Released job Virtual_PDF-\d+/)
+    await waitForState(result.job_id!, "completed")
+  })
+
+  it("should cancel a job that hasn't finished, removing its file", async () => {
+    config.pdfJobDelaySeconds = 60
+    const result = await handlePrint({ file_path: document })
+    const status = await waitForState(result.job_id!, "pending")
+
+    expect(await handleCancel({ job_id: result.job_id })).toMatchObject({ success: true })
+    expect((await getPrintJobStatus(result.job_id!)).state).toBe("canceled")
+    expect(existsSync(join(config.pdfOutputDir, `${status.job_id}-form.pdf`))).toBe(false)
+  })
+})
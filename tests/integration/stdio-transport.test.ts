@@ -0,0 +1,78 @@
+/**
+ * @fileoverview Integration tests for the stdio transport.
+ * Runs tool calls over stdio with debug logging on, checking that the log never reaches stdout,
+ * where it would corrupt the JSON-RPC stream.
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { PassThrough } from "stream"
+import { StdioServerTransport } from "@modelcontextprotocol/sdk/server/stdio.js"
+import { LATEST_PROTOCOL_VERSION } from "@modelcontextprotocol/sdk/types.js"
+import { config } from "../../src/config.js"
+import { createMcpServer } from "../../src/server.js"
+
+interface JsonRpcFrame {
+  jsonrpc: "2.0"
+  id?: number
+  method?: string
+}
+
+describe("stdio transport", () => {
+  it("should write only JSON-RPC frames to stdout during tool calls", async () => {
+    const written: string[] = []
+    const write = vi.spyOn(process.stdout, "write").mockImplementation((chunk) => {
+      written.push(String(chunk))
+      return true
+    })
+    vi.spyOn(console, "error").mockImplementation(() => {})
+    const logLevel = config.logLevel
+    config.logLevel = "debug"
+
+    const frames = () =>
+      written
+        .join("")
+        .split("\n")
+        .filter((line) => line.length > 0)
+    const stdin = new PassThrough()
+    const send = (message: object) =>
+      stdin.write(`${JSON.stringify({ jsonrpc: "2.0", ...message })}\n`)
+
+    const server = createMcpServer()
+    try {
+      await server.connect(new StdioServerTransport(stdin, process.stdout))
+      send({
+        id: 1,
+        method: "initialize",
+        params: {
+          protocolVersion: LATEST_PROTOCOL_VERSION,
+          capabilities: {},
+          clientInfo: { name: "integration-test", version: "1.0.0" },
+        },
+      })
+      send({ method: "notifications/initialized" })
+      send({ id: 2, method: "logging/setLevel", params: { level: "debug" } })
+      send({ id: 3, method: "tools/call", params: { name: "get_config", arguments: {} } })
+      send({ id: 4, method: "tools/call", params: { name: "list_printers", arguments: {} } })
+
+      await vi.waitFor(
+        () => {
+          const ids = frames().map((line) => (JSON.parse(line) as JsonRpcFrame).id)
+          expect(ids).toContain(3)
+          expect(ids).toContain(4)
+        },
+        { timeout: 10_000 }
+      )
+    } finally {
+      await server.close()
+      write.mockRestore()
+      config.logLevel = logLevel
+    }
+
+    const parsed = frames().map((line) => JSON.parse(line) as JsonRpcFrame)
+    for (const frame of parsed) {
+      expect(frame.jsonrpc).toBe("2.0")
+    }
+    // The log was sent to the client as notifications, not written to stdout as text
+    expect(parsed.some((frame) => frame.method === "notifications/message")).toBe(true)
+  })
+})
@@ -0,0 +1,96 @@
+/**
+ * @fileoverview Unit tests for printing backend selection, run against mock backends
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { config } from "../../src/config.js"
+import { listPrinters, submitLpJob } from "../../src/cups.js"
+import { listWindowsPrinters, submitWindowsJob } from "../../src/windows.js"
+import { getBackend, selectBackendName } from "../../src/backend.js"
+import { submitPrintJob } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "auto",
+    allowedPrinters: [],
+    defaultPrinter: "",
+    defaultOptions: [],
+  },
+}))
+
+vi.mock("../../src/cups.js", () => ({
+  submitLpJob: vi.fn().mockResolvedValue("Office_HP-1"),
+  listPrinters: vi.fn().mockResolvedValue([]),
+  getJobStatus: vi.fn(),
+  cancelJob: vi.fn(),
+  cancelAllJobs: vi.fn(),
+  printerFromJobId: (jobId: string) => jobId.slice(0, jobId.lastIndexOf("-")),
+}))
+
+vi.mock("../../src/windows.js", () => ({
+  submitWindowsJob: vi.fn().mockResolvedValue("Office HP-7"),
+  listWindowsPrinters: vi.fn().mockResolvedValue([]),
+  getWindowsJobStatus: vi.fn(),
+  cancelWindowsJob: vi.fn(),
+  cancelAllWindowsJobs: vi.fn(),
+}))
+
+describe("selectBackendName", () => {
+  const cases: Array<{ setting?: string; platform: NodeJS.Platform; expected: string }> = [
+    { setting: "auto", platform: "win32", expected: "windows" },
+    { setting: "auto", platform: "darwin", expected: "cups" },
+    { setting: "auto", platform: "linux", expected: "cups" },
+    { setting: "", platform: "win32", expected: "windows" },
+    { setting: undefined, platform: "linux", expected: "cups" },
+    { setting: "cups", platform: "win32", expected: "cups" },
+    { setting: "Windows", platform: "linux", expected: "windows" },
+    { setting: "pdf", platform: "win32", expected: "pdf" },
+  ]
+
+  for (const { setting, platform, expected } of cases) {
+    it(`should pick ${expected} for "${setting}" on ${platform}`, () => {
+      expect(selectBackendName(setting, platform)).toBe(expected)
+    })
+  }
+
+  it("should reject unknown backends", () => {
+    expect(() => selectBackendName("lpr", "linux")).toThrow(
+      'Unknown printing backend "lpr". Set MCP_PRINTER_BACKEND to auto, cups, windows, or pdf.'
+    )
+  })
+})
+
+describe("getBackend", () => {
+  beforeEach(() => {
+    vi.mocked(submitLpJob).mockClear()
+    vi.mocked(submitWindowsJob).mockClear()
+  })
+
+  it("should route jobs to the Windows spooler when configured", async () => {
+    config.backend = "windows"
+
+    expect(getBackend().name).toBe("windows")
+    expect(await submitPrintJob({ printer: "Office HP", filePath: "report.pdf" })).toBe(
+      "Office HP-7"
+    )
+    expect(submitWindowsJob).toHaveBeenCalledWith(
+      { printer: "Office HP", filePath: "report.pdf" },
+      undefined
+    )
+    expect(submitLpJob).not.toHaveBeenCalled()
+
+    await getBackend().listPrinters()
+    expect(listWindowsPrinters).toHaveBeenCalled()
+  })
+
+  it("should route jobs to CUPS when configured", async () => {
+    config.backend = "cups"
+
+    expect(getBackend().name).toBe("cups")
+    expect(await submitPrintJob({ printer: "Office_HP", content: "hello" })).toBe("Office_HP-1")
+    expect(submitWindowsJob).not.toHaveBeenCalled()
+
+    await getBackend().listPrinters()
+    expect(listPrinters).toHaveBeenCalled()
+  })
+})
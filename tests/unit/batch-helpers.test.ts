@@ -0,0 +1,206 @@
+/**
+ * @fileoverview Unit tests for batch operation handlers
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { execa } from "execa"
+import {
+  formatErrorResult,
+  formatPrintResults,
+  handleCancel,
+  handleRelease,
+} from "../../src/tools/batch-helpers.js"
+import { PrinterError } from "../../src/errors.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+/**
+ * Mocks lpstat job queries and records cancel invocations.
+ */
+function mockCups(activeJobs: string, completedJobs: string) {
+  vi.mocked(execa).mockImplementation(((command: string, args: string[]) => {
+    if (command === "lpstat") {
+      return Promise.resolve({
+        exitCode: 0,
+        stdout: args.includes("completed") ? completedJobs : activeJobs,
+        stderr: "",
+      })
+    }
+    return Promise.resolve({ exitCode: 0, stdout: "", stderr: "" })
+  }) as never)
+}
+
+const ACTIVE_JOB = `Office_HP-42  steve  1024  Mon Jan  1 10:00:00 2024
+	Alerts: none
+	queued for Office_HP`
+
+const COMPLETED_JOB = `Office_HP-41  steve  1024  Mon Jan  1 09:00:00 2024
+	Alerts: job-completed-successfully
+	queued for Office_HP`
+
+function cancelCalls() {
+  return vi.mocked(execa).mock.calls.filter(([command]) => String(command) === "cancel")
+}
+
+describe("handleCancel", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+    mockCups(ACTIVE_JOB, COMPLETED_JOB)
+  })
+
+  it("should cancel a pending job with the cancel command", async () => {
+    const result = await handleCancel({ job_id: "42" })
+
+    expect(result.success).toBe(true)
+    expect(result.state).toBe("pending")
+    expect(cancelCalls()).toHaveLength(1)
+    expect(cancelCalls()[0][1]).toEqual(["Office_HP-42"])
+  })
+
+  it("should report a job that was never submitted as not existing", async () => {
+    const result = await handleCancel({ job_id: "Office_HP-999" })
+
+    expect(result.success).toBe(false)
+    expect(result.state).toBe("not-found")
+    expect(result.error).toContain("does not exist")
+    expect(cancelCalls()).toHaveLength(0)
+  })
+
+  it("should report a job that already completed without calling cancel", async () => {
+    const result = await handleCancel({ job_id: "Office_HP-41" })
+
+    expect(result.success).toBe(false)
+    expect(result.state).toBe("completed")
+    expect(result.error).toContain("already completed")
+    expect(cancelCalls()).toHaveLength(0)
+  })
+
+  it("should cancel all jobs for a printer", async () => {
+    const result = await handleCancel({ printer: "Office_HP", cancel_all: true })
+
+    expect(result.success).toBe(true)
+    expect(cancelCalls()[0][1]).toEqual(["-a", "Office_HP"])
+  })
+
+  it("should reject a request without job_id or cancel_all", async () => {
+    const result = await handleCancel({ printer: "Office_HP" })
+
+    expect(result.success).toBe(false)
+    expect(result.message).toBe("Invalid parameters")
+  })
+})
+
+describe("handleRelease", () => {
+  const HELD_JOB = `Office_HP-43  steve  1024  Mon Jan  1 10:05:00 2024
+	Alerts: job-hold-until-specified
+	queued for Office_HP`
+
+  const releaseCalls = () =>
+    vi.mocked(execa).mock.calls.filter(([command]) => String(command) === "lp")
+
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+    mockCups(`${ACTIVE_JOB}\n${HELD_JOB}`, COMPLETED_JOB)
+  })
+
+  it("should release a held job with lp -H resume", async () => {
+    const result = await handleRelease("43")
+
+    expect(result.isError).toBeUndefined()
+    expect(result.content[0].text).toContain("Released job Office_HP-43")
+    expect(releaseCalls()[0][1]).toEqual(["-i", "Office_HP-43", "-H", "resume"])
+  })
+
+  it("should leave jobs that aren't held alone and say why", async () => {
+    const pending = await handleRelease("Office_HP-42")
+    const completed = await handleRelease("Office_HP-41")
+
+    expect(pending.isError).toBeUndefined()
+    expect(pending.content[0].text).toContain("not held (it is pending)")
+    expect(completed.content[0].text).toContain("already completed; nothing to release")
+    expect(releaseCalls()).toHaveLength(0)
+  })
+
+  it("should report a job that doesn't exist as an error", async () => {
+    const result = await handleRelease("Office_HP-999")
+
+    expect(result.isError).toBe(true)
+    expect(result.content[0].text).toContain("does not exist")
+  })
+})
+
+describe("handleCancel errors", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should report a forbidden cancel with a code and suggestion", async () => {
+    const forbidden = "cancel: cancel-job failed: You don't own job ID 42."
+    vi.mocked(execa).mockImplementation(((command: string) =>
+      Promise.resolve(
+        command === "cancel"
+          ? { exitCode: 1, stdout: "", stderr: forbidden }
+          : { exitCode: 0, stdout: ACTIVE_JOB, stderr: "" }
+      )) as never)
+
+    const result = await handleCancel({ job_id: "42" })
+
+    expect(result.success).toBe(false)
+    expect(result.code).toBe("PERMISSION_DENIED")
+    expect(result.suggestion).toBeTruthy()
+  })
+})
+
+describe("formatErrorResult", () => {
+  it("should include the code and suggestion of a PrinterError", () => {
+    const result = formatErrorResult(
+      new PrinterError("PRINTER_NOT_FOUND", "lp failed: The printer or class does not exist.")
+    )
+
+    expect(result.isError).toBe(true)
+    expect(result.content[0].text).toMatch(/^✗ lp failed/)
+    expect(result.content[0].text).toContain("Code: PRINTER_NOT_FOUND")
+    expect(result.content[0].text).toMatch(/Suggestion: Run list_printers/)
+    expect(result.structuredContent).toEqual({
+      code: "PRINTER_NOT_FOUND",
+      message: "lp failed: The printer or class does not exist.",
+      suggestion: expect.stringMatching(/list_printers/),
+    })
+  })
+
+  it("should report other errors as plain text", () => {
+    const result = formatErrorResult(new Error("copies must be at least 1"))
+
+    expect(result.content[0].text).toBe("✗ copies must be at least 1")
+    expect(result.structuredContent).toBeUndefined()
+  })
+})
+
+describe("formatPrintResults", () => {
+  it("should list coded failures in the text and structured content", () => {
+    const result = formatPrintResults([
+      {
+        success: false,
+        file_path: "/tmp/missing.pdf",
+        message: "Failed to print: File not found: /tmp/missing.pdf",
+        error: "File not found: /tmp/missing.pdf",
+        code: "FILE_NOT_FOUND",
+        suggestion: "Check the file path.",
+      },
+    ])
+
+    expect(result.isError).toBe(true)
+    expect(result.content[0].text).toContain("Code: FILE_NOT_FOUND")
+    expect(result.content[0].text).toContain("Suggestion: Check the file path.")
+    expect(result.structuredContent?.errors).toEqual([
+      {
+        file_path: "/tmp/missing.pdf",
+        code: "FILE_NOT_FOUND",
+        message: "File not found: /tmp/missing.pdf",
+        suggestion: "Check the file path.",
+      },
+    ])
+  })
+})
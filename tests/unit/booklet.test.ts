@@ -0,0 +1,214 @@
+/**
+ * @fileoverview Unit tests for booklet imposition (pages two to a sheet side, in signature order)
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { existsSync, readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures, with plain text sent as it is
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderMarkdown: true,
+      autoRenderCode: true,
+      autoRenderText: false,
+      fallbackOnRenderError: false,
+      header: "",
+      footer: "",
+      code: { excludeExtensions: [] },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import {
+  bookletSides,
+  describeBooklet,
+  imposeBooklet,
+  placePage,
+  validateBookletOptions,
+} from "../../src/renderers/booklet.js"
+import { PdfDocument, PdfStream, isDict } from "../../src/pdf/document.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+const fixture = (name: string) => join(fixturesDir, "pdfs", name)
+
+/**
+ * Reads the forms drawn on a sheet side: the page they show, the text of the page's content,
+ * and where the form is moved to on the sheet.
+ */
+function placements(document: PdfDocument, pageIndex: number) {
+  const page = document.getPages()[pageIndex]
+  const contents = document.resolve(page.dict.get("Contents") ?? null)
+  const content =
+    contents instanceof PdfStream ? document.decodeStream(contents).toString("latin1") : ""
+  const resources = document.resolve(page.dict.get("Resources") ?? null)
+  const xobjects = isDict(resources) ? document.resolve(resources.get("XObject") ?? null) : null
+
+  return [...content.matchAll(/^q (.+) cm \/(P\d+) Do Q$/gm)].map(([, matrix, name]) => {
+    const form = isDict(xobjects) ? document.resolve(xobjects.get(name) ?? null) : null
+    return {
+      name,
+      offset: Number(matrix.split(" ")[4]),
+      text: form instanceof PdfStream ? document.decodeStream(form).toString("latin1") : "",
+    }
+  })
+}
+
+describe("bookletSides", () => {
+  it("should pad six pages to eight and lay them out in signature order", () => {
+    expect(bookletSides(6)).toEqual([
+      [null, 1],
+      [2, null],
+      [6, 3],
+      [4, 5],
+    ])
+  })
+
+  it("should put a single page on a sheet of its own", () => {
+    expect(bookletSides(1)).toEqual([
+      [null, 1],
+      [null, null],
+    ])
+  })
+
+  it("should put the middle pages on the back of the last sheet", () => {
+    const sides = bookletSides(12)
+    expect(sides).toHaveLength(6)
+    expect(sides[0]).toEqual([12, 1])
+    expect(sides.at(-1)).toEqual([6, 7])
+  })
+})
+
+describe("imposeBooklet", () => {
+  it("should impose six pages on two landscape sheets in signature order", () => {
+    const booklet = imposeBooklet(readFileSync(fixture("six-pages.pdf")))
+    const document = new PdfDocument(booklet.data)
+
+    expect(booklet).toMatchObject({ pages: 6, slots: 8, sheets: 2 })
+    expect(document.getPages()).toHaveLength(4)
+    for (const page of document.getPages()) {
+      expect(page.dict.get("MediaBox")).toEqual([0, 0, 792, 612])
+    }
+
+    const sides = [0, 1, 2, 3].map((index) =>
+      placements(document, index).map(({ name, offset }) => [name, offset < 396 ? "left" : "right"])
+    )
+    expect(sides).toEqual([
+      [["P1", "right"]],
+      [["P2", "left"]],
+      [
+        ["P6", "left"],
+        ["P3", "right"],
+      ],
+      [
+        ["P4", "left"],
+        ["P5", "right"],
+      ],
+    ])
+  })
+
+  it("should copy each page's content into its form", () => {
+    const document = new PdfDocument(imposeBooklet(readFileSync(fixture("six-pages.pdf"))).data)
+    const forms = [0, 1, 2, 3].flatMap((index) => placements(document, index))
+
+    for (const { name, text } of forms) {
+      expect(text).toContain(`(Page ${name.slice(1)}) Tj`)
+    }
+    // Page 6 is drawn with two content streams, joined into one form
+    expect(forms.find(({ name }) => name === "P6")?.text).toContain("72 680 Td\n\n(Page 6) Tj")
+  })
+
+  it("should use the media size for the sheets", () => {
+    const booklet = imposeBooklet(readFileSync(fixture("six-pages.pdf")), { media: "A4" })
+    const [page] = new PdfDocument(booklet.data).getPages()
+    expect(page.dict.get("MediaBox")).toEqual([0, 0, 841.89, 595.28])
+  })
+
+  it("should refuse a file that isn't a readable PDF", () => {
+    expect(() =>
+      imposeBooklet(Buffer.from("%PDF-1.4\nnot really\n"), {}, "broken.pdf")
+    ).toThrow("Cannot print broken.pdf as a booklet")
+  })
+})
+
+describe("placePage", () => {
+  it("should fit an upright page to its half of the sheet", () => {
+    expect(placePage({ box: [0, 0, 612, 792], rotate: 0 }, [396, 0, 396, 612])).toEqual([
+      396 / 612,
+      0,
+      0,
+      396 / 612,
+      396,
+      (612 - 792 * (396 / 612)) / 2,
+    ])
+  })
+
+  it("should turn a page with a /Rotate of 90", () => {
+    // Shown landscape (792 x 612), so it's half as big and centered top to bottom
+    expect(placePage({ box: [0, 0, 612, 792], rotate: 90 }, [0, 0, 396, 612])).toEqual([
+      0, -0.5, 0.5, 0, 0, 459,
+    ])
+  })
+})
+
+describe("validateBookletOptions", () => {
+  it("should accept short-edge duplex or none given", () => {
+    expect(() => validateBookletOptions({})).not.toThrow()
+    expect(() => validateBookletOptions({ duplex: "short-edge", number_up: 1 })).not.toThrow()
+  })
+
+  it("should refuse options that conflict with a booklet", () => {
+    expect(() => validateBookletOptions({ duplex: "long-edge" })).toThrow(
+      'Invalid duplex "long-edge" for a booklet'
+    )
+    expect(() => validateBookletOptions({ number_up: 2 })).toThrow(
+      "Invalid number_up (2) for a booklet"
+    )
+    expect(() => validateBookletOptions({ page_ranges: "1-4" })).toThrow(
+      "Cannot print page_ranges as a booklet"
+    )
+  })
+})
+
+describe("describeBooklet", () => {
+  it("should say how many sheets to fold, and how", () => {
+    expect(describeBooklet(1)).toMatch(/^1 sheet: .*fold along the long edge/)
+    expect(describeBooklet(2)).toMatch(/^2 sheets: /)
+  })
+})
+
+describe("prepareFileForPrinting", () => {
+  it("should impose a PDF as a booklet and remove it on cleanup", async () => {
+    const result = await prepareFileForPrinting({
+      filePath: fixture("six-pages.pdf"),
+      booklet: true,
+    })
+    try {
+      expect(result.renderType).toBe("booklet")
+      expect(result.bookletSheets).toBe(2)
+      expect(result.actualFilePath).not.toBe(fixture("six-pages.pdf"))
+      expect(new PdfDocument(readFileSync(result.actualFilePath)).getPages()).toHaveLength(4)
+    } finally {
+      cleanupRenderedPdf(result.renderedPdf)
+    }
+    expect(existsSync(result.actualFilePath)).toBe(false)
+  })
+
+  it("should refuse a file that is printed as text", async () => {
+    await expect(
+      prepareFileForPrinting({ filePath: join(fixturesDir, "notes.txt"), booklet: true })
+    ).rejects.toThrow("Cannot print notes.txt as a booklet: it is printed as text")
+  })
+})
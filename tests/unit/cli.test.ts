@@ -0,0 +1,52 @@
+/**
+ * @fileoverview Unit tests for command-line argument parsing
+ */
+
+import { describe, it, expect } from "vitest"
+import { parseCliArgs, parseListenAddress } from "../../src/cli.js"
+
+describe("parseCliArgs", () => {
+  it("should default to the stdio transport", () => {
+    expect(parseCliArgs([])).toEqual({
+      transport: "stdio",
+      listen: { host: "127.0.0.1", port: 8080 },
+    })
+  })
+
+  it("should parse the HTTP transport and listen address", () => {
+    expect(parseCliArgs(["--transport=http", "--listen=:9000"])).toEqual({
+      transport: "http",
+      listen: { port: 9000 },
+    })
+  })
+
+  it("should reject unknown transports", () => {
+    expect(() => parseCliArgs(["--transport=websocket"])).toThrow(/Invalid --transport/)
+  })
+
+  it("should reject unknown arguments", () => {
+    expect(() => parseCliArgs(["--port=8080"])).toThrow()
+  })
+})
+
+describe("parseListenAddress", () => {
+  const cases = [
+    { listen: ":8080", expected: { port: 8080 } },
+    { listen: "8080", expected: { port: 8080 } },
+    { listen: "0.0.0.0:631", expected: { host: "0.0.0.0", port: 631 } },
+    { listen: "printserver.local:8080", expected: { host: "printserver.local", port: 8080 } },
+    { listen: "[::1]:8080", expected: { host: "::1", port: 8080 } },
+  ]
+
+  for (const { listen, expected } of cases) {
+    it(`should parse "${listen}"`, () => {
+      expect(parseListenAddress(listen)).toEqual(expected)
+    })
+  }
+
+  for (const listen of ["", "localhost", ":0", ":70000", "host:port"]) {
+    it(`should reject "${listen}"`, () => {
+      expect(() => parseListenAddress(listen)).toThrow(/Invalid --listen address/)
+    })
+  }
+})
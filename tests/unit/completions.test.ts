@@ -0,0 +1,136 @@
+/**
+ * @fileoverview Unit tests for printer name and media size completion, against a fake backend
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { config } from "../../src/config.js"
+import { getPrinterInfo, type PrinterCapabilities } from "../../src/printer-info.js"
+import { completeMediaSizes, completePrinterNames } from "../../src/completions.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    allowedPrinters: [],
+  },
+}))
+
+const listPrinters = vi.fn()
+
+vi.mock("../../src/backend.js", () => ({
+  getBackend: vi.fn(() => ({ listPrinters })),
+}))
+
+vi.mock("../../src/printer-info.js", () => ({
+  getPrinterInfo: vi.fn(),
+}))
+
+/** Starts each test a minute after the last, so nothing cached by one is seen by the next. */
+let now = new Date("2026-10-14T09:00:00Z").getTime()
+
+/**
+ * Moves the clock on by a number of milliseconds.
+ */
+function advance(ms: number) {
+  now += ms
+  vi.setSystemTime(new Date(now))
+}
+
+/**
+ * Capabilities of a printer with the given media sizes.
+ */
+function printerWithMedia(mediaSizes: string[]): PrinterCapabilities {
+  return {
+    printer: "Office_HP",
+    source: "cups",
+    state: "idle",
+    state_reasons: [],
+    accepting_jobs: true,
+    duplex: true,
+    duplex_modes: ["none", "long-edge"],
+    color: false,
+    quality_levels: [],
+    media_sizes: mediaSizes,
+    resolutions: [],
+  }
+}
+
+beforeEach(() => {
+  vi.useFakeTimers({ toFake: ["Date"] })
+  advance(60_000)
+  vi.mocked(config).allowedPrinters = []
+  listPrinters.mockReset()
+  listPrinters.mockResolvedValue(
+    ["Office_HP", "office_color", "Accounting_HP"].map((name) => ({
+      name,
+      description: name,
+      is_default: false,
+      state: "idle",
+      accepting_jobs: true,
+    }))
+  )
+  vi.mocked(getPrinterInfo).mockReset()
+})
+
+afterEach(() => {
+  vi.useRealTimers()
+})
+
+describe("completePrinterNames", () => {
+  it("should complete printer names case-insensitively", async () => {
+    expect(await completePrinterNames("off")).toEqual(["Office_HP", "office_color"])
+    expect(await completePrinterNames(undefined)).toHaveLength(3)
+  })
+
+  it("should only suggest allowed printers", async () => {
+    vi.mocked(config).allowedPrinters = ["Office_HP", "Accounting_HP"]
+    expect(await completePrinterNames("")).toEqual(["Office_HP", "Accounting_HP"])
+  })
+
+  it("should suggest nothing when printers can't be listed", async () => {
+    listPrinters.mockRejectedValue(new Error("lpstat: scheduler not responding"))
+    expect(await completePrinterNames("off")).toEqual([])
+  })
+
+  it("should list the printers once every few seconds", async () => {
+    await completePrinterNames("o")
+    await completePrinterNames("of")
+    advance(4_999)
+    await completePrinterNames("off")
+    expect(listPrinters).toHaveBeenCalledTimes(1)
+
+    advance(1)
+    await completePrinterNames("offi")
+    expect(listPrinters).toHaveBeenCalledTimes(2)
+  })
+
+  it("should list the printers again after a listing fails", async () => {
+    listPrinters.mockRejectedValueOnce(new Error("lpstat: scheduler not responding"))
+    expect(await completePrinterNames("off")).toEqual([])
+    expect(await completePrinterNames("off")).toEqual(["Office_HP", "office_color"])
+    expect(listPrinters).toHaveBeenCalledTimes(2)
+  })
+})
+
+describe("completeMediaSizes", () => {
+  it("should suggest the sizes the printer supports", async () => {
+    vi.mocked(getPrinterInfo).mockResolvedValue(printerWithMedia(["letter", "A4", "Tabloid"]))
+
+    expect(await completeMediaSizes("", "Office_HP")).toEqual(["A4", "Letter"])
+    expect(await completeMediaSizes("l", "Office_HP")).toEqual(["Letter"])
+    expect(getPrinterInfo).toHaveBeenCalledTimes(1)
+    expect(getPrinterInfo).toHaveBeenCalledWith("Office_HP")
+  })
+
+  it("should suggest every size without a printer", async () => {
+    expect(await completeMediaSizes(undefined)).toEqual(["A4", "Letter", "Legal"])
+    expect(await completeMediaSizes("le", " ")).toEqual(["Letter", "Legal"])
+    expect(getPrinterInfo).not.toHaveBeenCalled()
+  })
+
+  it("should suggest every size when the printer's sizes aren't known", async () => {
+    vi.mocked(getPrinterInfo).mockRejectedValueOnce(new Error('Printer "Gone" not found'))
+    expect(await completeMediaSizes("", "Gone")).toEqual(["A4", "Letter", "Legal"])
+
+    vi.mocked(getPrinterInfo).mockResolvedValue(printerWithMedia([]))
+    expect(await completeMediaSizes("", "Office_HP")).toEqual(["A4", "Letter", "Legal"])
+  })
+})
@@ -2,10 +2,20 @@
  * @fileoverview Unit tests for configuration parsing
  */
 
-import { describe, it, expect } from "vitest"
-import { homedir } from "os"
+import { describe, it, expect, afterEach } from "vitest"
+import { mkdtempSync, writeFileSync, rmSync } from "fs"
+import { homedir, tmpdir } from "os"
 import { join } from "path"
-import { config, MARKDOWN_EXTENSIONS } from "../../src/config.js"
+import {
+  config,
+  loadConfigFile,
+  MARKDOWN_EXTENSIONS,
+  parseAllowedPaths,
+  parseCoverPageMode,
+  parseCupsEncryption,
+  parseLogLevel,
+  parseQuotaScope,
+} from "../../src/config.js"
 
 describe("config", () => {
   it("should have markdown extensions defined", () => {
@@ -26,10 +36,12 @@ describe("config", () => {
     expect(typeof config.fallbackOnRenderError).toBe("boolean")
     expect(typeof config.autoRenderMarkdown).toBe("boolean")
     expect(typeof config.autoRenderCode).toBe("boolean")
+    expect(typeof config.autoRenderText).toBe("boolean")
   })
 
   it("should have array configs", () => {
     // Test that array configs are actually arrays
+    expect(Array.isArray(config.allowedPrinters)).toBe(true)
     expect(Array.isArray(config.defaultOptions)).toBe(true)
     expect(Array.isArray(config.allowedPaths)).toBe(true)
     expect(Array.isArray(config.deniedPaths)).toBe(true)
@@ -69,6 +81,135 @@ describe("config", () => {
     expect(config.confirmIfOverPages).toBeGreaterThanOrEqual(0)
   })
 
+  it("should refuse private URLs by default", () => {
+    if (!process.env.MCP_PRINTER_ALLOW_PRIVATE_URLS) {
+      expect(config.allowPrivateUrls).toBe(false)
+    }
+    expect(config.urlTimeoutSeconds).toBeGreaterThan(0)
+    expect(config.urlMaxSizeMb).toBeGreaterThan(0)
+  })
+
+  it("should accept print_data documents up to 20 MB by default", () => {
+    if (!process.env.MCP_PRINTER_MAX_UPLOAD_BYTES) {
+      expect(config.maxUploadBytes).toBe(20 * 1024 * 1024)
+    }
+  })
+
+  it("should have numeric submission and status timeouts", () => {
+    expect(typeof config.submitTimeoutSeconds).toBe("number")
+    expect(typeof config.statusTimeoutSeconds).toBe("number")
+    expect(config.submitTimeoutSeconds).toBeGreaterThanOrEqual(0)
+    expect(config.statusTimeoutSeconds).toBeGreaterThanOrEqual(0)
+  })
+
+  it("should retry transient submission failures by default", () => {
+    if (!process.env.MCP_PRINTER_MAX_RETRIES) {
+      expect(config.maxRetries).toBe(3)
+    }
+    expect(config.retryDelaySeconds).toBeGreaterThan(0)
+  })
+
+  it("should log at info to stderr by default", () => {
+    if (!process.env.MCP_PRINTER_LOG_LEVEL) {
+      expect(config.logLevel).toBe("info")
+    }
+    if (!process.env.MCP_PRINTER_LOG_FILE) {
+      expect(config.logFile).toBe("")
+    }
+  })
+
+  it("should have no print quotas by default", () => {
+    if (!process.env.MCP_PRINTER_MAX_JOBS_PER_HOUR) {
+      expect(config.maxJobsPerHour).toBe(0)
+    }
+    if (!process.env.MCP_PRINTER_MAX_PAGES_PER_DAY) {
+      expect(config.maxPagesPerDay).toBe(0)
+    }
+  })
+
+  it("should count quotas globally and close sessions idle for an hour by default", () => {
+    if (!process.env.MCP_PRINTER_QUOTA_SCOPE) {
+      expect(config.quotaScope).toBe("global")
+    }
+    if (!process.env.MCP_PRINTER_SESSION_TTL_MINUTES) {
+      expect(config.sessionTtlMinutes).toBe(60)
+    }
+  })
+
+  it("should rate-limit sessions and recognize duplicate jobs by default", () => {
+    if (!process.env.MCP_PRINTER_MAX_JOBS_PER_MINUTE) {
+      expect(config.maxJobsPerMinute).toBe(50)
+    }
+    if (!process.env.MCP_PRINTER_DEDUPE_WINDOW_SECONDS) {
+      expect(config.dedupeWindowSeconds).toBe(60)
+    }
+  })
+
+  it("should print no cover pages by default", () => {
+    if (!process.env.MCP_PRINTER_COVER_PAGE) {
+      expect(config.coverPage).toBe(false)
+    }
+    if (!process.env.MCP_PRINTER_COVER_PAGE_MODE) {
+      expect(config.coverPageMode).toBe("generate")
+    }
+  })
+
+  it("should keep temp files in one work directory, swept after 24 hours, up to 2 GB", () => {
+    if (!process.env.MCP_PRINTER_TEMP_DIR) {
+      expect(config.tempDir).toBe(join(tmpdir(), "mcp-printer"))
+    }
+    if (!process.env.MCP_PRINTER_TEMP_MAX_AGE_HOURS) {
+      expect(config.tempMaxAgeHours).toBe(24)
+    }
+    if (!process.env.MCP_PRINTER_TEMP_MAX_MB) {
+      expect(config.tempMaxMb).toBe(2048)
+    }
+  })
+
+  it("should use the local CUPS server by default", () => {
+    if (!process.env.MCP_PRINTER_CUPS_SERVER) {
+      expect(config.cupsServer).toBe("")
+    }
+    if (!process.env.MCP_PRINTER_CUPS_ENCRYPTION) {
+      expect(config.cupsEncryption).toBe("ifrequested")
+    }
+  })
+
+  it("should allow no printers raw jobs by default", () => {
+    if (!process.env.MCP_PRINTER_RAW_ALLOWED_PRINTERS) {
+      expect(config.rawAllowedPrinters).toEqual([])
+    }
+  })
+
+  it("should have no office converter by default, with a conversion timeout", () => {
+    if (!process.env.MCP_PRINTER_LIBREOFFICE_PATH) {
+      expect(config.libreofficePath).toBe("")
+    }
+    if (!process.env.MCP_PRINTER_CONVERT_TIMEOUT_SECONDS) {
+      expect(config.convertTimeoutSeconds).toBe(120)
+    }
+  })
+
+  it("should wait 10 seconds for work in flight at shutdown by default", () => {
+    if (!process.env.MCP_PRINTER_SHUTDOWN_TIMEOUT_SECONDS) {
+      expect(config.shutdownTimeoutSeconds).toBe(10)
+    }
+  })
+
+  it("should write virtual PDF jobs to a temp directory, taking 2 seconds each, by default", () => {
+    if (!process.env.MCP_PRINTER_PDF_OUTPUT_DIR) {
+      expect(config.pdfOutputDir).toBe(join(tmpdir(), "mcp-printer-pdf"))
+    }
+    if (!process.env.MCP_PRINTER_PDF_JOB_DELAY_SECONDS) {
+      expect(config.pdfJobDelaySeconds).toBe(2)
+    }
+  })
+
+  it("should have a numeric image margin", () => {
+    expect(typeof config.imageMarginMm).toBe("number")
+    expect(config.imageMarginMm).toBeGreaterThanOrEqual(0)
+  })
+
   it("should have code rendering configs", () => {
     expect(typeof config.code.colorScheme).toBe("string")
     expect(typeof config.code.autoLineNumbers).toBe("boolean")
@@ -91,6 +232,17 @@ describe("config", () => {
     expect(config.code.lineSpacing).toMatch(/^\d+(\.\d+)?$/)
   })
 
+  it("should default to exactly the standard user directories when no roots are configured", () => {
+    const homeDir = homedir()
+    if (!process.env.MCP_PRINTER_ALLOWED_PATHS) {
+      expect(config.allowedPaths).toEqual([
+        join(homeDir, "Documents"),
+        join(homeDir, "Downloads"),
+        join(homeDir, "Desktop"),
+      ])
+    }
+  })
+
   it("should not include entire home directory in allowedPaths by default", () => {
     const homeDir = homedir()
     // Should NOT contain the home directory itself (only subdirectories)
@@ -99,3 +251,294 @@ describe("config", () => {
     }
   })
 })
+
+describe("loadConfigFile", () => {
+  let tempDir: string | undefined
+
+  function writeConfig(contents: string): string {
+    tempDir ??= mkdtempSync(join(tmpdir(), "mcp-printer-config-test-"))
+    const filePath = join(tempDir, "config.json")
+    writeFileSync(filePath, contents, "utf-8")
+    return filePath
+  }
+
+  afterEach(() => {
+    if (tempDir) {
+      rmSync(tempDir, { recursive: true, force: true })
+      tempDir = undefined
+    }
+  })
+
+  it("should return no settings when no file is configured", () => {
+    expect(loadConfigFile(undefined)).toEqual({})
+    expect(loadConfigFile("")).toEqual({})
+  })
+
+  it("should load default_printer and allowed_printers", () => {
+    const filePath = writeConfig(
+      JSON.stringify({ default_printer: "Office_HP", allowed_printers: ["Office_HP", "Home"] })
+    )
+
+    expect(loadConfigFile(filePath)).toEqual({
+      default_printer: "Office_HP",
+      allowed_printers: ["Office_HP", "Home"],
+    })
+  })
+
+  it("should load allowed_paths", () => {
+    const filePath = writeConfig('{ "allowed_paths": ["~/Reports", "/srv/shared"] }')
+
+    expect(loadConfigFile(filePath)).toEqual({ allowed_paths: ["~/Reports", "/srv/shared"] })
+    expect(() => loadConfigFile(writeConfig('{ "allowed_paths": "/srv/shared" }'))).toThrow(
+      /"allowed_paths" must be an array of paths/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "allowed_paths": ["/srv", 42] }'))).toThrow(
+      /"allowed_paths" must be an array of paths/
+    )
+  })
+
+  it("should load allow_private_urls", () => {
+    expect(loadConfigFile(writeConfig('{ "allow_private_urls": true }'))).toEqual({
+      allow_private_urls: true,
+    })
+  })
+
+  it("should load log_level and log_file", () => {
+    const filePath = writeConfig('{ "log_level": "debug", "log_file": "/tmp/printer.log" }')
+
+    expect(loadConfigFile(filePath)).toEqual({ log_level: "debug", log_file: "/tmp/printer.log" })
+  })
+
+  it("should load max_pages_per_job and absolute_max_pages", () => {
+    const filePath = writeConfig('{ "max_pages_per_job": 20, "absolute_max_pages": 100 }')
+
+    expect(loadConfigFile(filePath)).toEqual({ max_pages_per_job: 20, absolute_max_pages: 100 })
+  })
+
+  it("should load max_jobs_per_hour and max_pages_per_day", () => {
+    const filePath = writeConfig('{ "max_jobs_per_hour": 5, "max_pages_per_day": 40 }')
+
+    expect(loadConfigFile(filePath)).toEqual({ max_jobs_per_hour: 5, max_pages_per_day: 40 })
+  })
+
+  it("should load quota_scope and session_ttl_minutes", () => {
+    const filePath = writeConfig('{ "quota_scope": "session", "session_ttl_minutes": 15 }')
+
+    expect(loadConfigFile(filePath)).toEqual({ quota_scope: "session", session_ttl_minutes: 15 })
+  })
+
+  it("should load max_jobs_per_minute and dedupe_window_seconds", () => {
+    const filePath = writeConfig('{ "max_jobs_per_minute": 10, "dedupe_window_seconds": 0 }')
+
+    expect(loadConfigFile(filePath)).toEqual({ max_jobs_per_minute: 10, dedupe_window_seconds: 0 })
+  })
+
+  it("should load max_upload_bytes", () => {
+    const filePath = writeConfig('{ "max_upload_bytes": 1048576 }')
+
+    expect(loadConfigFile(filePath)).toEqual({ max_upload_bytes: 1048576 })
+  })
+
+  it("should load cover_page, cover_page_mode, and job_owner", () => {
+    const filePath = writeConfig(
+      '{ "cover_page": true, "cover_page_mode": "job-sheets", "job_owner": "Front desk" }'
+    )
+
+    expect(loadConfigFile(filePath)).toEqual({
+      cover_page: true,
+      cover_page_mode: "job-sheets",
+      job_owner: "Front desk",
+    })
+  })
+
+  it("should load libreoffice_path", () => {
+    const filePath = writeConfig('{ "libreoffice_path": "/usr/bin/soffice" }')
+
+    expect(loadConfigFile(filePath)).toEqual({ libreoffice_path: "/usr/bin/soffice" })
+  })
+
+  it("should load raw_allowed_printers", () => {
+    const filePath = writeConfig('{ "raw_allowed_printers": ["Zebra_Labels"] }')
+
+    expect(loadConfigFile(filePath)).toEqual({ raw_allowed_printers: ["Zebra_Labels"] })
+  })
+
+  it("should load cups_server and cups_encryption", () => {
+    const filePath = writeConfig(
+      '{ "cups_server": "printserver.example.com:631", "cups_encryption": "always" }'
+    )
+
+    expect(loadConfigFile(filePath)).toEqual({
+      cups_server: "printserver.example.com:631",
+      cups_encryption: "always",
+    })
+    expect(() => loadConfigFile(writeConfig('{ "cups_encryption": "required" }'))).toThrow(
+      /"cups_encryption" must be one of never, ifrequested, always/
+    )
+  })
+
+  it("should load temp_dir, temp_max_age_hours, and temp_max_mb", () => {
+    const filePath = writeConfig(
+      '{ "temp_dir": "/srv/mcp-temp", "temp_max_age_hours": 6, "temp_max_mb": 512 }'
+    )
+
+    expect(loadConfigFile(filePath)).toEqual({
+      temp_dir: "/srv/mcp-temp",
+      temp_max_age_hours: 6,
+      temp_max_mb: 512,
+    })
+    expect(() => loadConfigFile(writeConfig('{ "temp_max_mb": "1G" }'))).toThrow(
+      /"temp_max_mb" must be a number/
+    )
+  })
+
+  it("should load backend and pdf_output_dir", () => {
+    const filePath = writeConfig('{ "backend": "pdf", "pdf_output_dir": "/srv/printed" }')
+
+    expect(loadConfigFile(filePath)).toEqual({ backend: "pdf", pdf_output_dir: "/srv/printed" })
+  })
+
+  it("should reject malformed JSON", () => {
+    const filePath = writeConfig("{ default_printer: ")
+
+    expect(() => loadConfigFile(filePath)).toThrow(/Failed to load config file/)
+  })
+
+  it("should reject fields of the wrong type", () => {
+    expect(() => loadConfigFile(writeConfig('{ "allowed_printers": "Office_HP" }'))).toThrow(
+      /"allowed_printers" must be an array/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "default_printer": 42 }'))).toThrow(
+      /"default_printer" must be a string/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "allow_private_urls": "yes" }'))).toThrow(
+      /"allow_private_urls" must be true or false/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "auth_token": 1234 }'))).toThrow(
+      /"auth_token" must be a string/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "max_concurrent_renders": 1.5 }'))).toThrow(
+      /"max_concurrent_renders" must be a whole number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "log_level": "verbose" }'))).toThrow(
+      /"log_level" must be one of debug, info, warn, error/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "max_pages_per_job": "20" }'))).toThrow(
+      /"max_pages_per_job" must be a whole number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "absolute_max_pages": 99.5 }'))).toThrow(
+      /"absolute_max_pages" must be a whole number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "max_pages_per_day": "40" }'))).toThrow(
+      /"max_pages_per_day" must be a whole number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "quota_scope": "client" }'))).toThrow(
+      /"quota_scope" must be one of global, session/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "session_ttl_minutes": "15" }'))).toThrow(
+      /"session_ttl_minutes" must be a number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "max_jobs_per_minute": 2.5 }'))).toThrow(
+      /"max_jobs_per_minute" must be a whole number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "dedupe_window_seconds": "60" }'))).toThrow(
+      /"dedupe_window_seconds" must be a number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "max_upload_bytes": "20MB" }'))).toThrow(
+      /"max_upload_bytes" must be a whole number/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "cover_page_mode": "banner" }'))).toThrow(
+      /"cover_page_mode" must be one of generate, job-sheets/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "libreoffice_path": true }'))).toThrow(
+      /"libreoffice_path" must be a string/
+    )
+    expect(() => loadConfigFile(writeConfig('{ "backend": ["pdf"] }'))).toThrow(
+      /"backend" must be a string/
+    )
+  })
+})
+
+describe("parseLogLevel", () => {
+  it("should parse log levels case-insensitively, accepting warning for warn", () => {
+    expect(parseLogLevel("DEBUG", "info")).toBe("debug")
+    expect(parseLogLevel("warning", "info")).toBe("warn")
+    expect(parseLogLevel("error", "info")).toBe("error")
+  })
+
+  it("should fall back when unset", () => {
+    expect(parseLogLevel(undefined, "warn")).toBe("warn")
+    expect(parseLogLevel("", "info")).toBe("info")
+  })
+
+  it("should reject unknown levels", () => {
+    expect(() => parseLogLevel("verbose", "info")).toThrow(
+      /Invalid MCP_PRINTER_LOG_LEVEL "verbose"/
+    )
+  })
+})
+
+describe("parseCoverPageMode", () => {
+  it("should parse cover page modes, falling back when unset", () => {
+    expect(parseCoverPageMode("Job-Sheets", "generate")).toBe("job-sheets")
+    expect(parseCoverPageMode(undefined, "job-sheets")).toBe("job-sheets")
+  })
+
+  it("should reject unknown modes", () => {
+    expect(() => parseCoverPageMode("banner", "generate")).toThrow(
+      /Invalid MCP_PRINTER_COVER_PAGE_MODE "banner"/
+    )
+  })
+})
+
+describe("parseCupsEncryption", () => {
+  it("should parse encryption settings, falling back when unset", () => {
+    expect(parseCupsEncryption("IfRequested", "never")).toBe("ifrequested")
+    expect(parseCupsEncryption(undefined, "always")).toBe("always")
+  })
+
+  it("should reject unknown settings", () => {
+    expect(() => parseCupsEncryption("tls", "ifrequested")).toThrow(
+      /Invalid MCP_PRINTER_CUPS_ENCRYPTION "tls"/
+    )
+  })
+})
+
+describe("parseQuotaScope", () => {
+  it("should parse quota scopes, falling back when unset", () => {
+    expect(parseQuotaScope("Session", "global")).toBe("session")
+    expect(parseQuotaScope(undefined, "session")).toBe("session")
+  })
+
+  it("should reject unknown scopes", () => {
+    expect(() => parseQuotaScope("client", "global")).toThrow(
+      /Invalid MCP_PRINTER_QUOTA_SCOPE "client"/
+    )
+  })
+})
+
+describe("parseAllowedPaths", () => {
+  const home = homedir()
+
+  it("should use the config file's paths when MCP_PRINTER_ALLOWED_PATHS is unset", () => {
+    expect(parseAllowedPaths(undefined, ["~/Reports", "/srv/shared"])).toEqual([
+      join(home, "Reports"),
+      "/srv/shared",
+    ])
+    expect(parseAllowedPaths("", ["$HOME/Reports"])).toEqual([join(home, "Reports")])
+  })
+
+  it("should prefer MCP_PRINTER_ALLOWED_PATHS to the config file", () => {
+    expect(parseAllowedPaths("~/Scans:/srv/print", ["/srv/shared"])).toEqual([
+      join(home, "Scans"),
+      "/srv/print",
+    ])
+  })
+
+  it("should fall back to the default directories when neither lists a path", () => {
+    const defaults = [join(home, "Documents"), join(home, "Downloads"), join(home, "Desktop")]
+    expect(parseAllowedPaths(undefined)).toEqual(defaults)
+    expect(parseAllowedPaths(undefined, [])).toEqual(defaults)
+    expect(parseAllowedPaths(undefined, ["", "  "])).toEqual(defaults)
+  })
+})
@@ -0,0 +1,164 @@
+/**
+ * @fileoverview Unit tests for cover pages
+ */
+
+import { describe, it, expect, vi, afterEach } from "vitest"
+import { readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { config } from "../../src/config.js"
+import {
+  addCoverPage,
+  buildCoverPageContent,
+  coverPageMode,
+  coverPageOwner,
+  shiftPageRanges,
+  type CoverPageInfo,
+} from "../../src/renderers/cover-page.js"
+import { PdfDocument, PdfStream } from "../../src/pdf/document.js"
+import { cleanupRenderedPdf } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    coverPage: false,
+    coverPageMode: "generate",
+    jobOwner: "",
+  },
+}))
+
+const backend = vi.hoisted(() => ({ name: "cups" }))
+
+vi.mock("../../src/backend.js", () => ({
+  getBackend: () => backend,
+}))
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+// A five-page PDF
+const pdf = join(fixturesDir, "pdfs", "linearized.pdf")
+
+const hex = (text: string) => `<${Buffer.from(text, "latin1").toString("hex").toUpperCase()}>`
+
+const info: CoverPageInfo = {
+  owner: "Dana",
+  title: "report.pdf",
+  queuedAt: new Date(2026, 9, 14, 9, 5),
+  source: "/home/dana/Documents/report.pdf",
+  pages: 5,
+  copies: 2,
+}
+
+describe("buildCoverPageContent", () => {
+  it("should show the owner, title, time queued, source, and page count", () => {
+    const content = buildCoverPageContent(info, [0, 0, 612, 792])
+
+    expect(content).toContain(hex("Dana"))
+    expect(content).toContain(hex("report.pdf"))
+    expect(content).toContain(hex("Queued: 2026-10-14 09:05"))
+    expect(content).toContain(hex("Source: /home/dana/Documents/report.pdf"))
+    expect(content).toContain(hex("Pages: 5 pages \xd7 2 copies"))
+  })
+
+  it("should cut long lines short and leave out a missing source", () => {
+    const content = buildCoverPageContent(
+      { ...info, title: "x".repeat(200), source: undefined, pages: 1, copies: 1 },
+      [0, 0, 612, 792]
+    )
+
+    expect(content).toMatch(/<(78)+85>/)
+    expect(content).not.toContain(hex("Source:"))
+    expect(content).toContain(hex("Pages: 1 page"))
+  })
+})
+
+describe("shiftPageRanges", () => {
+  it("should keep the pages in front and move the ranges past them", () => {
+    expect(shiftPageRanges("1-3,7", 1)).toBe("1,2-4,8")
+    expect(shiftPageRanges("2", 4)).toBe("1-4,6")
+  })
+})
+
+describe("addCoverPage", () => {
+  const pagesOf = (filePath: string) => new PdfDocument(readFileSync(filePath)).getPages()
+  let coverPdf: string | null = null
+
+  afterEach(() => {
+    cleanupRenderedPdf(coverPdf)
+    coverPdf = null
+  })
+
+  it("should put the cover in front of the document", async () => {
+    const covered = await addCoverPage({ printer: "Office_HP", filePath: pdf, options: [] }, info)
+    coverPdf = covered.coverPdf
+
+    expect(covered.job.filePath).toBe(coverPdf)
+    const document = new PdfDocument(readFileSync(coverPdf))
+    const pages = document.getPages()
+    expect(pages).toHaveLength(6)
+    const content = document.resolve(pages[0].dict.get("Contents") ?? null) as PdfStream
+    expect(document.decodeStream(content).toString("latin1")).toContain(hex("Dana"))
+  })
+
+  it("should fill the cover's sheet with blank pages and move the page ranges", async () => {
+    const covered = await addCoverPage(
+      {
+        printer: "Office_HP",
+        filePath: pdf,
+        options: ["sides=two-sided-long-edge", "number-up=2", "page-ranges=2-3"],
+      },
+      info
+    )
+    coverPdf = covered.coverPdf
+
+    expect(pagesOf(coverPdf)).toHaveLength(4 + 5)
+    expect(pagesOf(coverPdf)[1].dict.has("Contents")).toBe(false)
+    expect(covered.job.options).toEqual([
+      "sides=two-sided-long-edge",
+      "number-up=2",
+      "page-ranges=1-4,6-7",
+    ])
+  })
+
+  it("should refuse a PDF it can't read", async () => {
+    await expect(
+      addCoverPage({ filePath: join(fixturesDir, "notes.txt"), options: [] }, info)
+    ).rejects.toMatchObject({ code: "UNSUPPORTED_FORMAT" })
+  })
+})
+
+describe("coverPageMode", () => {
+  afterEach(() => {
+    config.coverPage = false
+    config.coverPageMode = "generate"
+    backend.name = "cups"
+  })
+
+  it("should follow MCP_PRINTER_COVER_PAGE unless cover_page is given", () => {
+    expect(coverPageMode("Office_HP", undefined)).toBeUndefined()
+    expect(coverPageMode("Office_HP", true)).toBe("generate")
+    config.coverPage = true
+    expect(coverPageMode("Office_HP", undefined)).toBe("generate")
+    expect(coverPageMode("Office_HP", false)).toBeUndefined()
+  })
+
+  it("should use job-sheets only for printers reached through CUPS", () => {
+    config.coverPageMode = "job-sheets"
+
+    expect(coverPageMode("Office_HP", true)).toBe("job-sheets")
+    expect(coverPageMode(undefined, true)).toBe("job-sheets")
+    expect(coverPageMode("ipp://printer.local/ipp/print", true)).toBe("generate")
+    backend.name = "windows"
+    expect(coverPageMode("Office_HP", true)).toBe("generate")
+  })
+})
+
+describe("coverPageOwner", () => {
+  afterEach(() => {
+    config.jobOwner = ""
+  })
+
+  it("should name MCP_PRINTER_JOB_OWNER, or the user running the server", () => {
+    expect(coverPageOwner().length).toBeGreaterThan(0)
+    config.jobOwner = "Front desk"
+    expect(coverPageOwner()).toBe("Front desk")
+  })
+})
@@ -0,0 +1,538 @@
+/**
+ * @fileoverview Unit tests for CUPS command output parsing
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { execa } from "execa"
+import { readFileSync } from "fs"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import {
+  cancelJob,
+  cupsEnv,
+  parseLpstatPrinters,
+  parseLpoptions,
+  getPrinterOptions,
+  listPrinters,
+  parseJobId,
+  printerFromJobId,
+  submitLpJob,
+  parseLpstatJobs,
+  inferJobState,
+  getJobStatus,
+} from "../../src/cups.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+const MULTI_PRINTER_OUTPUT = `printer Office_HP_LaserJet is idle.  enabled since Mon Jan  1 10:00:00 2024
+	Form mounted:
+	Content types: any
+	Printer types: unknown
+	Description: Office HP LaserJet
+	Alerts: none
+	Location: 2nd Floor
+	Connection: direct
+printer Home-Canon now printing Home-Canon-42.  enabled since Mon Jan  1 09:00:00 2024
+	Form mounted:
+	Description: Home Canon Pixma
+	Alerts: job-printing
+printer Label_Printer disabled since Mon Jan  1 08:00:00 2024 -
+	Paused
+	Form mounted:
+	Description:
+	Alerts: paused
+Office_HP_LaserJet accepting requests since Mon Jan  1 10:00:00 2024
+Home-Canon accepting requests since Mon Jan  1 09:00:00 2024
+Label_Printer not accepting requests since Mon Jan  1 08:00:00 2024 -
+	Paused
+system default destination: Office_HP_LaserJet`
+
+describe("parseLpstatPrinters", () => {
+  it("should parse multiple printers with descriptions and states", () => {
+    const printers = parseLpstatPrinters(MULTI_PRINTER_OUTPUT)
+
+    expect(printers).toHaveLength(3)
+    expect(printers[0]).toEqual({
+      name: "Office_HP_LaserJet",
+      description: "Office HP LaserJet",
+      is_default: true,
+      state: "idle",
+      accepting_jobs: true,
+      location: "2nd Floor",
+    })
+    expect(printers[1]).toMatchObject({
+      name: "Home-Canon",
+      description: "Home Canon Pixma",
+      is_default: false,
+      state: "printing",
+      accepting_jobs: true,
+    })
+    expect(printers[2]).toMatchObject({
+      name: "Label_Printer",
+      description: "Label_Printer",
+      state: "stopped",
+      accepting_jobs: false,
+      state_message: "Paused",
+    })
+  })
+
+  it("should collect printer state reasons from the Alerts line", () => {
+    const printers = parseLpstatPrinters(MULTI_PRINTER_OUTPUT)
+
+    expect(printers[0]).not.toHaveProperty("state_reasons")
+    expect(printers[2].state_reasons).toEqual(["paused"])
+    expect(
+      parseLpstatPrinters(
+        "printer Office_HP is idle.  enabled since today\n" +
+          "\tAlerts: media-empty-error toner-low-report"
+      )[0].state_reasons
+    ).toEqual(["media-empty-error", "toner-low-report"])
+  })
+
+  it("should keep underscore-escaped names intact", () => {
+    const printers = parseLpstatPrinters(
+      "printer Brother_HL_L2350DW_series is idle.  enabled since today\n" +
+        "\tDescription: Brother HL-L2350DW series"
+    )
+
+    expect(printers[0].name).toBe("Brother_HL_L2350DW_series")
+    expect(printers[0].description).toBe("Brother HL-L2350DW series")
+  })
+
+  it("should report no default when none is configured", () => {
+    const printers = parseLpstatPrinters(
+      "printer Office_HP is idle.  enabled since today\nno system default destination"
+    )
+
+    expect(printers).toHaveLength(1)
+    expect(printers[0].is_default).toBe(false)
+  })
+
+  it("should return an empty list for empty output", () => {
+    expect(parseLpstatPrinters("")).toEqual([])
+  })
+})
+
+describe("listPrinters", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should return an empty list when no destinations are added", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 1,
+      stdout: "",
+      stderr: "lpstat: No destinations added.",
+    } as never)
+
+    await expect(listPrinters()).resolves.toEqual([])
+  })
+
+  it("should throw when lpstat fails for another reason", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 1,
+      stdout: "",
+      stderr: "lpstat: Unable to connect to server",
+    } as never)
+
+    await expect(listPrinters()).rejects.toThrow(/Unable to connect to server/)
+  })
+
+  it("should parse printers from lpstat output", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 0,
+      stdout: MULTI_PRINTER_OUTPUT,
+      stderr: "",
+    } as never)
+
+    const printers = await listPrinters()
+    expect(printers.map((p) => p.name)).toEqual([
+      "Office_HP_LaserJet",
+      "Home-Canon",
+      "Label_Printer",
+    ])
+  })
+})
+
+describe("parseLpoptions", () => {
+  const fixture = (name: string) =>
+    readFileSync(join(process.cwd(), "tests", "fixtures", "lpoptions", name), "utf-8")
+
+  it("should parse multi-valued options with their defaults", () => {
+    const options = parseLpoptions(fixture("hp-laserjet-m404.txt"))
+
+    expect(options.map((o) => o.name)).toEqual([
+      "PageSize",
+      "MediaType",
+      "InputSlot",
+      "ColorModel",
+      "Duplex",
+      "cupsPrintQuality",
+      "OutputBin",
+      "print-content-optimize",
+      "print-rendering-intent",
+      "print-scaling",
+      "Resolution",
+    ])
+    expect(options.find((o) => o.name === "Duplex")).toEqual({
+      name: "Duplex",
+      label: "2-Sided Printing",
+      choices: ["None", "DuplexNoTumble", "DuplexTumble"],
+      default: "None",
+    })
+    expect(options.find((o) => o.name === "Resolution")).toEqual({
+      name: "Resolution",
+      label: "Resolution",
+      choices: ["300dpi", "600dpi", "1200dpi"],
+      default: "600dpi",
+    })
+  })
+
+  it("should handle defaults in the middle of the list and dotted option names", () => {
+    const options = parseLpoptions(fixture("epson-et-8550.txt"))
+    const pageSize = options.find((o) => o.name === "PageSize")
+
+    expect(pageSize?.default).toBe("A4")
+    expect(pageSize?.choices).toHaveLength(16)
+    expect(pageSize?.choices.slice(0, 4)).toEqual(["Letter", "Legal", "A4", "A3"])
+    expect(options.find((o) => o.name === "PageSize.Fullbleed")?.label).toBe("Borderless")
+    expect(options.find((o) => o.name === "ColorModel")).toMatchObject({
+      choices: ["Gray", "RGB"],
+      default: "RGB",
+    })
+  })
+
+  it("should return an empty list for empty output", () => {
+    expect(parseLpoptions("")).toEqual([])
+  })
+})
+
+describe("getPrinterOptions", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should run lpoptions for the printer", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 0,
+      stdout: "Duplex/2-Sided Printing: *None DuplexNoTumble",
+      stderr: "",
+    } as never)
+
+    const options = await getPrinterOptions("Office_HP")
+
+    expect(execa).toHaveBeenCalledWith("lpoptions", ["-p", "Office_HP", "-l"], expect.anything())
+    expect(options).toHaveLength(1)
+  })
+
+  it("should surface lpoptions errors", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 1,
+      stdout: "",
+      stderr: "lpoptions: Unable to get PPD file for Nope: Not Found",
+    } as never)
+
+    await expect(getPrinterOptions("Nope")).rejects.toThrow(/Unable to get PPD file for Nope/)
+  })
+})
+
+describe("parseJobId", () => {
+  it("should extract the job ID from lp output", () => {
+    expect(parseJobId("request id is Office_HP-123 (1 file(s))")).toBe("Office_HP-123")
+    expect(parseJobId("request id is Home-Canon-7 (0 file(s))")).toBe("Home-Canon-7")
+  })
+
+  it("should return null when no job ID is reported", () => {
+    expect(parseJobId("")).toBeNull()
+    expect(parseJobId("lp: Error - no default destination available.")).toBeNull()
+  })
+})
+
+describe("printerFromJobId", () => {
+  it("should split on the last dash so printer names may contain dashes", () => {
+    expect(printerFromJobId("Office_HP-123")).toBe("Office_HP")
+    expect(printerFromJobId("Home-Canon-Pixma-42")).toBe("Home-Canon-Pixma")
+  })
+})
+
+describe("submitLpJob", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 0,
+      stdout: "request id is Office_HP-77 (0 file(s))",
+      stderr: "",
+    } as never)
+  })
+
+  it("should stream content to lp over stdin without a file argument", async () => {
+    const jobId = await submitLpJob({ printer: "Office_HP", title: "Notes", content: "hello" })
+
+    expect(jobId).toBe("Office_HP-77")
+    expect(execa).toHaveBeenCalledWith(
+      "lp",
+      ["-d", "Office_HP", "-t", "Notes"],
+      expect.objectContaining({ input: "hello" })
+    )
+  })
+
+  it("should pass multi-megabyte content through unchanged", async () => {
+    const content = "The quick brown fox jumps over the lazy dog.\n".repeat(100_000)
+    expect(content.length).toBeGreaterThan(4 * 1024 * 1024)
+
+    await submitLpJob({ content })
+
+    const [, args, options] = vi.mocked(execa).mock.calls[0] as unknown as [
+      string,
+      string[],
+      { input: string },
+    ]
+    expect(args).toEqual([])
+    expect(options.input).toBe(content)
+  })
+
+  it("should pass non-ASCII UTF-8 text through unchanged", async () => {
+    const content = "Café — naïve résumé\n日本語のテキスト\nEmoji: 🖨️"
+
+    await submitLpJob({ content, title: "Ünïcødé" })
+
+    expect(execa).toHaveBeenCalledWith(
+      "lp",
+      ["-t", "Ünïcødé"],
+      expect.objectContaining({ input: content })
+    )
+  })
+
+  it("should pass CUPS options and a file path", async () => {
+    await submitLpJob({
+      filePath: "/tmp/doc.pdf",
+      options: ["landscape", "sides=two-sided-long-edge"],
+    })
+
+    const [, args, options] = vi.mocked(execa).mock.calls[0] as unknown as [
+      string,
+      string[],
+      Record<string, unknown>,
+    ]
+    expect(args).toEqual([
+      "-o",
+      "landscape",
+      "-o",
+      "sides=two-sided-long-edge",
+      "--",
+      "/tmp/doc.pdf",
+    ])
+    expect(options).not.toHaveProperty("input")
+  })
+
+  it("should surface lp errors", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 1,
+      stdout: "",
+      stderr: "lp: Error - no default destination available.",
+    } as never)
+
+    await expect(submitLpJob({ content: "hello" })).rejects.toThrow(/no default destination/)
+  })
+})
+
+const ACTIVE_JOBS_OUTPUT = `Office-HP-LaserJet-123  steve          1024   Mon Jan  1 10:00:00 2024
+	Status: Sending data to printer.
+	Alerts: job-printing
+	queued for Office-HP-LaserJet
+Office-HP-LaserJet-124  steve          2048   Mon Jan  1 10:01:00 2024
+	Alerts: none
+	queued for Office-HP-LaserJet`
+
+const COMPLETED_JOBS_OUTPUT = `Office-HP-LaserJet-120  steve          4096   Mon Jan  1 09:00:00 2024
+	Alerts: job-completed-successfully
+	queued for Office-HP-LaserJet
+Office-HP-LaserJet-121  steve          4096   Mon Jan  1 09:05:00 2024
+	Alerts: job-canceled-by-user
+	queued for Office-HP-LaserJet
+Office-HP-LaserJet-122  steve          4096   Mon Jan  1 09:10:00 2024
+	Alerts: aborted-by-system
+	queued for Office-HP-LaserJet`
+
+/**
+ * Mocks the two lpstat calls made by getJobStatus (active jobs, then completed jobs).
+ */
+function mockJobQueries(active: string, completed: string) {
+  vi.mocked(execa).mockImplementation(((_command: string, args: string[]) =>
+    Promise.resolve({
+      exitCode: 0,
+      stdout: args.includes("completed") ? completed : active,
+      stderr: "",
+    })) as never)
+}
+
+describe("parseLpstatJobs", () => {
+  it("should parse jobs for printers whose names contain dashes", () => {
+    const jobs = parseLpstatJobs(ACTIVE_JOBS_OUTPUT)
+
+    expect(jobs).toHaveLength(2)
+    expect(jobs[0]).toEqual({
+      job_id: "Office-HP-LaserJet-123",
+      printer: "Office-HP-LaserJet",
+      user: "steve",
+      size: 1024,
+      submitted: "Mon Jan  1 10:00:00 2024",
+      alerts: ["job-printing"],
+      status_message: "Sending data to printer.",
+    })
+    expect(jobs[1].alerts).toEqual([])
+  })
+})
+
+describe("inferJobState", () => {
+  it("should infer active job states", () => {
+    expect(inferJobState(["job-printing"], false)).toBe("processing")
+    expect(inferJobState([], false)).toBe("pending")
+  })
+
+  it("should tell held jobs from pending ones", () => {
+    expect(inferJobState(["job-hold-until-specified"], false)).toBe("held")
+    expect(inferJobState(["job-incoming"], false)).toBe("pending")
+  })
+
+  it("should infer finished job states", () => {
+    expect(inferJobState(["job-completed-successfully"], true)).toBe("completed")
+    expect(inferJobState(["job-canceled-by-user"], true)).toBe("canceled")
+    expect(inferJobState(["aborted-by-system"], true)).toBe("aborted")
+    expect(inferJobState([], true)).toBe("completed")
+  })
+})
+
+describe("getJobStatus", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+    mockJobQueries(ACTIVE_JOBS_OUTPUT, COMPLETED_JOBS_OUTPUT)
+  })
+
+  it("should report processing and pending jobs", async () => {
+    await expect(getJobStatus("Office-HP-LaserJet-123")).resolves.toMatchObject({
+      state: "processing",
+      printer: "Office-HP-LaserJet",
+    })
+    await expect(getJobStatus("Office-HP-LaserJet-124")).resolves.toMatchObject({
+      state: "pending",
+    })
+  })
+
+  it("should report completed, canceled, and aborted jobs", async () => {
+    await expect(getJobStatus("Office-HP-LaserJet-120")).resolves.toMatchObject({
+      state: "completed",
+    })
+    await expect(getJobStatus("Office-HP-LaserJet-121")).resolves.toMatchObject({
+      state: "canceled",
+    })
+    await expect(getJobStatus("Office-HP-LaserJet-122")).resolves.toMatchObject({
+      state: "aborted",
+    })
+  })
+
+  it("should accept a bare job number", async () => {
+    await expect(getJobStatus("123")).resolves.toMatchObject({
+      job_id: "Office-HP-LaserJet-123",
+      state: "processing",
+    })
+  })
+
+  it("should report not-found for purged or unknown jobs instead of throwing", async () => {
+    await expect(getJobStatus("Office-HP-LaserJet-999")).resolves.toEqual({
+      job_id: "Office-HP-LaserJet-999",
+      state: "not-found",
+    })
+  })
+
+  it("should not match a job number against the middle of another ID", async () => {
+    await expect(getJobStatus("12")).resolves.toMatchObject({ state: "not-found" })
+  })
+})
+
+describe("remote CUPS server", () => {
+  /** Environments the CUPS commands were run with, by command. */
+  let environments: Array<[string, Record<string, string> | undefined]>
+
+  /** Stands in for execa: records the environment and answers like a server with printers. */
+  function recordEnvironment(
+    command: string,
+    _args: string[],
+    options: { env?: Record<string, string> }
+  ) {
+    environments.push([command, options.env])
+    const output: Record<string, string> = {
+      lpstat: MULTI_PRINTER_OUTPUT,
+      lp: "request id is Office_HP_LaserJet-42 (1 file(s))",
+    }
+    return Promise.resolve({ exitCode: 0, stdout: output[command] ?? "", stderr: "" })
+  }
+
+  beforeEach(() => {
+    config.cupsServer = "printserver.example.com:631"
+    config.cupsEncryption = "always"
+    environments = []
+    vi.mocked(execa).mockReset()
+    vi.mocked(execa).mockImplementation(recordEnvironment as never)
+  })
+
+  afterEach(() => {
+    config.cupsServer = ""
+    config.cupsEncryption = "ifrequested"
+  })
+
+  it("should run lpstat, lpoptions, lp, and cancel against the server", async () => {
+    await listPrinters()
+    await getPrinterOptions("Office_HP_LaserJet")
+    await submitLpJob({ printer: "Office_HP_LaserJet", filePath: "/tmp/report.pdf" })
+    await cancelJob("Office_HP_LaserJet-42")
+
+    expect(environments.map(([command]) => command)).toEqual([
+      "lpstat",
+      "lpoptions",
+      "lp",
+      "cancel",
+    ])
+    for (const [, env] of environments) {
+      expect(env).toEqual({
+        LC_ALL: "C",
+        LANG: "C",
+        CUPS_SERVER: "printserver.example.com:631",
+        CUPS_ENCRYPTION: "Always",
+      })
+    }
+  })
+
+  it("should leave the server to CUPS when none is configured", () => {
+    config.cupsServer = ""
+    expect(cupsEnv()).toEqual({ LC_ALL: "C", LANG: "C" })
+  })
+
+  it("should name the server when it can't be reached", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 1,
+      stdout: "",
+      stderr: "lpstat: Unable to connect to server: Connection refused",
+    } as never)
+
+    const error = await listPrinters().catch((caught: unknown) => caught)
+    expect(error).toMatchObject({
+      code: "SERVER_UNREACHABLE",
+      message:
+        "Cannot reach the CUPS server printserver.example.com:631: lpstat: Unable to connect to server: Connection refused",
+    })
+    expect((error as { suggestion: string }).suggestion).toContain("printserver.example.com:631")
+  })
+
+  it("should report other failures as they are", async () => {
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 1,
+      stdout: "",
+      stderr: "lpoptions: The printer or class does not exist.",
+    } as never)
+
+    await expect(getPrinterOptions("Gone")).rejects.toMatchObject({ code: "PRINTER_NOT_FOUND" })
+  })
+})
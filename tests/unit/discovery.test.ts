@@ -0,0 +1,129 @@
+/**
+ * @fileoverview Unit tests for mDNS printer discovery, run against a local UDP responder
+ * that replays mDNS byte fixtures
+ */
+
+import { describe, it, expect, beforeAll, afterAll, beforeEach } from "vitest"
+import { createSocket, type Socket } from "dgram"
+import { readFileSync } from "fs"
+import { join } from "path"
+import type { AddressInfo } from "net"
+import { discoverPrinters } from "../../src/discovery.js"
+import { decodeDnsRecords, encodeDnsQuery, RECORD_TYPES } from "../../src/mdns.js"
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures", "mdns")
+
+function fixture(name: string): Buffer {
+  return readFileSync(join(fixturesDir, name))
+}
+
+describe("discoverPrinters", () => {
+  let responder: Socket
+  let target: { address: string; port: number }
+  let queries: Buffer[]
+  let respond: (query: Buffer) => Buffer[]
+
+  beforeAll(async () => {
+    responder = createSocket("udp4")
+    responder.on("message", (query, remote) => {
+      queries.push(query)
+      for (const reply of respond(query)) {
+        responder.send(reply, remote.port, remote.address)
+      }
+    })
+    await new Promise<void>((resolve) => responder.bind(0, "127.0.0.1", resolve))
+    target = { address: "127.0.0.1", port: (responder.address() as AddressInfo).port }
+  })
+
+  afterAll(() => {
+    responder.close()
+  })
+
+  beforeEach(() => {
+    queries = []
+    respond = () => [fixture("ipp-printer-response.bin")]
+  })
+
+  it("should browse both IPP service types", async () => {
+    await discoverPrinters({ durationMs: 200, target })
+
+    expect(queries.length).toBeGreaterThan(0)
+    expect(queries[0]).toEqual(
+      encodeDnsQuery([
+        { name: "_ipp._tcp.local", type: RECORD_TYPES.PTR },
+        { name: "_ipps._tcp.local", type: RECORD_TYPES.PTR },
+      ])
+    )
+  })
+
+  it("should return the printer with a usable URI and TXT hints", async () => {
+    const result = await discoverPrinters({ durationMs: 200, target })
+
+    expect(result).toEqual({
+      printers: [
+        {
+          name: "Office Printer",
+          service: "ipp",
+          host: "officeprinter.local",
+          port: 631,
+          addresses: ["192.168.1.50", "fe80::1"],
+          uri: "ipp://192.168.1.50:631/ipp/print",
+          make_and_model: "HP LaserJet Pro M404",
+          location: "2nd Floor",
+          pdl: ["application/pdf", "image/urf"],
+          color: false,
+          duplex: true,
+        },
+      ],
+    })
+  })
+
+  it("should ask for SRV and TXT records when the responder only sends the PTR record", async () => {
+    // Cut the fixture down to the question and the PTR answer, with no additional records
+    const ptrOnly = Buffer.from(fixture("ipp-printer-response.bin").subarray(0, 62))
+    ptrOnly.writeUInt16BE(0, 10)
+    expect(decodeDnsRecords(ptrOnly).map((record) => record.type)).toEqual([RECORD_TYPES.PTR])
+    respond = () => (queries.length === 1 ? [ptrOnly] : [])
+
+    const result = await discoverPrinters({ durationMs: 200, target })
+
+    expect(queries).toHaveLength(2)
+    expect(queries[1]).toEqual(
+      encodeDnsQuery([
+        { name: "Office Printer._ipp._tcp.local", type: RECORD_TYPES.SRV },
+        { name: "Office Printer._ipp._tcp.local", type: RECORD_TYPES.TXT },
+      ])
+    )
+    // Nothing answered the follow-up, so the instance's host and port are unknown
+    expect(result.printers).toEqual([])
+  })
+
+  it("should ignore malformed responses", async () => {
+    respond = () => [Buffer.from("not a dns message")]
+
+    const result = await discoverPrinters({ durationMs: 200, target })
+
+    expect(result).toEqual({ printers: [] })
+  })
+
+  it("should return no printers without a warning when nothing answers", async () => {
+    respond = () => []
+
+    const result = await discoverPrinters({ durationMs: 200, target })
+
+    expect(result).toEqual({ printers: [] })
+  })
+
+  it("should return a warning instead of hanging when queries can't be sent", async () => {
+    // Sending to the broadcast address without SO_BROADCAST fails like a missing multicast route
+    const started = Date.now()
+    const result = await discoverPrinters({
+      durationMs: 5000,
+      target: { address: "255.255.255.255", port: 5353 },
+    })
+
+    expect(result.printers).toEqual([])
+    expect(result.warning).toMatch(/mDNS discovery is unavailable/)
+    expect(Date.now() - started).toBeLessThan(5000)
+  })
+})
@@ -0,0 +1,176 @@
+/**
+ * @fileoverview Unit tests for character encoding detection and conversion of text files
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { readFileSync } from "fs"
+import { basename, dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures, with no header or footer to render
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderMarkdown: true,
+      autoRenderCode: true,
+      fallbackOnRenderError: false,
+      header: "",
+      footer: "",
+      code: {
+        excludeExtensions: [],
+        colorScheme: "atom-one-light",
+        autoLineNumbers: true,
+        fontSize: "10pt",
+        lineSpacing: "1.5",
+      },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import {
+  CJK_FONT_FAMILIES,
+  decodeText,
+  detectEncoding,
+  readTextFile,
+  resolveEncoding,
+} from "../../src/renderers/encoding.js"
+import { buildCodeHtml } from "../../src/renderers/code.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+const fixture = (name: string) => join(fixturesDir, "encodings", name)
+
+describe("resolveEncoding", () => {
+  it("should accept encoding labels and return the canonical name", () => {
+    expect(resolveEncoding("Shift-JIS")).toBe("shift_jis")
+    expect(resolveEncoding("sjis")).toBe("shift_jis")
+    expect(resolveEncoding("cp1252")).toBe("windows-1252")
+    expect(resolveEncoding(" UTF-8 ")).toBe("utf-8")
+  })
+
+  it("should reject unsupported encodings with the supported names", () => {
+    expect(() => resolveEncoding("ebcdic")).toThrow(
+      'Unsupported encoding "ebcdic": use one of utf-8, utf-16le, utf-16be, windows-1252,'
+    )
+    expect(() => resolveEncoding("ebcdic")).toThrow("shift_jis, euc-jp")
+  })
+})
+
+describe("detectEncoding", () => {
+  it("should detect the encoding of each fixture", () => {
+    const detected = (name: string) => detectEncoding(readFileSync(fixture(name)))
+
+    expect(detected("windows-1252.txt")).toBe("windows-1252")
+    expect(detected("shift_jis.txt")).toBe("shift_jis")
+    expect(detected("euc-jp.txt")).toBe("euc-jp")
+    expect(detected("gb18030.txt")).toBe("gb18030")
+    expect(detected("euc-kr.txt")).toBe("euc-kr")
+    expect(detectEncoding(readFileSync(join(fixturesDir, "hello.py")))).toBe("utf-8")
+  })
+
+  it("should use the byte order mark first", () => {
+    const bom = (name: string) =>
+      detectEncoding(readFileSync(join(fixturesDir, "file-types", name)))
+
+    expect(bom("utf8-bom.txt")).toBe("utf-8")
+    expect(bom("utf16le.txt")).toBe("utf-16le")
+    expect(bom("utf16be")).toBe("utf-16be")
+  })
+
+  it("should refuse text it can't tell the encoding of", () => {
+    // "Привет мир" in Windows-1251 reads as neither CJK text nor Windows-1252 words
+    const cyrillic = Buffer.from([0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2, 0x20, 0xec, 0xe8, 0xf0])
+
+    expect(() => detectEncoding(cyrillic, "hello.txt")).toThrow(
+      "Cannot detect the character encoding of hello.txt."
+    )
+    expect(decodeText(cyrillic, "windows-1251").text).toBe("Привет мир")
+  })
+})
+
+describe("readTextFile", () => {
+  it("should decode each fixture to the right characters", () => {
+    expect(readTextFile(fixture("windows-1252.txt")).text).toContain(
+      "Quarterly report – Café Müller\nRevenue: 1.250 €\n“Crème brûlée”"
+    )
+    expect(readTextFile(fixture("shift_jis.txt")).text).toContain(
+      "東京支店：こんにちは、ソフトウェア部です。"
+    )
+    expect(readTextFile(fixture("euc-jp.txt")).text).toContain("いつもお世話になっております。")
+    expect(readTextFile(fixture("gb18030.txt")).text).toContain("本季度收入增长了百分之十二。")
+    expect(readTextFile(fixture("euc-kr.txt")).text).toContain("이번 분기 매출이 증가했습니다.")
+  })
+
+  it("should drop the byte order mark", () => {
+    const { text, encoding } = readTextFile(join(fixturesDir, "file-types", "utf16le.txt"))
+
+    expect(encoding).toBe("utf-16le")
+    expect(text.startsWith("Grocery list\n- café au lait")).toBe(true)
+  })
+
+  it("should use the encoding option over detection", () => {
+    expect(readTextFile(fixture("windows-1252.txt"), "iso-8859-15").text).toContain("Café")
+  })
+
+  it("should refuse a file that isn't valid in the named encoding", () => {
+    expect(() => readTextFile(fixture("shift_jis.txt"), "utf-8")).toThrow(
+      "Cannot decode shift_jis.txt as utf-8: it contains bytes that aren't valid utf-8."
+    )
+    expect(() => readTextFile(fixture("windows-1252.txt"), "euc-jp")).toThrow(
+      expect.objectContaining({ code: "UNSUPPORTED_FORMAT" })
+    )
+  })
+})
+
+describe("buildCodeHtml", () => {
+  it("should render decoded CJK text with a font that has its glyphs", () => {
+    const { text } = readTextFile(fixture("shift_jis.txt"))
+    const html = buildCodeHtml(fixture("shift_jis.txt"), text)
+
+    expect(html).toContain("売上報告書（第3四半期）")
+    expect(html).toContain("こんにちは、ソフトウェア部です。")
+    expect(html).toContain(`font-family: Menlo, Monaco, 'Courier New', ${CJK_FONT_FAMILIES}`)
+  })
+})
+
+describe("prepareFileForPrinting", () => {
+  it("should send a Windows-1252 text file to the printer as UTF-8", async () => {
+    const result = await prepareFileForPrinting({ filePath: fixture("windows-1252.txt") })
+    try {
+      expect(result.fileType).toBe("text, WINDOWS-1252")
+      expect(result.renderType).toBe("")
+      expect(basename(result.actualFilePath)).toBe("windows-1252.txt")
+      expect(result.actualFilePath).not.toBe(fixture("windows-1252.txt"))
+      expect(readFileSync(result.actualFilePath, "utf-8")).toBe(
+        readTextFile(fixture("windows-1252.txt")).text
+      )
+    } finally {
+      cleanupRenderedPdf(result.renderedPdf)
+    }
+  })
+
+  it("should send UTF-8 text as it is", async () => {
+    const result = await prepareFileForPrinting({
+      filePath: join(fixturesDir, "hello.py"),
+      forceCodeRender: false,
+    })
+
+    expect(result.actualFilePath).toBe(join(fixturesDir, "hello.py"))
+    expect(result.renderedPdf).toBeNull()
+  })
+
+  it("should reject an unsupported encoding option", async () => {
+    await expect(
+      prepareFileForPrinting({ filePath: fixture("shift_jis.txt"), encoding: "ebcdic" })
+    ).rejects.toThrow('Unsupported encoding "ebcdic"')
+  })
+})
@@ -0,0 +1,213 @@
+/**
+ * @fileoverview Unit tests for typed printing errors and the parsing of CUPS error output
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { execa } from "execa"
+import {
+  classifyCommandError,
+  classifyIppStatus,
+  commandError,
+  describeError,
+  isTransientError,
+  PrinterError,
+  toPrinterError,
+  type PrinterErrorCode,
+} from "../../src/errors.js"
+import { cancelJob, getPrinterOptions, listPrinters, submitLpJob } from "../../src/cups.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+describe("classifyCommandError", () => {
+  const cases: Array<{ stderr: string; code: PrinterErrorCode | undefined }> = [
+    { stderr: "lp: Error - no default destination available.", code: "PRINTER_NOT_FOUND" },
+    { stderr: "lp: The printer or class does not exist.", code: "PRINTER_NOT_FOUND" },
+    {
+      stderr: 'lpstat: Invalid destination name in list "Nope".',
+      code: "PRINTER_NOT_FOUND",
+    },
+    { stderr: 'lpstat: Unknown destination "Nope".', code: "PRINTER_NOT_FOUND" },
+    {
+      stderr: "lpoptions: Unable to get PPD file for Nope: The printer or class does not exist.",
+      code: "PRINTER_NOT_FOUND",
+    },
+    {
+      stderr: 'lp: Destination "Office_HP" is not accepting jobs.',
+      code: "PRINTER_NOT_ACCEPTING",
+    },
+    {
+      stderr: 'lp: Error - unable to access "/tmp/missing.pdf" - No such file or directory',
+      code: "FILE_NOT_FOUND",
+    },
+    {
+      stderr: 'lp: Error - unable to access "/root/secret.pdf" - Permission denied',
+      code: "PERMISSION_DENIED",
+    },
+    { stderr: "lp: Forbidden", code: "PERMISSION_DENIED" },
+    {
+      stderr: "cancel: cancel-job failed: You don't own job ID 42.",
+      code: "PERMISSION_DENIED",
+    },
+    { stderr: "cancel: Not allowed to cancel job 42", code: "PERMISSION_DENIED" },
+    {
+      stderr: 'lp: Unsupported document-format "application/x-foo".',
+      code: "UNSUPPORTED_FORMAT",
+    },
+    {
+      stderr: "lp: client-error-document-format-not-supported",
+      code: "UNSUPPORTED_FORMAT",
+    },
+    { stderr: "lp: Request Entity Too Large", code: "JOB_REJECTED" },
+    {
+      stderr: "Exception calling \"Submit\": \"OpenPrinter failed for Nope\"",
+      code: "PRINTER_NOT_FOUND",
+    },
+    {
+      stderr: "lpstat: Unable to connect to server: Connection refused",
+      code: "PRINTER_UNREACHABLE",
+    },
+    { stderr: "lp: Unable to connect to printer.", code: "PRINTER_UNREACHABLE" },
+    { stderr: "lp: No route to host", code: "PRINTER_UNREACHABLE" },
+    { stderr: "cancel: cancel-job failed: Job #42 does not exist.", code: undefined },
+    { stderr: "", code: undefined },
+  ]
+
+  for (const c of cases) {
+    it(`should classify ${JSON.stringify(c.stderr)} as ${c.code ?? "unknown"}`, () => {
+      expect(classifyCommandError(c.stderr)).toBe(c.code)
+    })
+  }
+})
+
+describe("commandError", () => {
+  it("should wrap the command output as the cause of a PrinterError", () => {
+    const error = commandError("lp failed: nope", "lp: The printer or class does not exist.")
+
+    expect(error).toBeInstanceOf(PrinterError)
+    expect((error as PrinterError).code).toBe("PRINTER_NOT_FOUND")
+    expect((error as PrinterError).suggestion).toMatch(/list_printers/)
+    expect((error.cause as Error).message).toBe("lp: The printer or class does not exist.")
+  })
+
+  it("should use the fallback code for unrecognized output", () => {
+    const error = commandError("lp failed: odd", "lp: something odd", "JOB_REJECTED")
+    expect((error as PrinterError).code).toBe("JOB_REJECTED")
+  })
+
+  it("should return a plain Error when the output is unrecognized and there is no fallback", () => {
+    const error = commandError("lpstat failed", "lpstat: Scheduler is not running.")
+    expect(error).not.toBeInstanceOf(PrinterError)
+    expect(error.message).toBe("lpstat failed")
+  })
+})
+
+describe("classifyIppStatus", () => {
+  it("should map IPP status codes to error codes", () => {
+    expect(classifyIppStatus(0x0000)).toBeUndefined()
+    expect(classifyIppStatus(0x0403)).toBe("PERMISSION_DENIED")
+    expect(classifyIppStatus(0x0406)).toBe("PRINTER_NOT_FOUND")
+    expect(classifyIppStatus(0x040a)).toBe("UNSUPPORTED_FORMAT")
+    expect(classifyIppStatus(0x0506)).toBe("PRINTER_NOT_ACCEPTING")
+    expect(classifyIppStatus(0x040b)).toBe("JOB_REJECTED")
+  })
+})
+
+describe("isTransientError", () => {
+  it("should treat unreachable printers, paused queues, and timeouts as transient", () => {
+    expect(isTransientError(new PrinterError("PRINTER_UNREACHABLE", "down"))).toBe(true)
+    expect(isTransientError(new PrinterError("PRINTER_NOT_ACCEPTING", "paused"))).toBe(true)
+    expect(isTransientError(new PrinterError("TIMEOUT", "lp timed out after 30s"))).toBe(true)
+  })
+
+  it("should treat other failures as permanent", () => {
+    expect(isTransientError(new PrinterError("PRINTER_NOT_FOUND", "nope"))).toBe(false)
+    expect(isTransientError(new PrinterError("SERVER_UNREACHABLE", "server down"))).toBe(false)
+    expect(isTransientError(new PrinterError("FILE_NOT_FOUND", "gone"))).toBe(false)
+    expect(isTransientError(new PrinterError("JOB_REJECTED", "bad document"))).toBe(false)
+    expect(isTransientError(new Error("lp was canceled"))).toBe(false)
+  })
+})
+
+describe("toPrinterError", () => {
+  function errnoError(code: string, syscall: string) {
+    return Object.assign(new Error(`${code}: ${syscall} failed`), { code, syscall })
+  }
+
+  it("should classify a missing file", () => {
+    const cause = errnoError("ENOENT", "open")
+    const error = toPrinterError(cause)
+
+    expect(error?.code).toBe("FILE_NOT_FOUND")
+    expect(error?.cause).toBe(cause)
+  })
+
+  it("should classify an unreadable file", () => {
+    expect(toPrinterError(errnoError("EACCES", "open"))?.code).toBe("PERMISSION_DENIED")
+  })
+
+  it("should not treat a missing command as a missing file", () => {
+    expect(toPrinterError(errnoError("ENOENT", "spawn lp"))).toBeUndefined()
+  })
+
+  it("should leave other errors unclassified", () => {
+    expect(toPrinterError(new Error("boom"))).toBeUndefined()
+    expect(describeError("boom")).toEqual({ message: "boom" })
+  })
+})
+
+describe("CUPS command failures", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  function failWith(stderr: string) {
+    vi.mocked(execa).mockResolvedValue({ exitCode: 1, stdout: "", stderr } as never)
+  }
+
+  it("should report lp with no default destination as PRINTER_NOT_FOUND", async () => {
+    failWith("lp: Error - no default destination available.")
+
+    const error = await submitLpJob({ content: "hello" }).catch((e: unknown) => e)
+    expect(error).toBeInstanceOf(PrinterError)
+    expect((error as PrinterError).code).toBe("PRINTER_NOT_FOUND")
+    expect((error as PrinterError).message).toMatch(/^lp failed: /)
+  })
+
+  it("should report an unrecognized lp failure as JOB_REJECTED", async () => {
+    failWith("lp: Bad document")
+
+    await expect(submitLpJob({ content: "hello" })).rejects.toMatchObject({
+      code: "JOB_REJECTED",
+    })
+  })
+
+  it("should report an unknown printer from lpoptions as PRINTER_NOT_FOUND", async () => {
+    failWith("lpoptions: Unable to get PPD file for Nope: The printer or class does not exist.")
+
+    await expect(getPrinterOptions("Nope")).rejects.toMatchObject({ code: "PRINTER_NOT_FOUND" })
+  })
+
+  it("should report a forbidden cancel as PERMISSION_DENIED", async () => {
+    failWith("cancel: cancel-job failed: You don't own job ID 42.")
+
+    await expect(cancelJob("Office_HP-42")).rejects.toMatchObject({ code: "PERMISSION_DENIED" })
+  })
+
+  it("should report an lpstat connection failure as PRINTER_UNREACHABLE", async () => {
+    failWith("lpstat: Unable to connect to server: Connection refused")
+
+    const error = await listPrinters().catch((e: unknown) => e)
+    expect((error as PrinterError).code).toBe("PRINTER_UNREACHABLE")
+    expect((error as Error).message).toMatch(/Unable to connect to server/)
+  })
+
+  it("should report an lp connection failure as PRINTER_UNREACHABLE", async () => {
+    failWith("lp: Unable to connect to printer.")
+
+    await expect(submitLpJob({ content: "hello" })).rejects.toMatchObject({
+      code: "PRINTER_UNREACHABLE",
+    })
+  })
+})
@@ -0,0 +1,201 @@
+/**
+ * @fileoverview Unit tests for job estimates (page counts, color pages, sheets, and cost)
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config with prices the tests can change
+vi.mock("../../src/config.js", () => ({
+  config: {
+    autoDuplex: false,
+    defaultOptions: [],
+    costPerPage: 0,
+    costPerColorPage: 0,
+    costCurrency: "",
+  },
+  MARKDOWN_EXTENSIONS: ["md", "markdown"],
+}))
+
+import { config } from "../../src/config.js"
+import { estimatePdf, formatCost } from "../../src/estimate.js"
+import { findColorPages } from "../../src/pdf/color.js"
+import {
+  PdfDocument,
+  PdfName,
+  PdfStream,
+  type PdfDict,
+  type PdfValue,
+} from "../../src/pdf/document.js"
+import { PdfMerger } from "../../src/pdf/merge.js"
+import { getPdfPageCount } from "../../src/utils.js"
+
+const fixture = (name: string) =>
+  join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures", "pdfs", name)
+
+/**
+ * Checks whether a one-page PDF with the given content counts as color.
+ *
+ * @param content - Content stream of the page
+ * @param resources - Builds the page's resources, adding any objects they refer to
+ */
+function usesColor(content: string, resources?: (merger: PdfMerger) => PdfDict): boolean {
+  const merger = new PdfMerger()
+  merger.addPage(
+    new Map<string, PdfValue>([
+      ["MediaBox", [0, 0, 612, 792]],
+      ["Resources", resources?.(merger) ?? new Map()],
+      ["Contents", merger.add(new PdfStream(new Map(), Buffer.from(content, "latin1")))],
+    ])
+  )
+  return findColorPages(new PdfDocument(merger.toBuffer())).has(1)
+}
+
+/**
+ * Builds resources with one color space, /CS0.
+ */
+const colorSpace = (space: (merger: PdfMerger) => PdfValue) => (merger: PdfMerger) =>
+  new Map([["ColorSpace", new Map([["CS0", space(merger)]])]])
+
+const iccProfile = (components: number) => (merger: PdfMerger) => [
+  new PdfName("ICCBased"),
+  merger.add(new PdfStream(new Map([["N", components]]), Buffer.alloc(0))),
+]
+
+describe("getPdfPageCount", () => {
+  it.each([
+    ["form.pdf", 3],
+    ["compressed.pdf", 2],
+    ["linearized.pdf", 5],
+    ["updated.pdf", 3],
+  ])("should count the pages of %s", async (name, pages) => {
+    // Classic table; cross-reference and object streams; linearized with a nested page tree;
+    // hybrid references with an incremental update that adds a page
+    expect(await getPdfPageCount(fixture(name))).toBe(pages)
+  })
+})
+
+describe("findColorPages", () => {
+  it("should find the color pages of the fixtures", () => {
+    const colorPages = (name: string) =>
+      [...findColorPages(new PdfDocument(readFileSync(fixture(name))))].sort()
+
+    expect(colorPages("form.pdf")).toEqual([])
+    expect(colorPages("compressed.pdf")).toEqual([])
+    expect(colorPages("linearized.pdf")).toEqual([2, 4])
+    expect(colorPages("updated.pdf")).toEqual([3])
+  })
+
+  it("should tell colors from grays in RGB and CMYK", () => {
+    expect(usesColor("1 0 0 rg 72 72 100 100 re f")).toBe(true)
+    expect(usesColor("0.4 0.4 0.4 RG 0.2 g 0 0 0 1 k")).toBe(false)
+    expect(usesColor("0 1 1 0 K 72 72 m 200 200 l S")).toBe(true)
+    // Operators in strings and comments aren't operators
+    expect(usesColor("0 g BT (1 0 0 rg) Tj ET % 0 0 1 rg\n")).toBe(false)
+  })
+
+  it("should follow the color space of sc and scn", () => {
+    expect(usesColor("/CS0 cs 0.5 scn", colorSpace(iccProfile(1)))).toBe(false)
+    expect(usesColor("/CS0 CS 0.1 0.5 0.9 SCN", colorSpace(iccProfile(3)))).toBe(true)
+    expect(usesColor("/CS0 cs 0.3 0.3 0.3 sc", colorSpace(iccProfile(3)))).toBe(false)
+
+    const separation = (colorant: string) => () => [
+      new PdfName("Separation"),
+      new PdfName(colorant),
+      new PdfName("DeviceCMYK"),
+      null,
+    ]
+    expect(usesColor("/CS0 cs 1 scn", colorSpace(separation("Black")))).toBe(false)
+    expect(usesColor("/CS0 cs 1 scn", colorSpace(separation("PANTONE#20185#20C")))).toBe(true)
+    expect(usesColor("/Pattern cs /P0 scn 72 72 100 100 re f")).toBe(true)
+  })
+
+  it("should check images, forms, and shadings", () => {
+    const xobject = (dict: PdfDict, data: string) => (merger: PdfMerger) =>
+      new Map([["XObject", new Map([["X0", merger.add(new PdfStream(dict, Buffer.from(data)))]])]])
+    const image = (space: string) =>
+      new Map<string, PdfValue>([
+        ["Subtype", new PdfName("Image")],
+        ["ColorSpace", new PdfName(space)],
+      ])
+    const form = new Map<string, PdfValue>([["Subtype", new PdfName("Form")]])
+
+    expect(usesColor("/X0 Do", xobject(image("DeviceRGB"), "\xff\0\0"))).toBe(true)
+    expect(usesColor("/X0 Do", xobject(image("DeviceGray"), "\x80"))).toBe(false)
+    expect(usesColor("/X0 Do", xobject(form, "0 0 1 rg 0 0 10 10 re f"))).toBe(true)
+    expect(usesColor("/X0 Do", xobject(form, "0.5 g 0 0 10 10 re f"))).toBe(false)
+
+    const shading = (space: string) => () =>
+      new Map([["Shading", new Map([["Sh0", new Map([["ColorSpace", new PdfName(space)]])]])]])
+    expect(usesColor("/Sh0 sh", shading("DeviceGray"))).toBe(false)
+    expect(usesColor("/Sh0 sh", shading("DeviceRGB"))).toBe(true)
+  })
+
+  it("should check inline images and carry on after their data", () => {
+    expect(usesColor("BI /W 1 /H 1 /CS /RGB /BPC 8 ID \xff\0\0 EI")).toBe(true)
+    expect(usesColor("BI /W 1 /H 1 /CS /G /BPC 8 ID rg EI 0 g")).toBe(false)
+    expect(usesColor("BI /W 1 /H 1 /CS /G /BPC 8 ID \x80 EI 1 0 0 rg")).toBe(true)
+  })
+})
+
+describe("estimatePdf", () => {
+  beforeEach(() => {
+    config.costPerPage = 0
+    config.costPerColorPage = 0
+    config.costCurrency = ""
+  })
+
+  it("should count sides, color sides, and sheets with number-up, duplex, and copies", async () => {
+    // Pages 2 and 4 of linearized.pdf are in color: 2-up puts them on two of three sides
+    const estimate = await estimatePdf(fixture("linearized.pdf"), {
+      number_up: 2,
+      duplex: "long-edge",
+      copies: 2,
+    })
+
+    expect(estimate).toMatchObject({
+      documentPages: 5,
+      pages: 5,
+      colorPages: 2,
+      colorChecked: true,
+      sides: 3,
+      colorSides: 2,
+      sheets: 4,
+      cost: undefined,
+    })
+  })
+
+  it("should price black-and-white and color sides", async () => {
+    config.costPerPage = 0.1
+    config.costPerColorPage = 0.5
+
+    const all = await estimatePdf(fixture("linearized.pdf"), { copies: 2 })
+    expect(all.cost).toBeCloseTo(2 * (3 * 0.1 + 2 * 0.5))
+
+    const selected = await estimatePdf(fixture("linearized.pdf"), { page_ranges: "3,5" })
+    expect(selected).toMatchObject({ documentPages: 5, pages: 2, colorPages: 0 })
+    expect(selected.cost).toBeCloseTo(0.2)
+  })
+
+  it("should count no color pages for a grayscale job", async () => {
+    config.costPerPage = 0.1
+    config.costPerColorPage = 0.5
+
+    const typed = await estimatePdf(fixture("linearized.pdf"), { color_mode: "monochrome" })
+    const option = await estimatePdf(fixture("updated.pdf"), {}, "print-color-mode=monochrome")
+
+    expect(typed).toMatchObject({ monochrome: true, colorSides: 0 })
+    expect(typed.cost).toBeCloseTo(0.5)
+    expect(option).toMatchObject({ monochrome: true, colorPages: 0 })
+  })
+})
+
+describe("formatCost", () => {
+  it("should show two decimal places and the currency", () => {
+    expect(formatCost(2.6)).toBe("2.60")
+    config.costCurrency = "EUR"
+    expect(formatCost(0.125)).toBe("0.13 EUR")
+  })
+})
@@ -2,8 +2,9 @@
  * @fileoverview Unit tests for file security validation
  */
 
-import { describe, it, expect, vi, beforeEach } from "vitest"
-import { homedir } from "os"
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, mkdirSync, writeFileSync, symlinkSync, realpathSync, rmSync } from "fs"
+import { homedir, tmpdir } from "os"
 import { join } from "path"
 
 function createDefaultConfigMock() {
@@ -166,6 +167,111 @@ describe("validateFilePath", () => {
   })
 })
 
+describe("allowed directory enforcement", () => {
+  let baseDir: string
+  let allowedDir: string
+  let outsideDir: string
+
+  /**
+   * Imports file-security with only `allowedDir` allowed.
+   */
+  async function importWithAllowedDir() {
+    vi.resetModules()
+    const { config } = await import("../../src/config.js")
+    config.allowedPaths = [allowedDir]
+    config.deniedPaths = []
+    return import("../../src/file-security.js")
+  }
+
+  beforeEach(() => {
+    // Resolve the temp dir itself (e.g., /var -> /private/var on macOS)
+    baseDir = realpathSync(mkdtempSync(join(tmpdir(), "mcp-printer-security-")))
+    allowedDir = join(baseDir, "allowed")
+    outsideDir = join(baseDir, "outside")
+    mkdirSync(join(allowedDir, "sub"), { recursive: true })
+    mkdirSync(outsideDir)
+    writeFileSync(join(allowedDir, "doc.txt"), "allowed")
+    writeFileSync(join(outsideDir, "secret.txt"), "secret")
+  })
+
+  afterEach(() => {
+    rmSync(baseDir, { recursive: true, force: true })
+  })
+
+  it("should allow files under an allowed directory", async () => {
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(join(allowedDir, "doc.txt"))).not.toThrow()
+  })
+
+  it("should reject a symlinked file that points outside the allowed directories", async () => {
+    symlinkSync(join(outsideDir, "secret.txt"), join(allowedDir, "innocent.txt"))
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(join(allowedDir, "innocent.txt"))).toThrow(
+      /outside allowed directories/
+    )
+  })
+
+  it("should reject paths through a symlinked directory that escapes", async () => {
+    symlinkSync(outsideDir, join(allowedDir, "escape"))
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(join(allowedDir, "escape", "secret.txt"))).toThrow(
+      /outside allowed directories/
+    )
+    // Files that don't exist yet are checked through their resolved parent
+    expect(() => validateFilePath(join(allowedDir, "escape", "missing.txt"))).toThrow(
+      /outside allowed directories/
+    )
+  })
+
+  it("should allow symlinks that stay inside the allowed directories", async () => {
+    symlinkSync(join(allowedDir, "doc.txt"), join(allowedDir, "sub", "link.txt"))
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(join(allowedDir, "sub", "link.txt"))).not.toThrow()
+  })
+
+  it("should reject .. traversal out of an allowed directory", async () => {
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(`${allowedDir}/../outside/secret.txt`)).toThrow(
+      /outside allowed directories/
+    )
+    expect(() => validateFilePath(`${allowedDir}/sub/../../outside/secret.txt`)).toThrow(
+      /outside allowed directories/
+    )
+  })
+
+  it("should allow .. segments that stay inside an allowed directory", async () => {
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(`${allowedDir}/sub/../doc.txt`)).not.toThrow()
+  })
+
+  it("should accept an allowed root that is itself a symlink", async () => {
+    const linkedRoot = join(baseDir, "linked-root")
+    symlinkSync(allowedDir, linkedRoot)
+    vi.resetModules()
+    const { config } = await import("../../src/config.js")
+    config.allowedPaths = [linkedRoot]
+    config.deniedPaths = []
+    const { validateFilePath } = await import("../../src/file-security.js")
+
+    expect(() => validateFilePath(join(linkedRoot, "doc.txt"))).not.toThrow()
+    expect(() => validateFilePath(join(allowedDir, "doc.txt"))).not.toThrow()
+  })
+
+  it("should name the allowed directories in the error", async () => {
+    const { validateFilePath } = await importWithAllowedDir()
+
+    expect(() => validateFilePath(join(outsideDir, "secret.txt"))).toThrow(
+      `Allowed directories: ${allowedDir}.`
+    )
+  })
+})
+
 describe("cross-platform path handling - Windows simulation", () => {
   it("should detect dotfiles in Windows-style paths", async () => {
     const { validateFilePath } = await importFileSecurityWithWindows({
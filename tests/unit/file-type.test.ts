@@ -0,0 +1,244 @@
+/**
+ * @fileoverview Unit tests for file type detection from content (magic bytes and byte order marks)
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { existsSync, readFileSync } from "fs"
+import { basename, dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures, with no header or footer to render
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderMarkdown: true,
+      autoRenderCode: true,
+      fallbackOnRenderError: false,
+      header: "",
+      footer: "",
+      code: { excludeExtensions: [] },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import {
+  describeFileType,
+  extensionType,
+  rawLanguage,
+  resolveFileType,
+  sniffContent,
+  sniffFile,
+} from "../../src/renderers/file-type.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+const fixture = (name: string) => join(fixturesDir, "file-types", name)
+
+describe("sniffContent", () => {
+  it("should recognize each fixture by its magic bytes", async () => {
+    expect(await sniffFile(fixture("report-pdf.txt"))).toEqual({ type: "pdf" })
+    expect(await sniffFile(fixture("photo"))).toEqual({ type: "png" })
+    expect(await sniffFile(fixture("scan.pdf"))).toEqual({ type: "jpeg" })
+    expect(await sniffFile(fixture("letter"))).toEqual({ type: "office", extension: "docx" })
+    expect(await sniffFile(fixture("minutes.odt"))).toEqual({ type: "office", extension: "odt" })
+    expect(await sniffFile(fixture("mystery.bin"))).toEqual({ type: "unknown" })
+  })
+
+  it("should report the encoding of text with a byte order mark", async () => {
+    expect(await sniffFile(fixture("utf8-bom.txt"))).toEqual({ type: "text", encoding: "utf-8" })
+    expect((await sniffFile(fixture("utf16le.txt"))).encoding).toBe("utf-16le")
+    expect((await sniffFile(fixture("utf16be"))).encoding).toBe("utf-16be")
+    expect(await sniffFile(join(fixturesDir, "hello.py"))).toEqual({ type: "text" })
+  })
+
+  it("should recognize the other printable formats", () => {
+    const bytes = (text: string) => Buffer.from(text, "latin1")
+
+    expect(sniffContent(bytes("GIF89a\x01\x00")).type).toBe("gif")
+    expect(sniffContent(bytes("RIFF\x24\x00\x00\x00WEBPVP8 ")).type).toBe("webp")
+    expect(sniffContent(bytes("II*\x00\x08\x00")).type).toBe("tiff")
+    expect(sniffContent(bytes("%!PS-Adobe-3.0\n")).type).toBe("postscript")
+    expect(sniffContent(bytes("\x1bE\x1b&l0O")).type).toBe("pcl")
+    expect(sniffContent(bytes("\r\n%PDF-1.7\n")).type).toBe("pdf")
+    expect(sniffContent(bytes("PK\x03\x04not an office document")).type).toBe("unknown")
+  })
+
+  it("should recognize label and receipt printer commands", async () => {
+    const bytes = (text: string) => Buffer.from(text, "latin1")
+
+    expect(await sniffFile(fixture("shipping-label.txt"))).toEqual({ type: "zpl" })
+    expect(sniffContent(bytes("~SD20~JA\n^XA^FDHello^FS^XZ")).type).toBe("zpl")
+    expect(sniffContent(bytes("\x1b@\x1ba\x01Receipt\n\x1dV\x00")).type).toBe("escpos")
+    expect(sniffContent(bytes("Press ^XA to start a label")).type).toBe("text")
+  })
+})
+
+describe("rawLanguage", () => {
+  it("should name the printer language of raw content", () => {
+    expect(rawLanguage(Buffer.from("^XA^FDHello^FS^XZ"))).toBe("ZPL")
+    expect(rawLanguage(Buffer.from("\x1b@Receipt\n", "latin1"))).toBe("ESC/POS")
+    expect(rawLanguage(Buffer.from("%PDF-1.7\n"))).toBeUndefined()
+    expect(rawLanguage(Buffer.from("Plain text"))).toBeUndefined()
+  })
+})
+
+describe("extensionType", () => {
+  it("should map extensions and code file names to content types", () => {
+    expect(extensionType("report.PDF")).toBe("pdf")
+    expect(extensionType("photo.jpg")).toBe("jpeg")
+    expect(extensionType("budget.xlsx")).toBe("office")
+    expect(extensionType("label.zpl")).toBe("zpl")
+    expect(extensionType("main.go")).toBe("text")
+    expect(extensionType("Makefile")).toBe("text")
+    expect(extensionType("photo")).toBeUndefined()
+    expect(extensionType("mystery.bin")).toBeUndefined()
+  })
+})
+
+describe("resolveFileType", () => {
+  it("should use the extension when the content agrees with it", async () => {
+    expect(await resolveFileType(join(fixturesDir, "hello.py"))).toEqual({
+      format: "text",
+      type: "text",
+      source: "extension",
+    })
+    expect(await resolveFileType(fixture("minutes.odt"))).toEqual({
+      format: "office",
+      type: "office",
+      source: "extension",
+    })
+    expect(await resolveFileType(join(fixturesDir, "html", "report.html"))).toEqual({
+      format: "html",
+      type: "text",
+      source: "extension",
+    })
+  })
+
+  it("should use the content when the extension is missing or contradicts it", async () => {
+    expect(await resolveFileType(fixture("report-pdf.txt"))).toEqual({
+      format: "pdf",
+      type: "pdf",
+      source: "content",
+      extension: "pdf",
+    })
+    expect(await resolveFileType(fixture("photo"))).toMatchObject({
+      format: "image",
+      type: "png",
+      source: "content",
+    })
+    expect(await resolveFileType(fixture("scan.pdf"))).toMatchObject({
+      format: "image",
+      type: "jpeg",
+    })
+    expect(await resolveFileType(fixture("letter"))).toMatchObject({
+      format: "office",
+      extension: "docx",
+    })
+  })
+
+  it("should send label printer commands raw, whatever the extension", async () => {
+    expect(await resolveFileType(fixture("shipping-label.txt"))).toEqual({
+      format: "raw",
+      type: "zpl",
+      source: "content",
+    })
+  })
+
+  it("should send text without an extension as it is", async () => {
+    expect(await resolveFileType(fixture("utf16be"))).toEqual({
+      format: "text",
+      type: "text",
+      source: "content",
+      encoding: "utf-16be",
+    })
+  })
+
+  it("should let the format option override detection", async () => {
+    expect(await resolveFileType(fixture("report-pdf.txt"), "text")).toEqual({
+      format: "text",
+      source: "format",
+    })
+    expect(await resolveFileType(fixture("scan.pdf"), "text")).toEqual({
+      format: "text",
+      source: "format",
+      extension: "txt",
+    })
+    expect(await resolveFileType(fixture("mystery.bin"), "pdf")).toEqual({
+      format: "pdf",
+      source: "format",
+    })
+  })
+
+  it("should refuse binary content of unknown type", async () => {
+    await expect(resolveFileType(fixture("mystery.bin"))).rejects.toMatchObject({
+      code: "UNSUPPORTED_FORMAT",
+      message: expect.stringContaining("Cannot print mystery.bin"),
+    })
+  })
+})
+
+describe("describeFileType", () => {
+  it("should name the type and where it came from", () => {
+    expect(describeFileType({ format: "pdf", type: "pdf", source: "extension" })).toBe("pdf")
+    expect(describeFileType({ format: "image", type: "png", source: "content" })).toBe(
+      "png (detected from content)"
+    )
+    expect(describeFileType({ format: "text", source: "format" })).toBe("text (format option)")
+    expect(
+      describeFileType({ format: "text", type: "text", source: "extension", encoding: "utf-16le" })
+    ).toBe("text, UTF-16LE")
+    expect(describeFileType({ format: "raw", type: "zpl", source: "content" })).toBe(
+      "zpl (detected from content)"
+    )
+  })
+})
+
+describe("prepareFileForPrinting", () => {
+  it("should print a PDF named .txt from a copy with a .pdf extension", async () => {
+    const result = await prepareFileForPrinting({ filePath: fixture("report-pdf.txt") })
+    try {
+      expect(result.fileType).toBe("pdf (detected from content)")
+      expect(result.renderType).toBe("")
+      expect(result.renderedPdf).toBe(result.actualFilePath)
+      expect(basename(result.actualFilePath)).toBe("report-pdf.pdf")
+      expect(readFileSync(result.actualFilePath)).toEqual(readFileSync(fixture("report-pdf.txt")))
+    } finally {
+      cleanupRenderedPdf(result.renderedPdf)
+    }
+    expect(existsSync(result.actualFilePath)).toBe(false)
+  })
+
+  it("should send label printer commands raw, from the file itself", async () => {
+    const result = await prepareFileForPrinting({ filePath: fixture("shipping-label.txt") })
+    expect(result).toMatchObject({
+      actualFilePath: fixture("shipping-label.txt"),
+      renderedPdf: null,
+      renderType: "",
+      fileType: "zpl (detected from content)",
+      raw: true,
+    })
+  })
+
+  it("should send any file raw with the raw option", async () => {
+    const result = await prepareFileForPrinting({ filePath: fixture("mystery.bin"), raw: true })
+    expect(result).toMatchObject({ fileType: "raw (raw option)", raw: true, renderedPdf: null })
+    await expect(
+      prepareFileForPrinting({ filePath: fixture("mystery.bin"), raw: true, booklet: true })
+    ).rejects.toThrow("raw files are sent to the printer untouched")
+  })
+
+  it("should refuse an unknown binary file", async () => {
+    await expect(prepareFileForPrinting({ filePath: fixture("mystery.bin") })).rejects.toThrow(
+      "isn't a recognized document type"
+    )
+  })
+})
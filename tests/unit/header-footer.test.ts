@@ -0,0 +1,126 @@
+/**
+ * @fileoverview Unit tests for header and footer templates
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import {
+  buildHeaderFooterCss,
+  buildPuppeteerHeaderFooter,
+  hasHeaderFooter,
+  resolveHeaderFooter,
+  truncateStart,
+  validateTemplate,
+} from "../../src/renderers/header-footer.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    header: "{title}",
+    footer: "",
+  },
+}))
+
+const context = { filename: "report.md", title: "Q3 Report", date: new Date(2025, 0, 9) }
+
+describe("resolveHeaderFooter", () => {
+  it("should fall back to the configured templates", () => {
+    expect(resolveHeaderFooter()).toEqual({ header: "{title}", footer: "" })
+  })
+
+  it("should let per-call templates override the configuration", () => {
+    expect(resolveHeaderFooter({ header: "", footer: "{page}" })).toEqual({
+      header: "",
+      footer: "{page}",
+    })
+  })
+
+  it("should report whether anything is printed", () => {
+    expect(hasHeaderFooter({ header: "", footer: "" })).toBe(false)
+    expect(hasHeaderFooter({ footer: "{page}" })).toBe(true)
+  })
+})
+
+describe("validateTemplate", () => {
+  it("should accept the supported placeholders", () => {
+    expect(() => validateTemplate("{filename} {title} {date} {page}/{pages}")).not.toThrow()
+  })
+
+  it("should reject unknown placeholders", () => {
+    expect(() => validateTemplate("{author}")).toThrow(/Unknown placeholder \{author\}/)
+  })
+})
+
+describe("truncateStart", () => {
+  it("should keep short text as-is", () => {
+    expect(truncateStart("report.md")).toBe("report.md")
+  })
+
+  it("should keep the end of long text behind an ellipsis", () => {
+    const truncated = truncateStart(`${"very-long-directory/".repeat(5)}report.md`, 20)
+
+    expect(truncated).toBe("…directory/report.md")
+    expect([...truncated]).toHaveLength(20)
+  })
+})
+
+describe("buildPuppeteerHeaderFooter", () => {
+  it("should substitute placeholders and let Chrome fill in page numbers", () => {
+    const chrome = buildPuppeteerHeaderFooter(
+      { header: "{title}", footer: "{filename} - {date}||{page} / {pages}" },
+      context
+    )
+
+    expect(chrome.displayHeaderFooter).toBe(true)
+    expect(chrome.headerTemplate).toContain("Q3 Report")
+    expect(chrome.footerTemplate).toContain("report.md - 2025-01-09")
+    expect(chrome.footerTemplate).toContain(
+      '<span class="pageNumber"></span> / <span class="totalPages"></span>'
+    )
+    expect(chrome.footerTemplate).toContain("text-align: right")
+    expect(chrome.margin.top).toBe("1.5cm")
+  })
+
+  it("should escape HTML in file names and titles", () => {
+    const chrome = buildPuppeteerHeaderFooter(
+      { header: "{title}" },
+      { ...context, title: "<script>alert(1)</script>" }
+    )
+
+    expect(chrome.headerTemplate).not.toContain("<script>")
+    expect(chrome.headerTemplate).toContain("alert(1)")
+    expect(chrome.footerTemplate).toBe("<div></div>")
+    expect(chrome.margin.bottom).toBe("1cm")
+  })
+
+  it("should truncate long file names", () => {
+    const chrome = buildPuppeteerHeaderFooter(
+      { header: "{filename}" },
+      { ...context, filename: `${"a".repeat(100)}.md` }
+    )
+
+    expect(chrome.headerTemplate).toMatch(/>(…|&#x2026;)a{56}\.md</)
+  })
+})
+
+describe("buildHeaderFooterCss", () => {
+  it("should build @page margin boxes with page counters", () => {
+    const css = buildHeaderFooterCss(
+      { header: "{filename}|{title}", footer: "{page}/{pages}" },
+      context
+    )
+
+    expect(css).toContain('@top-left { content: "report.md"; }')
+    expect(css).toContain('@top-center { content: "Q3 Report"; }')
+    expect(css).toContain('@bottom-left { content: counter(page) "/" counter(pages); }')
+    expect(css).toContain("text-overflow: ellipsis")
+  })
+
+  it("should escape quotes and backslashes in CSS strings", () => {
+    const css = buildHeaderFooterCss({ header: "{title}" }, { ...context, title: 'a "b" \\ c' })
+
+    expect(css).toContain('@top-left { content: "a \\"b\\" \\\\ c"; }')
+  })
+
+  it("should return nothing without a header or footer", () => {
+    expect(buildHeaderFooterCss({ header: "", footer: "" }, context)).toBe("")
+  })
+})
@@ -0,0 +1,266 @@
+/**
+ * @fileoverview Unit tests for sandboxed HTML rendering and the basic layout used without Chrome
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { readFileSync, rmSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+    },
+  }
+})
+
+vi.mock("../../src/utils.js", () => ({
+  convertHtmlToPdf: vi.fn().mockResolvedValue("/tmp/mcp-printer-html-test/output.pdf"),
+  findChrome: vi.fn().mockResolvedValue("/usr/bin/chromium"),
+}))
+
+import {
+  SANDBOX_CHROME_FLAGS,
+  inlineLocalImages,
+  renderHtmlContentToPdf,
+  renderHtmlToPdf,
+  withContentSecurityPolicy,
+  withPageLayout,
+} from "../../src/renderers/html.js"
+import { layoutHtmlToPdf } from "../../src/renderers/html-layout.js"
+import { PdfDocument, PdfStream, isDict } from "../../src/pdf/document.js"
+import { convertHtmlToPdf, findChrome } from "../../src/utils.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures", "html")
+const reportPath = join(fixturesDir, "report.html")
+
+/**
+ * Reads the text a page draws, one string per Tj.
+ */
+function pageText(document: PdfDocument, pageIndex: number): string[] {
+  const page = document.getPages()[pageIndex]
+  const contents = document.resolve(page.dict.get("Contents") ?? null)
+  if (!(contents instanceof PdfStream)) {
+    return []
+  }
+  const ops = document.decodeStream(contents).toString("latin1")
+  return [...ops.matchAll(/<([0-9a-f]*)> Tj/g)].map((match) =>
+    Buffer.from(match[1], "hex").toString("latin1")
+  )
+}
+
+/**
+ * Reads the image XObjects of a page.
+ */
+function pageImages(document: PdfDocument, pageIndex: number): PdfStream[] {
+  const resources = document.resolve(document.getPages()[pageIndex].dict.get("Resources") ?? null)
+  const xobjects = isDict(resources) ? document.resolve(resources.get("XObject") ?? null) : null
+  if (!isDict(xobjects)) {
+    return []
+  }
+  return [...xobjects.values()]
+    .map((value) => document.resolve(value))
+    .filter((value): value is PdfStream => value instanceof PdfStream)
+}
+
+describe("withContentSecurityPolicy", () => {
+  it("should add the policy inside <head>, keeping the doctype first", () => {
+    const page = withContentSecurityPolicy('<!DOCTYPE html><html><head lang="en"><title>x</title>')
+    expect(page).toMatch(/^<!DOCTYPE html><html><head lang="en"><meta http-equiv="Content/)
+    expect(page).toContain("img-src data:;")
+    expect(page).not.toContain("https:")
+  })
+
+  it("should prepend the policy to fragments", () => {
+    expect(withContentSecurityPolicy("<p>Hi</p>")).toMatch(/^<meta [^>]+><p>Hi<\/p>$/)
+  })
+
+  it("should let remote images, stylesheets, and fonts load when allowed", () => {
+    const page = withContentSecurityPolicy("<p>Hi</p>", true)
+    expect(page).toContain("img-src data: http: https:")
+    expect(page).toContain("default-src 'none'")
+  })
+
+  it("should remove meta refreshes", () => {
+    const page = withContentSecurityPolicy(
+      '<head><meta http-equiv="refresh" content="0; url=https://example.com"></head>'
+    )
+    expect(page).not.toContain("refresh")
+  })
+})
+
+describe("withPageLayout", () => {
+  it("should add an @page rule after the page's own styles", () => {
+    const html = withPageLayout(
+      "<style>@page { size: portrait; }</style><p>Hi</p>",
+      { orientation: "landscape", margins: { left: 30 } },
+      "A4"
+    )
+    expect(html).toContain(
+      "<p>Hi</p>\n<style>@page { size: A4 landscape; margin-left: 30mm; }</style>"
+    )
+  })
+
+  it("should leave the page alone without an orientation or margins", () => {
+    expect(withPageLayout("<p>Hi</p>", {}, "A4")).toBe("<p>Hi</p>")
+  })
+})
+
+describe("inlineLocalImages", () => {
+  it("should inline relative images as data: URIs", () => {
+    const html = inlineLocalImages('<img alt="Chart" src="chart.png">', fixturesDir)
+    expect(html).toMatch(/^<img alt="Chart" src="data:image\/png;base64,[A-Za-z0-9+/=]+">$/)
+  })
+
+  it("should inline absolute paths and file: URLs", () => {
+    const path = join(fixturesDir, "chart.png")
+    const html = inlineLocalImages(`<img src='${path}'><img src="file://${path}">`)
+    expect(html.match(/data:image\/png;base64,/g)).toHaveLength(2)
+  })
+
+  it("should leave remote, missing, and disallowed images untouched", () => {
+    const html = [
+      '<img src="https://example.com/logo.png">',
+      '<img src="missing.png">',
+      '<img src="/etc/hosts">',
+      '<img src="../../unit/html.test.ts">',
+    ].join("")
+    expect(inlineLocalImages(html, fixturesDir)).toBe(html)
+  })
+
+  it("should not resolve relative paths in inline content", () => {
+    const html = '<img src="chart.png">'
+    expect(inlineLocalImages(html)).toBe(html)
+  })
+})
+
+describe("layoutHtmlToPdf", () => {
+  it("should lay out headings, paragraphs, and tables, skipping the head and scripts", () => {
+    const document = new PdfDocument(layoutHtmlToPdf(readFileSync(reportPath, "utf-8")))
+    expect(document.getPages()).toHaveLength(1)
+    const text = pageText(document, 0)
+    expect(text[0]).toBe("Quarterly Report")
+    // Text is drawn in WinAnsi, where ’ is 0x92
+    expect(text.join(" ")).toContain("last year\x92s figures")
+    for (const cell of ["Region", "Q3 2026", "North", "1,200", "West", "1,390"]) {
+      expect(text).toContain(cell)
+    }
+    expect(text.join(" ")).not.toContain("changed by a script")
+    expect(text.join(" ")).not.toContain("border-collapse")
+  })
+
+  it("should embed inlined PNGs with their alpha channel and show others as alt text", () => {
+    const html = inlineLocalImages(readFileSync(reportPath, "utf-8"), fixturesDir)
+    const document = new PdfDocument(layoutHtmlToPdf(html))
+    const images = pageImages(document, 0)
+    expect(images).toHaveLength(1)
+    expect(images[0].dict.get("Width")).toBe(48)
+    expect(images[0].dict.get("Height")).toBe(24)
+    expect(images[0].dict.has("SMask")).toBe(true)
+    expect(pageText(document, 0)).toContain("[image: Company logo]")
+  })
+
+  it("should use the requested paper size and move long documents to new pages", () => {
+    const html = Array.from({ length: 120 }, (_, i) => `<p>Paragraph ${i + 1}</p>`).join("")
+    const document = new PdfDocument(layoutHtmlToPdf(html, "A4"))
+    const pages = document.getPages()
+    expect(pages.length).toBeGreaterThan(1)
+    expect(pages[0].dict.get("MediaBox")).toEqual([0, 0, 595.28, 841.89])
+    expect(pageText(document, pages.length - 1)).toContain("Paragraph 120")
+  })
+
+  it("should turn the page for landscape", () => {
+    const landscape = { orientation: "landscape" } as const
+    const letter = new PdfDocument(layoutHtmlToPdf("<p>Hi</p>", "Letter", landscape))
+    expect(letter.getPages()[0].dict.get("MediaBox")).toEqual([0, 0, 792, 612])
+    const a4 = new PdfDocument(layoutHtmlToPdf("<p>Hi</p>", "A4", landscape))
+    expect(a4.getPages()[0].dict.get("MediaBox")).toEqual([0, 0, 841.89, 595.28])
+  })
+
+  it("should fit fewer paragraphs on a page with wider margins", () => {
+    const html = Array.from({ length: 120 }, (_, i) => `<p>Paragraph ${i + 1}</p>`).join("")
+    const pageCount = (layout = {}) =>
+      new PdfDocument(layoutHtmlToPdf(html, "Letter", layout)).getPages().length
+    expect(pageCount({ margins: { top: 50, bottom: 50 } })).toBeGreaterThan(pageCount())
+  })
+
+  it("should number ordered lists and bullet unordered ones", () => {
+    const html = "<ol><li>First</li><li>Second</li></ol><ul><li>Item</li></ul>"
+    const text = pageText(new PdfDocument(layoutHtmlToPdf(html)), 0)
+    // • is 0x95 in WinAnsi
+    expect(text).toEqual(["1.", "First", "2.", "Second", "\x95", "Item"])
+  })
+})
+
+describe("renderHtmlToPdf", () => {
+  beforeEach(() => {
+    vi.mocked(convertHtmlToPdf).mockClear()
+    vi.mocked(findChrome).mockResolvedValue("/usr/bin/chromium")
+  })
+
+  it("should render with Chrome in the sandbox, with local images inlined", async () => {
+    const rendered = await renderHtmlToPdf(reportPath)
+    expect(rendered).toEqual({
+      pdfPath: "/tmp/mcp-printer-html-test/output.pdf",
+      renderType: "html → PDF",
+    })
+    const [html, options] = vi.mocked(convertHtmlToPdf).mock.calls[0]
+    expect(html).toContain('http-equiv="Content-Security-Policy"')
+    expect(html).toContain('src="data:image/png;base64,')
+    expect(html).toContain('src="https://example.com/logo.png"')
+    expect(options).toMatchObject({
+      chromeFlags: SANDBOX_CHROME_FLAGS,
+      tempDirPrefix: "html-",
+    })
+  })
+
+  it("should keep scripts disabled when remote resources are allowed", async () => {
+    await renderHtmlContentToPdf("<p>Hi</p>", { allowRemoteResources: true })
+    const [html, options] = vi.mocked(convertHtmlToPdf).mock.calls[0]
+    expect(html).toContain("https:")
+    expect(options?.chromeFlags).toEqual(["--blink-settings=scriptEnabled=false"])
+  })
+
+  it("should use the basic layout when Chrome isn't found", async () => {
+    vi.mocked(findChrome).mockRejectedValue(new Error("Chrome not found"))
+    const rendered = await renderHtmlToPdf(reportPath, { media: "A4" })
+    try {
+      expect(convertHtmlToPdf).not.toHaveBeenCalled()
+      expect(rendered.renderType).toBe("html → PDF (basic layout, Chrome not found)")
+      const document = new PdfDocument(readFileSync(rendered.pdfPath))
+      expect(document.getPages()[0].dict.get("MediaBox")).toEqual([0, 0, 595.28, 841.89])
+      expect(pageImages(document, 0)).toHaveLength(1)
+    } finally {
+      rmSync(dirname(rendered.pdfPath), { recursive: true, force: true })
+    }
+  })
+
+  it("should lay out the page with the orientation and margins for Chrome", async () => {
+    await renderHtmlContentToPdf("<p>Hi</p>", { orientation: "landscape", margins: { top: 20 } })
+    const [html] = vi.mocked(convertHtmlToPdf).mock.calls[0]
+    expect(html).toContain("@page { size: landscape; margin-top: 20mm; }")
+  })
+
+  it("should reject zero and negative margins before rendering", async () => {
+    await expect(renderHtmlContentToPdf("<p>Hi</p>", { margins: { top: 0 } })).rejects.toThrow(
+      "Invalid margins.top 0"
+    )
+    await expect(renderHtmlToPdf(reportPath, { margins: { right: -10 } })).rejects.toThrow(
+      "Invalid margins.right -10"
+    )
+    expect(convertHtmlToPdf).not.toHaveBeenCalled()
+  })
+
+  it("should refuse files outside the allowed directories", async () => {
+    await expect(renderHtmlToPdf("/etc/hosts.html")).rejects.toThrow()
+  })
+})
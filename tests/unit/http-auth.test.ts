@@ -0,0 +1,83 @@
+/**
+ * @fileoverview Unit tests for bearer-token authentication on the HTTP transport
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll } from "vitest"
+import type { Server } from "http"
+import type { AddressInfo } from "net"
+import { isAuthorized, startHttpServer, MCP_ENDPOINT } from "../../src/http-server.js"
+
+describe("isAuthorized", () => {
+  const cases = [
+    { header: "Bearer s3cret", expected: true },
+    { header: "bearer s3cret", expected: true },
+    { header: "Bearer wrong", expected: false },
+    { header: "Bearer s3cret-and-more", expected: false },
+    { header: "Bearer ", expected: false },
+    { header: "Basic s3cret", expected: false },
+    { header: "s3cret", expected: false },
+    { header: undefined, expected: false },
+  ]
+
+  for (const { header, expected } of cases) {
+    it(`should return ${expected} for ${JSON.stringify(header)}`, () => {
+      expect(isAuthorized(header, "s3cret")).toBe(expected)
+    })
+  }
+})
+
+describe("HTTP transport authentication", () => {
+  const createMcpServer = vi.fn()
+  let server: Server
+  let endpoint: string
+
+  beforeAll(async () => {
+    server = await startHttpServer(
+      createMcpServer,
+      { host: "127.0.0.1", port: 0 },
+      { authToken: "s3cret" }
+    )
+    endpoint = `http://127.0.0.1:${(server.address() as AddressInfo).port}${MCP_ENDPOINT}`
+  })
+
+  afterAll(async () => {
+    await new Promise((resolve) => server.close(resolve))
+  })
+
+  function initialize(headers: Record<string, string> = {}) {
+    return fetch(endpoint, {
+      method: "POST",
+      headers: { "Content-Type": "application/json", ...headers },
+      body: JSON.stringify({ jsonrpc: "2.0", id: 1, method: "initialize", params: {} }),
+    })
+  }
+
+  it("should reject requests without an Authorization header", async () => {
+    const response = await initialize()
+
+    expect(response.status).toBe(401)
+    expect(response.headers.get("www-authenticate")).toMatch(/^Bearer/)
+    expect(createMcpServer).not.toHaveBeenCalled()
+  })
+
+  it("should reject the wrong token", async () => {
+    const response = await initialize({ Authorization: "Bearer nope" })
+
+    expect(response.status).toBe(401)
+    expect(await response.text()).not.toContain("s3cret")
+    expect(createMcpServer).not.toHaveBeenCalled()
+  })
+
+  it("should reject unauthenticated requests to any path", async () => {
+    const response = await fetch(endpoint.replace(MCP_ENDPOINT, "/other"))
+
+    expect(response.status).toBe(401)
+  })
+
+  it("should let requests with the right token through to the MCP endpoint", async () => {
+    const response = await fetch(endpoint, { headers: { Authorization: "Bearer s3cret" } })
+
+    // Authenticated, but a GET without a session is rejected by the session handling
+    expect(response.status).toBe(400)
+  })
+})
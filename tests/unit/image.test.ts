@@ -0,0 +1,194 @@
+/**
+ * @fileoverview Unit tests for image header parsing and page layout
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { readFileSync } from "fs"
+import { join } from "path"
+import { convertHtmlToPdf } from "../../src/utils.js"
+import {
+  buildImageHtml,
+  computeImageLayout,
+  displayedSize,
+  isImageFile,
+  readImageInfo,
+  renderImageDataToPdf,
+} from "../../src/renderers/image.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    imageMarginMm: 6,
+    allowedPaths: [],
+    deniedPaths: [],
+  },
+}))
+
+vi.mock("../../src/utils.js", () => ({
+  convertHtmlToPdf: vi.fn().mockResolvedValue("/tmp/mcp-printer-image-test/output.pdf"),
+}))
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures", "images")
+
+function fixture(name: string): Buffer {
+  return readFileSync(join(fixturesDir, name))
+}
+
+describe("readImageInfo", () => {
+  const cases = [
+    { file: "landscape.png", mimeType: "image/png", width: 60, height: 30, orientation: 1 },
+    { file: "portrait.gif", mimeType: "image/gif", width: 20, height: 40, orientation: 1 },
+    { file: "exif-rotated.jpg", mimeType: "image/jpeg", width: 32, height: 16, orientation: 6 },
+    { file: "square.webp", mimeType: "image/webp", width: 1, height: 1, orientation: 1 },
+  ]
+
+  for (const { file, ...expected } of cases) {
+    it(`should read the header of ${file}`, () => {
+      expect(readImageInfo(fixture(file))).toEqual(expected)
+    })
+  }
+
+  it("should reject other formats", () => {
+    expect(() => readImageInfo(Buffer.from("%PDF-1.4\n"))).toThrow(/Unsupported image format/)
+  })
+
+  it("should reject a JPEG without a frame header", () => {
+    const truncated = fixture("exif-rotated.jpg").subarray(0, 60)
+
+    expect(() => readImageInfo(truncated)).toThrow(/no frame header/)
+  })
+})
+
+describe("displayedSize", () => {
+  it("should swap width and height for EXIF orientations that rotate by 90 degrees", () => {
+    expect(displayedSize(readImageInfo(fixture("exif-rotated.jpg")))).toEqual({
+      width: 16,
+      height: 32,
+    })
+  })
+
+  it("should keep the stored size otherwise", () => {
+    expect(displayedSize(readImageInfo(fixture("landscape.png")))).toEqual({
+      width: 60,
+      height: 30,
+    })
+  })
+})
+
+describe("isImageFile", () => {
+  it("should match image extensions case-insensitively", () => {
+    expect(isImageFile("photo.JPG")).toBe(true)
+    expect(isImageFile("scan.webp")).toBe(true)
+    expect(isImageFile("scan.tiff")).toBe(false)
+    expect(isImageFile("notes.txt")).toBe(false)
+  })
+})
+
+describe("computeImageLayout", () => {
+  const defaults = { fit: "contain", orientation: "auto", media: "Letter", marginMm: 0 } as const
+
+  it("should pick a landscape page for a wide image and fit it to the width", () => {
+    const layout = computeImageLayout({ width: 600, height: 300 }, defaults)
+
+    expect(layout).toMatchObject({
+      orientation: "landscape",
+      pageWidth: 792,
+      pageHeight: 612,
+      imageWidth: 792,
+      imageHeight: 396,
+    })
+  })
+
+  it("should pick a portrait page for a tall image", () => {
+    const layout = computeImageLayout({ width: 300, height: 600 }, { ...defaults, media: "A4" })
+
+    expect(layout.orientation).toBe("portrait")
+    expect(layout.pageWidth).toBe(595.28)
+    expect(layout.imageHeight).toBeCloseTo(841.89)
+  })
+
+  it("should honor an explicit orientation", () => {
+    const layout = computeImageLayout(
+      { width: 600, height: 300 },
+      { ...defaults, orientation: "portrait" }
+    )
+
+    expect(layout).toMatchObject({ orientation: "portrait", pageWidth: 612, imageWidth: 612 })
+  })
+
+  it("should cover the printable area with fill", () => {
+    const layout = computeImageLayout(
+      { width: 600, height: 300 },
+      { ...defaults, orientation: "portrait", fit: "fill" }
+    )
+
+    expect(layout.imageHeight).toBe(792)
+    expect(layout.imageWidth).toBe(1584)
+  })
+
+  it("should print at 96 DPI with actual-size", () => {
+    const layout = computeImageLayout(
+      { width: 96, height: 192 },
+      { ...defaults, fit: "actual-size" }
+    )
+
+    expect(layout.imageWidth).toBe(72)
+    expect(layout.imageHeight).toBe(144)
+  })
+
+  it("should subtract the margins from the printable area", () => {
+    const layout = computeImageLayout({ width: 100, height: 100 }, { ...defaults, marginMm: 25.4 })
+
+    expect(layout.areaWidth).toBeCloseTo(468)
+    expect(layout.imageWidth).toBeCloseTo(468)
+  })
+
+  it("should reject margins that leave no printable area", () => {
+    expect(() =>
+      computeImageLayout({ width: 100, height: 100 }, { ...defaults, marginMm: 200 })
+    ).toThrow(/leaves no printable area/)
+  })
+})
+
+describe("renderImageDataToPdf", () => {
+  beforeEach(() => {
+    vi.mocked(convertHtmlToPdf).mockClear()
+  })
+
+  it("should lay out an EXIF-rotated JPEG on a portrait page", async () => {
+    await renderImageDataToPdf(fixture("exif-rotated.jpg"), { media: "Letter" })
+
+    const html = vi.mocked(convertHtmlToPdf).mock.calls[0][0]
+    expect(html).toContain("size: 612pt 792pt;")
+    expect(html).toContain("image-orientation: from-image;")
+    expect(html).toContain('src="data:image/jpeg;base64,')
+  })
+
+  it("should use the configured margin by default", async () => {
+    await renderImageDataToPdf(fixture("landscape.png"))
+
+    const html = vi.mocked(convertHtmlToPdf).mock.calls[0][0]
+    expect(html).toContain("size: 792pt 612pt;")
+    expect(html).toContain("top: 6mm;")
+  })
+})
+
+describe("buildImageHtml", () => {
+  it("should center the image in the printable area", () => {
+    const html = buildImageHtml(
+      "data:image/png;base64,",
+      {
+        orientation: "portrait",
+        pageWidth: 612,
+        pageHeight: 792,
+        areaWidth: 600,
+        areaHeight: 780,
+        imageWidth: 600,
+        imageHeight: 300,
+      },
+      2
+    )
+
+    expect(html).toContain("left: 0pt;")
+    expect(html).toContain("top: 240pt;")
+  })
+})
@@ -0,0 +1,287 @@
+/**
+ * @fileoverview Unit tests for the IPP client, run against a local HTTP server
+ * that replays IPP byte fixtures
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll, beforeEach } from "vitest"
+import { createServer, type Server } from "http"
+import { readFileSync } from "fs"
+import { join } from "path"
+import type { AddressInfo } from "net"
+import { config } from "../../src/config.js"
+import {
+  cancelIppJob,
+  getIppJobStatus,
+  getPrinterAttributes,
+  ippUriToHttpUrl,
+  parseIppJobId,
+  submitIppJob,
+} from "../../src/ipp/client.js"
+import { cupsOptionsToIppAttributes } from "../../src/ipp/options.js"
+import {
+  decodeIppMessage,
+  getAttributeValues,
+  GROUP_TAGS,
+  OPERATIONS,
+  VALUE_TAGS,
+  type IppMessage,
+} from "../../src/ipp/encoding.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    ippInsecureTls: false,
+    cupsServer: "",
+    cupsEncryption: "ifrequested",
+  },
+}))
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures", "ipp")
+
+function fixture(name: string): Buffer {
+  return readFileSync(join(fixturesDir, name))
+}
+
+describe("IPP client", () => {
+  let server: Server
+  let printerUri: string
+  let requests: IppMessage[]
+  let responseBody: Buffer
+  let responseStatus: number
+
+  beforeAll(async () => {
+    server = createServer((req, res) => {
+      const chunks: Buffer[] = []
+      req.on("data", (chunk: Buffer) => chunks.push(chunk))
+      req.on("end", () => {
+        requests.push(decodeIppMessage(Buffer.concat(chunks)))
+        res.writeHead(responseStatus, { "Content-Type": "application/ipp" })
+        res.end(responseBody)
+      })
+    })
+    await new Promise<void>((resolve) => server.listen(0, "127.0.0.1", resolve))
+    printerUri = `ipp://127.0.0.1:${(server.address() as AddressInfo).port}/ipp/print`
+  })
+
+  afterAll(async () => {
+    await new Promise((resolve) => server.close(resolve))
+  })
+
+  beforeEach(() => {
+    requests = []
+    responseStatus = 200
+  })
+
+  it("should send a Print-Job with content as text/plain and return an IPP job ID", async () => {
+    responseBody = fixture("print-job-response.bin")
+
+    const jobId = await submitIppJob({
+      printer: printerUri,
+      title: "Notes",
+      options: ["sides=two-sided-long-edge", "media=A4"],
+      copies: 2,
+      content: "hello",
+    })
+
+    expect(jobId).toBe(`${printerUri}#147`)
+    const [request] = requests
+    expect(request.code).toBe(OPERATIONS.printJob)
+    expect(getAttributeValues(request, GROUP_TAGS.operation, "printer-uri")).toEqual([printerUri])
+    expect(getAttributeValues(request, GROUP_TAGS.operation, "job-name")).toEqual(["Notes"])
+    expect(getAttributeValues(request, GROUP_TAGS.operation, "document-format")).toEqual([
+      "text/plain",
+    ])
+    expect(getAttributeValues(request, GROUP_TAGS.job, "sides")).toEqual(["two-sided-long-edge"])
+    expect(getAttributeValues(request, GROUP_TAGS.job, "media")).toEqual(["iso_a4_210x297mm"])
+    expect(getAttributeValues(request, GROUP_TAGS.job, "copies")).toEqual([2])
+    expect(request.data?.toString()).toBe("hello")
+  })
+
+  it("should send files with a document format based on the extension", async () => {
+    responseBody = fixture("print-job-response.bin")
+
+    await submitIppJob({
+      printer: printerUri,
+      filePath: join(fixturesDir, "print-job-request.bin"),
+    })
+
+    expect(getAttributeValues(requests[0], GROUP_TAGS.operation, "document-format")).toEqual([
+      "application/octet-stream",
+    ])
+    expect(requests[0].data?.equals(fixture("print-job-request.bin"))).toBe(true)
+  })
+
+  it("should send raw jobs as application/octet-stream, without the raw option", async () => {
+    responseBody = fixture("print-job-response.bin")
+
+    await submitIppJob({
+      printer: printerUri,
+      options: ["raw"],
+      content: Buffer.from("^XA^FDHello^FS^XZ"),
+    })
+
+    expect(getAttributeValues(requests[0], GROUP_TAGS.operation, "document-format")).toEqual([
+      "application/octet-stream",
+    ])
+    expect(getAttributeValues(requests[0], GROUP_TAGS.job, "raw")).toEqual([])
+    expect(requests[0].data?.toString()).toBe("^XA^FDHello^FS^XZ")
+  })
+
+  it("should decode printer attributes", async () => {
+    responseBody = fixture("get-printer-attributes-response.bin")
+
+    const attributes = await getPrinterAttributes(printerUri)
+
+    expect(requests[0].code).toBe(OPERATIONS.getPrinterAttributes)
+    expect(attributes["sides-supported"]).toContain("two-sided-long-edge")
+    expect(attributes["color-supported"]).toEqual([false])
+  })
+
+  it("should map job attributes to a job status", async () => {
+    responseBody = fixture("get-job-attributes-response.bin")
+
+    const status = await getIppJobStatus(`${printerUri}#147`)
+
+    expect(getAttributeValues(requests[0], GROUP_TAGS.operation, "job-id")).toEqual([147])
+    expect(status).toEqual({
+      job_id: `${printerUri}#147`,
+      state: "completed",
+      printer: printerUri,
+      user: "steve",
+      size: 12 * 1024,
+      submitted: "2024-01-15T15:29:58.000Z",
+      alerts: ["job-completed-successfully"],
+    })
+  })
+
+  it("should report jobs the printer does not know as not-found", async () => {
+    responseBody = fixture("not-found-response.bin")
+
+    const status = await getIppJobStatus(`${printerUri}#999`)
+
+    expect(status).toEqual({ job_id: `${printerUri}#999`, state: "not-found", printer: printerUri })
+  })
+
+  it("should surface IPP error statuses with the status message", async () => {
+    responseBody = fixture("not-found-response.bin")
+
+    await expect(cancelIppJob(`${printerUri}#999`)).rejects.toThrow(
+      /client-error-not-found \(Job #999 does not exist\.\)/
+    )
+    expect(requests[0].code).toBe(OPERATIONS.cancelJob)
+  })
+
+  it("should surface HTTP errors", async () => {
+    responseStatus = 503
+    responseBody = Buffer.alloc(0)
+
+    await expect(getPrinterAttributes(printerUri)).rejects.toThrow(/returned HTTP 503/)
+  })
+
+  it("should report unreachable printers", async () => {
+    await expect(getPrinterAttributes("ipp://127.0.0.1:1/ipp/print")).rejects.toThrow(
+      /Failed to reach printer at 127\.0\.0\.1:1/
+    )
+    await expect(getPrinterAttributes("ipp://127.0.0.1:1/ipp/print")).rejects.toMatchObject({
+      code: "PRINTER_UNREACHABLE",
+    })
+  })
+})
+
+describe("ippUriToHttpUrl", () => {
+  const cases = [
+    { uri: "ipp://printer.local/ipp/print", expected: "http://printer.local:631/ipp/print" },
+    { uri: "ipps://printer.local/ipp/print", expected: "https://printer.local:631/ipp/print" },
+    { uri: "ipp://10.0.0.5:8631/printers/Office", expected: "http://10.0.0.5:8631/printers/Office" },
+    { uri: "ipp://10.0.0.5:80/ipp", expected: "http://10.0.0.5/ipp" },
+  ]
+
+  for (const { uri, expected } of cases) {
+    it(`should map ${uri}`, () => {
+      expect(ippUriToHttpUrl(uri).href).toBe(expected)
+    })
+  }
+
+  it("should use TLS for the CUPS server's queues when its encryption is always", () => {
+    vi.mocked(config).cupsServer = "printserver.example.com"
+    vi.mocked(config).cupsEncryption = "always"
+    try {
+      expect(ippUriToHttpUrl("ipp://PrintServer.example.com/printers/Office").href).toBe(
+        "https://printserver.example.com:631/printers/Office"
+      )
+      expect(ippUriToHttpUrl("ipp://printserver.example.com:8631/printers/Office").href).toBe(
+        "http://printserver.example.com:8631/printers/Office"
+      )
+      expect(ippUriToHttpUrl("ipp://printer.local/ipp/print").href).toBe(
+        "http://printer.local:631/ipp/print"
+      )
+    } finally {
+      vi.mocked(config).cupsServer = ""
+      vi.mocked(config).cupsEncryption = "ifrequested"
+    }
+  })
+
+  it("should reject non-IPP URIs", () => {
+    expect(() => ippUriToHttpUrl("http://printer.local/")).toThrow(/expected ipp:\/\/ or ipps:\/\//)
+  })
+})
+
+describe("parseIppJobId", () => {
+  it("should split an IPP job ID into printer URI and job-id", () => {
+    expect(parseIppJobId("ipps://printer.local/ipp/print#42")).toEqual({
+      printerUri: "ipps://printer.local/ipp/print",
+      jobId: 42,
+    })
+  })
+
+  it("should not match CUPS job IDs", () => {
+    expect(parseIppJobId("Office_HP-123")).toBeNull()
+    expect(parseIppJobId("123")).toBeNull()
+  })
+})
+
+describe("cupsOptionsToIppAttributes", () => {
+  it("should translate common CUPS options", () => {
+    expect(
+      cupsOptionsToIppAttributes(
+        ["landscape", "page-ranges=1-3,7", "number-up=2", "media=Letter", "collate=true"],
+        3
+      )
+    ).toEqual([
+      { name: "orientation-requested", tag: VALUE_TAGS.enum, values: [4] },
+      {
+        name: "page-ranges",
+        tag: VALUE_TAGS.rangeOfInteger,
+        values: [
+          { lower: 1, upper: 3 },
+          { lower: 7, upper: 7 },
+        ],
+      },
+      { name: "number-up", tag: VALUE_TAGS.integer, values: [2] },
+      { name: "media", tag: VALUE_TAGS.keyword, values: ["na_letter_8.5x11in"] },
+      { name: "collate", tag: VALUE_TAGS.boolean, values: [true] },
+      { name: "copies", tag: VALUE_TAGS.integer, values: [3] },
+    ])
+  })
+
+  it("should send print-quality as an enum and print-color-mode as a keyword", () => {
+    expect(cupsOptionsToIppAttributes(["print-color-mode=monochrome", "print-quality=5"])).toEqual([
+      { name: "print-color-mode", tag: VALUE_TAGS.keyword, values: ["monochrome"] },
+      { name: "print-quality", tag: VALUE_TAGS.enum, values: [5] },
+    ])
+  })
+
+  it("should send job-hold-until times as names and periods as keywords", () => {
+    expect(cupsOptionsToIppAttributes(["job-hold-until=22:30:00"])).toEqual([
+      { name: "job-hold-until", tag: VALUE_TAGS.nameWithoutLanguage, values: ["22:30:00"] },
+    ])
+    expect(cupsOptionsToIppAttributes(["job-hold-until=indefinite"])).toEqual([
+      { name: "job-hold-until", tag: VALUE_TAGS.keyword, values: ["indefinite"] },
+    ])
+  })
+
+  it("should let later options override earlier ones", () => {
+    expect(
+      cupsOptionsToIppAttributes(["sides=two-sided-long-edge", "sides=one-sided"], 1)
+    ).toEqual([{ name: "sides", tag: VALUE_TAGS.keyword, values: ["one-sided"] }])
+  })
+})
@@ -0,0 +1,220 @@
+/**
+ * @fileoverview Unit tests for IPP message encoding and decoding against byte fixtures
+ */
+
+import { describe, it, expect } from "vitest"
+import { readFileSync } from "fs"
+import { join } from "path"
+import {
+  decodeIppMessage,
+  encodeIppMessage,
+  getAttributeValues,
+  GROUP_TAGS,
+  OPERATIONS,
+  VALUE_TAGS,
+  type IppMessage,
+} from "../../src/ipp/encoding.js"
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures", "ipp")
+
+function fixture(name: string): Buffer {
+  return readFileSync(join(fixturesDir, name))
+}
+
+describe("encodeIppMessage", () => {
+  it("should encode a Print-Job request byte-for-byte", () => {
+    const request: IppMessage = {
+      version: [2, 0],
+      code: OPERATIONS.printJob,
+      requestId: 1,
+      groups: [
+        {
+          tag: GROUP_TAGS.operation,
+          attributes: [
+            { name: "attributes-charset", tag: VALUE_TAGS.charset, values: ["utf-8"] },
+            {
+              name: "attributes-natural-language",
+              tag: VALUE_TAGS.naturalLanguage,
+              values: ["en-us"],
+            },
+            {
+              name: "printer-uri",
+              tag: VALUE_TAGS.uri,
+              values: ["ipp://printer.example.com/ipp/print/pinetree"],
+            },
+            { name: "job-name", tag: VALUE_TAGS.nameWithoutLanguage, values: ["foobar"] },
+            { name: "ipp-attribute-fidelity", tag: VALUE_TAGS.boolean, values: [true] },
+            { name: "document-format", tag: VALUE_TAGS.mimeMediaType, values: ["application/pdf"] },
+          ],
+        },
+        {
+          tag: GROUP_TAGS.job,
+          attributes: [
+            { name: "copies", tag: VALUE_TAGS.integer, values: [20] },
+            { name: "sides", tag: VALUE_TAGS.keyword, values: ["two-sided-long-edge"] },
+            {
+              name: "page-ranges",
+              tag: VALUE_TAGS.rangeOfInteger,
+              values: [
+                { lower: 1, upper: 3 },
+                { lower: 7, upper: 7 },
+              ],
+            },
+          ],
+        },
+      ],
+      data: Buffer.from("%PDF-1.4\n%mock document\n"),
+    }
+
+    expect(encodeIppMessage(request).equals(fixture("print-job-request.bin"))).toBe(true)
+  })
+
+  it("should round-trip collections, resolutions, and dates", () => {
+    const message: IppMessage = {
+      version: [2, 0],
+      code: 0,
+      requestId: 9,
+      groups: [
+        {
+          tag: GROUP_TAGS.printer,
+          attributes: [
+            {
+              name: "media-col",
+              tag: VALUE_TAGS.begCollection,
+              values: [
+                {
+                  members: [
+                    { name: "media-type", tag: VALUE_TAGS.keyword, values: ["stationery"] },
+                    { name: "media-top-margin", tag: VALUE_TAGS.integer, values: [0] },
+                  ],
+                },
+              ],
+            },
+            {
+              name: "printer-resolution-default",
+              tag: VALUE_TAGS.resolution,
+              values: [{ x: 300, y: 600, units: 3 }],
+            },
+            {
+              name: "printer-current-time",
+              tag: VALUE_TAGS.dateTime,
+              values: [new Date("2024-03-01T08:15:30.000Z")],
+            },
+          ],
+        },
+      ],
+    }
+
+    expect(decodeIppMessage(encodeIppMessage(message))).toEqual(message)
+  })
+})
+
+describe("decodeIppMessage", () => {
+  it("should decode a Print-Job request including its document data", () => {
+    const message = decodeIppMessage(fixture("print-job-request.bin"))
+
+    expect(message.version).toEqual([2, 0])
+    expect(message.code).toBe(OPERATIONS.printJob)
+    expect(message.requestId).toBe(1)
+    expect(getAttributeValues(message, GROUP_TAGS.job, "page-ranges")).toEqual([
+      { lower: 1, upper: 3 },
+      { lower: 7, upper: 7 },
+    ])
+    expect(message.data?.toString()).toBe("%PDF-1.4\n%mock document\n")
+  })
+
+  it("should decode a Print-Job response", () => {
+    const message = decodeIppMessage(fixture("print-job-response.bin"))
+
+    expect(message.code).toBe(0x0000)
+    expect(message.data).toBeUndefined()
+    expect(getAttributeValues(message, GROUP_TAGS.operation, "status-message")).toEqual([
+      "successful-ok",
+    ])
+    expect(getAttributeValues(message, GROUP_TAGS.job, "job-id")).toEqual([147])
+    expect(getAttributeValues(message, GROUP_TAGS.job, "job-state")).toEqual([3])
+    expect(getAttributeValues(message, GROUP_TAGS.job, "job-uri")).toEqual([
+      "ipp://printer.example.com/ipp/print/pinetree/147",
+    ])
+  })
+
+  describe("Get-Printer-Attributes response", () => {
+    const message = decodeIppMessage(fixture("get-printer-attributes-response.bin"))
+    const values = (name: string) => getAttributeValues(message, GROUP_TAGS.printer, name)
+
+    const cases: Array<{ name: string; expected: unknown[] }> = [
+      { name: "printer-name", expected: ["Office LaserJet"] },
+      { name: "printer-make-and-model", expected: ["HP LaserJet Pro M404"] },
+      { name: "printer-state", expected: [3] },
+      { name: "printer-state-reasons", expected: ["media-low-report", "toner-low-warning"] },
+      { name: "printer-is-accepting-jobs", expected: [true] },
+      { name: "color-supported", expected: [false] },
+      {
+        name: "sides-supported",
+        expected: ["one-sided", "two-sided-long-edge", "two-sided-short-edge"],
+      },
+      {
+        name: "media-supported",
+        expected: ["iso_a4_210x297mm", "na_letter_8.5x11in", "na_legal_8.5x14in"],
+      },
+      {
+        name: "printer-resolution-supported",
+        expected: [
+          { x: 600, y: 600, units: 3 },
+          { x: 1200, y: 1200, units: 3 },
+        ],
+      },
+      { name: "printer-current-time", expected: [new Date("2024-01-15T15:30:00.000Z")] },
+      { name: "printer-location", expected: [null] },
+    ]
+
+    for (const { name, expected } of cases) {
+      it(`should decode ${name}`, () => {
+        expect(values(name)).toEqual(expected)
+      })
+    }
+
+    it("should decode nested collections", () => {
+      expect(values("media-col-default")).toEqual([
+        {
+          members: [
+            {
+              name: "media-size",
+              tag: VALUE_TAGS.begCollection,
+              values: [
+                {
+                  members: [
+                    { name: "x-dimension", tag: VALUE_TAGS.integer, values: [21000] },
+                    { name: "y-dimension", tag: VALUE_TAGS.integer, values: [29700] },
+                  ],
+                },
+              ],
+            },
+            { name: "media-type", tag: VALUE_TAGS.keyword, values: ["stationery"] },
+          ],
+        },
+      ])
+    })
+
+    it("should end the collection without starting a new attribute or group", () => {
+      const printerGroup = message.groups.find((g) => g.tag === GROUP_TAGS.printer)
+      expect(printerGroup?.attributes.at(-1)?.name).toBe("media-col-default")
+      expect(message.groups.map((g) => g.tag)).toEqual([GROUP_TAGS.operation, GROUP_TAGS.printer])
+    })
+  })
+
+  it("should decode an error status", () => {
+    const message = decodeIppMessage(fixture("not-found-response.bin"))
+
+    expect(message.code).toBe(0x0406)
+    expect(getAttributeValues(message, GROUP_TAGS.operation, "status-message")).toEqual([
+      "Job #999 does not exist.",
+    ])
+  })
+
+  it("should reject truncated messages", () => {
+    const truncated = fixture("print-job-response.bin").subarray(0, 40)
+
+    expect(() => decodeIppMessage(truncated)).toThrow(/unexpected end of data/)
+  })
+})
@@ -0,0 +1,195 @@
+/**
+ * @fileoverview Unit tests for the job history ledger
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, readFileSync, rmSync, writeFileSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import { getJobStatus } from "../../src/cups.js"
+import { getIppJobStatus } from "../../src/ipp/client.js"
+import { listRecentJobs, MAX_HISTORY_ENTRIES, recordJob } from "../../src/job-history.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "cups",
+    historyFile: "",
+  },
+}))
+
+vi.mock("../../src/cups.js", () => ({
+  getJobStatus: vi.fn(),
+}))
+
+vi.mock("../../src/ipp/client.js", () => ({
+  getIppJobStatus: vi.fn(),
+  parseIppJobId: (jobId: string) => (jobId.startsWith("ipp://") ? { jobId: 1 } : null),
+}))
+
+vi.mock("../../src/utils.js", () => ({
+  getPdfPageCount: vi.fn().mockRejectedValue(new Error("Not a PDF")),
+}))
+
+describe("job history", () => {
+  let tempDir: string
+
+  beforeEach(() => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-history-test-"))
+    config.historyFile = join(tempDir, "mcp-printer", "history.json")
+    vi.mocked(getJobStatus).mockReset()
+    vi.mocked(getIppJobStatus).mockReset()
+  })
+
+  afterEach(() => {
+    rmSync(tempDir, { recursive: true, force: true })
+  })
+
+  function ledger() {
+    return JSON.parse(readFileSync(config.historyFile, "utf-8")).jobs
+  }
+
+  it("should return an empty history when nothing has been printed", async () => {
+    expect(await listRecentJobs(20)).toEqual([])
+  })
+
+  it("should record jobs and list them newest first", async () => {
+    await recordJob({ jobId: "Office-1", tool: "print_file", printer: "Office", title: "a.pdf" })
+    await recordJob({ jobId: "Office-2", tool: "print_text", printer: "Office", title: "Notes" })
+    vi.mocked(getJobStatus).mockResolvedValue({ job_id: "", state: "completed" })
+
+    const jobs = await listRecentJobs(20)
+
+    expect(jobs.map((job) => job.job_id)).toEqual(["Office-2", "Office-1"])
+    expect(jobs[0]).toMatchObject({
+      tool: "print_text",
+      printer: "Office",
+      title: "Notes",
+      status: "completed",
+    })
+    expect(jobs[0].submitted_at).toMatch(/^\d{4}-\d{2}-\d{2}T/)
+  })
+
+  it("should record the attempts of jobs that were retried", async () => {
+    await recordJob({ jobId: "Office-1", tool: "print_file", printer: "Office", title: "a" })
+    await recordJob({
+      jobId: "Office-2",
+      tool: "print_file",
+      printer: "Office",
+      title: "b",
+      attempts: 3,
+    })
+    vi.mocked(getJobStatus).mockResolvedValue({ job_id: "", state: "completed" })
+
+    const [retried, first] = await listRecentJobs(20)
+
+    expect(retried.attempts).toBe(3)
+    expect(first).not.toHaveProperty("attempts")
+  })
+
+  it("should record the session and client, and list a session's own jobs", async () => {
+    const job = { tool: "print_file", printer: "Office", title: "f" }
+    await recordJob({ ...job, jobId: "Office-1", session: "session-a", client: "alice 1.0.0" })
+    await recordJob({ ...job, jobId: "Office-2", session: "session-b", client: "bob 2.1.0" })
+    await recordJob({ ...job, jobId: "Office-3" })
+    vi.mocked(getJobStatus).mockResolvedValue({ job_id: "", state: "completed" })
+
+    expect(ledger()[0]).toMatchObject({ session: "session-a", client: "alice 1.0.0" })
+    expect(ledger()[2]).not.toHaveProperty("session")
+
+    const mine = await listRecentJobs(20, undefined, { session: "session-a" })
+    expect(mine.map((job) => job.job_id)).toEqual(["Office-1"])
+    expect(mine[0].client).toBe("alice 1.0.0")
+    // The stdio client's jobs are the ones no session queued
+    const stdio = await listRecentJobs(20, undefined, { session: undefined })
+    expect(stdio.map((job) => job.job_id)).toEqual(["Office-3"])
+
+    const all = await listRecentJobs(20)
+    expect(all.map((job) => job.job_id)).toEqual(["Office-3", "Office-2", "Office-1"])
+    for (const listed of [...mine, ...all]) {
+      expect(listed).not.toHaveProperty("session")
+    }
+  })
+
+  it("should apply the limit", async () => {
+    for (let i = 1; i <= 5; i++) {
+      await recordJob({ jobId: `Office-${i}`, tool: "print_file", printer: "Office", title: "f" })
+    }
+    vi.mocked(getJobStatus).mockResolvedValue({ job_id: "", state: "pending" })
+
+    const jobs = await listRecentJobs(2)
+
+    expect(jobs.map((job) => job.job_id)).toEqual(["Office-5", "Office-4"])
+  })
+
+  it("should persist refreshed states and stop polling finished jobs", async () => {
+    await recordJob({ jobId: "Office-7", tool: "print_file", printer: "Office", title: "f" })
+    vi.mocked(getJobStatus).mockResolvedValue({ job_id: "Office-7", state: "completed" })
+
+    await listRecentJobs(20)
+    await listRecentJobs(20)
+
+    expect(getJobStatus).toHaveBeenCalledTimes(1)
+    expect(ledger()[0]).toMatchObject({ status: "completed" })
+    expect(ledger()[0].status_checked_at).toBeDefined()
+  })
+
+  it("should poll IPP printers for IPP job IDs", async () => {
+    const jobId = "ipp://printer.local/ipp/print#42"
+    const printer = "ipp://printer.local/ipp/print"
+    await recordJob({ jobId, tool: "print_file", printer, title: "f" })
+    vi.mocked(getIppJobStatus).mockResolvedValue({ job_id: jobId, state: "processing" })
+
+    const [job] = await listRecentJobs(1)
+
+    expect(getIppJobStatus).toHaveBeenCalledWith(jobId, undefined)
+    expect(job.status).toBe("processing")
+  })
+
+  it("should keep the last known state when the printer can't be reached", async () => {
+    await recordJob({ jobId: "Office-8", tool: "print_file", printer: "Office", title: "f" })
+    vi.mocked(getJobStatus).mockRejectedValue(new Error("lpstat failed"))
+
+    const [job] = await listRecentJobs(1)
+
+    expect(job.status).toBe("pending")
+  })
+
+  it("should not lose entries when jobs are recorded concurrently", async () => {
+    await Promise.all(
+      Array.from({ length: 25 }, (_, i) =>
+        recordJob({ jobId: `Office-${i}`, tool: "print_file", printer: "Office", title: "f" })
+      )
+    )
+
+    expect(ledger()).toHaveLength(25)
+  })
+
+  it("should cap the ledger at the most recent entries", async () => {
+    const existing = Array.from({ length: MAX_HISTORY_ENTRIES }, (_, i) => ({
+      job_id: `Office-${i}`,
+      tool: "print_file",
+      printer: "Office",
+      title: "f",
+      submitted_at: "2024-01-01T00:00:00.000Z",
+      status: "completed",
+    }))
+    await recordJob({ jobId: "Office-0", tool: "print_file", printer: "Office", title: "f" })
+    writeFileSync(config.historyFile, JSON.stringify({ jobs: existing }))
+
+    await recordJob({ jobId: "Office-new", tool: "print_file", printer: "Office", title: "f" })
+
+    const jobs = ledger()
+    expect(jobs).toHaveLength(MAX_HISTORY_ENTRIES)
+    expect(jobs[0].job_id).toBe("Office-1")
+    expect(jobs[jobs.length - 1].job_id).toBe("Office-new")
+  })
+
+  it("should treat a corrupt ledger as empty", async () => {
+    await recordJob({ jobId: "Office-1", tool: "print_file", printer: "Office", title: "f" })
+    writeFileSync(config.historyFile, "{ not json")
+    vi.spyOn(console, "error").mockImplementation(() => {})
+
+    expect(await listRecentJobs(20)).toEqual([])
+  })
+})
@@ -0,0 +1,830 @@
+/**
+ * @fileoverview Unit tests for the print job queue and render limit, run against a fake backend
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { readFileSync } from "fs"
+import { config } from "../../src/config.js"
+import type { LpJobOptions } from "../../src/cups.js"
+import type { PrintJobOptions } from "../../src/print-options.js"
+import { recordJob } from "../../src/job-history.js"
+import {
+  cancelQueuedJob,
+  cancelWaitingJobs,
+  drainQueue,
+  getPrintJobStatus,
+  getQueuedJob,
+  queuePrintJob,
+  retryDelayMs,
+} from "../../src/job-queue.js"
+import { withRenderSlot } from "../../src/render-limit.js"
+import { closeSession, openSession } from "../../src/sessions.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "cups",
+    allowedPrinters: [],
+    rawAllowedPrinters: ["Zebra_Labels"],
+    defaultPrinter: "",
+    defaultOptions: [],
+    autoDuplex: false,
+    maxCopies: 10,
+    maxConcurrentRenders: 2,
+    maxPagesPerJob: 0,
+    absoluteMaxPages: 0,
+    maxRetries: 3,
+    retryDelaySeconds: 0.001,
+    coverPage: false,
+    coverPageMode: "generate",
+    jobOwner: "Dana",
+  },
+}))
+
+vi.mock("../../src/job-history.js", () => ({
+  recordJob: vi.fn().mockResolvedValue(undefined),
+  readJobHistory: vi.fn().mockResolvedValue([]),
+}))
+
+// lpstat and lpoptions, for the capability check of jobs with a color mode or quality
+vi.mock("execa", () => ({
+  execa: vi.fn(async (command: string) => ({
+    exitCode: 0,
+    stdout:
+      command === "lpstat"
+        ? "printer Office_HP is idle.  enabled since today"
+        : readFileSync("tests/fixtures/lpoptions/hp-laserjet-m404.txt", "utf-8"),
+    stderr: "",
+  })),
+}))
+
+/**
+ * A fake printing backend that records the order jobs reach each printer and checks that a
+ * printer never has two submissions in flight. Jobs whose title is in `failures` can't reach
+ * the printer that many times before they go through.
+ */
+const fakeBackend = vi.hoisted(() => {
+  const state = {
+    submitted: new Map<string, string[]>(),
+    options: new Map<string, string[]>(),
+    failures: new Map<string, number>(),
+    attempts: new Map<string, number>(),
+    inFlight: new Map<string, number>(),
+    overlaps: 0,
+    maxInFlight: 0,
+    nextJobNumber: 1,
+    delay: (): Promise<void> => new Promise((resolve) => setTimeout(resolve, Math.random() * 5)),
+    reset() {
+      state.submitted.clear()
+      state.options.clear()
+      state.failures.clear()
+      state.attempts.clear()
+      state.inFlight.clear()
+      state.overlaps = 0
+      state.maxInFlight = 0
+      state.delay = () => new Promise((resolve) => setTimeout(resolve, Math.random() * 5))
+    },
+  }
+  return state
+})
+
+vi.mock("../../src/backend.js", () => ({
+  getBackend: () => ({
+    name: "cups",
+    async submitJob(job: LpJobOptions) {
+      const printer = job.printer ?? "default"
+      const inFlight = (fakeBackend.inFlight.get(printer) ?? 0) + 1
+      if (inFlight > 1) {
+        fakeBackend.overlaps++
+      }
+      fakeBackend.inFlight.set(printer, inFlight)
+      const total = [...fakeBackend.inFlight.values()].reduce((sum, n) => sum + n, 0)
+      fakeBackend.maxInFlight = Math.max(fakeBackend.maxInFlight, total)
+
+      try {
+        await fakeBackend.delay()
+        const title = job.title ?? ""
+        fakeBackend.attempts.set(title, (fakeBackend.attempts.get(title) ?? 0) + 1)
+        const failures = fakeBackend.failures.get(title) ?? 0
+        if (failures > 0) {
+          fakeBackend.failures.set(title, failures - 1)
+          const { commandError } = await import("../../src/errors.js")
+          const stderr = "lp: Unable to connect to printer."
+          throw commandError(`lp failed: ${stderr}`, stderr, "JOB_REJECTED")
+        }
+        if (job.title === "server-down") {
+          const { PrinterError } = await import("../../src/errors.js")
+          throw new PrinterError("SERVER_UNREACHABLE", "Cannot reach the CUPS server print:631")
+        }
+        if (job.title === "broken") {
+          const { commandError } = await import("../../src/errors.js")
+          throw commandError("lp failed: lp: Bad document", "lp: Bad document", "JOB_REJECTED")
+        }
+        if (job.title === "no-color" && job.options?.some((o) => o.startsWith("print-color"))) {
+          const { commandError } = await import("../../src/errors.js")
+          const stderr = "lp: Unsupported print-color-mode."
+          throw commandError(`lp failed: ${stderr}`, stderr, "JOB_REJECTED")
+        }
+        fakeBackend.options.set(job.title ?? "", job.options ?? [])
+        fakeBackend.submitted.set(printer, [
+          ...(fakeBackend.submitted.get(printer) ?? []),
+          job.title ?? "",
+        ])
+        return `${printer}-${fakeBackend.nextJobNumber++}`
+      } finally {
+        fakeBackend.inFlight.set(printer, (fakeBackend.inFlight.get(printer) ?? 1) - 1)
+      }
+    },
+    getJobStatus: async (jobId: string) => ({ job_id: jobId, state: "pending" }),
+  }),
+}))
+
+/**
+ * A promise that resolves when release() is called.
+ */
+function gate() {
+  let release = () => {}
+  const opened = new Promise<void>((resolve) => {
+    release = resolve
+  })
+  return { opened, release }
+}
+
+/**
+ * Queues a text job titled with its content on Office_HP.
+ */
+function queueText(content: string, cleanup?: () => void) {
+  return queuePrintJob({
+    content,
+    printer: "Office_HP",
+    title: content,
+    tool: "print_text",
+    cleanup,
+  })
+}
+
+describe("print job queue", () => {
+  beforeEach(() => {
+    fakeBackend.reset()
+  })
+
+  afterEach(async () => {
+    await drainQueue()
+  })
+
+  it("should submit 50 jobs in order per printer without overlapping", async () => {
+    const printers = ["Office_HP", "Lab_Brother", "Front_Desk"]
+    const expected = new Map<string, string[]>(printers.map((printer) => [printer, []]))
+
+    const queued = await Promise.all(
+      Array.from({ length: 50 }, (_, index) => {
+        const printer = printers[index % printers.length]
+        const title = `job-${index}`
+        expected.get(printer)?.push(title)
+        return queuePrintJob({ content: title, printer, title, tool: "print_text" })
+      })
+    )
+    await drainQueue()
+
+    expect(fakeBackend.overlaps).toBe(0)
+    expect(fakeBackend.maxInFlight).toBeGreaterThan(1)
+    for (const printer of printers) {
+      expect(fakeBackend.submitted.get(printer)).toEqual(expected.get(printer))
+    }
+    for (const { job } of queued) {
+      expect(getQueuedJob(job.id)?.state).toBe("submitted")
+    }
+  })
+
+  it("should return right away and report queued jobs before the backend sees them", async () => {
+    const { opened, release } = gate()
+    fakeBackend.delay = () => opened
+
+    const first = await queueText("a")
+    const second = await queueText("b")
+
+    expect(first.job.id).toMatch(/^queue#\d+$/)
+    expect(await getPrintJobStatus(second.job.id)).toMatchObject({
+      job_id: second.job.id,
+      state: "queued",
+      printer: "Office_HP",
+      position: 1,
+    })
+
+    release()
+    await drainQueue()
+
+    const status = await getPrintJobStatus(second.job.id)
+    expect(status.state).toBe("pending")
+    expect(status.job_id).toMatch(/^Office_HP-\d+$/)
+    expect(status.queue_id).toBe(second.job.id)
+  })
+
+  it("should drop a canceled job before it is submitted and clean up after it", async () => {
+    const { opened, release } = gate()
+    fakeBackend.delay = () => opened
+    const cleanup = vi.fn()
+
+    await queueText("a")
+    const { job } = await queueText("b", cleanup)
+
+    expect(cancelQueuedJob(job.id)).toBe(true)
+    expect(cleanup).toHaveBeenCalledTimes(1)
+    release()
+    await drainQueue()
+
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["a"])
+    expect((await getPrintJobStatus(job.id)).state).toBe("canceled")
+    expect(cancelQueuedJob(job.id)).toBe(false)
+  })
+
+  it("should report a failed submission as aborted and keep going", async () => {
+    const broken = await queueText("broken")
+    const next = await queueText("next")
+    await drainQueue()
+
+    expect(await getPrintJobStatus(broken.job.id)).toMatchObject({
+      state: "aborted",
+      status_message: expect.stringMatching(/Bad document/),
+    })
+    expect(getQueuedJob(broken.job.id)?.code).toBe("JOB_REJECTED")
+    expect(getQueuedJob(next.job.id)?.state).toBe("submitted")
+  })
+
+  it("should warn about a color mode the printer doesn't list", async () => {
+    const { warnings } = await queuePrintJob({
+      content: "a",
+      printer: "Office_HP",
+      jobOptions: { color_mode: "color", quality: "high" },
+      tool: "print_text",
+    })
+
+    expect(warnings).toEqual([
+      `Office_HP doesn't report color support; color_mode "color" may be ignored.`,
+    ])
+    expect((await queueText("b")).warnings).toEqual([])
+  })
+
+  it("should submit without color mode and quality when the printer rejects them", async () => {
+    const { job } = await queuePrintJob({
+      content: "no-color",
+      printer: "Office_HP",
+      jobOptions: { color_mode: "monochrome", quality: "draft", duplex: "long-edge" },
+      title: "no-color",
+      tool: "print_text",
+    })
+    await drainQueue()
+
+    expect(fakeBackend.options.get("no-color")).toEqual(["sides=two-sided-long-edge"])
+    expect(await getPrintJobStatus(job.id)).toMatchObject({
+      state: "pending",
+      warnings: [
+        "The printer rejected print-color-mode=monochrome, print-quality=3; the job was sent " +
+          "without them, so the option may be ignored.",
+      ],
+    })
+  })
+
+  it("should reject invalid options before queueing", async () => {
+    await expect(
+      queuePrintJob({ content: "a", printer: "Office_HP", jobOptions: { copies: 0 }, tool: "t" })
+    ).rejects.toThrow()
+  })
+
+  it("should report unknown queued job IDs as not found", async () => {
+    expect((await getPrintJobStatus("queue#999999")).state).toBe("not-found")
+  })
+})
+
+describe("retries", () => {
+  beforeEach(() => {
+    fakeBackend.reset()
+    vi.mocked(recordJob).mockClear()
+  })
+
+  afterEach(async () => {
+    await drainQueue()
+    config.retryDelaySeconds = 0.001
+  })
+
+  it("should retry a job that can't reach the printer until it goes through", async () => {
+    fakeBackend.failures.set("flaky", 2)
+    const { job } = await queueText("flaky")
+    const next = await queueText("next")
+    await drainQueue()
+
+    expect(fakeBackend.attempts.get("flaky")).toBe(3)
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["flaky", "next"])
+    expect(getQueuedJob(job.id)).toMatchObject({ state: "submitted", attempts: 3 })
+    expect(getQueuedJob(job.id)?.error).toBeUndefined()
+    expect(await getPrintJobStatus(job.id)).toMatchObject({ state: "pending", attempts: 3 })
+    expect(await getPrintJobStatus(next.job.id)).not.toHaveProperty("attempts")
+    expect(recordJob).toHaveBeenCalledWith(expect.objectContaining({ title: "flaky", attempts: 3 }))
+  })
+
+  it("should fail permanent errors right away", async () => {
+    const { job } = await queueText("broken")
+    await drainQueue()
+
+    expect(fakeBackend.attempts.get("broken")).toBe(1)
+    expect(await getPrintJobStatus(job.id)).toMatchObject({ state: "aborted" })
+    expect(await getPrintJobStatus(job.id)).not.toHaveProperty("attempts")
+  })
+
+  it("should not retry jobs against a CUPS server that can't be reached", async () => {
+    const { job } = await queueText("server-down")
+    await drainQueue()
+
+    expect(fakeBackend.attempts.get("server-down")).toBe(1)
+    expect(await getPrintJobStatus(job.id)).toMatchObject({ state: "aborted" })
+    expect(getQueuedJob(job.id)?.code).toBe("SERVER_UNREACHABLE")
+  })
+
+  it("should give up after MCP_PRINTER_MAX_RETRIES retries", async () => {
+    fakeBackend.failures.set("offline", 10)
+    const { job } = await queueText("offline")
+    await drainQueue()
+
+    expect(fakeBackend.attempts.get("offline")).toBe(4)
+    expect(await getPrintJobStatus(job.id)).toMatchObject({
+      state: "aborted",
+      attempts: 4,
+      status_message: expect.stringMatching(/Unable to connect to printer/),
+    })
+    expect(getQueuedJob(job.id)?.code).toBe("PRINTER_UNREACHABLE")
+  })
+
+  it("should report the next retry and stop retrying when the job is canceled", async () => {
+    config.retryDelaySeconds = 60
+    fakeBackend.failures.set("flaky", 2)
+    const cleanup = vi.fn()
+    const { job } = await queueText("flaky", cleanup)
+    await vi.waitFor(() => expect(getQueuedJob(job.id)?.state).toBe("retrying"))
+
+    const status = await getPrintJobStatus(job.id)
+    expect(status).toMatchObject({
+      state: "queued",
+      position: 0,
+      attempts: 1,
+      status_message: expect.stringMatching(/Unable to connect to printer/),
+    })
+    const wait = Date.parse(status.next_retry_at ?? "") - Date.now()
+    expect(wait).toBeGreaterThan(29_000)
+    expect(wait).toBeLessThanOrEqual(60_000)
+
+    expect(cancelQueuedJob(job.id)).toBe(true)
+    await drainQueue()
+
+    expect(cleanup).toHaveBeenCalledTimes(1)
+    expect(fakeBackend.attempts.get("flaky")).toBe(1)
+    expect(await getPrintJobStatus(job.id)).toMatchObject({ state: "canceled" })
+    expect(cancelQueuedJob(job.id)).toBe(false)
+  })
+})
+
+describe("retryDelayMs", () => {
+  afterEach(() => {
+    config.retryDelaySeconds = 0.001
+  })
+
+  it("should double the delay for each failed attempt, up to a minute", () => {
+    config.retryDelaySeconds = 2
+    const noJitter = () => 0.999999
+
+    expect(retryDelayMs(1, noJitter)).toBe(2000)
+    expect(retryDelayMs(2, noJitter)).toBe(4000)
+    expect(retryDelayMs(3, noJitter)).toBe(8000)
+    expect(retryDelayMs(10, noJitter)).toBe(60_000)
+  })
+
+  it("should take up to half of the delay off at random", () => {
+    config.retryDelaySeconds = 2
+
+    expect(retryDelayMs(3, () => 0)).toBe(4000)
+    expect(retryDelayMs(3, () => 0.5)).toBe(6000)
+    for (let i = 0; i < 20; i++) {
+      const delay = retryDelayMs(2)
+      expect(delay).toBeGreaterThanOrEqual(2000)
+      expect(delay).toBeLessThanOrEqual(4000)
+    }
+  })
+})
+
+describe("page limits", () => {
+  // A five-page PDF
+  const pdf = "tests/fixtures/pdfs/linearized.pdf"
+  const queuePdf = (jobOptions: PrintJobOptions, confirmLargeJob?: boolean) =>
+    queuePrintJob({
+      filePath: pdf,
+      printer: "Office_HP",
+      jobOptions,
+      title: "report.pdf",
+      tool: "print_file",
+      confirmLargeJob,
+    })
+
+  beforeEach(() => {
+    fakeBackend.reset()
+    config.maxPagesPerJob = 10
+    config.absoluteMaxPages = 20
+  })
+
+  afterEach(async () => {
+    await drainQueue()
+    config.maxPagesPerJob = 0
+    config.absoluteMaxPages = 0
+  })
+
+  it("should queue a job at exactly the limit", async () => {
+    await queuePdf({ copies: 2 })
+    await drainQueue()
+
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["report.pdf"])
+  })
+
+  it("should reject a job one page over the limit with the page count and the limit", async () => {
+    config.maxPagesPerJob = 4
+
+    await expect(queuePdf({})).rejects.toMatchObject({
+      code: "PAGE_LIMIT_EXCEEDED",
+      message: "Job prints 5 pages, over the limit of 4 pages per job (MCP_PRINTER_MAX_PAGES_PER_JOB).",
+    })
+    await expect(queuePdf({ page_ranges: "1-4" })).resolves.toBeDefined()
+  })
+
+  it("should count copies and leave files that aren't PDFs alone", async () => {
+    await expect(queuePdf({ copies: 3 })).rejects.toThrow(
+      "Job prints 15 pages (5 pages × 3 copies), over the limit of 10 pages per job"
+    )
+    await expect(queueText("plain text")).resolves.toBeDefined()
+  })
+
+  it("should print over the limit with confirm_large_job, up to the absolute limit", async () => {
+    await expect(queuePdf({ copies: 4 }, true)).resolves.toBeDefined()
+    await expect(queuePdf({ copies: 5 }, true)).rejects.toMatchObject({
+      code: "PAGE_LIMIT_EXCEEDED",
+      message: expect.stringContaining(
+        "Job prints 25 pages (5 pages × 5 copies), over the absolute limit of 20 pages per job"
+      ),
+    })
+    await drainQueue()
+
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["report.pdf"])
+  })
+
+  it("should count the cover page toward the limit and say so", async () => {
+    config.maxPagesPerJob = 5
+
+    await expect(queuePdf({ cover_page: true })).rejects.toMatchObject({
+      code: "PAGE_LIMIT_EXCEEDED",
+      message:
+        "Job prints 6 pages, including the cover page, over the limit of 5 pages per job (MCP_PRINTER_MAX_PAGES_PER_JOB).",
+    })
+    await expect(queuePdf({ cover_page: true, copies: 4 }, true)).rejects.toThrow(
+      "Job prints 24 pages (6 pages, including the cover page, × 4 copies), over the absolute limit of 20 pages per job"
+    )
+  })
+
+  it("should print the cover in front of the selected pages", async () => {
+    await queuePdf({ cover_page: true, page_ranges: "4-5" })
+    await drainQueue()
+
+    expect(fakeBackend.options.get("report.pdf")).toEqual(["page-ranges=1,5-6"])
+  })
+})
+
+describe("cover pages", () => {
+  afterEach(async () => {
+    await drainQueue()
+    config.coverPage = false
+    config.coverPageMode = "generate"
+  })
+
+  it("should ask CUPS for a banner page in job-sheets mode", async () => {
+    config.coverPage = true
+    config.coverPageMode = "job-sheets"
+    await queueText("with banner")
+    await drainQueue()
+
+    expect(fakeBackend.options.get("with banner")).toEqual(["job-sheets=standard,none"])
+  })
+
+  it("should warn that plain text sent as it is gets no generated cover", async () => {
+    config.coverPage = true
+    const { warnings } = await queueText("no cover")
+
+    expect(warnings).toEqual([
+      "No cover page was added: only PDF jobs (including rendered documents) can have one.",
+    ])
+  })
+})
+
+describe("raw jobs", () => {
+  afterEach(async () => {
+    await drainQueue()
+    config.coverPage = false
+  })
+
+  it("should send raw content with -o raw, without a cover page", async () => {
+    config.coverPage = true
+    const { warnings } = await queuePrintJob({
+      content: Buffer.from("^XA^FDHello^FS^XZ"),
+      printer: "Zebra_Labels",
+      jobOptions: { copies: 2 },
+      title: "label",
+      tool: "print_raw",
+      raw: true,
+    })
+    await drainQueue()
+
+    expect(fakeBackend.options.get("label")).toEqual(["raw"])
+    expect(warnings).toEqual([
+      "No cover page was added: raw jobs are sent to the printer untouched.",
+    ])
+  })
+
+  it("should refuse a printer that isn't allowed raw jobs", async () => {
+    await expect(
+      queuePrintJob({
+        content: "^XA^XZ",
+        printer: "Office_HP",
+        title: "office label",
+        tool: "print_text",
+        raw: true,
+      })
+    ).rejects.toMatchObject({ code: "PERMISSION_DENIED" })
+    expect(fakeBackend.attempts.get("office label")).toBeUndefined()
+  })
+
+  it("should refuse page ranges", async () => {
+    await expect(
+      queuePrintJob({
+        content: "^XA^XZ",
+        printer: "Zebra_Labels",
+        jobOptions: { page_ranges: "1" },
+        title: "label",
+        tool: "print_text",
+        raw: true,
+      })
+    ).rejects.toThrow("Cannot print page_ranges in a raw job")
+  })
+})
+
+describe("duplicate requests and the rate limit", () => {
+  /** Moves the fake clock on by a number of milliseconds. */
+  function advance(ms: number) {
+    vi.setSystemTime(new Date(Date.now() + ms))
+  }
+
+  beforeEach(() => {
+    fakeBackend.reset()
+    vi.useFakeTimers({ toFake: ["Date"] })
+    vi.setSystemTime(new Date("2026-10-14T09:00:00Z"))
+    config.dedupeWindowSeconds = 60
+  })
+
+  afterEach(async () => {
+    await drainQueue()
+    vi.useRealTimers()
+    config.dedupeWindowSeconds = 0
+    config.maxJobsPerMinute = 0
+  })
+
+  it("should return the job an identical request just queued, flagged as a duplicate", async () => {
+    const cleanup = vi.fn()
+    const first = await queueText("minutes")
+    advance(20_000)
+    const second = await queueText("minutes", cleanup)
+    await drainQueue()
+
+    expect(first.duplicate).toBe(false)
+    expect(second.duplicate).toBe(true)
+    expect(second.job.id).toBe(first.job.id)
+    expect(cleanup).toHaveBeenCalledTimes(1)
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["minutes"])
+  })
+
+  it("should print it again with force, or once the window has passed", async () => {
+    const first = await queueText("agenda")
+    const forced = await queuePrintJob({
+      content: "agenda",
+      printer: "Office_HP",
+      title: "agenda",
+      tool: "print_text",
+      force: true,
+    })
+    advance(60_000)
+    const later = await queueText("agenda")
+    await drainQueue()
+
+    expect(forced).toMatchObject({ duplicate: false })
+    expect(later).toMatchObject({ duplicate: false })
+    expect(new Set([first.job.id, forced.job.id, later.job.id]).size).toBe(3)
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["agenda", "agenda", "agenda"])
+  })
+
+  it("should tell requests for other printers or options apart", async () => {
+    await queueText("report")
+    const copies = await queuePrintJob({
+      content: "report",
+      printer: "Office_HP",
+      jobOptions: { copies: 2 },
+      title: "report",
+      tool: "print_text",
+    })
+    const elsewhere = await queuePrintJob({
+      content: "report",
+      printer: "Lobby_HP",
+      title: "report",
+      tool: "print_text",
+    })
+
+    expect(copies.duplicate).toBe(false)
+    expect(elsewhere.duplicate).toBe(false)
+  })
+
+  it("should print a request again when the job it repeats failed", async () => {
+    const first = await queueText("broken")
+    await drainQueue()
+    expect(getQueuedJob(first.job.id)?.state).toBe("failed")
+
+    const again = await queueText("broken")
+    expect(again.duplicate).toBe(false)
+    expect(again.job.id).not.toBe(first.job.id)
+  })
+
+  it("should refuse a session's jobs over the rate limit until its bucket refills", async () => {
+    config.maxJobsPerMinute = 2
+    const queue = (content: string, session: string) =>
+      queuePrintJob({ content, printer: "Office_HP", title: content, tool: "print_text", session })
+
+    await queue("one", "session-a")
+    await queue("two", "session-a")
+    await expect(queue("three", "session-a")).rejects.toMatchObject({
+      code: "RATE_LIMITED",
+      message:
+        "Too many print jobs: each session may queue 2 jobs per minute (MCP_PRINTER_MAX_JOBS_PER_MINUTE). Try again in 30 seconds.",
+    })
+    // Other sessions have buckets of their own
+    await expect(queue("four", "session-b")).resolves.toMatchObject({ duplicate: false })
+
+    advance(30_000)
+    await expect(queue("three", "session-a")).resolves.toMatchObject({ duplicate: false })
+    await drainQueue()
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["one", "two", "four", "three"])
+  })
+
+  it("should not count a duplicate against the rate limit", async () => {
+    config.maxJobsPerMinute = 1
+    const queue = () =>
+      queuePrintJob({
+        content: "receipt",
+        printer: "Office_HP",
+        title: "receipt",
+        tool: "print_text",
+        session: "session-c",
+      })
+
+    await queue()
+    await expect(queue()).resolves.toMatchObject({ duplicate: true })
+  })
+})
+
+describe("quotas", () => {
+  // Each test prints in an hour of its own, clear of the jobs other tests queued
+  let hour = 0
+
+  beforeEach(() => {
+    fakeBackend.reset()
+    vi.useFakeTimers({ toFake: ["Date"] })
+    vi.setSystemTime(new Date(Date.UTC(2030, 0, 1, hour++)))
+  })
+
+  afterEach(async () => {
+    await drainQueue()
+    vi.useRealTimers()
+    config.maxJobsPerHour = 0
+    config.quotaScope = "global"
+  })
+
+  const queue = (title: string, session?: string) =>
+    queuePrintJob({ content: title, printer: "Office_HP", title, tool: "print_text", session })
+
+  it("should let only one of two concurrent requests take the last job of a quota", async () => {
+    config.maxJobsPerHour = 1
+
+    const results = await Promise.allSettled([queue("first"), queue("second")])
+    await drainQueue()
+
+    expect(results.map((result) => result.status).sort()).toEqual(["fulfilled", "rejected"])
+    const refused = results.find((result) => result.status === "rejected")
+    expect(refused?.reason).toMatchObject({ code: "QUOTA_EXCEEDED" })
+    expect(fakeBackend.submitted.get("Office_HP")).toHaveLength(1)
+  })
+
+  it("should hold concurrent requests to the quota of each session", async () => {
+    config.maxJobsPerHour = 1
+    config.quotaScope = "session"
+
+    const results = await Promise.allSettled([
+      queue("a-1", "session-a"),
+      queue("b-1", "session-b"),
+      queue("a-2", "session-a"),
+    ])
+    await drainQueue()
+
+    expect(results.map((result) => result.status)).toEqual(["fulfilled", "fulfilled", "rejected"])
+    expect(fakeBackend.submitted.get("Office_HP")?.sort()).toEqual(["a-1", "b-1"])
+  })
+})
+
+describe("sessions", () => {
+  const clients: Record<string, string> = {
+    "session-a": "alice-desktop 1.0.0",
+    "session-b": "bob-laptop 2.1.0",
+  }
+
+  beforeEach(() => {
+    fakeBackend.reset()
+    vi.mocked(recordJob).mockClear()
+    openSession("session-a", { name: "alice-desktop", version: "1.0.0" })
+    openSession("session-b", { name: "bob-laptop", version: "2.1.0" })
+  })
+
+  afterEach(async () => {
+    await drainQueue()
+    closeSession("session-a")
+    closeSession("session-b")
+  })
+
+  const queue = (title: string, session: string) =>
+    queuePrintJob({ content: title, printer: "Office_HP", title, tool: "print_text", session })
+
+  it("should attribute each job to its session when two sessions print at once", async () => {
+    const sessionOf = (index: number) => (index % 2 === 0 ? "session-a" : "session-b")
+    const titles = Array.from({ length: 20 }, (_, index) => `${sessionOf(index)}-job-${index}`)
+
+    await Promise.all(titles.map((title, index) => queue(title, sessionOf(index))))
+    await drainQueue()
+
+    const recorded = vi.mocked(recordJob).mock.calls.map(([job]) => job)
+    expect(recorded.map((job) => job.title).sort()).toEqual([...titles].sort())
+    for (const job of recorded) {
+      const session = job.title.startsWith("session-a") ? "session-a" : "session-b"
+      expect(job).toMatchObject({ session, client: clients[session] })
+    }
+  })
+
+  it("should cancel only the waiting jobs of an expired session", async () => {
+    const { opened, release } = gate()
+    fakeBackend.delay = () => opened
+
+    const first = await queue("b-1", "session-b")
+    const waiting = await queue("a-1", "session-a")
+    const other = await queue("b-2", "session-b")
+    expect(await cancelWaitingJobs("session expired", "session-a")).toBe(1)
+    release()
+    await drainQueue()
+
+    expect(getQueuedJob(waiting.job.id)?.state).toBe("canceled")
+    expect(getQueuedJob(first.job.id)?.state).toBe("submitted")
+    expect(getQueuedJob(other.job.id)?.state).toBe("submitted")
+    expect(fakeBackend.submitted.get("Office_HP")).toEqual(["b-1", "b-2"])
+    expect(recordJob).toHaveBeenCalledWith({
+      jobId: waiting.job.id,
+      tool: "print_text",
+      printer: "Office_HP",
+      title: "a-1",
+      canceledReason: "session expired",
+      session: "session-a",
+      client: "alice-desktop 1.0.0",
+    })
+  })
+})
+
+describe("withRenderSlot", () => {
+  it("should run at most maxConcurrentRenders renders at once, in order", async () => {
+    let running = 0
+    let maxRunning = 0
+    const started: number[] = []
+
+    await Promise.all(
+      Array.from({ length: 10 }, (_, index) =>
+        withRenderSlot(async () => {
+          started.push(index)
+          running++
+          maxRunning = Math.max(maxRunning, running)
+          await new Promise((resolve) => setTimeout(resolve, 2))
+          running--
+        })
+      )
+    )
+
+    expect(maxRunning).toBe(config.maxConcurrentRenders)
+    expect(started).toEqual([0, 1, 2, 3, 4, 5, 6, 7, 8, 9])
+  })
+
+  it("should free the slot when a render fails", async () => {
+    await expect(withRenderSlot(() => Promise.reject(new Error("boom")))).rejects.toThrow("boom")
+    await expect(withRenderSlot(async () => "ok")).resolves.toBe("ok")
+  })
+})
@@ -0,0 +1,259 @@
+/**
+ * @fileoverview Unit tests for structured logging and MCP logging notifications
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, readFileSync, rmSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { config } from "../../src/config.js"
+import {
+  addLogHandler,
+  formatLogRecord,
+  isLoggingLevelEnabled,
+  logger,
+  summarizeArguments,
+  type LogRecord,
+} from "../../src/logger.js"
+import { logToolCalls, registerLogging, SERVER_LOGGER } from "../../src/tools/logging.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    logLevel: "info",
+    logFile: "",
+  },
+}))
+
+/**
+ * A fake McpServer that records the tools, request handlers, and logging messages it gets.
+ */
+function fakeServer() {
+  const tools = new Map<string, (...params: unknown[]) => Promise<unknown>>()
+  const handlers: Array<(request: unknown) => Promise<unknown>> = []
+  const server = {
+    registerTool: vi.fn((name: string, _config: unknown, callback: never) => {
+      tools.set(name, callback)
+    }),
+    server: {
+      registerCapabilities: vi.fn(),
+      setRequestHandler: vi.fn((_schema: unknown, handler: never) => {
+        handlers.push(handler)
+      }),
+      sendLoggingMessage: vi.fn().mockResolvedValue(undefined),
+      onclose: undefined as (() => void) | undefined,
+    },
+  }
+  const setLevel = (level: string) => handlers[0]({ params: { level } })
+  return { server, mcpServer: server as unknown as McpServer, tools, setLevel }
+}
+
+describe("summarizeArguments", () => {
+  it("should replace document content and long strings with their length", () => {
+    expect(
+      summarizeArguments({
+        content: "short but private",
+        title: "Notes",
+        file_path: `/home/user/${"a".repeat(100)}.txt`,
+        copies: 2,
+        duplex: undefined,
+      })
+    ).toEqual({ content: "<17 chars>", title: "Notes", file_path: "<115 chars>", copies: 2 })
+  })
+
+  it("should summarize nested arrays, cutting long ones short", () => {
+    const files = Array.from({ length: 12 }, (_, i) => ({ file_path: `f${i}.md` }))
+    const summary = summarizeArguments({ files }) as { files: unknown[] }
+    expect(summary.files).toHaveLength(11)
+    expect(summary.files[0]).toEqual({ file_path: "f0.md" })
+    expect(summary.files[10]).toBe("<2 more>")
+  })
+})
+
+describe("formatLogRecord", () => {
+  it("should write one JSON object per record, with errors as their messages", () => {
+    const record: LogRecord = {
+      time: "2026-10-14T09:30:00.000Z",
+      level: "error",
+      msg: "tool failed",
+      attrs: { tool: "print_file", error: new Error("lp: not found") },
+    }
+    expect(JSON.parse(formatLogRecord(record))).toEqual({
+      time: "2026-10-14T09:30:00.000Z",
+      level: "error",
+      msg: "tool failed",
+      tool: "print_file",
+      error: "lp: not found",
+    })
+  })
+})
+
+describe("logger", () => {
+  let tempDir: string | undefined
+
+  beforeEach(() => {
+    vi.mocked(config).logLevel = "info"
+    vi.mocked(config).logFile = ""
+    vi.spyOn(console, "error").mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    vi.mocked(console.error).mockRestore()
+    if (tempDir) {
+      rmSync(tempDir, { recursive: true, force: true })
+      tempDir = undefined
+    }
+  })
+
+  it("should write records at or above the log level to stderr", () => {
+    vi.mocked(config).logLevel = "warn"
+    logger.info("job queued", { job_id: "queue#1" })
+    logger.warn("ignoring unreadable job history file")
+
+    expect(console.error).toHaveBeenCalledTimes(1)
+    const line = String(vi.mocked(console.error).mock.calls[0][0])
+    expect(JSON.parse(line)).toMatchObject({
+      level: "warn",
+      msg: "ignoring unreadable job history file",
+    })
+  })
+
+  it("should append records to the log file instead when one is set", () => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-log-test-"))
+    vi.mocked(config).logFile = join(tempDir, "printer.log")
+    logger.info("job queued", { job_id: "queue#1" })
+    logger.error("tool failed", { tool: "print_file" })
+
+    const lines = readFileSync(config.logFile, "utf-8").trimEnd().split("\n")
+    expect(lines.map((line) => JSON.parse(line).msg)).toEqual(["job queued", "tool failed"])
+    expect(console.error).not.toHaveBeenCalled()
+  })
+
+  it("should give handlers every record, whatever the log level", () => {
+    vi.mocked(config).logLevel = "error"
+    const records: LogRecord[] = []
+    const remove = addLogHandler((record) => records.push(record))
+    logger.debug("command", { command: "lpstat" })
+    remove()
+    logger.debug("command", { command: "lp" })
+
+    expect(records.map((record) => record.attrs.command)).toEqual(["lpstat"])
+    expect(console.error).not.toHaveBeenCalled()
+  })
+})
+
+describe("isLoggingLevelEnabled", () => {
+  it("should compare MCP logging levels by severity", () => {
+    expect(isLoggingLevelEnabled("warning", "info")).toBe(true)
+    expect(isLoggingLevelEnabled("info", "info")).toBe(true)
+    expect(isLoggingLevelEnabled("debug", "notice")).toBe(false)
+  })
+})
+
+describe("registerLogging", () => {
+  beforeEach(() => {
+    vi.spyOn(console, "error").mockImplementation(() => {})
+  })
+
+  it("should send records at or above the client's level once it sets one", async () => {
+    const { server, mcpServer, setLevel } = fakeServer()
+    registerLogging(mcpServer)
+    expect(server.server.registerCapabilities).toHaveBeenCalledWith({ logging: {} })
+
+    logger.info("before setLevel")
+    expect(server.server.sendLoggingMessage).not.toHaveBeenCalled()
+
+    await setLevel("warning")
+    logger.info("job queued")
+    logger.warn("render failed, printing the file as it is", { file: "notes.md" })
+
+    expect(server.server.sendLoggingMessage).toHaveBeenCalledTimes(1)
+    expect(server.server.sendLoggingMessage).toHaveBeenCalledWith({
+      level: "warning",
+      logger: SERVER_LOGGER,
+      data: { msg: "render failed, printing the file as it is", file: "notes.md" },
+    })
+    server.server.onclose?.()
+  })
+
+  it("should tell listeners about the level and stop sending when the session closes", async () => {
+    const { server, mcpServer, setLevel } = fakeServer()
+    const onclose = vi.fn()
+    server.server.onclose = onclose
+    const listener = vi.fn()
+    registerLogging(mcpServer).onSetLevel(listener)
+
+    await setLevel("debug")
+    expect(listener).toHaveBeenCalledWith("debug")
+
+    server.server.onclose?.()
+    logger.error("tool failed")
+    expect(onclose).toHaveBeenCalled()
+    expect(server.server.sendLoggingMessage).not.toHaveBeenCalled()
+  })
+})
+
+describe("logToolCalls", () => {
+  let records: LogRecord[]
+  let remove: () => void
+
+  beforeEach(() => {
+    vi.spyOn(console, "error").mockImplementation(() => {})
+    records = []
+    remove = addLogHandler((record) => records.push(record))
+  })
+
+  afterEach(() => {
+    remove()
+  })
+
+  it("should log calls with their arguments summarized, and their results", async () => {
+    const { mcpServer, tools } = fakeServer()
+    logToolCalls(mcpServer)
+    mcpServer.registerTool(
+      "print_text",
+      { inputSchema: {} },
+      async () => ({ content: [{ type: "text", text: "✓ Sent" }] })
+    )
+
+    const args = { content: "Dear diary", printer: "Office_HP" }
+    const result = await tools.get("print_text")!(args, {})
+
+    expect(result).toEqual({ content: [{ type: "text", text: "✓ Sent" }] })
+    expect(records[0]).toMatchObject({
+      level: "info",
+      msg: "tool call",
+      attrs: { tool: "print_text", args: { content: "<10 chars>", printer: "Office_HP" } },
+    })
+    expect(records[1]).toMatchObject({
+      msg: "tool result",
+      attrs: { tool: "print_text", is_error: false },
+    })
+    expect(JSON.stringify(records)).not.toContain("Dear diary")
+  })
+
+  it("should pass the request context to tools without parameters", async () => {
+    const { mcpServer, tools } = fakeServer()
+    logToolCalls(mcpServer)
+    const callback = vi.fn(async () => ({ content: [], isError: true }))
+    mcpServer.registerTool("list_printers", {}, callback)
+
+    const extra = { signal: new AbortController().signal }
+    await tools.get("list_printers")!(extra)
+
+    expect(callback).toHaveBeenCalledWith(extra)
+    expect(records[0].attrs).toEqual({ tool: "list_printers", args: undefined })
+    expect(records[1].attrs).toMatchObject({ is_error: true })
+  })
+
+  it("should log tools that throw", async () => {
+    const { mcpServer, tools } = fakeServer()
+    logToolCalls(mcpServer)
+    mcpServer.registerTool("get_config", {}, async () => {
+      throw new Error("boom")
+    })
+
+    await expect(tools.get("get_config")!({})).rejects.toThrow("boom")
+    expect(records[1]).toMatchObject({ level: "error", msg: "tool failed" })
+  })
+})
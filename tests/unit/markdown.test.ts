@@ -0,0 +1,62 @@
+/**
+ * @fileoverview Unit tests for markdown rendering helpers
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { homedir } from "os"
+import { join } from "path"
+import { pathToFileURL } from "url"
+import { resolveRelativeImages } from "../../src/renderers/markdown.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    allowedPaths: [homedir()],
+    deniedPaths: [],
+  },
+}))
+
+describe("resolveRelativeImages", () => {
+  const baseDir = join(homedir(), "Documents", "notes")
+
+  it("should rewrite relative markdown images to absolute file URLs", () => {
+    const result = resolveRelativeImages("![Diagram](images/diagram.png)", baseDir)
+
+    expect(result).toBe(`![Diagram](${pathToFileURL(join(baseDir, "images/diagram.png")).href})`)
+  })
+
+  it("should keep image titles intact", () => {
+    const result = resolveRelativeImages('![Logo](../logo.png "Company logo")', baseDir)
+
+    expect(result).toBe(
+      `![Logo](${pathToFileURL(join(homedir(), "Documents", "logo.png")).href} "Company logo")`
+    )
+  })
+
+  it("should rewrite relative HTML img tags", () => {
+    const result = resolveRelativeImages('<img src="./chart.svg" width="300">', baseDir)
+
+    expect(result).toBe(`<img src="${pathToFileURL(join(baseDir, "chart.svg")).href}" width="300">`)
+  })
+
+  it("should leave URLs, data URIs, and absolute paths unchanged", () => {
+    const content = [
+      "![Remote](https://example.com/image.png)",
+      "![Inline](data:image/png;base64,iVBORw0KGgo=)",
+      "![Absolute](/usr/share/pixmaps/logo.png)",
+    ].join("\n")
+
+    expect(resolveRelativeImages(content, baseDir)).toBe(content)
+  })
+
+  it("should not resolve images outside allowed directories", () => {
+    const content = "![Secret](../../.ssh/id_rsa.png)"
+
+    expect(resolveRelativeImages(content, baseDir)).toBe(content)
+  })
+
+  it("should leave regular links alone", () => {
+    const content = "See [the guide](guide.md) for details."
+
+    expect(resolveRelativeImages(content, baseDir)).toBe(content)
+  })
+})
@@ -0,0 +1,83 @@
+/**
+ * @fileoverview Unit tests for mDNS message encoding and decoding against byte fixtures
+ */
+
+import { describe, it, expect } from "vitest"
+import { readFileSync } from "fs"
+import { join } from "path"
+import { decodeDnsRecords, encodeDnsQuery, RECORD_TYPES } from "../../src/mdns.js"
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures", "mdns")
+
+function fixture(name: string): Buffer {
+  return readFileSync(join(fixturesDir, name))
+}
+
+describe("encodeDnsQuery", () => {
+  it("should encode a PTR query byte-for-byte", () => {
+    const query = encodeDnsQuery([{ name: "_ipp._tcp.local", type: RECORD_TYPES.PTR }])
+
+    expect(query.toString("hex")).toBe(
+      "000000000001000000000000" + "045f697070045f746370056c6f63616c00" + "000c0001"
+    )
+  })
+
+  it("should encode multiple questions", () => {
+    const query = encodeDnsQuery([
+      { name: "_ipp._tcp.local", type: RECORD_TYPES.PTR },
+      { name: "_ipps._tcp.local", type: RECORD_TYPES.PTR },
+    ])
+
+    expect(query.readUInt16BE(4)).toBe(2)
+  })
+})
+
+describe("decodeDnsRecords", () => {
+  it("should decode a printer advertisement with compressed names", () => {
+    const records = decodeDnsRecords(fixture("ipp-printer-response.bin"))
+
+    expect(records).toEqual([
+      {
+        name: "_ipp._tcp.local",
+        type: RECORD_TYPES.PTR,
+        ttl: 4500,
+        data: "Office Printer._ipp._tcp.local",
+      },
+      {
+        name: "Office Printer._ipp._tcp.local",
+        type: RECORD_TYPES.SRV,
+        ttl: 120,
+        data: { priority: 0, weight: 0, port: 631, target: "officeprinter.local" },
+      },
+      {
+        name: "Office Printer._ipp._tcp.local",
+        type: RECORD_TYPES.TXT,
+        ttl: 4500,
+        data: {
+          txtvers: "1",
+          rp: "ipp/print",
+          ty: "HP LaserJet Pro M404",
+          note: "2nd Floor",
+          pdl: "application/pdf,image/urf",
+          color: "F",
+          duplex: "T",
+        },
+      },
+      { name: "officeprinter.local", type: RECORD_TYPES.A, ttl: 120, data: "192.168.1.50" },
+      { name: "officeprinter.local", type: RECORD_TYPES.AAAA, ttl: 120, data: "fe80::1" },
+    ])
+  })
+
+  it("should throw on a truncated message", () => {
+    const truncated = fixture("ipp-printer-response.bin").subarray(0, 60)
+
+    expect(() => decodeDnsRecords(truncated)).toThrow(/Malformed DNS message/)
+  })
+
+  it("should throw on a compression loop", () => {
+    // One answer whose name is a pointer to itself
+    const looped = Buffer.from("000084000000000100000000c00c", "hex")
+
+    expect(() => decodeDnsRecords(looped)).toThrow(/compression loop/)
+  })
+})
@@ -0,0 +1,165 @@
+/**
+ * @fileoverview Unit tests for merged print jobs (PDF merging and separator pages)
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { existsSync, readFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures, with plain text sent as it is
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderMarkdown: true,
+      autoRenderCode: true,
+      autoRenderText: false,
+      fallbackOnRenderError: false,
+      header: "",
+      footer: "",
+      code: { excludeExtensions: [] },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import { buildSeparatorContent, mergeFilesToPdf } from "../../src/renderers/merge.js"
+import { PdfMerger } from "../../src/pdf/merge.js"
+import { PdfDocument, PdfRef, PdfStream, isDict } from "../../src/pdf/document.js"
+import { cleanupRenderedPdf } from "../../src/utils.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+const fixture = (name: string) => join(fixturesDir, "pdfs", name)
+
+describe("PdfMerger", () => {
+  it("should copy every page of each document in order", () => {
+    const merger = new PdfMerger()
+    const form = new PdfDocument(readFileSync(fixture("form.pdf")))
+    const compressed = new PdfDocument(readFileSync(fixture("compressed.pdf")))
+
+    expect(merger.appendDocument(form)).toBe(3)
+    expect(merger.appendDocument(compressed)).toBe(2)
+    const merged = new PdfDocument(merger.toBuffer())
+    const pages = merged.getPages()
+
+    expect(pages).toHaveLength(5)
+    // Inherited attributes move onto the pages, and compressed content is copied as it is
+    expect(pages[0].dict.get("MediaBox")).toEqual([0, 0, 612, 792])
+    expect(pages[2].dict.get("Rotate")).toBe(90)
+    const originalPage = compressed.getPages()[1]
+    const originalContent = compressed.resolve(originalPage.dict.get("Contents") ?? null)
+    const copiedContent = merged.resolve(pages[4].dict.get("Contents") ?? null)
+    expect(copiedContent).toBeInstanceOf(PdfStream)
+    expect(merged.decodeStream(copiedContent as PdfStream)).toEqual(
+      compressed.decodeStream(originalContent as PdfStream)
+    )
+  })
+
+  it("should keep form fields and annotations pointing at the copied pages", () => {
+    const merger = new PdfMerger()
+    merger.appendDocument(new PdfDocument(readFileSync(fixture("form.pdf"))))
+    merger.appendDocument(new PdfDocument(readFileSync(fixture("form.pdf"))))
+    const merged = new PdfDocument(merger.toBuffer())
+    const catalog = merged.resolve(merged.trailer.get("Root") ?? null)
+    const form = isDict(catalog) ? merged.resolve(catalog.get("AcroForm") ?? null) : null
+
+    expect(isDict(form) && form.get("Fields")).toHaveLength(2)
+    const pages = merged.getPages()
+    for (const index of [0, 3]) {
+      const [widget] = pages[index].dict.get("Annots") as PdfRef[]
+      const annotation = merged.resolve(widget)
+      expect(isDict(annotation) && (annotation.get("P") as PdfRef).num).toBe(pages[index].ref.num)
+    }
+  })
+})
+
+describe("buildSeparatorContent", () => {
+  it("should name the next file and its position", () => {
+    const content = buildSeparatorContent("handler_test.go", 2, 3, [0, 0, 612, 792])
+    const hex = (text: string) => `<${Buffer.from(text).toString("hex").toUpperCase()}>`
+
+    expect(content).toContain(hex("Next file (2 of 3)"))
+    expect(content).toContain(hex("handler_test.go"))
+  })
+
+  it("should shrink a long name to fit and replace characters the font can't show", () => {
+    const content = buildSeparatorContent(`${"x".repeat(200)}.txt`, 2, 2, [0, 0, 612, 792])
+    const sizes = [...content.matchAll(/\/F0 ([\d.]+) Tf/g)].map((match) => Number(match[1]))
+
+    expect(sizes[1]).toBeLessThan(28)
+    expect(buildSeparatorContent("東京.txt", 2, 2, [0, 0, 612, 792])).toContain("<3F3F2E747874>")
+  })
+})
+
+describe("mergeFilesToPdf", () => {
+  it("should merge files with a separator page before each file after the first", async () => {
+    const merged = await mergeFilesToPdf([
+      fixture("form.pdf"),
+      fixture("compressed.pdf"),
+      fixture("form.pdf"),
+    ])
+    try {
+      expect(merged.files.map(({ pages }) => pages)).toEqual([3, 2, 3])
+      expect(merged.separatorPages).toBe(2)
+      expect(merged.totalPages).toBe(10)
+      expect(new PdfDocument(readFileSync(merged.pdfPath)).getPages()).toHaveLength(10)
+    } finally {
+      cleanupRenderedPdf(merged.pdfPath)
+    }
+    expect(existsSync(merged.pdfPath)).toBe(false)
+  })
+
+  it("should stop at a file that isn't printed as a PDF by default", async () => {
+    await expect(
+      mergeFilesToPdf([fixture("form.pdf"), join(fixturesDir, "encodings", "windows-1252.txt")])
+    ).rejects.toThrow("Cannot merge windows-1252.txt: it is printed as text")
+  })
+
+  it("should leave out files that fail with on_error skip", async () => {
+    const textFile = join(fixturesDir, "encodings", "windows-1252.txt")
+    const merged = await mergeFilesToPdf([textFile, fixture("compressed.pdf")], {
+      onError: "skip",
+    })
+    try {
+      expect(merged.files.map(({ filePath }) => filePath)).toEqual([fixture("compressed.pdf")])
+      expect(merged.skipped).toEqual([
+        { filePath: textFile, message: expect.stringContaining("Cannot merge windows-1252.txt") },
+      ])
+      expect(merged.separatorPages).toBe(0)
+      expect(merged.totalPages).toBe(2)
+    } finally {
+      cleanupRenderedPdf(merged.pdfPath)
+    }
+  })
+
+  it("should check every path against the allowed directories before rendering", async () => {
+    await expect(
+      mergeFilesToPdf([fixture("form.pdf"), "/etc/passwd"], { onError: "skip" })
+    ).rejects.toThrow("outside allowed directories")
+  })
+
+  it("should stamp the watermark on every page of the merged PDF", async () => {
+    const merged = await mergeFilesToPdf([fixture("form.pdf"), fixture("compressed.pdf")], {
+      watermark: { text: "DRAFT" },
+    })
+    try {
+      const document = new PdfDocument(readFileSync(merged.pdfPath))
+      expect(document.getPages()).toHaveLength(6)
+      for (const page of document.getPages()) {
+        const contents = document.resolve(page.dict.get("Contents") ?? null) as PdfRef[]
+        const last = document.resolve(contents.at(-1) ?? null) as PdfStream
+        expect(document.decodeStream(last).toString("latin1")).toBe("q /Watermark Do Q\n")
+      }
+    } finally {
+      cleanupRenderedPdf(merged.pdfPath)
+    }
+  })
+})
@@ -0,0 +1,142 @@
+/**
+ * @fileoverview Unit tests for N-up imposition of IPP jobs (sheet layout and HTML generation)
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, rmSync, writeFileSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { convertHtmlToPdf } from "../../src/utils.js"
+import {
+  buildNUpHtml,
+  computeSheetLayout,
+  imposeIppJob,
+  N_UP_LAYOUTS,
+} from "../../src/renderers/n-up.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {},
+}))
+
+vi.mock("../../src/utils.js", () => ({
+  convertHtmlToPdf: vi.fn().mockResolvedValue("/tmp/mcp-printer-n-up-test/output.pdf"),
+}))
+
+const screenshots = vi.hoisted(() => ({ requested: [] as number[][] }))
+
+vi.mock("pdf-parse", () => ({
+  PDFParse: class {
+    async getInfo() {
+      return { total: 5 }
+    }
+    async getScreenshot({ partial }: { partial: number[] }) {
+      screenshots.requested.push(partial)
+      return { pages: partial.map((page) => ({ data: new Uint8Array([page]) })) }
+    }
+    async destroy() {}
+  },
+}))
+
+const PRINTER_URI = "ipp://printer.local/ipp/print"
+
+describe("computeSheetLayout", () => {
+  it("should turn 2-up sheets landscape with two cells side by side", () => {
+    const layout = computeSheetLayout(2, "Letter")
+
+    expect(layout.sheetWidth).toBe(792)
+    expect(layout.sheetHeight).toBe(612)
+    expect(layout.cellWidth).toBeLessThan(792 / 2)
+    expect(layout.cellHeight).toBeLessThan(612)
+  })
+
+  it("should keep 4-up, 9-up, and 16-up sheets portrait", () => {
+    for (const numberUp of [4, 9, 16] as const) {
+      expect(N_UP_LAYOUTS[numberUp].orientation).toBe("portrait")
+      expect(N_UP_LAYOUTS[numberUp].columns * N_UP_LAYOUTS[numberUp].rows).toBe(numberUp)
+    }
+    expect(computeSheetLayout(4, "A4").sheetWidth).toBe(595.28)
+  })
+})
+
+describe("buildNUpHtml", () => {
+  it("should put N pages on each sheet, with the last sheet partly filled", () => {
+    const images = ["a", "b", "c", "d", "e"].map((name) => `data:image/png;base64,${name}`)
+    const html = buildNUpHtml(images, 2, "Letter")
+    const sheets = html.match(/<div class="sheet">.*<\/div>/g) ?? []
+
+    expect(html).toContain("size: 792pt 612pt;")
+    expect(html).toContain("grid-template-columns: repeat(2, minmax(0, 1fr));")
+    expect(sheets).toHaveLength(3)
+    expect(sheets[0].match(/<img /g)).toHaveLength(2)
+    expect(sheets[2].match(/<img /g)).toHaveLength(1)
+  })
+})
+
+describe("imposeIppJob", () => {
+  let tempDir: string
+  let pdfPath: string
+
+  beforeEach(() => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-n-up-test-"))
+    pdfPath = join(tempDir, "doc.pdf")
+    writeFileSync(pdfPath, "%PDF-1.4")
+    screenshots.requested = []
+    vi.mocked(convertHtmlToPdf).mockClear()
+  })
+
+  afterEach(() => {
+    rmSync(tempDir, { recursive: true, force: true })
+  })
+
+  it("should leave CUPS printers, non-PDF files, and 1-up jobs alone", async () => {
+    const jobs = [
+      { printer: "Office_HP", filePath: pdfPath, options: ["number-up=2"] },
+      { printer: PRINTER_URI, filePath: join(tempDir, "notes.txt"), options: ["number-up=2"] },
+      { printer: PRINTER_URI, content: "hello", options: ["number-up=4"] },
+      { printer: PRINTER_URI, filePath: pdfPath, options: ["number-up=1"] },
+      { printer: PRINTER_URI, filePath: pdfPath },
+    ]
+
+    for (const job of jobs) {
+      expect(await imposeIppJob(job)).toEqual({ job, imposedPdf: null })
+    }
+    expect(convertHtmlToPdf).not.toHaveBeenCalled()
+  })
+
+  it("should impose the selected pages and drop number-up and page-ranges", async () => {
+    const result = await imposeIppJob({
+      printer: PRINTER_URI,
+      filePath: pdfPath,
+      options: ["sides=two-sided-long-edge", "page-ranges=2-4", "media=A4", "number-up=2"],
+    })
+
+    expect(screenshots.requested).toEqual([[2, 3, 4]])
+    expect(result.imposedPdf).toBe("/tmp/mcp-printer-n-up-test/output.pdf")
+    expect(result.job).toMatchObject({
+      filePath: result.imposedPdf,
+      options: ["sides=two-sided-long-edge", "media=A4"],
+    })
+
+    const [html] = vi.mocked(convertHtmlToPdf).mock.calls[0]
+    expect(html).toContain("size: 841.89pt 595.28pt;")
+    expect(html.match(/<div class="sheet">/g)).toHaveLength(2)
+  })
+
+  it("should use the last number-up option, like lp", async () => {
+    await imposeIppJob({
+      printer: PRINTER_URI,
+      filePath: pdfPath,
+      options: ["number-up=2", "number-up=4"],
+    })
+
+    const [html] = vi.mocked(convertHtmlToPdf).mock.calls[0]
+    expect(html.match(/<div class="sheet">/g)).toHaveLength(2)
+    expect(html).toContain("grid-template-rows: repeat(2, minmax(0, 1fr));")
+  })
+
+  it("should reject unsupported number-up values with the valid choices", async () => {
+    await expect(
+      imposeIppJob({ printer: PRINTER_URI, filePath: pdfPath, options: ["number-up=3"] })
+    ).rejects.toThrow("Invalid number-up=3: use one of 1, 2, 4, 6, 9, 16 pages per sheet.")
+  })
+})
@@ -0,0 +1,206 @@
+/**
+ * @fileoverview Unit tests for office document conversion, with LibreOffice mocked at the exec
+ * layer
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { existsSync, mkdirSync, writeFileSync } from "fs"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { execa } from "execa"
+import { config } from "../../src/config.js"
+import { getOfficeConverter, renderOfficeToPdf } from "../../src/renderers/office.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      libreofficePath: "",
+      convertTimeoutSeconds: 0,
+      maxConcurrentRenders: 0,
+      fallbackOnRenderError: false,
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+const document = join(fixturesDir, "file-types", "minutes.odt")
+// Any file that exists stands in for the soffice executable
+const soffice = fileURLToPath(import.meta.url)
+
+/** Value of a LibreOffice argument (e.g., "--outdir") or -env: setting in a mocked call. */
+function argument(args: string[], name: string): string {
+  const setting = args.find((arg) => arg.startsWith(`${name}=`))
+  return setting ? setting.slice(name.length + 1) : args[args.indexOf(name) + 1]
+}
+
+/** Makes the mocked soffice write its profile and, unless told otherwise, the PDF. */
+function fakeSoffice(writePdf = true) {
+  vi.mocked(execa).mockImplementation((async (_command: string, args: string[]) => {
+    mkdirSync(fileURLToPath(argument(args, "-env:UserInstallation")), { recursive: true })
+    if (writePdf) {
+      writeFileSync(join(argument(args, "--outdir"), "minutes.pdf"), "%PDF-1.4\n")
+    }
+    return { stdout: "", stderr: "", exitCode: 0 }
+  }) as unknown as typeof execa)
+}
+
+describe("getOfficeConverter", () => {
+  afterEach(() => {
+    config.libreofficePath = ""
+  })
+
+  it("should refuse office documents when libreoffice_path isn't set", () => {
+    expect(() => getOfficeConverter("/docs/budget.xlsx")).toThrow(
+      expect.objectContaining({
+        code: "UNSUPPORTED_FORMAT",
+        message:
+          "Cannot print budget.xlsx: .xlsx documents are converted to PDF with LibreOffice, and libreoffice_path (MCP_PRINTER_LIBREOFFICE_PATH) isn't set.",
+      })
+    )
+    expect(() => getOfficeConverter("/docs/letter", "docx")).toThrow(/\.docx documents/)
+  })
+
+  it("should refuse office documents when libreoffice_path doesn't exist", () => {
+    config.libreofficePath = "/nowhere/soffice"
+
+    expect(() => getOfficeConverter("/docs/budget.xlsx")).toThrow(
+      expect.objectContaining({
+        code: "UNSUPPORTED_FORMAT",
+        message: expect.stringContaining("/nowhere/soffice, which doesn't exist"),
+      })
+    )
+  })
+})
+
+describe("renderOfficeToPdf", () => {
+  const rendered: string[] = []
+
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+    config.libreofficePath = soffice
+  })
+
+  afterEach(() => {
+    rendered.splice(0).forEach(cleanupRenderedPdf)
+    config.libreofficePath = ""
+    config.convertTimeoutSeconds = 0
+  })
+
+  it("should run soffice headless with a profile of its own", async () => {
+    fakeSoffice()
+
+    const pdf = await renderOfficeToPdf(document, getOfficeConverter(document))
+    rendered.push(pdf)
+
+    expect(existsSync(pdf)).toBe(true)
+    const [command, args] = vi.mocked(execa).mock.calls[0] as unknown as [string, string[]]
+    expect(command).toBe(soffice)
+    expect(args).toEqual(expect.arrayContaining(["--headless", "--convert-to", "pdf", document]))
+    expect(argument(args, "--outdir")).toBe(dirname(pdf))
+    const profile = fileURLToPath(argument(args, "-env:UserInstallation"))
+    expect(dirname(profile)).toBe(dirname(pdf))
+    expect(existsSync(profile)).toBe(false)
+  })
+
+  it("should keep concurrent conversions apart", async () => {
+    fakeSoffice()
+    const converter = getOfficeConverter(document)
+
+    const pdfs = await Promise.all([
+      renderOfficeToPdf(document, converter),
+      renderOfficeToPdf(document, converter),
+    ])
+    rendered.push(...pdfs)
+
+    expect(new Set(pdfs.map(dirname)).size).toBe(2)
+    const profiles = vi
+      .mocked(execa)
+      .mock.calls.map((call) => argument(call[1] as unknown as string[], "-env:UserInstallation"))
+    expect(new Set(profiles).size).toBe(2)
+  })
+
+  it("should fail, leaving nothing behind, when soffice writes no PDF", async () => {
+    fakeSoffice(false)
+
+    await expect(renderOfficeToPdf(document, getOfficeConverter(document))).rejects.toThrow(
+      /LibreOffice failed to convert minutes\.odt: no PDF was written/
+    )
+    const args = vi.mocked(execa).mock.calls[0][1] as unknown as string[]
+    expect(existsSync(argument(args, "--outdir"))).toBe(false)
+  })
+
+  it("should stop a conversion that takes longer than MCP_PRINTER_CONVERT_TIMEOUT_SECONDS", async () => {
+    config.convertTimeoutSeconds = 0.05
+    vi.mocked(execa).mockImplementation(((
+      _command: string,
+      _args: string[],
+      options: { cancelSignal: AbortSignal }
+    ) =>
+      new Promise((_resolve, reject) =>
+        options.cancelSignal.addEventListener("abort", () => reject(new Error("canceled")))
+      )) as unknown as typeof execa)
+
+    await expect(renderOfficeToPdf(document, getOfficeConverter(document))).rejects.toMatchObject({
+      code: "TIMEOUT",
+      message: "LibreOffice timed out after 0.05s (MCP_PRINTER_CONVERT_TIMEOUT_SECONDS)",
+    })
+  })
+})
+
+describe("prepareFileForPrinting with office documents", () => {
+  afterEach(() => {
+    config.libreofficePath = ""
+  })
+
+  it("should convert them to PDF", async () => {
+    config.libreofficePath = soffice
+    fakeSoffice()
+
+    const result = await prepareFileForPrinting({ filePath: document })
+    try {
+      expect(result.renderType).toBe("office → PDF")
+      expect(result.actualFilePath).toBe(result.renderedPdf)
+      expect(result.actualFilePath).toMatch(/minutes\.pdf$/)
+    } finally {
+      cleanupRenderedPdf(result.renderedPdf)
+    }
+  })
+
+  it("should refuse them without a converter, even when render errors fall back", async () => {
+    config.fallbackOnRenderError = true
+    try {
+      await expect(prepareFileForPrinting({ filePath: document })).rejects.toMatchObject({
+        code: "UNSUPPORTED_FORMAT",
+      })
+    } finally {
+      config.fallbackOnRenderError = false
+    }
+  })
+
+  it("should refuse them when conversion fails, even when render errors fall back", async () => {
+    config.libreofficePath = soffice
+    config.fallbackOnRenderError = true
+    fakeSoffice(false)
+    try {
+      await expect(prepareFileForPrinting({ filePath: document })).rejects.toThrow(
+        /LibreOffice failed to convert minutes\.odt: no PDF was written/
+      )
+    } finally {
+      config.fallbackOnRenderError = false
+    }
+  })
+})
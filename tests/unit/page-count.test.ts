@@ -3,12 +3,17 @@
  */
 
 import { describe, it, expect, vi, beforeEach } from "vitest"
-import { calculatePhysicalSheets, shouldTriggerConfirmation } from "../../src/utils.js"
+import {
+  calculatePhysicalSheets,
+  getPagesPerSheet,
+  shouldTriggerConfirmation,
+} from "../../src/utils.js"
 
 // Mock the config module
 vi.mock("../../src/config.js", () => ({
   config: {
     confirmIfOverPages: 10, // Default test value
+    defaultOptions: ["number-up=4"],
   },
 }))
 
@@ -27,12 +32,28 @@ describe("calculatePhysicalSheets", () => {
     expect(calculatePhysicalSheets(3, true)).toBe(2)
   })
 
+  it("should divide pages across each side of a sheet for N-up printing", () => {
+    expect(calculatePhysicalSheets(4, false, 2)).toBe(2)
+    expect(calculatePhysicalSheets(4, true, 2)).toBe(1)
+    expect(calculatePhysicalSheets(5, true, 2)).toBe(2)
+    expect(calculatePhysicalSheets(17, false, 16)).toBe(2)
+  })
+
   it("should handle edge cases", () => {
     expect(calculatePhysicalSheets(0, false)).toBe(0)
     expect(calculatePhysicalSheets(0, true)).toBe(0)
   })
 })
 
+describe("getPagesPerSheet", () => {
+  it("should prefer number_up, then the last number-up option, then the defaults", () => {
+    expect(getPagesPerSheet("number-up=16", 2)).toBe(2)
+    expect(getPagesPerSheet("number-up=2 landscape number-up=6")).toBe(6)
+    expect(getPagesPerSheet("landscape")).toBe(4)
+    expect(getPagesPerSheet()).toBe(4)
+  })
+})
+
 describe("shouldTriggerConfirmation", () => {
   // Import the mocked config
   let config: { confirmIfOverPages: number }
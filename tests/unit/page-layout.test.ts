@@ -0,0 +1,132 @@
+/**
+ * @fileoverview Unit tests for page orientation and margins: validation, page sizes, the @page
+ * rule, and the orientation asked of the printer for PDFs printed as they are
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderMarkdown: true,
+      autoRenderCode: true,
+      autoRenderText: false,
+      fallbackOnRenderError: false,
+      header: "",
+      footer: "",
+      code: { excludeExtensions: [] },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import {
+  marginPoints,
+  pageDimensions,
+  pageLayoutCss,
+  validatePageMargins,
+} from "../../src/renderers/page-layout.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+const pdfFixture = join(
+  dirname(fileURLToPath(import.meta.url)),
+  "..",
+  "fixtures",
+  "pdfs",
+  "six-pages.pdf"
+)
+
+describe("validatePageMargins", () => {
+  it("should accept margins greater than 0 and at most 50 mm, on any sides", () => {
+    expect(() => validatePageMargins({ top: 0.5, right: 25, bottom: 50, left: 12.7 })).not.toThrow()
+    expect(() => validatePageMargins({ left: 30 })).not.toThrow()
+    expect(() => validatePageMargins({})).not.toThrow()
+  })
+
+  it("should reject zero and negative margins", () => {
+    expect(() => validatePageMargins({ top: 0 })).toThrow(
+      "Invalid margins.top 0: use millimeters greater than 0 and at most 50."
+    )
+    expect(() => validatePageMargins({ top: 10, left: -5 })).toThrow("Invalid margins.left -5")
+  })
+
+  it("should reject margins over 50 mm and numbers that aren't finite", () => {
+    expect(() => validatePageMargins({ bottom: 50.5 })).toThrow("Invalid margins.bottom 50.5")
+    expect(() => validatePageMargins({ right: NaN })).toThrow("Invalid margins.right NaN")
+    expect(() => validatePageMargins({ right: Infinity })).toThrow("Invalid margins.right")
+  })
+})
+
+describe("pageDimensions", () => {
+  it("should swap the width and height for landscape", () => {
+    expect(pageDimensions("A4")).toEqual({ width: 595.28, height: 841.89 })
+    expect(pageDimensions("A4", "landscape")).toEqual({ width: 841.89, height: 595.28 })
+    expect(pageDimensions(undefined, "landscape")).toEqual({ width: 792, height: 612 })
+  })
+})
+
+describe("marginPoints", () => {
+  it("should convert a given margin to points and fall back to the renderer's", () => {
+    expect(marginPoints({ left: 25.4 }, "left", 36)).toBeCloseTo(72)
+    expect(marginPoints({ left: 25.4 }, "right", 36)).toBe(36)
+    expect(marginPoints(undefined, "top", 54)).toBe(54)
+  })
+})
+
+describe("pageLayoutCss", () => {
+  it("should set the size and orientation, keeping the renderer's margin on sides left out", () => {
+    expect(pageLayoutCss({ orientation: "landscape" }, { margin: "0.5in", media: "A4" })).toBe(
+      "size: A4 landscape; margin: 0.5in;"
+    )
+    expect(pageLayoutCss({ margins: { top: 20, left: 15 } }, { margin: "0.5in" })).toBe(
+      "margin: 0.5in; margin-top: 20mm; margin-left: 15mm;"
+    )
+  })
+
+  it("should leave out what isn't set", () => {
+    expect(pageLayoutCss({})).toBe("")
+    expect(pageLayoutCss({ orientation: "portrait" })).toBe("size: portrait;")
+  })
+})
+
+describe("prepareFileForPrinting", () => {
+  it("should ask the printer to turn a PDF printed as it is", async () => {
+    for (const orientation of ["landscape", "portrait"] as const) {
+      const result = await prepareFileForPrinting({ filePath: pdfFixture, orientation })
+      expect(result).toMatchObject({ actualFilePath: pdfFixture, renderType: "", orientation })
+    }
+    const auto = await prepareFileForPrinting({ filePath: pdfFixture, orientation: "auto" })
+    expect(auto).not.toHaveProperty("orientation")
+  })
+
+  it("should leave a booklet's orientation to its imposition", async () => {
+    const result = await prepareFileForPrinting({
+      filePath: pdfFixture,
+      orientation: "landscape",
+      booklet: true,
+    })
+    try {
+      expect(result.renderType).toBe("booklet")
+      expect(result).not.toHaveProperty("orientation")
+    } finally {
+      cleanupRenderedPdf(result.renderedPdf)
+    }
+  })
+
+  it("should reject invalid margins before anything is rendered", async () => {
+    await expect(
+      prepareFileForPrinting({ filePath: pdfFixture, margins: { bottom: 0 } })
+    ).rejects.toThrow("Invalid margins.bottom 0")
+  })
+})
@@ -0,0 +1,183 @@
+/**
+ * @fileoverview Unit tests for the virtual PDF printer backend, writing to a temp directory
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll, afterEach } from "vitest"
+import { existsSync, mkdtempSync, readFileSync, rmSync, writeFileSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import { getBackend } from "../../src/backend.js"
+import { getPrinterInfo } from "../../src/printer-info.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "pdf",
+    pdfOutputDir: "",
+    pdfJobDelaySeconds: 0,
+    ippInsecureTls: false,
+  },
+}))
+
+describe("pdf backend", () => {
+  let outputDir = ""
+  const backend = () => getBackend()
+
+  beforeAll(() => {
+    outputDir = mkdtempSync(join(tmpdir(), "mcp-printer-pdf-test-"))
+    // A job left over from an earlier run of the server
+    writeFileSync(join(outputDir, "Virtual_PDF-41-old.pdf"), "%PDF-1.4\n")
+    config.pdfOutputDir = outputDir
+  })
+
+  afterAll(() => {
+    rmSync(outputDir, { recursive: true, force: true })
+  })
+
+  afterEach(() => {
+    vi.useRealTimers()
+    config.pdfJobDelaySeconds = 0
+  })
+
+  it("should be selected with MCP_PRINTER_BACKEND=pdf", () => {
+    expect(backend().name).toBe("pdf")
+  })
+
+  it("should list Virtual_PDF as the default printer", async () => {
+    expect(await backend().listPrinters()).toEqual([
+      {
+        name: "Virtual_PDF",
+        description: `Virtual PDF printer (writes to ${outputDir})`,
+        is_default: true,
+        state: "idle",
+        accepting_jobs: true,
+        location: outputDir,
+      },
+    ])
+  })
+
+  it("should write the document to the output directory, after the jobs already there", async () => {
+    const document = join(outputDir, "report.pdf")
+    writeFileSync(document, "%PDF-1.4 report\n")
+
+    const fromFile = await backend().submitJob({ printer: "Virtual_PDF", filePath: document })
+    const fromContent = await backend().submitJob({ title: "notes", content: "hello" })
+
+    expect(fromFile).toBe("Virtual_PDF-42")
+    expect(readFileSync(join(outputDir, "Virtual_PDF-42-report.pdf"), "utf-8")).toBe(
+      "%PDF-1.4 report\n"
+    )
+    expect(fromContent).toBe("Virtual_PDF-43")
+    expect(readFileSync(join(outputDir, "Virtual_PDF-43-notes.txt"), "utf-8")).toBe("hello")
+    expect(await backend().getJobStatus("43")).toMatchObject({
+      job_id: "Virtual_PDF-43",
+      state: "completed",
+      printer: "Virtual_PDF",
+      size: 5,
+      alerts: ["job-completed-successfully"],
+      status_message: `Written to ${join(outputDir, "Virtual_PDF-43-notes.txt")}`,
+    })
+  })
+
+  it("should go from pending to processing to completed over MCP_PRINTER_PDF_JOB_DELAY_SECONDS", async () => {
+    vi.useFakeTimers({ toFake: ["Date"] })
+    vi.setSystemTime(new Date("2026-10-14T09:00:00Z"))
+    config.pdfJobDelaySeconds = 2
+    const jobId = await backend().submitJob({ content: "slow" })
+
+    expect((await backend().getJobStatus(jobId)).state).toBe("pending")
+    vi.setSystemTime(new Date("2026-10-14T09:00:01Z"))
+    expect((await backend().getJobStatus(jobId)).state).toBe("processing")
+    expect((await backend().listPrinters())[0].state).toBe("printing")
+    vi.setSystemTime(new Date("2026-10-14T09:00:02Z"))
+    expect((await backend().getJobStatus(jobId)).state).toBe("completed")
+  })
+
+  it("should hold jobs with job-hold-until until they are released", async () => {
+    const jobId = await backend().submitJob({
+      content: "later",
+      options: ["job-hold-until=indefinite"],
+    })
+    expect(await backend().getJobStatus(jobId)).toMatchObject({
+      state: "held",
+      alerts: ["job-hold-until-specified"],
+    })
+
+    await backend().releaseJob(jobId)
+    expect((await backend().getJobStatus(jobId)).state).toBe("completed")
+  })
+
+  it("should release jobs held until a time of day at that time", async () => {
+    vi.useFakeTimers({ toFake: ["Date"] })
+    vi.setSystemTime(new Date("2026-10-14T22:00:00Z"))
+    const jobId = await backend().submitJob({
+      content: "tonight",
+      options: ["job-hold-until=22:30:00"],
+    })
+
+    expect((await backend().getJobStatus(jobId)).state).toBe("held")
+    vi.setSystemTime(new Date("2026-10-14T22:30:00Z"))
+    expect((await backend().getJobStatus(jobId)).state).toBe("completed")
+  })
+
+  it("should cancel unfinished jobs, removing their file", async () => {
+    config.pdfJobDelaySeconds = 60
+    const jobId = await backend().submitJob({ title: "draft", content: "draft" })
+    const outputPath = join(outputDir, `${jobId}-draft.txt`)
+    expect(existsSync(outputPath)).toBe(true)
+
+    await backend().cancelJob(jobId)
+
+    expect(existsSync(outputPath)).toBe(false)
+    expect(await backend().getJobStatus(jobId)).toMatchObject({
+      state: "canceled",
+      alerts: ["job-canceled-by-user"],
+    })
+    await expect(backend().cancelJob("Virtual_PDF-42")).rejects.toThrow(
+      "Job Virtual_PDF-42 is already completed - can't cancel."
+    )
+  })
+
+  it("should cancel all of the printer's unfinished jobs", async () => {
+    config.pdfJobDelaySeconds = 60
+    const first = await backend().submitJob({ content: "one" })
+    const second = await backend().submitJob({ content: "two" })
+
+    await backend().cancelAllJobs("Virtual_PDF")
+
+    expect((await backend().getJobStatus(first)).state).toBe("canceled")
+    expect((await backend().getJobStatus(second)).state).toBe("canceled")
+  })
+
+  it("should report jobs it didn't print as not-found", async () => {
+    expect(await backend().getJobStatus("Virtual_PDF-41")).toEqual({
+      job_id: "Virtual_PDF-41",
+      state: "not-found",
+    })
+  })
+
+  it("should refuse other printers with PRINTER_NOT_FOUND", async () => {
+    await expect(backend().submitJob({ printer: "Office_HP", content: "x" })).rejects.toMatchObject(
+      {
+        code: "PRINTER_NOT_FOUND",
+        message: 'Printer "Office_HP" not found: the pdf backend has a single printer, Virtual_PDF.',
+      }
+    )
+    await expect(getPrinterInfo("Office_HP")).rejects.toMatchObject({ code: "PRINTER_NOT_FOUND" })
+  })
+
+  it("should describe Virtual_PDF with every capability", async () => {
+    expect(await getPrinterInfo("Virtual_PDF")).toMatchObject({
+      printer: "Virtual_PDF",
+      source: "pdf",
+      state: "idle",
+      accepting_jobs: true,
+      duplex: true,
+      duplex_modes: ["none", "long-edge", "short-edge"],
+      color: true,
+      quality_levels: ["draft", "normal", "high"],
+      media_sizes: expect.arrayContaining(["Letter", "A4"]),
+      default_media: "Letter",
+    })
+  })
+})
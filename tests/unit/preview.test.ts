@@ -0,0 +1,111 @@
+/**
+ * @fileoverview Unit tests for dry-run previews
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, readFileSync, rmSync, writeFileSync } from "fs"
+import { tmpdir } from "os"
+import { dirname, join } from "path"
+import { config } from "../../src/config.js"
+import { savePreview, saveTextPreview, thumbnailContent } from "../../src/preview.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    previewDir: "",
+  },
+}))
+
+const PNG_SIGNATURE = [0x89, 0x50, 0x4e, 0x47]
+let screenshotFails = false
+
+vi.mock("pdf-parse", () => ({
+  PDFParse: class {
+    data: Buffer
+    constructor({ data }: { data: Buffer }) {
+      this.data = data
+    }
+    async getInfo() {
+      if (!this.data.toString("latin1").startsWith("%PDF-")) {
+        throw new Error("Invalid PDF structure")
+      }
+      return { total: 3 }
+    }
+    async getScreenshot() {
+      if (screenshotFails) {
+        throw new Error("Canvas unavailable")
+      }
+      return { pages: [{ data: new Uint8Array(PNG_SIGNATURE) }] }
+    }
+    async destroy() {}
+  },
+}))
+
+describe("previews", () => {
+  let sourceDir: string
+
+  beforeEach(() => {
+    sourceDir = mkdtempSync(join(tmpdir(), "mcp-printer-preview-test-"))
+    config.previewDir = join(sourceDir, "previews")
+    screenshotFails = false
+  })
+
+  afterEach(() => {
+    rmSync(sourceDir, { recursive: true, force: true })
+  })
+
+  function writeSource(name: string, contents: string): string {
+    const filePath = join(sourceDir, name)
+    writeFileSync(filePath, contents)
+    return filePath
+  }
+
+  it("should copy PDFs to the preview directory with their page count", async () => {
+    const source = writeSource("render.pdf", "%PDF-1.4 rendered")
+
+    const preview = await savePreview(source, "Quarterly Report.md")
+
+    expect(dirname(preview.path)).toBe(config.previewDir)
+    expect(preview.path).toMatch(/Quarterly_Report-[0-9a-f]{8}\.pdf$/)
+    expect(readFileSync(preview.path, "utf-8")).toBe("%PDF-1.4 rendered")
+    expect(preview.pages).toBe(3)
+    expect(preview.thumbnail).toBeUndefined()
+  })
+
+  it("should render the first page as a PNG thumbnail when asked", async () => {
+    const preview = await savePreview(writeSource("doc.pdf", "%PDF-1.4"), "doc.pdf", true)
+
+    expect([...(preview.thumbnail ?? [])]).toEqual(PNG_SIGNATURE)
+    expect(thumbnailContent(preview)).toEqual([
+      {
+        type: "image",
+        data: Buffer.from(PNG_SIGNATURE).toString("base64"),
+        mimeType: "image/png",
+      },
+    ])
+  })
+
+  it("should still save the preview when the thumbnail can't be rendered", async () => {
+    screenshotFails = true
+
+    const preview = await savePreview(writeSource("doc.pdf", "%PDF-1.4"), "doc.pdf", true)
+
+    expect(preview.pages).toBe(3)
+    expect(preview.thumbnail).toBeUndefined()
+    expect(thumbnailContent(preview)).toEqual([])
+  })
+
+  it("should save files that aren't PDFs without a page count", async () => {
+    const preview = await savePreview(writeSource("notes.txt", "plain text"), "notes.txt", true)
+
+    expect(preview.path).toMatch(/notes-[0-9a-f]{8}\.txt$/)
+    expect(preview.pages).toBeUndefined()
+    expect(preview.thumbnail).toBeUndefined()
+  })
+
+  it("should save text content", async () => {
+    const preview = await saveTextPreview("shopping list", "MCP Printer text")
+
+    expect(preview.path).toMatch(/MCP_Printer_text-[0-9a-f]{8}\.txt$/)
+    expect(readFileSync(preview.path, "utf-8")).toBe("shopping list")
+  })
+})
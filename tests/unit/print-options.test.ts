@@ -0,0 +1,209 @@
+/**
+ * @fileoverview Unit tests for typed print options and their translation to lp arguments
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { execa } from "execa"
+import {
+  validatePrintOptions,
+  parsePageRanges,
+  resolveHoldUntil,
+  countSelectedPages,
+  selectPages,
+  type PrintJobOptions,
+} from "../../src/print-options.js"
+import { executePrintJob } from "../../src/utils.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    defaultPrinter: "",
+    allowedPrinters: [],
+    defaultOptions: [],
+    autoDuplex: false,
+    maxCopies: 0,
+  },
+  MARKDOWN_EXTENSIONS: ["md", "markdown"],
+}))
+
+describe("executePrintJob argv translation", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+    vi.mocked(execa).mockResolvedValue({
+      exitCode: 0,
+      stdout: "request id is Office_HP-1 (1 file(s))",
+      stderr: "",
+    } as never)
+  })
+
+  const cases: Array<{ name: string; options: PrintJobOptions; expected: string[] }> = [
+    { name: "no options", options: {}, expected: [] },
+    { name: "single copy", options: { copies: 1 }, expected: [] },
+    { name: "multiple copies", options: { copies: 3 }, expected: ["-n", "3"] },
+    {
+      name: "long-edge duplex",
+      options: { duplex: "long-edge" },
+      expected: ["-o", "sides=two-sided-long-edge"],
+    },
+    {
+      name: "short-edge duplex",
+      options: { duplex: "short-edge" },
+      expected: ["-o", "sides=two-sided-short-edge"],
+    },
+    { name: "simplex", options: { duplex: "none" }, expected: ["-o", "sides=one-sided"] },
+    {
+      name: "page ranges",
+      options: { page_ranges: "1-3, 7" },
+      expected: ["-o", "page-ranges=1-3,7"],
+    },
+    { name: "A4 media", options: { media: "A4" }, expected: ["-o", "media=A4"] },
+    { name: "Legal media", options: { media: "Legal" }, expected: ["-o", "media=Legal"] },
+    { name: "2-up", options: { number_up: 2 }, expected: ["-o", "number-up=2"] },
+    {
+      name: "monochrome",
+      options: { color_mode: "monochrome" },
+      expected: ["-o", "print-color-mode=monochrome"],
+    },
+    { name: "draft quality", options: { quality: "draft" }, expected: ["-o", "print-quality=3"] },
+    { name: "hold", options: { hold: true }, expected: ["-o", "job-hold-until=indefinite"] },
+    { name: "landscape", options: { orientation: "landscape" }, expected: ["-o", "landscape"] },
+    {
+      name: "hold until a keyword",
+      options: { hold: true, hold_until: "Evening" },
+      expected: ["-o", "job-hold-until=evening"],
+    },
+    {
+      name: "all options combined",
+      options: { copies: 2, duplex: "long-edge", page_ranges: "2-4", media: "Letter" },
+      expected: [
+        "-o",
+        "sides=two-sided-long-edge",
+        "-o",
+        "page-ranges=2-4",
+        "-o",
+        "media=Letter",
+        "-n",
+        "2",
+      ],
+    },
+  ]
+
+  for (const { name, options, expected } of cases) {
+    it(`should translate ${name}`, async () => {
+      await executePrintJob("/tmp/doc.pdf", "Office_HP", options)
+
+      expect(execa).toHaveBeenCalledWith(
+        "lp",
+        ["-d", "Office_HP", ...expected, "--", "/tmp/doc.pdf"],
+        expect.anything()
+      )
+    })
+  }
+
+  it("should not call lp when options are invalid", async () => {
+    await expect(executePrintJob("/tmp/doc.pdf", "Office_HP", { copies: 0 })).rejects.toThrow(
+      /Invalid copies/
+    )
+    expect(execa).not.toHaveBeenCalled()
+  })
+})
+
+describe("validatePrintOptions", () => {
+  const valid: PrintJobOptions[] = [
+    {},
+    { copies: 1 },
+    { copies: 100 },
+    { page_ranges: "5" },
+    { page_ranges: "1-3,7,10-12" },
+    { duplex: "none", media: "A4" },
+    { number_up: 1 },
+    { number_up: 16, duplex: "long-edge" },
+    { color_mode: "auto", quality: "high" },
+  ]
+
+  for (const options of valid) {
+    it(`should accept ${JSON.stringify(options)}`, () => {
+      expect(() => validatePrintOptions(options)).not.toThrow()
+    })
+  }
+
+  const invalid: Array<{ options: PrintJobOptions; error: RegExp }> = [
+    { options: { copies: 0 }, error: /Invalid copies \(0\).*1 to 100/ },
+    { options: { copies: 101 }, error: /Invalid copies \(101\)/ },
+    { options: { copies: 1.5 }, error: /whole number/ },
+    { options: { page_ranges: "" }, error: /Invalid page_ranges/ },
+    { options: { page_ranges: "1-" }, error: /e\.g\. "1-3,7"/ },
+    { options: { page_ranges: "a-b" }, error: /Invalid page_ranges/ },
+    { options: { page_ranges: "1,,2" }, error: /Invalid page_ranges/ },
+    { options: { page_ranges: "0-2" }, error: /start at 1/ },
+    { options: { page_ranges: "5-3" }, error: /"5-3" ends before it starts/ },
+    { options: { duplex: "sideways" as never }, error: /Invalid duplex "sideways"/ },
+    { options: { media: "A3" as never }, error: /Invalid media "A3": use one of A4, Letter/ },
+    {
+      options: { number_up: 3 as never },
+      error: /Invalid number_up \(3\): use one of 1, 2, 4, 6, 9, 16 pages per sheet/,
+    },
+    {
+      options: { color_mode: "grayscale" as never },
+      error: /Invalid color_mode "grayscale": use one of color, monochrome, auto/,
+    },
+    { options: { quality: "best" as never }, error: /Invalid quality "best"/ },
+    { options: { hold_until: "after lunch" }, error: /Invalid hold_until "after lunch"/ },
+    { options: { hold_until: "2020-01-01T12:00:00Z" }, error: /in the next 24 hours/ },
+  ]
+
+  for (const { options, error } of invalid) {
+    it(`should reject ${JSON.stringify(options)}`, () => {
+      expect(() => validatePrintOptions(options)).toThrow(error)
+    })
+  }
+})
+
+describe("resolveHoldUntil", () => {
+  const now = new Date("2026-10-14T09:30:00Z")
+
+  it("should pass job-hold-until keywords through", () => {
+    expect(resolveHoldUntil("night", now)).toBe("night")
+    expect(resolveHoldUntil(" Second-Shift ", now)).toBe("second-shift")
+  })
+
+  it("should convert RFC 3339 times to the UTC time of day", () => {
+    expect(resolveHoldUntil("2026-10-14T18:30:00Z", now)).toBe("18:30:00")
+    expect(resolveHoldUntil("2026-10-14T18:30:00-04:00", now)).toBe("22:30:00")
+    expect(resolveHoldUntil("2026-10-15T08:00:00Z", now)).toBe("08:00:00")
+  })
+
+  it("should reject times that have passed or are more than a day away", () => {
+    expect(() => resolveHoldUntil("2026-10-14T09:00:00Z", now)).toThrow(/next 24 hours/)
+    expect(() => resolveHoldUntil("2026-10-16T09:00:00Z", now)).toThrow(/next 24 hours/)
+    expect(() => resolveHoldUntil("tomorrow 6pm", now)).toThrow(/RFC 3339 time/)
+  })
+})
+
+describe("parsePageRanges", () => {
+  it("should parse single pages and ranges", () => {
+    expect(parsePageRanges("1-3,7")).toEqual([
+      [1, 3],
+      [7, 7],
+    ])
+  })
+})
+
+describe("selectPages", () => {
+  it("should list selected pages in document order", () => {
+    expect(selectPages("7,1-3,2", 10)).toEqual([1, 2, 3, 7])
+    expect(selectPages("9-20", 10)).toEqual([9, 10])
+  })
+})
+
+describe("countSelectedPages", () => {
+  it("should count pages, clipping to the document and ignoring overlaps", () => {
+    expect(countSelectedPages("1-3,7", 10)).toBe(4)
+    expect(countSelectedPages("1-3,2-4", 10)).toBe(4)
+    expect(countSelectedPages("8-20", 10)).toBe(3)
+    expect(countSelectedPages("15", 10)).toBe(0)
+  })
+})
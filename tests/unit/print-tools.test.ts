@@ -0,0 +1,320 @@
+/**
+ * @fileoverview Unit tests for the print tools' handlers, registered on a fake server and run
+ * against a fake backend
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { copyFileSync, mkdtempSync } from "fs"
+import { tmpdir } from "os"
+import { join, resolve } from "path"
+import type { McpServer } from "@modelcontextprotocol/sdk/server/mcp.js"
+import { config } from "../../src/config.js"
+import { PrinterError } from "../../src/errors.js"
+import { readJobHistory } from "../../src/job-history.js"
+import { drainQueue } from "../../src/job-queue.js"
+import { RECOMMENDED_BATCH_SIZE } from "../../src/tools/batch-helpers.js"
+import { estimateTextPages, renderTextContentToPdf } from "../../src/renderers/text.js"
+import { registerPrintTools } from "../../src/tools/print.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "cups",
+    allowedPaths: [],
+    deniedPaths: [],
+    allowedPrinters: [],
+    rawAllowedPrinters: [],
+    defaultPrinter: "",
+    defaultOptions: [],
+    autoDuplex: false,
+    maxCopies: 10,
+    maxConcurrentRenders: 2,
+    maxPagesPerJob: 0,
+    absoluteMaxPages: 0,
+    maxPagesPerDay: 0,
+    maxJobsPerHour: 0,
+    maxJobsPerMinute: 0,
+    dedupeWindowSeconds: 0,
+    confirmIfOverPages: 0,
+    maxRetries: 0,
+    coverPage: false,
+    coverPageMode: "generate",
+    header: "",
+    footer: "",
+  },
+}))
+
+vi.mock("../../src/job-history.js", () => ({
+  recordJob: vi.fn().mockResolvedValue(undefined),
+  readJobHistory: vi.fn().mockResolvedValue([]),
+}))
+
+vi.mock("../../src/renderers/markdown.js", () => ({
+  renderMarkdownContentToPdf: vi.fn(async () => {
+    throw new PrinterError("TEMP_SPACE_EXCEEDED", "The temp directory is full", {
+      suggestion: "Free space in the temp directory.",
+    })
+  }),
+}))
+
+// Plain text "renders" to a five-page PDF, in place of Chrome, and is estimated at five pages
+vi.mock("../../src/renderers/text.js", () => ({
+  TEXT_WRAP_MODES: ["word", "character", "none"],
+  DEFAULT_TAB_WIDTH: 4,
+  MAX_TAB_WIDTH: 16,
+  estimateTextPages: vi.fn(() => 5),
+  renderTextContentToPdf: vi.fn(async () => {
+    const pdfPath = join(mkdtempSync(join(tmpdir(), "mcp-printer-tools-test-")), "text.pdf")
+    copyFileSync("tests/fixtures/pdfs/linearized.pdf", pdfPath)
+    return pdfPath
+  }),
+}))
+
+/** The jobs the fake backend was sent, in order: their titles and whether they were a file. */
+const submitted = vi.hoisted(() => [] as Array<{ title: string; file: boolean }>)
+
+vi.mock("../../src/backend.js", () => ({
+  getBackend: () => ({
+    name: "cups",
+    async submitJob(job: { title?: string; filePath?: string }) {
+      submitted.push({ title: job.title ?? "", file: job.filePath !== undefined })
+      return `Office_HP-${submitted.length}`
+    },
+    getJobStatus: async (jobId: string) => ({ job_id: jobId, state: "pending" }),
+  }),
+}))
+
+/** What a tool handler returns. */
+interface ToolResult {
+  content: Array<{ type: string; text: string }>
+  structuredContent?: { code: string; message: string; suggestion?: string }
+  isError?: boolean
+}
+
+/**
+ * Registers the print tools on a fake McpServer, returning their handlers.
+ */
+function printTools() {
+  const tools = new Map<string, (args: object, extra: object) => Promise<ToolResult>>()
+  const server = {
+    registerTool: vi.fn((name: string, _config: unknown, callback: never) => {
+      tools.set(name, callback)
+    }),
+  }
+  registerPrintTools(server as unknown as McpServer)
+  return (name: string, args: object, sessionId?: string) =>
+    tools.get(name)!(args, { signal: new AbortController().signal, sessionId })
+}
+
+const callTool = printTools()
+
+beforeEach(() => {
+  submitted.length = 0
+  vi.mocked(renderTextContentToPdf).mockClear()
+  vi.mocked(estimateTextPages).mockClear()
+})
+
+afterEach(async () => {
+  await drainQueue()
+  config.maxPagesPerJob = 0
+  config.absoluteMaxPages = 0
+  config.maxPagesPerDay = 0
+})
+
+describe("print_text", () => {
+  it("should return a render failure as an error result with its code", async () => {
+    const result = await callTool("print_text", {
+      content: "# Notes",
+      format: "markdown",
+      printer: "Office_HP",
+    })
+
+    expect(result.isError).toBe(true)
+    expect(result.structuredContent).toEqual({
+      code: "TEMP_SPACE_EXCEEDED",
+      message: "The temp directory is full",
+      suggestion: "Free space in the temp directory.",
+    })
+    expect(submitted).toEqual([])
+  })
+})
+
+describe("print_text page limits", () => {
+  const printText = (args: object = {}) =>
+    callTool("print_text", {
+      content: "{}\n".repeat(300),
+      title: "dump.json",
+      printer: "Office_HP",
+      ...args,
+    })
+
+  beforeEach(() => {
+    config.maxPagesPerJob = 5
+    config.absoluteMaxPages = 10
+  })
+
+  it("should estimate plain text's pages, and stream it at exactly the limit", async () => {
+    const result = await printText()
+    await drainQueue()
+
+    expect(result.isError).toBeUndefined()
+    expect(result.content[0].text).not.toContain("Rendered")
+    expect(estimateTextPages).toHaveBeenCalledWith("{}\n".repeat(300), { media: undefined })
+    expect(renderTextContentToPdf).not.toHaveBeenCalled()
+    expect(submitted).toEqual([{ title: "dump.json", file: false }])
+  })
+
+  it("should refuse plain text one page over the limit", async () => {
+    config.maxPagesPerJob = 4
+
+    const result = await printText()
+
+    expect(result.structuredContent).toMatchObject({
+      code: "PAGE_LIMIT_EXCEEDED",
+      message: "Job prints 5 pages, over the limit of 4 pages per job (MCP_PRINTER_MAX_PAGES_PER_JOB).",
+    })
+    expect(submitted).toEqual([])
+  })
+
+  it("should print over the limit with confirm_large_job, up to the absolute limit", async () => {
+    expect((await printText({ copies: 2, confirm_large_job: true })).isError).toBeUndefined()
+    const over = await printText({ copies: 3, confirm_large_job: true })
+    await drainQueue()
+
+    expect(over.structuredContent?.message).toContain(
+      "Job prints 15 pages (5 pages × 3 copies), over the absolute limit of 10 pages per job"
+    )
+    expect(submitted).toEqual([{ title: "dump.json", file: false }])
+  })
+
+  it("should count plain text toward the daily page quota", async () => {
+    config.maxPagesPerJob = 0
+    config.absoluteMaxPages = 0
+    config.maxPagesPerDay = 200
+    vi.mocked(readJobHistory).mockResolvedValueOnce([
+      {
+        job_id: "Office_HP-1",
+        tool: "print_file",
+        printer: "Office_HP",
+        title: "report.pdf",
+        printed_pages: 196,
+        submitted_at: new Date().toISOString(),
+        status: "completed",
+      },
+    ])
+
+    const result = await printText()
+
+    expect(result.structuredContent).toMatchObject({
+      code: "QUOTA_EXCEEDED",
+      message: expect.stringContaining("pages per day used"),
+    })
+    expect(submitted).toEqual([])
+  })
+
+  it("should stream plain text as it is when no page limit is set", async () => {
+    config.maxPagesPerJob = 0
+    config.absoluteMaxPages = 0
+
+    const result = await printText()
+    await drainQueue()
+
+    expect(result.content[0].text).not.toContain("Rendered")
+    expect(estimateTextPages).not.toHaveBeenCalled()
+    expect(renderTextContentToPdf).not.toHaveBeenCalled()
+    expect(submitted).toEqual([{ title: "dump.json", file: false }])
+  })
+
+  it("should stream plain text with the default page limits", async () => {
+    config.maxPagesPerJob = 50
+    config.absoluteMaxPages = 500
+
+    const result = await printText()
+    await drainQueue()
+
+    expect(result.isError).toBeUndefined()
+    expect(renderTextContentToPdf).not.toHaveBeenCalled()
+    expect(submitted).toEqual([{ title: "dump.json", file: false }])
+  })
+})
+
+describe("print_file rate limit", () => {
+  const pdf = resolve("tests/fixtures/pdfs/linearized.pdf")
+  const printFiles = (count: number, session: string) =>
+    callTool(
+      "print_file",
+      { files: Array.from({ length: count }, () => ({ file_path: pdf, printer: "Office_HP" })) },
+      session
+    )
+
+  beforeEach(() => {
+    config.allowedPaths = [resolve("tests")]
+  })
+
+  afterEach(() => {
+    config.maxJobsPerMinute = 0
+  })
+
+  it("should take a full batch with the default rate limit", async () => {
+    config.maxJobsPerMinute = 50
+
+    const result = await printFiles(RECOMMENDED_BATCH_SIZE, "session-full")
+    await drainQueue()
+
+    expect(result.isError).toBeUndefined()
+    expect(submitted).toHaveLength(RECOMMENDED_BATCH_SIZE)
+  })
+
+  it("should refuse a batch larger than the bucket before printing any of it", async () => {
+    config.maxJobsPerMinute = 3
+
+    const result = await printFiles(4, "session-large")
+
+    expect(result.structuredContent).toMatchObject({
+      code: "RATE_LIMITED",
+      message:
+        "Too many print jobs: a batch of 4 files is more than the 3 jobs each session may queue per minute (MCP_PRINTER_MAX_JOBS_PER_MINUTE).",
+      suggestion: "Print the files in batches of 3 or fewer, a minute apart.",
+    })
+    expect(submitted).toEqual([])
+  })
+
+  it("should refuse a batch that doesn't fit in what is left of the bucket", async () => {
+    config.maxJobsPerMinute = 3
+
+    await printFiles(2, "session-left")
+    const result = await printFiles(2, "session-left")
+    await drainQueue()
+
+    expect(result.structuredContent).toMatchObject({ code: "RATE_LIMITED" })
+    expect(result.structuredContent?.message).toMatch(
+      /a batch of 2 files doesn't fit in what is left\. Try again in \d+ seconds?\.$/
+    )
+    expect(submitted).toHaveLength(2)
+  })
+})
+
+describe("print_data", () => {
+  // Not valid base64, so the request fails if the data is decoded before the options are checked
+  const printData = (args: object) =>
+    callTool("print_data", {
+      data: "not base64!",
+      mime_type: "application/pdf",
+      filename: "ticket.pdf",
+      printer: "Office_HP",
+      ...args,
+    })
+
+  it("should reject a bad watermark before decoding the data", async () => {
+    const result = await printData({ watermark: "  " })
+
+    expect(result.isError).toBe(true)
+    expect(result.content[0].text).toContain("Invalid watermark: the text is empty.")
+  })
+
+  it("should reject bad margins before decoding the data", async () => {
+    const result = await printData({ margins: { top: 0 } })
+
+    expect(result.isError).toBe(true)
+    expect(result.content[0].text).toContain("Invalid margins.top 0")
+  })
+})
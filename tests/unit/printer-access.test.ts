@@ -0,0 +1,166 @@
+/**
+ * @fileoverview Unit tests for the printer allow-list
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { execa } from "execa"
+import { config } from "../../src/config.js"
+import {
+  isPrinterAllowed,
+  validatePrinter,
+  resolvePrinter,
+  resolveRawPrinter,
+  filterAllowedPrinters,
+} from "../../src/printer-access.js"
+import type { PrinterSummary } from "../../src/cups.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "cups",
+    defaultPrinter: "",
+    allowedPrinters: [],
+    rawAllowedPrinters: [],
+  },
+}))
+
+function printer(name: string, isDefault = false): PrinterSummary {
+  return { name, description: name, is_default: isDefault, state: "idle", accepting_jobs: true }
+}
+
+/**
+ * Mocks lpstat output with the given system default printer.
+ */
+function mockSystemDefault(name: string | null) {
+  vi.mocked(execa).mockResolvedValue({
+    exitCode: 0,
+    stdout:
+      "printer Office_HP is idle.  enabled since today\n" +
+      "printer Accounting_HP is idle.  enabled since today\n" +
+      (name ? `system default destination: ${name}` : "no system default destination"),
+    stderr: "",
+  } as never)
+}
+
+describe("printer allow-list", () => {
+  beforeEach(() => {
+    config.defaultPrinter = ""
+    config.allowedPrinters = []
+    vi.mocked(execa).mockReset()
+  })
+
+  describe("with an empty allow-list", () => {
+    it("should allow every printer", () => {
+      expect(isPrinterAllowed("Office_HP")).toBe(true)
+      expect(isPrinterAllowed("Accounting_HP")).toBe(true)
+      expect(() => validatePrinter("Accounting_HP")).not.toThrow()
+    })
+
+    it("should list every printer", () => {
+      const printers = [printer("Office_HP"), printer("Accounting_HP")]
+      expect(filterAllowedPrinters(printers)).toEqual(printers)
+    })
+
+    it("should leave the printer unset so CUPS uses the system default", async () => {
+      await expect(resolvePrinter()).resolves.toBeUndefined()
+      expect(execa).not.toHaveBeenCalled()
+    })
+  })
+
+  describe("with an allow-list", () => {
+    beforeEach(() => {
+      config.allowedPrinters = ["Office_HP"]
+    })
+
+    it("should allow only listed printers, ignoring case", () => {
+      expect(isPrinterAllowed("Office_HP")).toBe(true)
+      expect(isPrinterAllowed("office_hp")).toBe(true)
+      expect(isPrinterAllowed("Accounting_HP")).toBe(false)
+    })
+
+    it("should name the allowed printers when refusing", () => {
+      expect(() => validatePrinter("Accounting_HP")).toThrow(
+        /"Accounting_HP" is not in the allowed printers list.*Allowed printers: Office_HP/
+      )
+    })
+
+    it("should only list allowed printers", () => {
+      const printers = [printer("Office_HP"), printer("Accounting_HP")]
+      expect(filterAllowedPrinters(printers).map((p) => p.name)).toEqual(["Office_HP"])
+    })
+
+    it("should reject an explicit printer that is not allowed", async () => {
+      await expect(resolvePrinter("Accounting_HP")).rejects.toThrow(/Access denied/)
+    })
+
+    it("should check the system default when no printer is configured", async () => {
+      mockSystemDefault("Office_HP")
+      await expect(resolvePrinter()).resolves.toBe("Office_HP")
+
+      mockSystemDefault("Accounting_HP")
+      await expect(resolvePrinter()).rejects.toThrow(/"Accounting_HP" is not in the allowed/)
+    })
+
+    it("should ask for a printer when there is no default at all", async () => {
+      mockSystemDefault(null)
+      await expect(resolvePrinter()).rejects.toThrow(/No printer specified/)
+    })
+  })
+
+  describe("default printer fallback", () => {
+    it("should use the configured default printer when none is given", async () => {
+      config.defaultPrinter = "Office_HP"
+      config.allowedPrinters = ["Office_HP"]
+
+      await expect(resolvePrinter()).resolves.toBe("Office_HP")
+      await expect(resolvePrinter(undefined)).resolves.toBe("Office_HP")
+    })
+
+    it("should prefer an explicit printer over the default", async () => {
+      config.defaultPrinter = "Office_HP"
+
+      await expect(resolvePrinter("Home_Canon")).resolves.toBe("Home_Canon")
+    })
+
+    it("should reject a configured default that is not allowed", async () => {
+      config.defaultPrinter = "Accounting_HP"
+      config.allowedPrinters = ["Office_HP"]
+
+      await expect(resolvePrinter()).rejects.toThrow(/Access denied/)
+    })
+  })
+})
+
+describe("raw printer allow-list", () => {
+  beforeEach(() => {
+    config.defaultPrinter = ""
+    config.allowedPrinters = []
+    config.rawAllowedPrinters = ["Zebra_Labels"]
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should allow only printers listed for raw jobs, ignoring case", async () => {
+    await expect(resolveRawPrinter("zebra_labels")).resolves.toBe("zebra_labels")
+    await expect(resolveRawPrinter("Office_HP")).rejects.toThrow(
+      /Access denied: Raw data can't be sent to "Office_HP".*Printers allowed raw jobs: Zebra_Labels/
+    )
+  })
+
+  it("should refuse every printer when none is listed", async () => {
+    config.rawAllowedPrinters = []
+    await expect(resolveRawPrinter("Zebra_Labels")).rejects.toThrow(
+      /No printers are allowed raw jobs/
+    )
+  })
+
+  it("should check the system default when no printer is given", async () => {
+    mockSystemDefault("Office_HP")
+    await expect(resolveRawPrinter(undefined)).rejects.toThrow(/"Office_HP"/)
+
+    mockSystemDefault(null)
+    await expect(resolveRawPrinter(undefined)).rejects.toThrow(/No printer specified/)
+  })
+})
@@ -0,0 +1,187 @@
+/**
+ * @fileoverview Unit tests for printer capability discovery (get_printer_info)
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { execa } from "execa"
+import { readFileSync } from "fs"
+import { join } from "path"
+import { parseLpoptions } from "../../src/cups.js"
+import { decodeIppMessage, GROUP_TAGS } from "../../src/ipp/encoding.js"
+import {
+  capabilitiesFromIppAttributes,
+  capabilitiesFromLpoptions,
+  getPrinterInfo,
+  printOptionWarnings,
+} from "../../src/printer-info.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    ippInsecureTls: false,
+  },
+}))
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures")
+
+function lpoptionsFixture(name: string) {
+  return parseLpoptions(readFileSync(join(fixturesDir, "lpoptions", name), "utf-8"))
+}
+
+describe("capabilitiesFromLpoptions", () => {
+  it("should describe a monochrome duplex laser printer", () => {
+    const info = capabilitiesFromLpoptions("Office_HP", lpoptionsFixture("hp-laserjet-m404.txt"), {
+      name: "Office_HP",
+      description: "HP LaserJet Pro M404",
+      is_default: true,
+      state: "idle",
+      accepting_jobs: true,
+      state_reasons: ["toner-low-report"],
+    })
+
+    expect(info).toMatchObject({
+      printer: "Office_HP",
+      source: "cups",
+      state: "idle",
+      state_reasons: ["toner-low-report"],
+      accepting_jobs: true,
+      duplex: true,
+      duplex_modes: ["none", "long-edge", "short-edge"],
+      color: false,
+      quality_levels: ["draft", "normal", "high"],
+      default_media: "Letter",
+      resolutions: ["300dpi", "600dpi", "1200dpi"],
+      default_resolution: "600dpi",
+    })
+    expect(info.media_sizes).toContain("A4")
+    expect(info.media_sizes).not.toContain("A3")
+    expect(info.media_sizes).not.toContain("Custom.WIDTHxHEIGHT")
+  })
+
+  it("should describe a color printer without duplex", () => {
+    const info = capabilitiesFromLpoptions("Epson", lpoptionsFixture("epson-et-8550.txt"))
+
+    expect(info).toMatchObject({
+      state: "unknown",
+      state_reasons: [],
+      duplex: false,
+      duplex_modes: [],
+      color: true,
+      quality_levels: ["draft", "normal", "high"],
+      default_media: "A4",
+      resolutions: ["360dpi", "720dpi", "5760x1440dpi"],
+    })
+    expect(info.media_sizes).toContain("A3")
+    expect(info).not.toHaveProperty("accepting_jobs")
+  })
+})
+
+describe("capabilitiesFromIppAttributes", () => {
+  it("should normalize Get-Printer-Attributes into the same shape", () => {
+    const message = decodeIppMessage(
+      readFileSync(join(fixturesDir, "ipp", "get-printer-attributes-response.bin"))
+    )
+    const printerGroup = message.groups.find((g) => g.tag === GROUP_TAGS.printer)
+    const attributes = Object.fromEntries(
+      (printerGroup?.attributes ?? []).map((a) => [a.name, a.values])
+    )
+
+    expect(capabilitiesFromIppAttributes("ipp://printer.local/ipp/print", attributes)).toEqual({
+      printer: "ipp://printer.local/ipp/print",
+      source: "ipp",
+      make_and_model: "HP LaserJet Pro M404",
+      state: "idle",
+      state_reasons: ["media-low-report", "toner-low-warning"],
+      accepting_jobs: true,
+      duplex: true,
+      duplex_modes: ["none", "long-edge", "short-edge"],
+      color: false,
+      quality_levels: [],
+      media_sizes: ["A4", "Letter", "Legal"],
+      default_media: "A4",
+      resolutions: ["600dpi", "1200dpi"],
+    })
+  })
+
+  it("should read print-quality-supported enums as quality levels", () => {
+    const info = capabilitiesFromIppAttributes("ipp://printer.local/ipp/print", {
+      "print-color-mode-supported": ["auto", "monochrome", "color"],
+      "print-quality-supported": [3, 4],
+    })
+
+    expect(info.color).toBe(true)
+    expect(info.quality_levels).toEqual(["draft", "normal"])
+  })
+})
+
+describe("printOptionWarnings", () => {
+  const monochrome = capabilitiesFromLpoptions(
+    "Office_HP",
+    lpoptionsFixture("hp-laserjet-m404.txt")
+  )
+
+  it("should warn when color is asked of a monochrome printer", () => {
+    expect(printOptionWarnings(monochrome, { color_mode: "color" })).toEqual([
+      `Office_HP doesn't report color support; color_mode "color" may be ignored.`,
+    ])
+    expect(printOptionWarnings(monochrome, { color_mode: "monochrome" })).toEqual([])
+    expect(printOptionWarnings(monochrome, { color_mode: "auto" })).toEqual([])
+  })
+
+  it("should warn about quality levels the printer doesn't list", () => {
+    const draftOnly = { ...monochrome, quality_levels: ["draft" as const] }
+
+    expect(printOptionWarnings(draftOnly, { quality: "high" })).toEqual([
+      `Office_HP supports quality draft; quality "high" may be ignored.`,
+    ])
+    expect(printOptionWarnings(draftOnly, { quality: "draft" })).toEqual([])
+    expect(printOptionWarnings({ ...monochrome, quality_levels: [] }, { quality: "high" })).toEqual(
+      []
+    )
+  })
+})
+
+describe("getPrinterInfo", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  function mockCups(lpstat: string) {
+    vi.mocked(execa).mockImplementation(((command: string) =>
+      Promise.resolve({
+        exitCode: 0,
+        stdout:
+          command === "lpstat"
+            ? lpstat
+            : readFileSync(join(fixturesDir, "lpoptions", "hp-laserjet-m404.txt"), "utf-8"),
+        stderr: "",
+      })) as never)
+  }
+
+  it("should combine lpstat state with lpoptions capabilities", async () => {
+    mockCups(
+      "printer Office_HP is idle.  enabled since today\n" +
+        "\tAlerts: media-empty-error\n" +
+        "Office_HP accepting requests since today"
+    )
+
+    const info = await getPrinterInfo("office_hp")
+
+    expect(execa).toHaveBeenCalledWith("lpoptions", ["-p", "Office_HP", "-l"], expect.anything())
+    expect(info).toMatchObject({
+      printer: "Office_HP",
+      state: "idle",
+      state_reasons: ["media-empty-error"],
+      duplex: true,
+    })
+  })
+
+  it("should report unknown printers", async () => {
+    mockCups("printer Office_HP is idle.  enabled since today")
+
+    await expect(getPrinterInfo("Nope")).rejects.toThrow(/Printer "Nope" not found/)
+  })
+})
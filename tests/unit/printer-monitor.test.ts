@@ -0,0 +1,179 @@
+/**
+ * @fileoverview Unit tests for the printer status monitor
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import {
+  PrinterMonitor,
+  type MonitorNotifier,
+  type MonitorSource,
+} from "../../src/printer-monitor.js"
+import type { JobState, PrinterSummary } from "../../src/cups.js"
+
+/** Long enough that only the first poll runs on its own; tests run the others. */
+const INTERVAL_SECONDS = 3600
+
+/** Waits for the poll the monitor starts when the client opts in. */
+const firstPoll = () => new Promise((resolve) => setTimeout(resolve, 0))
+
+/**
+ * A fake backend whose printer state reasons and job states the tests change.
+ */
+function fakeSource() {
+  const reasons = new Map<string, string[]>([
+    ["Office_HP", []],
+    ["Lab_Laser", []],
+  ])
+  const jobs = new Map<string, JobState>()
+  const source = {
+    reasons,
+    jobs,
+    listPrinters: vi.fn(
+      async (): Promise<PrinterSummary[]> =>
+        [...reasons].map(([name, stateReasons]) => ({
+          name,
+          description: name,
+          is_default: false,
+          state: "idle",
+          accepting_jobs: true,
+          state_reasons: stateReasons,
+        }))
+    ),
+    listJobs: vi.fn(async () => [...jobs].map(([job_id, status]) => ({ job_id, status }))),
+  }
+  return source satisfies MonitorSource
+}
+
+/**
+ * A fake client that records the notifications it is sent.
+ */
+function fakeNotifier() {
+  return {
+    log: vi.fn<MonitorNotifier["log"]>(async () => {}),
+    jobsUpdated: vi.fn<MonitorNotifier["jobsUpdated"]>(async () => {}),
+  }
+}
+
+describe("PrinterMonitor", () => {
+  let source: ReturnType<typeof fakeSource>
+  let notifier: ReturnType<typeof fakeNotifier>
+  let monitor: PrinterMonitor
+
+  beforeEach(() => {
+    source = fakeSource()
+    notifier = fakeNotifier()
+    monitor = new PrinterMonitor(INTERVAL_SECONDS, source, notifier)
+  })
+
+  it("should not poll until the client sets a log level or subscribes", async () => {
+    await firstPoll()
+    expect(monitor.running).toBe(false)
+    expect(source.listPrinters).not.toHaveBeenCalled()
+
+    monitor.setLogLevel("info")
+    expect(monitor.running).toBe(true)
+    await firstPoll()
+    expect(source.listPrinters).toHaveBeenCalledTimes(1)
+    // Job states are only read for a subscribed client
+    expect(source.listJobs).not.toHaveBeenCalled()
+    monitor.close()
+  })
+
+  it("should log state reasons as they appear and clear", async () => {
+    source.reasons.set("Office_HP", ["media-empty-error"])
+    monitor.setLogLevel("info")
+    await firstPoll()
+    expect(notifier.log.mock.calls).toEqual([["error", "printer Office_HP: media-empty"]])
+
+    notifier.log.mockClear()
+    await monitor.poll()
+    expect(notifier.log).not.toHaveBeenCalled()
+
+    source.reasons.set("Office_HP", [])
+    source.reasons.set("Lab_Laser", ["toner-low-warning", "cover-open-report"])
+    await monitor.poll()
+    expect(notifier.log.mock.calls).toEqual([
+      ["info", "printer Office_HP: media-empty cleared"],
+      ["warning", "printer Lab_Laser: toner-low"],
+      ["info", "printer Lab_Laser: cover-open"],
+    ])
+    monitor.close()
+  })
+
+  it("should only log at or above the client's level", async () => {
+    monitor.setLogLevel("warning")
+    await firstPoll()
+
+    source.reasons.set("Office_HP", ["media-jam-error", "door-open-report"])
+    source.reasons.set("Lab_Laser", ["toner-low-warning"])
+    await monitor.poll()
+    expect(notifier.log.mock.calls).toEqual([
+      ["error", "printer Office_HP: media-jam"],
+      ["warning", "printer Lab_Laser: toner-low"],
+    ])
+
+    notifier.log.mockClear()
+    monitor.setLogLevel("error")
+    source.reasons.set("Office_HP", [])
+    await monitor.poll()
+    expect(notifier.log).not.toHaveBeenCalled()
+    monitor.close()
+  })
+
+  it("should send a jobs update when a subscribed client's jobs change state", async () => {
+    source.jobs.set("Office_HP-12", "pending")
+    monitor.setJobsSubscribed(true)
+    await firstPoll()
+    expect(notifier.jobsUpdated).not.toHaveBeenCalled()
+
+    await monitor.poll()
+    expect(notifier.jobsUpdated).not.toHaveBeenCalled()
+
+    source.jobs.set("Office_HP-12", "processing")
+    await monitor.poll()
+    source.jobs.set("Office_HP-13", "pending")
+    await monitor.poll()
+    expect(notifier.jobsUpdated).toHaveBeenCalledTimes(2)
+    // Printer state reasons are only read once the client sets a log level
+    expect(source.listPrinters).not.toHaveBeenCalled()
+
+    monitor.setJobsSubscribed(false)
+    expect(monitor.running).toBe(false)
+  })
+
+  it("should skip printers or jobs that can't be listed until the next poll", async () => {
+    monitor.setLogLevel("info")
+    monitor.setJobsSubscribed(true)
+    await firstPoll()
+
+    source.listPrinters.mockRejectedValueOnce(new Error("lpstat: Unable to connect"))
+    source.reasons.set("Office_HP", ["offline-report"])
+    await monitor.poll()
+    expect(notifier.log).not.toHaveBeenCalled()
+
+    await monitor.poll()
+    expect(notifier.log.mock.calls).toEqual([["info", "printer Office_HP: offline"]])
+    monitor.close()
+  })
+
+  it("should stop for good when the session closes, dropping a poll in progress", async () => {
+    monitor.setLogLevel("info")
+    await firstPoll()
+
+    let release = () => {}
+    source.listPrinters.mockImplementationOnce(async (signal?: AbortSignal) => {
+      await new Promise<void>((resolve) => (release = resolve))
+      expect(signal?.aborted).toBe(true)
+      return [{ ...(await fakeSource().listPrinters())[0], state_reasons: ["media-empty-error"] }]
+    })
+    const polling = monitor.poll()
+    monitor.close()
+    release()
+    await polling
+
+    expect(monitor.running).toBe(false)
+    expect(notifier.log).not.toHaveBeenCalled()
+    monitor.setLogLevel("debug")
+    expect(monitor.running).toBe(false)
+  })
+})
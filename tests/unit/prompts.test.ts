@@ -0,0 +1,95 @@
+/**
+ * @fileoverview Unit tests for the workflow prompts
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import type { GetPromptResult } from "@modelcontextprotocol/sdk/types.js"
+import {
+  buildPrintCodeReviewPrompt,
+  buildPrintDocumentPrompt,
+  parseFileList,
+} from "../../src/tools/prompts.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    allowedPrinters: [],
+  },
+}))
+
+/**
+ * Reads the text of a prompt's only message.
+ */
+function promptText(result: GetPromptResult): string {
+  expect(result.messages).toHaveLength(1)
+  const [message] = result.messages
+  expect(message.role).toBe("user")
+  return message.content.type === "text" ? message.content.text : ""
+}
+
+describe("parseFileList", () => {
+  it("should split on commas and newlines, dropping blanks", () => {
+    expect(parseFileList(" src/a.ts, src/b.ts\nsrc/c.ts,,\n")).toEqual([
+      "src/a.ts",
+      "src/b.ts",
+      "src/c.ts",
+    ])
+    expect(parseFileList(" , ")).toEqual([])
+  })
+})
+
+describe("buildPrintCodeReviewPrompt", () => {
+  it("should print each file 2-up duplex with highlighting on the given printer", () => {
+    const text = promptText(
+      buildPrintCodeReviewPrompt({
+        file_paths: "src/server.ts, src/my file.ts",
+        printer: "Office_HP",
+      })
+    )
+    expect(text).toContain("- src/server.ts\n- src/my file.ts\n")
+    expect(text).toContain("PRINTER: Office_HP")
+    expect(text).toContain(
+      '{ file_path: "src/my file.ts", printer: "Office_HP", force_code_render: true, ' +
+        'line_numbers: true, number_up: 2, duplex: "short-edge" }'
+    )
+    expect(text.match(/file_path:/g)).toHaveLength(2)
+  })
+
+  it("should use the default printer when none is given", () => {
+    const text = promptText(buildPrintCodeReviewPrompt({ file_paths: "main.go" }))
+    expect(text).toContain("PRINTER: the default printer")
+    expect(text).not.toContain("printer:")
+  })
+
+  it("should quote paths so they can't break out of the tool call", () => {
+    const text = promptText(buildPrintCodeReviewPrompt({ file_paths: 'say "hi".py' }))
+    expect(text).toContain('file_path: "say \\"hi\\".py"')
+  })
+})
+
+describe("buildPrintDocumentPrompt", () => {
+  it("should estimate the document before printing it", () => {
+    const text = promptText(
+      buildPrintDocumentPrompt({ path: " /docs/Annual Report.pdf ", printer: "HP LaserJet" })
+    )
+    expect(text).toContain("DOCUMENT: /docs/Annual Report.pdf\nPRINTER: HP LaserJet")
+    expect(text).toContain('estimate_job({ file_path: "/docs/Annual Report.pdf" })')
+    expect(text).toContain(
+      'print_file({ files: [{ file_path: "/docs/Annual Report.pdf", printer: "HP LaserJet" }] })'
+    )
+    expect(text.indexOf("estimate_job(")).toBeLessThan(text.indexOf("print_file("))
+    expect(text).toContain("confirm_large_job: true")
+  })
+
+  it("should leave the printer out when none is given", () => {
+    const text = promptText(buildPrintDocumentPrompt({ path: "notes.md", printer: " " }))
+    expect(text).toContain('print_file({ files: [{ file_path: "notes.md" }] })')
+    expect(text).toContain("PRINTER: the default printer")
+  })
+
+  it("should estimate and print on the given media", () => {
+    const text = promptText(buildPrintDocumentPrompt({ path: "notes.md", media: "A4" }))
+    expect(text).toContain("PRINTER: the default printer\nMEDIA: A4")
+    expect(text).toContain('estimate_job({ file_path: "notes.md", media: "A4" })')
+    expect(text).toContain('print_file({ files: [{ file_path: "notes.md", media: "A4" }] })')
+  })
+})
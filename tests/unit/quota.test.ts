@@ -0,0 +1,212 @@
+/**
+ * @fileoverview Unit tests for the print quotas, counted from a real job history ledger with a
+ * fake clock
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, rmSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import { recordJob } from "../../src/job-history.js"
+import { checkQuota, countQuotaUsage } from "../../src/quota.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "cups",
+    historyFile: "",
+    maxJobsPerHour: 0,
+    maxPagesPerDay: 0,
+    quotaScope: "global",
+  },
+}))
+
+vi.mock("../../src/cups.js", () => ({
+  getJobStatus: vi.fn(),
+}))
+
+vi.mock("../../src/ipp/client.js", () => ({
+  getIppJobStatus: vi.fn(),
+  parseIppJobId: () => null,
+}))
+
+vi.mock("../../src/utils.js", () => ({
+  getPdfPageCount: vi.fn().mockRejectedValue(new Error("Not a PDF")),
+}))
+
+/** Records a submitted job that printed the given pages, returning its job ID. */
+let nextJob = 1
+async function printed(printedPages: number, session?: string): Promise<string> {
+  const jobId = `Office_HP-${nextJob++}`
+  await recordJob({
+    jobId,
+    tool: "print_file",
+    printer: "Office_HP",
+    title: "homework.pdf",
+    printedPages,
+    session,
+  })
+  return jobId
+}
+
+describe("print quotas", () => {
+  let tempDir: string
+
+  beforeEach(() => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-quota-test-"))
+    config.historyFile = join(tempDir, "history.json")
+    config.maxJobsPerHour = 0
+    config.maxPagesPerDay = 0
+    config.quotaScope = "global"
+    vi.useFakeTimers({ toFake: ["Date"] })
+    vi.setSystemTime(new Date(2026, 9, 14, 9, 30))
+  })
+
+  afterEach(() => {
+    vi.useRealTimers()
+    rmSync(tempDir, { recursive: true, force: true })
+  })
+
+  it("should allow anything when no quota is set", async () => {
+    for (let i = 0; i < 5; i++) {
+      await printed(100)
+    }
+
+    await expect(checkQuota(100)).resolves.toBeUndefined()
+  })
+
+  it("should refuse jobs over the hourly quota until the next clock hour", async () => {
+    config.maxJobsPerHour = 2
+    vi.setSystemTime(new Date(2026, 9, 14, 8, 59))
+    await printed(1)
+    vi.setSystemTime(new Date(2026, 9, 14, 9, 5))
+    await printed(1)
+    await expect(checkQuota(1)).resolves.toBeUndefined()
+
+    vi.setSystemTime(new Date(2026, 9, 14, 9, 40))
+    await printed(1)
+    const resetsAt = new Date(2026, 9, 14, 10, 0).toISOString()
+    await expect(checkQuota(1)).rejects.toMatchObject({
+      code: "QUOTA_EXCEEDED",
+      message: `Print quota reached: 2 of 2 jobs per hour used (MCP_PRINTER_MAX_JOBS_PER_HOUR). It resets at ${resetsAt}.`,
+    })
+
+    vi.setSystemTime(new Date(2026, 9, 14, 10, 0))
+    await expect(checkQuota(1)).resolves.toBeUndefined()
+  })
+
+  it("should refuse a job that would go over the daily page quota until midnight", async () => {
+    config.maxPagesPerDay = 20
+    vi.setSystemTime(new Date(2026, 9, 13, 23, 50))
+    await printed(15)
+    vi.setSystemTime(new Date(2026, 9, 14, 9, 30))
+    await printed(12)
+
+    await expect(checkQuota(8)).resolves.toBeUndefined()
+    const resetsAt = new Date(2026, 9, 15, 0, 0).toISOString()
+    await expect(checkQuota(9)).rejects.toMatchObject({
+      code: "QUOTA_EXCEEDED",
+      message: `Print quota reached: this job prints 9 pages, and 12 of 20 pages per day used (MCP_PRINTER_MAX_PAGES_PER_DAY). It resets at ${resetsAt}.`,
+    })
+
+    vi.setSystemTime(new Date(2026, 9, 14, 23, 59, 59))
+    await expect(checkQuota(9)).rejects.toMatchObject({ code: "QUOTA_EXCEEDED" })
+    vi.setSystemTime(new Date(2026, 9, 15, 0, 0))
+    await expect(checkQuota(20)).resolves.toBeUndefined()
+  })
+
+  it("should refuse jobs whose pages can't be counted once the day's pages are used", async () => {
+    config.maxPagesPerDay = 10
+    await printed(10)
+
+    await expect(checkQuota(0)).rejects.toThrow(/10 of 10 pages per day used/)
+  })
+
+  it("should count queued jobs, but not the ones the ledger already has", async () => {
+    config.maxJobsPerHour = 3
+    const jobId = await printed(1)
+    const now = new Date().toISOString()
+    const queued = () => [
+      { job_id: jobId, at: now, pages: 1 },
+      { at: now, pages: 1 },
+    ]
+
+    await expect(checkQuota(1, queued)).resolves.toBeUndefined()
+    await printed(1)
+    await expect(checkQuota(1, queued)).rejects.toThrow(/3 of 3 jobs per hour used/)
+  })
+})
+
+describe("per-session quotas", () => {
+  let tempDir: string
+
+  beforeEach(() => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-quota-test-"))
+    config.historyFile = join(tempDir, "history.json")
+    config.maxJobsPerHour = 2
+    config.maxPagesPerDay = 0
+    config.quotaScope = "session"
+  })
+
+  afterEach(() => {
+    rmSync(tempDir, { recursive: true, force: true })
+  })
+
+  it("should count each session's jobs on their own", async () => {
+    await printed(1, "session-a")
+    await printed(1, "session-a")
+    await printed(1, "session-b")
+
+    await expect(checkQuota(1, () => [], "session-a")).rejects.toMatchObject({
+      code: "QUOTA_EXCEEDED",
+      message: expect.stringMatching(
+        /^Print quota reached: 2 of 2 jobs per hour used by this session \(MCP_PRINTER_MAX_JOBS_PER_HOUR\)/
+      ),
+    })
+    await expect(checkQuota(1, () => [], "session-b")).resolves.toBeUndefined()
+    // The stdio client's quota counts the jobs no session queued
+    await expect(checkQuota(1)).resolves.toBeUndefined()
+
+    config.quotaScope = "global"
+    await expect(checkQuota(1, () => [], "session-b")).rejects.toThrow(
+      /3 of 2 jobs per hour used \(/
+    )
+  })
+
+  it("should count a session's queued jobs, but not other sessions'", async () => {
+    await printed(1, "session-b")
+    const now = new Date().toISOString()
+    const queued = () => [
+      { at: now, pages: 1, session: "session-a" },
+      { at: now, pages: 1, session: "session-b" },
+    ]
+
+    await expect(checkQuota(1, queued, "session-a")).resolves.toBeUndefined()
+    await expect(checkQuota(1, queued, "session-b")).rejects.toThrow(/2 of 2 jobs per hour/)
+  })
+})
+
+describe("countQuotaUsage", () => {
+  it("should count jobs by clock hour and pages by local day", () => {
+    const now = new Date(2026, 9, 14, 9, 30)
+    const at = (hours: number, minutes: number) =>
+      new Date(2026, 9, 14, hours, minutes).toISOString()
+
+    expect(
+      countQuotaUsage(
+        [
+          { at: new Date(2026, 9, 13, 23, 0).toISOString(), pages: 50 },
+          { at: at(8, 59), pages: 3 },
+          { at: at(9, 0), pages: 4 },
+          { at: at(9, 29), pages: 5 },
+        ],
+        now
+      )
+    ).toEqual({
+      jobsThisHour: 2,
+      pagesToday: 12,
+      hourResetsAt: new Date(2026, 9, 14, 10, 0),
+      dayResetsAt: new Date(2026, 9, 15, 0, 0),
+    })
+  })
+})
@@ -0,0 +1,53 @@
+/**
+ * @fileoverview Unit tests for raw printing: base64 data for print_raw and the options raw jobs
+ * accept
+ */
+
+import { describe, it, expect } from "vitest"
+import { decodeRawData, validateRawOptions } from "../../src/raw.js"
+
+describe("decodeRawData", () => {
+  it("should decode base64, padded or not", () => {
+    expect(decodeRawData("XlhBXkZESGVsbG9eRlNeWFo=").toString()).toBe("^XA^FDHello^FS^XZ")
+    expect(decodeRawData("XlhBXlha").toString()).toBe("^XA^XZ")
+    expect(decodeRawData("G0A").equals(Buffer.from([0x1b, 0x40]))).toBe(true)
+  })
+
+  it("should ignore line breaks in the data", () => {
+    expect(decodeRawData("XlhBXkZE\r\nSGVsbG9e\nRlNeWFo=\n").toString()).toBe(
+      "^XA^FDHello^FS^XZ"
+    )
+  })
+
+  it("should keep binary bytes intact", () => {
+    const bytes = Buffer.from([0x1b, 0x40, 0x00, 0xff, 0x1d, 0x56, 0x00])
+    expect(decodeRawData(bytes.toString("base64")).equals(bytes)).toBe(true)
+  })
+
+  it("should refuse empty data", () => {
+    expect(() => decodeRawData("")).toThrow("Cannot print empty data")
+    expect(() => decodeRawData(" \n ")).toThrow("Cannot print empty data")
+  })
+
+  it("should refuse data that isn't base64", () => {
+    expect(() => decodeRawData("^XA^XZ")).toThrow("Invalid data: expected base64-encoded bytes")
+    expect(() => decodeRawData("XlhBX")).toThrow("Invalid data")
+    expect(() => decodeRawData("Xlh=BXlha")).toThrow("Invalid data")
+  })
+})
+
+describe("validateRawOptions", () => {
+  it("should accept options that don't change the pages", () => {
+    expect(() => validateRawOptions({})).not.toThrow()
+    expect(() => validateRawOptions({ copies: 3, number_up: 1 })).not.toThrow()
+  })
+
+  it("should refuse page ranges and number-up", () => {
+    expect(() => validateRawOptions({ page_ranges: "1-2" })).toThrow(
+      "Cannot print page_ranges in a raw job"
+    )
+    expect(() => validateRawOptions({ number_up: 2 })).toThrow(
+      "Invalid number_up (2) for a raw job"
+    )
+  })
+})
@@ -0,0 +1,99 @@
+/**
+ * @fileoverview Unit tests for the printer resources
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { config } from "../../src/config.js"
+import { getBackend } from "../../src/backend.js"
+import { getPrinterInfo, type PrinterCapabilities } from "../../src/printer-info.js"
+import type { PrinterSummary } from "../../src/cups.js"
+import {
+  RESOURCE_NOT_FOUND,
+  printerResourceUri,
+  readPrinterResource,
+  readPrintersResource,
+} from "../../src/tools/resources.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    allowedPrinters: [],
+  },
+}))
+
+const listPrinters = vi.fn()
+
+vi.mock("../../src/backend.js", () => ({
+  getBackend: vi.fn(() => ({ listPrinters })),
+}))
+
+vi.mock("../../src/printer-info.js", () => ({
+  getPrinterInfo: vi.fn(),
+}))
+
+function printer(name: string): PrinterSummary {
+  return { name, description: name, is_default: false, state: "idle", accepting_jobs: true }
+}
+
+describe("printerResourceUri", () => {
+  it("should percent-encode printer names", () => {
+    expect(printerResourceUri("Office_HP")).toBe("printer://printers/Office_HP")
+    expect(printerResourceUri("HP LaserJet #2")).toBe("printer://printers/HP%20LaserJet%20%232")
+  })
+})
+
+describe("printer resources", () => {
+  beforeEach(() => {
+    vi.mocked(config).allowedPrinters = []
+    listPrinters.mockResolvedValue([printer("Office_HP"), printer("HP LaserJet")])
+    vi.mocked(getPrinterInfo).mockReset()
+    vi.mocked(getBackend).mockClear()
+  })
+
+  it("should list the printers with the URI of each one's resource", async () => {
+    const { printers } = await readPrintersResource()
+    expect(printers.map((p) => p.uri)).toEqual([
+      "printer://printers/Office_HP",
+      "printer://printers/HP%20LaserJet",
+    ])
+    expect(printers[0]).toMatchObject({ name: "Office_HP", state: "idle" })
+  })
+
+  it("should only list allowed printers", async () => {
+    vi.mocked(config).allowedPrinters = ["Office_HP"]
+    const { printers } = await readPrintersResource()
+    expect(printers.map((p) => p.name)).toEqual(["Office_HP"])
+  })
+
+  it("should read a printer whose name has spaces", async () => {
+    const info = { printer: "HP LaserJet", state: "idle" } as unknown as PrinterCapabilities
+    vi.mocked(getPrinterInfo).mockResolvedValue(info)
+    await expect(readPrinterResource("HP%20LaserJet")).resolves.toBe(info)
+    expect(getPrinterInfo).toHaveBeenCalledWith("HP LaserJet", undefined)
+  })
+
+  it("should match printer names case-insensitively", async () => {
+    await readPrinterResource("office_hp")
+    expect(getPrinterInfo).toHaveBeenCalledWith("Office_HP", undefined)
+  })
+
+  it("should report unknown printers as not found", async () => {
+    await expect(readPrinterResource("Missing")).rejects.toMatchObject({
+      code: RESOURCE_NOT_FOUND,
+    })
+    expect(getPrinterInfo).not.toHaveBeenCalled()
+  })
+
+  it("should report printers that aren't allowed as not found", async () => {
+    vi.mocked(config).allowedPrinters = ["Office_HP"]
+    await expect(readPrinterResource("HP%20LaserJet")).rejects.toMatchObject({
+      code: RESOURCE_NOT_FOUND,
+    })
+    expect(getPrinterInfo).not.toHaveBeenCalled()
+  })
+
+  it("should report malformed names as not found", async () => {
+    await expect(readPrinterResource("%E0%A4%A")).rejects.toMatchObject({
+      code: RESOURCE_NOT_FOUND,
+    })
+  })
+})
@@ -0,0 +1,150 @@
+/**
+ * @fileoverview Unit tests for server_status against a fake backend, answering and unreachable
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, rmSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import { PrinterError } from "../../src/errors.js"
+import { drainQueue, enqueueJob } from "../../src/job-queue.js"
+import { getServerStatus } from "../../src/server-status.js"
+import packageJson from "../../package.json" with { type: "json" }
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    cupsServer: "",
+    defaultPrinter: "",
+    tempDir: "",
+    tempMaxMb: 0,
+    tempMaxAgeHours: 24,
+    maxRetries: 0,
+    maxCopies: 10,
+    maxPagesPerJob: 50,
+    absoluteMaxPages: 500,
+    confirmIfOverPages: 10,
+    maxJobsPerHour: 0,
+    maxPagesPerDay: 200,
+    quotaScope: "session",
+    maxJobsPerMinute: 30,
+    dedupeWindowSeconds: 60,
+    maxUploadBytes: 20 * 1024 * 1024,
+    maxConcurrentRenders: 2,
+    sessionTtlMinutes: 60,
+  },
+}))
+
+const fakeBackend = {
+  name: "cups",
+  listPrinters: vi.fn(),
+}
+
+vi.mock("../../src/backend.js", () => ({
+  getBackend: () => fakeBackend,
+}))
+
+let baseDir = ""
+
+beforeEach(() => {
+  baseDir = mkdtempSync(join(tmpdir(), "mcp-printer-status-test-"))
+  config.tempDir = join(baseDir, "work")
+  config.cupsServer = ""
+  config.defaultPrinter = ""
+  fakeBackend.listPrinters.mockReset()
+  fakeBackend.listPrinters.mockResolvedValue(
+    ["Office_HP", "Lobby_HP"].map((name) => ({
+      name,
+      description: name,
+      is_default: name === "Lobby_HP",
+      state: "idle",
+      accepting_jobs: true,
+    }))
+  )
+})
+
+afterEach(async () => {
+  await drainQueue()
+  rmSync(baseDir, { recursive: true, force: true })
+})
+
+describe("getServerStatus", () => {
+  it("should report a healthy backend, the system default printer, and the limits", async () => {
+    const status = await getServerStatus()
+
+    expect(status).toMatchObject({
+      version: packageJson.version,
+      node: process.version,
+      platform: process.platform,
+      backend: { name: "cups", cups_server: "(local)", reachable: true, printers: 2 },
+      default_printer: { name: "Lobby_HP", source: "system" },
+      queue: { queued: 0, submitting: 0, retrying: 0 },
+      temp: { directory: config.tempDir, bytes: 0, directories: 0 },
+      limits: {
+        max_pages_per_job: 50,
+        absolute_max_pages: 500,
+        max_jobs_per_hour: 0,
+        max_pages_per_day: 200,
+        quota_scope: "session",
+        max_jobs_per_minute: 30,
+        max_upload_bytes: 20 * 1024 * 1024,
+      },
+    })
+    expect(status.backend).not.toHaveProperty("error")
+    expect(status.uptime_seconds).toBeGreaterThanOrEqual(0)
+  })
+
+  it("should report an unreachable backend as a field instead of failing", async () => {
+    config.cupsServer = "print.example.com:631"
+    fakeBackend.listPrinters.mockRejectedValue(
+      new PrinterError(
+        "SERVER_UNREACHABLE",
+        "Cannot reach the CUPS server print.example.com:631: lpstat: Unable to connect to server"
+      )
+    )
+
+    const status = await getServerStatus()
+
+    expect(status.backend).toEqual({
+      name: "cups",
+      cups_server: "print.example.com:631",
+      reachable: false,
+      error:
+        "Cannot reach the CUPS server print.example.com:631: lpstat: Unable to connect to server",
+      code: "SERVER_UNREACHABLE",
+    })
+    expect(status.default_printer).toBeNull()
+    expect(status.temp.directory).toBe(config.tempDir)
+  })
+
+  it("should still name the configured default printer when the backend fails", async () => {
+    config.defaultPrinter = "Office_HP"
+    fakeBackend.listPrinters.mockRejectedValue(new Error("lpstat exited with code 1"))
+
+    const status = await getServerStatus()
+
+    expect(status.backend).toMatchObject({ reachable: false, error: "lpstat exited with code 1" })
+    expect(status.backend).not.toHaveProperty("code")
+    expect(status.default_printer).toEqual({ name: "Office_HP", source: "config" })
+  })
+
+  it("should count the jobs still in the queue", async () => {
+    let finish = () => {}
+    const submitted = new Promise<void>((resolve) => {
+      finish = resolve
+    })
+    const submit = async () => {
+      await submitted
+      return "Office_HP-1"
+    }
+    enqueueJob({ printer: "Office_HP", title: "first", submit })
+    enqueueJob({ printer: "Office_HP", title: "second", submit })
+
+    const status = await getServerStatus()
+    finish()
+    await drainQueue()
+
+    expect(status.queue).toEqual({ queued: 1, submitting: 1, retrying: 0 })
+    expect((await getServerStatus()).queue).toEqual({ queued: 0, submitting: 0, retrying: 0 })
+  })
+})
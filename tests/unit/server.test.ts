@@ -0,0 +1,97 @@
+/**
+ * @fileoverview Unit tests for transport selection at server startup
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { startHttpServer } from "../../src/http-server.js"
+import { startServer } from "../../src/server.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    authToken: "s3cret",
+  },
+}))
+
+vi.mock("../../src/tools/index.js", () => ({
+  registerAllTools: vi.fn(),
+}))
+
+vi.mock("@modelcontextprotocol/sdk/server/mcp.js", () => ({
+  McpServer: class {
+    connect = vi.fn()
+  },
+}))
+
+vi.mock("@modelcontextprotocol/sdk/server/stdio.js", () => ({
+  StdioServerTransport: class {},
+}))
+
+vi.mock("../../src/http-server.js", () => ({
+  MCP_ENDPOINT: "/mcp",
+  startHttpServer: vi.fn().mockResolvedValue({
+    address: () => ({ address: "127.0.0.1", port: 8080 }),
+  }),
+}))
+
+describe("startServer", () => {
+  const { log, info, debug } = console
+
+  beforeEach(() => {
+    vi.mocked(startHttpServer).mockClear()
+    vi.spyOn(console, "error").mockImplementation(() => {})
+  })
+
+  afterEach(() => {
+    Object.assign(console, { log, info, debug })
+  })
+
+  it("should ignore the auth token on the stdio transport", async () => {
+    await startServer({ transport: "stdio", listen: { port: 8080 } })
+
+    expect(startHttpServer).not.toHaveBeenCalled()
+  })
+
+  it("should send console output to stderr on the stdio transport", async () => {
+    await startServer({ transport: "stdio", listen: { port: 8080 } })
+    console.log("stray output from a dependency")
+
+    const logged = vi
+      .mocked(console.error)
+      .mock.calls.flat()
+      .map((arg) => String(arg))
+    expect(logged.some((line) => line.includes("stray output from a dependency"))).toBe(true)
+  })
+
+  it("should start on Windows, printing through the Windows spooler", async () => {
+    const platform = Object.getOwnPropertyDescriptor(process, "platform")!
+    Object.defineProperty(process, "platform", { value: "win32" })
+    try {
+      await expect(
+        startServer({ transport: "stdio", listen: { port: 8080 } })
+      ).resolves.toBeUndefined()
+    } finally {
+      Object.defineProperty(process, "platform", platform)
+    }
+
+    const logged = vi
+      .mocked(console.error)
+      .mock.calls.flat()
+      .map((arg) => String(arg))
+    expect(logged.some((line) => line.includes('"backend":"windows"'))).toBe(true)
+  })
+
+  it("should pass the auth token to the HTTP transport without logging it", async () => {
+    await startServer({ transport: "http", listen: { host: "127.0.0.1", port: 8080 } })
+
+    expect(startHttpServer).toHaveBeenCalledWith(
+      expect.any(Function),
+      { host: "127.0.0.1", port: 8080 },
+      { authToken: "s3cret" }
+    )
+    const logged = vi
+      .mocked(console.error)
+      .mock.calls.flat()
+      .map((arg) => String(arg))
+    expect(logged.some((line) => line.includes("s3cret"))).toBe(false)
+  })
+})
@@ -0,0 +1,76 @@
+/**
+ * @fileoverview Unit tests for HTTP sessions: the client each one declared, and idle expiry
+ */
+
+import { describe, it, expect, afterEach } from "vitest"
+import {
+  clientLabel,
+  closeSession,
+  getSession,
+  idleSessions,
+  openSession,
+  touchSession,
+} from "../../src/sessions.js"
+
+const MINUTE = 60 * 1000
+
+afterEach(() => {
+  for (const id of ["session-a", "session-b", "session-c"]) {
+    closeSession(id)
+  }
+})
+
+describe("openSession", () => {
+  it("should record the client a session declared", () => {
+    const session = openSession("session-a", { name: "claude-ai", version: "0.1.0" }, 0)
+
+    expect(session).toEqual({
+      id: "session-a",
+      client: { name: "claude-ai", version: "0.1.0" },
+      opened_at: "1970-01-01T00:00:00.000Z",
+      lastActiveAt: 0,
+    })
+    expect(getSession("session-a")).toBe(session)
+    expect(clientLabel("session-a")).toBe("claude-ai 0.1.0")
+  })
+
+  it("should name no client for sessions that didn't declare one, or the stdio transport", () => {
+    openSession("session-a")
+
+    expect(getSession("session-a")).not.toHaveProperty("client")
+    expect(clientLabel("session-a")).toBeUndefined()
+    expect(clientLabel(undefined)).toBeUndefined()
+    expect(getSession(undefined)).toBeUndefined()
+  })
+})
+
+describe("closeSession", () => {
+  it("should forget the session", () => {
+    openSession("session-a", { name: "claude-ai", version: "0.1.0" })
+    closeSession("session-a")
+
+    expect(getSession("session-a")).toBeUndefined()
+    expect(clientLabel("session-a")).toBeUndefined()
+    expect(() => closeSession("session-a")).not.toThrow()
+  })
+})
+
+describe("idleSessions", () => {
+  it("should list the sessions idle longer than the TTL, oldest activity first", () => {
+    openSession("session-a", undefined, 0)
+    openSession("session-b", undefined, 0)
+    openSession("session-c", undefined, 0)
+    touchSession("session-a", 20 * MINUTE)
+    touchSession("session-c", 50 * MINUTE)
+
+    expect(idleSessions(30 * MINUTE, 60 * MINUTE)).toEqual(["session-b", "session-a"])
+    expect(idleSessions(60 * MINUTE, 60 * MINUTE)).toEqual([])
+  })
+
+  it("should ignore activity from sessions that aren't open", () => {
+    touchSession("session-a", 0)
+
+    expect(getSession("session-a")).toBeUndefined()
+    expect(idleSessions(0, MINUTE)).toEqual([])
+  })
+})
@@ -0,0 +1,122 @@
+/**
+ * @fileoverview Unit tests for the graceful shutdown, run against a fake slow Chrome and a fake
+ * slow lp
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll } from "vitest"
+import { chmodSync, existsSync, mkdtempSync, readdirSync, rmSync, writeFileSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import { submitLpJob } from "../../src/cups.js"
+import { readJobHistory } from "../../src/job-history.js"
+import { enqueueJob, getQueuedJob } from "../../src/job-queue.js"
+import { installShutdownHandlers, isShuttingDown, trackToolCall } from "../../src/shutdown.js"
+import { convertHtmlToPdf } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    backend: "cups",
+    submitTimeoutSeconds: 0,
+    statusTimeoutSeconds: 0,
+    shutdownTimeoutSeconds: 0.2,
+    maxRetries: 0,
+    chromePath: "",
+    historyFile: "",
+    tempDir: "",
+    fallbackOnRenderError: false,
+  },
+}))
+
+const TEMP_DIR_PREFIX = "shutdown-test-"
+
+let fakeBin = ""
+
+/**
+ * Writes an executable shell script to the fake bin directory.
+ */
+function fakeCommand(name: string, script: string) {
+  const path = join(fakeBin, name)
+  writeFileSync(path, `#!/bin/sh\n${script}\n`)
+  chmodSync(path, 0o755)
+}
+
+/**
+ * Temp directories left behind by convertHtmlToPdf runs in this file.
+ */
+function leftoverTempDirs(): string[] {
+  if (!existsSync(config.tempDir)) {
+    return []
+  }
+  return readdirSync(config.tempDir).filter((name) => name.startsWith(TEMP_DIR_PREFIX))
+}
+
+describe("graceful shutdown", () => {
+  const originalPath = process.env.PATH
+  const sigintListeners = process.listeners("SIGINT")
+
+  beforeAll(() => {
+    fakeBin = mkdtempSync(join(tmpdir(), "mcp-printer-fake-bin-"))
+    fakeCommand("lp", "exec sleep 30")
+    fakeCommand("chrome", "exec sleep 30")
+    process.env.PATH = `${fakeBin}:${originalPath}`
+    config.chromePath = join(fakeBin, "chrome")
+    config.historyFile = join(fakeBin, "history.json")
+    config.tempDir = join(fakeBin, "temp")
+  })
+
+  afterAll(() => {
+    process.env.PATH = originalPath
+    rmSync(fakeBin, { recursive: true, force: true })
+    for (const listener of process.listeners("SIGINT")) {
+      if (!sigintListeners.includes(listener)) {
+        process.off("SIGINT", listener)
+      }
+    }
+  })
+
+  it("should stop a slow render, cancel waiting jobs, clean up, and exit with 1", async () => {
+    const exit = vi.fn()
+    installShutdownHandlers(exit)
+
+    const rendered = trackToolCall((signal) =>
+      convertHtmlToPdf("<p>hi</p>", { tempDirPrefix: TEMP_DIR_PREFIX, signal })
+    ).catch((error: Error) => error)
+    // A submission that hangs, and a job waiting behind it
+    enqueueJob({
+      printer: "Office_HP",
+      submit: () => submitLpJob({ printer: "Office_HP", content: "first" }),
+    })
+    const cleanup = vi.fn()
+    const waiting = enqueueJob({
+      printer: "Office_HP",
+      title: "notes.txt",
+      tool: "print_file",
+      submit: vi.fn(),
+      cleanup,
+    })
+    await vi.waitFor(() => expect(leftoverTempDirs()).toHaveLength(1))
+
+    process.emit("SIGTERM")
+    expect(isShuttingDown()).toBe(true)
+    await expect(trackToolCall(async () => "too late")).rejects.toThrow(
+      "The server is shutting down and isn't accepting new requests."
+    )
+
+    await vi.waitFor(() => expect(exit).toHaveBeenCalledWith(1), { timeout: 3000 })
+    expect(((await rendered) as Error).message).toBe("Rendering was canceled")
+    expect(leftoverTempDirs()).toEqual([])
+    expect(cleanup).toHaveBeenCalled()
+    expect(getQueuedJob(waiting.id)?.state).toBe("canceled")
+    expect(await readJobHistory()).toEqual([
+      expect.objectContaining({
+        job_id: waiting.id,
+        tool: "print_file",
+        printer: "Office_HP",
+        title: "notes.txt",
+        status: "canceled",
+        canceled_reason: "shutdown",
+      }),
+    ])
+  })
+})
@@ -0,0 +1,167 @@
+/**
+ * @fileoverview Unit tests for the temp directory: per-render subdirectories, the startup sweep
+ * of directories left by crashed renders, and the size budget
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import {
+  chmodSync,
+  existsSync,
+  mkdirSync,
+  mkdtempSync,
+  rmSync,
+  statSync,
+  symlinkSync,
+  utimesSync,
+  writeFileSync,
+} from "fs"
+import { tmpdir } from "os"
+import { basename, dirname, join } from "path"
+import { config } from "../../src/config.js"
+import { createTempDir, getTempUsage, isTempDir, sweepTempDir } from "../../src/temp-files.js"
+import { cleanupRenderedPdf } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    tempDir: "",
+    tempMaxAgeHours: 24,
+    tempMaxMb: 0,
+  },
+}))
+
+const HOUR_MS = 60 * 60 * 1000
+
+let baseDir = ""
+
+/**
+ * Leaves a directory in the temp directory, as a crashed render would, last written to the given
+ * number of hours ago.
+ */
+function orphan(name: string, hoursAgo: number, bytes = 10): string {
+  const path = join(config.tempDir, name)
+  mkdirSync(join(path, "nested"), { recursive: true })
+  writeFileSync(join(path, "nested", "output.pdf"), Buffer.alloc(bytes))
+  const time = new Date(Date.now() - hoursAgo * HOUR_MS)
+  utimesSync(path, time, time)
+  return path
+}
+
+beforeEach(() => {
+  baseDir = mkdtempSync(join(tmpdir(), "mcp-printer-temp-test-"))
+  config.tempDir = join(baseDir, "work")
+  config.tempMaxAgeHours = 24
+  config.tempMaxMb = 0
+})
+
+afterEach(() => {
+  rmSync(baseDir, { recursive: true, force: true })
+})
+
+describe("createTempDir", () => {
+  it("should create a directory per render in the work directory", () => {
+    const first = createTempDir("markdown-")
+    const second = createTempDir("markdown-")
+
+    expect(first).not.toBe(second)
+    expect(dirname(first)).toBe(config.tempDir)
+    expect(basename(first)).toMatch(/^markdown-/)
+    expect(isTempDir(first)).toBe(true)
+    expect(isTempDir(baseDir)).toBe(false)
+  })
+
+  it("should remove a rendered PDF's directory on cleanup", () => {
+    const dir = createTempDir("code-")
+    writeFileSync(join(dir, "input.html"), "<p>hi</p>")
+    writeFileSync(join(dir, "output.pdf"), "%PDF-1.4\n")
+
+    cleanupRenderedPdf(join(dir, "output.pdf"))
+    expect(existsSync(dir)).toBe(false)
+    expect(existsSync(config.tempDir)).toBe(true)
+  })
+
+  it("should refuse new renders once the work directory is over its budget", () => {
+    config.tempMaxMb = 1
+    orphan("html-crashed", 1, 512 * 1024)
+    expect(() => createTempDir("html-")).not.toThrow()
+
+    orphan("html-crashed-too", 1, 600 * 1024)
+    expect(() => createTempDir("html-")).toThrow(
+      expect.objectContaining({
+        code: "TEMP_SPACE_EXCEEDED",
+        message: expect.stringContaining("holds 1.1 MB, over its 1 MB limit"),
+      })
+    )
+  })
+})
+
+describe("sweepTempDir", () => {
+  it("should remove directories older than the maximum age, and keep the rest", () => {
+    const old = orphan("markdown-old", 30)
+    const recent = orphan("markdown-recent", 2)
+
+    expect(sweepTempDir()).toEqual(["markdown-old"])
+    expect(existsSync(old)).toBe(false)
+    expect(existsSync(recent)).toBe(true)
+  })
+
+  it("should leave files and directories that aren't a render's alone", () => {
+    const photos = orphan("photos", 30)
+    const notes = join(config.tempDir, "markdown-notes.txt")
+    writeFileSync(notes, "mine")
+    const time = new Date(Date.now() - 30 * HOUR_MS)
+    utimesSync(notes, time, time)
+
+    expect(sweepTempDir()).toEqual([])
+    expect(existsSync(photos)).toBe(true)
+    expect(existsSync(notes)).toBe(true)
+  })
+
+  it("should refuse to sweep a work directory that is a symlink", () => {
+    const old = orphan("markdown-old", 30)
+    const link = join(baseDir, "link")
+    symlinkSync(config.tempDir, link)
+    config.tempDir = link
+
+    expect(sweepTempDir()).toEqual([])
+    expect(existsSync(old)).toBe(true)
+  })
+
+  it("should make the work directory readable only by its owner", () => {
+    orphan("markdown-recent", 1)
+    chmodSync(config.tempDir, 0o755)
+
+    sweepTempDir()
+    expect(statSync(config.tempDir).mode & 0o777).toBe(0o700)
+  })
+
+  it("should sweep nothing when the maximum age is 0 or there is no work directory", () => {
+    const old = orphan("watermark-old", 1000)
+    config.tempMaxAgeHours = 0
+    expect(sweepTempDir()).toEqual([])
+    expect(existsSync(old)).toBe(true)
+
+    config.tempMaxAgeHours = 24
+    config.tempDir = join(baseDir, "missing")
+    expect(sweepTempDir()).toEqual([])
+  })
+})
+
+describe("getTempUsage", () => {
+  it("should add up the files in the work directory", () => {
+    config.tempMaxMb = 2
+    orphan("text-a", 1, 100)
+    orphan("text-b", 1, 250)
+
+    expect(getTempUsage()).toEqual({
+      directory: config.tempDir,
+      bytes: 350,
+      directories: 2,
+      max_bytes: 2 * 1024 * 1024,
+      max_age_hours: 24,
+    })
+  })
+
+  it("should report an empty work directory that doesn't exist yet", () => {
+    expect(getTempUsage()).toMatchObject({ bytes: 0, directories: 0, max_bytes: 0 })
+  })
+})
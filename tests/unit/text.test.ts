@@ -0,0 +1,289 @@
+/**
+ * @fileoverview Unit tests for plain text rendering (tab expansion, wrapping, and streaming)
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { mkdtempSync, readFileSync, rmSync, writeFileSync } from "fs"
+import { join } from "path"
+import { tmpdir } from "os"
+import { convertHtmlToPdf } from "../../src/utils.js"
+import {
+  buildTextHtmlHead,
+  chooseTextOrientation,
+  estimateTextPages,
+  expandTabs,
+  portraitColumns,
+  renderTextToPdf,
+  validateTabWidth,
+} from "../../src/renderers/text.js"
+import { readTextLines } from "../../src/renderers/encoding.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    allowedPaths: [],
+    deniedPaths: [],
+    header: "",
+    footer: "",
+    code: { fontSize: "10pt", lineSpacing: "1.5" },
+  },
+}))
+
+vi.mock("../../src/file-security.js", () => ({
+  validateFilePath: vi.fn(),
+}))
+
+// Run the HTML writer into a file the test can read, in place of Chrome
+vi.mock("../../src/utils.js", () => ({
+  convertHtmlToPdf: vi.fn(),
+}))
+
+const fixturesDir = join(process.cwd(), "tests", "fixtures")
+
+describe("expandTabs", () => {
+  it("should move each tab to the next stop", () => {
+    expect(expandTabs("\tx", 4)).toBe("    x")
+    expect(expandTabs("ab\tc", 4)).toBe("ab  c")
+    expect(expandTabs("abcd\te", 4)).toBe("abcd    e")
+    expect(expandTabs("a\tb", 8)).toBe("a       b")
+    expect(expandTabs("no tabs", 4)).toBe("no tabs")
+  })
+
+  it("should line up mixed tab and space indentation", () => {
+    const lines = ["\tif (x) {", "  \tif (x) {", "    if (x) {", " \t \treturn"]
+
+    expect(lines.map((line) => expandTabs(line, 4))).toEqual([
+      "    if (x) {",
+      "    if (x) {",
+      "    if (x) {",
+      "        return",
+    ])
+  })
+})
+
+describe("validateTabWidth", () => {
+  it("should accept whole numbers from 1 to 16", () => {
+    expect(() => validateTabWidth(1)).not.toThrow()
+    expect(() => validateTabWidth(16)).not.toThrow()
+  })
+
+  it("should reject other tab widths", () => {
+    expect(() => validateTabWidth(0)).toThrow(
+      "Invalid tab_width 0: use a whole number from 1 to 16."
+    )
+    expect(() => validateTabWidth(2.5)).toThrow("Invalid tab_width 2.5")
+    expect(() => validateTabWidth(17)).toThrow("Invalid tab_width 17")
+  })
+})
+
+describe("buildTextHtmlHead", () => {
+  it("should wrap at spaces by default", () => {
+    const html = buildTextHtmlHead("notes.txt")
+
+    expect(html).toContain("white-space: pre-wrap; overflow-wrap: anywhere;")
+    expect(html).toContain("font-family: Menlo, Monaco, 'Courier New'")
+    expect(html).toContain("font-size: 10pt;")
+  })
+
+  it("should use the CSS of each wrap mode", () => {
+    expect(buildTextHtmlHead("notes.txt", { wrap: "character" })).toContain(
+      "word-break: break-all;"
+    )
+    expect(buildTextHtmlHead("notes.txt", { wrap: "none" })).toContain(
+      "white-space: pre; overflow: hidden; text-overflow: ellipsis;"
+    )
+  })
+
+  it("should print the filename and page numbers when no header or footer is set", () => {
+    expect(buildTextHtmlHead("/logs/server.log")).toContain('"server.log"')
+    expect(buildTextHtmlHead("/logs/server.log", { footer: "{title}" })).not.toContain("counter")
+  })
+
+  it("should set the page size from the media", () => {
+    expect(buildTextHtmlHead("notes.txt", { media: "A4" })).toContain("size: A4;")
+    expect(buildTextHtmlHead("notes.txt")).not.toContain("size: A4;")
+  })
+
+  it("should turn the page and set the margins given", () => {
+    const html = buildTextHtmlHead("notes.txt", {
+      media: "A4",
+      orientation: "landscape",
+      margins: { left: 25 },
+    })
+    expect(html).toContain("size: A4 landscape; margin: 0.5in; margin-left: 25mm;")
+  })
+})
+
+describe("chooseTextOrientation", () => {
+  async function* lines(...text: string[]): AsyncIterable<string> {
+    yield* text
+  }
+
+  it("should count the columns a portrait page holds at the font size", () => {
+    // 8.5in less two half-inch margins, at 0.6em per character
+    expect(portraitColumns({})).toBe(90)
+    expect(portraitColumns({ fontSize: "12pt" })).toBe(75)
+    expect(portraitColumns({ media: "A4", margins: { left: 10, right: 10 } })).toBe(89)
+  })
+
+  it("should estimate the pages text fills without rendering it", () => {
+    // 11in less two half-inch margins, at 10pt with 1.5 line spacing: 48 lines a page
+    expect(estimateTextPages("line\n".repeat(48))).toBe(1)
+    expect(estimateTextPages("line\n".repeat(49))).toBe(2)
+    expect(estimateTextPages("")).toBe(1)
+    expect(estimateTextPages("line\r\n".repeat(96), { lineSpacing: "18pt" })).toBe(3)
+    expect(estimateTextPages("line\n".repeat(48), { margins: { top: 50 } })).toBe(2)
+  })
+
+  it("should count the rows long lines and tabs wrap to", () => {
+    expect(estimateTextPages(`${"x".repeat(91)}\n`.repeat(24))).toBe(1)
+    expect(estimateTextPages(`${"x".repeat(91)}\n`.repeat(25))).toBe(2)
+    expect(estimateTextPages(`${"\t".repeat(23)}\n`.repeat(25), { tabWidth: 4 })).toBe(2)
+  })
+
+  it("should choose landscape when more than a tenth of the lines are too wide", async () => {
+    const wide = "x".repeat(120)
+    const narrow = "short line"
+    expect(await chooseTextOrientation(lines(wide, ...Array(8).fill(narrow)), {})).toBe(
+      "landscape"
+    )
+    expect(await chooseTextOrientation(lines(wide, ...Array(9).fill(narrow)), {})).toBe("portrait")
+    expect(await chooseTextOrientation(lines(), {})).toBe("portrait")
+  })
+
+  it("should count expanded tabs toward a line's width", async () => {
+    const indented = "\t".repeat(12) + "x".repeat(4)
+    expect(await chooseTextOrientation(lines(indented), { tabWidth: 4 })).toBe("portrait")
+    expect(await chooseTextOrientation(lines(indented), { tabWidth: 8 })).toBe("landscape")
+  })
+})
+
+describe("renderTextToPdf", () => {
+  let tempDir: string
+
+  beforeEach(() => {
+    tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-text-test-"))
+    vi.mocked(convertHtmlToPdf).mockReset()
+    vi.mocked(convertHtmlToPdf).mockImplementation(async (htmlContent) => {
+      const htmlPath = join(tempDir, "render.html")
+      if (typeof htmlContent === "string") {
+        writeFileSync(htmlPath, htmlContent)
+      } else {
+        await htmlContent(htmlPath)
+      }
+      return htmlPath
+    })
+  })
+
+  afterEach(() => {
+    rmSync(tempDir, { recursive: true, force: true })
+  })
+
+  function textFile(name: string, content: string | Buffer): string {
+    const filePath = join(tempDir, name)
+    writeFileSync(filePath, content)
+    return filePath
+  }
+
+  it("should keep a 5000-character line whole in every wrap mode", async () => {
+    const longLine = "word ".repeat(999) + "end.."
+    const filePath = textFile("long.txt", `first\n${longLine}\nlast\n`)
+
+    for (const wrap of ["word", "character", "none"] as const) {
+      const html = readFileSync(await renderTextToPdf(filePath, { wrap }), "utf-8")
+
+      expect(longLine).toHaveLength(5000)
+      expect(html).toContain(`<div class="line">${longLine}</div>`)
+      expect(html).toContain('<div class="line">first</div>\n')
+      expect(html).toContain('<div class="line">last</div>\n')
+    }
+  })
+
+  it("should expand tabs with the tab width", async () => {
+    const filePath = textFile("indent.txt", "\tone\n  \ttwo\r\n")
+    const html = readFileSync(await renderTextToPdf(filePath, { tabWidth: 8 }), "utf-8")
+
+    expect(html).toContain(`<div class="line">${" ".repeat(8)}one</div>`)
+    expect(html).toContain(`<div class="line">${" ".repeat(8)}two</div>`)
+  })
+
+  it("should escape HTML in the text", async () => {
+    const filePath = textFile("markup.txt", "<b>&</b>\n")
+    const html = readFileSync(await renderTextToPdf(filePath), "utf-8")
+
+    expect(html).toContain('<div class="line">&lt;b&gt;&amp;&lt;/b&gt;</div>')
+  })
+
+  it("should decode text in a legacy encoding", async () => {
+    const filePath = join(fixturesDir, "encodings", "shift_jis.txt")
+    const html = readFileSync(await renderTextToPdf(filePath), "utf-8")
+
+    expect(html).toContain("東京支店：こんにちは、ソフトウェア部です。")
+  })
+
+  it("should lay out wide text in landscape when the orientation is auto", async () => {
+    const wide = textFile("wide.txt", `${"a,".repeat(60)}\n`.repeat(5))
+    const narrow = textFile("narrow.txt", "short\n".repeat(5))
+
+    expect(readFileSync(await renderTextToPdf(wide, { orientation: "auto" }), "utf-8")).toContain(
+      "size: landscape;"
+    )
+    expect(
+      readFileSync(await renderTextToPdf(narrow, { orientation: "auto" }), "utf-8")
+    ).toContain("size: portrait;")
+  })
+
+  it("should reject zero and negative margins before rendering", async () => {
+    await expect(renderTextToPdf("notes.txt", { margins: { bottom: -1 } })).rejects.toThrow(
+      "Invalid margins.bottom -1"
+    )
+    expect(convertHtmlToPdf).not.toHaveBeenCalled()
+  })
+
+  it("should reject an invalid tab width before rendering", async () => {
+    await expect(renderTextToPdf("notes.txt", { tabWidth: 0 })).rejects.toThrow(
+      "Invalid tab_width 0"
+    )
+    expect(convertHtmlToPdf).not.toHaveBeenCalled()
+  })
+})
+
+describe("readTextLines", () => {
+  it("should stream a file larger than one read without splitting characters", async () => {
+    const tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-text-test-"))
+    try {
+      const sample = readFileSync(join(fixturesDir, "encodings", "shift_jis.txt"))
+      const filePath = join(tempDir, "large.txt")
+      // Far more than one read of the stream, so lines and characters span chunk boundaries
+      writeFileSync(filePath, Buffer.concat(Array(2000).fill(sample)))
+
+      const lines: string[] = []
+      for await (const line of readTextLines(filePath, "shift_jis")) {
+        lines.push(line)
+      }
+      const decoded = new TextDecoder("shift_jis").decode(readFileSync(filePath))
+
+      expect(readFileSync(filePath).length).toBeGreaterThan(128 * 1024)
+      expect(lines).toEqual(decoded.replace(/\r?\n$/, "").split(/\r?\n/))
+      expect(lines).toContain("東京支店：こんにちは、ソフトウェア部です。")
+    } finally {
+      rmSync(tempDir, { recursive: true, force: true })
+    }
+  })
+
+  it("should strip carriage returns from CRLF line breaks", async () => {
+    const tempDir = mkdtempSync(join(tmpdir(), "mcp-printer-text-test-"))
+    try {
+      const filePath = join(tempDir, "crlf.txt")
+      writeFileSync(filePath, "one\r\ntwo\r\n\r\nthree")
+
+      const lines: string[] = []
+      for await (const line of readTextLines(filePath, "utf-8")) {
+        lines.push(line)
+      }
+
+      expect(lines).toEqual(["one", "two", "", "three"])
+    } finally {
+      rmSync(tempDir, { recursive: true, force: true })
+    }
+  })
+})
@@ -0,0 +1,137 @@
+/**
+ * @fileoverview Unit tests for operation timeouts and request cancellation, run against fake
+ * slow CUPS commands and a fake slow Chrome
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll } from "vitest"
+import { chmodSync, mkdtempSync, readdirSync, rmSync, writeFileSync } from "fs"
+import { tmpdir } from "os"
+import { join } from "path"
+import { config } from "../../src/config.js"
+import { getJobStatus, submitLpJob } from "../../src/cups.js"
+import { PrinterError } from "../../src/errors.js"
+import { abortError, operationSignal, throwIfAborted } from "../../src/timeouts.js"
+import { convertHtmlToPdf } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    submitTimeoutSeconds: 0.2,
+    statusTimeoutSeconds: 0.2,
+    chromePath: "",
+    fallbackOnRenderError: false,
+  },
+}))
+
+const TEMP_DIR_PREFIX = "mcp-printer-timeout-test-"
+
+let fakeBin = ""
+
+/**
+ * Writes an executable shell script to the fake bin directory. Scripts exec their slow command
+ * so that stopping the script stops the command too.
+ */
+function fakeCommand(name: string, script: string) {
+  const path = join(fakeBin, name)
+  writeFileSync(path, `#!/bin/sh\n${script}\n`)
+  chmodSync(path, 0o755)
+}
+
+/**
+ * Temp directories left behind by convertHtmlToPdf runs in this file.
+ */
+function leftoverTempDirs(): string[] {
+  return readdirSync(tmpdir()).filter((name) => name.startsWith(TEMP_DIR_PREFIX))
+}
+
+describe("operation timeouts", () => {
+  const originalPath = process.env.PATH
+
+  beforeAll(() => {
+    fakeBin = mkdtempSync(join(tmpdir(), "mcp-printer-fake-bin-"))
+    fakeCommand("lp", "exec sleep 5")
+    fakeCommand("lpstat", "exec sleep 5")
+    fakeCommand("chrome", "exec sleep 5")
+    process.env.PATH = `${fakeBin}:${originalPath}`
+    config.chromePath = join(fakeBin, "chrome")
+  })
+
+  afterAll(() => {
+    process.env.PATH = originalPath
+    rmSync(fakeBin, { recursive: true, force: true })
+  })
+
+  it("should stop a slow lp after the submission timeout", async () => {
+    const started = Date.now()
+    const error = await submitLpJob({ printer: "Office_HP", content: "hello" }).catch((e) => e)
+
+    expect(error).toBeInstanceOf(PrinterError)
+    expect(error.code).toBe("TIMEOUT")
+    expect(error.message).toMatch(
+      /^lp timed out after 0\.2s \(MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS\)/
+    )
+    expect(Date.now() - started).toBeLessThan(2000)
+  })
+
+  it("should stop a slow lpstat after the status timeout", async () => {
+    const error = await getJobStatus("Office_HP-1").catch((e) => e)
+
+    expect(error.code).toBe("TIMEOUT")
+    expect(error.message).toMatch(/MCP_PRINTER_STATUS_TIMEOUT_SECONDS/)
+  })
+
+  it("should stop lp when the request is canceled", async () => {
+    const controller = new AbortController()
+    const submitted = submitLpJob({ content: "hello" }, controller.signal)
+    setTimeout(() => controller.abort(), 20)
+
+    const error = await submitted.catch((e) => e)
+    expect(error).not.toBeInstanceOf(PrinterError)
+    expect(error.message).toBe("lp was canceled")
+  })
+
+  it("should remove the render's temp directory when Chrome is stopped", async () => {
+    const controller = new AbortController()
+    const rendered = convertHtmlToPdf("<p>hi</p>", {
+      tempDirPrefix: TEMP_DIR_PREFIX,
+      signal: controller.signal,
+    })
+    setTimeout(() => controller.abort(), 20)
+
+    await expect(rendered).rejects.toThrow("Rendering was canceled")
+    expect(leftoverTempDirs()).toEqual([])
+  })
+})
+
+describe("operationSignal", () => {
+  it("should follow the request's signal", () => {
+    const controller = new AbortController()
+    const signal = operationSignal("status", controller.signal)
+
+    expect(signal.aborted).toBe(false)
+    controller.abort()
+    expect(signal.aborted).toBe(true)
+  })
+
+  it("should time out with a TIMEOUT error naming the setting", async () => {
+    const signal = operationSignal("submit")
+    await new Promise((resolve) => setTimeout(resolve, 300))
+
+    expect(signal.aborted).toBe(true)
+    const error = abortError("Print-Job request to printer.local", signal)
+    expect(error).toBeInstanceOf(PrinterError)
+    expect(error.message).toBe(
+      "Print-Job request to printer.local timed out after 0.2s (MCP_PRINTER_SUBMIT_TIMEOUT_SECONDS)"
+    )
+  })
+})
+
+describe("throwIfAborted", () => {
+  it("should do nothing until the signal fires", () => {
+    const controller = new AbortController()
+    expect(() => throwIfAborted("Rendering", controller.signal)).not.toThrow()
+    expect(() => throwIfAborted("Rendering")).not.toThrow()
+
+    controller.abort()
+    expect(() => throwIfAborted("Rendering", controller.signal)).toThrow("Rendering was canceled")
+  })
+})
@@ -0,0 +1,155 @@
+/**
+ * @fileoverview Unit tests for documents sent to print_data: decoding, the size limit, media
+ * type checks against the content, and the saved file going through the print pipeline
+ */
+
+import { describe, it, expect, vi, beforeEach, afterEach } from "vitest"
+import { existsSync, mkdtempSync, readFileSync, rmSync } from "fs"
+import { tmpdir } from "os"
+import { basename, dirname, join } from "path"
+import { fileURLToPath } from "url"
+import { config } from "../../src/config.js"
+import { isTempDir } from "../../src/temp-files.js"
+import { storeUpload } from "../../src/upload.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    tempDir: "",
+    tempMaxMb: 0,
+    maxUploadBytes: 20 * 1024 * 1024,
+    allowedPaths: ["/nonexistent-allowed-dir"],
+    deniedPaths: [],
+  },
+}))
+
+const PDF_FIXTURE = join(
+  dirname(fileURLToPath(import.meta.url)),
+  "..",
+  "fixtures",
+  "pdfs",
+  "six-pages.pdf"
+)
+const PNG_BYTES = Buffer.from("89504e470d0a1a0a0000000d49484452", "hex")
+
+let baseDir = ""
+
+/**
+ * Encodes bytes or text as print_data receives them.
+ */
+function base64(data: Buffer | string): string {
+  return Buffer.from(data).toString("base64")
+}
+
+beforeEach(() => {
+  baseDir = mkdtempSync(join(tmpdir(), "mcp-printer-upload-test-"))
+  config.tempDir = join(baseDir, "work")
+  config.maxUploadBytes = 20 * 1024 * 1024
+})
+
+afterEach(() => {
+  rmSync(baseDir, { recursive: true, force: true })
+})
+
+describe("storeUpload", () => {
+  it("should round-trip a PDF through base64 into a temp directory of its own", async () => {
+    const pdf = readFileSync(PDF_FIXTURE)
+
+    const upload = storeUpload(base64(pdf), "application/pdf", "six-pages.pdf")
+
+    expect(upload).toMatchObject({ mediaType: "application/pdf", bytes: pdf.length, warnings: [] })
+    expect(basename(upload.filePath)).toBe("six-pages.pdf")
+    expect(isTempDir(dirname(upload.filePath))).toBe(true)
+    expect(readFileSync(upload.filePath).equals(pdf)).toBe(true)
+
+    // The saved file is outside the allowed paths, but the server wrote it
+    const prepared = await prepareFileForPrinting({ filePath: upload.filePath, uploaded: true })
+    expect(prepared).toMatchObject({ actualFilePath: upload.filePath, fileType: "pdf" })
+    await expect(prepareFileForPrinting({ filePath: upload.filePath })).rejects.toMatchObject({
+      code: "PERMISSION_DENIED",
+    })
+
+    cleanupRenderedPdf(upload.filePath)
+    expect(existsSync(dirname(upload.filePath))).toBe(false)
+  })
+
+  it("should ignore line breaks in the data and take the charset of text", () => {
+    const encoded = base64("Notes from the meeting\n").replace(/(.{8})/g, "$1\r\n")
+
+    const upload = storeUpload(encoded, "Text/Plain; charset=windows-1252", "notes.txt")
+
+    expect(upload).toMatchObject({ mediaType: "text/plain", encoding: "windows-1252" })
+    expect(readFileSync(upload.filePath, "utf-8")).toBe("Notes from the meeting\n")
+  })
+
+  it("should save the document under the extension of its media type, with a safe name", () => {
+    expect(basename(storeUpload(base64("# Notes"), "text/markdown", "notes.txt").filePath)).toBe(
+      "notes.md"
+    )
+    expect(
+      basename(storeUpload(base64("plain"), "text/plain", "../../etc/.passwd").filePath)
+    ).toBe("passwd.txt")
+    expect(
+      basename(storeUpload(base64("plain"), "text/plain", "Q3 report (final).txt").filePath)
+    ).toBe("Q3_report_final_.txt")
+    expect(basename(storeUpload(base64("plain"), "text/plain", "").filePath)).toBe("document.txt")
+  })
+
+  it("should refuse media types that aren't supported", () => {
+    expect(() => storeUpload(base64("PK"), "application/zip", "archive.zip")).toThrow(
+      expect.objectContaining({
+        code: "UNSUPPORTED_FORMAT",
+        message: expect.stringMatching(/unsupported mime_type "application\/zip"/),
+      })
+    )
+  })
+
+  it("should refuse empty and invalid base64 data", () => {
+    expect(() => storeUpload("", "application/pdf", "empty.pdf")).toThrow(/empty data/)
+    expect(() => storeUpload("not base64!", "application/pdf", "bad.pdf")).toThrow(
+      /expected base64-encoded bytes/
+    )
+  })
+
+  it("should refuse data over MCP_PRINTER_MAX_UPLOAD_BYTES once decoded", () => {
+    config.maxUploadBytes = 16
+
+    expect(storeUpload(base64("x".repeat(16)), "text/plain", "limit.txt").bytes).toBe(16)
+    expect(() => storeUpload(base64("x".repeat(17)), "text/plain", "over.txt")).toThrow(
+      /over\.txt: it is 0 MB once decoded, over the 0 MB limit \(MCP_PRINTER_MAX_UPLOAD_BYTES\)/
+    )
+  })
+
+  it("should refuse content that contradicts the media type", () => {
+    expect(() => storeUpload(base64(PNG_BYTES), "application/pdf", "scan.pdf")).toThrow(
+      expect.objectContaining({
+        code: "UNSUPPORTED_FORMAT",
+        message: "Cannot print scan.pdf: it was sent as application/pdf, but its content looks like png.",
+      })
+    )
+    expect(() =>
+      storeUpload(base64(Buffer.from([0, 1, 2, 3, 0, 255])), "text/plain", "blob.txt")
+    ).toThrow(/its content looks like binary data of unknown type/)
+  })
+
+  it("should print mismatched content with a warning when allow_type_mismatch is set", () => {
+    const upload = storeUpload(base64(PNG_BYTES), "application/pdf", "scan.pdf", {
+      allowTypeMismatch: true,
+    })
+
+    expect(upload.warnings).toEqual([
+      "scan.pdf was sent as application/pdf, but its content looks like png; it is printed as detected from its content",
+    ])
+    expect(readFileSync(upload.filePath).equals(PNG_BYTES)).toBe(true)
+  })
+
+  it("should accept text of any text media type", () => {
+    for (const [mimeType, name] of [
+      ["text/markdown", "notes.md"],
+      ["text/html", "page.html"],
+      ["text/csv", "table.csv"],
+    ]) {
+      expect(storeUpload(base64("a,b\n1,2\n"), mimeType, name).warnings).toEqual([])
+    }
+  })
+})
@@ -0,0 +1,263 @@
+/**
+ * @fileoverview Unit tests for print_url fetching, run against a local HTTP server
+ */
+
+import { describe, it, expect, vi, beforeAll, afterAll, beforeEach } from "vitest"
+import { createServer, type Server, type ServerResponse } from "http"
+import { readFileSync, rmSync } from "fs"
+import { dirname } from "path"
+import type { AddressInfo } from "net"
+import { config } from "../../src/config.js"
+import { convertHtmlToPdf } from "../../src/utils.js"
+import {
+  detectUrlDocumentType,
+  fetchUrl,
+  isPrivateAddress,
+  prepareUrlForPrinting,
+  validateFetchUrl,
+} from "../../src/url-fetch.js"
+
+vi.mock("../../src/config.js", () => ({
+  config: {
+    allowPrivateUrls: true,
+    urlTimeoutSeconds: 30,
+    urlMaxSizeMb: 20,
+  },
+}))
+
+vi.mock("../../src/utils.js", () => ({
+  convertHtmlToPdf: vi.fn().mockResolvedValue("/tmp/mcp-printer-url-test/output.pdf"),
+}))
+
+vi.mock("../../src/renderers/markdown.js", () => ({
+  renderMarkdownContentToPdf: vi.fn().mockResolvedValue("/tmp/mcp-printer-url-test/output.pdf"),
+}))
+
+describe("isPrivateAddress", () => {
+  const cases = [
+    { address: "127.0.0.1", expected: true },
+    { address: "10.1.2.3", expected: true },
+    { address: "172.16.0.1", expected: true },
+    { address: "172.32.0.1", expected: false },
+    { address: "192.168.1.10", expected: true },
+    { address: "169.254.169.254", expected: true },
+    { address: "100.64.0.1", expected: true },
+    { address: "0.0.0.0", expected: true },
+    { address: "8.8.8.8", expected: false },
+    { address: "::1", expected: true },
+    { address: "::", expected: true },
+    { address: "fd00::1", expected: true },
+    { address: "fe80::1", expected: true },
+    { address: "::ffff:127.0.0.1", expected: true },
+    { address: "::ffff:8.8.8.8", expected: false },
+    { address: "2606:4700:4700::1111", expected: false },
+  ]
+
+  for (const { address, expected } of cases) {
+    it(`should return ${expected} for ${address}`, () => {
+      expect(isPrivateAddress(address)).toBe(expected)
+    })
+  }
+})
+
+describe("validateFetchUrl", () => {
+  beforeEach(() => {
+    config.allowPrivateUrls = false
+  })
+
+  it("should only allow http and https", () => {
+    expect(() => validateFetchUrl(new URL("file:///etc/passwd"))).toThrow(
+      /only http and https URLs can be printed/
+    )
+    expect(() => validateFetchUrl(new URL("ftp://example.com/doc.pdf"))).toThrow(
+      /only http and https/
+    )
+  })
+
+  it("should refuse private IP literals unless private URLs are allowed", () => {
+    expect(() => validateFetchUrl(new URL("http://127.0.0.1/"))).toThrow(
+      /MCP_PRINTER_ALLOW_PRIVATE_URLS/
+    )
+    expect(() => validateFetchUrl(new URL("http://[::1]:8080/"))).toThrow(/private address ::1/)
+
+    config.allowPrivateUrls = true
+    expect(() => validateFetchUrl(new URL("http://127.0.0.1/"))).not.toThrow()
+  })
+})
+
+describe("fetchUrl", () => {
+  let server: Server
+  let baseUrl: string
+  let handler: (path: string, res: ServerResponse) => void
+
+  beforeAll(async () => {
+    server = createServer((req, res) => handler(req.url ?? "/", res))
+    await new Promise<void>((resolve) => server.listen(0, "127.0.0.1", resolve))
+    baseUrl = `http://127.0.0.1:${(server.address() as AddressInfo).port}`
+  })
+
+  afterAll(async () => {
+    server.closeAllConnections()
+    await new Promise((resolve) => server.close(resolve))
+  })
+
+  beforeEach(() => {
+    config.allowPrivateUrls = true
+    handler = (path, res) => {
+      if (path === "/doc.pdf") {
+        res.writeHead(200, { "Content-Type": "application/pdf" })
+        res.end("%PDF-1.4 test")
+      } else if (path === "/redirect") {
+        res.writeHead(302, { Location: "/doc.pdf" })
+        res.end()
+      } else {
+        res.writeHead(404)
+        res.end()
+      }
+    }
+  })
+
+  it("should download a document", async () => {
+    const fetched = await fetchUrl(`${baseUrl}/doc.pdf`)
+
+    expect(fetched.data.toString()).toBe("%PDF-1.4 test")
+    expect(fetched.contentType).toBe("application/pdf")
+    expect(fetched.url).toBe(`${baseUrl}/doc.pdf`)
+  })
+
+  it("should follow redirects", async () => {
+    const fetched = await fetchUrl(`${baseUrl}/redirect`)
+
+    expect(fetched.url).toBe(`${baseUrl}/doc.pdf`)
+  })
+
+  it("should refuse redirects to file:// URLs", async () => {
+    handler = (_path, res) => {
+      res.writeHead(302, { Location: "file:///etc/passwd" })
+      res.end()
+    }
+
+    await expect(fetchUrl(`${baseUrl}/`)).rejects.toThrow(/only http and https/)
+  })
+
+  it("should refuse hostnames that resolve to private addresses", async () => {
+    config.allowPrivateUrls = false
+    const port = (server.address() as AddressInfo).port
+
+    await expect(fetchUrl(`http://localhost:${port}/doc.pdf`)).rejects.toThrow(
+      /localhost resolves to the private address/
+    )
+  })
+
+  it("should stop after too many redirects", async () => {
+    handler = (_path, res) => {
+      res.writeHead(302, { Location: "/loop" })
+      res.end()
+    }
+
+    await expect(fetchUrl(`${baseUrl}/loop`)).rejects.toThrow(/Too many redirects/)
+  })
+
+  it("should surface HTTP errors", async () => {
+    await expect(fetchUrl(`${baseUrl}/missing`)).rejects.toThrow(/HTTP 404/)
+  })
+
+  it("should enforce the size cap from Content-Length", async () => {
+    await expect(fetchUrl(`${baseUrl}/doc.pdf`, { maxBytes: 4 })).rejects.toThrow(
+      /document is larger than/
+    )
+  })
+
+  it("should enforce the size cap while streaming", async () => {
+    handler = (_path, res) => {
+      res.writeHead(200, { "Content-Type": "text/plain" })
+      res.write("a".repeat(1024))
+      res.end("b".repeat(1024))
+    }
+
+    await expect(fetchUrl(`${baseUrl}/`, { maxBytes: 1500 })).rejects.toThrow(
+      /document is larger than/
+    )
+  })
+
+  it("should time out slow servers", async () => {
+    handler = (_path, res) => {
+      res.writeHead(200, { "Content-Type": "text/plain" })
+      res.write("partial")
+    }
+
+    await expect(fetchUrl(`${baseUrl}/`, { timeoutMs: 100 })).rejects.toThrow(/Timed out/)
+  })
+
+  it("should print plain text as-is and report what was fetched", async () => {
+    handler = (_path, res) => {
+      res.writeHead(200, { "Content-Type": "text/plain; charset=utf-8" })
+      res.end("hello from the web")
+    }
+
+    const prepared = await prepareUrlForPrinting(`${baseUrl}/notes.txt`)
+
+    expect(prepared).toMatchObject({ type: "text", bytes: 18, renderType: "" })
+    expect(prepared.tempFile).toMatch(/\/url-[^/]+\/download\.txt$/)
+    expect(readFileSync(prepared.filePath, "utf-8")).toBe("hello from the web")
+    rmSync(dirname(prepared.tempFile), { recursive: true, force: true })
+  })
+
+  it("should render HTML with JavaScript and network access disabled", async () => {
+    handler = (_path, res) => {
+      res.writeHead(200, { "Content-Type": "text/html" })
+      res.end("<html><head><title>Hi</title></head><body><h1>Hello</h1></body></html>")
+    }
+
+    const prepared = await prepareUrlForPrinting(`${baseUrl}/page`)
+
+    expect(prepared).toMatchObject({ type: "html", renderType: "html → PDF" })
+    expect(convertHtmlToPdf).toHaveBeenCalledWith(
+      expect.stringMatching(/^<html><head><meta http-equiv="Content-Security-Policy"[^>]+><title>/),
+      {
+        chromeFlags: expect.arrayContaining([
+          "--blink-settings=scriptEnabled=false",
+          "--host-resolver-rules=MAP * ~NOTFOUND",
+        ]),
+        tempDirPrefix: "url-",
+      }
+    )
+  })
+})
+
+describe("detectUrlDocumentType", () => {
+  const cases = [
+    { contentType: "application/pdf", url: "https://example.com/a", expected: "pdf" },
+    { contentType: "image/png", url: "https://example.com/a", expected: "image" },
+    { contentType: "text/html; charset=utf-8", url: "https://example.com/", expected: "html" },
+    { contentType: "text/markdown", url: "https://example.com/a", expected: "markdown" },
+    { contentType: "text/plain", url: "https://example.com/README.md", expected: "markdown" },
+    { contentType: "text/plain", url: "https://example.com/a.txt", expected: "text" },
+  ]
+
+  for (const { contentType, url, expected } of cases) {
+    it(`should detect ${contentType} at ${url} as ${expected}`, () => {
+      expect(detectUrlDocumentType({ data: Buffer.from(""), contentType, url })).toBe(expected)
+    })
+  }
+
+  it("should sniff PDFs served as application/octet-stream", () => {
+    expect(
+      detectUrlDocumentType({
+        data: Buffer.from("%PDF-1.7"),
+        contentType: "application/octet-stream",
+        url: "https://example.com/download",
+      })
+    ).toBe("pdf")
+  })
+
+  it("should reject unsupported content types", () => {
+    expect(() =>
+      detectUrlDocumentType({
+        data: Buffer.from("{}"),
+        contentType: "application/json",
+        url: "https://example.com/data",
+      })
+    ).toThrow(/unsupported content type "application\/json"/)
+  })
+})
@@ -0,0 +1,212 @@
+/**
+ * @fileoverview Unit tests for watermark stamping (incremental updates to existing PDFs)
+ */
+
+import { describe, it, expect, vi } from "vitest"
+import { existsSync, readFileSync } from "fs"
+import { basename, dirname, join } from "path"
+import { fileURLToPath } from "url"
+
+// Mock config to allow access to the fixtures, with plain text sent as it is
+vi.mock("../../src/config.js", () => {
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { dirname, join } = require("path")
+  // eslint-disable-next-line @typescript-eslint/no-require-imports
+  const { fileURLToPath } = require("url")
+  const mockTestDir = join(dirname(fileURLToPath(import.meta.url)), "..")
+
+  return {
+    config: {
+      allowedPaths: [mockTestDir],
+      deniedPaths: [],
+      autoRenderMarkdown: true,
+      autoRenderCode: true,
+      autoRenderText: false,
+      fallbackOnRenderError: false,
+      header: "",
+      footer: "",
+      code: { excludeExtensions: [] },
+    },
+    MARKDOWN_EXTENSIONS: ["md", "markdown"],
+  }
+})
+
+import {
+  buildStampContent,
+  stampWatermark,
+  validateWatermark,
+  watermarkFontSize,
+  watermarkOptions,
+} from "../../src/renderers/watermark.js"
+import { PdfDocument, PdfRef, PdfStream, isDict } from "../../src/pdf/document.js"
+import { cleanupRenderedPdf, prepareFileForPrinting } from "../../src/utils.js"
+
+const fixturesDir = join(dirname(fileURLToPath(import.meta.url)), "..", "fixtures")
+const fixture = (name: string) => join(fixturesDir, "pdfs", name)
+
+/**
+ * Reads the decoded content streams of a page, in order.
+ */
+function pageContents(document: PdfDocument, pageIndex: number): string[] {
+  const page = document.getPages()[pageIndex]
+  const contents = document.resolve(page.dict.get("Contents") ?? null)
+  const streams = Array.isArray(contents) ? contents : [contents]
+  return streams.map((stream) => {
+    const resolved = document.resolve(stream)
+    return resolved instanceof PdfStream ? document.decodeStream(resolved).toString("latin1") : ""
+  })
+}
+
+/**
+ * Reads a page's XObject resources.
+ */
+function pageXObjects(document: PdfDocument, pageIndex: number): string[] {
+  const page = document.getPages()[pageIndex]
+  const resources = document.resolve(page.dict.get("Resources") ?? null)
+  const xobjects = isDict(resources) ? document.resolve(resources.get("XObject") ?? null) : null
+  return isDict(xobjects) ? [...xobjects.keys()] : []
+}
+
+describe("stampWatermark", () => {
+  for (const name of ["form.pdf", "compressed.pdf"]) {
+    it(`should keep the pages of ${name} and append to the original bytes`, () => {
+      const original = readFileSync(fixture(name))
+      const stamped = stampWatermark(original, { text: "DRAFT" })
+      const before = new PdfDocument(original)
+      const after = new PdfDocument(stamped)
+
+      expect(after.getPages()).toHaveLength(before.getPages().length)
+      expect(stamped.subarray(0, original.length)).toEqual(original)
+      expect(after.xrefIsStream).toBe(before.xrefIsStream)
+      for (let i = 0; i < after.getPages().length; i++) {
+        const contents = pageContents(after, i)
+        expect(contents[0]).toBe("q\n")
+        expect(contents.at(-1)).toBe("q /Watermark Do Q\n")
+        expect(pageXObjects(after, i)).toContain("Watermark")
+      }
+    })
+  }
+
+  it("should keep form fields and annotations", () => {
+    const original = new PdfDocument(readFileSync(fixture("form.pdf")))
+    const stamped = new PdfDocument(stampWatermark(original.data, { text: "CONFIDENTIAL" }))
+    const catalog = stamped.resolve(stamped.trailer.get("Root") ?? null)
+    const form = isDict(catalog) ? stamped.resolve(catalog.get("AcroForm") ?? null) : null
+
+    expect(isDict(form) && Array.isArray(form.get("Fields"))).toBe(true)
+    const annots = (pages: PdfDocument) =>
+      pages.getPages().map((page) => (page.dict.get("Annots") as PdfRef[] | undefined)?.length)
+    expect(annots(stamped)).toEqual(annots(original))
+    expect(pageContents(stamped, 0).join("")).toContain(pageContents(original, 0).join(""))
+  })
+
+  it("should stamp a stamped PDF again under a new resource name", () => {
+    const once = stampWatermark(readFileSync(fixture("compressed.pdf")), { text: "DRAFT" })
+    const twice = new PdfDocument(stampWatermark(once, { text: "COPY", opacity: 0.5 }))
+
+    expect(twice.getPages()).toHaveLength(2)
+    expect(pageXObjects(twice, 0)).toEqual(expect.arrayContaining(["Watermark", "Watermark1"]))
+    expect(pageContents(twice, 0).at(-1)).toBe("q /Watermark1 Do Q\n")
+  })
+
+  it("should refuse an encrypted PDF", () => {
+    const original = readFileSync(fixture("form.pdf"))
+    const document = new PdfDocument(original)
+    const root = document.trailer.get("Root") as PdfRef
+    const offset = original.length
+    const encrypted = Buffer.concat([
+      original,
+      Buffer.from(
+        `xref\n0 0\ntrailer\n<< /Size ${document.size} /Root ${root.num} ${root.gen} R ` +
+          `/Prev ${document.startXref} /Encrypt << /Filter /Standard >> >>\n` +
+          `startxref\n${offset}\n%%EOF\n`,
+        "latin1"
+      ),
+    ])
+
+    expect(() => stampWatermark(encrypted, { text: "DRAFT" }, "secret.pdf")).toThrow(
+      "Cannot add a watermark to secret.pdf: it is encrypted."
+    )
+  })
+
+  it("should refuse a file that isn't a readable PDF", () => {
+    expect(() =>
+      stampWatermark(Buffer.from("%PDF-1.4\nnot really\n"), { text: "DRAFT" }, "broken.pdf")
+    ).toThrow("Cannot add a watermark to broken.pdf")
+  })
+})
+
+describe("buildStampContent", () => {
+  it("should run the text from corner to corner of an upright page", () => {
+    const content = buildStampContent("DRAFT", [0, 0, 612, 792], 0)
+
+    expect(content).toContain("1 0 0 1 0 0 cm\n1 0 0 1 306 396 cm")
+    expect(content).toContain("0.6114 0.7913 -0.7913 0.6114 0 0 cm")
+    expect(content).toContain("<4452414654> Tj")
+  })
+
+  it("should follow the page as shown when it is rotated", () => {
+    const content = buildStampContent("DRAFT", [0, 0, 595, 842], 90)
+
+    // Shown in landscape: 842 wide and 595 high, from the page's bottom-right corner
+    expect(content).toContain("0 1 -1 0 595 0 cm\n1 0 0 1 421 297.5 cm")
+  })
+})
+
+describe("watermarkFontSize", () => {
+  it("should shrink long text to fit the page and keep an explicit size", () => {
+    expect(watermarkFontSize("DRAFT", 612, 792)).toBe(96)
+    expect(watermarkFontSize("CONFIDENTIAL - DO NOT DISTRIBUTE", 612, 792)).toBeLessThan(96)
+    expect(watermarkFontSize("CONFIDENTIAL - DO NOT DISTRIBUTE", 612, 792, 120)).toBe(120)
+  })
+})
+
+describe("validateWatermark", () => {
+  it("should reject empty, long, and non-Latin text", () => {
+    expect(() => validateWatermark({ text: "  " })).toThrow("Invalid watermark: the text is empty.")
+    expect(() => validateWatermark({ text: "X".repeat(61) })).toThrow("at most 60 characters")
+    expect(() => validateWatermark({ text: "下書き" })).toThrow('Invalid watermark "下書き"')
+    expect(() => validateWatermark({ text: "Entwurf – Überarbeitung" })).not.toThrow()
+  })
+
+  it("should reject an opacity or font size out of range", () => {
+    expect(() => validateWatermark({ text: "DRAFT", opacity: 0 })).toThrow(
+      "Invalid watermark_opacity 0: use a number from 0.05 to 1."
+    )
+    expect(() => validateWatermark({ text: "DRAFT", fontSize: 400 })).toThrow(
+      "Invalid watermark_font_size 400: use a size from 6 to 300 points."
+    )
+  })
+
+  it("should ask for the text when only the opacity or font size is given", () => {
+    expect(watermarkOptions()).toBeUndefined()
+    expect(() => watermarkOptions(undefined, 0.5)).toThrow("need watermark")
+  })
+})
+
+describe("prepareFileForPrinting", () => {
+  it("should stamp a PDF and remove the stamped copy on cleanup", async () => {
+    const result = await prepareFileForPrinting({
+      filePath: fixture("form.pdf"),
+      watermark: { text: "DRAFT" },
+    })
+    try {
+      expect(result.renderType).toBe("watermarked")
+      expect(basename(result.actualFilePath)).toBe("form.pdf")
+      expect(result.actualFilePath).not.toBe(fixture("form.pdf"))
+      expect(new PdfDocument(readFileSync(result.actualFilePath)).getPages()).toHaveLength(3)
+    } finally {
+      cleanupRenderedPdf(result.renderedPdf)
+    }
+    expect(existsSync(result.actualFilePath)).toBe(false)
+  })
+
+  it("should refuse a watermark on text that is printed as it is", async () => {
+    await expect(
+      prepareFileForPrinting({
+        filePath: join(fixturesDir, "encodings", "windows-1252.txt"),
+        watermark: { text: "DRAFT" },
+      })
+    ).rejects.toThrow("Cannot add a watermark to windows-1252.txt: it is printed as text")
+  })
+})
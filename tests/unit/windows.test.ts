@@ -0,0 +1,240 @@
+/**
+ * @fileoverview Unit tests for the Windows print spooler backend (PowerShell is mocked)
+ */
+
+import { describe, it, expect, vi, beforeEach } from "vitest"
+import { execa } from "execa"
+import {
+  cancelWindowsJob,
+  getWindowsJobStatus,
+  inferWindowsJobState,
+  parseWindowsPrinters,
+  submitWindowsJob,
+  windowsJobToStatus,
+} from "../../src/windows.js"
+
+vi.mock("execa", () => ({
+  execa: vi.fn(),
+}))
+
+/**
+ * Returns the script, environment, and options of the nth PowerShell call.
+ */
+function powerShellCall(index = 0) {
+  const [command, args, options] = vi.mocked(execa).mock.calls[index] as unknown as [
+    string,
+    string[],
+    { env: Record<string, string>; input?: string },
+  ]
+  const script = Buffer.from(args[args.indexOf("-EncodedCommand") + 1], "base64").toString(
+    "utf16le"
+  )
+  return { command, script, env: options.env, input: options.input }
+}
+
+function mockPowerShell(stdout: string, exitCode = 0, stderr = "") {
+  vi.mocked(execa).mockResolvedValue({ stdout, stderr, exitCode } as never)
+}
+
+describe("parseWindowsPrinters", () => {
+  it("should parse Win32_Printer fields into printer summaries", () => {
+    const printers = parseWindowsPrinters(
+      JSON.stringify([
+        {
+          name: "Office HP",
+          comment: "HP LaserJet M404",
+          location: "2nd Floor",
+          default: true,
+          status: 3,
+          offline: false,
+        },
+        { name: "Microsoft Print to PDF", comment: null, location: "", status: 4 },
+        { name: "Label Printer", comment: "", default: false, status: 3, offline: true },
+        { name: "Broken", status: 2 },
+      ])
+    )
+
+    expect(printers).toEqual([
+      {
+        name: "Office HP",
+        description: "HP LaserJet M404",
+        is_default: true,
+        state: "idle",
+        accepting_jobs: true,
+        location: "2nd Floor",
+      },
+      {
+        name: "Microsoft Print to PDF",
+        description: "Microsoft Print to PDF",
+        is_default: false,
+        state: "printing",
+        accepting_jobs: true,
+      },
+      {
+        name: "Label Printer",
+        description: "Label Printer",
+        is_default: false,
+        state: "stopped",
+        accepting_jobs: true,
+        state_message: "Offline",
+      },
+      {
+        name: "Broken",
+        description: "Broken",
+        is_default: false,
+        state: "unknown",
+        accepting_jobs: true,
+      },
+    ])
+  })
+
+  it("should accept a single printer object and empty output", () => {
+    expect(parseWindowsPrinters('{"name":"Office HP","status":3}')).toHaveLength(1)
+    expect(parseWindowsPrinters("")).toEqual([])
+    expect(parseWindowsPrinters("[]")).toEqual([])
+  })
+})
+
+describe("inferWindowsJobState", () => {
+  const cases: Array<{ flags: string[]; expected: string }> = [
+    { flags: [], expected: "pending" },
+    { flags: ["paused"], expected: "held" },
+    { flags: ["spooling"], expected: "processing" },
+    { flags: ["printing", "retained"], expected: "processing" },
+    { flags: ["printed", "retained"], expected: "completed" },
+    { flags: ["error", "deleting"], expected: "canceled" },
+  ]
+
+  for (const { flags, expected } of cases) {
+    it(`should report ${expected} for [${flags.join(", ")}]`, () => {
+      expect(inferWindowsJobState(flags)).toBe(expected)
+    })
+  }
+})
+
+describe("windowsJobToStatus", () => {
+  it("should build a printer-prefixed job ID and lowercase alerts", () => {
+    expect(
+      windowsJobToStatus({
+        id: 12,
+        printer: "Office HP",
+        user: "sam",
+        size: 2048,
+        submitted: "2025-01-09T10:00:00.0000000+00:00",
+        status: "Printing, Retained",
+      })
+    ).toEqual({
+      job_id: "Office HP-12",
+      state: "processing",
+      printer: "Office HP",
+      user: "sam",
+      size: 2048,
+      submitted: "2025-01-09T10:00:00.0000000+00:00",
+      alerts: ["printing", "retained"],
+    })
+  })
+
+  it("should drop the Normal flag", () => {
+    expect(windowsJobToStatus({ id: 3, printer: "P", status: "Normal" }).alerts).toEqual([])
+  })
+})
+
+describe("submitWindowsJob", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should spool a file as RAW through winspool and return the job ID", async () => {
+    mockPowerShell('{"printer":"Office HP","job_ids":[12,13]}')
+
+    const jobId = await submitWindowsJob({
+      printer: "Office HP",
+      filePath: "C:\\Users\\sam\\Documents\\report.pdf",
+      copies: 2,
+    })
+
+    const { command, script, env, input } = powerShellCall()
+    expect(jobId).toBe("Office HP-12")
+    expect(command).toBe("powershell.exe")
+    expect(script).toContain("StartDocPrinter")
+    expect(script).toContain('info.pDataType = "RAW"')
+    expect(env).toEqual({
+      MCP_PRINTER_PS_PRINTER: "Office HP",
+      MCP_PRINTER_PS_FILE: "C:\\Users\\sam\\Documents\\report.pdf",
+      MCP_PRINTER_PS_TITLE: "report.pdf",
+      MCP_PRINTER_PS_COPIES: "2",
+    })
+    expect(input).toBeUndefined()
+  })
+
+  it("should stream content over stdin and default to the default printer", async () => {
+    mockPowerShell('{"printer":"Office HP","job_ids":5}')
+
+    const jobId = await submitWindowsJob({ content: "hello", title: "Note" })
+
+    const { env, input } = powerShellCall()
+    expect(jobId).toBe("Office HP-5")
+    expect(env.MCP_PRINTER_PS_PRINTER).toBe("")
+    expect(env.MCP_PRINTER_PS_TITLE).toBe("Note")
+    expect(input).toBe("hello")
+  })
+
+  it("should report spooler errors", async () => {
+    mockPowerShell("", 1, "OpenPrinter failed for Nope")
+
+    await expect(submitWindowsJob({ printer: "Nope", content: "x" })).rejects.toThrow(
+      /PowerShell failed: OpenPrinter failed for Nope/
+    )
+  })
+
+  it("should refuse to hold jobs rather than print them right away", async () => {
+    await expect(
+      submitWindowsJob({ content: "x", options: ["job-hold-until=indefinite"] })
+    ).rejects.toThrow(/can't hold jobs/)
+    expect(execa).not.toHaveBeenCalled()
+  })
+})
+
+describe("getWindowsJobStatus", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should look up the job by printer and number", async () => {
+    mockPowerShell('{"id":12,"printer":"Office-HP","status":"Spooling"}')
+
+    const status = await getWindowsJobStatus("Office-HP-12")
+
+    expect(status).toMatchObject({ job_id: "Office-HP-12", state: "processing" })
+    expect(powerShellCall().env).toEqual({
+      MCP_PRINTER_PS_PRINTER: "Office-HP",
+      MCP_PRINTER_PS_ID: "12",
+    })
+  })
+
+  it("should search every printer for a bare job number", async () => {
+    mockPowerShell("")
+
+    expect(await getWindowsJobStatus("12")).toEqual({ job_id: "12", state: "not-found" })
+    expect(powerShellCall().env.MCP_PRINTER_PS_PRINTER).toBe("")
+  })
+
+  it("should reject job IDs without a job number", async () => {
+    await expect(getWindowsJobStatus("Office HP")).rejects.toThrow(/Invalid job ID/)
+    expect(execa).not.toHaveBeenCalled()
+  })
+})
+
+describe("cancelWindowsJob", () => {
+  beforeEach(() => {
+    vi.mocked(execa).mockReset()
+  })
+
+  it("should remove the job with Remove-PrintJob", async () => {
+    mockPowerShell("")
+
+    await cancelWindowsJob("Office HP-12")
+
+    expect(powerShellCall().script).toContain("Remove-PrintJob -InputObject $job")
+  })
+})